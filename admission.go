@@ -0,0 +1,48 @@
+package orus
+
+import (
+	"time"
+)
+
+// AdmissionPolicy limits how many requests of a kind run at once. Excess
+// requests wait in a bounded queue for at most QueueTimeout; when the queue
+// is full or the wait expires they are answered 503 with a Retry-After.
+// A limit of 0 disables admission control.
+type AdmissionPolicy struct {
+	Limit        int           `yaml:"limit"`
+	QueueDepth   int           `yaml:"queue"`
+	QueueTimeout time.Duration `yaml:"queue_timeout"`
+	// KeyQueueDepth caps the queued requests of one caller, so a batch job
+	// cannot fill the queue for everyone; 0 leaves only QueueDepth.
+	KeyQueueDepth int `yaml:"key_queue"`
+}
+
+// DefaultRateLimitWindow is the window of a rate limit without one.
+const DefaultRateLimitWindow = time.Minute
+
+// RateLimitPolicy caps the requests each caller sends to the REST API in a
+// window; 0 Requests disables the limit.
+type RateLimitPolicy struct {
+	Requests int           `yaml:"requests"`
+	Window   time.Duration `yaml:"window"`
+}
+
+// DefaultStreamsPerCaller is how many event streams a caller may keep open
+// at once by default.
+const DefaultStreamsPerCaller = 16
+
+// StreamLimitPolicy caps the event streams open at once, in all and for each
+// caller, so a client that never closes its streams cannot exhaust the file
+// descriptors of the server; 0 disables a cap.
+type StreamLimitPolicy struct {
+	Total     int `yaml:"total" json:"total"`
+	PerCaller int `yaml:"per_caller" json:"per_caller"`
+}
+
+func DefaultGenerationAdmission() AdmissionPolicy {
+	return AdmissionPolicy{Limit: 4, QueueDepth: 32, QueueTimeout: 30 * time.Second}
+}
+
+func DefaultEmbeddingAdmission() AdmissionPolicy {
+	return AdmissionPolicy{Limit: 8, QueueDepth: 64, QueueTimeout: 10 * time.Second}
+}
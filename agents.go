@@ -0,0 +1,367 @@
+package orus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Dsouza10082/orus/ollama"
+	"go.yaml.in/yaml/v3"
+)
+
+const (
+	// maxAgentDepth bounds how deep supervisors may delegate.
+	maxAgentDepth = 4
+	// delegateToolName is the tool a supervisor calls to hand a subtask to a
+	// worker.
+	delegateToolName = "delegate"
+)
+
+const supervisorPrompt = `You coordinate a team of agents. Break the task into subtasks and hand each one to the best suited agent with the delegate tool; you may delegate several times and build on earlier results. When you have what you need, answer the task yourself, synthesizing the results.
+
+Agents:
+`
+
+// ErrAgentDepth is returned to a supervisor delegating deeper than
+// maxAgentDepth.
+var ErrAgentDepth = errors.New("the delegation is too deep")
+
+// Agent is a named model with a persona. An agent with workers is a
+// supervisor: it delegates subtasks to them and synthesizes their results.
+type Agent struct {
+	Name string `yaml:"name" json:"name"`
+	// Description tells a supervisor what the agent is good at.
+	Description string `yaml:"description" json:"description,omitempty"`
+	Model       string `yaml:"model" json:"model"`
+	// Persona is the system prompt of the agent.
+	Persona string `yaml:"persona" json:"persona,omitempty"`
+	// Tools are the registered tools the agent may call.
+	Tools []string `yaml:"tools" json:"tools,omitempty"`
+	// Memory recalls the long-term memories of the agent for the user of a
+	// run, and stores what it learns.
+	Memory  bool     `yaml:"memory" json:"memory,omitempty"`
+	Cloud   bool     `yaml:"cloud" json:"cloud,omitempty"`
+	Workers []string `yaml:"workers" json:"workers,omitempty"`
+}
+
+type AgentsFile struct {
+	Agents []Agent `yaml:"agents"`
+}
+
+// AgentNode is an agent invocation of a run. Parent is the node of the
+// supervisor that delegated it, so the nodes form the conversation graph.
+type AgentNode struct {
+	ID        string           `json:"id"`
+	Parent    string           `json:"parent,omitempty"`
+	Agent     string           `json:"agent"`
+	Model     string           `json:"model"`
+	Task      string           `json:"task"`
+	Answer    string           `json:"answer,omitempty"`
+	Error     string           `json:"error,omitempty"`
+	Messages  []ollama.Message `json:"messages"`
+	ToolTrace []ToolStep       `json:"tool_trace"`
+	Memories  int              `json:"memories,omitempty"`
+	TimeTaken string           `json:"time_taken"`
+}
+
+// AgentRun is the result of a run: the answer of the agent it started with
+// and every node, in the order they finished.
+type AgentRun struct {
+	Agent     string      `json:"agent"`
+	Answer    string      `json:"answer"`
+	Nodes     []AgentNode `json:"nodes"`
+	TimeTaken string      `json:"time_taken"`
+}
+
+// Agents holds the agents of the agents file and runs them.
+type Agents struct {
+	orus   *Orus
+	mu     sync.RWMutex
+	agents map[string]*Agent
+	path   string
+}
+
+// LoadAgents returns the agents of the file at path; an empty path defines
+// none.
+func LoadAgents(orus *Orus, path string) (*Agents, error) {
+	agents := &Agents{orus: orus, agents: make(map[string]*Agent), path: path}
+	if path == "" {
+		return agents, nil
+	}
+	if err := agents.Reload(); err != nil {
+		return agents, err
+	}
+	return agents, nil
+}
+
+// Reload reads the agents file again and swaps in its agents. On error the
+// current agents are kept.
+func (a *Agents) Reload() error {
+	if a.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(a.path)
+	if err != nil {
+		return fmt.Errorf("error reading agents file: %w", err)
+	}
+	var file AgentsFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("error decoding agents file: %w", err)
+	}
+	agents := make(map[string]*Agent, len(file.Agents))
+	for i := range file.Agents {
+		agent := &file.Agents[i]
+		if !toolNamePattern.MatchString(agent.Name) {
+			return fmt.Errorf("agent name %q must be 1 to 64 letters, digits, '_' or '-'", agent.Name)
+		}
+		if agent.Model == "" {
+			return fmt.Errorf("agent %q: a model is required", agent.Name)
+		}
+		if _, ok := agents[agent.Name]; ok {
+			return fmt.Errorf("agent %q is defined twice", agent.Name)
+		}
+		agents[agent.Name] = agent
+	}
+	for _, agent := range agents {
+		for _, worker := range agent.Workers {
+			if _, ok := agents[worker]; !ok {
+				return fmt.Errorf("agent %q: unknown worker %q", agent.Name, worker)
+			}
+		}
+	}
+	for _, agent := range agents {
+		if cycle := agentCycle(agents, agent.Name, nil); cycle != nil {
+			return fmt.Errorf("agents delegate in a cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	a.mu.Lock()
+	a.agents = agents
+	a.mu.Unlock()
+	return nil
+}
+
+// agentCycle returns the delegation path back to an agent of path, or nil.
+func agentCycle(agents map[string]*Agent, name string, path []string) []string {
+	for _, seen := range path {
+		if seen == name {
+			return append(path, name)
+		}
+	}
+	path = append(path, name)
+	for _, worker := range agents[name].Workers {
+		if cycle := agentCycle(agents, worker, path); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// List returns the agents sorted by name.
+func (a *Agents) List() []*Agent {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	agents := make([]*Agent, 0, len(a.agents))
+	for _, agent := range a.agents {
+		agents = append(agents, agent)
+	}
+	sort.Slice(agents, func(i, j int) bool {
+		return agents[i].Name < agents[j].Name
+	})
+	return agents
+}
+
+func (a *Agents) Get(name string) (*Agent, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	agent, ok := a.agents[name]
+	return agent, ok
+}
+
+// agentRun collects the nodes of a run as they finish.
+type agentRun struct {
+	mu        sync.Mutex
+	nodes     []AgentNode
+	next      int
+	userID    string
+	maxRounds int
+	onNode    func(AgentNode)
+}
+
+func (r *agentRun) nextID() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.next++
+	return fmt.Sprintf("n%d", r.next)
+}
+
+func (r *agentRun) finish(node AgentNode) {
+	r.mu.Lock()
+	r.nodes = append(r.nodes, node)
+	r.mu.Unlock()
+	if r.onNode != nil {
+		r.onNode(node)
+	}
+}
+
+// Run has the named agent answer task for userID. Supervisors delegate to
+// their workers through the delegate tool, each delegation being a node of
+// the run. onNode, when not nil, sees every node as it finishes. A run that
+// fails returns the nodes finished so far.
+func (a *Agents) Run(ctx context.Context, agent *Agent, task, userID string, maxRounds int, onNode func(AgentNode)) (*AgentRun, error) {
+	startTime := time.Now()
+	state := &agentRun{userID: userID, maxRounds: maxRounds, onNode: onNode}
+	answer, err := a.runAgent(ctx, state, agent, task, "", 0)
+	run := &AgentRun{Agent: agent.Name, Answer: answer, Nodes: state.nodes, TimeTaken: time.Since(startTime).String()}
+	return run, err
+}
+
+func (a *Agents) runAgent(ctx context.Context, state *agentRun, agent *Agent, task, parent string, depth int) (string, error) {
+	startTime := time.Now()
+	node := AgentNode{
+		ID:        state.nextID(),
+		Parent:    parent,
+		Agent:     agent.Name,
+		Model:     agent.Model,
+		Task:      task,
+		ToolTrace: make([]ToolStep, 0),
+	}
+
+	messages := make([]ollama.Message, 0, 3)
+	if system := a.systemPrompt(agent); system != "" {
+		messages = append(messages, ollama.Message{Role: "system", Content: system})
+	}
+	if agent.Memory && a.orus.Memory != nil {
+		memories, err := a.orus.Memory.Recall(agent.Name, state.userID, task)
+		if err != nil {
+			log.Println("Error recalling agent memory: ", err)
+		} else if len(memories) > 0 {
+			node.Memories = len(memories)
+			messages = append(messages, MemoryMessage(memories))
+		}
+	}
+	messages = append(messages, ollama.Message{Role: "user", Content: task})
+	req := ollama.ChatRequest{Model: agent.Model, Messages: messages}
+
+	client := a.orus.Backend.WithContext(ctx)
+	chat := client.Chat
+	if agent.Cloud {
+		chat = client.ChatCloud
+	}
+	// The tool loop adds the calls and results to the messages; the last
+	// request sent is kept as the conversation of the node
+	var last ollama.ChatRequest
+	recorded := func(req ollama.ChatRequest) (*ollama.ChatResponse, error) {
+		last = req
+		return chat(req)
+	}
+
+	var response *ollama.ChatResponse
+	extra := make([]Tool, 0, 1)
+	if len(agent.Workers) > 0 {
+		extra = append(extra, a.delegateTool(state, agent, node.ID, depth))
+	}
+	tools, err := a.orus.Tools.Subset(agent.Tools, extra...)
+	if err == nil {
+		if names := tools.Names(); len(names) == 0 {
+			response, err = recorded(req)
+		} else {
+			req.Tools, _ = tools.Definitions(names)
+			response, node.ToolTrace, err = tools.RunTools(ctx, req, recorded, state.maxRounds, nil, nil)
+		}
+	}
+
+	node.Messages = last.Messages
+	if node.Messages == nil {
+		node.Messages = messages
+	}
+	if err != nil {
+		node.Error = err.Error()
+	} else {
+		node.Answer = response.Message.Content
+		node.Messages = append(node.Messages, ollama.Message{Role: "assistant", Content: node.Answer})
+	}
+	node.TimeTaken = time.Since(startTime).String()
+	state.finish(node)
+	if err != nil {
+		return "", fmt.Errorf("agent %s: %w", agent.Name, err)
+	}
+
+	if agent.Memory && a.orus.Memory != nil {
+		exchange := []ollama.Message{{Role: "user", Content: task}, {Role: "assistant", Content: node.Answer}}
+		go func() {
+			if _, err := a.orus.Memory.RememberConversation(agent.Name, state.userID, agent.Model, exchange); err != nil {
+				log.Println("Error storing agent memory: ", err)
+			}
+		}()
+	}
+	return node.Answer, nil
+}
+
+// systemPrompt is the persona of agent, followed for a supervisor by its
+// workers and what they do.
+func (a *Agents) systemPrompt(agent *Agent) string {
+	if len(agent.Workers) == 0 {
+		return agent.Persona
+	}
+	sb := &strings.Builder{}
+	if agent.Persona != "" {
+		sb.WriteString(agent.Persona)
+		sb.WriteString("\n\n")
+	}
+	sb.WriteString(supervisorPrompt)
+	for _, name := range agent.Workers {
+		description := ""
+		if worker, ok := a.Get(name); ok {
+			description = worker.Description
+		}
+		fmt.Fprintf(sb, "- %s: %s\n", name, description)
+	}
+	return sb.String()
+}
+
+// delegateTool runs a worker of supervisor on a subtask, as a child node of
+// parent, and returns its answer.
+func (a *Agents) delegateTool(state *agentRun, supervisor *Agent, parent string, depth int) Tool {
+	workers := make([]interface{}, 0, len(supervisor.Workers))
+	for _, worker := range supervisor.Workers {
+		workers = append(workers, worker)
+	}
+	return Tool{
+		Name:        delegateToolName,
+		Description: "Hands a self-contained subtask to an agent of the team and returns its answer. The agent does not see this conversation, so include everything it needs in the task.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"agent": map[string]interface{}{
+					"type":        "string",
+					"description": "The agent to delegate to",
+					"enum":        workers,
+				},
+				"task": map[string]interface{}{
+					"type":        "string",
+					"description": "The subtask, with the context it needs",
+					"minLength":   1.0,
+				},
+			},
+			"required": []interface{}{"agent", "task"},
+		},
+		Run: func(ctx context.Context, arguments map[string]interface{}) (string, error) {
+			if depth+1 >= maxAgentDepth {
+				return "", ErrAgentDepth
+			}
+			name, _ := arguments["agent"].(string)
+			task, _ := arguments["task"].(string)
+			worker, ok := a.Get(name)
+			if !ok {
+				return "", fmt.Errorf("unknown agent %q", name)
+			}
+			return a.runAgent(ctx, state, worker, task, parent, depth+1)
+		},
+	}
+}
@@ -0,0 +1,328 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Dsouza10082/orus"
+)
+
+// Priority orders the queued requests: a request is only admitted when no
+// request of a higher priority waits.
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+	priorityCount
+)
+
+var priorityNames = [priorityCount]string{"low", "normal", "high"}
+
+func (p Priority) String() string {
+	return priorityNames[p]
+}
+
+// ParsePriority reads "low", "normal" or "high".
+func ParsePriority(name string) (Priority, bool) {
+	index := slices.Index(priorityNames[:], strings.ToLower(strings.TrimSpace(name)))
+	return Priority(index), index >= 0
+}
+
+// Admission is the scheduler shared by every route of a kind, so the UI and
+// the API compete for the same Ollama capacity. Queued requests are admitted
+// by priority and, within a priority, round-robin between callers, each
+// caller's requests in arrival order.
+type Admission struct {
+	name     string
+	priority func(*http.Request) Priority
+
+	mu      sync.Mutex
+	policy  orus.AdmissionPolicy
+	running int
+	queued  int
+	queues  [priorityCount]fairQueue
+}
+
+// admissionWaiter is a queued request, admitted by closing ready.
+type admissionWaiter struct {
+	key      string
+	priority Priority
+	ready    chan struct{}
+	admitted bool
+}
+
+// fairQueue holds the waiters of one priority per caller, serving the
+// callers in turn.
+type fairQueue struct {
+	keys    []string
+	next    int
+	waiters map[string][]*admissionWaiter
+}
+
+func NewAdmission(name string, policy orus.AdmissionPolicy) *Admission {
+	a := &Admission{name: name}
+	for i := range a.queues {
+		a.queues[i].waiters = make(map[string][]*admissionWaiter)
+	}
+	a.SetPolicy(policy)
+	return a
+}
+
+// SetPriority sets how the priority of a request is chosen; without it every
+// request is PriorityNormal.
+func (a *Admission) SetPriority(priority func(*http.Request) Priority) *Admission {
+	a.priority = priority
+	return a
+}
+
+// SetPolicy replaces the policy. Requests already running finish under a
+// lower limit, and queued ones are admitted as soon as the new limit allows.
+func (a *Admission) SetPolicy(policy orus.AdmissionPolicy) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.policy = policy
+	if policy.Limit <= 0 {
+		// Without a limit nobody has to wait
+		for a.queued > 0 {
+			a.admit(a.pop())
+		}
+		return
+	}
+	a.dispatch()
+}
+
+func (a *Admission) Policy() orus.AdmissionPolicy {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.policy
+}
+
+// InFlight returns the number of admitted requests and of queued ones.
+func (a *Admission) InFlight() (running int, queued int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.running, a.queued
+}
+
+// AdmissionStats is the state of the queue of an admission.
+type AdmissionStats struct {
+	Name    string `json:"name"`
+	Limit   int    `json:"limit"`
+	Running int    `json:"running"`
+	Queued  int    `json:"queued"`
+	// QueuedByPriority and QueuedByCaller break the queue down; callers are
+	// "key:<fingerprint>" or "ip:<address>".
+	QueuedByPriority map[string]int `json:"queued_by_priority"`
+	QueuedByCaller   map[string]int `json:"queued_by_caller"`
+}
+
+func (a *Admission) Stats() AdmissionStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	stats := AdmissionStats{
+		Name:             a.name,
+		Limit:            a.policy.Limit,
+		Running:          a.running,
+		Queued:           a.queued,
+		QueuedByPriority: make(map[string]int, priorityCount),
+		QueuedByCaller:   make(map[string]int),
+	}
+	for priority, queue := range a.queues {
+		stats.QueuedByPriority[Priority(priority).String()] = 0
+		for key, waiters := range queue.waiters {
+			stats.QueuedByPriority[Priority(priority).String()] += len(waiters)
+			stats.QueuedByCaller[key] += len(waiters)
+		}
+	}
+	return stats
+}
+
+func (a *Admission) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		priority := PriorityNormal
+		if a.priority != nil {
+			priority = a.priority(r)
+		}
+		waiter, policy, reason := a.enqueue(fairnessKey(r), priority)
+		if reason != "" {
+			a.reject(w, policy, reason)
+			return
+		}
+		if waiter == nil {
+			defer a.release()
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		queuedAt := time.Now()
+		timer := time.NewTimer(policy.QueueTimeout)
+		defer timer.Stop()
+		select {
+		case <-waiter.ready:
+			defer a.release()
+			orus.AddPhase(r.Context(), orus.PhaseQueue, queuedAt)
+			next.ServeHTTP(w, r)
+		case <-timer.C:
+			if a.leave(waiter) {
+				a.reject(w, policy, fmt.Sprintf("waited %s in queue", policy.QueueTimeout))
+				return
+			}
+			// Admitted as the wait expired
+			defer a.release()
+			orus.AddPhase(r.Context(), orus.PhaseQueue, queuedAt)
+			next.ServeHTTP(w, r)
+		case <-r.Context().Done():
+			if !a.leave(waiter) {
+				a.release()
+			}
+		}
+	})
+}
+
+// enqueue admits the request at once, returning a nil waiter, or queues it.
+// A rejected request gets the reason.
+func (a *Admission) enqueue(key string, priority Priority) (*admissionWaiter, orus.AdmissionPolicy, string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	policy := a.policy
+	if policy.Limit <= 0 || (a.running < policy.Limit && a.queued == 0) {
+		a.running++
+		return nil, policy, ""
+	}
+	if a.queued >= policy.QueueDepth {
+		return nil, policy, "queue is full"
+	}
+	if policy.KeyQueueDepth > 0 && a.queuedBy(key) >= policy.KeyQueueDepth {
+		return nil, policy, "too many queued requests from this caller"
+	}
+	waiter := &admissionWaiter{key: key, priority: priority, ready: make(chan struct{})}
+	a.queues[priority].push(waiter)
+	a.queued++
+	return waiter, policy, ""
+}
+
+func (a *Admission) queuedBy(key string) int {
+	queued := 0
+	for _, queue := range a.queues {
+		queued += len(queue.waiters[key])
+	}
+	return queued
+}
+
+// leave takes a waiter out of the queue, and reports false when it had
+// already been admitted.
+func (a *Admission) leave(waiter *admissionWaiter) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if waiter.admitted {
+		return false
+	}
+	a.queues[waiter.priority].remove(waiter)
+	a.queued--
+	return true
+}
+
+func (a *Admission) release() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.running--
+	a.dispatch()
+}
+
+// dispatch admits queued requests while the limit allows.
+func (a *Admission) dispatch() {
+	for a.queued > 0 && a.running < a.policy.Limit {
+		a.admit(a.pop())
+	}
+}
+
+func (a *Admission) admit(waiter *admissionWaiter) {
+	a.running++
+	waiter.admitted = true
+	close(waiter.ready)
+}
+
+// pop takes the next waiter of the highest priority with waiters.
+func (a *Admission) pop() *admissionWaiter {
+	for priority := priorityCount - 1; priority >= 0; priority-- {
+		if waiter := a.queues[priority].pop(); waiter != nil {
+			a.queued--
+			return waiter
+		}
+	}
+	return nil
+}
+
+func (q *fairQueue) push(waiter *admissionWaiter) {
+	if _, ok := q.waiters[waiter.key]; !ok {
+		q.keys = append(q.keys, waiter.key)
+	}
+	q.waiters[waiter.key] = append(q.waiters[waiter.key], waiter)
+}
+
+// pop takes the oldest waiter of the caller whose turn it is.
+func (q *fairQueue) pop() *admissionWaiter {
+	if len(q.keys) == 0 {
+		return nil
+	}
+	if q.next >= len(q.keys) {
+		q.next = 0
+	}
+	key := q.keys[q.next]
+	waiter := q.waiters[key][0]
+	if len(q.waiters[key]) == 1 {
+		// The next caller moves into this position
+		delete(q.waiters, key)
+		q.keys = slices.Delete(q.keys, q.next, q.next+1)
+	} else {
+		q.waiters[key] = q.waiters[key][1:]
+		q.next++
+	}
+	return waiter
+}
+
+func (q *fairQueue) remove(waiter *admissionWaiter) {
+	waiters := slices.DeleteFunc(q.waiters[waiter.key], func(w *admissionWaiter) bool { return w == waiter })
+	if len(waiters) > 0 {
+		q.waiters[waiter.key] = waiters
+		return
+	}
+	delete(q.waiters, waiter.key)
+	index := slices.Index(q.keys, waiter.key)
+	q.keys = slices.Delete(q.keys, index, index+1)
+	if index < q.next {
+		q.next--
+	}
+}
+
+// fairnessKey identifies the caller a request is scheduled for: its API key
+// or, without one, its address without the port.
+func fairnessKey(r *http.Request) string {
+	if orus.RequestAPIKey(r) != "" {
+		return orus.CallerKey(r)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+func (a *Admission) reject(w http.ResponseWriter, policy orus.AdmissionPolicy, reason string) {
+	retryAfter := int(math.Ceil(policy.QueueTimeout.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	respondError(w, http.StatusServiceUnavailable, "server_busy",
+		fmt.Sprintf("Too many concurrent %s requests (%s), please retry later", a.name, reason))
+}
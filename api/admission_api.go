@@ -0,0 +1,28 @@
+package api
+
+import (
+	"net/http"
+	"time"
+)
+
+// GetSchedulerStats godoc
+// @Summary      Returns the generation and embedding queues
+// @Description  Returns the limit, running and queued requests of the generation and embedding schedulers, with the queue broken down by priority and by caller. Requires an admin key (ORUS_API_ADMIN_KEYS) in the X-Admin-Key header
+// @Tags         config
+// @Produce      json
+// @Param        X-Admin-Key  header    string  true  "Admin key"
+// @Success      200  {object}  OrusResponse
+// @Failure      401  {object}  OrusResponse
+// @Failure      403  {object}  OrusResponse
+// @Router       /orus-api/v1/scheduler [get]
+func (s *OrusAPI) GetSchedulerStats(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{
+		"generation": s.GenerationAdmission.Stats(),
+		"embedding":  s.EmbeddingAdmission.Stats(),
+	}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Scheduler stats retrieved successfully"
+	respondJSON(w, http.StatusOK, response)
+}
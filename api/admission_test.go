@@ -0,0 +1,159 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Dsouza10082/orus"
+)
+
+// admitted returns the waiters, named by their key and priority, in the
+// order releasing the running request one at a time admits them.
+func admitted(t *testing.T, a *Admission, waiters []*admissionWaiter) []string {
+	t.Helper()
+	seen := make(map[*admissionWaiter]bool, len(waiters))
+	order := make([]string, 0, len(waiters))
+	for range waiters {
+		a.release()
+		var next *admissionWaiter
+		for _, waiter := range waiters {
+			select {
+			case <-waiter.ready:
+				if !seen[waiter] {
+					next = waiter
+				}
+			default:
+			}
+		}
+		if next == nil {
+			t.Fatal("releasing a request admitted nobody")
+		}
+		seen[next] = true
+		order = append(order, next.key+"/"+next.priority.String())
+	}
+	return order
+}
+
+func TestAdmissionFairOrder(t *testing.T) {
+	a := NewAdmission("generation", orus.AdmissionPolicy{Limit: 1, QueueDepth: 10})
+	if waiter, _, reason := a.enqueue("a", PriorityNormal); waiter != nil || reason != "" {
+		t.Fatal("the first request was not admitted at once")
+	}
+	var waiters []*admissionWaiter
+	for _, request := range []struct {
+		key      string
+		priority Priority
+	}{
+		{"a", PriorityNormal},
+		{"a", PriorityNormal},
+		{"a", PriorityNormal},
+		{"b", PriorityNormal},
+		{"c", PriorityLow},
+		{"c", PriorityNormal},
+		{"d", PriorityHigh},
+	} {
+		waiter, _, reason := a.enqueue(request.key, request.priority)
+		if waiter == nil || reason != "" {
+			t.Fatalf("%s was not queued: %q", request.key, reason)
+		}
+		waiters = append(waiters, waiter)
+	}
+	if stats := a.Stats(); stats.Running != 1 || stats.Queued != 7 || stats.QueuedByCaller["a"] != 3 || stats.QueuedByPriority["high"] != 1 {
+		t.Fatalf("stats %+v", stats)
+	}
+
+	// the high priority first, then the callers in turn, the low priority last
+	got := admitted(t, a, waiters)
+	want := []string{"d/high", "a/normal", "b/normal", "c/normal", "a/normal", "a/normal", "c/low"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("admitted %v, want %v", got, want)
+	}
+	if running, queued := a.InFlight(); running != 1 || queued != 0 {
+		t.Fatalf("%d running and %d queued, want 1 and 0", running, queued)
+	}
+}
+
+func TestAdmissionQueueLimits(t *testing.T) {
+	a := NewAdmission("generation", orus.AdmissionPolicy{Limit: 1, QueueDepth: 3, KeyQueueDepth: 2})
+	a.enqueue("a", PriorityNormal)
+	first, _, _ := a.enqueue("a", PriorityNormal)
+	a.enqueue("a", PriorityNormal)
+	if _, _, reason := a.enqueue("a", PriorityNormal); reason == "" {
+		t.Fatal("a caller queued more than its queue depth")
+	}
+	a.enqueue("b", PriorityNormal)
+	if _, _, reason := a.enqueue("c", PriorityNormal); reason != "queue is full" {
+		t.Fatalf("rejected with %q, want a full queue", reason)
+	}
+
+	// a waiter that leaves frees its place
+	if !a.leave(first) {
+		t.Fatal("a queued waiter was reported admitted")
+	}
+	if waiter, _, reason := a.enqueue("c", PriorityNormal); waiter == nil || reason != "" {
+		t.Fatalf("not queued after a waiter left: %q", reason)
+	}
+
+	// lifting the limit admits everyone
+	a.SetPolicy(orus.AdmissionPolicy{})
+	if running, queued := a.InFlight(); running != 4 || queued != 0 {
+		t.Fatalf("%d running and %d queued, want 4 and 0", running, queued)
+	}
+}
+
+func TestAdmissionMiddleware(t *testing.T) {
+	a := NewAdmission("generation", orus.AdmissionPolicy{Limit: 2, QueueDepth: 16, QueueTimeout: 10 * time.Second})
+	release := make(chan struct{})
+	var mu sync.Mutex
+	running, peak := 0, 0
+	handler := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+		<-release
+		mu.Lock()
+		running--
+		mu.Unlock()
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+		}()
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if running, queued := a.InFlight(); running == 2 && queued == 6 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the requests were not queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	if peak != 2 {
+		t.Fatalf("%d requests ran at once, want 2", peak)
+	}
+	if running, queued := a.InFlight(); running != 0 || queued != 0 {
+		t.Fatalf("%d running and %d queued once done, want 0 and 0", running, queued)
+	}
+
+	// a request that waits longer than the queue timeout is answered 503
+	a.SetPolicy(orus.AdmissionPolicy{Limit: 1, QueueDepth: 1, QueueTimeout: 10 * time.Millisecond})
+	a.enqueue("other", PriorityNormal)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("answered %d with Retry-After %q, want 503", w.Code, w.Header().Get("Retry-After"))
+	}
+}
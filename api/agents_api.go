@@ -0,0 +1,119 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Dsouza10082/orus"
+	"github.com/go-chi/chi/v5"
+)
+
+// AgentRunRequest is the body of a multi-agent run.
+type AgentRunRequest struct {
+	Task string `json:"task" swaggertype:"string" example:"Compare the climate of Lisbon and Porto"`
+	// UserID selects the long-term memories of the agents with memory.
+	UserID string `json:"user_id" swaggertype:"string" example:"user-42"`
+	// Stream sends every finished agent as an agent event, then the run in
+	// the done event.
+	Stream bool `json:"stream" swaggertype:"boolean" example:"false"`
+}
+
+func (r *AgentRunRequest) Validate() *orus.ValidationError {
+	if strings.TrimSpace(r.Task) == "" {
+		return &orus.ValidationError{Code: "missing_task", Field: "task", Message: "Field 'task' is required"}
+	}
+	return nil
+}
+
+// ListAgents godoc
+// @Summary      Lists the agents
+// @Description  Lists the agents read from ORUS_API_AGENTS_PATH, with their models, tools and workers
+// @Tags         agents
+// @Produce      json
+// @Success      200  {object}  OrusResponse
+// @Router       /orus-api/v1/agents [get]
+func (s *OrusAPI) ListAgents(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{"agents": s.Agents.List()}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Agents retrieved successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// RunAgent godoc
+// @Summary      Runs an agent
+// @Description  Has an agent answer a task. A supervisor delegates subtasks to its workers and synthesizes their answers; the response has every agent invocation with its parent, messages and tool calls. With stream every finished agent is sent as an agent event and the run ends with a done event
+// @Tags         agents
+// @Accept       json
+// @Produce      json
+// @Param        name     path  string           true  "Agent name"
+// @Param        request  body  AgentRunRequest  true  "Task"
+// @Success      200  {object}  OrusResponse
+// @Failure      400  {object}  OrusResponse
+// @Failure      404  {object}  OrusResponse
+// @Failure      422  {object}  OrusResponse
+// @Router       /orus-api/v1/agents/{name}/run [post]
+func (s *OrusAPI) RunAgent(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	agent, ok := s.Agents.Get(chi.URLParam(r, "name"))
+	if !ok {
+		respondError(w, http.StatusNotFound, "unknown_agent", "The agent does not exist")
+		return
+	}
+	request, ok := decodeJSON[AgentRunRequest](w, r)
+	if !ok {
+		return
+	}
+	maxRounds := s.CurrentConfig().Tools.MaxRounds
+
+	if !request.Stream {
+		run, err := s.Agents.Run(r.Context(), agent, request.Task, request.UserID, maxRounds, nil)
+		if err != nil {
+			status := errorStatus(err)
+			if errors.Is(err, orus.ErrToolRounds) {
+				status = http.StatusUnprocessableEntity
+			}
+			response := NewOrusResponse()
+			response.Success = false
+			response.Error = err.Error()
+			response.Message = "Error running agent"
+			response.Data = map[string]interface{}{"run": run}
+			response.TimeTaken = time.Since(startTime)
+			respondJSON(w, status, response)
+			return
+		}
+		response := NewOrusResponse()
+		response.Data = map[string]interface{}{"run": run}
+		response.TimeTaken = time.Since(startTime)
+		response.Message = "Agent run successfully"
+		respondJSON(w, http.StatusOK, response)
+		return
+	}
+
+	events, ok := NewEventStream(w)
+	if !ok {
+		return
+	}
+	run, err := s.Agents.Run(r.Context(), agent, request.Task, request.UserID, maxRounds, func(node orus.AgentNode) {
+		_ = events.Agent(node)
+	})
+	if err != nil {
+		code := llmErrorCode(err)
+		if errors.Is(err, orus.ErrToolRounds) {
+			code = "tool_rounds_exceeded"
+		}
+		_ = events.Error(code, err)
+		return
+	}
+	_ = events.Done(DonePayload{
+		Message:   "Agent run successfully",
+		Model:     agent.Model,
+		Content:   run.Answer,
+		Agents:    run,
+		TimeTaken: time.Since(startTime).String(),
+	})
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Dsouza10082/orus"
+	"github.com/go-chi/chi/v5"
+)
+
+type CreateAPIKeyRequest struct {
+	Name string `json:"name" swaggertype:"string" example:"ci"`
+}
+
+func (r *CreateAPIKeyRequest) Validate() *orus.ValidationError {
+	if strings.TrimSpace(r.Name) == "" {
+		return &orus.ValidationError{Code: "missing_name", Field: "name", Message: "Field 'name' is required"}
+	}
+	return nil
+}
+
+// ListAPIKeys godoc
+// @Summary      Lists the API keys created through the API
+// @Description  Lists the API keys created through the API, with their names and prefixes; the keys themselves are not kept. Requires an admin key
+// @Tags         api-keys
+// @Produce      json
+// @Success      200  {object}  OrusResponse
+// @Failure      401  {object}  OrusResponse
+// @Failure      500  {object}  OrusResponse
+// @Router       /orus-api/v1/api-keys [get]
+func (s *OrusAPI) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	keys, err := s.APIKeys.List()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "api_keys_unavailable", err.Error())
+		return
+	}
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{"api_keys": keys}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "API keys retrieved successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// CreateAPIKey godoc
+// @Summary      Creates an API key
+// @Description  Generates an API key accepted along with ORUS_API_KEYS, by every replica sharing the storage. The key is only returned in this response. Requires an admin key
+// @Tags         api-keys
+// @Accept       json
+// @Produce      json
+// @Param        request  body  CreateAPIKeyRequest  true  "Key name"
+// @Success      200  {object}  OrusResponse
+// @Failure      400  {object}  OrusResponse
+// @Failure      401  {object}  OrusResponse
+// @Failure      500  {object}  OrusResponse
+// @Router       /orus-api/v1/api-keys [post]
+func (s *OrusAPI) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	request, ok := decodeJSON[CreateAPIKeyRequest](w, r)
+	if !ok {
+		return
+	}
+	record, key, err := s.APIKeys.Create(strings.TrimSpace(request.Name))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "api_key_not_created", err.Error())
+		return
+	}
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{
+		"api_key": record,
+		"key":     key,
+	}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "API key created successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// RevokeAPIKey godoc
+// @Summary      Revokes an API key
+// @Description  Revokes an API key created through the API. Requires an admin key
+// @Tags         api-keys
+// @Produce      json
+// @Param        id   path      string  true  "API key ID"
+// @Success      200  {object}  OrusResponse
+// @Failure      401  {object}  OrusResponse
+// @Failure      404  {object}  OrusResponse
+// @Failure      500  {object}  OrusResponse
+// @Router       /orus-api/v1/api-keys/{id} [delete]
+func (s *OrusAPI) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	err := s.APIKeys.Revoke(chi.URLParam(r, "id"))
+	if errors.Is(err, orus.ErrAPIKeyNotFound) {
+		respondError(w, http.StatusNotFound, "api_key_not_found", "api key not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "api_key_not_revoked", err.Error())
+		return
+	}
+	response := NewOrusResponse()
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "API key revoked successfully"
+	respondJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Dsouza10082/orus"
+)
+
+// GetAuditLog godoc
+// @Summary      Returns audit records
+// @Description  Returns the audited LLM requests, newest first, filtered by time range, endpoint, model and caller. Only available when ORUS_API_AUDIT_SINK is set. Requires an admin key (ORUS_API_ADMIN_KEYS) in the X-Admin-Key header
+// @Tags         audit
+// @Produce      json
+// @Param        X-Admin-Key  header    string  true  "Admin key"
+// @Param        since     query     string  false  "RFC 3339 start time (inclusive)"
+// @Param        until     query     string  false  "RFC 3339 end time (exclusive)"
+// @Param        endpoint  query     string  false  "Endpoint path"
+// @Param        model     query     string  false  "Model name"
+// @Param        caller    query     string  false  "Caller key as recorded (key:<fingerprint> or ip:<address>)"
+// @Param        limit     query     int     false  "Maximum records (default 100, max 1000)"
+// @Success      200  {object}  OrusResponse
+// @Failure      400  {object}  OrusResponse
+// @Failure      401  {object}  OrusResponse
+// @Failure      403  {object}  OrusResponse
+// @Failure      404  {object}  OrusResponse
+// @Failure      500  {object}  OrusResponse
+// @Router       /orus-api/v1/audit [get]
+func (s *OrusAPI) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	if s.Audit == nil {
+		respondError(w, http.StatusNotFound, "audit_disabled", "Auditing is not enabled, set ORUS_API_AUDIT_SINK")
+		return
+	}
+
+	params := r.URL.Query()
+	query := orus.AuditQuery{
+		Endpoint: params.Get("endpoint"),
+		Model:    params.Get("model"),
+		Caller:   params.Get("caller"),
+	}
+	for name, target := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+		if value := params.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, "invalid_"+name, "Query parameter '"+name+"' must be an RFC 3339 time")
+				return
+			}
+			*target = parsed
+		}
+	}
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			respondError(w, http.StatusBadRequest, "invalid_limit", "Query parameter 'limit' must be a positive integer")
+			return
+		}
+		query.Limit = limit
+	}
+
+	records, err := s.Audit.Query(query)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "audit_query_failed", err.Error())
+		return
+	}
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{
+		"records": records,
+		"total":   len(records),
+	}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Audit records retrieved successfully"
+	respondJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"crypto/sha256"
+	"errors"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/Dsouza10082/orus"
+)
+
+// apiPathPrefix is the prefix of the REST API routes. The playground pages
+// and their event streams are served outside it.
+const apiPathPrefix = "/orus-api/"
+
+// playgroundKeyCookie carries the API key of a browser signed in to the
+// playground, which cannot set the X-API-Key header of its event streams.
+const playgroundKeyCookie = "orus_api_key"
+
+// keySet holds the digests of API keys, which are compared in constant time.
+type keySet [][sha256.Size]byte
+
+func newKeySet(keys []orus.Secret) keySet {
+	set := make(keySet, len(keys))
+	for i, key := range keys {
+		set[i] = sha256.Sum256([]byte(key.Reveal()))
+	}
+	return set
+}
+
+func (s keySet) contains(key string) bool {
+	digest := sha256.Sum256([]byte(key))
+	found := false
+	for _, allowed := range s {
+		if subtle.ConstantTimeCompare(digest[:], allowed[:]) == 1 {
+			found = true
+		}
+	}
+	return found
+}
+
+// APIKeyAuth rejects the requests that do not carry one of keys or a key
+// of store. Only the pages of the playground and the API docs are public;
+// its event streams take the key of a browser signed in at /login from the
+// orus_api_key cookie.
+func APIKeyAuth(keys []orus.Secret, store orus.APIKeyStore) func(next http.Handler) http.Handler {
+	set := newKeySet(keys)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if publicRoute(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key := orus.RequestAPIKey(r)
+			if key == "" && !strings.HasPrefix(r.URL.Path, apiPathPrefix) {
+				if cookie, err := r.Cookie(playgroundKeyCookie); err == nil {
+					key = cookie.Value
+				}
+			}
+			if key == "" {
+				respondError(w, http.StatusUnauthorized, "unauthorized", "An API key is required in the X-API-Key header or as a bearer token, or by signing in to the playground at "+playgroundLoginPath)
+				return
+			}
+			switch err := checkAPIKey(set, store, key); {
+			case errors.Is(err, orus.ErrAPIKeyNotFound):
+				respondError(w, http.StatusUnauthorized, "unauthorized", "Invalid API key")
+			case err != nil:
+				respondError(w, http.StatusServiceUnavailable, "auth_unavailable", "The API keys cannot be checked")
+			default:
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// publicPages are the pages served without a key: the shells of the
+// playground, which change nothing and generate nothing, and its sign in.
+var publicPages = map[string]bool{
+	"/prompt":           true,
+	"/chat":             true,
+	"/rag":              true,
+	"/models":           true,
+	"/embeddings":       true,
+	"/compare":          true,
+	playgroundLoginPath: true,
+}
+
+// publicRoute reports whether r is served without a key: the preflight
+// requests, the sign in, the pages of the playground and the API docs.
+func publicRoute(r *http.Request) bool {
+	if r.Method == http.MethodOptions {
+		return true
+	}
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	if path == playgroundLoginPath && r.Method == http.MethodPost {
+		return true
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	return publicPages[path] || strings.HasPrefix(path, "/swagger/")
+}
+
+// checkAPIKey returns nil when key is one of set or was created through
+// the API, and an error wrapping orus.ErrAPIKeyNotFound when it is
+// neither.
+func checkAPIKey(set keySet, store orus.APIKeyStore, key string) error {
+	if set.contains(key) {
+		return nil
+	}
+	if store == nil {
+		return orus.ErrAPIKeyNotFound
+	}
+	_, err := store.Lookup(key)
+	return err
+}
+
+// AdminOnly lets through the requests that carry one of the admin keys in
+// the X-Admin-Key header or as their API key. Without admin keys the route
+// is forbidden.
+func AdminOnly(keys []orus.Secret) func(next http.Handler) http.Handler {
+	set := newKeySet(keys)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(set) == 0 {
+				respondError(w, http.StatusForbidden, "admin_disabled", "Set ORUS_API_ADMIN_KEYS to use the admin endpoints")
+				return
+			}
+			key := adminKey(r)
+			if key == "" || !set.contains(key) {
+				respondError(w, http.StatusUnauthorized, "unauthorized", "An admin key is required in the X-Admin-Key header")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// adminKey returns the key of the X-Admin-Key header, or else the API key.
+func adminKey(r *http.Request) string {
+	if key := r.Header.Get("X-Admin-Key"); key != "" {
+		return key
+	}
+	return orus.RequestAPIKey(r)
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Dsouza10082/orus"
+	"github.com/Dsouza10082/orus/orustest"
+)
+
+func TestAPIKeyAuthCoversThePlayground(t *testing.T) {
+	handler := testAPIWith(t, orustest.NewBackend(), func(config *orus.Config) {
+		config.Server.RequireAuth = true
+		config.Server.APIKeys = []orus.Secret{"test-key"}
+	})
+	serve := func(method, path string, configure func(*http.Request)) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader("{}"))
+		if configure != nil {
+			configure(r)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	withKey := func(r *http.Request) { r.Header.Set("X-API-Key", "test-key") }
+
+	for _, path := range []string{"/prompt", "/chat", "/models", "/compare", "/login"} {
+		if w := serve(http.MethodGet, path, nil); w.Code != http.StatusOK {
+			t.Errorf("GET %s answered %d without a key, want the page", path, w.Code)
+		}
+	}
+	for _, route := range []struct{ method, path string }{
+		{http.MethodPost, "/models/delete"},
+		{http.MethodPost, "/models/pull"},
+		{http.MethodPost, "/rag/clear"},
+		{http.MethodPost, "/rag/index"},
+		{http.MethodPost, "/prompt/llm-stream"},
+		{http.MethodPost, "/chat/send"},
+		{http.MethodPost, "/rag/ask"},
+		{http.MethodPost, "/compare/run"},
+		{http.MethodGet, "/metrics"},
+		{http.MethodGet, "/orus-api/v1/system-info"},
+	} {
+		if w := serve(route.method, route.path, nil); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s answered %d without a key, want 401", route.method, route.path, w.Code)
+		}
+		if w := serve(route.method, route.path, func(r *http.Request) { r.Header.Set("X-API-Key", "wrong") }); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s answered %d with a wrong key, want 401", route.method, route.path, w.Code)
+		}
+	}
+	if w := serve(http.MethodGet, "/metrics", withKey); w.Code != http.StatusOK {
+		t.Errorf("GET /metrics answered %d with a key, want 200", w.Code)
+	}
+
+	login := func(key string) *httptest.ResponseRecorder {
+		form := url.Values{"api_key": {key}, "next": {"/rag"}}
+		r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	if w := login("wrong"); w.Code != http.StatusUnauthorized || len(w.Result().Cookies()) != 0 {
+		t.Fatalf("signing in with a wrong key answered %d with cookies %v", w.Code, w.Result().Cookies())
+	}
+	w := login("test-key")
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/rag" {
+		t.Fatalf("signing in answered %d to %q, want a redirect to /rag", w.Code, w.Header().Get("Location"))
+	}
+	var cookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == playgroundKeyCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil || !cookie.HttpOnly || cookie.SameSite != http.SameSiteStrictMode {
+		t.Fatalf("signing in set the cookie %+v, want an HttpOnly and SameSite=Strict one", cookie)
+	}
+
+	// the cookie signs in the playground streams, not the REST API
+	withCookie := func(r *http.Request) { r.AddCookie(cookie) }
+	if w := serve(http.MethodPost, "/rag/clear", withCookie); w.Code == http.StatusUnauthorized {
+		t.Error("a signed in browser could not use the playground")
+	}
+	if w := serve(http.MethodGet, "/orus-api/v1/system-info", withCookie); w.Code != http.StatusUnauthorized {
+		t.Errorf("the REST API answered %d to the cookie, want 401", w.Code)
+	}
+}
+
+func TestLoginNext(t *testing.T) {
+	for next, want := range map[string]string{
+		"/rag":                "/rag",
+		"":                    "/prompt",
+		"/login":              "/prompt",
+		"https://example.com": "/prompt",
+		"//example.com":       "/prompt",
+		"/orus-api/v1/audit":  "/prompt",
+	} {
+		if got := loginNext(next); got != want {
+			t.Errorf("loginNext(%q) = %q, want %q", next, got, want)
+		}
+	}
+}
+
+func TestAdminRoutes(t *testing.T) {
+	routes := []struct{ method, path string }{
+		{http.MethodGet, "/orus-api/v1/audit"},
+		{http.MethodPost, "/orus-api/v1/config/reload"},
+	}
+	serve := func(handler http.Handler, method, path, key string) int {
+		r := httptest.NewRequest(method, path, nil)
+		if key != "" {
+			r.Header.Set("X-Admin-Key", key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	disabled := testAPI(t, orustest.NewBackend())
+	for _, route := range routes {
+		if code := serve(disabled, route.method, route.path, ""); code != http.StatusForbidden {
+			t.Errorf("%s %s answered %d without admin keys, want 403", route.method, route.path, code)
+		}
+	}
+	handler := testAPIWith(t, orustest.NewBackend(), func(config *orus.Config) {
+		config.Server.AdminKeys = []orus.Secret{"admin-key"}
+	})
+	for _, route := range routes {
+		for _, key := range []string{"", "wrong"} {
+			if code := serve(handler, route.method, route.path, key); code != http.StatusUnauthorized {
+				t.Errorf("%s %s answered %d with the key %q, want 401", route.method, route.path, code, key)
+			}
+		}
+		if code := serve(handler, route.method, route.path, "admin-key"); code == http.StatusUnauthorized || code == http.StatusForbidden {
+			t.Errorf("%s %s answered %d with the admin key", route.method, route.path, code)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Dsouza10082/orus"
+)
+
+type RestoreRequest struct {
+	Name string `json:"name" swaggertype:"string" example:"orus-20250102T100000Z.tar.gz"`
+}
+
+func (r *RestoreRequest) Validate() *orus.ValidationError {
+	if strings.TrimSpace(r.Name) == "" {
+		return &orus.ValidationError{Code: "missing_name", Field: "name", Message: "Field 'name' is required"}
+	}
+	return nil
+}
+
+// backupStream starts the event stream of a backup or a restore with its
+// first event, so the errors found before it are answered with their
+// status rather than as an error event.
+type backupStream struct {
+	w       http.ResponseWriter
+	events  *EventStream
+	started bool
+}
+
+func (b *backupStream) start() *EventStream {
+	if !b.started {
+		b.started = true
+		b.events, _ = NewEventStream(b.w)
+	}
+	return b.events
+}
+
+func (b *backupStream) Progress(progress orus.BackupProgress) {
+	if events := b.start(); events != nil {
+		_ = events.BackupProgress(progress)
+	}
+}
+
+func (b *backupStream) Fail(err error, code string) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, orus.ErrBackupsDisabled):
+		status, code = http.StatusServiceUnavailable, "backups_disabled"
+	case errors.Is(err, orus.ErrBackupRunning):
+		status, code = http.StatusConflict, "backup_running"
+	case errors.Is(err, orus.ErrBackupNotFound):
+		status, code = http.StatusNotFound, "backup_not_found"
+	case errors.Is(err, orus.ErrInvalidBackup):
+		status, code = http.StatusUnprocessableEntity, "invalid_backup"
+	}
+	if !b.started {
+		b.started = true
+		respondError(b.w, status, code, err.Error())
+		return
+	}
+	if b.events != nil {
+		_ = b.events.Error(code, err)
+	}
+}
+
+func (b *backupStream) Done(done DonePayload) {
+	if events := b.start(); events != nil {
+		_ = events.Done(done)
+	}
+}
+
+// CreateBackup godoc
+// @Summary      Backs up the server
+// @Description  Writes an archive of the sessions, the documents of every vector collection with their embeddings, the images they link to and the configuration, secrets masked, to the backup store: a directory of ORUS_API_BLOB_DIR, or the S3 bucket. The stages are reported as progress events and the backup in the done event. Requires an admin key
+// @Tags         backups
+// @Produce      text/event-stream
+// @Success      200  {object}  DonePayload
+// @Failure      401  {object}  OrusResponse
+// @Failure      409  {object}  OrusResponse
+// @Failure      503  {object}  OrusResponse
+// @Router       /orus-api/v1/admin/backup [post]
+func (s *OrusAPI) CreateBackup(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	stream := &backupStream{w: w}
+	backup, err := s.Backup(stream.Progress)
+	if err != nil {
+		stream.Fail(err, "backup_failed")
+		return
+	}
+	stream.Done(DonePayload{
+		Message:   "Backup created successfully",
+		Backup:    &backup,
+		TimeTaken: time.Since(startTime).String(),
+	})
+}
+
+// ListBackups godoc
+// @Summary      Lists the backups
+// @Description  Lists the archives of the backup store, oldest first. Requires an admin key
+// @Tags         backups
+// @Produce      json
+// @Success      200  {object}  OrusResponse
+// @Failure      401  {object}  OrusResponse
+// @Failure      500  {object}  OrusResponse
+// @Failure      503  {object}  OrusResponse
+// @Router       /orus-api/v1/admin/backup [get]
+func (s *OrusAPI) ListBackups(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	backups, err := s.Orus.ListBackups()
+	if errors.Is(err, orus.ErrBackupsDisabled) {
+		respondError(w, http.StatusServiceUnavailable, "backups_disabled", err.Error())
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "backups_unavailable", err.Error())
+		return
+	}
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{"backups": backups}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Backups retrieved successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// GetBackupFile godoc
+// @Summary      Downloads a backup
+// @Description  Returns a backup archive, a gzipped tar file. Requires an admin key
+// @Tags         backups
+// @Produce      application/gzip
+// @Param        name  query  string  true  "Backup name, as listed"
+// @Success      200  {file}  file
+// @Failure      400  {object}  OrusResponse
+// @Failure      401  {object}  OrusResponse
+// @Failure      404  {object}  OrusResponse
+// @Failure      503  {object}  OrusResponse
+// @Router       /orus-api/v1/admin/backup/file [get]
+func (s *OrusAPI) GetBackupFile(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		respondError(w, http.StatusBadRequest, "missing_name", "Query parameter 'name' is required")
+		return
+	}
+	if s.Backups == nil {
+		respondError(w, http.StatusServiceUnavailable, "backups_disabled", orus.ErrBackupsDisabled.Error())
+		return
+	}
+	data, err := s.Backups.Get(name)
+	if errors.Is(err, orus.ErrBlobNotFound) {
+		respondError(w, http.StatusNotFound, "backup_not_found", "backup not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "backup_unavailable", err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+strings.ReplaceAll(name, "/", "-")+"\"")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// RestoreBackup godoc
+// @Summary      Restores a backup
+// @Description  Loads a backup of the backup store into the server: the sessions replace those of the same ID, the documents of each collection of the archive replace those of the collection and the images are stored again. The archive is checked whole before anything changes. The configuration is not restored. The stages are reported as progress events and the manifest of the backup in the done event. Requires an admin key
+// @Tags         backups
+// @Accept       json
+// @Produce      text/event-stream
+// @Param        request  body  RestoreRequest  true  "Backup"
+// @Success      200  {object}  DonePayload
+// @Failure      400  {object}  OrusResponse
+// @Failure      401  {object}  OrusResponse
+// @Failure      404  {object}  OrusResponse
+// @Failure      409  {object}  OrusResponse
+// @Failure      422  {object}  OrusResponse
+// @Failure      503  {object}  OrusResponse
+// @Router       /orus-api/v1/admin/restore [post]
+func (s *OrusAPI) RestoreBackup(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	request, ok := decodeJSON[RestoreRequest](w, r)
+	if !ok {
+		return
+	}
+	stream := &backupStream{w: w}
+	name := strings.TrimSpace(request.Name)
+	manifest, err := s.Restore(name, stream.Progress)
+	if err != nil {
+		stream.Fail(err, "restore_failed")
+		return
+	}
+	stream.Done(DonePayload{
+		Message:   "Backup restored successfully",
+		Backup:    &orus.Backup{Name: name, CreatedAt: manifest.CreatedAt, Manifest: manifest},
+		TimeTaken: time.Since(startTime).String(),
+	})
+}
@@ -1,4 +1,4 @@
-package main
+package api
 
 import "net/http"
 
@@ -9,4 +9,4 @@ func BodyLimiter(maxBytes int64) func(next http.Handler) http.Handler {
 			next.ServeHTTP(w, r)
 		})
 	}
-}
\ No newline at end of file
+}
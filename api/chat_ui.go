@@ -0,0 +1,273 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Dsouza10082/orus"
+	"github.com/Dsouza10082/orus/ollama"
+	"github.com/Dsouza10082/orus/view"
+	"github.com/google/uuid"
+	"github.com/starfederation/datastar-go/datastar"
+)
+
+const chatTitleLength = 60
+
+// ChatHandler is a handler for the chat page
+// It renders the sessions sidebar and the conversation selected by the session query parameter
+func (s *OrusAPI) ChatHandler(w http.ResponseWriter, r *http.Request) {
+	models, err := s.Backend.ListModels()
+	if err != nil {
+		log.Printf("ChatHandler: failed to list models: %v", err)
+		http.Error(w, "failed to list models", http.StatusInternalServerError)
+		return
+	}
+
+	var (
+		sessionID string
+		title     string
+		model     = "llama3.1:8b"
+		messages  = make([]view.ChatMessage, 0)
+	)
+	if id := r.URL.Query().Get("session"); id != "" {
+		session, err := s.Sessions.Get(id)
+		if errors.Is(err, orus.ErrSessionNotFound) {
+			http.Redirect(w, r, "/chat", http.StatusSeeOther)
+			return
+		}
+		if err != nil {
+			log.Printf("ChatHandler: failed to load session: %v", err)
+			http.Error(w, "failed to load session", http.StatusInternalServerError)
+			return
+		}
+		sessionID = session.ID
+		title = session.Title
+		if session.Settings.Model != "" {
+			model = session.Settings.Model
+		}
+		for _, turn := range session.Branch() {
+			messages = append(messages, chatMessage(turn, false))
+		}
+	}
+
+	sessions, err := s.sessionLinks(sessionID)
+	if err != nil {
+		log.Printf("ChatHandler: failed to list sessions: %v", err)
+		http.Error(w, "failed to list sessions", http.StatusInternalServerError)
+		return
+	}
+
+	if err := view.NewView().SetModels(models).RenderChat(w, sessionID, title, model, sessions, messages); err != nil {
+		log.Printf("ChatHandler: failed to render chat: %v", err)
+		http.Error(w, "failed to render page", http.StatusInternalServerError)
+	}
+}
+
+// ChatSendStream is a handler for the chat/send endpoint
+// It appends the user message to the active session, creating one when needed,
+// and streams the assistant answer into the conversation
+func (s *OrusAPI) ChatSendStream(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	signals := &view.ChatSignals{}
+	if err := datastar.ReadSignals(r, signals); err != nil {
+		log.Printf("ChatSendStream: failed to read signals: %v", err)
+		http.Error(w, "failed to read signals", http.StatusBadRequest)
+		return
+	}
+
+	sse := datastar.NewSSE(w, r)
+
+	message := strings.TrimSpace(signals.Message)
+	if message == "" {
+		return
+	}
+
+	var (
+		session *orus.Session
+		err     error
+	)
+	if signals.SessionID != "" {
+		session, err = s.Sessions.Get(signals.SessionID)
+	} else {
+		session, err = s.Sessions.Create(orus.Session{
+			Title:    chatTitle(message),
+			Settings: orus.SessionSettings{Model: signals.Model},
+		})
+	}
+	if err != nil {
+		_ = sse.ConsoleError(fmt.Errorf("session error: %w", err))
+		return
+	}
+
+	settings := session.Settings
+	if signals.Model != "" {
+		settings.Model = signals.Model
+	}
+	if settings.Model == "" {
+		settings.Model = "llama3.1:8b"
+	}
+
+	signals.SessionID = session.ID
+	signals.Message = ""
+	signals.Model = settings.Model
+	if err := sse.MarshalAndPatchSignals(signals); err != nil {
+		_ = sse.ConsoleError(fmt.Errorf("failed to patch signals: %w", err))
+		return
+	}
+	_ = sse.ExecuteScript(fmt.Sprintf("history.replaceState(null, '', '/chat?session=%s')", session.ID))
+
+	userTurn := orus.SessionTurn{
+		ID:        uuid.New().String(),
+		Role:      "user",
+		Content:   message,
+		CreatedAt: time.Now().UTC(),
+	}
+	assistantTurn := orus.SessionTurn{
+		ID:         uuid.New().String(),
+		Role:       "assistant",
+		Model:      settings.Model,
+		Parameters: settings.Parameters(),
+	}
+
+	_ = sse.RemoveElement("#chat-empty")
+	if err := appendChatMessage(sse, chatMessage(userTurn, false)); err != nil {
+		_ = sse.ConsoleError(err)
+		return
+	}
+	if err := appendChatMessage(sse, chatMessage(assistantTurn, true)); err != nil {
+		_ = sse.ConsoleError(err)
+		return
+	}
+
+	history := append(session.Messages(), ollama.Message{Role: userTurn.Role, Content: userTurn.Content})
+	chatRequest, _ := s.sessionChatRequest(session, history, settings)
+
+	content := &strings.Builder{}
+	// the message is patched whole, with the pieces batched since the last
+	// patch; the last ones come with the final patch
+	batch := newChunkBatch(s.CurrentConfig().Streams)
+	onChunk := func(ctx context.Context, chunk ollama.ChatStreamResponse) error {
+		if sse.IsClosed() {
+			return context.Canceled
+		}
+		if chunk.Message.Content == "" {
+			return nil
+		}
+		content.WriteString(chunk.Message.Content)
+		if !batch.add(utf8.RuneCountInString(chunk.Message.Content)) {
+			return nil
+		}
+		assistantTurn.Content = content.String()
+		if err := patchChatMessage(sse, chatMessage(assistantTurn, true)); err != nil {
+			_ = sse.ConsoleError(err)
+		}
+		return nil
+	}
+	client := s.Backend.WithContext(r.Context())
+	if settings.Provider == orus.ProviderOllamaCloud {
+		err = client.ChatStreamCloud(chatRequest, onChunk)
+	} else {
+		err = client.ChatStream(chatRequest, onChunk)
+	}
+	if ollama.IsCanceled(err) {
+		// the browser left mid-answer: the generation was aborted and the
+		// partial exchange is not saved
+		return
+	}
+	if err != nil {
+		_ = sse.ConsoleError(fmt.Errorf("ChatStream error: %w", err))
+		return
+	}
+
+	assistantTurn.Content = content.String()
+	assistantTurn.Duration = time.Since(startTime)
+	assistantTurn.CreatedAt = time.Now().UTC()
+	if err := patchChatMessage(sse, chatMessage(assistantTurn, false)); err != nil {
+		_ = sse.ConsoleError(err)
+	}
+
+	session, err = s.Sessions.AppendTurns(session.ID, userTurn, assistantTurn)
+	if err != nil {
+		_ = sse.ConsoleError(fmt.Errorf("session error: %w", err))
+		return
+	}
+	s.rememberSessionExchange(session, settings.Model, userTurn, assistantTurn)
+	branch := session.Branch()
+	s.SessionIndex.IndexAsync(session, branch[len(branch)-2:]...)
+	s.recordGeneration(r.Context(), uuid.New().String(), r.URL.Path, &chatRequest, assistantTurn.Content, startTime)
+
+	sessions, err := s.sessionLinks(session.ID)
+	if err != nil {
+		_ = sse.ConsoleError(fmt.Errorf("failed to list sessions: %w", err))
+		return
+	}
+	sidebar, err := view.RenderSessionList(sessions)
+	if err != nil {
+		_ = sse.ConsoleError(err)
+		return
+	}
+	_ = sse.PatchElements(sidebar)
+}
+
+// sessionLinks lists the sessions for the sidebar, marking activeID.
+func (s *OrusAPI) sessionLinks(activeID string) ([]view.SessionLink, error) {
+	sessions, err := s.Sessions.List()
+	if err != nil {
+		return nil, err
+	}
+	links := make([]view.SessionLink, 0, len(sessions))
+	for _, session := range sessions {
+		title := session.Title
+		if title == "" {
+			title = "Untitled conversation"
+		}
+		links = append(links, view.SessionLink{
+			ID:     session.ID,
+			Title:  title,
+			Active: session.ID == activeID,
+		})
+	}
+	return links, nil
+}
+
+func appendChatMessage(sse *datastar.ServerSentEventGenerator, message view.ChatMessage) error {
+	html, err := view.RenderChatMessage(message)
+	if err != nil {
+		return err
+	}
+	return sse.PatchElements(html, datastar.WithSelectorID("messages"), datastar.WithModeAppend())
+}
+
+func patchChatMessage(sse *datastar.ServerSentEventGenerator, message view.ChatMessage) error {
+	html, err := view.RenderChatMessage(message)
+	if err != nil {
+		return err
+	}
+	return sse.PatchElements(html)
+}
+
+func chatMessage(turn orus.SessionTurn, pending bool) view.ChatMessage {
+	return view.ChatMessage{
+		ID:      turn.ID,
+		Role:    turn.Role,
+		Content: turn.Content,
+		Model:   turn.Model,
+		Pending: pending,
+	}
+}
+
+// chatTitle derives a session title from the first message.
+func chatTitle(message string) string {
+	title := strings.Join(strings.Fields(message), " ")
+	if runes := []rune(title); len(runes) > chatTitleLength {
+		title = string(runes[:chatTitleLength]) + "…"
+	}
+	return title
+}
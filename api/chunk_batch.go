@@ -0,0 +1,46 @@
+package api
+
+import (
+	"time"
+
+	"github.com/Dsouza10082/orus"
+)
+
+// chunkBatch decides when the pieces of a streamed generation are sent, so
+// a fast model does not cost the client an event, or a Datastar patch, per
+// token. The pieces pending are sent once the stream interval passed since
+// the previous send and the stream min chunk chars are pending; the ones
+// left at the end of the generation are sent with its last event.
+type chunkBatch struct {
+	interval time.Duration
+	minChars int
+	pending  int
+	last     time.Time
+}
+
+func newChunkBatch(config orus.StreamConfig) *chunkBatch {
+	return &chunkBatch{interval: config.Interval, minChars: config.MinChunkChars}
+}
+
+// batches reports whether the pieces are batched at all.
+func (b *chunkBatch) batches() bool {
+	return b.interval > 0 || b.minChars > 1
+}
+
+// add counts a piece of chars characters and reports whether the pending
+// pieces are due.
+func (b *chunkBatch) add(chars int) bool {
+	b.pending += chars
+	if b.pending == 0 || b.pending < b.minChars || time.Since(b.last) < b.interval {
+		return false
+	}
+	b.pending, b.last = 0, time.Now()
+	return true
+}
+
+// flush reports whether pieces are pending, which are then taken as sent.
+func (b *chunkBatch) flush() bool {
+	pending := b.pending > 0
+	b.pending, b.last = 0, time.Now()
+	return pending
+}
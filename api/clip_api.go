@@ -0,0 +1,214 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Dsouza10082/orus"
+)
+
+const DefaultImageSearchLimit = 5
+
+// EmbedImageRequest is the body of an image embedding.
+type EmbedImageRequest struct {
+	// Image is base64, a data URL or the handle of an uploaded image.
+	Image string `json:"image" swaggertype:"string" example:"img_3f2a9c0d7e1b4a5f8c6d2e0b1a9f7c3d"`
+	// Index adds the embedding to the images collection as source, replacing
+	// the previous image of source.
+	Index       bool   `json:"index" swaggertype:"boolean" example:"false"`
+	Source      string `json:"source" swaggertype:"string" example:"catalog/red-shoe.jpg"`
+	Description string `json:"description" swaggertype:"string" example:"Red running shoe"`
+}
+
+func (r *EmbedImageRequest) Validate() *orus.ValidationError {
+	if r.Image == "" {
+		return &orus.ValidationError{Code: "missing_image", Field: "image", Message: "Field 'image' is required"}
+	}
+	images, verr := orus.ValidateImages([]string{r.Image})
+	if verr != nil {
+		verr.Field = "image"
+		return verr
+	}
+	r.Image = images[0]
+	if r.Index && strings.TrimSpace(r.Source) == "" {
+		return &orus.ValidationError{Code: "missing_source", Field: "source", Message: "Field 'source' is required to index the image"}
+	}
+	return nil
+}
+
+// ImageSearchRequest is the body of a cross-modal search: images or
+// documents found by text, or by an image.
+type ImageSearchRequest struct {
+	Query string `json:"query" swaggertype:"string" example:"a red running shoe"`
+	// Image is base64, a data URL or the handle of an uploaded image.
+	Image string `json:"image" swaggertype:"string"`
+	// Collection is searched among its documents embedded with clip; it
+	// defaults to the images collection.
+	Collection string `json:"collection" swaggertype:"string" example:"images"`
+	Limit      int    `json:"limit" swaggertype:"integer" example:"5"`
+}
+
+func (r *ImageSearchRequest) Validate() *orus.ValidationError {
+	if (strings.TrimSpace(r.Query) == "") == (r.Image == "") {
+		return &orus.ValidationError{Code: "invalid_query", Field: "query", Message: "Exactly one of 'query' and 'image' is required"}
+	}
+	if r.Image != "" {
+		images, verr := orus.ValidateImages([]string{r.Image})
+		if verr != nil {
+			verr.Field = "image"
+			return verr
+		}
+		r.Image = images[0]
+	}
+	if r.Collection == "" {
+		r.Collection = orus.ImageCollection
+	}
+	if r.Limit < 0 {
+		return &orus.ValidationError{Code: "invalid_limit", Field: "limit", Message: "Field 'limit' must not be negative"}
+	}
+	if r.Limit == 0 {
+		r.Limit = DefaultImageSearchLimit
+	}
+	return nil
+}
+
+// EmbedImage godoc
+// @Summary      Embeds an image with the CLIP image encoder
+// @Description  Embeds an image (base64, data URL or upload handle) with the CLIP image encoder of ORUS_API_CLIP_IMAGE_PATH. With index the embedding is added to the images collection, so it can be found by text or by image
+// @Tags         embed
+// @Accept       json
+// @Produce      json
+// @Param        request  body  EmbedImageRequest  true  "Image"
+// @Success      200  {object}  OrusResponse
+// @Failure      400  {object}  OrusResponse
+// @Failure      503  {object}  OrusResponse
+// @Router       /orus-api/v1/embed-image [post]
+func (s *OrusAPI) EmbedImage(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	request, ok := decodeJSON[EmbedImageRequest](w, r)
+	if !ok {
+		return
+	}
+	vector, ok := s.embedImage(w, request.Image)
+	if !ok {
+		return
+	}
+
+	data := map[string]interface{}{
+		"vector":       vector,
+		"model":        orus.ClipModel,
+		"dimensions":   len(vector),
+		"quantization": "float32",
+	}
+	if request.Index {
+		metadata := map[string]interface{}{
+			"source": request.Source,
+			"model":  orus.ClipModel,
+			"kind":   "image",
+		}
+		if orus.IsImageHandle(request.Image) {
+			metadata["image"] = request.Image
+		}
+		s.VectorStore.DeleteWhere(orus.ImageCollection, func(document orus.Document) bool {
+			return document.Metadata["source"] == request.Source
+		})
+		added := s.VectorStore.Add(orus.ImageCollection, orus.Document{
+			Content:   request.Description,
+			Embedding: orus.Float64s(vector),
+			Metadata:  metadata,
+		})
+		data["id"] = added[0].ID
+	}
+
+	response := NewOrusResponse()
+	response.Data = data
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Image embedded successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// SearchImages godoc
+// @Summary      Searches images or documents by text or by image
+// @Description  Embeds the query text with the CLIP text encoder, or the image with the image encoder, and returns the closest documents of the collection embedded with clip: the indexed images by default, or the RAG documents ingested with the clip embedding model
+// @Tags         embed
+// @Accept       json
+// @Produce      json
+// @Param        request  body  ImageSearchRequest  true  "Query"
+// @Success      200  {object}  OrusResponse
+// @Failure      400  {object}  OrusResponse
+// @Failure      503  {object}  OrusResponse
+// @Router       /orus-api/v1/image-search [post]
+func (s *OrusAPI) SearchImages(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	request, ok := decodeJSON[ImageSearchRequest](w, r)
+	if !ok {
+		return
+	}
+	var vector []float32
+	if request.Image != "" {
+		if vector, ok = s.embedImage(w, request.Image); !ok {
+			return
+		}
+	} else {
+		var err error
+		if vector, err = s.Clip.EmbedText(request.Query); err != nil {
+			respondClipError(w, err)
+			return
+		}
+	}
+
+	results := s.VectorStore.Search(request.Collection, orus.Float64s(vector), request.Limit, func(document orus.Document) bool {
+		return document.Metadata["model"] == orus.ClipModel
+	})
+	for i := range results {
+		results[i].Document.Embedding = nil
+	}
+
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{
+		"collection": request.Collection,
+		"results":    results,
+	}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Search completed successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// embedImage embeds a validated image, resolving its handle. It answers
+// the error and returns false when it fails.
+func (s *OrusAPI) embedImage(w http.ResponseWriter, encoded string) ([]float32, bool) {
+	images, err := s.Images.Resolve([]string{encoded})
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "unknown_image", err.Error())
+		return nil, false
+	}
+	data, err := base64.StdEncoding.DecodeString(images[0])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_image", fmt.Sprintf("The image is not valid base64: %v", err))
+		return nil, false
+	}
+	vector, err := s.Clip.EmbedImage(data)
+	if err != nil {
+		respondClipError(w, err)
+		return nil, false
+	}
+	return vector, true
+}
+
+func respondClipError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, orus.ErrClipDisabled):
+		respondError(w, http.StatusServiceUnavailable, "clip_disabled", err.Error())
+	case errors.Is(err, orus.ErrClipTextDisabled):
+		respondError(w, http.StatusServiceUnavailable, "clip_text_disabled", err.Error())
+	case errors.Is(err, image.ErrFormat):
+		respondError(w, http.StatusBadRequest, "invalid_image", err.Error())
+	default:
+		respondError(w, errorStatus(err), "embedding_error", fmt.Sprintf("Error embedding with %s: %v", orus.ClipModel, err))
+	}
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Dsouza10082/orus/ollama"
+	"github.com/Dsouza10082/orus/view"
+	"github.com/starfederation/datastar-go/datastar"
+)
+
+// CompareHandler is a handler for the model comparison page
+func (s *OrusAPI) CompareHandler(w http.ResponseWriter, r *http.Request) {
+	models, err := s.Backend.ListModels()
+	if err != nil {
+		log.Printf("CompareHandler: failed to list models: %v", err)
+		http.Error(w, "failed to list models", http.StatusInternalServerError)
+		return
+	}
+	initial := view.CompareSignals{
+		Models: make(map[string]string, view.ComparePanes),
+		Panes:  make(map[string]view.ComparePane, view.ComparePanes),
+	}
+	for i := 0; i < view.ComparePanes; i++ {
+		key := view.CompareKey(i)
+		initial.Models[key] = ""
+		initial.Panes[key] = view.ComparePane{}
+	}
+	if err := view.NewView().SetModels(models).RenderCompare(w, initial); err != nil {
+		log.Printf("CompareHandler: failed to render compare: %v", err)
+		http.Error(w, "failed to render page", http.StatusInternalServerError)
+	}
+}
+
+// CompareRunStream is a handler for the compare/run endpoint
+// It sends the prompt to every selected model concurrently and streams each output into its pane
+func (s *OrusAPI) CompareRunStream(w http.ResponseWriter, r *http.Request) {
+	signals := &view.CompareSignals{}
+	if err := datastar.ReadSignals(r, signals); err != nil {
+		log.Printf("CompareRunStream: failed to read signals: %v", err)
+		http.Error(w, "failed to read signals", http.StatusBadRequest)
+		return
+	}
+
+	sse := datastar.NewSSE(w, r)
+
+	if strings.TrimSpace(signals.Prompt) == "" {
+		return
+	}
+
+	// patches from the concurrent streams are serialized on the SSE connection
+	var mu sync.Mutex
+	patch := func(key string, pane view.ComparePane) {
+		mu.Lock()
+		defer mu.Unlock()
+		if sse.IsClosed() {
+			return
+		}
+		if err := sse.MarshalAndPatchSignals(map[string]interface{}{
+			"panes": map[string]view.ComparePane{key: pane},
+		}); err != nil {
+			_ = sse.ConsoleError(fmt.Errorf("failed to patch signals: %w", err))
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < view.ComparePanes; i++ {
+		key := view.CompareKey(i)
+		model := signals.Models[key]
+		if model == "" {
+			patch(key, view.ComparePane{})
+			continue
+		}
+		wg.Add(1)
+		go func(key, model string) {
+			defer wg.Done()
+			s.streamComparePane(r.Context(), signals.Prompt, model, func(pane view.ComparePane) {
+				patch(key, pane)
+			})
+		}(key, model)
+	}
+	wg.Wait()
+}
+
+// streamComparePane streams the answer of model to prompt, reporting the pane
+// after every chunk, or every batch of chunks. The generation is aborted when ctx is done.
+func (s *OrusAPI) streamComparePane(ctx context.Context, prompt, model string, report func(view.ComparePane)) {
+	startTime := time.Now()
+	pane := view.ComparePane{
+		Model:  model,
+		Status: "waiting",
+	}
+	report(pane)
+
+	output := &strings.Builder{}
+	batch := newChunkBatch(s.CurrentConfig().Streams)
+	err := s.Backend.WithContext(ctx).ChatStream(ollama.ChatRequest{
+		Model:    model,
+		Messages: []ollama.Message{{Role: "user", Content: prompt}},
+		Stream:   true,
+	}, func(ctx context.Context, chunk ollama.ChatStreamResponse) error {
+		if chunk.Message.Content != "" {
+			if pane.FirstToken == "" {
+				pane.FirstToken = formatLatency(time.Since(startTime))
+			}
+			output.WriteString(chunk.Message.Content)
+			pane.Output = output.String()
+		}
+		pane.Status = "streaming"
+		pane.Latency = formatLatency(time.Since(startTime))
+		if chunk.Done {
+			pane.PromptTokens = chunk.PromptEvalCount
+			pane.CompletionTokens = chunk.EvalCount
+			return nil
+		}
+		// without batching every chunk reports the pane, the thinking ones
+		// included
+		if batch.add(utf8.RuneCountInString(chunk.Message.Content)) || !batch.batches() {
+			report(pane)
+		}
+		return nil
+	})
+	if ollama.IsCanceled(err) {
+		return
+	}
+	pane.Latency = formatLatency(time.Since(startTime))
+	pane.Status = "done"
+	if err != nil {
+		pane.Status = "error: " + err.Error()
+	}
+	report(pane)
+}
+
+func formatLatency(d time.Duration) string {
+	return d.Round(time.Millisecond).String()
+}
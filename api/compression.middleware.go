@@ -0,0 +1,245 @@
+package api
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressors pool the encoders of the content codings, which are costly to
+// allocate for every response.
+var compressors = map[string]*sync.Pool{
+	"gzip": {New: func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	}},
+	"zstd": {New: func() interface{} {
+		// the responses are compressed as they are written, on the goroutine
+		// of the handler
+		encoder, _ := zstd.NewWriter(io.Discard, zstd.WithEncoderConcurrency(1))
+		return encoder
+	}},
+}
+
+// compressor is what gzip.Writer and zstd.Encoder have in common.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// Compress compresses the JSON responses of at least minSize bytes with the
+// first of encodings the Accept-Encoding of the request allows. The event
+// streams, the responses of another type or already encoded, and the HEAD
+// requests are passed through untouched; no encodings disables it.
+func Compress(encodings []string, minSize int) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(encodings) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cw := &compressWriter{
+				ResponseWriter: w,
+				encoding:       negotiateEncoding(r.Header.Get("Accept-Encoding"), encodings),
+				minSize:        minSize,
+			}
+			defer cw.close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding returns the encoding the client prefers among the ones
+// offered, by their q-values and then the order of offered, or "" when it
+// accepts none.
+func negotiateEncoding(accept string, offered []string) string {
+	if accept == "" {
+		return ""
+	}
+	accepted := make(map[string]float64)
+	for _, item := range strings.Split(accept, ",") {
+		coding, params, _ := strings.Cut(item, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		q := 1.0
+		if name, value, found := strings.Cut(strings.TrimSpace(params), "="); found && strings.TrimSpace(name) == "q" {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		accepted[coding] = q
+	}
+	best, bestQ := "", 0.0
+	for _, encoding := range offered {
+		q, ok := accepted[encoding]
+		if !ok {
+			q, ok = accepted["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// isJSON reports whether contentType is JSON, such as application/json or
+// application/problem+json.
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+// compressWriter holds the start of a response until it knows whether to
+// compress it: once the response turns out to be JSON of at least minSize
+// bytes, it is compressed, and otherwise it is written as is.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+
+	status int
+	// decided is set once the response is compressed by encoder, or passed
+	// through when encoder is nil.
+	decided bool
+	buf     []byte
+	encoder compressor
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.status != 0 || w.decided {
+		return
+	}
+	if status < http.StatusOK {
+		// the informational responses, such as 103 Early Hints, come first
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.status = status
+	header := w.Header()
+	if !isJSON(header.Get("Content-Type")) {
+		w.passThrough()
+		return
+	}
+	header.Add("Vary", "Accept-Encoding")
+	if w.encoding == "" || header.Get("Content-Encoding") != "" || status == http.StatusNoContent || status == http.StatusNotModified {
+		w.passThrough()
+		return
+	}
+	if length, err := strconv.Atoi(header.Get("Content-Length")); err == nil && length < w.minSize {
+		w.passThrough()
+	}
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if w.status == 0 && !w.decided {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.decided {
+		w.buf = append(w.buf, data...)
+		if len(w.buf) < w.minSize {
+			return len(data), nil
+		}
+		w.compress()
+		if err := w.writeBuffered(); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush sends what was written so far, compressed when the response is; a
+// response still held is sent as is.
+func (w *compressWriter) Flush() {
+	if w.status == 0 && !w.decided {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.decided {
+		w.passThrough()
+		if w.writeBuffered() != nil {
+			return
+		}
+	}
+	if w.encoder != nil {
+		if w.encoder.Flush() != nil {
+			return
+		}
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the writer of the connection, to
+// set its deadlines.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// passThrough writes the header of a response sent as is.
+func (w *compressWriter) passThrough() {
+	w.decided = true
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+// compress writes the header of a compressed response and takes an encoder.
+func (w *compressWriter) compress() {
+	w.decided = true
+	header := w.Header()
+	header.Set("Content-Encoding", w.encoding)
+	header.Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.status)
+	w.encoder = compressors[w.encoding].Get().(compressor)
+	w.encoder.Reset(w.ResponseWriter)
+}
+
+// writeBuffered writes the start of the response that was held.
+func (w *compressWriter) writeBuffered() error {
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.encoder != nil {
+		_, err = w.encoder.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// close ends the response once the handler returned: a response held below
+// minSize is sent as is, and the encoder is flushed and put back.
+func (w *compressWriter) close() {
+	if !w.decided && w.status != 0 {
+		w.passThrough()
+		w.writeBuffered()
+	}
+	if w.encoder == nil {
+		return
+	}
+	w.encoder.Close()
+	w.encoder.Reset(io.Discard)
+	compressors[w.encoding].Put(w.encoder)
+	w.encoder = nil
+}
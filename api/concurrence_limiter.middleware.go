@@ -1,4 +1,4 @@
-package main
+package api
 
 import (
 	"net/http"
@@ -20,4 +20,4 @@ func ConcurrencyLimiter(maxConcurrent int) func(next http.Handler) http.Handler
 			}
 		})
 	}
-}
\ No newline at end of file
+}
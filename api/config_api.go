@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// ReloadConfig godoc
+// @Summary      Reloads the configuration
+// @Description  Reloads orus.yaml, .env and the environment and applies the settings that can change at runtime (Ollama Cloud API key, format retries, admission limits, screening rules, tools). Sending SIGHUP to the process does the same. Requires an admin key (ORUS_API_ADMIN_KEYS) in the X-Admin-Key header
+// @Tags         config
+// @Produce      json
+// @Param        X-Admin-Key  header    string  true  "Admin key"
+// @Success      200  {object}  OrusResponse
+// @Failure      400  {object}  OrusResponse
+// @Failure      401  {object}  OrusResponse
+// @Failure      403  {object}  OrusResponse
+// @Router       /orus-api/v1/config/reload [post]
+func (s *OrusAPI) ReloadConfig(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	reload, err := s.Reload()
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_config", err.Error())
+		return
+	}
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{
+		"applied":          reload.Applied,
+		"restart_required": reload.RestartRequired,
+	}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Configuration reloaded successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// GetConfig godoc
+// @Summary      Returns the effective configuration
+// @Description  Returns the configuration the process is running with, after defaults, profile, file, .env, environment and reloads, keyed like orus.yaml. API keys and DSNs are masked. Requires an admin key (ORUS_API_ADMIN_KEYS) in the X-Admin-Key header
+// @Tags         config
+// @Produce      json
+// @Param        X-Admin-Key  header    string  true  "Admin key"
+// @Success      200  {object}  OrusResponse
+// @Failure      401  {object}  OrusResponse
+// @Failure      403  {object}  OrusResponse
+// @Router       /orus-api/v1/config [get]
+func (s *OrusAPI) GetConfig(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	config := s.CurrentConfig()
+	// Encoding through YAML names the keys like the configuration file and
+	// masks the secrets
+	data, err := yaml.Marshal(config)
+	var effective map[string]interface{}
+	if err == nil {
+		err = yaml.Unmarshal(data, &effective)
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "config_error", err.Error())
+		return
+	}
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{
+		"profile": config.Profile,
+		"config":  effective,
+	}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Configuration retrieved successfully"
+	respondJSON(w, http.StatusOK, response)
+}
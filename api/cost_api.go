@@ -0,0 +1,54 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Dsouza10082/orus"
+	"github.com/Dsouza10082/orus/ollama"
+)
+
+// CostReport is the cost of a cloud chat: the estimate checked before it
+// was sent, and the cost of the tokens Ollama Cloud reported.
+type CostReport struct {
+	Estimate orus.CostEstimate  `json:"estimate"`
+	Actual   *orus.CostEstimate `json:"actual,omitempty"`
+	MaxCost  *float64           `json:"max_cost,omitempty" swaggertype:"number" example:"0.01"`
+}
+
+// checkMaxCost answers 422 and returns false when maxCost is set and the
+// estimate is above it, or unknown because the model has no price.
+func checkMaxCost(w http.ResponseWriter, estimate orus.CostEstimate, maxCost *float64) bool {
+	if maxCost == nil {
+		return true
+	}
+	var code, message string
+	switch {
+	case !estimate.Priced:
+		code = "cost_unknown"
+		message = fmt.Sprintf("The model %s has no price in ORUS_API_CLOUD_PRICES, so max_cost cannot be enforced", estimate.Model)
+	case estimate.Cost > *maxCost:
+		code = "max_cost_exceeded"
+		message = fmt.Sprintf("The estimated cost %.6f %s is above max_cost %.6f", estimate.Cost, estimate.Currency, *maxCost)
+	default:
+		return true
+	}
+	respondJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+		"success": false,
+		"error":   code,
+		"message": message,
+		"cost":    CostReport{Estimate: estimate, MaxCost: maxCost},
+	})
+	return false
+}
+
+// actualCost prices the tokens of a reply; a reply served from the cache
+// sent none.
+func actualCost(costs orus.CostConfig, model string, resp *ollama.ChatResponse, cache orus.CacheStatus) *orus.CostEstimate {
+	if cache == orus.CacheHit {
+		actual := costs.Cost(model, 0, 0)
+		return &actual
+	}
+	actual := costs.Cost(model, resp.PromptEvalCount, resp.EvalCount)
+	return &actual
+}
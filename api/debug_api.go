@@ -0,0 +1,175 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const debugPath = "/orus-api/v1/debug"
+
+// maxGoroutineGroups caps the goroutine stacks listed by the runtime
+// snapshot, the most frequent first.
+const maxGoroutineGroups = 25
+
+var processStart = time.Now()
+
+// mountDebug serves pprof, expvar and the runtime snapshot under debugPath
+// for the admin keys. The routes have no timeout, so CPU profiles and traces
+// can run for as long as their seconds parameter asks.
+func (s *OrusAPI) mountDebug(r chi.Router) {
+	if expvar.Get("orus") == nil {
+		expvar.Publish("orus", expvar.Func(func() any { return s.runtimeVars() }))
+	}
+	r.Use(AdminOnly(s.CurrentConfig().Server.AdminKeys))
+	r.Use(StreamTimeout(0))
+	r.Use(withoutServerWriteTimeout)
+	r.Get(debugPath+"/runtime", s.GetRuntimeSnapshot)
+	r.Get(debugPath+"/vars", expvar.Handler().ServeHTTP)
+	r.Get(debugPath+"/pprof", pprof.Index)
+	r.Get(debugPath+"/pprof/cmdline", pprof.Cmdline)
+	r.Get(debugPath+"/pprof/profile", pprof.Profile)
+	r.Get(debugPath+"/pprof/symbol", pprof.Symbol)
+	r.Post(debugPath+"/pprof/symbol", pprof.Symbol)
+	r.Get(debugPath+"/pprof/trace", pprof.Trace)
+	r.Get(debugPath+"/pprof/{profile}", func(w http.ResponseWriter, r *http.Request) {
+		pprof.Handler(chi.URLParam(r, "profile")).ServeHTTP(w, r)
+	})
+}
+
+// withoutServerWriteTimeout hides the server from the pprof handlers, which
+// refuse profiles longer than its WriteTimeout even though StreamTimeout
+// lifted the write deadline of the route.
+func withoutServerWriteTimeout(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), http.ServerContextKey, nil)))
+	})
+}
+
+// runtimeVars is published as the "orus" expvar.
+func (s *OrusAPI) runtimeVars() map[string]interface{} {
+	return map[string]interface{}{
+		"uptime_seconds": int64(time.Since(processStart).Seconds()),
+		"goroutines":     runtime.NumGoroutine(),
+		"generation":     s.GenerationAdmission.Stats(),
+		"embedding":      s.EmbeddingAdmission.Stats(),
+	}
+}
+
+// GoroutineGroup is a set of goroutines with the same stack.
+type GoroutineGroup struct {
+	Count int      `json:"count"`
+	Stack []string `json:"stack"`
+}
+
+// GetRuntimeSnapshot godoc
+// @Summary      Returns a snapshot of the Go runtime
+// @Description  Returns the goroutine count, the heap and GC statistics and the goroutines grouped by stack, the most frequent first, to spot leaked streaming goroutines. Pass gc=true to collect garbage before reading the heap. Requires an admin key (ORUS_API_ADMIN_KEYS) in the X-Admin-Key header
+// @Tags         debug
+// @Produce      json
+// @Param        X-Admin-Key  header    string  true   "Admin key"
+// @Param        gc           query     bool    false  "Run a garbage collection first"
+// @Success      200  {object}  OrusResponse
+// @Failure      401  {object}  OrusResponse
+// @Failure      403  {object}  OrusResponse
+// @Failure      500  {object}  OrusResponse
+// @Router       /orus-api/v1/debug/runtime [get]
+func (s *OrusAPI) GetRuntimeSnapshot(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	if gc, _ := strconv.ParseBool(r.URL.Query().Get("gc")); gc {
+		runtime.GC()
+	}
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+
+	groups, err := goroutineGroups()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "profile_error", err.Error())
+		return
+	}
+	total := len(groups)
+	if total > maxGoroutineGroups {
+		groups = groups[:maxGoroutineGroups]
+	}
+
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{
+		"go_version":     runtime.Version(),
+		"gomaxprocs":     runtime.GOMAXPROCS(0),
+		"num_cpu":        runtime.NumCPU(),
+		"uptime_seconds": int64(time.Since(processStart).Seconds()),
+		"goroutines":     runtime.NumGoroutine(),
+		"heap": map[string]interface{}{
+			"alloc_bytes":    memory.HeapAlloc,
+			"in_use_bytes":   memory.HeapInuse,
+			"idle_bytes":     memory.HeapIdle,
+			"released_bytes": memory.HeapReleased,
+			"objects":        memory.HeapObjects,
+			"sys_bytes":      memory.Sys,
+		},
+		"gc": map[string]interface{}{
+			"cycles":         memory.NumGC,
+			"pause_total_ms": float64(memory.PauseTotalNs) / 1e6,
+			"last_pause_ms":  float64(memory.PauseNs[(memory.NumGC+255)%256]) / 1e6,
+			"next_gc_bytes":  memory.NextGC,
+		},
+		"goroutine_stacks":       groups,
+		"goroutine_stacks_total": total,
+	}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Runtime snapshot retrieved successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// goroutineGroups reads the goroutine profile, in which goroutines with the
+// same stack are already counted together:
+//
+//	3 @ 0x4321 0x4567
+//	#	0x4320	main.(*OrusAPI).ChatSendStream+0x120	/src/orus_api.go:812
+func goroutineGroups() ([]GoroutineGroup, error) {
+	var profile bytes.Buffer
+	if err := runtimepprof.Lookup("goroutine").WriteTo(&profile, 1); err != nil {
+		return nil, err
+	}
+	var groups []GoroutineGroup
+	scanner := bufio.NewScanner(&profile)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if count, _, ok := strings.Cut(line, " @ "); ok {
+			n, err := strconv.Atoi(count)
+			if err != nil {
+				continue
+			}
+			groups = append(groups, GoroutineGroup{Count: n})
+			continue
+		}
+		if len(groups) == 0 || !strings.HasPrefix(line, "#\t") {
+			continue
+		}
+		// #	<pc>	<function>+<offset>	<file>:<line>, aligned with tabs
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		function, _, _ := strings.Cut(fields[2], "+")
+		group := &groups[len(groups)-1]
+		group.Stack = append(group.Stack, function+" "+fields[len(fields)-1])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Count > groups[j].Count })
+	return groups, nil
+}
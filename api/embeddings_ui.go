@@ -0,0 +1,129 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/Dsouza10082/orus"
+	"github.com/Dsouza10082/orus/view"
+	"github.com/starfederation/datastar-go/datastar"
+)
+
+const maxProjectedPoints = 2000
+
+// EmbeddingsHandler is a handler for the embeddings page
+// It renders the form used to project texts or a collection to 2D
+func (s *OrusAPI) EmbeddingsHandler(w http.ResponseWriter, r *http.Request) {
+	initial := view.EmbeddingsSignals{
+		EmbedModel: orus.DefaultRAGEmbedModel,
+	}
+	if err := view.NewView().RenderEmbeddings(w, initial, s.VectorStore.Collections()); err != nil {
+		log.Printf("EmbeddingsHandler: failed to render embeddings: %v", err)
+		http.Error(w, "failed to render page", http.StatusInternalServerError)
+	}
+}
+
+// EmbeddingsProjectStream is a handler for the embeddings/project endpoint
+// It embeds the submitted texts, or loads the selected collection, and renders their PCA projection
+func (s *OrusAPI) EmbeddingsProjectStream(w http.ResponseWriter, r *http.Request) {
+	signals := &view.EmbeddingsSignals{}
+	if err := datastar.ReadSignals(r, signals); err != nil {
+		log.Printf("EmbeddingsProjectStream: failed to read signals: %v", err)
+		http.Error(w, "failed to read signals", http.StatusBadRequest)
+		return
+	}
+
+	sse := datastar.NewSSE(w, r)
+
+	var (
+		documents []orus.Document
+		source    string
+	)
+	if signals.Collection != "" {
+		documents = s.collectionDocuments(signals.Collection)
+		source = "collection " + signals.Collection
+	} else {
+		model := signals.EmbedModel
+		if model == "" {
+			model = orus.DefaultRAGEmbedModel
+		}
+		for group, block := range strings.Split(strings.ReplaceAll(signals.Texts, "\r\n", "\n"), "\n\n") {
+			for _, line := range strings.Split(block, "\n") {
+				if line = strings.TrimSpace(line); line == "" {
+					continue
+				}
+				if len(documents) >= maxProjectedPoints {
+					break
+				}
+				vector, err := s.Orus.Embed(model, line)
+				if err != nil {
+					_ = sse.ConsoleError(fmt.Errorf("embedding error: %w", err))
+					return
+				}
+				documents = append(documents, orus.Document{
+					Content:   line,
+					Embedding: vector,
+					Metadata:  map[string]interface{}{"group": fmt.Sprintf("group %d", group+1)},
+				})
+			}
+		}
+		source = model
+	}
+	if len(documents) < 2 {
+		_ = sse.ConsoleError(fmt.Errorf("at least two texts are needed for a projection"))
+		return
+	}
+
+	vectors := make([][]float64, len(documents))
+	for i, document := range documents {
+		vectors[i] = document.Embedding
+	}
+	projected := ProjectPCA(vectors, 2)
+
+	points := make([]view.EmbeddingPoint, len(documents))
+	for i, document := range documents {
+		points[i] = view.EmbeddingPoint{
+			X:     projected[i][0],
+			Y:     projected[i][1],
+			Text:  document.Content,
+			Group: documentGroup(document),
+		}
+	}
+	html, err := view.RenderEmbeddingPlot(view.NewEmbeddingPlot(source, points))
+	if err != nil {
+		_ = sse.ConsoleError(err)
+		return
+	}
+	_ = sse.PatchElements(html)
+}
+
+// collectionDocuments returns up to maxProjectedPoints documents of the
+// collection sharing the dimension of the first one, so mixed models are not projected together.
+func (s *OrusAPI) collectionDocuments(collection string) []orus.Document {
+	documents := make([]orus.Document, 0)
+	for _, document := range s.VectorStore.Documents(collection, nil) {
+		if len(document.Embedding) == 0 {
+			continue
+		}
+		if len(documents) > 0 && len(document.Embedding) != len(documents[0].Embedding) {
+			continue
+		}
+		documents = append(documents, document)
+		if len(documents) >= maxProjectedPoints {
+			break
+		}
+	}
+	return documents
+}
+
+// documentGroup picks the metadata field used to color a point.
+func documentGroup(document orus.Document) string {
+	for _, key := range []string{"group", "source", "session_id", "user_id", "model"} {
+		if value, ok := document.Metadata[key].(string); ok && value != "" {
+			return value
+		}
+	}
+	return ""
+}
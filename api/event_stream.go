@@ -0,0 +1,512 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Dsouza10082/orus"
+	"github.com/Dsouza10082/orus/ollama"
+)
+
+// StreamEvent names the events of the streaming endpoints. Every event is
+// written as
+//
+//	id: <seq>
+//	event: <name>
+//	data: <json payload>
+//
+// where seq starts at 1 and grows by one per event, and is repeated in the
+// payload, so a client that sees a jump knows it missed events. The
+// generation streams announced with an X-Stream-Id header are resumed from
+// the last seq received (see StreamBuffers).
+type StreamEvent string
+
+const (
+	// EventToken carries a piece of the generated answer (TokenPayload).
+	EventToken StreamEvent = "token"
+	// EventPartial carries the answer of a generation with a JSON format
+	// as far as it was generated, closed into a well-formed value, in place
+	// of its tokens (PartialPayload).
+	EventPartial StreamEvent = "partial"
+	// EventThinking carries a piece of the model reasoning (ThinkingPayload).
+	EventThinking StreamEvent = "thinking"
+	// EventProgress reports the progress of a model download, an image
+	// generation, a backup or restore, or an ingestion (ProgressPayload).
+	EventProgress StreamEvent = "progress"
+	// EventError ends the stream with a failure (ErrorPayload).
+	EventError StreamEvent = "error"
+	// EventDone ends the stream successfully (DonePayload).
+	EventDone StreamEvent = "done"
+	// EventChunk carries an Ollama chat chunk as is, in passthrough mode.
+	EventChunk StreamEvent = "chunk"
+	// EventToolCall reports a tool the model calls, before it runs
+	// (ToolCallPayload).
+	EventToolCall StreamEvent = "tool_call"
+	// EventTool reports a tool call run by the server, with its result
+	// (ToolPayload).
+	EventTool StreamEvent = "tool"
+	// EventUsage reports the tokens and durations of a generation, from
+	// its last chunk, before its done event (UsagePayload).
+	EventUsage StreamEvent = "usage"
+	// EventStep reports the progress of a workflow step (StepPayload).
+	EventStep StreamEvent = "step"
+	// EventAgent reports an agent of a multi-agent run that finished
+	// (AgentPayload).
+	EventAgent StreamEvent = "agent"
+	// EventAborted ends the stream of a generation stopped by the watchdog
+	// (AbortedPayload).
+	EventAborted StreamEvent = "aborted"
+)
+
+type TokenPayload struct {
+	Seq     int64  `json:"seq"`
+	Content string `json:"content"`
+}
+
+type PartialPayload struct {
+	Seq   int64           `json:"seq"`
+	Value json.RawMessage `json:"value"`
+}
+
+type ThinkingPayload struct {
+	Seq     int64  `json:"seq"`
+	Content string `json:"content"`
+}
+
+type ProgressPayload struct {
+	Seq       int64  `json:"seq"`
+	Status    string `json:"status"`
+	Digest    string `json:"digest,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+	Completed int64  `json:"completed,omitempty"`
+	// ETA is how long an ingestion stage should still take.
+	ETA string `json:"eta,omitempty"`
+}
+
+type ToolCallPayload struct {
+	Seq int64 `json:"seq"`
+	// Round is the round of a tool loop run by the server; it is 0 for a
+	// call streamed by the model for the client to run.
+	Round     int                    `json:"round,omitempty"`
+	Tool      string                 `json:"tool"`
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+type ToolPayload struct {
+	Seq int64 `json:"seq"`
+	orus.ToolStep
+}
+
+type StepPayload struct {
+	Seq int64 `json:"seq"`
+	orus.WorkflowEvent
+}
+
+type AgentPayload struct {
+	Seq int64 `json:"seq"`
+	orus.AgentNode
+}
+
+type AbortedPayload struct {
+	Seq int64 `json:"seq"`
+	orus.GenerationAborted
+}
+
+// UsagePayload has the durations of Ollama, in nanoseconds.
+type UsagePayload struct {
+	Seq                int64 `json:"seq"`
+	PromptTokens       int   `json:"prompt_tokens"`
+	CompletionTokens   int   `json:"completion_tokens"`
+	TotalDuration      int64 `json:"total_duration,omitempty"`
+	LoadDuration       int64 `json:"load_duration,omitempty"`
+	PromptEvalDuration int64 `json:"prompt_eval_duration,omitempty"`
+	EvalDuration       int64 `json:"eval_duration,omitempty"`
+}
+
+type ErrorPayload struct {
+	Seq     int64  `json:"seq"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type DonePayload struct {
+	Seq              int64                  `json:"seq"`
+	Message          string                 `json:"message"`
+	Serial           string                 `json:"serial,omitempty"`
+	RequestID        string                 `json:"request_id,omitempty"`
+	Model            string                 `json:"model,omitempty"`
+	Content          string                 `json:"content,omitempty"`
+	Thinking         string                 `json:"thinking,omitempty"`
+	Think            bool                   `json:"think,omitempty"`
+	PromptTokens     int                    `json:"prompt_tokens,omitempty"`
+	CompletionTokens int                    `json:"completion_tokens,omitempty"`
+	FormatError      string                 `json:"format_error,omitempty"`
+	Screening        *orus.ScreenReport     `json:"screening,omitempty"`
+	ToolTrace        []orus.ToolStep        `json:"tool_trace,omitempty"`
+	Workflow         *orus.WorkflowRun      `json:"workflow,omitempty"`
+	Agents           *orus.AgentRun         `json:"agents,omitempty"`
+	Image            *GeneratedImage        `json:"image,omitempty"`
+	Cost             *CostReport            `json:"cost,omitempty"`
+	Backup           *orus.Backup           `json:"backup,omitempty"`
+	Ingest           map[string]interface{} `json:"ingest,omitempty"`
+	TimeTaken        string                 `json:"time_taken"`
+}
+
+// EventStream writes the named, sequenced events of a streaming endpoint.
+// It is safe for concurrent use.
+type EventStream struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+	seq     int64
+	// buffer keeps the events of a resumable stream; gone is set once its
+	// first client cannot be written to.
+	buffer *streamBuffer
+	gone   bool
+	// batch holds the pieces of a generation, thinking and content, until
+	// they are due; nil sends them as they come.
+	batch    *chunkBatch
+	thinking strings.Builder
+	content  strings.Builder
+	// partial parses the answer of a generation with a JSON format
+	partial *partialJSON
+	// transform post-processes the answer of a generation
+	transform transformChain
+}
+
+// NewEventStream starts an event stream on w. When w cannot be flushed it
+// answers 500 and returns false.
+func NewEventStream(w http.ResponseWriter) (*EventStream, bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondError(w, http.StatusInternalServerError, "streaming_not_supported", "Streaming not supported")
+		return nil, false
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return &EventStream{w: w, flusher: flusher}, true
+}
+
+func (s *EventStream) Token(content string) error {
+	return s.send(EventToken, func(seq int64) interface{} {
+		return TokenPayload{Seq: seq, Content: content}
+	})
+}
+
+func (s *EventStream) Thinking(content string) error {
+	return s.send(EventThinking, func(seq int64) interface{} {
+		return ThinkingPayload{Seq: seq, Content: content}
+	})
+}
+
+func (s *EventStream) Progress(progress ollama.PullModelProgress) error {
+	return s.send(EventProgress, func(seq int64) interface{} {
+		return ProgressPayload{
+			Seq:       seq,
+			Status:    progress.Status,
+			Digest:    progress.Digest,
+			Total:     progress.Total,
+			Completed: progress.Completed,
+		}
+	})
+}
+
+// BackupProgress reports a stage of a backup or a restore, named in the
+// status.
+func (s *EventStream) BackupProgress(progress orus.BackupProgress) error {
+	return s.send(EventProgress, func(seq int64) interface{} {
+		return ProgressPayload{
+			Seq:       seq,
+			Status:    progress.Stage,
+			Total:     progress.Total,
+			Completed: progress.Completed,
+		}
+	})
+}
+
+// IngestProgress reports a stage of an ingestion, named in the status.
+func (s *EventStream) IngestProgress(progress orus.IngestProgress) error {
+	return s.send(EventProgress, func(seq int64) interface{} {
+		payload := ProgressPayload{
+			Seq:       seq,
+			Status:    progress.Stage,
+			Total:     progress.Total,
+			Completed: progress.Completed,
+		}
+		if progress.ETA > 0 {
+			payload.ETA = progress.ETA.Round(time.Second).String()
+		}
+		return payload
+	})
+}
+
+func (s *EventStream) Error(code string, err error) error {
+	return s.send(EventError, func(seq int64) interface{} {
+		return ErrorPayload{Seq: seq, Code: code, Message: err.Error()}
+	})
+}
+
+// ToolCall reports a call of a tool loop, before the tool runs.
+func (s *EventStream) ToolCall(call orus.ToolStep) error {
+	return s.send(EventToolCall, func(seq int64) interface{} {
+		return ToolCallPayload{Seq: seq, Round: call.Round, Tool: call.Tool, Arguments: call.Arguments}
+	})
+}
+
+func (s *EventStream) Usage(usage UsagePayload) error {
+	return s.send(EventUsage, func(seq int64) interface{} {
+		usage.Seq = seq
+		return usage
+	})
+}
+
+func (s *EventStream) Tool(step orus.ToolStep) error {
+	return s.send(EventTool, func(seq int64) interface{} {
+		return ToolPayload{Seq: seq, ToolStep: step}
+	})
+}
+
+func (s *EventStream) Step(event orus.WorkflowEvent) error {
+	return s.send(EventStep, func(seq int64) interface{} {
+		return StepPayload{Seq: seq, WorkflowEvent: event}
+	})
+}
+
+func (s *EventStream) Agent(node orus.AgentNode) error {
+	return s.send(EventAgent, func(seq int64) interface{} {
+		return AgentPayload{Seq: seq, AgentNode: node}
+	})
+}
+
+func (s *EventStream) Aborted(aborted *orus.GenerationAborted) error {
+	return s.send(EventAborted, func(seq int64) interface{} {
+		return AbortedPayload{Seq: seq, GenerationAborted: *aborted}
+	})
+}
+
+func (s *EventStream) Done(done DonePayload) error {
+	return s.send(EventDone, func(seq int64) interface{} {
+		done.Seq = seq
+		return done
+	})
+}
+
+// batchChunks batches the pieces of the chunks as config says.
+func (s *EventStream) batchChunks(config orus.StreamConfig) {
+	if batch := newChunkBatch(config); batch.batches() {
+		s.batch = batch
+	}
+}
+
+// streamJSON sends the answer of the chunks as partial events, for a
+// generation with a JSON format.
+func (s *EventStream) streamJSON() {
+	s.partial = newPartialJSON()
+}
+
+// transformAnswer applies the named transforms to the answer of the chunks,
+// as they are sent.
+func (s *EventStream) transformAnswer(names []string) {
+	s.transform = newTransformChain(names)
+}
+
+// Chunk forwards a chat chunk as a thinking and/or token, or partial,
+// event, a tool_call event per tool the model calls, and the last chunk as
+// a usage event. When the stream batches the chunks, their pieces are held
+// until they are due or another event is sent; what the transforms held
+// back is sent with the last chunk.
+func (s *EventStream) Chunk(chunk ollama.ChatStreamResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.chunkPieces(chunk); err != nil {
+		return err
+	}
+	if len(chunk.Message.ToolCalls) == 0 && !chunk.Done {
+		return nil
+	}
+	if err := s.flush(); err != nil {
+		return err
+	}
+	if chunk.Done && s.transform != nil {
+		tail := s.transform.Close()
+		s.transform = nil
+		if err := s.pieces("", tail); err != nil {
+			return err
+		}
+	}
+	for _, call := range chunk.Message.ToolCalls {
+		if err := s.encode(EventToolCall, func(seq int64) interface{} {
+			return ToolCallPayload{Seq: seq, Tool: call.Function.Name, Arguments: call.Function.Arguments}
+		}); err != nil {
+			return err
+		}
+	}
+	if !chunk.Done {
+		return nil
+	}
+	return s.encode(EventUsage, func(seq int64) interface{} {
+		return UsagePayload{
+			Seq:                seq,
+			PromptTokens:       chunk.PromptEvalCount,
+			CompletionTokens:   chunk.EvalCount,
+			TotalDuration:      chunk.TotalDuration,
+			LoadDuration:       chunk.LoadDuration,
+			PromptEvalDuration: chunk.PromptEvalDuration,
+			EvalDuration:       chunk.EvalDuration,
+		}
+	})
+}
+
+// chunkPieces sends the thinking and the answer of a chunk, or holds them
+// in the batch. It must be called with mu held.
+func (s *EventStream) chunkPieces(chunk ollama.ChatStreamResponse) error {
+	if s.batch == nil {
+		return s.pieces(chunk.Message.Thinking, chunk.Message.Content)
+	}
+	if chunk.Message.Thinking != "" && s.content.Len() > 0 {
+		// the pieces are sent in the order they came
+		if err := s.flush(); err != nil {
+			return err
+		}
+	}
+	s.thinking.WriteString(chunk.Message.Thinking)
+	s.content.WriteString(chunk.Message.Content)
+	if !s.batch.add(utf8.RuneCountInString(chunk.Message.Thinking) + utf8.RuneCountInString(chunk.Message.Content)) {
+		return nil
+	}
+	return s.flush()
+}
+
+// flush sends the pieces held by the batch. It must be called with mu held.
+func (s *EventStream) flush() error {
+	if s.batch == nil {
+		return nil
+	}
+	s.batch.flush()
+	thinking, content := s.thinking.String(), s.content.String()
+	s.thinking.Reset()
+	s.content.Reset()
+	return s.pieces(thinking, content)
+}
+
+// pieces sends pieces of the thinking and the answer of a generation. It
+// must be called with mu held.
+func (s *EventStream) pieces(thinking, content string) error {
+	if thinking != "" {
+		if err := s.encode(EventThinking, func(seq int64) interface{} {
+			return ThinkingPayload{Seq: seq, Content: thinking}
+		}); err != nil {
+			return err
+		}
+	}
+	if s.transform != nil {
+		content = s.transform.Write(content)
+	}
+	if content == "" {
+		return nil
+	}
+	if s.partial != nil {
+		value, err := s.partial.Write(content)
+		if err == nil {
+			if value == nil {
+				return nil
+			}
+			return s.encode(EventPartial, func(seq int64) interface{} {
+				return PartialPayload{Seq: seq, Value: value}
+			})
+		}
+		// an answer that is not JSON goes on as tokens, from its start
+		content = string(s.partial.buf)
+		s.partial = nil
+	}
+	return s.encode(EventToken, func(seq int64) interface{} {
+		return TokenPayload{Seq: seq, Content: content}
+	})
+}
+
+// Raw sends data, a single line of JSON, as the payload of event without
+// encoding it again. Its seq is only in the id field.
+func (s *EventStream) Raw(event StreamEvent, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.flush(); err != nil {
+		return err
+	}
+	s.seq++
+	return s.write(event, data)
+}
+
+func (s *EventStream) send(event StreamEvent, payload func(seq int64) interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.flush(); err != nil {
+		return err
+	}
+	return s.encode(event, payload)
+}
+
+// encode sends event with its payload. It must be called with mu held.
+func (s *EventStream) encode(event StreamEvent, payload func(seq int64) interface{}) error {
+	s.seq++
+	data, err := json.Marshal(payload(s.seq))
+	if err != nil {
+		return fmt.Errorf("error encoding %s event: %w", event, err)
+	}
+	return s.write(event, data)
+}
+
+// write sends an event, and keeps it in the buffer of a resumable stream,
+// whose client may go away without stopping the stream.
+func (s *EventStream) write(event StreamEvent, data []byte) error {
+	if s.buffer != nil {
+		s.buffer.add(bufferedEvent{seq: s.seq, event: event, data: bytes.Clone(data)})
+		if s.gone {
+			return nil
+		}
+	}
+	if err := s.writeEvent(s.seq, event, data); err != nil {
+		if s.buffer != nil {
+			s.gone = true
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// replay sends a buffered event with its own seq.
+func (s *EventStream) replay(event bufferedEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.writeEvent(event.seq, event.event, event.data)
+}
+
+func (s *EventStream) writeEvent(seq int64, event StreamEvent, data []byte) error {
+	if _, err := fmt.Fprintf(s.w, "id: %d\nevent: %s\ndata: %s\n\n", seq, event, data); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// Close sends the pieces still held by the batch, and ends a resumable
+// stream, so the clients following it stop. The other streams end with
+// their handler.
+func (s *EventStream) Close() {
+	s.mu.Lock()
+	_ = s.flush()
+	s.mu.Unlock()
+	if s.buffer != nil {
+		s.buffer.end()
+	}
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Dsouza10082/orus"
+	"github.com/Dsouza10082/orus/ollama"
+)
+
+// SubmitFeedback godoc
+// @Summary      Records user feedback about a generation
+// @Description  Records thumbs, a 1-5 score and/or a free-text comment for the generation identified by the serial returned by the LLM endpoints
+// @Tags         feedback
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  OrusResponse
+// @Failure      400  {object}  OrusResponse
+// @Failure      404  {object}  OrusResponse
+// @Router       /orus-api/v1/feedback [post]
+func (s *OrusAPI) SubmitFeedback(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	type Req struct {
+		Serial  string `json:"serial"`
+		Thumbs  string `json:"thumbs"`
+		Score   *int   `json:"score"`
+		Comment string `json:"comment"`
+	}
+
+	request, ok := decodeJSON[Req](w, r)
+	if !ok {
+		return
+	}
+	if request.Serial == "" {
+		respondError(w, http.StatusBadRequest, "missing_serial", "Field 'serial' is required")
+		return
+	}
+	if request.Thumbs != "" && request.Thumbs != "up" && request.Thumbs != "down" {
+		respondError(w, http.StatusBadRequest, "invalid_thumbs", "Field 'thumbs' must be 'up' or 'down'")
+		return
+	}
+	if request.Score != nil && (*request.Score < 1 || *request.Score > 5) {
+		respondError(w, http.StatusBadRequest, "invalid_score", "Field 'score' must be between 1 and 5")
+		return
+	}
+	if request.Thumbs == "" && request.Score == nil && request.Comment == "" {
+		respondError(w, http.StatusBadRequest, "missing_feedback", "One of 'thumbs', 'score' or 'comment' is required")
+		return
+	}
+
+	generation, err := s.Generations.Get(request.Serial)
+	if errors.Is(err, orus.ErrGenerationNotFound) {
+		respondError(w, http.StatusNotFound, "generation_not_found", "No generation found for serial "+request.Serial)
+		return
+	}
+
+	feedback, err := s.Feedback.Add(orus.Feedback{
+		Serial:     request.Serial,
+		Thumbs:     request.Thumbs,
+		Score:      request.Score,
+		Comment:    request.Comment,
+		Generation: generation,
+	})
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "feedback_error", err.Error())
+		return
+	}
+
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{
+		"feedback": feedback,
+	}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Feedback recorded successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// GetFeedbackSummary godoc
+// @Summary      Aggregates feedback to find poorly performing prompts
+// @Description  Groups feedback by prompt, model or endpoint with thumbs counts and average score, worst rated first
+// @Tags         feedback
+// @Produce      json
+// @Param        group_by  query     string  false  "prompt (default), model or endpoint"
+// @Success      200  {object}  OrusResponse
+// @Failure      400  {object}  OrusResponse
+// @Router       /orus-api/v1/feedback/summary [get]
+func (s *OrusAPI) GetFeedbackSummary(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	groupBy := r.URL.Query().Get("group_by")
+	if groupBy == "" {
+		groupBy = "prompt"
+	}
+	if groupBy != "prompt" && groupBy != "model" && groupBy != "endpoint" {
+		respondError(w, http.StatusBadRequest, "invalid_group_by", "Query parameter 'group_by' must be 'prompt', 'model' or 'endpoint'")
+		return
+	}
+
+	feedback, err := s.Feedback.List()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "feedback_error", err.Error())
+		return
+	}
+
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{
+		"group_by": groupBy,
+		"total":    len(feedback),
+		"groups":   orus.SummarizeFeedback(feedback, groupBy),
+	}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Feedback summary retrieved successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// recordGeneration stores the exchange under serial so feedback can reference it,
+// and adds it to the audit record of the request when the route is audited.
+// Messages are copied because pooled chat requests are reused after the handler returns.
+// When PII redaction targets storage, the stored exchange keeps only placeholders.
+// The payloads captured in debug mode are stored under serial too, as sent.
+func (s *OrusAPI) recordGeneration(ctx context.Context, serial string, endpoint string, chatRequest *ollama.ChatRequest, content string, startTime time.Time) {
+	messages := make([]ollama.Message, len(chatRequest.Messages))
+	copy(messages, chatRequest.Messages)
+	if s.PII != nil && s.PII.Storage {
+		var redaction *ollama.Redaction
+		messages, redaction = s.PII.RedactMessages(ctx, messages)
+		content = redaction.Redact(content)
+	}
+	if record := orus.AuditRecordFrom(ctx); record != nil {
+		record.Serial = serial
+		record.Model = chatRequest.Model
+		record.Messages = messages
+		record.Response = content
+	}
+	s.Generations.Record(orus.Generation{
+		Serial:    serial,
+		Endpoint:  endpoint,
+		Model:     chatRequest.Model,
+		Messages:  messages,
+		Response:  content,
+		TimeTaken: time.Since(startTime),
+	})
+	s.recordPayloads(ctx, serial, endpoint, chatRequest.Model)
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"regexp"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// ErrGenerationCanceled is the cause of the context of a generation stopped
+// with POST /orus-api/v1/generations/{id}/cancel.
+var ErrGenerationCanceled = errors.New("the generation was canceled")
+
+// statusCanceled answers a generation that was canceled, as nginx logs a
+// request closed by its client.
+const statusCanceled = 499
+
+// generationIDPattern is what a client may send as X-Generation-Id.
+var generationIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// RunningGenerations tracks the generations in progress by generation ID,
+// so a client, or a UI with a stop button, can cancel one and abort its
+// upstream Ollama request.
+type RunningGenerations struct {
+	mu      sync.Mutex
+	running map[string]*runningGeneration
+}
+
+type runningGeneration struct {
+	// owner is the digest of the API key that started the generation, the
+	// only one that may cancel it.
+	owner [sha256.Size]byte
+
+	mu       sync.Mutex
+	cancels  []context.CancelCauseFunc
+	canceled bool
+}
+
+type runningGenerationKey struct{}
+
+func NewRunningGenerations() *RunningGenerations {
+	return &RunningGenerations{running: make(map[string]*runningGeneration)}
+}
+
+// Middleware runs the requests of the routes it wraps as generations that
+// can be canceled. The ID is the X-Generation-Id header of the request, so
+// a client waiting for a reply knows it, or a new one; it is answered in
+// the X-Generation-Id header, which a stream sends before its first event.
+func (g *RunningGenerations) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Generation-Id")
+		if id == "" {
+			id = uuid.New().String()
+		} else if !generationIDPattern.MatchString(id) {
+			respondError(w, http.StatusBadRequest, "invalid_generation_id", "X-Generation-Id must be 1 to 128 letters, digits, dots, dashes or underscores")
+			return
+		}
+		ctx, cancel := context.WithCancelCause(r.Context())
+		defer cancel(nil)
+		running := &runningGeneration{owner: streamOwner(r), cancels: []context.CancelCauseFunc{cancel}}
+		g.mu.Lock()
+		if _, ok := g.running[id]; ok {
+			g.mu.Unlock()
+			respondError(w, http.StatusConflict, "generation_exists", "A generation with this X-Generation-Id is running")
+			return
+		}
+		g.running[id] = running
+		g.mu.Unlock()
+		defer func() {
+			g.mu.Lock()
+			delete(g.running, id)
+			g.mu.Unlock()
+		}()
+		w.Header().Set("X-Generation-Id", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, runningGenerationKey{}, running)))
+	})
+}
+
+// Cancel cancels the generation id when it was started with the API key of
+// r, and reports whether it was running.
+func (g *RunningGenerations) Cancel(id string, r *http.Request) bool {
+	g.mu.Lock()
+	running := g.running[id]
+	g.mu.Unlock()
+	if running == nil {
+		return false
+	}
+	owner := streamOwner(r)
+	if subtle.ConstantTimeCompare(owner[:], running.owner[:]) != 1 {
+		return false
+	}
+	running.mu.Lock()
+	running.canceled = true
+	cancels := running.cancels
+	running.mu.Unlock()
+	for _, cancel := range cancels {
+		cancel(ErrGenerationCanceled)
+	}
+	return true
+}
+
+// onCancel calls cancel too when the generation of ctx is canceled, for the
+// work detached from the request context, such as a resumable stream.
+func onCancel(ctx context.Context, cancel context.CancelCauseFunc) {
+	running, _ := ctx.Value(runningGenerationKey{}).(*runningGeneration)
+	if running == nil {
+		return
+	}
+	running.mu.Lock()
+	defer running.mu.Unlock()
+	if running.canceled {
+		cancel(ErrGenerationCanceled)
+		return
+	}
+	running.cancels = append(running.cancels, cancel)
+}
+
+// canceledCause replaces the error of a generation stopped by the cancel
+// endpoint, which is the context error, with ErrGenerationCanceled.
+func canceledCause(ctx context.Context, err error) error {
+	if err != nil && errors.Is(context.Cause(ctx), ErrGenerationCanceled) {
+		return ErrGenerationCanceled
+	}
+	return err
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// CancelGeneration godoc
+// @Summary      Cancels a running generation
+// @Description  Stops a chat or stream generation and aborts its upstream Ollama request. The ID is the X-Generation-Id header of the generation, sent by the client or answered by the server; a generation can only be canceled with the API key that started it. The canceled request answers 499, or ends its stream with an error event of code canceled
+// @Tags         llm
+// @Produce      json
+// @Param        id   path      string  true  "Generation ID"
+// @Success      200  {object}  OrusResponse
+// @Failure      404  {object}  OrusResponse
+// @Router       /orus-api/v1/generations/{id}/cancel [post]
+func (s *OrusAPI) CancelGeneration(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	id := chi.URLParam(r, "id")
+	if !s.Running.Cancel(id, r) {
+		respondError(w, http.StatusNotFound, "generation_not_found", "The generation is unknown or already finished")
+		return
+	}
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{"id": id, "canceled": true}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Generation canceled"
+	respondJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/Dsouza10082/orus"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	idempotencyHeader = "Idempotency-Key"
+	maxIdempotencyKey = 255
+)
+
+// Idempotency answers a POST to the REST API carrying an Idempotency-Key
+// header with the response of the first request sent with that key, when
+// there was one, instead of running it again. The keys are kept per
+// caller. Streams and server errors are not kept, so retrying them runs
+// them again; videos are too large to be fingerprinted and are not
+// covered.
+func Idempotency(store *orus.IdempotencyStore) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(idempotencyHeader)
+			if store == nil || key == "" || r.Method != http.MethodPost ||
+				!strings.HasPrefix(r.URL.Path, apiPathPrefix) || r.URL.Path == videoIngestPath {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKey {
+				respondError(w, http.StatusBadRequest, "invalid_idempotency_key", "The Idempotency-Key header is longer than 255 characters")
+				return
+			}
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				respondError(w, http.StatusRequestEntityTooLarge, "body_too_large", "The request body is too large")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			sum := sha256.New()
+			io.WriteString(sum, r.Method+" "+r.URL.RequestURI()+"\n")
+			sum.Write(body)
+			fingerprint := hex.EncodeToString(sum.Sum(nil))
+			key = fairnessKey(r) + ":" + key
+
+			kept, err := store.Begin(key, fingerprint)
+			switch {
+			case errors.Is(err, orus.ErrIdempotencyPending):
+				respondError(w, http.StatusConflict, "idempotency_in_progress", "A request with this Idempotency-Key is in progress, retry later")
+				return
+			case errors.Is(err, orus.ErrIdempotencyMismatch):
+				respondError(w, http.StatusUnprocessableEntity, "idempotency_key_reused", "The Idempotency-Key was used for another request")
+				return
+			case err != nil:
+				// the request runs as if it had no key rather than failing
+				log.Println("Error checking the idempotency key: ", err)
+				next.ServeHTTP(w, r)
+				return
+			case kept != nil:
+				for name, values := range kept.Header {
+					w.Header()[name] = values
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(kept.Status)
+				w.Write(kept.Body)
+				return
+			}
+
+			var buffer bytes.Buffer
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			ww.Tee(&buffer)
+			defer func() {
+				if ww.Status() == 0 || ww.Status() >= http.StatusInternalServerError ||
+					strings.HasPrefix(ww.Header().Get("Content-Type"), "text/event-stream") {
+					store.Release(key)
+					return
+				}
+				store.Finish(key, orus.IdempotentResponse{
+					Fingerprint: fingerprint,
+					Status:      ww.Status(),
+					Header:      ww.Header().Clone(),
+					Body:        buffer.Bytes(),
+				})
+			}()
+			next.ServeHTTP(ww, r)
+		})
+	}
+}
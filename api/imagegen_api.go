@@ -0,0 +1,143 @@
+package api
+
+import (
+	"cmp"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Dsouza10082/orus"
+	"github.com/Dsouza10082/orus/ollama"
+)
+
+// GeneratedImage is a generated image, inline or stored.
+type GeneratedImage struct {
+	Provider    string `json:"provider"`
+	Model       string `json:"model,omitempty"`
+	ContentType string `json:"content_type"`
+	// Image is the base64 image, unless it was stored.
+	Image string `json:"image,omitempty"`
+	// Stored is the stored image, whose handle can be sent to vision chats.
+	Stored *orus.StoredImage `json:"stored,omitempty"`
+}
+
+// GenerateImage godoc
+// @Summary      Generates an image from a prompt
+// @Description  Generates an image with the provider of ORUS_API_IMAGE_GEN_PROVIDER: a local automatic1111 or ComfyUI API, or the OpenAI images API. The image is answered as base64, stored as an upload whose handle can be sent to vision chats, or answered raw. With stream the progress is sent as progress events and the image in the done event
+// @Tags         llm
+// @Accept       json
+// @Produce      json
+// @Produce      image/png
+// @Produce      text/event-stream
+// @Param        request  body  orus.ImageGenerationRequest  true  "Generation"
+// @Success      200  {object}  OrusResponse
+// @Failure      400  {object}  OrusResponse
+// @Failure      502  {object}  OrusResponse
+// @Failure      503  {object}  OrusResponse
+// @Router       /orus-api/v1/generate-image [post]
+func (s *OrusAPI) GenerateImage(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	request, ok := decodeJSON[orus.ImageGenerationRequest](w, r)
+	if !ok {
+		return
+	}
+	config := s.CurrentConfig().ImageGeneration
+	generator, err := orus.NewImageGenerator(config)
+	if err != nil {
+		respondError(w, http.StatusServiceUnavailable, "image_generation_disabled", err.Error())
+		return
+	}
+	if request.Output == "handle" && s.Images == nil {
+		respondError(w, http.StatusServiceUnavailable, "images_disabled", "Image uploads are disabled, the image cannot be stored")
+		return
+	}
+	model := cmp.Or(request.Model, config.Model)
+	if model == "" && config.Provider == "openai" {
+		model = orus.DefaultOpenAIImageModel
+	}
+
+	if !request.Stream {
+		data, err := generator.Generate(r.Context(), *request, nil)
+		if err != nil {
+			respondError(w, imageGenStatus(err), "image_generation_error", fmt.Sprintf("Error generating image: %v", err))
+			return
+		}
+		if request.Output == "raw" {
+			w.Header().Set("Content-Type", http.DetectContentType(data))
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(data)
+			return
+		}
+		image, verr := s.generatedImage(*request, config.Provider, model, data)
+		if verr != nil {
+			respondError(w, http.StatusBadGateway, verr.Code, verr.Message)
+			return
+		}
+		response := NewOrusResponse()
+		response.Data = map[string]interface{}{"image": image}
+		response.TimeTaken = time.Since(startTime)
+		response.Message = "Image generated successfully"
+		respondJSON(w, http.StatusOK, response)
+		return
+	}
+
+	events, ok := NewEventStream(w)
+	if !ok {
+		return
+	}
+	data, err := generator.Generate(r.Context(), *request, func(progress orus.ImageGenerationProgress) {
+		_ = events.Progress(ollama.PullModelProgress{
+			Status:    progress.Status,
+			Total:     int64(progress.Steps),
+			Completed: int64(progress.Step),
+		})
+	})
+	switch {
+	case ollama.IsCanceled(err):
+		return
+	case err != nil:
+		_ = events.Error("image_generation_error", err)
+		return
+	}
+	image, verr := s.generatedImage(*request, config.Provider, model, data)
+	if verr != nil {
+		_ = events.Error(verr.Code, errors.New(verr.Message))
+		return
+	}
+	_ = events.Done(DonePayload{
+		Message:   "Image generated successfully",
+		Model:     model,
+		Image:     image,
+		TimeTaken: time.Since(startTime).String(),
+	})
+}
+
+// generatedImage answers the image inline or stores it, as the request
+// asks.
+func (s *OrusAPI) generatedImage(request orus.ImageGenerationRequest, provider, model string, data []byte) (*GeneratedImage, *orus.ValidationError) {
+	image := &GeneratedImage{Provider: provider, Model: model, ContentType: http.DetectContentType(data)}
+	if request.Output != "handle" {
+		image.Image = base64.StdEncoding.EncodeToString(data)
+		return image, nil
+	}
+	stored, verr := s.Images.Put(data)
+	if verr != nil {
+		return nil, verr
+	}
+	image.ContentType = stored.ContentType
+	image.Stored = &stored
+	return image, nil
+}
+
+// imageGenStatus is 502 for a provider that failed, unless the request
+// was canceled or timed out.
+func imageGenStatus(err error) int {
+	if status := errorStatus(err); status != http.StatusInternalServerError {
+		return status
+	}
+	return http.StatusBadGateway
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/Dsouza10082/orus"
+)
+
+// UploadImage godoc
+// @Summary      Uploads images for vision chats
+// @Description  Validates the images of a multipart form (field image, repeatable), scales them down to ORUS_API_IMAGES_MAX_DIMENSION and re-encodes them, then keeps them for ORUS_API_IMAGES_TTL. The returned handles can be sent in the images of a chat request instead of base64
+// @Tags         llm
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        image  formData  file  true  "Image (PNG, JPEG, GIF or WebP)"
+// @Success      200  {object}  OrusResponse
+// @Failure      400  {object}  OrusResponse
+// @Failure      503  {object}  OrusResponse
+// @Router       /orus-api/v1/upload-image [post]
+func (s *OrusAPI) UploadImage(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	if s.Images == nil {
+		respondError(w, http.StatusServiceUnavailable, "images_disabled", "Image uploads are disabled")
+		return
+	}
+	if err := r.ParseMultipartForm(orus.MaxBodySize); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_upload", fmt.Sprintf("The body must be a multipart form: %v", err))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	files := r.MultipartForm.File["image"]
+	if len(files) == 0 {
+		respondError(w, http.StatusBadRequest, "missing_image", "Field 'image' is required")
+		return
+	}
+	if len(files) > orus.MaxImages {
+		respondError(w, http.StatusBadRequest, "too_many_images", fmt.Sprintf("At most %d images can be uploaded", orus.MaxImages))
+		return
+	}
+
+	images := make([]orus.StoredImage, 0, len(files))
+	for i, header := range files {
+		file, err := header.Open()
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid_upload", fmt.Sprintf("Image %d cannot be read: %v", i+1, err))
+			return
+		}
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid_upload", fmt.Sprintf("Image %d cannot be read: %v", i+1, err))
+			return
+		}
+		image, verr := s.Images.Put(data)
+		if verr != nil {
+			status := http.StatusBadRequest
+			if verr.Code == "image_store_error" {
+				status = http.StatusInternalServerError
+			}
+			respondError(w, status, verr.Code, fmt.Sprintf("Image %d: %s", i+1, verr.Message))
+			return
+		}
+		images = append(images, image)
+	}
+
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{"images": images}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Images uploaded successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// resolveImages replaces the handles of uploaded images in the images of
+// body with the images, scaled down to the resolution of the model. It
+// answers 400 and returns false when one is unknown or expired.
+func (s *OrusAPI) resolveImages(w http.ResponseWriter, body *LLMCloudRequestBody) bool {
+	images, err := s.Images.Resolve(body.Images)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "unknown_image", err.Error())
+		return false
+	}
+	images, verr := s.fitImages(body.Model, images)
+	if verr != nil {
+		respondError(w, http.StatusBadRequest, verr.Code, verr.Message)
+		return false
+	}
+	body.Images = images
+	return true
+}
+
+// fitImages scales images down to the resolution model takes.
+func (s *OrusAPI) fitImages(model string, images []string) ([]string, *orus.ValidationError) {
+	if len(images) == 0 {
+		return images, nil
+	}
+	return orus.FitImages(images, s.CurrentConfig().Images.MaxDimensionFor(s.Backend.ResolveModel(model)))
+}
+
+// checkVision answers 400 and returns false when images are sent to a
+// local model Ollama reports without the vision capability, which it would
+// otherwise reject with an opaque error. A model whose capabilities cannot
+// be read is let through.
+func (s *OrusAPI) checkVision(w http.ResponseWriter, r *http.Request, model string, images []string) bool {
+	if len(images) == 0 {
+		return true
+	}
+	capabilities, err := s.Backend.WithContext(r.Context()).Capabilities(model)
+	if err != nil || len(capabilities) == 0 || slices.Contains(capabilities, "vision") {
+		return true
+	}
+	respondError(w, http.StatusBadRequest, "model_not_vision",
+		fmt.Sprintf("Model %s does not accept images, use a vision model such as llama3.2-vision", model))
+	return false
+}
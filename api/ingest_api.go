@@ -0,0 +1,305 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Dsouza10082/orus"
+)
+
+// IngestDocument godoc
+// @Summary      Ingests a document into the RAG index
+// @Description  Reads the text of an uploaded file (field file) and indexes it as the source, replacing its previous chunks. Text files are taken as they are; images and the PDF pages without a text layer are read by OCR with ORUS_API_OCR_ENGINE. With images the figures of a PDF, or the image itself, are kept and linked to the chunks of their page, and indexed on their own when they can be embedded: with clip, or by their caption with ORUS_API_RAG_CAPTION_MODEL
+// @Tags         rag
+// @Accept       multipart/form-data
+// @Produce      json,text/event-stream
+// @Param        file           formData  file    true   "Text, PDF or image (PNG, JPEG, GIF or WebP)"
+// @Param        source         formData  string  false  "Source name, defaults to the file name"
+// @Param        embed_model    formData  string  false  "Embedding model, defaults to bge-m3"
+// @Param        chunk_size     formData  int     false  "Chunk size in characters"
+// @Param        chunk_overlap  formData  int     false  "Overlap between chunks in characters"
+// @Param        images         formData  bool    false  "Keep the images of the document, defaults to true"
+// @Param        stream         formData  bool    false  "Stream the progress as events, then the result in the done event"
+// @Success      200  {object}  OrusResponse
+// @Failure      400  {object}  OrusResponse
+// @Failure      422  {object}  OrusResponse
+// @Failure      500  {object}  OrusResponse
+// @Router       /orus-api/v1/documents [post]
+func (s *OrusAPI) IngestDocument(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	if err := r.ParseMultipartForm(orus.MaxBodySize); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_upload", fmt.Sprintf("The body must be a multipart form: %v", err))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "missing_file", "Field 'file' is required")
+		return
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_upload", fmt.Sprintf("The file cannot be read: %v", err))
+		return
+	}
+
+	source := strings.TrimSpace(r.FormValue("source"))
+	if source == "" {
+		source = header.Filename
+	}
+	model := r.FormValue("embed_model")
+	if model == "" {
+		model = orus.DefaultRAGEmbedModel
+	}
+	size, overlap := orus.DefaultChunkSize, orus.DefaultChunkOverlap
+	for _, field := range []struct {
+		name  string
+		value *int
+	}{{"chunk_size", &size}, {"chunk_overlap", &overlap}} {
+		if raw := r.FormValue(field.name); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 0 {
+				respondError(w, http.StatusBadRequest, "invalid_"+field.name, fmt.Sprintf("Field '%s' must be a non-negative number", field.name))
+				return
+			}
+			*field.value = n
+		}
+	}
+
+	withImages := true
+	if raw := r.FormValue("images"); raw != "" {
+		if withImages, err = strconv.ParseBool(raw); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid_images", "Field 'images' must be a boolean")
+			return
+		}
+	}
+	ingest, ok := startIngestStream(w, r)
+	if !ok {
+		return
+	}
+
+	config := s.CurrentConfig()
+	ingest.progress(orus.IngestProgress{Stage: "extracting"})
+	extraction, err := s.ExtractText(r.Context(), config.OCR, data, withImages)
+	switch {
+	case errors.Is(err, orus.ErrUnsupportedDocument):
+		ingest.fail(http.StatusBadRequest, "unsupported_document", err.Error())
+		return
+	case errors.Is(err, orus.ErrOCRDisabled):
+		ingest.fail(http.StatusUnprocessableEntity, "ocr_disabled", err.Error())
+		return
+	case err != nil:
+		ingest.fail(errorStatus(err), "extraction_error", fmt.Sprintf("Error reading the document: %v", err))
+		return
+	}
+	if strings.TrimSpace(extraction.Text) == "" && len(extraction.Images) == 0 {
+		ingest.fail(http.StatusUnprocessableEntity, "empty_document", "No text was found in the document")
+		return
+	}
+
+	documents, err := s.Documents.IndexExtraction(r.Context(), source, extraction, model, config.RAG.CaptionModel, size, overlap, ingest.progress)
+	if err != nil {
+		ingest.fail(errorStatus(err), "indexing_error", fmt.Sprintf("Error indexing the document: %v", err))
+		return
+	}
+	if len(documents) == 0 {
+		ingest.fail(http.StatusUnprocessableEntity, "empty_document",
+			"No text was found in the document and its images cannot be embedded without ORUS_API_RAG_CAPTION_MODEL")
+		return
+	}
+	if s.Uploads != nil {
+		// the document is indexed already, so a failure only loses the file
+		if err := s.Uploads.Put(orus.UploadKey(source), data, http.DetectContentType(data)); err != nil {
+			log.Printf("Error keeping the upload of %s: %v", source, err)
+		}
+	}
+	chunks, records := 0, 0
+	for _, document := range documents {
+		if orus.IsImageRecord(document) {
+			records++
+		} else {
+			chunks++
+		}
+	}
+
+	ingest.done(map[string]interface{}{
+		"source":        source,
+		"model":         model,
+		"chunks":        chunks,
+		"images":        len(extraction.Images),
+		"image_records": records,
+		"extraction":    extraction,
+	}, "Document ingested successfully", startTime)
+}
+
+// ingestStream answers an ingestion as JSON, or with the stream field as
+// an event stream: the progress of its stages, then a done event with the
+// data of the JSON answer, or an error event.
+type ingestStream struct {
+	w      http.ResponseWriter
+	events *EventStream
+}
+
+// startIngestStream starts the event stream of an ingestion asking for one.
+// It answers 400 and returns false for an invalid stream field.
+func startIngestStream(w http.ResponseWriter, r *http.Request) (*ingestStream, bool) {
+	ingest := &ingestStream{w: w}
+	raw := r.FormValue("stream")
+	if raw == "" {
+		return ingest, true
+	}
+	stream, err := strconv.ParseBool(raw)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_stream", "Field 'stream' must be a boolean")
+		return nil, false
+	}
+	if stream {
+		if ingest.events, stream = NewEventStream(w); !stream {
+			return nil, false
+		}
+	}
+	return ingest, true
+}
+
+func (i *ingestStream) progress(progress orus.IngestProgress) {
+	if i.events != nil {
+		_ = i.events.IngestProgress(progress)
+	}
+}
+
+func (i *ingestStream) fail(status int, code, message string) {
+	if i.events != nil {
+		_ = i.events.Error(code, errors.New(message))
+		return
+	}
+	respondError(i.w, status, code, message)
+}
+
+func (i *ingestStream) done(data map[string]interface{}, message string, startTime time.Time) {
+	if i.events != nil {
+		_ = i.events.Done(DonePayload{Message: message, Ingest: data, TimeTaken: time.Since(startTime).String()})
+		return
+	}
+	response := NewOrusResponse()
+	response.Data = data
+	response.TimeTaken = time.Since(startTime)
+	response.Message = message
+	respondJSON(i.w, http.StatusOK, response)
+}
+
+// GetDocumentFile godoc
+// @Summary      Downloads an ingested file
+// @Description  Returns the file last uploaded for a source, kept with ORUS_API_BLOB_KEEP_UPLOADS
+// @Tags         rag
+// @Produce      octet-stream
+// @Param        source  query  string  true  "Source name"
+// @Success      200  {file}  file
+// @Failure      400  {object}  OrusResponse
+// @Failure      404  {object}  OrusResponse
+// @Failure      500  {object}  OrusResponse
+// @Router       /orus-api/v1/documents/file [get]
+func (s *OrusAPI) GetDocumentFile(w http.ResponseWriter, r *http.Request) {
+	source := r.URL.Query().Get("source")
+	if source == "" {
+		respondError(w, http.StatusBadRequest, "missing_source", "Query parameter 'source' is required")
+		return
+	}
+	if s.Uploads == nil {
+		respondError(w, http.StatusNotFound, "uploads_not_kept", "Uploaded files are not kept, check ORUS_API_BLOB_KEEP_UPLOADS")
+		return
+	}
+	data, err := s.Uploads.Get(orus.UploadKey(source))
+	if errors.Is(err, orus.ErrBlobNotFound) {
+		respondError(w, http.StatusNotFound, "file_not_found", "No file was kept for this source")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "file_unavailable", err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", http.DetectContentType(data))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(source)}))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// DocumentMatch is a chunk of an ingested document found by a search.
+type DocumentMatch struct {
+	Source string `json:"source" swaggertype:"string" example:"contract.pdf"`
+	Chunk  int    `json:"chunk" swaggertype:"integer" example:"7"`
+	// Citation locates the chunk in its document, such as "page 12,
+	// section 3.2 Fees", when it was chunked along its layout.
+	Citation   string  `json:"citation,omitempty" swaggertype:"string" example:"page 12, section 3.2 Fees"`
+	Content    string  `json:"content" swaggertype:"string" example:"The fees are due within 30 days of the invoice."`
+	Similarity float64 `json:"similarity" swaggertype:"number" example:"0.82"`
+}
+
+// DocumentSearchRequest is the body of a search among the ingested
+// documents.
+type DocumentSearchRequest struct {
+	Query      string `json:"query" swaggertype:"string" example:"when are the fees due"`
+	EmbedModel string `json:"embed_model" swaggertype:"string" example:"bge-m3"`
+	Limit      int    `json:"limit" swaggertype:"integer" example:"5"`
+}
+
+func (r *DocumentSearchRequest) Validate() *orus.ValidationError {
+	if strings.TrimSpace(r.Query) == "" {
+		return &orus.ValidationError{Code: "missing_query", Field: "query", Message: "Field 'query' is required"}
+	}
+	if r.EmbedModel == "" {
+		r.EmbedModel = orus.DefaultRAGEmbedModel
+	}
+	if r.Limit < 0 {
+		return &orus.ValidationError{Code: "invalid_limit", Field: "limit", Message: "Field 'limit' must not be negative"}
+	}
+	return nil
+}
+
+// SearchDocuments godoc
+// @Summary      Searches the ingested documents
+// @Description  Returns the chunks closest to the query among the documents ingested with the same embedding model, with their source and citation
+// @Tags         rag
+// @Accept       json
+// @Produce      json
+// @Param        request  body  DocumentSearchRequest  true  "Query"
+// @Success      200  {object}  OrusResponse
+// @Failure      400  {object}  OrusResponse
+// @Failure      500  {object}  OrusResponse
+// @Router       /orus-api/v1/documents/search [post]
+func (s *OrusAPI) SearchDocuments(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	request, ok := decodeJSON[DocumentSearchRequest](w, r)
+	if !ok {
+		return
+	}
+	results, err := s.Documents.Retrieve(request.Query, request.EmbedModel, request.Limit)
+	if err != nil {
+		respondError(w, errorStatus(err), "embedding_error", fmt.Sprintf("Error embedding the query: %v", err))
+		return
+	}
+	matches := make([]DocumentMatch, len(results))
+	for i, result := range results {
+		matches[i] = DocumentMatch{
+			Chunk:      orus.ChunkNumber(result.Document),
+			Citation:   orus.Citation(result.Document),
+			Content:    result.Document.Content,
+			Similarity: result.Similarity,
+		}
+		matches[i].Source, _ = result.Document.Metadata["source"].(string)
+	}
+
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{"results": matches}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Search completed successfully"
+	respondJSON(w, http.StatusOK, response)
+}
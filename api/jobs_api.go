@@ -0,0 +1,43 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Dsouza10082/orus"
+	"github.com/go-chi/chi/v5"
+)
+
+// GetJob godoc
+// @Summary      Gets the state of a job
+// @Description  Returns the state of a job run for a callback URL: the payload posted to the callback once it finished, or the job.running event while it runs
+// @Tags         jobs
+// @Produce      json
+// @Param        id   path      string  true  "Job ID"
+// @Success      200  {object}  OrusResponse
+// @Failure      400  {object}  OrusResponse
+// @Failure      404  {object}  OrusResponse
+// @Failure      500  {object}  OrusResponse
+// @Router       /orus-api/v1/jobs/{id} [get]
+func (s *OrusAPI) GetJob(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	if s.Webhooks == nil {
+		respondError(w, http.StatusBadRequest, "webhooks_disabled", "Webhooks are disabled, check ORUS_API_WEBHOOK_SECRET")
+		return
+	}
+	job, err := s.Webhooks.Job(chi.URLParam(r, "id"))
+	if errors.Is(err, orus.ErrJobNotFound) {
+		respondError(w, http.StatusNotFound, "job_not_found", "job not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "job_unavailable", err.Error())
+		return
+	}
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{"job": job}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Job retrieved successfully"
+	respondJSON(w, http.StatusOK, response)
+}
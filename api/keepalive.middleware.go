@@ -0,0 +1,142 @@
+package api
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// keepaliveComment is written on an idle event stream. Lines starting with a
+// colon are comments, which EventSource and the SSE parsers ignore.
+var keepaliveComment = []byte(": keepalive\n\n")
+
+// SSEKeepalive writes a comment on the event streams of the routes it wraps
+// once they have been idle for interval, so proxies and load balancers that
+// drop idle connections keep them open while a model is loading or thinking.
+// Other responses are passed through untouched; 0 disables it.
+func SSEKeepalive(interval time.Duration) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if interval <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			kw := &keepaliveWriter{ResponseWriter: w, interval: interval, done: make(chan struct{})}
+			defer kw.stop()
+			next.ServeHTTP(kw, r)
+		})
+	}
+}
+
+// keepaliveWriter starts writing comments once the response turns out to be
+// an event stream. It only writes them right after a flush, so they never
+// land in the middle of an event.
+type keepaliveWriter struct {
+	http.ResponseWriter
+	interval time.Duration
+	done     chan struct{}
+
+	mu      sync.Mutex
+	checked bool
+	stopped bool
+	flushed bool
+	last    time.Time
+}
+
+func (w *keepaliveWriter) WriteHeader(status int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.check(status)
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *keepaliveWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.check(http.StatusOK)
+	w.flushed = false
+	w.last = time.Now()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *keepaliveWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.check(http.StatusOK)
+	w.flush()
+}
+
+func (w *keepaliveWriter) flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	w.flushed = true
+	w.last = time.Now()
+}
+
+func (w *keepaliveWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the writer of the connection, to
+// set its deadlines.
+func (w *keepaliveWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// check starts the keepalive on the first write of a successful event
+// stream. It must be called with mu held.
+func (w *keepaliveWriter) check(status int) {
+	if w.checked {
+		return
+	}
+	w.checked = true
+	if status != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		return
+	}
+	w.last = time.Now()
+	go w.keepalive()
+}
+
+func (w *keepaliveWriter) keepalive() {
+	timer := time.NewTimer(w.interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-timer.C:
+		}
+		w.mu.Lock()
+		if w.stopped {
+			w.mu.Unlock()
+			return
+		}
+		wait := w.interval - time.Since(w.last)
+		if wait <= 0 && w.flushed {
+			if _, err := w.ResponseWriter.Write(keepaliveComment); err != nil {
+				// the client is gone, the handler will notice on its next write
+				w.mu.Unlock()
+				return
+			}
+			w.flush()
+			wait = w.interval
+		} else if wait <= 0 {
+			// an event is being written; look again once it is flushed
+			wait = w.interval
+		}
+		w.mu.Unlock()
+		timer.Reset(wait)
+	}
+}
+
+// stop ends the keepalive before the handler returns, since the response
+// cannot be written after that.
+func (w *keepaliveWriter) stop() {
+	w.mu.Lock()
+	w.stopped = true
+	w.mu.Unlock()
+	close(w.done)
+}
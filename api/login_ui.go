@@ -0,0 +1,76 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Dsouza10082/orus"
+	"github.com/Dsouza10082/orus/view"
+)
+
+const playgroundLoginPath = "/login"
+
+// playgroundKeyMaxAge is how long a browser stays signed in.
+const playgroundKeyMaxAge = 12 * 60 * 60
+
+// LoginHandler is a handler for the sign in page of the playground
+func (s *OrusAPI) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	s.renderLogin(w, http.StatusOK, r.URL.Query().Get("next"), "")
+}
+
+// Login checks the API key of the sign in form and keeps it in the
+// orus_api_key cookie, which the event streams of the playground are
+// authenticated with, then returns to the page the browser came from.
+// Without auth there is nothing to sign in to.
+func (s *OrusAPI) Login(w http.ResponseWriter, r *http.Request) {
+	next := loginNext(r.PostFormValue("next"))
+	if s.authKeys == nil {
+		http.Redirect(w, r, next, http.StatusSeeOther)
+		return
+	}
+	key := r.PostFormValue("api_key")
+	if key == "" {
+		s.renderLogin(w, http.StatusUnauthorized, next, "Enter an API key")
+		return
+	}
+	switch err := checkAPIKey(s.authKeys, s.APIKeys, key); {
+	case errors.Is(err, orus.ErrAPIKeyNotFound):
+		s.renderLogin(w, http.StatusUnauthorized, next, "Invalid API key")
+		return
+	case err != nil:
+		s.renderLogin(w, http.StatusServiceUnavailable, next, "The API keys cannot be checked, try again later")
+		return
+	}
+	// Strict keeps other sites from posting to the streams with the key
+	http.SetCookie(w, &http.Cookie{
+		Name:     playgroundKeyCookie,
+		Value:    key,
+		Path:     "/",
+		MaxAge:   playgroundKeyMaxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+func (s *OrusAPI) renderLogin(w http.ResponseWriter, status int, next, message string) {
+	if status != http.StatusOK {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+	}
+	if err := view.NewView().RenderLogin(w, loginNext(next), message); err != nil {
+		log.Printf("LoginHandler: failed to render login: %v", err)
+		http.Error(w, "failed to render page", http.StatusInternalServerError)
+	}
+}
+
+// loginNext returns next when it is a page of the playground, so the sign
+// in never redirects elsewhere, and the prompt page otherwise.
+func loginNext(next string) string {
+	if next != playgroundLoginPath && publicPages[next] {
+		return next
+	}
+	return "/prompt"
+}
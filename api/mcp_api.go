@@ -0,0 +1,112 @@
+package api
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+const (
+	mcpPath        = "/orus-api/v1/mcp"
+	mcpSSEPath     = mcpPath + "/sse"
+	mcpMessagePath = mcpPath + "/message"
+
+	// EventMCPEndpoint tells an MCP SSE client where to POST its messages,
+	// and EventMCPMessage carries the answers.
+	EventMCPEndpoint StreamEvent = "endpoint"
+	EventMCPMessage  StreamEvent = "message"
+
+	// mcpSessionBuffer is how many answers wait for a slow SSE client
+	// before the POSTs of its session block.
+	mcpSessionBuffer = 16
+)
+
+// MCPStream godoc
+// @Summary      Opens an MCP session over SSE
+// @Description  Opens a Model Context Protocol session with the HTTP+SSE transport. The first event, endpoint, is the URL to POST the JSON-RPC messages of the session to; the answers come back as message events
+// @Tags         mcp
+// @Produce      text/event-stream
+// @Success      200  {string}  string  "event stream"
+// @Router       /orus-api/v1/mcp/sse [get]
+func (s *OrusAPI) MCPStream(w http.ResponseWriter, r *http.Request) {
+	events, ok := NewEventStream(w)
+	if !ok {
+		return
+	}
+	id := uuid.New().String()
+	messages := make(chan []byte, mcpSessionBuffer)
+	s.MCP.OpenSession(id, messages)
+	defer s.MCP.CloseSession(id)
+
+	if err := events.Raw(EventMCPEndpoint, []byte(mcpMessagePath+"?session_id="+id)); err != nil {
+		return
+	}
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case message := <-messages:
+			if err := events.Raw(EventMCPMessage, message); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// MCPMessage godoc
+// @Summary      Sends a message to an MCP SSE session
+// @Description  Handles a JSON-RPC message of the MCP session opened on /orus-api/v1/mcp/sse; the answer is sent on that stream
+// @Tags         mcp
+// @Accept       json
+// @Param        session_id  query  string  true  "Session of the SSE stream"
+// @Success      202
+// @Failure      400  {object}  OrusResponse
+// @Failure      404  {object}  OrusResponse
+// @Router       /orus-api/v1/mcp/message [post]
+func (s *OrusAPI) MCPMessage(w http.ResponseWriter, r *http.Request) {
+	messages, ok := s.MCP.Session(r.URL.Query().Get("session_id"))
+	if !ok {
+		respondError(w, http.StatusNotFound, "unknown_session", "The MCP session is closed or does not exist")
+		return
+	}
+	message, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if answer := s.MCP.Handle(r.Context(), message); answer != nil {
+		select {
+		case messages <- answer:
+		case <-r.Context().Done():
+			return
+		}
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// MCPRequest godoc
+// @Summary      Handles an MCP message over HTTP
+// @Description  Handles a JSON-RPC message of the Model Context Protocol (streamable HTTP transport) and answers it in the response body. Notifications are answered 202 without a body
+// @Tags         mcp
+// @Accept       json
+// @Produce      json
+// @Success      200
+// @Success      202
+// @Failure      400  {object}  OrusResponse
+// @Router       /orus-api/v1/mcp [post]
+func (s *OrusAPI) MCPRequest(w http.ResponseWriter, r *http.Request) {
+	message, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	answer := s.MCP.Handle(r.Context(), message)
+	if answer == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(answer)
+}
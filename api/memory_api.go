@@ -0,0 +1,125 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ListMemories godoc
+// @Summary      Returns the long-term memories of an agent/user pair
+// @Description  Returns the long-term memories of an agent/user pair
+// @Tags         memory
+// @Produce      json
+// @Param        agent_id  query     string  false  "Agent ID"
+// @Param        user_id   query     string  false  "User ID"
+// @Success      200  {object}  OrusResponse
+// @Failure      400  {object}  OrusResponse
+// @Router       /orus-api/v1/memory [get]
+func (s *OrusAPI) ListMemories(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	agentID := r.URL.Query().Get("agent_id")
+	userID := r.URL.Query().Get("user_id")
+	if agentID == "" && userID == "" {
+		respondError(w, http.StatusBadRequest, "missing_scope", "Query parameter 'agent_id' or 'user_id' is required")
+		return
+	}
+	memories := s.Memory.List(agentID, userID)
+	for i := range memories {
+		memories[i].Embedding = nil
+	}
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{
+		"memories": memories,
+	}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Memories retrieved successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// AddMemories godoc
+// @Summary      Stores facts in the long-term memory of an agent/user pair
+// @Description  Stores facts in the long-term memory of an agent/user pair, skipping near-duplicates
+// @Tags         memory
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  OrusResponse
+// @Failure      400  {object}  OrusResponse
+// @Failure      500  {object}  OrusResponse
+// @Router       /orus-api/v1/memory [post]
+func (s *OrusAPI) AddMemories(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	type Req struct {
+		AgentID string   `json:"agent_id"`
+		UserID  string   `json:"user_id"`
+		Facts   []string `json:"facts"`
+	}
+
+	request, ok := decodeJSON[Req](w, r)
+	if !ok {
+		return
+	}
+	if request.AgentID == "" && request.UserID == "" {
+		respondError(w, http.StatusBadRequest, "missing_scope", "Field 'agent_id' or 'user_id' is required")
+		return
+	}
+	if len(request.Facts) == 0 {
+		respondError(w, http.StatusBadRequest, "missing_facts", "Field 'facts' is required")
+		return
+	}
+
+	stored, err := s.Memory.Remember(request.AgentID, request.UserID, request.Facts...)
+	if err != nil {
+		response := NewOrusResponse()
+		response.Error = err.Error()
+		response.Message = "Error storing memories"
+		response.Success = false
+		response.TimeTaken = time.Since(startTime)
+		respondJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	for i := range stored {
+		stored[i].Embedding = nil
+	}
+
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{
+		"memories": stored,
+	}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Memories stored successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// DeleteMemory godoc
+// @Summary      Removes a long-term memory
+// @Description  Removes a long-term memory
+// @Tags         memory
+// @Produce      json
+// @Param        id        path      string  true   "Memory ID"
+// @Param        agent_id  query     string  false  "Agent ID"
+// @Param        user_id   query     string  false  "User ID"
+// @Success      200  {object}  OrusResponse
+// @Failure      400  {object}  OrusResponse
+// @Failure      404  {object}  OrusResponse
+// @Router       /orus-api/v1/memory/{id} [delete]
+func (s *OrusAPI) DeleteMemory(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	agentID := r.URL.Query().Get("agent_id")
+	userID := r.URL.Query().Get("user_id")
+	if agentID == "" && userID == "" {
+		respondError(w, http.StatusBadRequest, "missing_scope", "Query parameter 'agent_id' or 'user_id' is required")
+		return
+	}
+	// a memory of another agent/user pair is not found
+	if s.Memory.Forget(agentID, userID, chi.URLParam(r, "id")) == 0 {
+		respondError(w, http.StatusNotFound, "memory_not_found", "memory not found")
+		return
+	}
+	response := NewOrusResponse()
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Memory deleted successfully"
+	respondJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Dsouza10082/orus/orustest"
+)
+
+func TestDeleteMemoryIsScoped(t *testing.T) {
+	handler := testAPI(t, orustest.NewBackend())
+	w := post(t, handler, "/orus-api/v1/memory", `{"agent_id":"a1","user_id":"u1","facts":["likes green tea"]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("storing answered %d: %s", w.Code, w.Body)
+	}
+	var stored struct {
+		Data struct {
+			Memories []struct {
+				ID string `json:"id"`
+			} `json:"memories"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &stored); err != nil {
+		t.Fatal(err)
+	}
+	if len(stored.Data.Memories) != 1 {
+		t.Fatalf("stored %d memories, want 1", len(stored.Data.Memories))
+	}
+	id := stored.Data.Memories[0].ID
+
+	remove := func(query string) int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/orus-api/v1/memory/"+id+query, nil))
+		return w.Code
+	}
+	if code := remove(""); code != http.StatusBadRequest {
+		t.Fatalf("deleting without a scope answered %d, want 400", code)
+	}
+	if code := remove("?agent_id=a1&user_id=u2"); code != http.StatusNotFound {
+		t.Fatalf("deleting the memory of another user answered %d, want 404", code)
+	}
+	if code := remove("?agent_id=a1&user_id=u1"); code != http.StatusOK {
+		t.Fatalf("deleting the memory answered %d, want 200", code)
+	}
+	if code := remove("?agent_id=a1&user_id=u1"); code != http.StatusNotFound {
+		t.Fatalf("deleting the memory again answered %d, want 404", code)
+	}
+}
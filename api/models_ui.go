@@ -0,0 +1,158 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Dsouza10082/orus/ollama"
+	"github.com/Dsouza10082/orus/view"
+	"github.com/starfederation/datastar-go/datastar"
+)
+
+const pullProgressInterval = 200 * time.Millisecond
+
+// ModelsHandler is a handler for the models page
+// It lists the models installed on the Ollama host
+func (s *OrusAPI) ModelsHandler(w http.ResponseWriter, r *http.Request) {
+	models, err := s.installedModels()
+	if err != nil {
+		log.Printf("ModelsHandler: failed to list models: %v", err)
+		http.Error(w, "failed to list models", http.StatusInternalServerError)
+		return
+	}
+	if err := view.NewView().RenderModels(w, models); err != nil {
+		log.Printf("ModelsHandler: failed to render models: %v", err)
+		http.Error(w, "failed to render page", http.StatusInternalServerError)
+	}
+}
+
+// ModelsPullStream is a handler for the models/pull endpoint
+// It pulls the requested model and streams the progress of every layer
+func (s *OrusAPI) ModelsPullStream(w http.ResponseWriter, r *http.Request) {
+	signals := &view.ModelsSignals{}
+	if err := datastar.ReadSignals(r, signals); err != nil {
+		log.Printf("ModelsPullStream: failed to read signals: %v", err)
+		http.Error(w, "failed to read signals", http.StatusBadRequest)
+		return
+	}
+
+	sse := datastar.NewSSE(w, r)
+
+	model := strings.TrimSpace(signals.PullModel)
+	if model == "" {
+		return
+	}
+
+	progress := view.PullProgress{
+		Model:  model,
+		Status: "starting",
+		Layers: make([]view.PullLayer, 0),
+	}
+	layers := make(map[string]int)
+	lastPatch := time.Time{}
+	err := s.Backend.PullModel(model, func(update ollama.PullModelProgress) {
+		if sse.IsClosed() {
+			return
+		}
+		statusChanged := update.Status != progress.Status
+		progress.Status = update.Status
+		if update.Digest != "" {
+			i, ok := layers[update.Digest]
+			if !ok {
+				i = len(progress.Layers)
+				layers[update.Digest] = i
+				progress.Layers = append(progress.Layers, view.PullLayer{Digest: update.Digest})
+			}
+			progress.Layers[i].Total = update.Total
+			progress.Layers[i].Completed = update.Completed
+		}
+		if !statusChanged && time.Since(lastPatch) < pullProgressInterval {
+			return
+		}
+		lastPatch = time.Now()
+		if err := patchPullProgress(sse, progress); err != nil {
+			_ = sse.ConsoleError(err)
+		}
+	})
+	if err != nil {
+		progress.Status = "error: " + err.Error()
+		_ = patchPullProgress(sse, progress)
+		return
+	}
+
+	progress.Done = true
+	for i := range progress.Layers {
+		progress.Layers[i].Completed = progress.Layers[i].Total
+	}
+	if err := patchPullProgress(sse, progress); err != nil {
+		_ = sse.ConsoleError(err)
+	}
+	s.patchModelList(sse)
+}
+
+// ModelsDeleteStream is a handler for the models/delete endpoint
+// It removes the selected model from the Ollama host and refreshes the list
+func (s *OrusAPI) ModelsDeleteStream(w http.ResponseWriter, r *http.Request) {
+	signals := &view.ModelsSignals{}
+	if err := datastar.ReadSignals(r, signals); err != nil {
+		log.Printf("ModelsDeleteStream: failed to read signals: %v", err)
+		http.Error(w, "failed to read signals", http.StatusBadRequest)
+		return
+	}
+
+	sse := datastar.NewSSE(w, r)
+
+	if signals.DeleteModel == "" {
+		return
+	}
+	if err := s.Backend.DeleteModel(signals.DeleteModel); err != nil {
+		_ = sse.ConsoleError(fmt.Errorf("delete error: %w", err))
+		return
+	}
+	s.patchModelList(sse)
+}
+
+func (s *OrusAPI) installedModels() ([]view.InstalledModel, error) {
+	details, err := s.Backend.ListModelDetails()
+	if err != nil {
+		return nil, err
+	}
+	models := make([]view.InstalledModel, 0, len(details))
+	for _, model := range details {
+		models = append(models, view.InstalledModel{
+			Name:              model.Name,
+			Size:              model.Size,
+			Digest:            model.Digest,
+			ModifiedAt:        model.ModifiedAt,
+			Family:            model.Details.Family,
+			ParameterSize:     model.Details.ParameterSize,
+			QuantizationLevel: model.Details.QuantizationLevel,
+		})
+	}
+	return models, nil
+}
+
+func (s *OrusAPI) patchModelList(sse *datastar.ServerSentEventGenerator) {
+	models, err := s.installedModels()
+	if err != nil {
+		_ = sse.ConsoleError(fmt.Errorf("failed to list models: %w", err))
+		return
+	}
+	html, err := view.RenderModelList(models)
+	if err != nil {
+		_ = sse.ConsoleError(err)
+		return
+	}
+	_ = sse.PatchElements(html)
+}
+
+func patchPullProgress(sse *datastar.ServerSentEventGenerator, progress view.PullProgress) error {
+	html, err := view.RenderPullProgress(progress)
+	if err != nil {
+		return err
+	}
+	return sse.PatchElements(html)
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/Dsouza10082/orus/ollama"
+)
+
+// Option customizes the server built by NewOrusAPI.
+type Option func(*options)
+
+type options struct {
+	port        string
+	listener    net.Listener
+	middlewares []func(next http.Handler) http.Handler
+	logger      *slog.Logger
+	auth        func(next http.Handler) http.Handler
+	basePath    string
+	backend     ollama.Backend
+}
+
+// WithPort serves on port instead of ORUS_API_PORT.
+func WithPort(port string) Option {
+	return func(o *options) {
+		o.port = port
+	}
+}
+
+// WithListener serves on listener, such as a Unix socket or a listener of
+// a test, instead of opening the port.
+func WithListener(listener net.Listener) Option {
+	return func(o *options) {
+		o.listener = listener
+	}
+}
+
+// WithMiddleware adds middlewares around every route. They run after the
+// built-in ones, in order, so they see the request ID and the
+// authenticated requests.
+func WithMiddleware(middlewares ...func(next http.Handler) http.Handler) Option {
+	return func(o *options) {
+		o.middlewares = append(o.middlewares, middlewares...)
+	}
+}
+
+// WithLogger writes the request logs and the errors of the HTTP server to
+// logger instead of the default logger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithAuth authenticates the requests with auth instead of the API keys of
+// the configuration. It applies even when ORUS_API_REQUIRE_AUTH is off.
+func WithAuth(auth func(next http.Handler) http.Handler) Option {
+	return func(o *options) {
+		o.auth = auth
+	}
+}
+
+// WithBasePath serves the routes under path, such as "/ai", so /ai/orus-api/v1/call-llm
+// reaches /orus-api/v1/call-llm. The playground pages link to the routes
+// at the root, so they only work without a base path.
+func WithBasePath(path string) Option {
+	return func(o *options) {
+		o.basePath = strings.TrimSuffix(path, "/")
+	}
+}
+
+// WithBackend answers the chats and the Ollama embeddings with backend
+// instead of the Ollama server of the configuration, such as the
+// orustest backend in tests.
+func WithBackend(backend ollama.Backend) Option {
+	return func(o *options) {
+		o.backend = backend
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package api
 
 import (
 	"encoding/json"
@@ -6,16 +6,40 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/Dsouza10082/orus"
+	"github.com/Dsouza10082/orus/ollama"
 	"github.com/google/uuid"
 )
 
 type LLMCloudRequestBody struct {
 	Model    string    `json:"model"`
 	Think    bool      `json:"think"`
-	Messages []Message `json:"messages"`
+	Messages []ollama.Message `json:"messages"`
 	Stream   bool      `json:"stream"`
-	Format   string    `json:"format,omitempty"`
+	Format   ollama.ResponseFormat `json:"format,omitempty"`
 	Images   []string  `json:"images,omitempty"`
+	// Options are passed to the model, e.g. temperature and seed.
+	Options  map[string]interface{} `json:"options,omitempty"`
+	// Passthrough streams the Ollama chunks as they come, when the reply
+	// needs no format check nor output screening.
+	Passthrough bool `json:"passthrough,omitempty"`
+	// AutoTools runs the tools the model calls on the server, feeding the
+	// results back until it answers. Tools picks the registered tools
+	// offered to the model; empty offers them all.
+	AutoTools bool     `json:"auto_tools,omitempty"`
+	Tools     []string `json:"tools,omitempty"`
+	// RespondAs is a Go type or JSON schema the reply must match; the
+	// decoded reply is returned as result. RepairRetries overrides how many
+	// times a mismatching reply is sent back with the validation errors.
+	RespondAs     RespondAs `json:"respond_as,omitempty" swaggertype:"object"`
+	RepairRetries *int      `json:"repair_retries,omitempty"`
+	// MaxCost rejects a /call-llm-cloud request whose estimated cost, in the
+	// currency of ORUS_API_CLOUD_PRICES, is above it.
+	MaxCost *float64 `json:"max_cost,omitempty"`
+	// Transforms post-process the answer, in order, as it is streamed:
+	// sanitize_markdown, extract_code, mask_profanity and
+	// trim_trailing_whitespace.
+	Transforms []string `json:"transforms,omitempty"`
 }
 
 type LLMCloudRequest struct {
@@ -49,15 +73,17 @@ type OrusRequest struct {
 	Body    map[string]interface{} `json:"body" swaggertype:"interface{}" example:"{"text": "Hello, how are you?"}`
 }
 
-func releaseChatRequest(chatRequest *ChatRequest) {
+func releaseChatRequest(chatRequest *ollama.ChatRequest) {
 	chatRequest.Messages = chatRequest.Messages[:0]
 	chatRequest.Images = chatRequest.Images[:0]
-	chatRequest.Format = ""
+	chatRequest.Format = nil
 	chatRequest.Model = ""
+	chatRequest.Options = nil
+	chatRequest.FormatRetries = nil
 	chatRequestPool.Put(chatRequest)
 }
 
-func logRequest(requestID string, chatRequest *ChatRequest) {
+func logRequest(requestID string, chatRequest *ollama.ChatRequest) {
 	slog.Debug("LLM request",
 		"request_id", requestID,
 		"model", chatRequest.Model,
@@ -80,4 +106,11 @@ func respondError(w http.ResponseWriter, status int, code, message string) {
 		"error":   code,
 		"message": message,
 	})
-}
\ No newline at end of file
+}
+
+// setCacheHeader reports the cache status in the X-Orus-Cache header.
+func setCacheHeader(w http.ResponseWriter, status orus.CacheStatus) {
+	if status != "" {
+		w.Header().Set("X-Orus-Cache", string(status))
+	}
+}
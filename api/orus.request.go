@@ -0,0 +1,201 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/Dsouza10082/orus"
+)
+
+// ==================== Request Decoding ====================
+
+// Validator is implemented by request bodies that check their own fields.
+// decodeJSON runs it after decoding so handlers only see valid requests.
+type Validator interface {
+	Validate() *orus.ValidationError
+}
+
+// decodeJSON decodes the body of r into a new T, rejecting bodies over
+// MaxBodySize, unknown fields and trailing data, then validates it when T
+// implements Validator. On failure it writes a structured error response
+// and returns false.
+func decodeJSON[T any](w http.ResponseWriter, r *http.Request) (*T, bool) {
+	return decodeRequest[T](w, r, false)
+}
+
+// decodeOptionalJSON is decodeJSON for the routes whose body may be
+// omitted: an empty body decodes to the zero T.
+func decodeOptionalJSON[T any](w http.ResponseWriter, r *http.Request) (*T, bool) {
+	return decodeRequest[T](w, r, true)
+}
+
+func decodeRequest[T any](w http.ResponseWriter, r *http.Request, emptyAllowed bool) (*T, bool) {
+	request := new(T)
+	if err := decodeJSONBody(w, r, request); err != nil && !(emptyAllowed && err.Code == "missing_body") {
+		respondValidationError(w, err)
+		return nil, false
+	}
+	if validator, ok := any(request).(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			respondValidationError(w, err)
+			return nil, false
+		}
+	}
+	return request, true
+}
+
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, v any) *orus.ValidationError {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, orus.MaxBodySize))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(v)
+	if err == nil {
+		if decoder.More() {
+			return &orus.ValidationError{Code: "invalid_request", Message: "Request body must contain a single JSON object"}
+		}
+		return nil
+	}
+
+	var (
+		syntaxError   *json.SyntaxError
+		typeError     *json.UnmarshalTypeError
+		maxBytesError *http.MaxBytesError
+	)
+	switch {
+	case errors.Is(err, io.EOF):
+		return &orus.ValidationError{Code: "missing_body", Message: "Request body is required"}
+	case errors.As(err, &maxBytesError):
+		return &orus.ValidationError{Code: "request_too_large", Message: fmt.Sprintf("Request body must not exceed %d bytes", maxBytesError.Limit)}
+	case errors.As(err, &syntaxError):
+		return &orus.ValidationError{Code: "invalid_json", Message: fmt.Sprintf("Malformed JSON at position %d", syntaxError.Offset)}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &orus.ValidationError{Code: "invalid_json", Message: "Malformed JSON: unexpected end of body"}
+	case errors.As(err, &typeError):
+		return &orus.ValidationError{
+			Code:    "invalid_field",
+			Field:   typeError.Field,
+			Message: fmt.Sprintf("Field '%s' must be a %s", typeError.Field, typeError.Type),
+		}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return &orus.ValidationError{
+			Code:    "unknown_field",
+			Field:   field,
+			Message: fmt.Sprintf("Field '%s' is not supported", field),
+		}
+	default:
+		return &orus.ValidationError{Code: "invalid_request", Message: "Invalid JSON body: " + err.Error()}
+	}
+}
+
+// respondValidationError writes err as a 400, or a 413 for oversized bodies,
+// naming the offending field when known.
+func respondValidationError(w http.ResponseWriter, err *orus.ValidationError) {
+	status := http.StatusBadRequest
+	if err.Code == "request_too_large" {
+		status = http.StatusRequestEntityTooLarge
+	}
+	body := map[string]interface{}{
+		"success": false,
+		"error":   err.Code,
+		"message": err.Message,
+	}
+	if err.Field != "" {
+		body["field"] = err.Field
+	}
+	respondJSON(w, status, body)
+}
+
+type EmbedTextRequest struct {
+	Model string `json:"model" swaggertype:"string" example:"bge-m3"`
+	Text  string `json:"text" swaggertype:"string" example:"Hello, how are you?"`
+}
+
+func (r *EmbedTextRequest) Validate() *orus.ValidationError {
+	if r.Model == "" {
+		return &orus.ValidationError{Code: "missing_model", Field: "model", Message: "Field 'model' is required"}
+	}
+	if strings.TrimSpace(r.Text) == "" {
+		return &orus.ValidationError{Code: "missing_text", Field: "text", Message: "Field 'text' is required"}
+	}
+	return nil
+}
+
+type PullModelRequest struct {
+	Name string `json:"name" swaggertype:"string" example:"llama3.1:8b"`
+}
+
+func (r *PullModelRequest) Validate() *orus.ValidationError {
+	if strings.TrimSpace(r.Name) == "" {
+		return &orus.ValidationError{Code: "missing_name", Field: "name", Message: "Field 'name' is required"}
+	}
+	return nil
+}
+
+var messageRoles = []string{"system", "user", "assistant", "tool"}
+
+// Validate checks the LLM call and normalizes data URL images to plain base64.
+func (b *LLMCloudRequestBody) Validate() *orus.ValidationError {
+	if b.Model == "" {
+		return &orus.ValidationError{Code: "missing_model", Field: "model", Message: "Field 'model' is required"}
+	}
+	if len(b.Messages) == 0 {
+		return &orus.ValidationError{Code: "missing_messages", Field: "messages", Message: "Field 'messages' is required"}
+	}
+	for i, message := range b.Messages {
+		if !slices.Contains(messageRoles, message.Role) {
+			return &orus.ValidationError{
+				Code:    "invalid_messages",
+				Field:   fmt.Sprintf("messages[%d].role", i),
+				Message: fmt.Sprintf("Field 'messages[%d].role' must be one of %s", i, strings.Join(messageRoles, ", ")),
+			}
+		}
+	}
+	if err := b.Format.Validate(); err != nil {
+		return &orus.ValidationError{Code: "invalid_format", Field: "format", Message: "Field 'format' must be 'json' or a JSON schema object"}
+	}
+	if b.RepairRetries != nil && (*b.RepairRetries < 0 || *b.RepairRetries > maxRepairRetries) {
+		return &orus.ValidationError{Code: "invalid_repair_retries", Field: "repair_retries", Message: fmt.Sprintf("Field 'repair_retries' must be between 0 and %d", maxRepairRetries)}
+	}
+	if b.MaxCost != nil && *b.MaxCost < 0 {
+		return &orus.ValidationError{Code: "invalid_max_cost", Field: "max_cost", Message: "Field 'max_cost' must not be negative"}
+	}
+	for i, name := range b.Transforms {
+		if _, ok := streamTransforms[name]; !ok {
+			return &orus.ValidationError{
+				Code:    "invalid_transforms",
+				Field:   fmt.Sprintf("transforms[%d]", i),
+				Message: fmt.Sprintf("Field 'transforms[%d]' must be one of %s", i, strings.Join(TransformNames(), ", ")),
+			}
+		}
+	}
+	if len(b.Transforms) > 0 && (len(b.Format) > 0 || len(b.RespondAs) > 0 || b.AutoTools) {
+		return &orus.ValidationError{Code: "invalid_transforms", Field: "transforms", Message: "Field 'transforms' cannot be combined with format, respond_as or auto_tools"}
+	}
+	if len(b.RespondAs) > 0 {
+		if len(b.Format) > 0 || b.Stream || b.AutoTools {
+			return &orus.ValidationError{Code: "invalid_respond_as", Field: "respond_as", Message: "Field 'respond_as' cannot be combined with format, stream or auto_tools"}
+		}
+		format, err := b.RespondAs.Format()
+		if err != nil {
+			return &orus.ValidationError{Code: "invalid_respond_as", Field: "respond_as", Message: fmt.Sprintf("Field 'respond_as' is invalid: %s", err)}
+		}
+		b.Format = format
+	}
+	images, err := orus.ValidateImages(b.Images)
+	if err != nil {
+		err.Field = "images"
+		return err
+	}
+	b.Images = images
+	return nil
+}
+
+func (r *LLMCloudRequest) Validate() *orus.ValidationError {
+	return r.Body.Validate()
+}
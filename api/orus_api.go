@@ -0,0 +1,1420 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Dsouza10082/orus"
+	"github.com/Dsouza10082/orus/ollama"
+	view "github.com/Dsouza10082/orus/view"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+	"github.com/starfederation/datastar-go/datastar"
+	httpSwagger "github.com/swaggo/http-swagger"
+
+	_ "github.com/Dsouza10082/orus/docs"
+)
+
+type OrusAPI struct {
+	*orus.Orus
+	Port     string
+	router   *chi.Mux
+	Verbose  bool
+	server   *http.Server
+	Timeouts orus.TimeoutPolicy
+
+	// listener and basePath are set by WithListener and WithBasePath
+	listener net.Listener
+	basePath string
+	// authKeys are the keys of ORUS_API_REQUIRE_AUTH the playground signs
+	// in with; nil when the built-in auth is off.
+	authKeys keySet
+	// routesOnce sets up the routes for Start or Handler, whichever comes
+	// first
+	routesOnce sync.Once
+
+	GenerationAdmission *Admission
+	EmbeddingAdmission  *Admission
+	RateLimiter         *RateLimiter
+	MCP                 *orus.MCPServer
+	// Streams keeps the events of the generation streams for the clients
+	// that resume them.
+	Streams *StreamBuffers
+	// Running are the generations in progress, which can be canceled.
+	Running *RunningGenerations
+	// StreamConnections are the open event streams, capped per caller.
+	StreamConnections *StreamConnections
+	// Prompts are the generations of the prompt page, which a reloaded
+	// page re-attaches to.
+	Prompts *PromptRuns
+
+	reloadMu sync.Mutex
+}
+
+type PromptSignals struct {
+	Prompt        string   `json:"prompt"`
+	Model         string   `json:"model"`
+	OperationType string   `json:"operationType"`
+	ResponseMode  string   `json:"responseMode"`
+	Temperature   float64  `json:"temperature"`
+	Theme         string   `json:"theme"`
+	Think         bool     `json:"think"`
+	Thinking      string   `json:"thinking"`
+	Result        string   `json:"result"`
+	Images        []string `json:"images,omitempty"`
+	ImageError    string   `json:"imageError"`
+	// PageSession identifies the browser tab, so a reload re-attaches to
+	// its generation.
+	PageSession string `json:"pageSession"`
+}
+
+
+var (
+	bufferPool = sync.Pool{
+		New: func() interface{} {
+			return bytes.NewBuffer(make([]byte, 0, 4096))
+		},
+	}
+
+	stringBuilderPool = sync.Pool{
+		New: func() interface{} {
+			return &strings.Builder{}
+		},
+	}
+
+	chatRequestPool = sync.Pool{
+		New: func() interface{} {
+			return &ollama.ChatRequest{
+				Messages: make([]ollama.Message, 0, 10),
+				Images:   make([]string, 0, 4),
+			}
+		},
+	}
+)
+
+const optimizedLLMPath = "/orus-api/v2/call-llm"
+
+// NewOrusAPI builds the server of config. The options customize it for
+// programs embedding Orus; see WithPort, WithListener, WithMiddleware,
+// WithLogger, WithAuth, WithBasePath and WithBackend. Like orus.NewOrus, it returns the
+// server along with a *orus.DegradedError when some features failed to
+// load, and fails when config is invalid.
+func NewOrusAPI(config orus.Config, opts ...Option) (*OrusAPI, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.port != "" {
+		config.Server.Port = o.port
+	}
+	if o.listener != nil {
+		if addr, ok := o.listener.Addr().(*net.TCPAddr); ok {
+			config.Server.Port = strconv.Itoa(addr.Port)
+		}
+	}
+
+	// the core comes first: the API key middleware checks the stored keys
+	var core *orus.Orus
+	var err error
+	if o.backend != nil {
+		core, err = orus.NewOrusWithBackend(config, o.backend)
+	} else {
+		core, err = orus.NewOrus(config)
+	}
+	if core == nil {
+		return nil, err
+	}
+
+	router := chi.NewRouter()
+	if o.logger != nil {
+		router.Use(middleware.RequestLogger(&middleware.DefaultLogFormatter{
+			Logger:  slog.NewLogLogger(o.logger.Handler(), slog.LevelInfo),
+			NoColor: true,
+		}))
+	} else {
+		router.Use(middleware.Logger)
+	}
+	router.Use(middleware.Recoverer)
+	router.Use(middleware.StripSlashes)
+	router.Use(middleware.URLFormat)
+
+	router.Use(middleware.RequestID)
+	router.Use(middleware.RealIP)
+	if o.logger != nil {
+		router.Use(NewRequestLogger(o.logger))
+	} else {
+		router.Use(RequestLogger)
+	}
+	if len(config.Server.CORSOrigins) > 0 {
+		router.Use(CORS(config.Server.CORSOrigins))
+	}
+	// the responses are compressed as the handlers and the idempotency
+	// replays write them
+	router.Use(Compress(config.Compression.Encodings, config.Compression.MinSize))
+	var authKeys keySet
+	if o.auth != nil {
+		router.Use(o.auth)
+	} else if config.Server.RequireAuth {
+		keys := slices.Concat(config.Server.APIKeys, config.Server.AdminKeys)
+		authKeys = newKeySet(keys)
+		router.Use(APIKeyAuth(keys, core.APIKeys))
+	}
+	rateLimiter := NewRateLimiter(config.Limits.Rate, core.Redis)
+	router.Use(rateLimiter.Middleware)
+
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit := int64(orus.MaxBodySize)
+			// videos are spooled to disk while they are sampled, so they have a limit of their own
+			if r.URL.Path == videoIngestPath {
+				limit = int64(config.Video.MaxSize)
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.Use(Idempotency(core.Idempotency))
+	router.Use(o.middlewares...)
+
+	var handler http.Handler = router
+	if o.basePath != "" {
+		// the routes see the path without the base path, so the middlewares
+		// and the screening rules match it as they do at the root
+		handler = http.StripPrefix(o.basePath, router)
+	}
+
+	timeouts := config.Timeouts
+	server := &http.Server{
+		Addr:              ":" + config.Server.Port,
+		Handler:           handler,
+		ReadTimeout:       timeouts.Read,
+		WriteTimeout:      timeouts.WriteTimeout(),
+		IdleTimeout:       120 * time.Second,
+		ReadHeaderTimeout: 10 * time.Second,
+		MaxHeaderBytes:    1 << 20,
+	}
+	if o.logger != nil {
+		server.ErrorLog = slog.NewLogLogger(o.logger.Handler(), slog.LevelError)
+	}
+	s := &OrusAPI{
+		Orus:     core,
+		Port:     config.Server.Port,
+		router:   router,
+		Verbose:  config.Server.Verbose,
+		server:   server,
+		Timeouts: timeouts,
+		listener: o.listener,
+		basePath: o.basePath,
+		authKeys: authKeys,
+	}
+	s.RateLimiter = rateLimiter
+	s.GenerationAdmission = NewAdmission("generation", config.Limits.Generation).SetPriority(s.requestPriority)
+	s.EmbeddingAdmission = NewAdmission("embedding", config.Limits.Embedding).SetPriority(s.requestPriority)
+	s.MCP = orus.NewMCPServer(s.Orus)
+	s.Streams = NewStreamBuffers()
+	s.Running = NewRunningGenerations()
+	s.StreamConnections = NewStreamConnections(config.Limits.Streams)
+	s.Prompts = NewPromptRuns(s.Streams)
+	return s, err
+}
+
+// requestPriority reads the X-Orus-Priority header. Only the admin keys may
+// ask for high priority, so a tenant cannot jump the queue.
+func (s *OrusAPI) requestPriority(r *http.Request) Priority {
+	priority, ok := ParsePriority(r.Header.Get("X-Orus-Priority"))
+	if !ok {
+		return PriorityNormal
+	}
+	if priority == PriorityHigh && !newKeySet(s.CurrentConfig().Server.AdminKeys).contains(adminKey(r)) {
+		return PriorityNormal
+	}
+	return priority
+}
+
+func (s *OrusAPI) setupRoutes() {
+	timeouts := s.Timeouts
+	// the slow log wraps every route, before their admission
+	s.router.Use(s.SlowRequests.Middleware)
+	s.router.Use(SSEKeepalive(timeouts.Keepalive))
+	// within the keepalive, so a rejected stream gets no keepalive comments
+	s.router.Use(s.StreamConnections.Middleware)
+
+	s.router.Group(func(r chi.Router) {
+		r.Use(RouteTimeout(timeouts.Default))
+		r.Get("/orus-api/v1/system-info", s.GetSystemInfo)
+		r.Get("/orus-api/v1/ollama-model-list", s.OllamaModelList)
+		r.Post("/orus-api/v2/health-check", s.HealthCheck)
+		r.Post("/orus-api/v1/upload-image", s.UploadImage)
+		r.Post("/orus-api/v1/sessions", s.CreateSession)
+		r.Get("/orus-api/v1/sessions", s.ListSessions)
+		r.Get("/orus-api/v1/sessions/{id}", s.GetSession)
+		r.Delete("/orus-api/v1/sessions/{id}", s.DeleteSession)
+		r.Get("/orus-api/v1/sessions/{id}/settings", s.GetSessionSettings)
+		r.Patch("/orus-api/v1/sessions/{id}/settings", s.UpdateSessionSettings)
+		r.Post("/orus-api/v1/sessions/{id}/branch", s.BranchSession)
+		r.Get("/orus-api/v1/sessions/{id}/export", s.ExportSession)
+		r.Post("/orus-api/v1/feedback", s.SubmitFeedback)
+		r.Get("/orus-api/v1/feedback/summary", s.GetFeedbackSummary)
+		r.Get("/orus-api/v1/memory", s.ListMemories)
+		r.Delete("/orus-api/v1/memory/{id}", s.DeleteMemory)
+		r.Get("/orus-api/v1/ui-settings", s.GetUISettings)
+		r.With(AdminOnly(s.CurrentConfig().Server.AdminKeys)).Get("/orus-api/v1/audit", s.GetAuditLog)
+		r.Get("/orus-api/v1/usage/summary", s.GetUsageSummary)
+		r.Get("/orus-api/v1/stats/models", s.GetModelStats)
+		r.Get("/orus-api/v1/stats/evictions", s.GetEvictionStats)
+		r.Get("/metrics", s.Metrics)
+		r.Get("/orus-api/v1/tools", s.ListTools)
+		r.Get("/orus-api/v1/workflows", s.ListWorkflows)
+		r.Get("/orus-api/v1/agents", s.ListAgents)
+		r.Get("/orus-api/v1/jobs/{id}", s.GetJob)
+		r.Post("/orus-api/v1/generations/{id}/cancel", s.CancelGeneration)
+		r.Get("/orus-api/v1/documents/file", s.GetDocumentFile)
+		r.With(AdminOnly(s.CurrentConfig().Server.AdminKeys)).Post("/orus-api/v1/config/reload", s.ReloadConfig)
+		r.With(AdminOnly(s.CurrentConfig().Server.AdminKeys)).Get("/orus-api/v1/config", s.GetConfig)
+		r.With(AdminOnly(s.CurrentConfig().Server.AdminKeys)).Get("/orus-api/v1/scheduler", s.GetSchedulerStats)
+		r.With(AdminOnly(s.CurrentConfig().Server.AdminKeys)).Get("/orus-api/v1/screening", s.GetScreeningStats)
+		r.With(AdminOnly(s.CurrentConfig().Server.AdminKeys)).Get("/orus-api/v1/slow-requests", s.GetSlowRequests)
+		r.With(AdminOnly(s.CurrentConfig().Server.AdminKeys)).Get("/orus-api/v1/api-keys", s.ListAPIKeys)
+		r.With(AdminOnly(s.CurrentConfig().Server.AdminKeys)).Post("/orus-api/v1/api-keys", s.CreateAPIKey)
+		r.With(AdminOnly(s.CurrentConfig().Server.AdminKeys)).Delete("/orus-api/v1/api-keys/{id}", s.RevokeAPIKey)
+		r.With(AdminOnly(s.CurrentConfig().Server.AdminKeys)).Get("/orus-api/v1/snapshots", s.ListSnapshots)
+		r.With(AdminOnly(s.CurrentConfig().Server.AdminKeys)).Post("/orus-api/v1/snapshots", s.CreateSnapshot)
+		r.With(AdminOnly(s.CurrentConfig().Server.AdminKeys)).Get("/orus-api/v1/snapshots/file", s.GetSnapshotFile)
+		r.With(AdminOnly(s.CurrentConfig().Server.AdminKeys)).Get("/orus-api/v1/admin/backup", s.ListBackups)
+		r.With(AdminOnly(s.CurrentConfig().Server.AdminKeys)).Get("/orus-api/v1/admin/backup/file", s.GetBackupFile)
+		r.With(AdminOnly(s.CurrentConfig().Server.AdminKeys)).Get("/orus-api/v1/admin/streams", s.GetStreamConnections)
+		r.Put("/orus-api/v1/ui-settings", s.UpdateUISettings)
+		r.Get("/prompt", s.IndexHandler)
+		r.Get("/chat", s.ChatHandler)
+		r.Get("/rag", s.RAGHandler)
+		r.Get("/models", s.ModelsHandler)
+		r.Get("/embeddings", s.EmbeddingsHandler)
+		r.Get("/compare", s.CompareHandler)
+		r.Get(playgroundLoginPath, s.LoginHandler)
+		r.Post(playgroundLoginPath, s.Login)
+	})
+
+	s.router.Group(func(r chi.Router) {
+		r.Use(RouteTimeout(timeouts.Embed))
+		r.Use(s.EmbeddingAdmission.Middleware)
+		r.Use(s.Usage.Middleware)
+		r.Post("/orus-api/v1/embed-text", s.EmbedText)
+		r.Post("/orus-api/v1/embed-image", s.EmbedImage)
+		r.Post("/orus-api/v1/image-search", s.SearchImages)
+		r.Post("/orus-api/v1/documents/search", s.SearchDocuments)
+		r.Post("/orus-api/v1/videos/search", s.SearchVideos)
+		r.Post("/orus-api/v1/sessions/search", s.SearchSessions)
+		r.Post("/orus-api/v1/memory", s.AddMemories)
+		r.Post(mcpPath, s.MCPRequest)
+		r.Post(mcpMessagePath, s.MCPMessage)
+	})
+
+	// a request with a callback URL runs as a job, within the timeout and
+	// the admission of its route
+	s.router.Group(func(r chi.Router) {
+		r.Use(WebhookJobs(s.Webhooks))
+		r.Use(RouteTimeout(timeouts.Chat))
+		r.Use(s.GenerationAdmission.Middleware)
+		r.Use(s.Audit.Middleware)
+		r.Use(s.Usage.Middleware)
+		r.Use(s.Screener.Middleware)
+		r.Use(s.capturePayloads)
+		r.Use(s.Running.Middleware)
+		r.Post("/orus-api/v1/call-llm", s.CallLLM)
+		r.Post("/orus-api/v1/call-llm-cloud", s.CallLLMCloud)
+		r.Post(optimizedLLMPath, s.CallLLMOptimized)
+		r.Post("/orus-api/v1/sessions/{id}/chat", s.SessionChat)
+		r.Post("/orus-api/v1/sessions/{id}/regenerate", s.RegenerateSession)
+		r.Post("/orus-api/v1/workflows/{name}/run", s.RunWorkflow)
+		r.Post("/orus-api/v1/agents/{name}/run", s.RunAgent)
+	})
+
+	// Ingestion may read every page of a scan by OCR, so it has the budget of
+	// a generation
+	s.router.Group(func(r chi.Router) {
+		r.Use(WebhookJobs(s.Webhooks))
+		r.Use(RouteTimeout(timeouts.Chat))
+		r.Use(s.EmbeddingAdmission.Middleware)
+		r.Post("/orus-api/v1/documents", s.IngestDocument)
+	})
+
+	// Every sampled frame of a video is captioned by a vision model, so video
+	// ingestion has the budget of a model download
+	s.router.Group(func(r chi.Router) {
+		r.Use(RouteTimeout(timeouts.Pull))
+		r.Use(s.GenerationAdmission.Middleware)
+		r.Post(videoIngestPath, s.IngestVideo)
+	})
+
+	s.router.Group(func(r chi.Router) {
+		r.Use(WebhookJobs(s.Webhooks))
+		r.Use(RouteTimeout(timeouts.Chat))
+		r.Use(s.GenerationAdmission.Middleware)
+		r.Use(s.Audit.Middleware)
+		r.Use(s.Usage.Middleware)
+		r.Post("/orus-api/v1/generate-image", s.GenerateImage)
+	})
+
+	s.router.Group(func(r chi.Router) {
+		r.Use(WebhookJobs(s.Webhooks))
+		r.Use(RouteTimeout(timeouts.Pull))
+		r.Post("/orus-api/v1/ollama-pull-model", s.OllamaPullModel)
+	})
+
+	// A backup or a restore copies every session and document, so it has
+	// the budget of a model download
+	s.router.Group(func(r chi.Router) {
+		r.Use(RouteTimeout(timeouts.Pull))
+		r.Use(AdminOnly(s.CurrentConfig().Server.AdminKeys))
+		r.Post("/orus-api/v1/admin/backup", s.CreateBackup)
+		r.Post("/orus-api/v1/admin/restore", s.RestoreBackup)
+	})
+
+	s.router.Group(func(r chi.Router) {
+		r.Use(StreamTimeout(timeouts.Stream))
+		r.With(s.GenerationAdmission.Middleware, s.Audit.Middleware, s.Usage.Middleware).Post("/prompt/llm-stream", s.PromptLLMStream)
+		r.Post("/prompt/resume", s.PromptResumeStream)
+		r.Post("/prompt/settings", s.PromptSettingsStream)
+		r.With(s.GenerationAdmission.Middleware, s.Audit.Middleware, s.Usage.Middleware).Post("/chat/send", s.ChatSendStream)
+		r.With(s.EmbeddingAdmission.Middleware).Post("/rag/index", s.RAGIndexStream)
+		r.With(s.GenerationAdmission.Middleware, s.Audit.Middleware, s.Usage.Middleware).Post("/rag/ask", s.RAGAskStream)
+		r.Post("/rag/clear", s.RAGClearStream)
+		r.Post("/models/delete", s.ModelsDeleteStream)
+		r.With(s.EmbeddingAdmission.Middleware).Post("/embeddings/project", s.EmbeddingsProjectStream)
+		r.With(s.GenerationAdmission.Middleware, s.Audit.Middleware, s.Usage.Middleware).Post("/compare/run", s.CompareRunStream)
+	})
+
+	s.router.Group(func(r chi.Router) {
+		r.Use(StreamTimeout(timeouts.Pull))
+		r.Post("/models/pull", s.ModelsPullStream)
+	})
+
+	s.router.Group(func(r chi.Router) {
+		r.Use(StreamTimeout(timeouts.Stream))
+		r.Get(mcpSSEPath, s.MCPStream)
+		r.Get("/orus-api/v1/streams/{id}", s.ResumeStream)
+	})
+
+	s.router.Group(s.mountDebug)
+
+	// a replay is a generation, so it waits for its turn like the others
+	s.router.Group(func(r chi.Router) {
+		r.Use(AdminOnly(s.CurrentConfig().Server.AdminKeys))
+		r.Use(RouteTimeout(timeouts.Chat))
+		r.Use(s.GenerationAdmission.Middleware)
+		r.Get(debugPath+"/payloads/{serial}", s.GetCapturedPayloads)
+		r.Post(debugPath+"/replay/{serial}", s.ReplayPayload)
+	})
+
+	s.router.Get("/swagger/*", httpSwagger.Handler(
+		httpSwagger.URL(fmt.Sprintf("http://localhost:%s%s/swagger/doc.json", s.Port, s.basePath)),
+	))
+
+	s.router.Get("/swagger/doc.json", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "docs/swagger.json")
+	})
+}
+
+// IndexHandler is a handler for the prompt endpoint
+// It renders the index.html file
+func (s *OrusAPI) IndexHandler(w http.ResponseWriter, r *http.Request) {
+	indexView := view.NewView()
+	models, err := s.Backend.ListModels()
+	if err != nil {
+		log.Printf("IndexHandler: failed to list models: %v", err)
+		http.Error(w, "failed to list models", http.StatusInternalServerError)
+		return
+	}
+	settings, err := s.UISettings.Get(uiUserID(w, r))
+	if err != nil {
+		log.Printf("IndexHandler: failed to load UI settings: %v", err)
+	}
+	preferences := view.DefaultPreferences()
+	if settings.DefaultModel != "" {
+		preferences.Model = settings.DefaultModel
+	}
+	if settings.Temperature != nil {
+		preferences.Temperature = *settings.Temperature
+	}
+	if settings.Theme != "" {
+		preferences.Theme = settings.Theme
+	}
+	preferences.Streaming = settings.IsStreaming()
+	if err := indexView.SetModels(models).RenderIndex(w, preferences, view.ImageLimits{
+		MaxSize:  orus.MaxImageSize,
+		MaxCount: orus.MaxImages,
+		Types:    orus.AllowedImageTypes,
+	}); err != nil {
+		log.Printf("IndexHandler: failed to render index: %v", err)
+		http.Error(w, "failed to render page", http.StatusInternalServerError)
+	}
+}
+
+// PromptLLMStream is a handler for the prompt/llm-stream endpoint
+// It reads the signals from the request and sends them to the LLM
+// It then streams the response back to the client
+func (s *OrusAPI) PromptLLMStream(w http.ResponseWriter, r *http.Request) {
+
+	signals := &PromptSignals{}
+	if err := datastar.ReadSignals(r, signals); err != nil {
+		log.Printf("PromptLLMStream: failed to read signals: %v", err)
+		http.Error(w, "failed to read signals", http.StatusBadRequest)
+		return
+	}
+
+	sse := datastar.NewSSE(w, r)
+
+	if signals.OperationType == "embedding" {
+
+		if signals.Model == "nomic-embed-text:latest" {
+			embedding, err := s.Backend.WithContext(r.Context()).GetEmbedding(signals.Model, signals.Prompt)
+			if err != nil {
+				_ = sse.ConsoleError(fmt.Errorf("embedding error: %w", err))
+				return
+			}
+			signals.Result = fmt.Sprintf("Nomic Embedding (768 dimensions): %v", embedding)
+		} else {
+			embedding, err := s.Orus.EmbedWithBGE_M3(signals.Prompt)
+			if err != nil {
+				_ = sse.ConsoleError(fmt.Errorf("embedding error: %w", err))
+				return
+			}
+			signals.Result = fmt.Sprintf("BGE-M3 Embedding (1024 dimensions): %v", embedding)
+		}
+
+		if err := sse.MarshalAndPatchSignals(signals); err != nil {
+			_ = sse.ConsoleError(fmt.Errorf("failed to patch signals: %w", err))
+		}
+		return
+	}
+
+	if signals.Model == "" {
+		signals.Model = "llama3.1:8b"
+	}
+
+	if signals.ResponseMode != "single" {
+		signals.ResponseMode = "stream"
+	}
+	options := map[string]interface{}{"temperature": signals.Temperature}
+
+	// images are only read from the client; clearing them keeps them out of every patch
+	images, verr := orus.ValidateImages(signals.Images)
+	signals.Images = nil
+	if verr != nil {
+		signals.ImageError = verr.Message
+		_ = sse.MarshalAndPatchSignals(signals)
+		return
+	}
+	images, resolveErr := s.Images.Resolve(images)
+	if resolveErr != nil {
+		signals.ImageError = resolveErr.Error()
+		_ = sse.MarshalAndPatchSignals(signals)
+		return
+	}
+	if images, verr = s.fitImages(signals.Model, images); verr != nil {
+		signals.ImageError = verr.Message
+		_ = sse.MarshalAndPatchSignals(signals)
+		return
+	}
+
+	signals.Result = ""
+	signals.Thinking = ""
+	signals.ImageError = ""
+	if err := sse.MarshalAndPatchSignals(signals); err != nil {
+		_ = sse.ConsoleError(fmt.Errorf("failed to clear result: %w", err))
+		return
+	}
+
+	messages := []ollama.Message{
+		{
+			Role:    "user",
+			Content: signals.Prompt,
+		},
+	}
+
+	if signals.ResponseMode == "single" {
+		resp, err := s.Backend.WithContext(r.Context()).Chat(ollama.ChatRequest{
+			Model:    signals.Model,
+			Messages: messages,
+			Stream:   false,
+			Think:    signals.Think,
+			Images:   images,
+			Options:  options,
+		})
+		if err != nil {
+			_ = sse.ConsoleError(fmt.Errorf("LLM error: %w", err))
+			return
+		}
+
+		thinking, answer := orus.SplitThinking(resp.Message.Content)
+		signals.Thinking = resp.Message.Thinking + thinking
+		signals.Result = answer
+		if err := sse.MarshalAndPatchSignals(signals); err != nil {
+			_ = sse.ConsoleError(fmt.Errorf("failed to patch signals: %w", err))
+		}
+		return
+	}
+
+	thinking := &strings.Builder{}
+	content := &strings.Builder{}
+	patch := func() {
+		tagged, answer := orus.SplitThinking(content.String())
+		signals.Thinking = thinking.String() + tagged
+		signals.Result = answer
+		if err := sse.MarshalAndPatchSignals(signals); err != nil {
+			_ = sse.ConsoleError(fmt.Errorf("failed to patch signals: %w", err))
+		}
+	}
+	batch := newChunkBatch(s.CurrentConfig().Streams)
+	// with a page session the generation outlives the request, for the page
+	// to re-attach to it after a reload
+	run, ctx := s.Prompts.start(w, r, signals, s.CurrentConfig().Streams)
+	err := s.Backend.WithContext(ctx).ChatStream(ollama.ChatRequest{
+		Model:    signals.Model,
+		Messages: messages,
+		Stream:   true,
+		Think:    signals.Think,
+		Images:   images,
+		Options:  options,
+	}, func(ctx context.Context, chunk ollama.ChatStreamResponse) error {
+		if sse.IsClosed() && run == nil {
+			return context.Canceled
+		}
+		if chunk.Message.Content == "" && chunk.Message.Thinking == "" {
+			return nil
+		}
+		thinking.WriteString(chunk.Message.Thinking)
+		content.WriteString(chunk.Message.Content)
+		run.add(chunk.Message.Thinking, chunk.Message.Content)
+		if batch.add(utf8.RuneCountInString(chunk.Message.Thinking)+utf8.RuneCountInString(chunk.Message.Content)) && !sse.IsClosed() {
+			patch()
+		}
+		return nil
+	})
+	run.end(err)
+	if batch.flush() && !sse.IsClosed() {
+		patch()
+	}
+
+	if err != nil && !ollama.IsCanceled(err) {
+		_ = sse.ConsoleError(fmt.Errorf("ChatStream error: %w", err))
+	}
+}
+
+// passthroughChat streams the Ollama chunks of a chat without decoding them,
+// each as a chunk event. Only the final chunk is decoded, for the token
+// counts of the done event. The reply is not kept, so it is not recorded in
+// the generation log and the done event has no serial nor content.
+func (s *OrusAPI) passthroughChat(w http.ResponseWriter, r *http.Request, chatRequest ollama.ChatRequest, startTime time.Time) {
+	events, ctx, ok := s.Streams.Start(w, r, s.CurrentConfig().Streams)
+	if !ok {
+		return
+	}
+	defer events.Close()
+	watchdog, ctx := orus.NewWatchdog(ctx, s.CurrentConfig().Watchdog)
+	defer watchdog.Stop()
+	var last ollama.ChatStreamResponse
+	err := s.Backend.WithContext(ctx).ChatStreamRaw(chatRequest, func(line []byte) error {
+		if bytes.Contains(line, []byte(`"done":true`)) {
+			_ = json.Unmarshal(line, &last)
+		}
+		if err := events.Raw(EventChunk, line); err != nil {
+			return err
+		}
+		return watchdog.ObserveLine()
+	})
+	err = canceledCause(ctx, err)
+	if aborted := watchdog.Aborted(); aborted != nil {
+		_ = events.Aborted(aborted)
+		return
+	}
+	if err != nil {
+		_ = events.Error(llmErrorCode(err), err)
+		return
+	}
+	_ = events.Done(DonePayload{
+		Message:          "LLM request received successfully",
+		Model:            chatRequest.Model,
+		Think:            chatRequest.Think,
+		PromptTokens:     last.PromptEvalCount,
+		CompletionTokens: last.EvalCount,
+		TimeTaken:        time.Since(startTime).String(),
+	})
+}
+
+// Start is a function that starts the Orus API server
+// It sets up the routes and serves until the server fails
+func (s *OrusAPI) Start() error {
+	s.routesOnce.Do(s.setupRoutes)
+	go s.reloadOnSignal()
+	if remote := s.CurrentConfig().Remote; remote.Backend != "" {
+		go s.watchRemote(context.Background(), remote)
+	}
+	config := s.CurrentConfig()
+	log.Println("Orus API ORUS_API_PORT", config.Server.Port)
+	log.Println("Orus API ORUS_API_AGENT_MEMORY_PATH", config.Embedder.MemoryPath)
+	log.Println("Orus API ORUS_API_TOK_PATH", config.Embedder.TokPath)
+	log.Println("Orus API ORUS_API_ONNX_PATH", config.Embedder.OnnxPath)
+	log.Println("Orus API ORUS_API_ONNX_RUNTIME_PATH", config.Embedder.OnnxRuntimePath)
+	log.Println("Orus API ORUS_API_OLLAMA_BASE_URL", config.Ollama.BaseURL)
+	if s.listener != nil {
+		log.Println("Orus API server started on", s.listener.Addr())
+		return serveError(s.server.Serve(s.listener))
+	}
+	log.Println("Orus API server started on port", s.server.Addr)
+
+	return serveError(s.server.ListenAndServe())
+}
+
+// Handler returns the handler of every route, to mount Orus in an existing
+// server instead of calling Start. Mounted under a prefix, the server must
+// be built with WithBasePath(prefix) so the routes, and the API key checks,
+// see the paths they expect; with chi:
+//
+//	router.Mount("/ai", orusAPI.Handler())
+//
+// The configuration is not reloaded on SIGHUP; call Reload instead.
+func (s *OrusAPI) Handler() http.Handler {
+	s.routesOnce.Do(s.setupRoutes)
+	return s.server.Handler
+}
+
+// serveError wraps the error the server stopped with; a server closed on
+// purpose is not an error.
+func serveError(err error) error {
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return fmt.Errorf("failed to start server: %w", err)
+}
+
+// SetVerbose is a function that sets the verbose mode
+// It returns the OrusAPI instance
+func (s *OrusAPI) SetVerbose(verbose bool) *OrusAPI {
+	s.Verbose = verbose
+	return s
+}
+
+// GetUsers godoc
+// @Summary      Returns the system information
+// @Description  Returns the system information
+// @Tags         system
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  OrusResponse
+// @Failure      500  {object}  OrusResponse
+// @Router       /orus-api/v1/system-info [get]
+func (s *OrusAPI) GetSystemInfo(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	response := OrusResponse{
+		Success:   true,
+		Serial:    uuid.New().String(),
+		Message:   "System info retrieved successfully",
+		Error:     "",
+		TimeTaken: time.Since(startTime),
+		Data: map[string]interface{}{
+			"version":     "1.0.0",
+			"name":        "Orus",
+			"description": "Orus is a server for the Orus library",
+			"author":      "Dsouza10082",
+			"author_url":  "https://github.com/Dsouza10082",
+		},
+	}
+	respondJSON(w, http.StatusOK, response)
+}
+
+// EmbedText godoc
+// @Summary      Embeds text using the BGE-M3 or Ollama embedding model
+// @Description  Embeds text using the BGE-M3 or Ollama embedding model
+// @Tags         embed
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  OrusResponse
+// @Failure      500  {object}  OrusResponse
+// @Router       /orus-api/v1/embed-text [post]
+func (s *OrusAPI) EmbedText(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	request, ok := decodeJSON[EmbedTextRequest](w, r)
+	if !ok {
+		return
+	}
+	model := request.Model
+	text := request.Text
+	if _, err := s.Orus.Embedder(model); err != nil {
+		respondValidationError(w, &orus.ValidationError{
+			Code:    "invalid_model",
+			Field:   "model",
+			Message: fmt.Sprintf("Field 'model' must be one of %s", strings.Join(s.EmbedderNames(), ", ")),
+		})
+		return
+	}
+
+	ctx := r.Context()
+
+	respChan := make(chan *OrusResponse, 1)
+
+	go func() {
+		resp := s.embedText(ctx, model, text, startTime)
+		select {
+		case respChan <- resp:
+		case <-ctx.Done():
+		}
+	}()
+
+	select {
+	case resp := <-respChan:
+		respondJSON(w, http.StatusOK, resp)
+	case <-ctx.Done():
+		timeoutResp := NewOrusResponse()
+		timeoutResp.Error = "Error Timeout"
+		timeoutResp.Success = false
+		timeoutResp.TimeTaken = time.Since(startTime)
+		timeoutResp.Message = "Error Timeout"
+		respondJSON(w, http.StatusGatewayTimeout, timeoutResp)
+	}
+}
+
+// OllamaModelList godoc
+// @Summary      Returns the list of models available in the Ollama server
+// @Description  Returns the list of models available in the Ollama server
+// @Tags         ollama
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  OrusResponse
+// @Failure      500  {object}  OrusResponse
+// @Router       /orus-api/v1/ollama-model-list [get]
+func (s *OrusAPI) OllamaModelList(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	models, err := s.Backend.WithContext(r.Context()).ListModels()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{
+		"models": models,
+	}
+	response.Success = true
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Ollama model list retrieved successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// OllamaPullModel godoc
+// @Summary      Pulls a model from the Ollama server
+// @Description  Pulls a model from the Ollama server
+// @Tags         ollama
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  OrusResponse
+// @Failure      500  {object}  OrusResponse
+// @Router       /orus-api/v1/ollama-pull-model [post]
+func (s *OrusAPI) OllamaPullModel(w http.ResponseWriter, r *http.Request) {
+	request, ok := decodeJSON[PullModelRequest](w, r)
+	if !ok {
+		return
+	}
+
+	startTime := time.Now()
+	events, ok := NewEventStream(w)
+	if !ok {
+		return
+	}
+
+	progressCallback := func(progress ollama.PullModelProgress) {
+		_ = events.Progress(progress)
+	}
+
+	if err := s.Backend.WithContext(r.Context()).PullModel(request.Name, progressCallback); err != nil {
+		_ = events.Error("pull_error", err)
+		return
+	}
+
+	_ = events.Done(DonePayload{
+		Message:   fmt.Sprintf("Model %s downloaded successfully", request.Name),
+		Model:     request.Name,
+		TimeTaken: time.Since(startTime).String(),
+	})
+}
+
+func (s *OrusAPI) embedText(ctx context.Context, model string, text string, startTime time.Time) *OrusResponse {
+	resp := NewOrusResponse()
+
+	serial := uuid.New().String()
+	embedder, err := s.Orus.Embedder(model)
+	if err != nil {
+		resp.Error = "Invalid model"
+		resp.Success = false
+		resp.TimeTaken = time.Since(startTime)
+		resp.Message = "Invalid model"
+		return resp
+	}
+	vector64, err := embedder.Embed(ctx, text)
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.TimeTaken = time.Since(startTime)
+		resp.Message = fmt.Sprintf("Error embedding text with model %s", model)
+		return resp
+	}
+	quantization := "float64"
+	if quantized, ok := embedder.(interface{ Quantization() string }); ok {
+		quantization = quantized.Quantization()
+	}
+	// the float32 embeddings are written at their own precision
+	vector := make([]any, len(vector64))
+	for i, v := range vector64 {
+		if quantization == "float32" {
+			vector[i] = float32(v)
+		} else {
+			vector[i] = v
+		}
+	}
+	resp.Data = map[string]interface{}{
+		"serial":       serial,
+		"vector":       vector,
+		"text":         text,
+		"model":        model,
+		"dimensions":   len(vector64),
+		"quantization": quantization,
+	}
+	resp.Success = true
+	resp.TimeTaken = time.Since(startTime)
+	resp.Message = "Embed request received successfully"
+	return resp
+}
+
+// CallLLM godoc
+// @Summary      Calls the LLM using the Ollama client
+// @Description  Calls the LLM using the Ollama client
+// @Tags         llm
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  OrusResponse
+// @Failure      500  {object}  OrusResponse
+// @Router       /orus-api/v1/call-llm [post]
+func (s *OrusAPI) CallLLM(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+
+	response := NewOrusResponse()
+	request, ok := decodeJSON[LLMCloudRequest](w, r)
+	if !ok || !s.resolveImages(w, &request.Body) || !s.checkVision(w, r, request.Body.Model, request.Body.Images) {
+		return
+	}
+
+	model := request.Body.Model
+	think := request.Body.Think
+	stream := request.Body.Stream
+
+	chatRequest := ollama.ChatRequest{
+		Model:    model,
+		Messages: request.Body.Messages,
+		Stream:   stream,
+		Think:    think,
+		Format:   request.Body.Format,
+		Images:   request.Body.Images,
+		Options:  request.Body.Options,
+		FormatRetries: request.Body.RepairRetries,
+	}
+
+	screening := s.Screener.ScreenInput(r.Context(), r.URL.Path, chatRequest.Messages)
+	if screening != nil && screening.Blocked {
+		respondScreenBlocked(w, orus.ScreenInput, screening)
+		return
+	}
+
+	if request.Body.AutoTools {
+		s.chatWithTools(w, r, chatRequest, request.Body.Tools, screening, startTime)
+		return
+	}
+
+	if stream && request.Body.Passthrough && len(chatRequest.Format) == 0 && len(request.Body.Transforms) == 0 && !s.Screener.ScreensOutput(r.Context(), r.URL.Path) {
+		s.passthroughChat(w, r, chatRequest, startTime)
+		return
+	}
+
+	if stream {
+		events, streamCtx, ok := s.Streams.Start(w, r, s.CurrentConfig().Streams)
+		if !ok {
+			return
+		}
+		defer events.Close()
+		if len(chatRequest.Format) > 0 {
+			events.streamJSON()
+		}
+		events.transformAnswer(request.Body.Transforms)
+		content := &strings.Builder{}
+		thinking := &strings.Builder{}
+		watchdog, ctx := orus.NewWatchdog(streamCtx, s.CurrentConfig().Watchdog)
+		defer watchdog.Stop()
+		var last ollama.ChatStreamResponse
+		chatStreamProgressCallback := func(ctx context.Context, chatResp ollama.ChatStreamResponse) error {
+			content.WriteString(chatResp.Message.Content)
+			thinking.WriteString(chatResp.Message.Thinking)
+			last = chatResp
+			watchdog.Observe(chatResp)
+			// a client that cannot be written to is gone, so the generation
+			// stops, unless the stream can be resumed
+			return events.Chunk(chatResp)
+		}
+		err := s.Backend.WithContext(ctx).ChatStream(chatRequest, chatStreamProgressCallback)
+		err = canceledCause(ctx, err)
+		if aborted := watchdog.Aborted(); aborted != nil {
+			_ = events.Aborted(aborted)
+			return
+		}
+		if err != nil {
+			_ = events.Error(llmErrorCode(err), err)
+			return
+		}
+		answer := transformText(request.Body.Transforms, content.String())
+		serial := uuid.New().String()
+		s.recordGeneration(streamCtx, serial, r.URL.Path, &chatRequest, answer, startTime)
+		done := DonePayload{
+			Message:          "LLM request received successfully",
+			Serial:           serial,
+			Model:            model,
+			Content:          answer,
+			Thinking:         thinking.String(),
+			Think:            think,
+			PromptTokens:     last.PromptEvalCount,
+			CompletionTokens: last.EvalCount,
+			TimeTaken:        time.Since(startTime).String(),
+		}
+		if err := chatRequest.Format.Check(content.String()); err != nil {
+			done.FormatError = err.Error()
+		}
+		done.Screening = s.Screener.ScreenOutput(streamCtx, r.URL.Path, answer, screening)
+		if done.Screening != nil && done.Screening.Blocked {
+			_ = events.Error("output_blocked", errors.New("the output was blocked by the content policy"))
+			return
+		}
+		_ = events.Done(done)
+		return
+	} else {
+		responseLLM, cache, err := s.ResponseCache.Chat("local", chatRequest, s.Backend.WithContext(r.Context()).Chat)
+		err = canceledCause(r.Context(), err)
+		setCacheHeader(w, cache)
+		if err != nil && len(request.Body.RespondAs) > 0 && respondFormatFailure(w, err) {
+			return
+		}
+		if err != nil {
+			response.Error = err.Error()
+			response.Message = "Error calling LLM"
+			response.Success = false
+			response.TimeTaken = time.Since(startTime)
+			respondJSON(w, errorStatus(err), response)
+		} else {
+			answer := transformText(request.Body.Transforms, responseLLM.Message.Content)
+			screening = s.Screener.ScreenOutput(r.Context(), r.URL.Path, answer, screening)
+			if screening != nil && screening.Blocked {
+				respondScreenBlocked(w, orus.ScreenOutput, screening)
+				return
+			}
+			serial := uuid.New().String()
+			s.recordGeneration(r.Context(), serial, r.URL.Path, &chatRequest, answer, startTime)
+			successData := map[string]interface{}{
+				"success":    true,
+				"message":    "LLM request received successfully",
+				"content":    answer,
+				"serial":     serial,
+				"time_taken": time.Since(startTime).String(),
+				"model":      model,
+				"stream":     stream,
+				"think":      think,
+			}
+			if screening != nil {
+				successData["screening"] = screening
+			}
+			if cache != "" {
+				successData["cache"] = cache
+			}
+			if len(request.Body.RespondAs) > 0 {
+				successData["result"] = json.RawMessage(strings.TrimSpace(responseLLM.Message.Content))
+			}
+			respondJSON(w, http.StatusOK, successData)
+		}
+	}
+}
+
+// CallLLM godoc
+// @Summary      Calls the LLM using the Ollama client
+// @Description  Calls the LLM using the Ollama client
+// @Tags         llm
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  OrusResponse
+// @Failure      500  {object}  OrusResponse
+// @Router       /orus-api/v1/call-llm [post]
+func (s *OrusAPI) CallLLMCloud(w http.ResponseWriter, r *http.Request) {
+
+	startTime := time.Now()
+
+	response := NewOrusResponse()
+	request, ok := decodeJSON[LLMCloudRequest](w, r)
+	if !ok || !s.resolveImages(w, &request.Body) {
+		return
+	}
+
+	model := request.Body.Model
+	think := request.Body.Think
+	stream := request.Body.Stream
+
+	chatRequest := ollama.ChatRequest{
+		Model:    model,
+		Messages: request.Body.Messages,
+		Stream:   stream,
+		Think:    think,
+		Format:   request.Body.Format,
+		Images:   request.Body.Images,
+		Options:  request.Body.Options,
+		FormatRetries: request.Body.RepairRetries,
+	}
+
+	screening := s.Screener.ScreenInput(r.Context(), r.URL.Path, chatRequest.Messages)
+	if screening != nil && screening.Blocked {
+		respondScreenBlocked(w, orus.ScreenInput, screening)
+		return
+	}
+
+	costs := s.CurrentConfig().Cost
+	cost := &CostReport{Estimate: costs.Estimate(chatRequest), MaxCost: request.Body.MaxCost}
+	if !checkMaxCost(w, cost.Estimate, request.Body.MaxCost) {
+		return
+	}
+
+	chatRequest.Model = model
+
+	log.Println("chatRequest--->", chatRequest)
+	log.Println("model--->", model)
+	log.Println("think--->", think)
+	log.Println("stream--->", stream)
+
+	if stream {
+		events, streamCtx, ok := s.Streams.Start(w, r, s.CurrentConfig().Streams)
+		if !ok {
+			return
+		}
+		defer events.Close()
+		if len(chatRequest.Format) > 0 {
+			events.streamJSON()
+		}
+		events.transformAnswer(request.Body.Transforms)
+		content := &strings.Builder{}
+		thinking := &strings.Builder{}
+		watchdog, ctx := orus.NewWatchdog(streamCtx, s.CurrentConfig().Watchdog)
+		defer watchdog.Stop()
+		var last ollama.ChatStreamResponse
+		chatStreamProgressCallback := func(ctx context.Context, chatResp ollama.ChatStreamResponse) error {
+			content.WriteString(chatResp.Message.Content)
+			thinking.WriteString(chatResp.Message.Thinking)
+			last = chatResp
+			watchdog.Observe(chatResp)
+			// a client that cannot be written to is gone, so the generation
+			// stops, unless the stream can be resumed
+			return events.Chunk(chatResp)
+		}
+		err := s.Backend.WithContext(ctx).ChatStreamCloud(chatRequest, chatStreamProgressCallback)
+		err = canceledCause(ctx, err)
+		if aborted := watchdog.Aborted(); aborted != nil {
+			_ = events.Aborted(aborted)
+			return
+		}
+		if err != nil {
+			_ = events.Error(llmErrorCode(err), err)
+			return
+		}
+		answer := transformText(request.Body.Transforms, content.String())
+		serial := uuid.New().String()
+		s.recordGeneration(streamCtx, serial, r.URL.Path, &chatRequest, answer, startTime)
+		done := DonePayload{
+			Message:          "LLM request received successfully",
+			Serial:           serial,
+			Model:            model,
+			Content:          answer,
+			Thinking:         thinking.String(),
+			Think:            think,
+			PromptTokens:     last.PromptEvalCount,
+			CompletionTokens: last.EvalCount,
+			TimeTaken:        time.Since(startTime).String(),
+		}
+		actual := costs.Cost(model, last.PromptEvalCount, last.EvalCount)
+		cost.Actual = &actual
+		done.Cost = cost
+		if err := chatRequest.Format.Check(content.String()); err != nil {
+			done.FormatError = err.Error()
+		}
+		done.Screening = s.Screener.ScreenOutput(streamCtx, r.URL.Path, answer, screening)
+		if done.Screening != nil && done.Screening.Blocked {
+			_ = events.Error("output_blocked", errors.New("the output was blocked by the content policy"))
+			return
+		}
+		_ = events.Done(done)
+		return
+	} else {
+		responseLLM, cache, err := s.ResponseCache.Chat("cloud", chatRequest, s.Backend.WithContext(r.Context()).ChatCloud)
+		err = canceledCause(r.Context(), err)
+		setCacheHeader(w, cache)
+		if err != nil && len(request.Body.RespondAs) > 0 && respondFormatFailure(w, err) {
+			return
+		}
+		if err != nil {
+			response.Error = err.Error()
+			response.Message = "Error calling LLM"
+			response.Success = false
+			response.TimeTaken = time.Since(startTime)
+			respondJSON(w, errorStatus(err), response)
+		} else {
+			answer := transformText(request.Body.Transforms, responseLLM.Message.Content)
+			screening = s.Screener.ScreenOutput(r.Context(), r.URL.Path, answer, screening)
+			if screening != nil && screening.Blocked {
+				respondScreenBlocked(w, orus.ScreenOutput, screening)
+				return
+			}
+			serial := uuid.New().String()
+			s.recordGeneration(r.Context(), serial, r.URL.Path, &chatRequest, answer, startTime)
+			successData := map[string]interface{}{
+				"success":    true,
+				"message":    "LLM request received successfully",
+				"content":    answer,
+				"serial":     serial,
+				"time_taken": time.Since(startTime).String(),
+				"model":      model,
+				"stream":     stream,
+				"think":      think,
+			}
+			cost.Actual = actualCost(costs, model, responseLLM, cache)
+			successData["cost"] = cost
+			if screening != nil {
+				successData["screening"] = screening
+			}
+			if cache != "" {
+				successData["cache"] = cache
+			}
+			if len(request.Body.RespondAs) > 0 {
+				successData["result"] = json.RawMessage(strings.TrimSpace(responseLLM.Message.Content))
+			}
+			respondJSON(w, http.StatusOK, successData)
+		}
+	}
+}
+
+func (s *OrusAPI) handleStreamingResponseChi(w http.ResponseWriter, r *http.Request, chatRequest *ollama.ChatRequest, transforms []string, screening *orus.ScreenReport, startTime time.Time, requestID string) {
+	w.Header().Set("X-Request-ID", requestID)
+	events, ctx, ok := s.Streams.Start(w, r, s.CurrentConfig().Streams)
+	if !ok {
+		return
+	}
+	defer events.Close()
+	if len(chatRequest.Format) > 0 {
+		events.streamJSON()
+	}
+	events.transformAnswer(transforms)
+
+	// StringBuilder do pool
+	contentBuilder := stringBuilderPool.Get().(*strings.Builder)
+	contentBuilder.Reset()
+	defer stringBuilderPool.Put(contentBuilder)
+
+	watchdog, watchedCtx := orus.NewWatchdog(ctx, s.CurrentConfig().Watchdog)
+	defer watchdog.Stop()
+	var last ollama.ChatStreamResponse
+	chatStreamProgressCallback := func(ctx context.Context, chatResp ollama.ChatStreamResponse) error {
+		contentBuilder.WriteString(chatResp.Message.Content)
+		last = chatResp
+		watchdog.Observe(chatResp)
+		// a client that cannot be written to is gone, so the generation
+		// stops, unless the stream can be resumed
+		return events.Chunk(chatResp)
+	}
+
+	// the upstream request is bound to ctx, so it is aborted as soon as the
+	// client goes away for longer than the resume timeout, the route
+	// deadline expires or the watchdog fires
+	err := s.Backend.WithContext(watchedCtx).ChatStreamCloud(*chatRequest, chatStreamProgressCallback)
+	err = canceledCause(watchedCtx, err)
+	switch aborted := watchdog.Aborted(); {
+	case aborted != nil:
+		_ = events.Aborted(aborted)
+		return
+	case ollama.IsCanceled(err):
+		return
+	case errors.Is(err, context.DeadlineExceeded):
+		_ = events.Error("timeout", errors.New("request timed out"))
+		return
+	case err != nil:
+		_ = events.Error(llmErrorCode(err), err)
+		return
+	}
+
+	answer := transformText(transforms, contentBuilder.String())
+	screening = s.Screener.ScreenOutput(ctx, optimizedLLMPath, answer, screening)
+	if screening != nil && screening.Blocked {
+		_ = events.Error("output_blocked", errors.New("the output was blocked by the content policy"))
+		return
+	}
+
+	serial := uuid.New().String()
+	s.recordGeneration(ctx, serial, optimizedLLMPath, chatRequest, answer, startTime)
+	_ = events.Done(DonePayload{
+		Message:          "LLM request completed successfully",
+		Serial:           serial,
+		RequestID:        requestID,
+		Model:            chatRequest.Model,
+		Content:          answer,
+		Think:            chatRequest.Think,
+		PromptTokens:     last.PromptEvalCount,
+		CompletionTokens: last.EvalCount,
+		Screening:        screening,
+		TimeTaken:        time.Since(startTime).String(),
+	})
+}
+
+func (s *OrusAPI) CallLLMOptimized(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	ctx := r.Context()
+
+	requestID := middleware.GetReqID(ctx)
+
+	request, ok := decodeJSON[LLMCloudRequest](w, r)
+	if !ok || !s.resolveImages(w, &request.Body) {
+		return
+	}
+
+	chatRequest := acquireChatRequest(&request.Body)
+	defer releaseChatRequest(chatRequest)
+
+	screening := s.Screener.ScreenInput(ctx, optimizedLLMPath, chatRequest.Messages)
+	if screening != nil && screening.Blocked {
+		respondScreenBlocked(w, orus.ScreenInput, screening)
+		return
+	}
+
+	go logRequest(requestID, chatRequest)
+
+	if chatRequest.Stream {
+		s.handleStreamingResponseChi(w, r, chatRequest, request.Body.Transforms, screening, startTime, requestID)
+	} else {
+		s.handleSyncResponseChi(ctx, w, chatRequest, request.Body.Transforms, screening, startTime, requestID, len(request.Body.RespondAs) > 0)
+	}
+}
+
+// HealthCheck answers 200 while the server runs, with the status "degraded"
+// and the alerts firing when a dependency degrades: restarting Orus would
+// not bring Ollama back.
+func (s *OrusAPI) HealthCheck(w http.ResponseWriter, r *http.Request) {
+	state := s.Monitor.State()
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"status": state.Status,
+		"time":   time.Now().UTC(),
+		"ollama": state.Ollama,
+		"calls":  state.Calls,
+		"alerts": state.Alerts,
+	})
+}
+
+func (s *OrusAPI) handleSyncResponseChi(ctx context.Context, w http.ResponseWriter, chatRequest *ollama.ChatRequest, transforms []string, screening *orus.ScreenReport, startTime time.Time, requestID string, respondAs bool) {
+
+	type result struct {
+		response *ollama.ChatResponse
+		cache    orus.CacheStatus
+		err      error
+	}
+	resultChan := make(chan result, 1)
+
+	go func() {
+		resp, cache, err := s.ResponseCache.Chat("cloud", *chatRequest, s.Backend.WithContext(ctx).ChatCloud)
+		resultChan <- result{resp, cache, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		if errors.Is(context.Cause(ctx), ErrGenerationCanceled) {
+			respondError(w, statusCanceled, "canceled", ErrGenerationCanceled.Error())
+			return
+		}
+		respondError(w, http.StatusRequestTimeout, "timeout", "Request timed out or was cancelled")
+		return
+
+	case res := <-resultChan:
+		setCacheHeader(w, res.cache)
+		if res.err != nil && respondAs && respondFormatFailure(w, res.err) {
+			return
+		}
+		if res.err != nil {
+			response := OrusResponse{
+				Success:   false,
+				Serial:    requestID,
+				Error:     res.err.Error(),
+				Message:   "Error calling LLM",
+				TimeTaken: time.Since(startTime),
+			}
+			respondJSON(w, http.StatusInternalServerError, response)
+			return
+		}
+
+		answer := transformText(transforms, res.response.Message.Content)
+		screening = s.Screener.ScreenOutput(ctx, optimizedLLMPath, answer, screening)
+		if screening != nil && screening.Blocked {
+			respondScreenBlocked(w, orus.ScreenOutput, screening)
+			return
+		}
+
+		serial := uuid.New().String()
+		s.recordGeneration(ctx, serial, optimizedLLMPath, chatRequest, answer, startTime)
+		successData := map[string]interface{}{
+			"success":    true,
+			"message":    "LLM request completed successfully",
+			"content":    answer,
+			"serial":     serial,
+			"request_id": requestID,
+			"time_taken": time.Since(startTime).String(),
+			"model":      chatRequest.Model,
+			"stream":     false,
+			"think":      chatRequest.Think,
+		}
+		if screening != nil {
+			successData["screening"] = screening
+		}
+		if res.cache != "" {
+			successData["cache"] = res.cache
+		}
+		if respondAs {
+			successData["result"] = json.RawMessage(strings.TrimSpace(res.response.Message.Content))
+		}
+		respondJSON(w, http.StatusOK, successData)
+	}
+}
+
+// ==================== Helper Functions ====================
+
+func acquireChatRequest(body *LLMCloudRequestBody) *ollama.ChatRequest {
+	chatRequest := chatRequestPool.Get().(*ollama.ChatRequest)
+	chatRequest.Model = body.Model
+	chatRequest.Messages = append(chatRequest.Messages[:0], body.Messages...)
+	chatRequest.Stream = body.Stream
+	chatRequest.Think = body.Think
+	chatRequest.Format = body.Format
+	chatRequest.Options = body.Options
+	chatRequest.FormatRetries = body.RepairRetries
+	if len(body.Images) > 0 {
+		chatRequest.Images = append(chatRequest.Images[:0], body.Images...)
+	}
+	return chatRequest
+}
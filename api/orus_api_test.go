@@ -0,0 +1,227 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Dsouza10082/orus"
+	"github.com/Dsouza10082/orus/ollama"
+	"github.com/Dsouza10082/orus/orustest"
+)
+
+// testAPI returns the handler of a server answering with backend, keeping
+// its files in a temporary directory.
+func testAPI(t *testing.T, backend *orustest.Backend) http.Handler {
+	t.Helper()
+	return testAPIWith(t, backend, nil)
+}
+
+// testAPIWith is testAPI with the configuration changed by configure.
+func testAPIWith(t *testing.T, backend *orustest.Backend, configure func(*orus.Config)) http.Handler {
+	t.Helper()
+	dir := t.TempDir()
+	config := orus.DefaultConfig()
+	config.Embedder.MemoryPath = filepath.Join(dir, "agent_memory")
+	config.Usage.Dir = filepath.Join(dir, "usage")
+	config.RAG.MediaDir = filepath.Join(dir, "media")
+	// the ONNX embedder and the other optional features fail to load here
+	config.Embedder.MemoryModel = "nomic-embed-text:latest"
+	config.Embedder.SessionModel = "nomic-embed-text:latest"
+	if configure != nil {
+		configure(&config)
+	}
+	s, err := NewOrusAPI(config, WithBackend(backend))
+	if s == nil {
+		t.Fatal(err)
+	}
+	return s.Handler()
+}
+
+func post(t *testing.T, handler http.Handler, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+type sseEvent struct {
+	name string
+	data string
+}
+
+func readEvents(t *testing.T, body string) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	var event sseEvent
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.data = strings.TrimPrefix(line, "data: ")
+		case line == "" && event.name != "":
+			events = append(events, event)
+			event = sseEvent{}
+		}
+	}
+	return events
+}
+
+func TestCallLLM(t *testing.T) {
+	backend := orustest.NewBackend()
+	handler := testAPI(t, backend)
+
+	w := post(t, handler, "/orus-api/v1/call-llm", `{"body":{"model":"llama3.1:8b","messages":[{"role":"user","content":"hello there"}]}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("answered %d: %s", w.Code, w.Body)
+	}
+	var response struct {
+		Success bool   `json:"success"`
+		Content string `json:"content"`
+		Model   string `json:"model"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if !response.Success || response.Content != "hello there" || response.Model != "llama3.1:8b" {
+		t.Fatalf("answered %+v, want the echo of the prompt", response)
+	}
+	if requests := backend.Requests(); len(requests) != 1 || requests[0].Model != "llama3.1:8b" {
+		t.Fatalf("backend received %+v", requests)
+	}
+
+	backend.SetReply("a fixed reply")
+	w = post(t, handler, "/orus-api/v1/call-llm", `{"body":{"model":"llama3.1:8b","messages":[{"role":"user","content":"something else"}]}}`)
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Content != "a fixed reply" {
+		t.Fatalf("answered %q, want the reply of the backend", response.Content)
+	}
+}
+
+func TestCallLLMInvalidBody(t *testing.T) {
+	handler := testAPI(t, orustest.NewBackend())
+	if w := post(t, handler, "/orus-api/v1/call-llm", `{"body":`); w.Code != http.StatusBadRequest {
+		t.Fatalf("malformed body answered %d, want 400", w.Code)
+	}
+}
+
+func TestCallLLMStream(t *testing.T) {
+	backend := orustest.NewBackend()
+	handler := testAPI(t, backend)
+
+	w := post(t, handler, "/orus-api/v1/call-llm", `{"body":{"model":"llama3.1:8b","stream":true,"messages":[{"role":"user","content":"stream these few words"}]}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("answered %d: %s", w.Code, w.Body)
+	}
+	if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/event-stream") {
+		t.Fatalf("answered %s, want an event stream", contentType)
+	}
+	events := readEvents(t, w.Body.String())
+	var content strings.Builder
+	var names []string
+	for _, event := range events {
+		names = append(names, event.name)
+		if event.name == string(EventToken) {
+			var token TokenPayload
+			if err := json.Unmarshal([]byte(event.data), &token); err != nil {
+				t.Fatal(err)
+			}
+			content.WriteString(token.Content)
+		}
+	}
+	if content.String() != "stream these few words" {
+		t.Fatalf("streamed %q, want the echo of the prompt", content.String())
+	}
+	if len(names) < 2 || names[len(names)-1] != string(EventDone) || !slices.Contains(names, string(EventUsage)) {
+		t.Fatalf("streamed the events %v, want the tokens, usage and done", names)
+	}
+	var done DonePayload
+	if err := json.Unmarshal([]byte(events[len(events)-1].data), &done); err != nil {
+		t.Fatal(err)
+	}
+	if done.Content != "stream these few words" || done.Model != "llama3.1:8b" {
+		t.Fatalf("done with %+v", done)
+	}
+}
+
+func TestCallLLMStreamError(t *testing.T) {
+	backend := orustest.NewBackend()
+	handler := testAPI(t, backend)
+	backend.SetError(ollama.ErrOllamaUnavailable)
+
+	w := post(t, handler, "/orus-api/v1/call-llm", `{"body":{"model":"llama3.1:8b","stream":true,"messages":[{"role":"user","content":"hello"}]}}`)
+	events := readEvents(t, w.Body.String())
+	if len(events) == 0 || events[len(events)-1].name != string(EventError) {
+		t.Fatalf("streamed %v, want an error event", events)
+	}
+}
+
+func TestEmbedText(t *testing.T) {
+	backend := orustest.NewBackend()
+	handler := testAPI(t, backend)
+
+	w := post(t, handler, "/orus-api/v1/embed-text", `{"model":"nomic-embed-text:latest","text":"embed this text"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("answered %d: %s", w.Code, w.Body)
+	}
+	var response struct {
+		Success bool `json:"success"`
+		Data    struct {
+			Vector     []float64 `json:"vector"`
+			Dimensions int       `json:"dimensions"`
+			Model      string    `json:"model"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if !response.Success || response.Data.Dimensions != orustest.DefaultDimensions || len(response.Data.Vector) != orustest.DefaultDimensions {
+		t.Fatalf("answered %+v", response)
+	}
+	if embedded := backend.Embedded(); !slices.Contains(embedded, "embed this text") {
+		t.Fatalf("backend embedded %v", embedded)
+	}
+
+	// the same text is embedded to the same vector
+	again := post(t, handler, "/orus-api/v1/embed-text", `{"model":"nomic-embed-text:latest","text":"embed this text"}`)
+	var second struct {
+		Data struct {
+			Vector []float64 `json:"vector"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(again.Body.Bytes(), &second); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(response.Data.Vector, second.Data.Vector) {
+		t.Fatal("the same text was embedded to different vectors")
+	}
+}
+
+func TestEmbedTextUnknownModel(t *testing.T) {
+	handler := testAPI(t, orustest.NewBackend())
+	w := post(t, handler, "/orus-api/v1/embed-text", `{"model":"no-such-model","text":"hello"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("answered %d, want 400", w.Code)
+	}
+	var response struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Error != "invalid_model" {
+		t.Fatalf("answered the code %q, want invalid_model", response.Error)
+	}
+}
@@ -0,0 +1,251 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"unicode/utf8"
+)
+
+// errPartialJSON is returned once the streamed reply is not JSON.
+var errPartialJSON = errors.New("the reply is not JSON")
+
+// The states of the containers open in a partial JSON document.
+const (
+	// an object expects its first key or its end
+	objectFirst = iota
+	// an object expects a key, after a comma
+	objectKey
+	objectColon
+	objectValue
+	// an object expects a comma or its end
+	objectNext
+	arrayFirst
+	arrayValue
+	arrayNext
+)
+
+// partialJSON parses a JSON document as its pieces are streamed, and closes
+// what was read so far into a well-formed value: the strings, arrays and
+// objects left open are closed, and a key without its value, or a number or
+// literal still being read, is left out. A string value is shown as far as
+// it was read. Each piece is only scanned once.
+type partialJSON struct {
+	buf    []byte
+	states []int
+	// inString is set within a string, and inKey within an object key
+	inString bool
+	inKey    bool
+	// escape is where an escape being read starts, or -1; hex counts the
+	// digits left of a \u escape
+	escape int
+	hex    int
+	// scalar is where the number or literal being read starts, or -1
+	scalar int
+	// safe is the length of buf that the closers make well-formed
+	safe    int
+	closers []byte
+	ended   bool
+	failed  bool
+	last    []byte
+}
+
+func newPartialJSON() *partialJSON {
+	return &partialJSON{escape: -1, scalar: -1}
+}
+
+// Write reads a piece of the document and returns the value read so far
+// when it changed, or nil. It returns errPartialJSON once the document is
+// not JSON, and then buf holds the pieces written.
+func (p *partialJSON) Write(piece string) (json.RawMessage, error) {
+	if p.failed {
+		return nil, errPartialJSON
+	}
+	for i := 0; i < len(piece); i++ {
+		p.buf = append(p.buf, piece[i])
+		if !p.step(piece[i]) {
+			// buf keeps the whole reply, for the caller to go on with
+			p.buf = append(p.buf, piece[i+1:]...)
+			p.failed = true
+			return nil, errPartialJSON
+		}
+	}
+	value := p.value()
+	if value == nil || slices.Equal(value, p.last) || !json.Valid(value) {
+		return nil, nil
+	}
+	p.last = value
+	return value, nil
+}
+
+// step reads c, the last byte of buf, and reports whether the document is
+// still JSON.
+func (p *partialJSON) step(c byte) bool {
+	if p.inString {
+		switch {
+		case p.hex > 0:
+			if p.hex--; p.hex == 0 {
+				p.escape = -1
+			}
+		case p.escape >= 0:
+			if c == 'u' {
+				p.hex = 4
+			} else {
+				p.escape = -1
+			}
+		case c == '\\':
+			p.escape = len(p.buf) - 1
+		case c == '"':
+			p.inString = false
+			if p.inKey {
+				p.inKey = false
+				p.states[len(p.states)-1] = objectColon
+				return true
+			}
+			p.valueEnded()
+		}
+		return true
+	}
+	if p.scalar >= 0 {
+		if isScalarByte(c) {
+			return true
+		}
+		if !json.Valid(p.buf[p.scalar : len(p.buf)-1]) {
+			return false
+		}
+		p.scalar = -1
+		p.valueEnded()
+		// c, which ended the scalar, is read below
+		p.safe--
+	}
+	if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+		return true
+	}
+	if p.ended {
+		return false
+	}
+	state := -1
+	if len(p.states) > 0 {
+		state = p.states[len(p.states)-1]
+	}
+	switch state {
+	case objectFirst, objectKey:
+		if c == '"' {
+			p.inString, p.inKey = true, true
+			return true
+		}
+		if c == '}' && state == objectFirst {
+			p.closeContainer()
+			return true
+		}
+		return false
+	case objectColon:
+		if c != ':' {
+			return false
+		}
+		p.states[len(p.states)-1] = objectValue
+		return true
+	case objectNext, arrayNext:
+		switch {
+		case c == ',' && state == objectNext:
+			p.states[len(p.states)-1] = objectKey
+		case c == ',':
+			p.states[len(p.states)-1] = arrayValue
+		case c == '}' && state == objectNext, c == ']' && state == arrayNext:
+			p.closeContainer()
+		default:
+			return false
+		}
+		return true
+	case arrayFirst:
+		if c == ']' {
+			p.closeContainer()
+			return true
+		}
+	}
+	// a value is expected
+	switch {
+	case c == '{':
+		p.openContainer(objectFirst)
+	case c == '[':
+		p.openContainer(arrayFirst)
+	case c == '"':
+		p.inString = true
+	case c == '-' || (c >= '0' && c <= '9') || c == 't' || c == 'f' || c == 'n':
+		p.scalar = len(p.buf) - 1
+	default:
+		return false
+	}
+	return true
+}
+
+func isScalarByte(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || c == '.' || c == '+' || c == '-' || c == 'E'
+}
+
+func (p *partialJSON) openContainer(state int) {
+	p.states = append(p.states, state)
+	p.mark()
+}
+
+func (p *partialJSON) closeContainer() {
+	p.states = p.states[:len(p.states)-1]
+	p.valueEnded()
+}
+
+// valueEnded moves the container of the value that ended to its next
+// state, or ends the document.
+func (p *partialJSON) valueEnded() {
+	if len(p.states) == 0 {
+		p.ended = true
+	} else if p.states[len(p.states)-1] < arrayFirst {
+		p.states[len(p.states)-1] = objectNext
+	} else {
+		p.states[len(p.states)-1] = arrayNext
+	}
+	p.mark()
+}
+
+// mark records buf as well-formed once its containers are closed.
+func (p *partialJSON) mark() {
+	p.safe = len(p.buf)
+	p.closers = p.closing(p.closers[:0])
+}
+
+// closing appends the ends of the open containers to closers.
+func (p *partialJSON) closing(closers []byte) []byte {
+	for i := len(p.states) - 1; i >= 0; i-- {
+		if p.states[i] < arrayFirst {
+			closers = append(closers, '}')
+		} else {
+			closers = append(closers, ']')
+		}
+	}
+	return closers
+}
+
+// value returns the document read so far, well-formed, or nil before its
+// first value.
+func (p *partialJSON) value() json.RawMessage {
+	if p.inString && !p.inKey {
+		// a string value is cut where it was read, but not within an
+		// escape or a rune
+		text := p.buf
+		if p.escape >= 0 {
+			text = text[:p.escape]
+		}
+		for i := len(text) - 1; i >= 0 && i >= len(text)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(text[i]) {
+				if !utf8.FullRune(text[i:]) {
+					text = text[:i]
+				}
+				break
+			}
+		}
+		return p.closing(slices.Concat(text, []byte{'"'}))
+	}
+	if p.safe == 0 {
+		return nil
+	}
+	return slices.Concat(p.buf[:p.safe], p.closers)
+}
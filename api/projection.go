@@ -0,0 +1,78 @@
+package api
+
+import (
+	"math"
+)
+
+const projectionIterations = 100
+
+// ProjectPCA projects vectors onto their first dims principal components.
+// Components are found by power iteration with deflation, which avoids
+// building the covariance matrix of high-dimensional embeddings.
+func ProjectPCA(vectors [][]float64, dims int) [][]float64 {
+	projected := make([][]float64, len(vectors))
+	for i := range projected {
+		projected[i] = make([]float64, dims)
+	}
+	if len(vectors) == 0 {
+		return projected
+	}
+	size := len(vectors[0])
+
+	mean := make([]float64, size)
+	for _, vector := range vectors {
+		for j, value := range vector {
+			mean[j] += value
+		}
+	}
+	for j := range mean {
+		mean[j] /= float64(len(vectors))
+	}
+	centered := make([][]float64, len(vectors))
+	for i, vector := range vectors {
+		centered[i] = make([]float64, size)
+		for j, value := range vector {
+			centered[i][j] = value - mean[j]
+		}
+	}
+
+	for d := 0; d < dims; d++ {
+		component := make([]float64, size)
+		for j := range component {
+			component[j] = 1 / math.Sqrt(float64(size)+float64(j+d))
+		}
+		for iteration := 0; iteration < projectionIterations; iteration++ {
+			next := make([]float64, size)
+			for _, row := range centered {
+				score := dot(row, component)
+				for j, value := range row {
+					next[j] += score * value
+				}
+			}
+			norm := math.Sqrt(dot(next, next))
+			if norm == 0 {
+				break
+			}
+			for j := range next {
+				next[j] /= norm
+			}
+			component = next
+		}
+		for i, row := range centered {
+			score := dot(row, component)
+			projected[i][d] = score
+			for j := range row {
+				row[j] -= score * component[j]
+			}
+		}
+	}
+	return projected
+}
+
+func dot(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
@@ -0,0 +1,250 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/Dsouza10082/orus"
+	"github.com/Dsouza10082/orus/ollama"
+	"github.com/starfederation/datastar-go/datastar"
+)
+
+// pageSessionPattern is what the prompt page may send as its session.
+var pageSessionPattern = regexp.MustCompile(`^[A-Za-z0-9-]{1,64}$`)
+
+// PromptRuns keeps the streaming generations of the prompt page by page
+// session, the ID a browser tab keeps in its session storage, so a reload
+// in the middle of a generation re-attaches to it and shows its output so
+// far instead of losing it. A run is a resumable stream of StreamBuffers,
+// owned by the UI user of the cookie: it goes on without a page for the
+// resume timeout, and is kept for as long once it ended.
+type PromptRuns struct {
+	streams *StreamBuffers
+
+	mu   sync.Mutex
+	runs map[string]*promptRun
+}
+
+// promptRun is a generation of the prompt page. Its pieces are buffered as
+// thinking and token events, and the output so far is kept whole, for a
+// page that re-attaches after the events it missed were dropped.
+type promptRun struct {
+	buffer *streamBuffer
+	prompt string
+	model  string
+
+	mu       sync.Mutex
+	seq      int64
+	thinking strings.Builder
+	content  strings.Builder
+	failure  string
+}
+
+func NewPromptRuns(streams *StreamBuffers) *PromptRuns {
+	return &PromptRuns{streams: streams, runs: make(map[string]*promptRun)}
+}
+
+// promptStreamID is the stream of the runs of a page session.
+func promptStreamID(pageSession string) string {
+	return "prompt-" + pageSession
+}
+
+// promptOwner is the digest of the UI user of r, the only one that may
+// re-attach to its runs.
+func promptOwner(w http.ResponseWriter, r *http.Request) [sha256.Size]byte {
+	return sha256.Sum256([]byte(uiUserID(w, r)))
+}
+
+// start registers the run of the page session of signals, stopping the one
+// it replaces, and returns the context the generation runs with. Without a
+// resume timeout or a page session, or for a stream rejected over the
+// stream limits, it returns a nil run, which records nothing, and the
+// context of r.
+func (p *PromptRuns) start(w http.ResponseWriter, r *http.Request, signals *PromptSignals, config orus.StreamConfig) (*promptRun, context.Context) {
+	if config.ResumeTimeout <= 0 || !pageSessionPattern.MatchString(signals.PageSession) || streamRejected(r) {
+		return nil, r.Context()
+	}
+	id := promptStreamID(signals.PageSession)
+	run := &promptRun{prompt: signals.Prompt, model: signals.Model}
+	buffer, ctx := p.streams.open(id, promptOwner(w, r), r, config, func() {
+		p.mu.Lock()
+		if p.runs[id] == run {
+			delete(p.runs, id)
+		}
+		p.mu.Unlock()
+	})
+	run.buffer = buffer
+	p.mu.Lock()
+	previous := p.runs[id]
+	p.runs[id] = run
+	p.mu.Unlock()
+	if previous != nil {
+		previous.buffer.cancel()
+	}
+	return run, ctx
+}
+
+// get returns the run of pageSession when it belongs to the UI user of r.
+func (p *PromptRuns) get(w http.ResponseWriter, r *http.Request, pageSession string) *promptRun {
+	if !pageSessionPattern.MatchString(pageSession) {
+		return nil
+	}
+	id := promptStreamID(pageSession)
+	p.mu.Lock()
+	run := p.runs[id]
+	p.mu.Unlock()
+	if run == nil || p.streams.lookup(id, promptOwner(w, r)) != run.buffer {
+		return nil
+	}
+	return run
+}
+
+// add records the pieces of a chunk.
+func (run *promptRun) add(thinking, content string) {
+	if run == nil {
+		return
+	}
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	if thinking != "" {
+		run.thinking.WriteString(thinking)
+		run.record(EventThinking, func(seq int64) interface{} {
+			return ThinkingPayload{Seq: seq, Content: thinking}
+		})
+	}
+	if content != "" {
+		run.content.WriteString(content)
+		run.record(EventToken, func(seq int64) interface{} {
+			return TokenPayload{Seq: seq, Content: content}
+		})
+	}
+}
+
+// record buffers an event. It must be called with mu held.
+func (run *promptRun) record(event StreamEvent, payload func(seq int64) interface{}) {
+	run.seq++
+	data, err := json.Marshal(payload(run.seq))
+	if err != nil {
+		log.Printf("Error encoding %s event: %v", event, err)
+		return
+	}
+	run.buffer.add(bufferedEvent{seq: run.seq, event: event, data: data})
+}
+
+// end ends the run with the error of its generation, so the pages following
+// it stop.
+func (run *promptRun) end(err error) {
+	if run == nil {
+		return
+	}
+	run.mu.Lock()
+	if err != nil && !ollama.IsCanceled(err) {
+		run.failure = fmt.Sprintf("ChatStream error: %v", err)
+	}
+	run.mu.Unlock()
+	run.buffer.end()
+}
+
+// snapshot returns the output so far, the seq of its last event and the
+// failure of the run.
+func (run *promptRun) snapshot() (int64, string, string, string) {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	return run.seq, run.thinking.String(), run.content.String(), run.failure
+}
+
+// PromptResumeStream is a handler for the prompt/resume endpoint
+// It re-attaches a reloaded prompt page to the generation of its page
+// session: it patches the prompt and the output so far, then follows the
+// generation until it ends
+func (s *OrusAPI) PromptResumeStream(w http.ResponseWriter, r *http.Request) {
+	signals := &PromptSignals{}
+	if err := datastar.ReadSignals(r, signals); err != nil {
+		log.Printf("PromptResumeStream: failed to read signals: %v", err)
+		http.Error(w, "failed to read signals", http.StatusBadRequest)
+		return
+	}
+	run := s.Prompts.get(w, r, signals.PageSession)
+	sse := datastar.NewSSE(w, r)
+	if run == nil {
+		return
+	}
+	run.buffer.attach()
+	defer run.buffer.detach()
+
+	signals.Prompt = run.prompt
+	signals.Model = run.model
+	signals.Images = nil
+	signals.ImageError = ""
+	thinking := &strings.Builder{}
+	content := &strings.Builder{}
+	patch := func() error {
+		tagged, answer := orus.SplitThinking(content.String())
+		signals.Thinking = thinking.String() + tagged
+		signals.Result = answer
+		return sse.MarshalAndPatchSignals(signals)
+	}
+	batch := newChunkBatch(s.CurrentConfig().Streams)
+	var seq int64
+	synced := false
+	for {
+		missed, ended, changed := run.buffer.since(seq)
+		if !synced || (len(missed) > 0 && missed[0].seq != seq+1) {
+			// the output so far, and again when the events the page missed
+			// were dropped from the buffer
+			var thought, said string
+			seq, thought, said, _ = run.snapshot()
+			thinking.Reset()
+			thinking.WriteString(thought)
+			content.Reset()
+			content.WriteString(said)
+			synced = true
+			if err := patch(); err != nil {
+				return
+			}
+			continue
+		}
+		chars := 0
+		for _, event := range missed {
+			var payload TokenPayload
+			if err := json.Unmarshal(event.data, &payload); err != nil {
+				continue
+			}
+			if event.event == EventThinking {
+				thinking.WriteString(payload.Content)
+			} else {
+				content.WriteString(payload.Content)
+			}
+			chars += utf8.RuneCountInString(payload.Content)
+			seq = event.seq
+		}
+		if batch.add(chars) {
+			if err := patch(); err != nil {
+				return
+			}
+		}
+		if ended {
+			if batch.flush() {
+				_ = patch()
+			}
+			if _, _, _, failure := run.snapshot(); failure != "" {
+				_ = sse.ConsoleError(errors.New(failure))
+			}
+			return
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
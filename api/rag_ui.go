@@ -0,0 +1,236 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Dsouza10082/orus"
+	"github.com/Dsouza10082/orus/ollama"
+	"github.com/Dsouza10082/orus/view"
+	"github.com/starfederation/datastar-go/datastar"
+)
+
+// RAGHandler is a handler for the RAG playground page
+// It renders the indexed documents and the retrieval form
+func (s *OrusAPI) RAGHandler(w http.ResponseWriter, r *http.Request) {
+	models, err := s.Backend.ListModels()
+	if err != nil {
+		log.Printf("RAGHandler: failed to list models: %v", err)
+		http.Error(w, "failed to list models", http.StatusInternalServerError)
+		return
+	}
+	initial := view.RAGSignals{
+		ChunkSize:    orus.DefaultChunkSize,
+		ChunkOverlap: orus.DefaultChunkOverlap,
+		EmbedModel:   orus.DefaultRAGEmbedModel,
+		Limit:        orus.DefaultRAGLimit,
+		Model:        "llama3.1:8b",
+	}
+	if err := view.NewView().SetModels(models).RenderRAG(w, initial, s.ragChunks(""), s.WebSearch != nil); err != nil {
+		log.Printf("RAGHandler: failed to render RAG playground: %v", err)
+		http.Error(w, "failed to render page", http.StatusInternalServerError)
+	}
+}
+
+// RAGIndexStream is a handler for the rag/index endpoint
+// It chunks and embeds the submitted document and shows the resulting chunks
+func (s *OrusAPI) RAGIndexStream(w http.ResponseWriter, r *http.Request) {
+	signals := &view.RAGSignals{}
+	if err := datastar.ReadSignals(r, signals); err != nil {
+		log.Printf("RAGIndexStream: failed to read signals: %v", err)
+		http.Error(w, "failed to read signals", http.StatusBadRequest)
+		return
+	}
+
+	sse := datastar.NewSSE(w, r)
+
+	if strings.TrimSpace(signals.Document) == "" {
+		_ = sse.ConsoleError(fmt.Errorf("document is empty"))
+		return
+	}
+	source := strings.TrimSpace(signals.Source)
+	if source == "" {
+		source = "untitled"
+	}
+	model := signals.EmbedModel
+	if model == "" {
+		model = orus.DefaultRAGEmbedModel
+	}
+
+	if _, err := s.Documents.Index(source, signals.Document, model, signals.ChunkSize, signals.ChunkOverlap); err != nil {
+		_ = sse.ConsoleError(fmt.Errorf("indexing error: %w", err))
+		return
+	}
+
+	html, err := view.RenderRAGChunks(s.ragChunks(source))
+	if err != nil {
+		_ = sse.ConsoleError(err)
+		return
+	}
+	_ = sse.PatchElements(html)
+}
+
+// RAGAskStream is a handler for the rag/ask endpoint
+// It shows the retrieved chunks with their similarity and streams the answer built from them
+func (s *OrusAPI) RAGAskStream(w http.ResponseWriter, r *http.Request) {
+	signals := &view.RAGSignals{}
+	if err := datastar.ReadSignals(r, signals); err != nil {
+		log.Printf("RAGAskStream: failed to read signals: %v", err)
+		http.Error(w, "failed to read signals", http.StatusBadRequest)
+		return
+	}
+
+	sse := datastar.NewSSE(w, r)
+
+	if strings.TrimSpace(signals.Question) == "" {
+		return
+	}
+	if signals.EmbedModel == "" {
+		signals.EmbedModel = orus.DefaultRAGEmbedModel
+	}
+	if signals.Model == "" {
+		signals.Model = "llama3.1:8b"
+	}
+
+	var results []orus.SearchResult
+	var err error
+	if signals.WebSearch && s.WebSearch != nil {
+		webSearch := s.CurrentConfig().WebSearch
+		results, err = s.Documents.RetrieveWithWeb(r.Context(), s.WebSearch, signals.Question, signals.EmbedModel,
+			signals.Limit, webSearch.Results, webSearch.Index)
+	} else {
+		results, err = s.Documents.Retrieve(signals.Question, signals.EmbedModel, signals.Limit)
+	}
+	if err != nil {
+		_ = sse.ConsoleError(fmt.Errorf("retrieval error: %w", err))
+		return
+	}
+
+	retrieved := make([]view.RAGChunk, 0, len(results))
+	for _, result := range results {
+		chunk := ragChunk(result.Document)
+		chunk.Similarity = result.Similarity
+		retrieved = append(retrieved, chunk)
+	}
+	html, err := view.RenderRAGRetrieved(retrieved)
+	if err != nil {
+		_ = sse.ConsoleError(err)
+		return
+	}
+	_ = sse.PatchElements(html)
+
+	signals.Answer = ""
+	if err := sse.MarshalAndPatchSignals(signals); err != nil {
+		_ = sse.ConsoleError(fmt.Errorf("failed to clear answer: %w", err))
+		return
+	}
+	if len(results) == 0 {
+		signals.Answer = "No chunks were retrieved for the selected embedding model."
+		_ = sse.MarshalAndPatchSignals(signals)
+		return
+	}
+
+	var images []string
+	if max := s.CurrentConfig().RAG.MaxImages; max > 0 {
+		images = s.Documents.Images(results, max)
+		if len(images) > 0 && !s.supportsVision(r.Context(), signals.Model) {
+			images = nil
+		}
+	}
+	patch := func() {
+		if err := sse.MarshalAndPatchSignals(signals); err != nil {
+			_ = sse.ConsoleError(fmt.Errorf("failed to patch signals: %w", err))
+		}
+	}
+	batch := newChunkBatch(s.CurrentConfig().Streams)
+	err = s.Backend.WithContext(r.Context()).ChatStream(ollama.ChatRequest{
+		Model:    signals.Model,
+		Messages: orus.RAGMessages(signals.Question, results, images),
+		Stream:   true,
+	}, func(ctx context.Context, chunk ollama.ChatStreamResponse) error {
+		if sse.IsClosed() {
+			return context.Canceled
+		}
+		if chunk.Message.Content == "" {
+			return nil
+		}
+		signals.Answer += chunk.Message.Content
+		if batch.add(utf8.RuneCountInString(chunk.Message.Content)) {
+			patch()
+		}
+		return nil
+	})
+	if batch.flush() && !sse.IsClosed() {
+		patch()
+	}
+	if err != nil && !ollama.IsCanceled(err) {
+		_ = sse.ConsoleError(fmt.Errorf("ChatStream error: %w", err))
+	}
+}
+
+// supportsVision reports whether model accepts images. A model whose
+// capabilities cannot be read is taken as text only.
+func (s *OrusAPI) supportsVision(ctx context.Context, model string) bool {
+	capabilities, err := s.Backend.WithContext(ctx).Capabilities(model)
+	if err != nil {
+		log.Printf("Error reading the capabilities of %s: %v", model, err)
+		return false
+	}
+	return slices.Contains(capabilities, "vision")
+}
+
+// RAGClearStream is a handler for the rag/clear endpoint
+// It removes every indexed document from the playground
+func (s *OrusAPI) RAGClearStream(w http.ResponseWriter, r *http.Request) {
+	sse := datastar.NewSSE(w, r)
+	s.Documents.Clear()
+	html, err := view.RenderRAGChunks(s.ragChunks(""))
+	if err != nil {
+		_ = sse.ConsoleError(err)
+		return
+	}
+	_ = sse.PatchElements(html)
+	html, err = view.RenderRAGRetrieved([]view.RAGChunk{})
+	if err != nil {
+		_ = sse.ConsoleError(err)
+		return
+	}
+	_ = sse.PatchElements(html)
+}
+
+// ragChunks lists the indexed sources with the chunks of source.
+func (s *OrusAPI) ragChunks(source string) view.RAGChunks {
+	indexed := view.RAGChunks{
+		Source:  source,
+		Sources: make([]view.RAGSource, 0),
+		Chunks:  make([]view.RAGChunk, 0),
+	}
+	for _, entry := range s.Documents.Sources() {
+		indexed.Sources = append(indexed.Sources, view.RAGSource{
+			Source: entry.Source,
+			Model:  entry.Model,
+			Chunks: entry.Chunks,
+		})
+	}
+	if source != "" {
+		for _, document := range s.Documents.Chunks(source) {
+			indexed.Chunks = append(indexed.Chunks, ragChunk(document))
+		}
+	}
+	return indexed
+}
+
+func ragChunk(document orus.Document) view.RAGChunk {
+	source, _ := document.Metadata["source"].(string)
+	return view.RAGChunk{
+		ID:      document.ID,
+		Source:  source,
+		Number:  orus.ChunkNumber(document) + 1,
+		Content: document.Content,
+	}
+}
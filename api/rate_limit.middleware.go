@@ -0,0 +1,100 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Dsouza10082/orus"
+)
+
+// RateLimiter counts the REST API requests of each caller in fixed
+// windows and rejects those above the limit of the window. With Redis the
+// counters are shared, so the limit holds across the replicas.
+type RateLimiter struct {
+	redis *orus.RedisClient
+
+	mu     sync.Mutex
+	policy orus.RateLimitPolicy
+	window int64
+	counts map[string]int64
+}
+
+func NewRateLimiter(policy orus.RateLimitPolicy, redis *orus.RedisClient) *RateLimiter {
+	return &RateLimiter{redis: redis, policy: policy, counts: make(map[string]int64)}
+}
+
+// SetPolicy applies a new limit from the next request on.
+func (l *RateLimiter) SetPolicy(policy orus.RateLimitPolicy) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.policy = policy
+	l.counts = make(map[string]int64)
+}
+
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.mu.Lock()
+		policy := l.policy
+		l.mu.Unlock()
+		if policy.Requests <= 0 || !strings.HasPrefix(r.URL.Path, apiPathPrefix) || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		count, reset, err := l.take(policy, fairnessKey(r))
+		if err != nil {
+			// a limit that cannot be counted lets the requests through
+			log.Println("Error counting the rate limit: ", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		resetSeconds := int(math.Ceil(reset.Seconds()))
+		if resetSeconds < 1 {
+			resetSeconds = 1
+		}
+		remaining := int64(policy.Requests) - count
+		if remaining < 0 {
+			remaining = 0
+		}
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(policy.Requests))
+		w.Header().Set("X-RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+		w.Header().Set("X-RateLimit-Reset", strconv.Itoa(resetSeconds))
+		if count > int64(policy.Requests) {
+			w.Header().Set("Retry-After", strconv.Itoa(resetSeconds))
+			respondError(w, http.StatusTooManyRequests, "rate_limited",
+				fmt.Sprintf("More than %d requests in %s, please retry later", policy.Requests, policy.Window))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// take counts a request of caller and returns the count of its window and
+// the time left in it.
+func (l *RateLimiter) take(policy orus.RateLimitPolicy, caller string) (int64, time.Duration, error) {
+	window := policy.Window
+	if window <= 0 {
+		window = orus.DefaultRateLimitWindow
+	}
+	now := time.Now()
+	index := now.UnixNano() / int64(window)
+	reset := time.Unix(0, (index+1)*int64(window)).Sub(now)
+	if l.redis != nil {
+		count, _, err := l.redis.Incr(l.redis.Key("rate", caller, strconv.FormatInt(index, 10)), reset+time.Second)
+		return count, reset, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if index != l.window {
+		// the counters of the previous window are of no use anymore
+		l.window = index
+		l.counts = make(map[string]int64)
+	}
+	l.counts[caller]++
+	return l.counts[caller], reset, nil
+}
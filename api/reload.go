@@ -0,0 +1,241 @@
+package api
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+
+	"github.com/Dsouza10082/orus"
+	"github.com/Dsouza10082/orus/ollama"
+)
+
+// ConfigReload reports what a reload changed.
+type ConfigReload struct {
+	// Applied lists the settings now in effect.
+	Applied []string `json:"applied"`
+	// RestartRequired lists the changed settings that only take effect after
+	// a restart; they keep their current value until then.
+	RestartRequired []string `json:"restart_required"`
+}
+
+// Reload loads the configuration again and applies the settings that can
+// change at runtime: the Ollama Cloud API key, the format retries, the
+// allowed local models and their aliases, the admission and stream limits, the
+// similarity kernel, the search sharding, the screening rules, the tools
+// and their rounds, the workflows, the agents, the watchdog, the stream
+// resumption and batching, the OCR, the RAG captions and images, the image generation,
+// the video sampling and the session TTL. A configuration that does not validate is rejected as a
+// whole and nothing changes.
+func (s *OrusAPI) Reload() (*ConfigReload, error) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	loaded, err := orus.LoadConfig("")
+	if err != nil {
+		return nil, err
+	}
+	current := s.CurrentConfig()
+	reload := &ConfigReload{Applied: make([]string, 0), RestartRequired: make([]string, 0)}
+
+	// the Ollama settings do not apply to a backend of another kind
+	if client, ok := ollama.ClientOf(s.Backend); ok {
+		if loaded.Ollama.APIKey != current.Ollama.APIKey {
+			client.SetAPIKey(loaded.Ollama.APIKey.Reveal())
+			current.Ollama.APIKey = loaded.Ollama.APIKey
+			reload.Applied = append(reload.Applied, "ollama.api_key")
+		}
+		if loaded.Ollama.FormatRetries != current.Ollama.FormatRetries {
+			client.SetFormatRetries(loaded.Ollama.FormatRetries)
+			current.Ollama.FormatRetries = loaded.Ollama.FormatRetries
+			reload.Applied = append(reload.Applied, "ollama.format_retries")
+		}
+		if !reflect.DeepEqual(loaded.Ollama.Models, current.Ollama.Models) {
+			client.SetModels(loaded.Ollama.Models)
+			current.Ollama.Models = loaded.Ollama.Models
+			reload.Applied = append(reload.Applied, "ollama.models")
+		}
+		if !reflect.DeepEqual(loaded.Ollama.Aliases, current.Ollama.Aliases) {
+			client.SetAliases(loaded.Ollama.Aliases)
+			current.Ollama.Aliases = loaded.Ollama.Aliases
+			reload.Applied = append(reload.Applied, "ollama.aliases")
+		}
+	}
+	if loaded.Limits.Generation != current.Limits.Generation {
+		s.GenerationAdmission.SetPolicy(loaded.Limits.Generation)
+		current.Limits.Generation = loaded.Limits.Generation
+		reload.Applied = append(reload.Applied, "limits.generation")
+	}
+	if loaded.Limits.Embedding != current.Limits.Embedding {
+		s.EmbeddingAdmission.SetPolicy(loaded.Limits.Embedding)
+		current.Limits.Embedding = loaded.Limits.Embedding
+		reload.Applied = append(reload.Applied, "limits.embedding")
+	}
+	if loaded.Limits.Rate != current.Limits.Rate {
+		s.RateLimiter.SetPolicy(loaded.Limits.Rate)
+		current.Limits.Rate = loaded.Limits.Rate
+		reload.Applied = append(reload.Applied, "limits.rate")
+	}
+	if loaded.Limits.Streams != current.Limits.Streams {
+		s.StreamConnections.SetPolicy(loaded.Limits.Streams)
+		current.Limits.Streams = loaded.Limits.Streams
+		reload.Applied = append(reload.Applied, "limits.streams")
+	}
+	if loaded.Search.Kernel != current.Search.Kernel {
+		if _, err := orus.UseSimilarityKernel(loaded.Search.Kernel); err != nil {
+			log.Println("Error selecting similarity kernel, keeping the current one: ", err)
+		} else {
+			current.Search.Kernel = loaded.Search.Kernel
+			reload.Applied = append(reload.Applied, "search.kernel")
+		}
+	}
+	if loaded.Search.Shards != current.Search.Shards || loaded.Search.Parallelism != current.Search.Parallelism ||
+		loaded.Search.MinShardSize != current.Search.MinShardSize {
+		current.Search.Shards = loaded.Search.Shards
+		current.Search.Parallelism = loaded.Search.Parallelism
+		current.Search.MinShardSize = loaded.Search.MinShardSize
+		s.VectorStore.SetSearch(current.Search)
+		reload.Applied = append(reload.Applied, "search.sharding")
+	}
+	if loaded.Tools.MaxRounds != current.Tools.MaxRounds {
+		current.Tools.MaxRounds = loaded.Tools.MaxRounds
+		reload.Applied = append(reload.Applied, "tools.max_rounds")
+	}
+	if loaded.Debug.Capture != current.Debug.Capture {
+		current.Debug.Capture = loaded.Debug.Capture
+		reload.Applied = append(reload.Applied, "debug.capture")
+	}
+	if !reflect.DeepEqual(loaded.Cost, current.Cost) {
+		current.Cost = loaded.Cost
+		reload.Applied = append(reload.Applied, "cost")
+	}
+	if loaded.SlowLog != current.SlowLog {
+		s.SlowRequests.SetConfig(loaded.SlowLog)
+		current.SlowLog = loaded.SlowLog
+		reload.Applied = append(reload.Applied, "slow_log")
+	}
+	if loaded.Watchdog != current.Watchdog {
+		current.Watchdog = loaded.Watchdog
+		reload.Applied = append(reload.Applied, "watchdog")
+	}
+	if loaded.Streams != current.Streams {
+		current.Streams = loaded.Streams
+		reload.Applied = append(reload.Applied, "streams")
+	}
+	if loaded.Janitor.SessionTTL != current.Janitor.SessionTTL {
+		current.Janitor.SessionTTL = loaded.Janitor.SessionTTL
+		reload.Applied = append(reload.Applied, "janitor.session_ttl")
+	}
+	if loaded.OCR != current.OCR {
+		current.OCR = loaded.OCR
+		reload.Applied = append(reload.Applied, "ocr")
+	}
+	if loaded.RAG.CaptionModel != current.RAG.CaptionModel || loaded.RAG.MaxImages != current.RAG.MaxImages {
+		current.RAG.CaptionModel = loaded.RAG.CaptionModel
+		current.RAG.MaxImages = loaded.RAG.MaxImages
+		reload.Applied = append(reload.Applied, "rag")
+	}
+	if loaded.ImageGeneration != current.ImageGeneration {
+		current.ImageGeneration = loaded.ImageGeneration
+		reload.Applied = append(reload.Applied, "image_generation")
+	}
+	if loaded.Video.Interval != current.Video.Interval || loaded.Video.MaxFrames != current.Video.MaxFrames ||
+		loaded.Video.CaptionModel != current.Video.CaptionModel {
+		current.Video.Interval = loaded.Video.Interval
+		current.Video.MaxFrames = loaded.Video.MaxFrames
+		current.Video.CaptionModel = loaded.Video.CaptionModel
+		reload.Applied = append(reload.Applied, "video")
+	}
+	if loaded.Tools.Path != "" && loaded.Tools.Path == current.Tools.Path {
+		if err := s.Tools.Reload(); err != nil {
+			log.Println("Error reloading tools, keeping the current ones: ", err)
+		} else {
+			reload.Applied = append(reload.Applied, "tools.definitions")
+		}
+	}
+	if loaded.Workflows.Path != "" && loaded.Workflows.Path == current.Workflows.Path {
+		if err := s.Workflows.Reload(); err != nil {
+			log.Println("Error reloading workflows, keeping the current ones: ", err)
+		} else {
+			reload.Applied = append(reload.Applied, "workflows.definitions")
+		}
+	}
+	if loaded.Agents.Path != "" && loaded.Agents.Path == current.Agents.Path {
+		if err := s.Agents.Reload(); err != nil {
+			log.Println("Error reloading agents, keeping the current ones: ", err)
+		} else {
+			reload.Applied = append(reload.Applied, "agents.definitions")
+		}
+	}
+	if s.Screener != nil && loaded.Screening.Path == current.Screening.Path {
+		if err := s.Screener.Reload(); err != nil {
+			log.Println("Error reloading screening rules, keeping the current ones: ", err)
+		} else {
+			reload.Applied = append(reload.Applied, "screening.rules")
+		}
+	}
+
+	structural := []struct {
+		name            string
+		current, loaded interface{}
+	}{
+		{"profile", current.Profile, loaded.Profile},
+		{"server", current.Server, loaded.Server},
+		{"ollama.base_url", current.Ollama.BaseURL, loaded.Ollama.BaseURL},
+		{"ollama.transport", current.Ollama.Transport, loaded.Ollama.Transport},
+		{"embedder", current.Embedder, loaded.Embedder},
+		{"screening.path", current.Screening.Path, loaded.Screening.Path},
+		{"tools.path", current.Tools.Path, loaded.Tools.Path},
+		{"web_search", current.WebSearch, loaded.WebSearch},
+		{"workflows.path", current.Workflows.Path, loaded.Workflows.Path},
+		{"agents.path", current.Agents.Path, loaded.Agents.Path},
+		{"images", current.Images, loaded.Images},
+		{"rag.media_dir", current.RAG.MediaDir, loaded.RAG.MediaDir},
+		{"video.max_size", current.Video.MaxSize, loaded.Video.MaxSize},
+		{"pii", current.PII, loaded.PII},
+		{"storage", current.Storage, loaded.Storage},
+		{"redis", current.Redis, loaded.Redis},
+		{"idempotency", current.Idempotency, loaded.Idempotency},
+		{"blobs", current.Blobs, loaded.Blobs},
+		{"janitor.interval", current.Janitor.Interval, loaded.Janitor.Interval},
+		{"compression", current.Compression, loaded.Compression},
+		{"audit", current.Audit, loaded.Audit},
+		{"usage", current.Usage, loaded.Usage},
+		{"webhooks", current.Webhooks, loaded.Webhooks},
+		{"monitor", current.Monitor, loaded.Monitor},
+		{"debug.capture_size", current.Debug.CaptureSize, loaded.Debug.CaptureSize},
+		{"log", current.Log, loaded.Log},
+		{"timeouts", current.Timeouts, loaded.Timeouts},
+		{"remote", current.Remote, loaded.Remote},
+		{"cache", current.Cache, loaded.Cache},
+		{"search.mmap_dir", current.Search.MmapDir, loaded.Search.MmapDir},
+		{"search.mmap_collections", current.Search.MmapCollections, loaded.Search.MmapCollections},
+		{"search.float16_collections", current.Search.Float16Collections, loaded.Search.Float16Collections},
+		{"search.journal_dir", current.Search.JournalDir, loaded.Search.JournalDir},
+		{"search.journal_collections", current.Search.JournalCollections, loaded.Search.JournalCollections},
+		{"search.journal_checkpoint", current.Search.JournalCheckpoint, loaded.Search.JournalCheckpoint},
+	}
+	for _, setting := range structural {
+		if !reflect.DeepEqual(setting.current, setting.loaded) {
+			reload.RestartRequired = append(reload.RestartRequired, setting.name)
+		}
+	}
+
+	s.SetConfig(current)
+	return reload, nil
+}
+
+// reloadOnSignal reloads the configuration on every SIGHUP.
+func (s *OrusAPI) reloadOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		reload, err := s.Reload()
+		if err != nil {
+			log.Printf("Configuration reload rejected, keeping the current configuration:\n%v", err)
+			continue
+		}
+		log.Printf("Configuration reloaded, applied: %v, restart required: %v", reload.Applied, reload.RestartRequired)
+	}
+}
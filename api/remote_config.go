@@ -0,0 +1,51 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Dsouza10082/orus"
+)
+
+// watchRemote reloads the configuration every time the remote document
+// changes, until ctx is done.
+func (s *OrusAPI) watchRemote(ctx context.Context, config orus.RemoteConfig) {
+	source, err := orus.NewRemoteSource(config)
+	if err != nil {
+		log.Println("Error watching remote config: ", err)
+		return
+	}
+	var version uint64
+	// missed is set after an error, when a change may have gone unseen
+	missed := false
+	for ctx.Err() == nil {
+		_, latest, err := source.Fetch(ctx, version)
+		if errors.Is(err, context.Canceled) {
+			return
+		}
+		if err != nil {
+			log.Printf("Error watching remote config, retrying in %s: %v", orus.RemoteRetryBackoff, err)
+			// Fetch the current version without waiting on the next attempt,
+			// as an etcd revision may have been compacted away meanwhile
+			version, missed = 0, true
+			select {
+			case <-ctx.Done():
+			case <-time.After(orus.RemoteRetryBackoff):
+			}
+			continue
+		}
+		// The first answer is the document loaded at startup, and an
+		// unchanged version is a Consul blocking query that timed out
+		if (version != 0 && latest != version) || missed {
+			reload, err := s.Reload()
+			if err != nil {
+				log.Printf("Remote configuration rejected, keeping the current configuration:\n%v", err)
+			} else {
+				log.Printf("Remote configuration reloaded, applied: %v, restart required: %v", reload.Applied, reload.RestartRequired)
+			}
+		}
+		version, missed = latest, false
+	}
+}
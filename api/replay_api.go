@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Dsouza10082/orus"
+	"github.com/Dsouza10082/orus/ollama"
+	"github.com/go-chi/chi/v5"
+)
+
+// capturePayloads makes the chats of the request keep their payloads while
+// the debug capture is on, for recordGeneration to store under the serial.
+func (s *OrusAPI) capturePayloads(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.CurrentConfig().Debug.Capture {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, _ := ollama.WithPayloadCapture(r.Context())
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// recordPayloads stores the payloads captured for the request of ctx under
+// serial. A reply served from the cache sent none and is not stored.
+func (s *OrusAPI) recordPayloads(ctx context.Context, serial, endpoint, model string) {
+	capture := ollama.PayloadCaptureFrom(ctx)
+	if capture == nil {
+		return
+	}
+	payloads := capture.Payloads()
+	if len(payloads) == 0 {
+		return
+	}
+	s.Payloads.Record(orus.CapturedRequest{Serial: serial, Endpoint: endpoint, Model: model, Payloads: payloads})
+}
+
+// GetCapturedPayloads godoc
+// @Summary      Returns the payloads a request sent upstream
+// @Description  Returns the exact chat payloads sent to Ollama or Ollama Cloud for a request serial, captured while ORUS_API_DEBUG_CAPTURE is on. Requires an admin key (ORUS_API_ADMIN_KEYS) in the X-Admin-Key header
+// @Tags         debug
+// @Produce      json
+// @Param        X-Admin-Key  header    string  true   "Admin key"
+// @Param        serial       path      string  true   "Request serial"
+// @Success      200  {object}  OrusResponse
+// @Failure      401  {object}  OrusResponse
+// @Failure      403  {object}  OrusResponse
+// @Failure      404  {object}  OrusResponse
+// @Router       /orus-api/v1/debug/payloads/{serial} [get]
+func (s *OrusAPI) GetCapturedPayloads(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	captured, err := s.Payloads.Get(chi.URLParam(r, "serial"))
+	if err != nil {
+		respondError(w, http.StatusNotFound, "payloads_not_found", err.Error())
+		return
+	}
+
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{
+		"request": captured,
+	}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Payloads retrieved successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// ReplayPayload godoc
+// @Summary      Replays a request serial
+// @Description  Sends a captured payload of a request serial again, byte for byte, optionally to another model, and returns the new reply along with the original one. The last payload, the one that produced the answer, is replayed unless index picks another. Requires an admin key (ORUS_API_ADMIN_KEYS) in the X-Admin-Key header
+// @Tags         debug
+// @Produce      json
+// @Param        X-Admin-Key  header    string  true   "Admin key"
+// @Param        serial       path      string  true   "Request serial"
+// @Param        model        query     string  false  "Model to replay against instead of the original one"
+// @Param        index        query     int     false  "Payload to replay, from 0; defaults to the last"
+// @Success      200  {object}  OrusResponse
+// @Failure      400  {object}  OrusResponse
+// @Failure      401  {object}  OrusResponse
+// @Failure      403  {object}  OrusResponse
+// @Failure      404  {object}  OrusResponse
+// @Failure      502  {object}  OrusResponse
+// @Router       /orus-api/v1/debug/replay/{serial} [post]
+func (s *OrusAPI) ReplayPayload(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	serial := chi.URLParam(r, "serial")
+	captured, err := s.Payloads.Get(serial)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "payloads_not_found", err.Error())
+		return
+	}
+	index := len(captured.Payloads) - 1
+	if value := r.URL.Query().Get("index"); value != "" {
+		index, err = strconv.Atoi(value)
+		if err != nil || index < 0 || index >= len(captured.Payloads) {
+			respondError(w, http.StatusBadRequest, "invalid_index", "Query parameter 'index' must be between 0 and "+strconv.Itoa(len(captured.Payloads)-1))
+			return
+		}
+	}
+	model := r.URL.Query().Get("model")
+
+	client, ok := ollama.ClientOf(s.Backend.WithContext(r.Context()))
+	if !ok {
+		respondError(w, http.StatusNotImplemented, "replay_unsupported", "The backend of this server cannot replay payloads")
+		return
+	}
+	payload := captured.Payloads[index]
+	reply, err := client.Replay(payload, model)
+	if err != nil {
+		respondError(w, errorStatus(err), llmErrorCode(err), err.Error())
+		return
+	}
+
+	data := map[string]interface{}{
+		"serial":  serial,
+		"index":   index,
+		"url":     payload.URL,
+		"model":   reply.Model,
+		"payload": payload.Body,
+		"replay": map[string]interface{}{
+			"content":           reply.Message.Content,
+			"thinking":          reply.Message.Thinking,
+			"tool_calls":        reply.Message.ToolCalls,
+			"prompt_tokens":     reply.PromptEvalCount,
+			"completion_tokens": reply.EvalCount,
+		},
+	}
+	if generation, err := s.Generations.Get(serial); err == nil {
+		data["original"] = map[string]interface{}{
+			"model":   generation.Model,
+			"content": generation.Response,
+		}
+	} else if !errors.Is(err, orus.ErrGenerationNotFound) {
+		respondError(w, http.StatusInternalServerError, "generation_error", err.Error())
+		return
+	}
+
+	response := NewOrusResponse()
+	response.Data = data
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Payload replayed successfully"
+	respondJSON(w, http.StatusOK, response)
+}
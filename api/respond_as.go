@@ -0,0 +1,215 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/Dsouza10082/orus/ollama"
+)
+
+// maxRepairRetries bounds the repair_retries of a request.
+const maxRepairRetries = 10
+
+// RespondAs is the shape a chat reply must have: either a Go type
+// expression, such as `struct { Name string `json:"name"` }`, or a JSON
+// Schema object. The reply is held to it like a format schema, and decoded.
+type RespondAs []byte
+
+func (r RespondAs) MarshalJSON() ([]byte, error) {
+	if len(r) == 0 {
+		return []byte("null"), nil
+	}
+	return r, nil
+}
+
+func (r *RespondAs) UnmarshalJSON(data []byte) error {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.Equal(trimmed, []byte("null")) || bytes.Equal(trimmed, []byte(`""`)) {
+		*r = nil
+		return nil
+	}
+	*r = append((*r)[:0], trimmed...)
+	return nil
+}
+
+// Format returns the JSON Schema format the reply is checked against.
+func (r RespondAs) Format() (ollama.ResponseFormat, error) {
+	var source string
+	if err := json.Unmarshal(r, &source); err == nil {
+		expr, err := parser.ParseExpr(source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Go type: %w", err)
+		}
+		schema, err := goTypeSchema(expr)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(schema)
+		if err != nil {
+			return nil, err
+		}
+		return ollama.ResponseFormat(data), nil
+	}
+	format := ollama.ResponseFormat(r)
+	if format.Schema() == nil {
+		return nil, errors.New("respond_as must be a Go type or a JSON schema object")
+	}
+	return format, nil
+}
+
+// respondFormatFailure answers a respond_as call whose reply never matched
+// with 422 and the failure. It reports false when err is not a FormatFailure.
+func respondFormatFailure(w http.ResponseWriter, err error) bool {
+	var failure *ollama.FormatFailure
+	if !errors.As(err, &failure) {
+		return false
+	}
+	respondJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+		"success": false,
+		"error":   "respond_as_failed",
+		"message": failure.Error(),
+		"failure": failure,
+	})
+	return true
+}
+
+// goTypeSchema translates a Go type expression to the JSON Schema of its
+// encoding/json encoding. Struct fields follow their json tags; pointers and
+// omitempty fields are optional, every other field is required.
+func goTypeSchema(expr ast.Expr) (map[string]interface{}, error) {
+	switch t := expr.(type) {
+	case *ast.ParenExpr:
+		return goTypeSchema(t.X)
+	case *ast.Ident:
+		return goIdentSchema(t.Name)
+	case *ast.SelectorExpr:
+		if pkg, ok := t.X.(*ast.Ident); ok && pkg.Name == "time" && t.Sel.Name == "Time" {
+			return map[string]interface{}{"type": "string", "format": "date-time"}, nil
+		}
+		if pkg, ok := t.X.(*ast.Ident); ok && pkg.Name == "json" && t.Sel.Name == "RawMessage" {
+			return map[string]interface{}{}, nil
+		}
+	case *ast.StarExpr:
+		schema, err := goTypeSchema(t.X)
+		if err != nil {
+			return nil, err
+		}
+		if kind, ok := schema["type"].(string); ok {
+			schema["type"] = []interface{}{kind, "null"}
+		}
+		return schema, nil
+	case *ast.InterfaceType:
+		if t.Methods == nil || len(t.Methods.List) == 0 {
+			return map[string]interface{}{}, nil
+		}
+	case *ast.ArrayType:
+		items, err := goTypeSchema(t.Elt)
+		if err != nil {
+			return nil, err
+		}
+		schema := map[string]interface{}{"type": "array", "items": items}
+		if t.Len != nil {
+			length, ok := t.Len.(*ast.BasicLit)
+			if !ok || length.Kind != token.INT {
+				return nil, fmt.Errorf("array length %s must be a number", types.ExprString(t.Len))
+			}
+			n, err := strconv.Atoi(length.Value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid array length %s", length.Value)
+			}
+			schema["minItems"] = float64(n)
+			schema["maxItems"] = float64(n)
+		}
+		return schema, nil
+	case *ast.MapType:
+		if key, ok := t.Key.(*ast.Ident); !ok || key.Name != "string" {
+			return nil, fmt.Errorf("map keys must be strings, got %s", types.ExprString(t.Key))
+		}
+		values, err := goTypeSchema(t.Value)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "object", "additionalProperties": values}, nil
+	case *ast.StructType:
+		return goStructSchema(t)
+	}
+	return nil, fmt.Errorf("unsupported Go type %s", types.ExprString(expr))
+}
+
+func goIdentSchema(name string) (map[string]interface{}, error) {
+	switch name {
+	case "string":
+		return map[string]interface{}{"type": "string"}, nil
+	case "bool":
+		return map[string]interface{}{"type": "boolean"}, nil
+	case "int", "int8", "int16", "int32", "int64", "rune":
+		return map[string]interface{}{"type": "integer"}, nil
+	case "uint", "uint8", "uint16", "uint32", "uint64", "byte":
+		return map[string]interface{}{"type": "integer", "minimum": 0.0}, nil
+	case "float32", "float64":
+		return map[string]interface{}{"type": "number"}, nil
+	case "any":
+		return map[string]interface{}{}, nil
+	}
+	return nil, fmt.Errorf("unsupported Go type %s", name)
+}
+
+func goStructSchema(structType *ast.StructType) (map[string]interface{}, error) {
+	properties := make(map[string]interface{})
+	required := make([]interface{}, 0)
+	for _, field := range structType.Fields.List {
+		if len(field.Names) == 0 {
+			return nil, fmt.Errorf("embedded field %s is not supported", types.ExprString(field.Type))
+		}
+		var tag reflect.StructTag
+		if field.Tag != nil {
+			value, err := strconv.Unquote(field.Tag.Value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid tag %s", field.Tag.Value)
+			}
+			tag = reflect.StructTag(value)
+		}
+		jsonName, options, _ := strings.Cut(tag.Get("json"), ",")
+		if jsonName == "-" && options == "" {
+			continue
+		}
+		schema, err := goTypeSchema(field.Type)
+		if err != nil {
+			return nil, err
+		}
+		if description := tag.Get("description"); description != "" {
+			schema["description"] = description
+		}
+		_, pointer := field.Type.(*ast.StarExpr)
+		optional := pointer || strings.Contains(","+options+",", ",omitempty,")
+		for _, name := range field.Names {
+			if !name.IsExported() {
+				continue
+			}
+			key := jsonName
+			if key == "" {
+				key = name.Name
+			}
+			properties[key] = schema
+			if !optional {
+				required = append(required, key)
+			}
+		}
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}, nil
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Dsouza10082/orus"
+)
+
+// respondScreenBlocked answers a call stopped by screening with the report.
+func respondScreenBlocked(w http.ResponseWriter, stage orus.ScreenStage, report *orus.ScreenReport) {
+	respondJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+		"success":   false,
+		"error":     string(stage) + "_blocked",
+		"message":   fmt.Sprintf("The %s was blocked by the content policy", stage),
+		"screening": report,
+	})
+}
+
+// GetScreeningStats godoc
+// @Summary      Returns the screening metrics
+// @Description  Returns how many inputs and outputs were screened and blocked, and how many times each rule triggered on each route, including the findings of policies in monitor mode. Requires an admin key (ORUS_API_ADMIN_KEYS) in the X-Admin-Key header
+// @Tags         config
+// @Produce      json
+// @Param        X-Admin-Key  header    string  true  "Admin key"
+// @Success      200  {object}  OrusResponse
+// @Failure      401  {object}  OrusResponse
+// @Failure      403  {object}  OrusResponse
+// @Router       /orus-api/v1/screening [get]
+func (s *OrusAPI) GetScreeningStats(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{"screening": s.Screener.Stats()}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Screening stats retrieved successfully"
+	respondJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,668 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Dsouza10082/orus"
+	"github.com/Dsouza10082/orus/ollama"
+	"github.com/go-chi/chi/v5"
+)
+
+type SessionExport struct {
+	Session          *orus.Session `json:"session"`
+	PromptTokens     int           `json:"prompt_tokens"`
+	CompletionTokens int           `json:"completion_tokens"`
+	ExportedAt       time.Time     `json:"exported_at"`
+}
+
+// CreateSession godoc
+// @Summary      Creates a new conversation session
+// @Description  Creates a new conversation session
+// @Tags         sessions
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  OrusResponse
+// @Failure      400  {object}  OrusResponse
+// @Router       /orus-api/v1/sessions [post]
+func (s *OrusAPI) CreateSession(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	type Req struct {
+		Title    string               `json:"title"`
+		AgentID  string               `json:"agent_id"`
+		UserID   string               `json:"user_id"`
+		Settings orus.SessionSettings `json:"settings"`
+	}
+
+	request, ok := decodeJSON[Req](w, r)
+	if !ok {
+		return
+	}
+	if err := request.Settings.Validate(); err != nil {
+		respondError(w, http.StatusBadRequest, err.Code, err.Message)
+		return
+	}
+
+	session, err := s.Sessions.Create(orus.Session{
+		Title:    request.Title,
+		AgentID:  request.AgentID,
+		UserID:   request.UserID,
+		Settings: request.Settings,
+	})
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "session_error", err.Error())
+		return
+	}
+
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{
+		"session": session,
+	}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Session created successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// ListSessions godoc
+// @Summary      Returns the persisted conversation sessions
+// @Description  Returns the persisted conversation sessions, most recently updated first
+// @Tags         sessions
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  OrusResponse
+// @Failure      500  {object}  OrusResponse
+// @Router       /orus-api/v1/sessions [get]
+func (s *OrusAPI) ListSessions(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	sessions, err := s.Sessions.List()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "session_error", err.Error())
+		return
+	}
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{
+		"sessions": sessions,
+	}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Sessions retrieved successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// SearchSessions godoc
+// @Summary      Searches past conversations by meaning
+// @Description  Finds the session turns semantically closest to the query, returning their session IDs and the matching turns
+// @Tags         sessions
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  OrusResponse
+// @Failure      400  {object}  OrusResponse
+// @Failure      500  {object}  OrusResponse
+// @Router       /orus-api/v1/sessions/search [post]
+func (s *OrusAPI) SearchSessions(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	type Req struct {
+		orus.SearchRequest
+		SessionID string `json:"session_id"`
+	}
+
+	request, ok := decodeJSON[Req](w, r)
+	if !ok {
+		return
+	}
+	if request.Query == "" {
+		respondError(w, http.StatusBadRequest, "missing_query", "Field 'query' is required")
+		return
+	}
+
+	results, err := s.SessionIndex.Search(request.Query, request.Limit, request.SessionID)
+	if err != nil {
+		response := NewOrusResponse()
+		response.Error = err.Error()
+		response.Message = "Error searching sessions"
+		response.Success = false
+		response.TimeTaken = time.Since(startTime)
+		respondJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	sessionIDs := make([]string, 0)
+	seen := make(map[string]struct{})
+	for _, result := range results {
+		if _, ok := seen[result.SessionID]; !ok {
+			seen[result.SessionID] = struct{}{}
+			sessionIDs = append(sessionIDs, result.SessionID)
+		}
+	}
+
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{
+		"query":       request.Query,
+		"session_ids": sessionIDs,
+		"results":     results,
+	}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Session search completed successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// GetSession godoc
+// @Summary      Returns a conversation session
+// @Description  Returns a conversation session with all of its turns
+// @Tags         sessions
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "Session ID"
+// @Success      200  {object}  OrusResponse
+// @Failure      404  {object}  OrusResponse
+// @Router       /orus-api/v1/sessions/{id} [get]
+func (s *OrusAPI) GetSession(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	session, ok := s.loadSession(w, r)
+	if !ok {
+		return
+	}
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{
+		"session": session,
+	}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Session retrieved successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// DeleteSession godoc
+// @Summary      Deletes a conversation session
+// @Description  Deletes a conversation session
+// @Tags         sessions
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "Session ID"
+// @Success      200  {object}  OrusResponse
+// @Failure      404  {object}  OrusResponse
+// @Router       /orus-api/v1/sessions/{id} [delete]
+func (s *OrusAPI) DeleteSession(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	id := chi.URLParam(r, "id")
+	if err := s.Sessions.Delete(id); err != nil {
+		respondSessionError(w, err)
+		return
+	}
+	s.SessionIndex.Remove(id)
+	response := NewOrusResponse()
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Session deleted successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// GetSessionSettings godoc
+// @Summary      Returns the default model and parameters of a session
+// @Description  Returns the default model and parameters of a session
+// @Tags         sessions
+// @Produce      json
+// @Param        id   path      string  true  "Session ID"
+// @Success      200  {object}  OrusResponse
+// @Failure      404  {object}  OrusResponse
+// @Router       /orus-api/v1/sessions/{id}/settings [get]
+func (s *OrusAPI) GetSessionSettings(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	session, ok := s.loadSession(w, r)
+	if !ok {
+		return
+	}
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{
+		"settings": session.Settings,
+	}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Session settings retrieved successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// UpdateSessionSettings godoc
+// @Summary      Updates the default model and parameters of a session
+// @Description  Updates the default model, provider, temperature, system prompt, think and format of a session. Omitted fields keep their current value.
+// @Tags         sessions
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "Session ID"
+// @Success      200  {object}  OrusResponse
+// @Failure      400  {object}  OrusResponse
+// @Failure      404  {object}  OrusResponse
+// @Router       /orus-api/v1/sessions/{id}/settings [patch]
+func (s *OrusAPI) UpdateSessionSettings(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	update, ok := decodeJSON[orus.SessionSettingsUpdate](w, r)
+	if !ok {
+		return
+	}
+
+	session, ok := s.loadSession(w, r)
+	if !ok {
+		return
+	}
+
+	settings := session.Settings.Apply(*update)
+	if err := settings.Validate(); err != nil {
+		respondError(w, http.StatusBadRequest, err.Code, err.Message)
+		return
+	}
+
+	session, err := s.Sessions.UpdateSettings(session.ID, settings)
+	if err != nil {
+		respondSessionError(w, err)
+		return
+	}
+
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{
+		"settings": session.Settings,
+	}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Session settings updated successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// SessionChat godoc
+// @Summary      Sends a message inside a conversation session
+// @Description  Appends the user message to the session history, calls the LLM with the session settings (optionally overridden per request) and records the answer
+// @Tags         sessions
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "Session ID"
+// @Success      200  {object}  OrusResponse
+// @Failure      400  {object}  OrusResponse
+// @Failure      404  {object}  OrusResponse
+// @Failure      500  {object}  OrusResponse
+// @Router       /orus-api/v1/sessions/{id}/chat [post]
+func (s *OrusAPI) SessionChat(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	type Req struct {
+		Message string `json:"message"`
+		orus.SessionSettingsUpdate
+	}
+
+	request, ok := decodeJSON[Req](w, r)
+	if !ok {
+		return
+	}
+	if request.Message == "" {
+		respondError(w, http.StatusBadRequest, "missing_message", "Field 'message' is required")
+		return
+	}
+
+	session, ok := s.loadSession(w, r)
+	if !ok {
+		return
+	}
+
+	settings, ok := resolveSessionSettings(w, session.Settings, request.SessionSettingsUpdate, "")
+	if !ok {
+		return
+	}
+
+	// the answer continues the branch it was generated from, even if the
+	// head moves meanwhile
+	userTurn := orus.SessionTurn{
+		ParentID:  session.HeadID,
+		Role:      "user",
+		Content:   request.Message,
+		CreatedAt: time.Now().UTC(),
+	}
+	history := append(session.Messages(), ollama.Message{Role: userTurn.Role, Content: userTurn.Content})
+
+	assistantTurn, memories, err := s.generateSessionTurn(r.Context(), session, history, settings, startTime)
+	if err != nil {
+		respondLLMError(w, err, startTime)
+		return
+	}
+
+	session, err = s.Sessions.AppendTurns(session.ID, userTurn, assistantTurn)
+	if err != nil {
+		respondSessionError(w, err)
+		return
+	}
+	s.rememberSessionExchange(session, settings.Model, userTurn, assistantTurn)
+	branch := session.Branch()
+	s.SessionIndex.IndexAsync(session, branch[len(branch)-2:]...)
+
+	s.respondSessionTurn(w, r, session, settings, memories, startTime)
+}
+
+// RegenerateSession godoc
+// @Summary      Regenerates the last assistant message of a session
+// @Description  Generates an alternative answer to the last user message of the active branch. The previous answer is kept as a sibling turn and the new one becomes the head.
+// @Tags         sessions
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "Session ID"
+// @Success      200  {object}  OrusResponse
+// @Failure      400  {object}  OrusResponse
+// @Failure      404  {object}  OrusResponse
+// @Failure      500  {object}  OrusResponse
+// @Router       /orus-api/v1/sessions/{id}/regenerate [post]
+func (s *OrusAPI) RegenerateSession(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	// the overrides are optional, so is the body
+	request, ok := decodeOptionalJSON[orus.SessionSettingsUpdate](w, r)
+	if !ok {
+		return
+	}
+
+	session, ok := s.loadSession(w, r)
+	if !ok {
+		return
+	}
+
+	branch := session.Branch()
+	if len(branch) < 2 || branch[len(branch)-1].Role != "assistant" || branch[len(branch)-2].Role != "user" {
+		respondError(w, http.StatusBadRequest, "nothing_to_regenerate", "The active branch does not end with an assistant answer")
+		return
+	}
+	previous := branch[len(branch)-1]
+	userTurn := branch[len(branch)-2]
+
+	settings, ok := resolveSessionSettings(w, session.Settings, *request, previous.Model)
+	if !ok {
+		return
+	}
+
+	assistantTurn, memories, err := s.generateSessionTurn(r.Context(), session, orus.TurnMessages(session.Path(userTurn.ID)), settings, startTime)
+	if err != nil {
+		respondLLMError(w, err, startTime)
+		return
+	}
+	assistantTurn.ParentID = userTurn.ID
+
+	session, err = s.Sessions.AppendTurns(session.ID, assistantTurn)
+	if err != nil {
+		respondSessionError(w, err)
+		return
+	}
+	if head, ok := session.Turn(session.HeadID); ok {
+		s.SessionIndex.IndexAsync(session, *head)
+	}
+
+	s.respondSessionTurn(w, r, session, settings, memories, startTime)
+}
+
+// BranchSession godoc
+// @Summary      Moves the active branch of a session to an earlier turn
+// @Description  Selects any turn as the new head so the next chat continues from it, keeping all other turns as alternative branches. An empty turn_id starts a new branch from the beginning.
+// @Tags         sessions
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "Session ID"
+// @Success      200  {object}  OrusResponse
+// @Failure      400  {object}  OrusResponse
+// @Failure      404  {object}  OrusResponse
+// @Router       /orus-api/v1/sessions/{id}/branch [post]
+func (s *OrusAPI) BranchSession(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	type Req struct {
+		TurnID string `json:"turn_id"`
+	}
+
+	request, ok := decodeJSON[Req](w, r)
+	if !ok {
+		return
+	}
+
+	session, err := s.Sessions.SetHead(chi.URLParam(r, "id"), request.TurnID)
+	if err != nil {
+		respondSessionError(w, err)
+		return
+	}
+
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{
+		"session": session,
+		"branch":  session.Branch(),
+	}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Session branch selected successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// resolveSessionSettings applies the per-request overrides to the session
+// settings, falling back to fallbackModel, and writes a 400 when the result is unusable.
+func resolveSessionSettings(w http.ResponseWriter, settings orus.SessionSettings, update orus.SessionSettingsUpdate, fallbackModel string) (orus.SessionSettings, bool) {
+	settings = settings.Apply(update)
+	if settings.Model == "" {
+		settings.Model = fallbackModel
+	}
+	if settings.Model == "" {
+		respondError(w, http.StatusBadRequest, "missing_model", "Field 'model' is required when the session has no default model")
+		return settings, false
+	}
+	if err := settings.Validate(); err != nil {
+		respondError(w, http.StatusBadRequest, err.Code, err.Message)
+		return settings, false
+	}
+	return settings, true
+}
+
+// sessionChatRequest builds the chat request answering history, which must end
+// with the user message, and returns it with the memories recalled for the prompt.
+func (s *OrusAPI) sessionChatRequest(session *orus.Session, history []ollama.Message, settings orus.SessionSettings) (ollama.ChatRequest, []orus.SearchResult) {
+	messages := make([]ollama.Message, 0, len(history)+2)
+	if settings.SystemPrompt != "" {
+		messages = append(messages, ollama.Message{Role: "system", Content: settings.SystemPrompt})
+	}
+	memories := make([]orus.SearchResult, 0)
+	if s.Memory != nil && (session.AgentID != "" || session.UserID != "") && len(history) > 0 {
+		recalled, err := s.Memory.Recall(session.AgentID, session.UserID, history[len(history)-1].Content)
+		if err != nil {
+			log.Println("Error recalling agent memory: ", err)
+		} else if len(recalled) > 0 {
+			memories = recalled
+			messages = append(messages, orus.MemoryMessage(memories))
+		}
+	}
+	messages = append(messages, history...)
+
+	chatRequest := ollama.ChatRequest{
+		Model:    settings.Model,
+		Messages: messages,
+		Think:    settings.Think,
+		Format:   settings.Format,
+	}
+	if settings.Temperature != nil {
+		chatRequest.Options = map[string]interface{}{"temperature": *settings.Temperature}
+	}
+	return chatRequest, memories
+}
+
+// generateSessionTurn answers history, which must end with the user message,
+// and returns the assistant turn with the memories recalled for the prompt.
+func (s *OrusAPI) generateSessionTurn(ctx context.Context, session *orus.Session, history []ollama.Message, settings orus.SessionSettings, startTime time.Time) (orus.SessionTurn, []orus.SearchResult, error) {
+	chatRequest, memories := s.sessionChatRequest(session, history, settings)
+
+	var (
+		responseLLM *ollama.ChatResponse
+		err         error
+	)
+	if settings.Provider == orus.ProviderOllamaCloud {
+		responseLLM, err = s.Backend.WithContext(ctx).ChatCloud(chatRequest)
+	} else {
+		responseLLM, err = s.Backend.WithContext(ctx).Chat(chatRequest)
+	}
+	if err != nil {
+		return orus.SessionTurn{}, nil, err
+	}
+
+	return orus.SessionTurn{
+		Role:             "assistant",
+		Content:          responseLLM.Message.Content,
+		Model:            settings.Model,
+		Parameters:       settings.Parameters(),
+		PromptTokens:     responseLLM.PromptEvalCount,
+		CompletionTokens: responseLLM.EvalCount,
+		Duration:         time.Since(startTime),
+		CreatedAt:        time.Now().UTC(),
+	}, memories, nil
+}
+
+func (s *OrusAPI) rememberSessionExchange(session *orus.Session, model string, userTurn, assistantTurn orus.SessionTurn) {
+	if s.Memory == nil || (session.AgentID == "" && session.UserID == "") {
+		return
+	}
+	exchange := []ollama.Message{
+		{Role: userTurn.Role, Content: userTurn.Content},
+		{Role: assistantTurn.Role, Content: assistantTurn.Content},
+	}
+	go func(agentID, userID string) {
+		if _, err := s.Memory.RememberConversation(agentID, userID, model, exchange); err != nil {
+			log.Println("Error storing agent memory: ", err)
+		}
+	}(session.AgentID, session.UserID)
+}
+
+// respondSessionTurn answers with the head turn and records it as a generation
+// so the returned serial can be used for feedback.
+func (s *OrusAPI) respondSessionTurn(w http.ResponseWriter, r *http.Request, session *orus.Session, settings orus.SessionSettings, memories []orus.SearchResult, startTime time.Time) {
+	turn, _ := session.Turn(session.HeadID)
+	messages := orus.TurnMessages(session.Path(turn.ParentID))
+	if settings.SystemPrompt != "" {
+		messages = append([]ollama.Message{{Role: "system", Content: settings.SystemPrompt}}, messages...)
+	}
+	response := NewOrusResponse()
+	s.recordGeneration(r.Context(), response.Serial, r.URL.Path, &ollama.ChatRequest{Model: turn.Model, Messages: messages}, turn.Content, startTime)
+	response.Data = map[string]interface{}{
+		"session_id": session.ID,
+		"content":    turn.Content,
+		"model":      turn.Model,
+		"turn":       turn,
+		"siblings":   len(session.Children(turn.ParentID)),
+		"memories":   memories,
+	}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "LLM request received successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+func respondLLMError(w http.ResponseWriter, err error, startTime time.Time) {
+	response := NewOrusResponse()
+	response.Error = err.Error()
+	response.Message = "Error calling LLM"
+	response.Success = false
+	response.TimeTaken = time.Since(startTime)
+	respondJSON(w, errorStatus(err), response)
+}
+
+// ExportSession godoc
+// @Summary      Exports a conversation session as a portable transcript
+// @Description  Exports a conversation session as JSON or Markdown, including model, parameters, timestamps and token counts
+// @Tags         sessions
+// @Produce      json
+// @Produce      text/markdown
+// @Param        id      path      string  true   "Session ID"
+// @Param        format  query     string  false  "Export format (json or md)"
+// @Success      200  {object}  SessionExport
+// @Failure      400  {object}  OrusResponse
+// @Failure      404  {object}  OrusResponse
+// @Router       /orus-api/v1/sessions/{id}/export [get]
+func (s *OrusAPI) ExportSession(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "md" {
+		respondError(w, http.StatusBadRequest, "invalid_format", "Query parameter 'format' must be 'json' or 'md'")
+		return
+	}
+
+	session, ok := s.loadSession(w, r)
+	if !ok {
+		return
+	}
+
+	export := SessionExport{
+		Session:    session,
+		ExportedAt: time.Now().UTC(),
+	}
+	export.PromptTokens, export.CompletionTokens = session.TokenUsage()
+
+	if format == "md" {
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"session-%s.md\"", session.ID))
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(renderSessionMarkdown(export)))
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"session-%s.json\"", session.ID))
+	respondJSON(w, http.StatusOK, export)
+}
+
+func renderSessionMarkdown(export SessionExport) string {
+	session := export.Session
+	sb := &strings.Builder{}
+
+	title := session.Title
+	if title == "" {
+		title = "Session " + session.ID
+	}
+	fmt.Fprintf(sb, "# %s\n\n", title)
+	fmt.Fprintf(sb, "- **Session ID:** %s\n", session.ID)
+	if session.Settings.Model != "" {
+		fmt.Fprintf(sb, "- **Default model:** %s\n", session.Settings.Model)
+	}
+	fmt.Fprintf(sb, "- **Created:** %s\n", session.CreatedAt.Format(time.RFC3339))
+	fmt.Fprintf(sb, "- **Updated:** %s\n", session.UpdatedAt.Format(time.RFC3339))
+	fmt.Fprintf(sb, "- **Exported:** %s\n", export.ExportedAt.Format(time.RFC3339))
+	fmt.Fprintf(sb, "- **Tokens:** %d prompt / %d completion\n\n", export.PromptTokens, export.CompletionTokens)
+
+	for _, turn := range session.Branch() {
+		fmt.Fprintf(sb, "---\n\n### %s\n\n", turn.Role)
+		meta := []string{turn.CreatedAt.Format(time.RFC3339)}
+		if turn.Model != "" {
+			meta = append(meta, "model: "+turn.Model)
+		}
+		keys := make([]string, 0, len(turn.Parameters))
+		for key := range turn.Parameters {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			meta = append(meta, fmt.Sprintf("%s: %v", key, turn.Parameters[key]))
+		}
+		if turn.PromptTokens > 0 || turn.CompletionTokens > 0 {
+			meta = append(meta, fmt.Sprintf("tokens: %d prompt / %d completion", turn.PromptTokens, turn.CompletionTokens))
+		}
+		fmt.Fprintf(sb, "_%s_\n\n%s\n\n", strings.Join(meta, " · "), turn.Content)
+	}
+	return sb.String()
+}
+
+func (s *OrusAPI) loadSession(w http.ResponseWriter, r *http.Request) (*orus.Session, bool) {
+	session, err := s.Sessions.Get(chi.URLParam(r, "id"))
+	if err != nil {
+		respondSessionError(w, err)
+		return nil, false
+	}
+	return session, true
+}
+
+func respondSessionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, orus.ErrSessionNotFound) {
+		respondError(w, http.StatusNotFound, "session_not_found", err.Error())
+		return
+	}
+	if errors.Is(err, orus.ErrTurnNotFound) {
+		respondError(w, http.StatusNotFound, "turn_not_found", err.Error())
+		return
+	}
+	respondError(w, http.StatusInternalServerError, "session_error", err.Error())
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Dsouza10082/orus/orustest"
+)
+
+// testSession creates a session and chats once in it, returning its ID.
+func testSession(t *testing.T, handler http.Handler) string {
+	t.Helper()
+	w := post(t, handler, "/orus-api/v1/sessions", `{"title":"test","settings":{"model":"llama3.1:8b"}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("creating the session answered %d: %s", w.Code, w.Body)
+	}
+	var created struct {
+		Data struct {
+			Session struct {
+				ID string `json:"id"`
+			} `json:"session"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	id := created.Data.Session.ID
+	if w := post(t, handler, "/orus-api/v1/sessions/"+id+"/chat", `{"message":"first question"}`); w.Code != http.StatusOK {
+		t.Fatalf("chatting answered %d: %s", w.Code, w.Body)
+	}
+	return id
+}
+
+func TestRegenerateSessionBody(t *testing.T) {
+	handler := testAPI(t, orustest.NewBackend())
+	id := testSession(t, handler)
+	path := "/orus-api/v1/sessions/" + id + "/regenerate"
+
+	for _, test := range []struct {
+		name   string
+		body   string
+		status int
+		code   string
+	}{
+		{"empty", "", http.StatusOK, ""},
+		{"overrides", `{"temperature":0.5}`, http.StatusOK, ""},
+		{"malformed", `{"temperature":`, http.StatusBadRequest, "invalid_json"},
+		{"unknown field", `{"temprature":0.5}`, http.StatusBadRequest, "unknown_field"},
+		{"trailing data", `{} {}`, http.StatusBadRequest, "invalid_request"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			w := post(t, handler, path, test.body)
+			if w.Code != test.status {
+				t.Fatalf("answered %d, want %d: %s", w.Code, test.status, w.Body)
+			}
+			if test.code == "" {
+				return
+			}
+			var response struct {
+				Error string `json:"error"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if response.Error != test.code {
+				t.Fatalf("answered the code %q, want %q", response.Error, test.code)
+			}
+		})
+	}
+}
+
+func TestExportSessionCountsTheActiveBranch(t *testing.T) {
+	backend := orustest.NewBackend()
+	handler := testAPI(t, backend)
+	id := testSession(t, handler)
+	backend.SetReply("a longer answer of six words")
+	if w := post(t, handler, "/orus-api/v1/sessions/"+id+"/regenerate", ""); w.Code != http.StatusOK {
+		t.Fatalf("regenerating answered %d: %s", w.Code, w.Body)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orus-api/v1/sessions/"+id+"/export", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("exporting answered %d: %s", w.Code, w.Body)
+	}
+	var export struct {
+		Session struct {
+			Turns []struct {
+				CompletionTokens int `json:"completion_tokens"`
+			} `json:"turns"`
+		} `json:"session"`
+		CompletionTokens int `json:"completion_tokens"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &export); err != nil {
+		t.Fatal(err)
+	}
+	// the question and both answers are exported, only the last answer is counted
+	if len(export.Session.Turns) != 3 {
+		t.Fatalf("exported %d turns, want 3", len(export.Session.Turns))
+	}
+	if export.CompletionTokens != 6 {
+		t.Fatalf("exported %d completion tokens, want the 6 of the active branch", export.CompletionTokens)
+	}
+}
+
+func TestSessionErrorCodes(t *testing.T) {
+	handler := testAPI(t, orustest.NewBackend())
+	id := testSession(t, handler)
+	for _, test := range []struct {
+		name string
+		path string
+		code string
+	}{
+		{"unknown turn", "/orus-api/v1/sessions/" + id + "/branch", "turn_not_found"},
+		{"unknown session", "/orus-api/v1/sessions/no-such-session/branch", "session_not_found"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			w := post(t, handler, test.path, `{"turn_id":"no-such-turn"}`)
+			if w.Code != http.StatusNotFound {
+				t.Fatalf("answered %d, want 404", w.Code)
+			}
+			var response struct {
+				Error string `json:"error"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if response.Error != test.code {
+				t.Fatalf("answered the code %q, want %q", response.Error, test.code)
+			}
+		})
+	}
+}
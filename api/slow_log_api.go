@@ -0,0 +1,50 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Dsouza10082/orus"
+)
+
+// GetSlowRequests godoc
+// @Summary      Returns the recent slow requests
+// @Description  Returns the most recent requests over the latency or token thresholds, newest first, with their route, models, prompt size, tokens and the time spent queued, embedding and generating. Requires an admin key (ORUS_API_ADMIN_KEYS) in the X-Admin-Key header
+// @Tags         config
+// @Produce      json
+// @Param        X-Admin-Key  header    string  true   "Admin key"
+// @Param        limit        query     int     false  "Maximum requests (default 50)"
+// @Success      200  {object}  OrusResponse
+// @Failure      400  {object}  OrusResponse
+// @Failure      401  {object}  OrusResponse
+// @Failure      403  {object}  OrusResponse
+// @Router       /orus-api/v1/slow-requests [get]
+func (s *OrusAPI) GetSlowRequests(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	limit := orus.DefaultSlowQueryLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			respondError(w, http.StatusBadRequest, "invalid_limit", "Query parameter 'limit' must be a positive integer")
+			return
+		}
+		limit = parsed
+	}
+
+	requests := s.SlowRequests.Recent(limit)
+	config := s.SlowRequests.Config()
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{
+		"thresholds": map[string]interface{}{
+			"latency": config.Latency.String(),
+			"tokens":  config.Tokens,
+			"size":    config.Size,
+		},
+		"requests":   requests,
+		"total":      len(requests),
+	}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Slow requests retrieved successfully"
+	respondJSON(w, http.StatusOK, response)
+}
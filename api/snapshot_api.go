@@ -0,0 +1,126 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Dsouza10082/orus"
+)
+
+type CreateSnapshotRequest struct {
+	Collection string `json:"collection" swaggertype:"string" example:"rag_documents"`
+}
+
+func (r *CreateSnapshotRequest) Validate() *orus.ValidationError {
+	if strings.TrimSpace(r.Collection) == "" {
+		return &orus.ValidationError{Code: "missing_collection", Field: "collection", Message: "Field 'collection' is required"}
+	}
+	return nil
+}
+
+// ListSnapshots godoc
+// @Summary      Lists the snapshots of the vector collections
+// @Description  Lists the snapshots kept in the snapshot store, oldest first. Requires an admin key
+// @Tags         snapshots
+// @Produce      json
+// @Param        collection  query  string  false  "Only the snapshots of this collection"
+// @Success      200  {object}  OrusResponse
+// @Failure      401  {object}  OrusResponse
+// @Failure      500  {object}  OrusResponse
+// @Failure      503  {object}  OrusResponse
+// @Router       /orus-api/v1/snapshots [get]
+func (s *OrusAPI) ListSnapshots(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	snapshots, err := s.Orus.ListSnapshots(r.URL.Query().Get("collection"))
+	if errors.Is(err, orus.ErrSnapshotsDisabled) {
+		respondError(w, http.StatusServiceUnavailable, "snapshots_disabled", err.Error())
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "snapshots_unavailable", err.Error())
+		return
+	}
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{"snapshots": snapshots}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Snapshots retrieved successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// CreateSnapshot godoc
+// @Summary      Snapshots a vector collection
+// @Description  Writes the documents of a vector collection, embeddings included, to the snapshot store: a directory of ORUS_API_BLOB_DIR, or the S3 bucket. Requires an admin key
+// @Tags         snapshots
+// @Accept       json
+// @Produce      json
+// @Param        request  body  CreateSnapshotRequest  true  "Collection"
+// @Success      200  {object}  OrusResponse
+// @Failure      400  {object}  OrusResponse
+// @Failure      401  {object}  OrusResponse
+// @Failure      404  {object}  OrusResponse
+// @Failure      500  {object}  OrusResponse
+// @Failure      503  {object}  OrusResponse
+// @Router       /orus-api/v1/snapshots [post]
+func (s *OrusAPI) CreateSnapshot(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	request, ok := decodeJSON[CreateSnapshotRequest](w, r)
+	if !ok {
+		return
+	}
+	snapshot, err := s.SnapshotCollection(strings.TrimSpace(request.Collection))
+	switch {
+	case errors.Is(err, orus.ErrSnapshotsDisabled):
+		respondError(w, http.StatusServiceUnavailable, "snapshots_disabled", err.Error())
+		return
+	case errors.Is(err, orus.ErrCollectionNotFound):
+		respondError(w, http.StatusNotFound, "collection_not_found", err.Error())
+		return
+	case err != nil:
+		respondError(w, http.StatusInternalServerError, "snapshot_failed", err.Error())
+		return
+	}
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{"snapshot": snapshot}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Snapshot created successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// GetSnapshotFile godoc
+// @Summary      Downloads a snapshot
+// @Description  Returns a snapshot as the JSON array of the documents of its collection. Requires an admin key
+// @Tags         snapshots
+// @Produce      json
+// @Param        name  query  string  true  "Snapshot name, as listed"
+// @Success      200  {file}  file
+// @Failure      400  {object}  OrusResponse
+// @Failure      401  {object}  OrusResponse
+// @Failure      404  {object}  OrusResponse
+// @Failure      503  {object}  OrusResponse
+// @Router       /orus-api/v1/snapshots/file [get]
+func (s *OrusAPI) GetSnapshotFile(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		respondError(w, http.StatusBadRequest, "missing_name", "Query parameter 'name' is required")
+		return
+	}
+	if s.Snapshots == nil {
+		respondError(w, http.StatusServiceUnavailable, "snapshots_disabled", orus.ErrSnapshotsDisabled.Error())
+		return
+	}
+	data, err := s.Snapshots.Get(name)
+	if errors.Is(err, orus.ErrBlobNotFound) {
+		respondError(w, http.StatusNotFound, "snapshot_not_found", "snapshot not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "snapshot_unavailable", err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+strings.ReplaceAll(name, "/", "-")+"\"")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
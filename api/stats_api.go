@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+	"time"
+)
+
+// GetModelStats godoc
+// @Summary      Returns the speed of each model
+// @Description  Returns, for each model called since the server started, the requests, errors and tokens, and the distributions of the end-to-end latency, the time to first token and the generation speed in tokens per second, with their mean, percentiles and cumulative buckets to chart
+// @Tags         stats
+// @Produce      json
+// @Success      200  {object}  OrusResponse
+// @Router       /orus-api/v1/stats/models [get]
+func (s *OrusAPI) GetModelStats(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	models := s.ModelStats.Snapshot()
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{
+		"models": models,
+		"total":  len(models),
+	}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Model stats retrieved successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// GetEvictionStats godoc
+// @Summary      Returns the evictions of the caches and stores
+// @Description  Returns how many entries of the response and embedding caches, idempotency keys, uploaded images and sessions were removed since the server started, by store and reason: expired, capacity for the least recently used entries of a full cache, idle for the sessions past ORUS_API_SESSION_TTL. The last run of the janitor, which removes them every ORUS_API_JANITOR_INTERVAL, is returned along
+// @Tags         stats
+// @Produce      json
+// @Success      200  {object}  OrusResponse
+// @Router       /orus-api/v1/stats/evictions [get]
+func (s *OrusAPI) GetEvictionStats(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{
+		"evictions":   s.Evictions.Snapshot(),
+		"janitor_run": s.Janitor.LastRun(),
+	}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Eviction stats retrieved successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// Metrics godoc
+// @Summary      Prometheus metrics
+// @Description  Returns the model stats in the Prometheus text format: the requests, errors and tokens of each model, and the histograms of its latency, time to first token and tokens per second; the entries evicted from the caches and stores, by store and reason; and the open event streams and the ones rejected over the stream limits
+// @Tags         stats
+// @Produce      plain
+// @Success      200  {string}  string
+// @Router       /metrics [get]
+func (s *OrusAPI) Metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := s.ModelStats.WritePrometheus(w); err != nil {
+		respondError(w, http.StatusInternalServerError, "metrics_error", err.Error())
+		return
+	}
+	_ = s.Evictions.WritePrometheus(w)
+	_ = s.StreamConnections.WritePrometheus(w)
+}
@@ -0,0 +1,235 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Dsouza10082/orus"
+	"github.com/google/uuid"
+)
+
+// StreamBuffers keeps the latest events of the streaming generations by
+// stream ID, so a client whose connection dropped resumes a stream from the
+// Last-Event-ID it received, with GET /orus-api/v1/streams/{id}, instead of
+// losing the rest of a long generation. A generation goes on without a
+// client for the resume timeout, and its events are kept for as long once
+// it ended.
+type StreamBuffers struct {
+	mu      sync.Mutex
+	streams map[string]*streamBuffer
+}
+
+func NewStreamBuffers() *StreamBuffers {
+	return &StreamBuffers{streams: make(map[string]*streamBuffer)}
+}
+
+// bufferedEvent is an event as it was written, with its seq.
+type bufferedEvent struct {
+	seq   int64
+	event StreamEvent
+	data  []byte
+}
+
+type streamBuffer struct {
+	// owner is the digest of the API key that started the stream, the only
+	// one that may resume it.
+	owner   [sha256.Size]byte
+	size    int
+	timeout time.Duration
+	// cancel stops the generation; forget removes the stream.
+	cancel context.CancelFunc
+	forget func()
+
+	mu     sync.Mutex
+	events []bufferedEvent
+	ended  bool
+	// changed is closed when an event is added or the stream ends.
+	changed chan struct{}
+	clients int
+	idle    *time.Timer
+}
+
+// streamOwner is the digest of the API key of r.
+func streamOwner(r *http.Request) [sha256.Size]byte {
+	return sha256.Sum256([]byte(orus.RequestAPIKey(r)))
+}
+
+// Start starts the event stream of a generation on w, answering 500 and
+// returning false when w cannot be flushed, and returning false when the
+// stream was rejected over the stream limits. The chunks of the generation
+// are batched as config says; it runs with the returned context and must
+// Close the stream once it finished.
+//
+// With a resume timeout the stream is announced in the X-Stream-Id header
+// and its events are buffered; the context then outlives the request,
+// within its deadline, and a write to a client that went away is not an
+// error, so the generation goes on for a client that resumes it. Without
+// one this is NewEventStream, with the context of r.
+func (b *StreamBuffers) Start(w http.ResponseWriter, r *http.Request, config orus.StreamConfig) (*EventStream, context.Context, bool) {
+	if config.ResumeTimeout <= 0 {
+		events, ok := NewEventStream(w)
+		if !ok || streamRejected(r) {
+			return nil, nil, false
+		}
+		events.batchChunks(config)
+		return events, r.Context(), true
+	}
+	id := uuid.New().String()
+	w.Header().Set("X-Stream-Id", id)
+	events, ok := NewEventStream(w)
+	if !ok || streamRejected(r) {
+		return nil, nil, false
+	}
+	buffer, ctx := b.open(id, streamOwner(r), r, config, nil)
+	events.buffer = buffer
+	events.batchChunks(config)
+	return events, ctx, true
+}
+
+// open registers the buffered stream id of owner, with r as its first
+// client, and returns the context its generation runs with: it outlives r,
+// within its deadline, until the stream ends or expires. A stream already
+// registered as id is replaced, and forgotten is called once the stream is
+// forgotten.
+func (b *StreamBuffers) open(id string, owner [sha256.Size]byte, r *http.Request, config orus.StreamConfig, forgotten func()) (*streamBuffer, context.Context) {
+	base, cancel := context.WithCancelCause(context.WithoutCancel(r.Context()))
+	onCancel(r.Context(), cancel)
+	ctx, stop := base, context.CancelFunc(func() {})
+	if deadline, ok := r.Context().Deadline(); ok {
+		ctx, stop = context.WithDeadline(base, deadline)
+	}
+	buffer := &streamBuffer{
+		owner:   owner,
+		size:    max(config.Buffer, 1),
+		timeout: config.ResumeTimeout,
+		cancel: func() {
+			stop()
+			cancel(nil)
+		},
+		changed: make(chan struct{}),
+		clients: 1,
+	}
+	buffer.forget = func() {
+		b.mu.Lock()
+		if b.streams[id] == buffer {
+			delete(b.streams, id)
+		}
+		b.mu.Unlock()
+		if forgotten != nil {
+			forgotten()
+		}
+	}
+	b.mu.Lock()
+	b.streams[id] = buffer
+	b.mu.Unlock()
+	// the context of r ends when the client goes away or the handler returns
+	go func() {
+		<-r.Context().Done()
+		buffer.detach()
+	}()
+	return buffer, ctx
+}
+
+// get returns the stream id when it was started with the API key of r.
+func (b *StreamBuffers) get(id string, r *http.Request) *streamBuffer {
+	return b.lookup(id, streamOwner(r))
+}
+
+// lookup returns the stream id when it belongs to owner.
+func (b *StreamBuffers) lookup(id string, owner [sha256.Size]byte) *streamBuffer {
+	b.mu.Lock()
+	buffer := b.streams[id]
+	b.mu.Unlock()
+	if buffer == nil || subtle.ConstantTimeCompare(owner[:], buffer.owner[:]) != 1 {
+		return nil
+	}
+	return buffer
+}
+
+func (b *streamBuffer) add(event bufferedEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.events = append(b.events, event)
+	if len(b.events) > 2*b.size {
+		b.events = slices.Clone(b.events[len(b.events)-b.size:])
+	}
+	b.notify()
+}
+
+// end marks the stream ended, so its clients stop following it.
+func (b *streamBuffer) end() {
+	b.mu.Lock()
+	b.ended = true
+	b.notify()
+	if b.clients == 0 {
+		b.arm()
+	}
+	b.mu.Unlock()
+	b.cancel()
+}
+
+// since returns the events kept after seq, whether the stream ended, and a
+// channel closed at its next change.
+func (b *streamBuffer) since(seq int64) ([]bufferedEvent, bool, <-chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	events := b.events[max(len(b.events)-b.size, 0):]
+	i := sort.Search(len(events), func(i int) bool { return events[i].seq > seq })
+	return slices.Clone(events[i:]), b.ended, b.changed
+}
+
+func (b *streamBuffer) attach() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.clients++
+	if b.idle != nil {
+		b.idle.Stop()
+		b.idle = nil
+	}
+}
+
+func (b *streamBuffer) detach() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.clients--
+	if b.clients == 0 {
+		b.arm()
+	}
+}
+
+// notify wakes the clients following the stream. It must be called with mu
+// held.
+func (b *streamBuffer) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// arm expires the stream after the resume timeout without a client. It must
+// be called with mu held.
+func (b *streamBuffer) arm() {
+	if b.idle != nil {
+		b.idle.Stop()
+	}
+	b.idle = time.AfterFunc(b.timeout, b.expire)
+}
+
+// expire stops a generation nobody resumed, which ends the stream and arms
+// it again, or forgets a stream that ended.
+func (b *streamBuffer) expire() {
+	b.mu.Lock()
+	clients, ended := b.clients, b.ended
+	b.mu.Unlock()
+	switch {
+	case clients > 0:
+	case ended:
+		b.forget()
+	default:
+		b.cancel()
+	}
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Dsouza10082/orus"
+	"github.com/go-chi/chi/v5"
+)
+
+// streamRouter serves a generation streaming the given tokens, pausing
+// after the first one until proceed is closed, and the resume route.
+func streamRouter(streams *StreamBuffers, config orus.StreamConfig, tokens []string, paused chan<- context.Context, proceed <-chan struct{}) http.Handler {
+	s := &OrusAPI{Streams: streams}
+	router := chi.NewRouter()
+	router.Post("/generate", func(w http.ResponseWriter, r *http.Request) {
+		events, ctx, ok := streams.Start(w, r, config)
+		if !ok {
+			return
+		}
+		defer events.Close()
+		for i, token := range tokens {
+			if i == 1 {
+				paused <- ctx
+				<-proceed
+			}
+			if ctx.Err() != nil {
+				_ = events.Error("canceled", ctx.Err())
+				return
+			}
+			_ = events.Token(token)
+		}
+		_ = events.Done(DonePayload{Message: "done", Content: strings.Join(tokens, "")})
+	})
+	router.Get("/orus-api/v1/streams/{id}", s.ResumeStream)
+	return router
+}
+
+func TestStreamResumeAfterDisconnect(t *testing.T) {
+	config := orus.StreamConfig{Buffer: 16, ResumeTimeout: 5 * time.Second}
+	paused := make(chan context.Context, 1)
+	proceed := make(chan struct{})
+	router := streamRouter(NewStreamBuffers(), config, []string{"one ", "two ", "three"}, paused, proceed)
+
+	ctx, disconnect := context.WithCancel(context.Background())
+	r := httptest.NewRequest(http.MethodPost, "/generate", nil).WithContext(ctx)
+	r.Header.Set("X-API-Key", "owner-key")
+	first := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		router.ServeHTTP(first, r)
+	}()
+
+	// the client goes away after the first token, the generation goes on
+	generation := <-paused
+	disconnect()
+	time.Sleep(10 * time.Millisecond)
+	if err := generation.Err(); err != nil {
+		t.Fatalf("the generation stopped with its client: %v", err)
+	}
+	close(proceed)
+	<-done
+	id := first.Header().Get("X-Stream-Id")
+	if id == "" {
+		t.Fatal("the stream has no X-Stream-Id")
+	}
+
+	resume := func(key, lastEventID string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/orus-api/v1/streams/"+id, nil)
+		r.Header.Set("X-API-Key", key)
+		if lastEventID != "" {
+			r.Header.Set("Last-Event-ID", lastEventID)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := resume("owner-key", "1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("resuming answered %d: %s", w.Code, w.Body)
+	}
+	events := readEvents(t, w.Body.String())
+	var names, tokens []string
+	for _, event := range events {
+		names = append(names, event.name)
+		if event.name == string(EventToken) {
+			var token TokenPayload
+			if err := json.Unmarshal([]byte(event.data), &token); err != nil {
+				t.Fatal(err)
+			}
+			if token.Seq <= 1 {
+				t.Fatalf("resumed the event %d, received before Last-Event-ID", token.Seq)
+			}
+			tokens = append(tokens, token.Content)
+		}
+	}
+	if strings.Join(tokens, "") != "two three" || names[len(names)-1] != string(EventDone) {
+		t.Fatalf("resumed %v with the tokens %q, want the rest of the generation", names, tokens)
+	}
+
+	// from the start, every event is resumed
+	if events := readEvents(t, resume("owner-key", "").Body.String()); len(events) != 4 {
+		t.Fatalf("resumed %d events from the start, want 4", len(events))
+	}
+	if w := resume("other-key", "1"); w.Code != http.StatusNotFound {
+		t.Fatalf("resuming with another key answered %d, want 404", w.Code)
+	}
+	if w := resume("owner-key", "last"); w.Code != http.StatusBadRequest {
+		t.Fatalf("resuming after an invalid Last-Event-ID answered %d, want 400", w.Code)
+	}
+}
+
+func TestStreamExpiresWithoutClient(t *testing.T) {
+	config := orus.StreamConfig{Buffer: 16, ResumeTimeout: 20 * time.Millisecond}
+	streams := NewStreamBuffers()
+	paused := make(chan context.Context, 1)
+	proceed := make(chan struct{})
+	router := streamRouter(streams, config, []string{"one ", "two"}, paused, proceed)
+
+	ctx, disconnect := context.WithCancel(context.Background())
+	first := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		router.ServeHTTP(first, httptest.NewRequest(http.MethodPost, "/generate", nil).WithContext(ctx))
+	}()
+
+	// nobody resumes the generation within the timeout, so it is stopped
+	generation := <-paused
+	disconnect()
+	select {
+	case <-generation.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the generation nobody resumed was not stopped")
+	}
+	close(proceed)
+	<-done
+
+	// and the ended stream is forgotten after the timeout
+	id := first.Header().Get("X-Stream-Id")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		streams.mu.Lock()
+		_, kept := streams.streams[id]
+		streams.mu.Unlock()
+		if !kept {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the ended stream was kept after the resume timeout")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
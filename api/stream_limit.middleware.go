@@ -0,0 +1,269 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Dsouza10082/orus"
+)
+
+// errStreamRejected is returned by the writes of an event stream over the
+// limits, which was answered with an error instead.
+var errStreamRejected = errors.New("the event stream was rejected")
+
+// StreamConnections keeps the registry of the open event streams, by
+// caller, and caps them, so a buggy client that opens streams without
+// closing them cannot exhaust the file descriptors of the server. A stream
+// over the limits is answered 429, or 503 over the total, in place of its
+// first event.
+type StreamConnections struct {
+	mu       sync.Mutex
+	policy   orus.StreamLimitPolicy
+	next     int64
+	open     map[int64]*openStream
+	byCaller map[string]int
+	rejected int64
+}
+
+// openStream is a registered event stream.
+type openStream struct {
+	caller    string
+	method    string
+	path      string
+	startedAt time.Time
+}
+
+func NewStreamConnections(policy orus.StreamLimitPolicy) *StreamConnections {
+	return &StreamConnections{
+		policy:   policy,
+		open:     make(map[int64]*openStream),
+		byCaller: make(map[string]int),
+	}
+}
+
+// SetPolicy applies new limits to the streams opened from now on; the open
+// ones are kept.
+func (c *StreamConnections) SetPolicy(policy orus.StreamLimitPolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.policy = policy
+}
+
+// Middleware registers the responses of the routes it wraps that turn out
+// to be event streams, for as long as their handler runs. A stream over the
+// limits gets the error, its writes fail and its request context is
+// canceled with errStreamRejected, so the handler stops (see
+// streamRejected). Other responses are passed through.
+func (c *StreamConnections) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithCancelCause(r.Context())
+		defer cancel(nil)
+		sw := &streamLimitWriter{ResponseWriter: w, connections: c, r: r, cancel: cancel}
+		defer sw.release()
+		next.ServeHTTP(sw, r.WithContext(ctx))
+	})
+}
+
+// acquire registers a stream of r, or returns the status and the error that
+// reject it.
+func (c *StreamConnections) acquire(r *http.Request) (int64, int, string, string) {
+	caller := fairnessKey(r)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	policy := c.policy
+	if policy.Total > 0 && len(c.open) >= policy.Total {
+		c.rejected++
+		return 0, http.StatusServiceUnavailable, "stream_capacity",
+			fmt.Sprintf("The server has %d event streams open, please retry later", len(c.open))
+	}
+	if policy.PerCaller > 0 && c.byCaller[caller] >= policy.PerCaller {
+		c.rejected++
+		return 0, http.StatusTooManyRequests, "too_many_streams",
+			fmt.Sprintf("%d event streams are already open, close one before opening another", policy.PerCaller)
+	}
+	c.next++
+	c.open[c.next] = &openStream{caller: caller, method: r.Method, path: r.URL.Path, startedAt: time.Now()}
+	c.byCaller[caller]++
+	return c.next, 0, "", ""
+}
+
+func (c *StreamConnections) release(id int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stream := c.open[id]
+	if stream == nil {
+		return
+	}
+	delete(c.open, id)
+	if c.byCaller[stream.caller]--; c.byCaller[stream.caller] == 0 {
+		delete(c.byCaller, stream.caller)
+	}
+}
+
+// Open returns the number of open event streams.
+func (c *StreamConnections) Open() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.open)
+}
+
+// OpenStream is an open event stream.
+type OpenStream struct {
+	// Caller is "key:<fingerprint>" or "ip:<address>".
+	Caller    string    `json:"caller"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	StartedAt time.Time `json:"started_at" swaggertype:"string" example:"2021-01-01T00:00:00Z"`
+	// Duration is how long the stream has been open, in milliseconds.
+	Duration int64 `json:"duration_ms"`
+}
+
+// StreamConnectionStats is the registry of the open event streams.
+type StreamConnectionStats struct {
+	Limit    orus.StreamLimitPolicy `json:"limit"`
+	Open     int                    `json:"open"`
+	Rejected int64                  `json:"rejected"`
+	ByCaller map[string]int         `json:"by_caller"`
+	// Streams are the open streams, the oldest first.
+	Streams []OpenStream `json:"streams"`
+}
+
+func (c *StreamConnections) Stats() StreamConnectionStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := StreamConnectionStats{
+		Limit:    c.policy,
+		Open:     len(c.open),
+		Rejected: c.rejected,
+		ByCaller: make(map[string]int, len(c.byCaller)),
+		Streams:  make([]OpenStream, 0, len(c.open)),
+	}
+	for caller, open := range c.byCaller {
+		stats.ByCaller[caller] = open
+	}
+	now := time.Now()
+	for _, stream := range c.open {
+		stats.Streams = append(stats.Streams, OpenStream{
+			Caller:    stream.caller,
+			Method:    stream.method,
+			Path:      stream.path,
+			StartedAt: stream.startedAt,
+			Duration:  now.Sub(stream.startedAt).Milliseconds(),
+		})
+	}
+	sort.Slice(stats.Streams, func(i, j int) bool {
+		return stats.Streams[i].StartedAt.Before(stats.Streams[j].StartedAt)
+	})
+	return stats
+}
+
+// WritePrometheus writes the open and rejected streams in the Prometheus
+// text format.
+func (c *StreamConnections) WritePrometheus(w io.Writer) error {
+	c.mu.Lock()
+	open, rejected := len(c.open), c.rejected
+	c.mu.Unlock()
+	out := &bytes.Buffer{}
+	fmt.Fprintf(out, "# HELP orus_open_streams Event streams open.\n# TYPE orus_open_streams gauge\n")
+	fmt.Fprintf(out, "orus_open_streams %d\n", open)
+	fmt.Fprintf(out, "# HELP orus_rejected_streams_total Event streams rejected over the stream limits.\n# TYPE orus_rejected_streams_total counter\n")
+	fmt.Fprintf(out, "orus_rejected_streams_total %d\n", rejected)
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// streamLimitWriter registers the response once it turns out to be an
+// event stream, on its first write.
+type streamLimitWriter struct {
+	http.ResponseWriter
+	connections *StreamConnections
+	r           *http.Request
+	cancel      context.CancelCauseFunc
+
+	checked  bool
+	rejected bool
+	id       int64
+}
+
+func (w *streamLimitWriter) WriteHeader(status int) {
+	if w.check(status) {
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (w *streamLimitWriter) Write(data []byte) (int, error) {
+	if !w.check(http.StatusOK) {
+		return 0, errStreamRejected
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *streamLimitWriter) Flush() {
+	if !w.check(http.StatusOK) {
+		return
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *streamLimitWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the writer of the connection, to
+// set its deadlines.
+func (w *streamLimitWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// check registers a successful event stream on its first write, or rejects
+// it, and reports whether the response may be written.
+func (w *streamLimitWriter) check(status int) bool {
+	if w.checked {
+		return !w.rejected
+	}
+	w.checked = true
+	if status != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		return true
+	}
+	id, status, code, message := w.connections.acquire(w.r)
+	if status == 0 {
+		w.id = id
+		return true
+	}
+	w.rejected = true
+	w.cancel(errStreamRejected)
+	header := w.Header()
+	header.Del("Cache-Control")
+	header.Del("Connection")
+	header.Del("X-Accel-Buffering")
+	// the stream was refused, so there is nothing to resume
+	header.Del("X-Stream-Id")
+	header.Set("Retry-After", "1")
+	respondError(w.ResponseWriter, status, code, message)
+	return false
+}
+
+// streamRejected reports whether the event stream started on the response
+// of r was rejected over the stream limits; its handler must not start the
+// work it streams, in particular not with a context that outlives r.
+func streamRejected(r *http.Request) bool {
+	return errors.Is(context.Cause(r.Context()), errStreamRejected)
+}
+
+func (w *streamLimitWriter) release() {
+	if w.id != 0 {
+		w.connections.release(w.id)
+	}
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Dsouza10082/orus"
+)
+
+// resumableStream is a handler streaming a resumable generation that runs
+// until release is closed, counting the generations it started.
+func resumableStream(streams *StreamBuffers, started chan<- bool, release <-chan struct{}, generations *atomic.Int32) http.Handler {
+	config := orus.StreamConfig{Buffer: 16, ResumeTimeout: orus.DefaultStreamResumeTimeout}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		events, ctx, ok := streams.Start(w, r, config)
+		started <- ok
+		if !ok {
+			return
+		}
+		generations.Add(1)
+		defer events.Close()
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		_ = events.Done(DonePayload{Message: "done"})
+	})
+}
+
+func TestStreamLimitRejectsBeforeTheGeneration(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		policy orus.StreamLimitPolicy
+		status int
+	}{
+		{"per caller", orus.StreamLimitPolicy{PerCaller: 1}, http.StatusTooManyRequests},
+		{"total", orus.StreamLimitPolicy{Total: 1}, http.StatusServiceUnavailable},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			connections := NewStreamConnections(test.policy)
+			started := make(chan bool, 3)
+			release := make(chan struct{})
+			var generations atomic.Int32
+			handler := connections.Middleware(resumableStream(NewStreamBuffers(), started, release, &generations))
+
+			first := httptest.NewRecorder()
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				handler.ServeHTTP(first, httptest.NewRequest(http.MethodPost, "/stream", nil))
+			}()
+			if !<-started {
+				t.Fatal("the first stream was not started")
+			}
+
+			second := httptest.NewRecorder()
+			handler.ServeHTTP(second, httptest.NewRequest(http.MethodPost, "/stream", nil))
+			if <-started {
+				t.Fatal("Start returned true for a rejected stream")
+			}
+			if second.Code != test.status {
+				t.Fatalf("rejected stream answered %d, want %d", second.Code, test.status)
+			}
+			if id := second.Header().Get("X-Stream-Id"); id != "" {
+				t.Fatalf("rejected stream announced stream %s", id)
+			}
+			if second.Header().Get("Retry-After") == "" {
+				t.Fatal("rejected stream has no Retry-After")
+			}
+			if n := generations.Load(); n != 1 {
+				t.Fatalf("%d generations started, want 1", n)
+			}
+			if stats := connections.Stats(); stats.Open != 1 || stats.Rejected != 1 {
+				t.Fatalf("open %d rejected %d, want 1 and 1", stats.Open, stats.Rejected)
+			}
+
+			close(release)
+			<-done
+			if first.Code != http.StatusOK || first.Header().Get("X-Stream-Id") == "" {
+				t.Fatalf("first stream answered %d with stream %q", first.Code, first.Header().Get("X-Stream-Id"))
+			}
+			if open := connections.Open(); open != 0 {
+				t.Fatalf("%d streams open once they ended, want 0", open)
+			}
+
+			// the slot is free again
+			third := httptest.NewRecorder()
+			handler.ServeHTTP(third, httptest.NewRequest(http.MethodPost, "/stream", nil))
+			if !<-started || third.Code != http.StatusOK {
+				t.Fatalf("stream after the first one ended answered %d", third.Code)
+			}
+		})
+	}
+}
+
+func TestStreamLimitConcurrentCallers(t *testing.T) {
+	const callers, perCaller = 8, 2
+	connections := NewStreamConnections(orus.StreamLimitPolicy{PerCaller: perCaller})
+	started := make(chan bool, callers*perCaller*2)
+	release := make(chan struct{})
+	var generations atomic.Int32
+	handler := connections.Middleware(resumableStream(NewStreamBuffers(), started, release, &generations))
+
+	var wg sync.WaitGroup
+	codes := make(chan int, callers*perCaller*2)
+	for caller := 0; caller < callers; caller++ {
+		for i := 0; i < perCaller*2; i++ {
+			wg.Add(1)
+			go func(caller int) {
+				defer wg.Done()
+				r := httptest.NewRequest(http.MethodPost, "/stream", nil)
+				r.RemoteAddr = "192.0.2." + string(rune('1'+caller)) + ":1234"
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+				codes <- w.Code
+			}(caller)
+		}
+	}
+	// every caller gets perCaller streams, the others are rejected at once
+	deadline := time.After(10 * time.Second)
+	for i := 0; i < callers*perCaller*2; i++ {
+		select {
+		case <-started:
+		case <-deadline:
+			t.Fatal("the streams did not start")
+		}
+	}
+	if n := generations.Load(); n != callers*perCaller {
+		t.Fatalf("%d generations started, want %d", n, callers*perCaller)
+	}
+	stats := connections.Stats()
+	if stats.Open != callers*perCaller || stats.Rejected != callers*perCaller {
+		t.Fatalf("open %d rejected %d, want %d each", stats.Open, stats.Rejected, callers*perCaller)
+	}
+	for caller, open := range stats.ByCaller {
+		if open != perCaller {
+			t.Fatalf("%s has %d streams open, want %d", caller, open, perCaller)
+		}
+	}
+	close(release)
+	wg.Wait()
+	close(codes)
+	count := map[int]int{}
+	for code := range codes {
+		count[code]++
+	}
+	if count[http.StatusOK] != callers*perCaller || count[http.StatusTooManyRequests] != callers*perCaller {
+		t.Fatalf("answered %v", count)
+	}
+	if open := connections.Open(); open != 0 {
+		t.Fatalf("%d streams open once they ended, want 0", open)
+	}
+}
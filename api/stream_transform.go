@@ -0,0 +1,590 @@
+package api
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// The post-processors a request may apply to the answer of a generation,
+// by the name it gives them in transforms.
+const (
+	TransformSanitizeMarkdown = "sanitize_markdown"
+	TransformExtractCode      = "extract_code"
+	TransformMaskProfanity    = "mask_profanity"
+	TransformTrimWhitespace   = "trim_trailing_whitespace"
+)
+
+var streamTransforms = map[string]func() streamTransform{
+	TransformSanitizeMarkdown: func() streamTransform { return &markdownSanitizer{} },
+	TransformExtractCode:      func() streamTransform { return &codeExtractor{} },
+	TransformMaskProfanity:    func() streamTransform { return &profanityMask{} },
+	TransformTrimWhitespace:   func() streamTransform { return &whitespaceTrimmer{} },
+}
+
+// TransformNames returns the names of the post-processors, sorted.
+func TransformNames() []string {
+	names := make([]string, 0, len(streamTransforms))
+	for name := range streamTransforms {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// streamTransform rewrites the answer of a generation as its pieces are
+// streamed. It only holds back the end of a piece it cannot decide on yet,
+// such as a word or a tag cut in two, so the answer keeps streaming; the
+// pieces it returns put together are the same whatever the answer was cut
+// into.
+type streamTransform interface {
+	// Write reads a piece of the answer and returns what can be sent of it.
+	Write(piece string) string
+	// Close returns what was held back, once the answer ended.
+	Close() string
+}
+
+// transformChain applies its transforms in order, each to what the one
+// before it returned.
+type transformChain []streamTransform
+
+// newTransformChain returns the chain of the named transforms, which were
+// validated, or nil for none.
+func newTransformChain(names []string) transformChain {
+	if len(names) == 0 {
+		return nil
+	}
+	chain := make(transformChain, 0, len(names))
+	for _, name := range names {
+		chain = append(chain, streamTransforms[name]())
+	}
+	return chain
+}
+
+func (c transformChain) Write(piece string) string {
+	for _, transform := range c {
+		if piece == "" {
+			return ""
+		}
+		piece = transform.Write(piece)
+	}
+	return piece
+}
+
+func (c transformChain) Close() string {
+	tail := ""
+	for _, transform := range c {
+		if tail != "" {
+			tail = transform.Write(tail)
+		}
+		tail += transform.Close()
+	}
+	return tail
+}
+
+// transformText applies the named transforms to a whole answer, the way
+// they are applied to its streamed pieces.
+func transformText(names []string, text string) string {
+	chain := newTransformChain(names)
+	if chain == nil {
+		return text
+	}
+	return chain.Write(text) + chain.Close()
+}
+
+// whitespaceTrimmer drops the spaces and tabs at the end of the lines, and
+// the whitespace at the end of the answer. A run of whitespace is held until
+// the next character tells whether it ends a line.
+type whitespaceTrimmer struct {
+	held []byte
+}
+
+func (t *whitespaceTrimmer) Write(piece string) string {
+	var out strings.Builder
+	for i := 0; i < len(piece); i++ {
+		c := piece[i]
+		if c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+			t.held = append(t.held, c)
+			continue
+		}
+		if len(t.held) > 0 {
+			lines := strings.Split(string(t.held), "\n")
+			for j := range lines[:len(lines)-1] {
+				line, crlf := strings.CutSuffix(lines[j], "\r")
+				lines[j] = strings.TrimRight(line, " \t")
+				if crlf {
+					lines[j] += "\r"
+				}
+			}
+			out.WriteString(strings.Join(lines, "\n"))
+			t.held = t.held[:0]
+		}
+		out.WriteByte(c)
+	}
+	return out.String()
+}
+
+func (t *whitespaceTrimmer) Close() string {
+	t.held = nil
+	return ""
+}
+
+// profanities are the words masked by mask_profanity, with the suffixes of
+// profanitySuffixes.
+var profanities = map[string]bool{
+	"arse": true, "arsehole": true, "asshole": true, "bastard": true,
+	"bitch": true, "bollocks": true, "bullshit": true, "cock": true,
+	"crap": true, "cunt": true, "damn": true, "dick": true, "fuck": true,
+	"motherfuck": true, "motherfucker": true, "piss": true, "prick": true,
+	"shit": true, "shitty": true, "slut": true, "twat": true, "wank": true, "wanker": true,
+	"whore": true,
+}
+
+var profanitySuffixes = []string{"s", "es", "ed", "er", "ers", "ing", "in", "y"}
+
+// maxProfanity is the longest word that may be masked; a longer word is
+// sent as it comes.
+const maxProfanity = 16
+
+// profanityMask masks the profanities, whole words only, keeping their
+// first letter. The word at the end of a piece is held until it ends.
+type profanityMask struct {
+	word []byte
+	// long is set within a word too long to be masked
+	long bool
+}
+
+func (m *profanityMask) Write(piece string) string {
+	var out strings.Builder
+	for i := 0; i < len(piece); i++ {
+		c := piece[i]
+		if !isWordByte(c) {
+			out.WriteString(m.endWord())
+			out.WriteByte(c)
+			continue
+		}
+		if m.long {
+			out.WriteByte(c)
+			continue
+		}
+		m.word = append(m.word, c)
+		if len(m.word) > maxProfanity {
+			out.Write(m.word)
+			m.word = m.word[:0]
+			m.long = true
+		}
+	}
+	return out.String()
+}
+
+func (m *profanityMask) Close() string {
+	return m.endWord()
+}
+
+// endWord returns the word that ended, masked when it is a profanity.
+func (m *profanityMask) endWord() string {
+	word := string(m.word)
+	m.word = m.word[:0]
+	m.long = false
+	if !isProfanity(strings.ToLower(word)) {
+		return word
+	}
+	_, size := utf8.DecodeRuneInString(word)
+	return word[:size] + strings.Repeat("*", utf8.RuneCountInString(word[size:]))
+}
+
+func isProfanity(word string) bool {
+	if profanities[word] {
+		return true
+	}
+	for _, suffix := range profanitySuffixes {
+		if stem, ok := strings.CutSuffix(word, suffix); ok && profanities[stem] {
+			return true
+		}
+	}
+	return false
+}
+
+// isWordByte reports whether c is part of a word: an ASCII letter, or a
+// byte of a non-ASCII rune, so a rune is never cut.
+func isWordByte(c byte) bool {
+	return isASCIILetter(c) || c >= utf8.RuneSelf
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// The states of a line read by codeExtractor.
+const (
+	// the line may still be a fence, and is held
+	lineUndecided = iota
+	// the line is code, sent as it comes
+	lineCode
+	// the line is prose, dropped
+	lineProse
+	// the line opens a fence
+	lineOpening
+	// the line may close the fence, and is held until it ends
+	lineClosing
+)
+
+// codeExtractor keeps only the code of the fenced blocks of the answer, the
+// blocks separated by an empty line. The start of a line is held until it
+// is known whether it is a fence.
+type codeExtractor struct {
+	inFence   bool
+	fenceChar byte
+	fenceLen  int
+	blocks    int
+
+	line  []byte
+	state int
+}
+
+func (e *codeExtractor) Write(piece string) string {
+	var out strings.Builder
+	for i := 0; i < len(piece); i++ {
+		c := piece[i]
+		if c == '\n' {
+			out.WriteString(e.endLine(true))
+			continue
+		}
+		switch e.state {
+		case lineCode:
+			out.WriteByte(c)
+		case lineProse, lineOpening:
+		case lineClosing:
+			e.line = append(e.line, c)
+		default:
+			e.line = append(e.line, c)
+			out.WriteString(e.decide(false))
+		}
+	}
+	return out.String()
+}
+
+func (e *codeExtractor) Close() string {
+	return e.endLine(false)
+}
+
+// decide moves a held line to its state once it is known, and returns what
+// is sent of it. ended is set when the line is whole.
+func (e *codeExtractor) decide(ended bool) string {
+	char, run, rest, possible := fencePrefix(e.line)
+	if possible && !ended {
+		return ""
+	}
+	switch {
+	case run < 3:
+	case !e.inFence:
+		if char == '`' && bytes.IndexByte(rest, '`') >= 0 {
+			// an info string with a backtick makes inline code, not a fence
+			break
+		}
+		e.state = lineOpening
+		e.fenceChar, e.fenceLen = char, run
+		return ""
+	case char == e.fenceChar && run >= e.fenceLen:
+		e.state = lineClosing
+		return ""
+	}
+	if !e.inFence {
+		e.state = lineProse
+		return ""
+	}
+	e.state = lineCode
+	line := string(e.line)
+	e.line = e.line[:0]
+	return line
+}
+
+// endLine ends the line being read, with its newline when newline is set.
+func (e *codeExtractor) endLine(newline bool) string {
+	out := ""
+	if e.state == lineUndecided {
+		out = e.decide(true)
+	}
+	switch e.state {
+	case lineCode:
+		if newline {
+			out += "\n"
+		}
+	case lineOpening:
+		e.inFence = true
+		if e.blocks > 0 && newline {
+			out += "\n"
+		}
+		e.blocks++
+	case lineClosing:
+		if e.closes() {
+			e.inFence = false
+			break
+		}
+		out += string(e.line)
+		if newline {
+			out += "\n"
+		}
+	}
+	e.line = e.line[:0]
+	e.state = lineUndecided
+	return out
+}
+
+// closes reports whether the held line closes the fence: its fence is only
+// followed by whitespace.
+func (e *codeExtractor) closes() bool {
+	_, _, rest, _ := fencePrefix(e.line)
+	return len(bytes.TrimSpace(rest)) == 0
+}
+
+// fencePrefix reads the fence line may start with: up to 3 spaces, then a
+// run of backticks or tildes, of char, followed by rest. possible is set
+// while line is short of telling whether it is a fence.
+func fencePrefix(line []byte) (char byte, run int, rest []byte, possible bool) {
+	indent := 0
+	for indent < len(line) && line[indent] == ' ' {
+		indent++
+	}
+	if indent > 3 {
+		return 0, 0, nil, false
+	}
+	if indent == len(line) {
+		return 0, 0, nil, true
+	}
+	char = line[indent]
+	if char != '`' && char != '~' {
+		return 0, 0, nil, false
+	}
+	for indent+run < len(line) && line[indent+run] == char {
+		run++
+	}
+	rest = line[indent+run:]
+	return char, run, rest, len(rest) == 0
+}
+
+// dangerousSchemes are the link targets sanitize_markdown neutralizes.
+var dangerousSchemes = []string{"javascript:", "vbscript:", "data:"}
+
+// maxHeldTag is how long a raw HTML tag may be; a longer one is escaped.
+const maxHeldTag = 256
+
+// The states of markdownSanitizer.
+const (
+	markdownText = iota
+	// a run of backticks is held
+	markdownTicks
+	// a raw HTML tag is held
+	markdownTag
+	// a ] is held, that may start a link target
+	markdownBracket
+	// the start of a link target is held, until its scheme is known
+	markdownTarget
+	// a dangerous link target is dropped
+	markdownDropTarget
+)
+
+// markdownSanitizer drops the raw HTML tags and comments of the answer and
+// neutralizes the links to dangerous schemes, outside the code spans and
+// blocks, which are sent as they are. A tag, a run of backticks or the
+// start of a link target is held until it ends.
+type markdownSanitizer struct {
+	state int
+	held  []byte
+	// code is the length of the run of backticks that opened the code being
+	// read, or 0
+	code int
+	// newline is set after a newline, until a character other than
+	// whitespace; attrs is set once the name of the held tag was read
+	newline bool
+	attrs   bool
+	// parens counts the parentheses open in a dropped link target
+	parens int
+}
+
+func (m *markdownSanitizer) Write(piece string) string {
+	var out strings.Builder
+	for i := 0; i < len(piece); i++ {
+		m.step(&out, piece[i])
+	}
+	return out.String()
+}
+
+func (m *markdownSanitizer) Close() string {
+	out := &strings.Builder{}
+	switch m.state {
+	case markdownTicks:
+		m.endTicks(out)
+	case markdownTag:
+		m.escapeTag(out)
+	case markdownBracket, markdownTarget:
+		out.Write(m.held)
+	}
+	m.held = nil
+	m.state = markdownText
+	return out.String()
+}
+
+func (m *markdownSanitizer) step(out *strings.Builder, c byte) {
+	switch m.state {
+	case markdownTicks:
+		if c == '`' {
+			m.held = append(m.held, c)
+			return
+		}
+		m.endTicks(out)
+	case markdownTag:
+		if m.tag(out, c) {
+			return
+		}
+	case markdownBracket:
+		if c == '(' {
+			m.held = append(m.held, c)
+			m.state = markdownTarget
+			return
+		}
+		m.release(out)
+	case markdownTarget:
+		if m.target(out, c) {
+			return
+		}
+	case markdownDropTarget:
+		switch {
+		case c == '(':
+			m.parens++
+		case c == ')' && m.parens > 0:
+			m.parens--
+		case c == ')' || c == '\n':
+			out.WriteByte(c)
+			m.state = markdownText
+		}
+		return
+	}
+	m.text(out, c)
+}
+
+// text reads c outside anything held.
+func (m *markdownSanitizer) text(out *strings.Builder, c byte) {
+	if c == '\n' {
+		if m.newline && m.code > 0 && m.code < 3 {
+			// a code span does not go past a paragraph
+			m.code = 0
+		}
+		m.newline = true
+	} else if c != ' ' && c != '\t' && c != '\r' {
+		m.newline = false
+	}
+	switch {
+	case c == '`':
+		m.held = append(m.held[:0], c)
+		m.state = markdownTicks
+	case m.code > 0:
+		out.WriteByte(c)
+	case c == '<':
+		m.held = append(m.held[:0], c)
+		m.attrs = false
+		m.state = markdownTag
+	case c == ']':
+		m.held = append(m.held[:0], c)
+		m.state = markdownBracket
+	default:
+		out.WriteByte(c)
+	}
+}
+
+// endTicks sends a run of backticks, which opens or closes code.
+func (m *markdownSanitizer) endTicks(out *strings.Builder) {
+	switch run := len(m.held); {
+	case m.code == 0:
+		m.code = run
+	case m.code == run:
+		m.code = 0
+	}
+	m.release(out)
+}
+
+// tag reads c within a tag, and reports whether it was taken; otherwise the
+// held < is sent and c is read as text.
+func (m *markdownSanitizer) tag(out *strings.Builder, c byte) bool {
+	kind := byte(0)
+	if len(m.held) > 1 {
+		kind = m.held[1]
+	}
+	name := bytes.TrimPrefix(m.held[1:], []byte{'/'})
+	switch {
+	case len(m.held) == 1 && (c == '/' || c == '!' || c == '?' || isASCIILetter(c)):
+	case len(m.held) == 1:
+		m.release(out)
+		return false
+	case kind == '!' || kind == '?' || m.attrs:
+		if c == '>' {
+			m.held = m.held[:0]
+			m.state = markdownText
+			return true
+		}
+	case len(name) == 0:
+		// </ must be followed by the name of a tag
+		if !isASCIILetter(c) {
+			m.release(out)
+			return false
+		}
+	case isASCIILetter(c) || (c >= '0' && c <= '9') || c == '-':
+	case c == '>':
+		m.held = m.held[:0]
+		m.state = markdownText
+		return true
+	case c == ' ' || c == '\t' || c == '\n' || c == '/':
+		m.attrs = true
+	case c == ':' && slices.Contains(dangerousSchemes, strings.ToLower(string(name))+":"):
+		// an autolink to a dangerous scheme
+		m.escapeTag(out)
+		return false
+	default:
+		m.release(out)
+		return false
+	}
+	m.held = append(m.held, c)
+	if len(m.held) > maxHeldTag {
+		m.escapeTag(out)
+	}
+	return true
+}
+
+// escapeTag sends the held tag with its < escaped, so it shows as text.
+func (m *markdownSanitizer) escapeTag(out *strings.Builder) {
+	if len(m.held) > 1 {
+		out.WriteString("&lt;")
+		m.held = m.held[1:]
+	}
+	m.release(out)
+}
+
+// target reads c at the start of a link target, and reports whether it was
+// taken; otherwise what was held is sent and c is read as text.
+func (m *markdownSanitizer) target(out *strings.Builder, c byte) bool {
+	held := append(m.held, c)
+	scheme := strings.ToLower(strings.TrimLeft(string(held[2:]), " <"))
+	if slices.Contains(dangerousSchemes, scheme) {
+		out.WriteString("](#")
+		m.held = m.held[:0]
+		m.parens = 0
+		m.state = markdownDropTarget
+		return true
+	}
+	for _, dangerous := range dangerousSchemes {
+		if strings.HasPrefix(dangerous, scheme) && len(held) < 64 {
+			m.held = held
+			return true
+		}
+	}
+	m.release(out)
+	return false
+}
+
+// release sends what was held, which is read as text.
+func (m *markdownSanitizer) release(out *strings.Builder) {
+	out.Write(m.held)
+	m.held = m.held[:0]
+	m.state = markdownText
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ResumeStream godoc
+// @Summary      Resumes a generation stream
+// @Description  Sends the events of a streaming generation after the Last-Event-ID header, or the last_event_id query parameter, then follows the stream until it ends. The ID is the X-Stream-Id header of the generation; a stream can be resumed for ORUS_API_STREAM_RESUME_TIMEOUT after its client went away or it ended, with the API key that started it
+// @Tags         llm
+// @Produce      text/event-stream
+// @Param        id             path    string  true   "Stream ID"
+// @Param        Last-Event-ID  header  int     false  "Seq of the last event received"
+// @Success      200
+// @Failure      400  {object}  OrusResponse
+// @Failure      404  {object}  OrusResponse
+// @Router       /orus-api/v1/streams/{id} [get]
+func (s *OrusAPI) ResumeStream(w http.ResponseWriter, r *http.Request) {
+	buffer := s.Streams.get(chi.URLParam(r, "id"), r)
+	if buffer == nil {
+		respondError(w, http.StatusNotFound, "stream_not_found", "The stream is unknown or expired")
+		return
+	}
+	last := r.Header.Get("Last-Event-ID")
+	if last == "" {
+		last = r.URL.Query().Get("last_event_id")
+	}
+	var seq int64
+	if last != "" {
+		parsed, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || parsed < 0 {
+			respondError(w, http.StatusBadRequest, "invalid_last_event_id", "Last-Event-ID must be the seq of an event")
+			return
+		}
+		seq = parsed
+	}
+	events, ok := NewEventStream(w)
+	if !ok {
+		return
+	}
+	buffer.attach()
+	defer buffer.detach()
+	for {
+		// the events dropped from the buffer show as a jump of the seq
+		missed, ended, changed := buffer.since(seq)
+		for _, event := range missed {
+			if err := events.replay(event); err != nil {
+				return
+			}
+			seq = event.seq
+		}
+		if ended {
+			return
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// GetStreamConnections godoc
+// @Summary      Returns the open event streams
+// @Description  Returns the event streams open, in all and by caller, with the method, path and age of each, the limits of ORUS_API_STREAM_LIMIT and ORUS_API_STREAM_KEY_LIMIT, and how many streams they rejected since the server started. Requires an admin key (ORUS_API_ADMIN_KEYS) in the X-Admin-Key header
+// @Tags         config
+// @Produce      json
+// @Param        X-Admin-Key  header    string  true  "Admin key"
+// @Success      200  {object}  OrusResponse
+// @Failure      401  {object}  OrusResponse
+// @Failure      403  {object}  OrusResponse
+// @Router       /orus-api/v1/admin/streams [get]
+func (s *OrusAPI) GetStreamConnections(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	stats := s.StreamConnections.Stats()
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{
+		"limit":     stats.Limit,
+		"open":      stats.Open,
+		"rejected":  stats.Rejected,
+		"by_caller": stats.ByCaller,
+		"streams":   stats.Streams,
+	}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Open streams retrieved successfully"
+	respondJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/Dsouza10082/orus"
+	"github.com/Dsouza10082/orus/ollama"
+)
+
+// errorStatus answers 504 when err comes from an expired route deadline,
+// the status of the backend and storage errors Orus knows, and 500
+// otherwise.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, ollama.ErrModelNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ollama.ErrContextTooLong):
+		return http.StatusBadRequest
+	case errors.Is(err, ollama.ErrOllamaUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ollama.ErrStreamClosed):
+		return http.StatusBadGateway
+	case errors.Is(err, orus.ErrStorageFull):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, ErrGenerationCanceled):
+		return statusCanceled
+	}
+	return http.StatusInternalServerError
+}
+
+// llmErrorCode is the code of the error event of a failed generation, so
+// clients can tell a missing model or a prompt too long from other
+// failures.
+func llmErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ollama.ErrModelNotFound):
+		return "model_not_found"
+	case errors.Is(err, ollama.ErrContextTooLong):
+		return "context_too_long"
+	case errors.Is(err, ollama.ErrOllamaUnavailable):
+		return "ollama_unavailable"
+	case errors.Is(err, ollama.ErrStreamClosed):
+		return "stream_closed"
+	case errors.Is(err, ErrGenerationCanceled):
+		return "canceled"
+	}
+	return "llm_error"
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Dsouza10082/orus"
+	"github.com/Dsouza10082/orus/ollama"
+	"github.com/google/uuid"
+)
+
+// ListTools godoc
+// @Summary      Lists the tools
+// @Description  Lists the tools the model can call with auto_tools, in the format they are offered to the model
+// @Tags         llm
+// @Produce      json
+// @Success      200  {object}  OrusResponse
+// @Router       /orus-api/v1/tools [get]
+func (s *OrusAPI) ListTools(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	definitions, _ := s.Tools.Definitions(nil)
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{
+		"tools":      definitions,
+		"max_rounds": s.CurrentConfig().Tools.MaxRounds,
+	}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Tools retrieved successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// chatWithTools answers a call-llm request with auto_tools: the tool calls
+// of the model are run here and their results fed back until it answers.
+// The answer is not cached, as tools may have side effects. When streaming,
+// every tool call is sent as a tool event and the answer as one token event.
+func (s *OrusAPI) chatWithTools(w http.ResponseWriter, r *http.Request, chatRequest ollama.ChatRequest, tools []string, screening *orus.ScreenReport, startTime time.Time) {
+	definitions, err := s.Tools.Definitions(tools)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "unknown_tool", err.Error())
+		return
+	}
+	chatRequest.Tools = definitions
+	maxRounds := s.CurrentConfig().Tools.MaxRounds
+	chat := s.Backend.WithContext(r.Context()).Chat
+
+	if !chatRequest.Stream {
+		responseLLM, trace, err := s.Tools.RunTools(r.Context(), chatRequest, chat, maxRounds, nil, nil)
+		err = canceledCause(r.Context(), err)
+		if err != nil {
+			status := errorStatus(err)
+			if errors.Is(err, orus.ErrToolRounds) {
+				status = http.StatusUnprocessableEntity
+			}
+			response := NewOrusResponse()
+			response.Success = false
+			response.Error = err.Error()
+			response.Message = "Error calling LLM"
+			response.Data = map[string]interface{}{"tool_trace": trace}
+			response.TimeTaken = time.Since(startTime)
+			respondJSON(w, status, response)
+			return
+		}
+		screening = s.Screener.ScreenOutput(r.Context(), r.URL.Path, responseLLM.Message.Content, screening)
+		if screening != nil && screening.Blocked {
+			respondScreenBlocked(w, orus.ScreenOutput, screening)
+			return
+		}
+		serial := uuid.New().String()
+		s.recordGeneration(r.Context(), serial, r.URL.Path, &chatRequest, responseLLM.Message.Content, startTime)
+		successData := map[string]interface{}{
+			"success":    true,
+			"message":    "LLM request received successfully",
+			"content":    responseLLM.Message.Content,
+			"serial":     serial,
+			"time_taken": time.Since(startTime).String(),
+			"model":      chatRequest.Model,
+			"stream":     false,
+			"think":      chatRequest.Think,
+			"tool_trace": trace,
+		}
+		if screening != nil {
+			successData["screening"] = screening
+		}
+		respondJSON(w, http.StatusOK, successData)
+		return
+	}
+
+	events, ok := NewEventStream(w)
+	if !ok {
+		return
+	}
+	responseLLM, trace, err := s.Tools.RunTools(r.Context(), chatRequest, chat, maxRounds, func(call orus.ToolStep) {
+		_ = events.ToolCall(call)
+	}, func(step orus.ToolStep) {
+		_ = events.Tool(step)
+	})
+	err = canceledCause(r.Context(), err)
+	if err != nil {
+		code := llmErrorCode(err)
+		if errors.Is(err, orus.ErrToolRounds) {
+			code = "tool_rounds_exceeded"
+		}
+		_ = events.Error(code, err)
+		return
+	}
+	content := responseLLM.Message.Content
+	done := DonePayload{
+		Message:          "LLM request received successfully",
+		Model:            chatRequest.Model,
+		Content:          content,
+		Thinking:         responseLLM.Message.Thinking,
+		Think:            chatRequest.Think,
+		PromptTokens:     responseLLM.PromptEvalCount,
+		CompletionTokens: responseLLM.EvalCount,
+		ToolTrace:        trace,
+	}
+	done.Screening = s.Screener.ScreenOutput(r.Context(), r.URL.Path, content, screening)
+	if done.Screening != nil && done.Screening.Blocked {
+		_ = events.Error("output_blocked", errors.New("the output was blocked by the content policy"))
+		return
+	}
+	if thinking := responseLLM.Message.Thinking; strings.TrimSpace(thinking) != "" {
+		_ = events.Thinking(thinking)
+	}
+	if content != "" {
+		_ = events.Token(content)
+	}
+	_ = events.Usage(UsagePayload{
+		PromptTokens:       responseLLM.PromptEvalCount,
+		CompletionTokens:   responseLLM.EvalCount,
+		TotalDuration:      responseLLM.TotalDuration,
+		LoadDuration:       responseLLM.LoadDuration,
+		PromptEvalDuration: responseLLM.PromptEvalDuration,
+		EvalDuration:       responseLLM.EvalDuration,
+	})
+	done.Serial = uuid.New().String()
+	s.recordGeneration(r.Context(), done.Serial, r.URL.Path, &chatRequest, content, startTime)
+	done.TimeTaken = time.Since(startTime).String()
+	_ = events.Done(done)
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Dsouza10082/orus"
+	"github.com/google/uuid"
+	"github.com/starfederation/datastar-go/datastar"
+)
+
+const uiUserCookie = "orus_user"
+
+// GetUISettings godoc
+// @Summary      Returns the UI preferences of a user
+// @Description  Returns the playground preferences (default model, temperature, theme, streaming) of the user given by user_id or the orus_user cookie
+// @Tags         ui-settings
+// @Produce      json
+// @Param        user_id  query     string  false  "User ID, defaults to the orus_user cookie"
+// @Success      200  {object}  OrusResponse
+// @Failure      500  {object}  OrusResponse
+// @Router       /orus-api/v1/ui-settings [get]
+func (s *OrusAPI) GetUISettings(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	settings, err := s.UISettings.Get(uiUserID(w, r))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "ui_settings_error", err.Error())
+		return
+	}
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{
+		"settings": settings,
+	}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "UI settings retrieved successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// UpdateUISettings godoc
+// @Summary      Saves the UI preferences of a user
+// @Description  Replaces the playground preferences of the user given by user_id or the orus_user cookie
+// @Tags         ui-settings
+// @Accept       json
+// @Produce      json
+// @Param        user_id  query     string  false  "User ID, defaults to the orus_user cookie"
+// @Success      200  {object}  OrusResponse
+// @Failure      400  {object}  OrusResponse
+// @Failure      500  {object}  OrusResponse
+// @Router       /orus-api/v1/ui-settings [put]
+func (s *OrusAPI) UpdateUISettings(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	request, ok := decodeJSON[orus.UISettings](w, r)
+	if !ok {
+		return
+	}
+	request.UserID = uiUserID(w, r)
+
+	settings, err := s.UISettings.Save(*request)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "ui_settings_error", err.Error())
+		return
+	}
+
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{
+		"settings": settings,
+	}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "UI settings saved successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// PromptSettingsStream is a handler for the prompt/settings endpoint
+// It saves the preferences currently selected in the prompt console
+func (s *OrusAPI) PromptSettingsStream(w http.ResponseWriter, r *http.Request) {
+	signals := &PromptSignals{}
+	if err := datastar.ReadSignals(r, signals); err != nil {
+		log.Printf("PromptSettingsStream: failed to read signals: %v", err)
+		http.Error(w, "failed to read signals", http.StatusBadRequest)
+		return
+	}
+	userID := uiUserID(w, r)
+
+	sse := datastar.NewSSE(w, r)
+
+	temperature := signals.Temperature
+	streaming := signals.ResponseMode != "single"
+	settings := orus.UISettings{
+		UserID:       userID,
+		DefaultModel: signals.Model,
+		Temperature:  &temperature,
+		Theme:        signals.Theme,
+		Streaming:    &streaming,
+	}
+	if err := settings.Validate(); err != nil {
+		_ = sse.ConsoleError(err)
+		return
+	}
+	if _, err := s.UISettings.Save(settings); err != nil {
+		_ = sse.ConsoleError(fmt.Errorf("failed to save settings: %w", err))
+		return
+	}
+	_ = sse.ConsoleLog("UI settings saved")
+}
+
+// uiUserID identifies the user owning the UI settings: the user_id query
+// parameter when given, otherwise the orus_user cookie, which is issued on first visit.
+func uiUserID(w http.ResponseWriter, r *http.Request) string {
+	if userID := r.URL.Query().Get("user_id"); userID != "" {
+		return userID
+	}
+	if cookie, err := r.Cookie(uiUserCookie); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+	userID := uuid.New().String()
+	http.SetCookie(w, &http.Cookie{
+		Name:     uiUserCookie,
+		Value:    userID,
+		Path:     "/",
+		MaxAge:   365 * 24 * 60 * 60,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return userID
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding/csv"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Dsouza10082/orus"
+)
+
+// GetUsageSummary godoc
+// @Summary      Aggregates the usage of the models
+// @Description  Returns the requests, errors, tokens and durations of the generation and embedding endpoints over a time range, grouped by model, API key, day or endpoint, with the totals, as JSON or CSV
+// @Tags         usage
+// @Produce      json
+// @Produce      text/csv
+// @Param        since     query     string  false  "RFC 3339 start time (inclusive)"
+// @Param        until     query     string  false  "RFC 3339 end time (exclusive)"
+// @Param        group_by  query     string  false  "Comma-separated dimensions: model, key, day or endpoint, e.g. day,model"
+// @Param        format    query     string  false  "json (default) or csv"
+// @Success      200  {object}  OrusResponse
+// @Failure      400  {object}  OrusResponse
+// @Failure      404  {object}  OrusResponse
+// @Failure      500  {object}  OrusResponse
+// @Router       /orus-api/v1/usage/summary [get]
+func (s *OrusAPI) GetUsageSummary(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	if s.Usage == nil {
+		respondError(w, http.StatusNotFound, "usage_disabled", "Usage is not recorded, check ORUS_API_USAGE_DIR")
+		return
+	}
+
+	params := r.URL.Query()
+	var since, until time.Time
+	for name, target := range map[string]*time.Time{"since": &since, "until": &until} {
+		if value := params.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, "invalid_"+name, "Query parameter '"+name+"' must be an RFC 3339 time")
+				return
+			}
+			*target = parsed
+		}
+	}
+	groupBy := make([]string, 0)
+	if value := params.Get("group_by"); value != "" {
+		for _, dimension := range strings.Split(value, ",") {
+			dimension = strings.TrimSpace(dimension)
+			if !slices.Contains(orus.UsageGroups, dimension) || slices.Contains(groupBy, dimension) {
+				respondError(w, http.StatusBadRequest, "invalid_group_by", "Query parameter 'group_by' must list distinct dimensions among "+strings.Join(orus.UsageGroups, ", "))
+				return
+			}
+			groupBy = append(groupBy, dimension)
+		}
+	}
+	format := params.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		respondError(w, http.StatusBadRequest, "invalid_format", "Query parameter 'format' must be 'json' or 'csv'")
+		return
+	}
+
+	records, err := s.Usage.Query(since, until)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "usage_query_failed", err.Error())
+		return
+	}
+	groups, totals := orus.SummarizeUsage(records, groupBy)
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", "attachment; filename=\"usage-summary.csv\"")
+		w.WriteHeader(http.StatusOK)
+		writeUsageCSV(w, groupBy, groups, totals)
+		return
+	}
+
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{
+		"group_by": groupBy,
+		"groups":   groups,
+		"totals":   totals,
+	}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Usage summary retrieved successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// writeUsageCSV writes a row per group, then the totals on a row whose
+// dimensions read "total".
+func writeUsageCSV(w http.ResponseWriter, groupBy []string, groups []orus.UsageSummary, totals orus.UsageSummary) {
+	writer := csv.NewWriter(w)
+	header := append(slices.Clone(groupBy), "requests", "errors", "prompt_tokens", "completion_tokens", "total_tokens", "total_duration_ms", "average_duration_ms")
+	_ = writer.Write(header)
+	row := func(values []string, summary orus.UsageSummary) []string {
+		return append(values,
+			strconv.Itoa(summary.Requests),
+			strconv.Itoa(summary.Errors),
+			strconv.Itoa(summary.PromptTokens),
+			strconv.Itoa(summary.CompletionTokens),
+			strconv.Itoa(summary.TotalTokens),
+			strconv.FormatInt(summary.TotalDuration.Milliseconds(), 10),
+			strconv.FormatInt(summary.AverageDuration.Milliseconds(), 10),
+		)
+	}
+	for _, group := range groups {
+		values := make([]string, len(groupBy))
+		for i, dimension := range groupBy {
+			values[i] = group.Group[dimension]
+		}
+		_ = writer.Write(row(values, group))
+	}
+	values := make([]string, len(groupBy))
+	for i := range values {
+		values[i] = "total"
+	}
+	_ = writer.Write(row(values, totals))
+	writer.Flush()
+}
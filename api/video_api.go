@@ -0,0 +1,237 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Dsouza10082/orus"
+)
+
+const videoIngestPath = "/orus-api/v1/videos"
+
+// VideoMatch is a video frame found by a search, with its position in the
+// video.
+type VideoMatch struct {
+	Source string `json:"source" swaggertype:"string" example:"onboarding.mp4"`
+	// Timestamp is the position of the frame in seconds, and Timecode the
+	// same position as hours, minutes and seconds.
+	Timestamp  float64 `json:"timestamp" swaggertype:"number" example:"83.4"`
+	Timecode   string  `json:"timecode" swaggertype:"string" example:"00:01:23"`
+	Caption    string  `json:"caption" swaggertype:"string" example:"A slide titled Expense policy with a table of limits"`
+	Similarity float64 `json:"similarity" swaggertype:"number" example:"0.82"`
+	// Media is the stored frame, when a media store is configured.
+	Media string `json:"media,omitempty" swaggertype:"string"`
+}
+
+// VideoSearchRequest is the body of a search among the ingested videos.
+type VideoSearchRequest struct {
+	Query string `json:"query" swaggertype:"string" example:"the slide about expense limits"`
+	// Source restricts the search to one video.
+	Source     string `json:"source" swaggertype:"string" example:"onboarding.mp4"`
+	EmbedModel string `json:"embed_model" swaggertype:"string" example:"bge-m3"`
+	Limit      int    `json:"limit" swaggertype:"integer" example:"5"`
+}
+
+func (r *VideoSearchRequest) Validate() *orus.ValidationError {
+	if strings.TrimSpace(r.Query) == "" {
+		return &orus.ValidationError{Code: "missing_query", Field: "query", Message: "Field 'query' is required"}
+	}
+	if r.EmbedModel == "" {
+		r.EmbedModel = orus.DefaultRAGEmbedModel
+	}
+	if r.Limit < 0 {
+		return &orus.ValidationError{Code: "invalid_limit", Field: "limit", Message: "Field 'limit' must not be negative"}
+	}
+	return nil
+}
+
+// IngestVideo godoc
+// @Summary      Ingests a video into the RAG index
+// @Description  Samples the keyframes of an uploaded video (field file) with ffmpeg, one every ORUS_API_VIDEO_INTERVAL at most, captions them with the vision model of ORUS_API_VIDEO_CAPTION_MODEL and indexes the captions as the source, replacing its previous records. Every frame keeps its position as timestamp and timecode, so a search or a RAG answer can point to the moment of the video. With clip the frames are embedded as images
+// @Tags         rag
+// @Accept       multipart/form-data
+// @Produce      json,text/event-stream
+// @Param        file           formData  file    true   "Video (MP4, MOV, WebM, MKV or AVI)"
+// @Param        source         formData  string  false  "Source name, defaults to the file name"
+// @Param        embed_model    formData  string  false  "Embedding model, defaults to bge-m3"
+// @Param        caption_model  formData  string  false  "Vision model captioning the frames"
+// @Param        interval       formData  string  false  "Shortest time between two frames, such as 5s"
+// @Param        max_frames     formData  int     false  "Most frames sampled"
+// @Param        stream         formData  bool    false  "Stream the progress as events, then the result in the done event"
+// @Success      200  {object}  OrusResponse
+// @Failure      400  {object}  OrusResponse
+// @Failure      413  {object}  OrusResponse
+// @Failure      422  {object}  OrusResponse
+// @Failure      500  {object}  OrusResponse
+// @Router       /orus-api/v1/videos [post]
+func (s *OrusAPI) IngestVideo(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	config := s.CurrentConfig().Video
+	if err := r.ParseMultipartForm(orus.MaxBodySize); err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			respondError(w, http.StatusRequestEntityTooLarge, "video_too_large",
+				fmt.Sprintf("The video must not exceed %d bytes", maxBytesError.Limit))
+			return
+		}
+		respondError(w, http.StatusBadRequest, "invalid_upload", fmt.Sprintf("The body must be a multipart form: %v", err))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "missing_file", "Field 'file' is required")
+		return
+	}
+	defer file.Close()
+	sniff := make([]byte, 512)
+	n, _ := io.ReadFull(file, sniff)
+	if !orus.IsVideo(http.DetectContentType(sniff[:n]), header.Filename) {
+		respondError(w, http.StatusBadRequest, "unsupported_video", orus.ErrUnsupportedVideo.Error())
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_upload", fmt.Sprintf("The file cannot be read: %v", err))
+		return
+	}
+
+	source := strings.TrimSpace(r.FormValue("source"))
+	if source == "" {
+		source = header.Filename
+	}
+	model := r.FormValue("embed_model")
+	if model == "" {
+		model = orus.DefaultRAGEmbedModel
+	}
+	captionModel := r.FormValue("caption_model")
+	if captionModel == "" {
+		captionModel = config.CaptionModel
+	}
+	interval, maxFrames := config.Interval, config.MaxFrames
+	if raw := r.FormValue("interval"); raw != "" {
+		if interval, err = time.ParseDuration(raw); err != nil || interval < time.Second {
+			respondError(w, http.StatusBadRequest, "invalid_interval", "Field 'interval' must be a duration of at least 1s")
+			return
+		}
+	}
+	if raw := r.FormValue("max_frames"); raw != "" {
+		if maxFrames, err = strconv.Atoi(raw); err != nil || maxFrames < 1 || maxFrames > orus.MaxVideoFrames {
+			respondError(w, http.StatusBadRequest, "invalid_max_frames", fmt.Sprintf("Field 'max_frames' must be between 1 and %d", orus.MaxVideoFrames))
+			return
+		}
+	}
+	if !s.supportsVision(r.Context(), captionModel) {
+		respondError(w, http.StatusBadRequest, "model_not_vision", fmt.Sprintf("Model '%s' does not accept images", captionModel))
+		return
+	}
+	ingest, ok := startIngestStream(w, r)
+	if !ok {
+		return
+	}
+
+	// ffmpeg reads the video from a file, as MP4 cannot always be read from
+	// a pipe
+	dir, err := os.MkdirTemp("", "orus-video-*")
+	if err != nil {
+		ingest.fail(http.StatusInternalServerError, "video_error", fmt.Sprintf("Error storing the video: %v", err))
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "video"+strings.ToLower(filepath.Ext(header.Filename)))
+	if err := writeUpload(path, file); err != nil {
+		ingest.fail(http.StatusInternalServerError, "video_error", fmt.Sprintf("Error storing the video: %v", err))
+		return
+	}
+	ingest.progress(orus.IngestProgress{Stage: "sampling"})
+	frames, err := orus.SampleVideoFrames(r.Context(), path, interval, maxFrames)
+	if err != nil {
+		ingest.fail(errorStatus(err), "extraction_error", fmt.Sprintf("Error sampling the video: %v", err))
+		return
+	}
+	if len(frames) == 0 {
+		ingest.fail(http.StatusUnprocessableEntity, "empty_video", "No frame could be read from the video")
+		return
+	}
+
+	documents, err := s.Documents.IndexVideo(r.Context(), source, frames, model, captionModel, ingest.progress)
+	if err != nil {
+		ingest.fail(errorStatus(err), "indexing_error", fmt.Sprintf("Error indexing the video: %v", err))
+		return
+	}
+	matches := make([]VideoMatch, len(documents))
+	for i, document := range documents {
+		matches[i] = videoMatch(orus.SearchResult{Document: document})
+	}
+
+	ingest.done(map[string]interface{}{
+		"source":        source,
+		"model":         model,
+		"caption_model": captionModel,
+		"frames":        matches,
+	}, "Video ingested successfully", startTime)
+}
+
+// SearchVideos godoc
+// @Summary      Searches the ingested videos
+// @Description  Returns the video frames whose captions are the closest to the query, among the videos ingested with the same embedding model, with the timecode to jump to
+// @Tags         rag
+// @Accept       json
+// @Produce      json
+// @Param        request  body  VideoSearchRequest  true  "Query"
+// @Success      200  {object}  OrusResponse
+// @Failure      400  {object}  OrusResponse
+// @Failure      500  {object}  OrusResponse
+// @Router       /orus-api/v1/videos/search [post]
+func (s *OrusAPI) SearchVideos(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	request, ok := decodeJSON[VideoSearchRequest](w, r)
+	if !ok {
+		return
+	}
+	results, err := s.Documents.SearchVideos(request.Query, request.EmbedModel, request.Source, request.Limit)
+	if err != nil {
+		respondError(w, errorStatus(err), "embedding_error", fmt.Sprintf("Error embedding the query: %v", err))
+		return
+	}
+	matches := make([]VideoMatch, len(results))
+	for i, result := range results {
+		matches[i] = videoMatch(result)
+	}
+
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{"results": matches}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Search completed successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+func videoMatch(result orus.SearchResult) VideoMatch {
+	document := result.Document
+	match := VideoMatch{Caption: document.Content, Similarity: result.Similarity}
+	match.Source, _ = document.Metadata["source"].(string)
+	match.Timestamp, _ = document.Metadata["timestamp"].(float64)
+	match.Timecode, _ = document.Metadata["timecode"].(string)
+	if len(document.Media) > 0 {
+		match.Media = document.Media[0].ID
+	}
+	return match
+}
+
+func writeUpload(path string, upload io.Reader) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, upload); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
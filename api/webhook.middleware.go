@@ -0,0 +1,214 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Dsouza10082/orus"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+)
+
+// CallbackHeader holds the URL a request is run as a background job for.
+const CallbackHeader = "X-Orus-Callback-URL"
+
+// WebhookJobs runs the requests with a callback URL as background jobs, so
+// automation systems do not hold a connection open for a model download or
+// a long generation. The request is answered 202 with the job ID, the route
+// runs with its body as if the caller waited, and its result is posted to
+// the callback URL by webhooks, which also keep the state of the job for
+// GET /orus-api/v1/jobs/{id}. It must run before the timeout and the
+// admission of the route, which then apply to the job.
+func WebhookJobs(webhooks *orus.Webhooks) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			callbackURL := strings.TrimSpace(r.Header.Get(CallbackHeader))
+			if callbackURL == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			startTime := time.Now()
+			if webhooks == nil {
+				respondError(w, http.StatusBadRequest, "webhooks_disabled", "Webhooks are disabled, check ORUS_API_WEBHOOK_SECRET")
+				return
+			}
+			if err := webhooks.CheckCallback(callbackURL); err != nil {
+				respondError(w, http.StatusBadRequest, "invalid_callback_url", err.Error())
+				return
+			}
+			// the body is read now, as the connection is gone when the job runs
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				var maxBytesError *http.MaxBytesError
+				if errors.As(err, &maxBytesError) {
+					respondError(w, http.StatusRequestEntityTooLarge, "request_too_large", fmt.Sprintf("Request body must not exceed %d bytes", maxBytesError.Limit))
+					return
+				}
+				respondError(w, http.StatusBadRequest, "invalid_request", "Error reading request body: "+err.Error())
+				return
+			}
+
+			route := r.URL.Path
+			if routeContext := chi.RouteContext(r.Context()); routeContext != nil && routeContext.RoutePattern() != "" {
+				route = routeContext.RoutePattern()
+			}
+			payload := orus.WebhookPayload{
+				ID:        uuid.New().String(),
+				Route:     route,
+				RequestID: middleware.GetReqID(r.Context()),
+				Event:     orus.WebhookJobRunning,
+				StartedAt: startTime.UTC(),
+			}
+			if err := webhooks.SaveJob(payload); err != nil {
+				log.Printf("Error saving the state of job %s: %v", payload.ID, err)
+			}
+			job := r.Clone(context.WithoutCancel(r.Context()))
+			job.Body = io.NopCloser(bytes.NewReader(body))
+			job.ContentLength = int64(len(body))
+			job.Header.Del(CallbackHeader)
+			go func() {
+				jw := newJobWriter()
+				jw.serve(next, job)
+				jw.result(&payload)
+				payload.FinishedAt = time.Now().UTC()
+				if err := webhooks.SaveJob(payload); err != nil {
+					log.Printf("Error saving the state of job %s: %v", payload.ID, err)
+				}
+				if err := webhooks.Deliver(job.Context(), callbackURL, payload); err != nil {
+					log.Printf("Error delivering the %s webhook of job %s: %v", payload.Event, payload.ID, err)
+				}
+			}()
+
+			response := NewOrusResponse()
+			response.Data = map[string]interface{}{
+				"job_id":       payload.ID,
+				"callback_url": callbackURL,
+			}
+			response.TimeTaken = time.Since(startTime)
+			response.Message = "Job accepted, its result will be posted to the callback URL"
+			respondJSON(w, http.StatusAccepted, response)
+		})
+	}
+}
+
+// jobWriter is the response writer of a job. It keeps the body of a JSON
+// response, and only the last event of an event stream, which tells how the
+// stream ended, so a model download does not pile up its progress events.
+type jobWriter struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	stream      bool
+	body        bytes.Buffer
+	event       string
+	data        []byte
+}
+
+func newJobWriter() *jobWriter {
+	return &jobWriter{header: make(http.Header)}
+}
+
+func (w *jobWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *jobWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+	w.stream = strings.HasPrefix(w.header.Get("Content-Type"), "text/event-stream")
+}
+
+func (w *jobWriter) Write(data []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	w.body.Write(data)
+	if w.stream {
+		w.readEvents()
+	}
+	return len(data), nil
+}
+
+// serve runs the job. The recoverer of the router does not run on it, so a
+// panic is recovered here and fails the job with a 500.
+func (w *jobWriter) serve(next http.Handler, r *http.Request) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			log.Printf("Job of %s panicked: %v", r.URL.Path, recovered)
+			w.wroteHeader, w.status, w.stream = true, http.StatusInternalServerError, false
+			w.body.Reset()
+		}
+	}()
+	next.ServeHTTP(w, r)
+}
+
+// Flush lets the streaming handlers write to the job.
+func (w *jobWriter) Flush() {
+	w.WriteHeader(http.StatusOK)
+}
+
+// readEvents keeps the last complete event of the stream, and the part of
+// the next one written so far.
+func (w *jobWriter) readEvents() {
+	buffered := w.body.Bytes()
+	end := bytes.LastIndex(buffered, []byte("\n\n"))
+	if end < 0 {
+		return
+	}
+	for _, block := range bytes.Split(buffered[:end], []byte("\n\n")) {
+		var event string
+		var data [][]byte
+		for _, line := range bytes.Split(block, []byte("\n")) {
+			switch {
+			case bytes.HasPrefix(line, []byte("event:")):
+				event = strings.TrimSpace(string(line[len("event:"):]))
+			case bytes.HasPrefix(line, []byte("data:")):
+				data = append(data, bytes.TrimPrefix(line[len("data:"):], []byte(" ")))
+			}
+		}
+		if len(data) > 0 {
+			w.event = event
+			w.data = bytes.Join(data, []byte("\n"))
+		}
+	}
+	rest := bytes.Clone(buffered[end+2:])
+	w.body.Reset()
+	w.body.Write(rest)
+}
+
+// result sets the status, event and result of payload from the response. A
+// stream completed when it ended with a done event.
+func (w *jobWriter) result(payload *orus.WebhookPayload) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	payload.Status = w.status
+	body := w.body.Bytes()
+	completed := w.status >= 200 && w.status < 300
+	if w.stream {
+		body = w.data
+		completed = completed && w.event == string(EventDone)
+	}
+	body = bytes.TrimSpace(body)
+	switch {
+	case len(body) == 0:
+	case json.Valid(body):
+		payload.Result = json.RawMessage(body)
+	default:
+		payload.Result, _ = json.Marshal(string(body))
+	}
+	payload.Event = orus.WebhookJobFailed
+	if completed {
+		payload.Event = orus.WebhookJobCompleted
+	}
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Dsouza10082/orus"
+	"github.com/go-chi/chi/v5"
+)
+
+// WorkflowRunRequest is the body of a workflow run.
+type WorkflowRunRequest struct {
+	Inputs map[string]interface{} `json:"inputs" swaggertype:"object"`
+	// Stream sends every step as a step event, then the run in the done
+	// event.
+	Stream bool `json:"stream" swaggertype:"boolean" example:"false"`
+}
+
+// ListWorkflows godoc
+// @Summary      Lists the workflows
+// @Description  Lists the workflow definitions read from ORUS_API_WORKFLOWS_PATH, with their inputs and steps
+// @Tags         workflows
+// @Produce      json
+// @Success      200  {object}  OrusResponse
+// @Router       /orus-api/v1/workflows [get]
+func (s *OrusAPI) ListWorkflows(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	response := NewOrusResponse()
+	response.Data = map[string]interface{}{"workflows": s.Workflows.List()}
+	response.TimeTaken = time.Since(startTime)
+	response.Message = "Workflows retrieved successfully"
+	respondJSON(w, http.StatusOK, response)
+}
+
+// RunWorkflow godoc
+// @Summary      Runs a workflow
+// @Description  Runs the steps of a workflow with the given inputs, retrying the failed steps as defined. With stream every step start, success and failure is sent as a step event and the run ends with a done event
+// @Tags         workflows
+// @Accept       json
+// @Produce      json
+// @Param        name     path  string              true  "Workflow name"
+// @Param        request  body  WorkflowRunRequest  true  "Inputs"
+// @Success      200  {object}  OrusResponse
+// @Failure      400  {object}  OrusResponse
+// @Failure      404  {object}  OrusResponse
+// @Failure      422  {object}  OrusResponse
+// @Router       /orus-api/v1/workflows/{name}/run [post]
+func (s *OrusAPI) RunWorkflow(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	workflow, ok := s.Workflows.Get(chi.URLParam(r, "name"))
+	if !ok {
+		respondError(w, http.StatusNotFound, "unknown_workflow", "The workflow does not exist")
+		return
+	}
+	request, ok := decodeJSON[WorkflowRunRequest](w, r)
+	if !ok {
+		return
+	}
+	for _, input := range workflow.Inputs {
+		if _, ok := request.Inputs[input]; !ok {
+			respondError(w, http.StatusBadRequest, "missing_input", "The input "+input+" is required")
+			return
+		}
+	}
+
+	if !request.Stream {
+		run, err := s.Workflows.Run(r.Context(), workflow, request.Inputs, nil)
+		if err != nil {
+			status := errorStatus(err)
+			if errors.Is(err, orus.ErrWorkflowFailed) {
+				status = http.StatusUnprocessableEntity
+			}
+			response := NewOrusResponse()
+			response.Success = false
+			response.Error = err.Error()
+			response.Message = "Error running workflow"
+			response.Data = map[string]interface{}{"workflow": run}
+			response.TimeTaken = time.Since(startTime)
+			respondJSON(w, status, response)
+			return
+		}
+		response := NewOrusResponse()
+		response.Data = map[string]interface{}{"workflow": run}
+		response.TimeTaken = time.Since(startTime)
+		response.Message = "Workflow run successfully"
+		respondJSON(w, http.StatusOK, response)
+		return
+	}
+
+	events, ok := NewEventStream(w)
+	if !ok {
+		return
+	}
+	run, err := s.Workflows.Run(r.Context(), workflow, request.Inputs, func(event orus.WorkflowEvent) {
+		_ = events.Step(event)
+	})
+	if err != nil {
+		code := "workflow_error"
+		if errors.Is(err, orus.ErrWorkflowFailed) {
+			code = "workflow_failed"
+		}
+		_ = events.Error(code, err)
+		return
+	}
+	_ = events.Done(DonePayload{
+		Message:   "Workflow run successfully",
+		Content:   run.Output,
+		Workflow:  run,
+		TimeTaken: time.Since(startTime).String(),
+	})
+}
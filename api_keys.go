@@ -0,0 +1,126 @@
+package orus
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// apiKeyPrefix starts the keys the server generates, so they can be told
+// apart from the keys of the configuration.
+const apiKeyPrefix = "orus_"
+
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// APIKey is a key created through the API. Only the digest of the key is
+// kept: the key itself is returned once, when it is created.
+type APIKey struct {
+	ID   string `json:"id" swaggertype:"string" example:"123e4567-e89b-12d3-a456-426614174000"`
+	Name string `json:"name" swaggertype:"string" example:"ci"`
+	// Prefix is the start of the key, to recognize it.
+	Prefix    string    `json:"prefix" swaggertype:"string" example:"orus_Zm9v"`
+	CreatedAt time.Time `json:"created_at" swaggertype:"string" example:"2021-01-01T00:00:00Z"`
+}
+
+type APIKeyStore interface {
+	// Create generates a key named name and returns it along with its record.
+	Create(name string) (*APIKey, string, error)
+	List() ([]APIKey, error)
+	Revoke(id string) error
+	// Lookup returns the record of key, or ErrAPIKeyNotFound.
+	Lookup(key string) (*APIKey, error)
+}
+
+// newAPIKey generates a key and the record stored for it.
+func newAPIKey(name string) (APIKey, string, string, error) {
+	random := make([]byte, 24)
+	if _, err := rand.Read(random); err != nil {
+		return APIKey{}, "", "", err
+	}
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(random)
+	record := APIKey{
+		ID:        uuid.New().String(),
+		Name:      name,
+		Prefix:    key[:len(apiKeyPrefix)+4],
+		CreatedAt: time.Now().UTC(),
+	}
+	return record, key, apiKeyDigest(key), nil
+}
+
+func apiKeyDigest(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// MemoryAPIKeyStore keeps the API keys until the server stops.
+type MemoryAPIKeyStore struct {
+	mu       sync.RWMutex
+	keys     map[string]APIKey
+	byDigest map[string]string
+}
+
+func NewMemoryAPIKeyStore() *MemoryAPIKeyStore {
+	return &MemoryAPIKeyStore{
+		keys:     make(map[string]APIKey),
+		byDigest: make(map[string]string),
+	}
+}
+
+func (s *MemoryAPIKeyStore) Create(name string) (*APIKey, string, error) {
+	record, key, digest, err := newAPIKey(name)
+	if err != nil {
+		return nil, "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[record.ID] = record
+	s.byDigest[digest] = record.ID
+	return &record, key, nil
+}
+
+// List returns the keys oldest first.
+func (s *MemoryAPIKeyStore) List() ([]APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		return keys[a].CreatedAt.Before(keys[b].CreatedAt)
+	})
+	return keys, nil
+}
+
+func (s *MemoryAPIKeyStore) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[id]; !ok {
+		return ErrAPIKeyNotFound
+	}
+	delete(s.keys, id)
+	for digest, keyID := range s.byDigest {
+		if keyID == id {
+			delete(s.byDigest, digest)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryAPIKeyStore) Lookup(key string) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	id, ok := s.byDigest[apiKeyDigest(key)]
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+	record := s.keys[id]
+	return &record, nil
+}
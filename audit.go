@@ -0,0 +1,392 @@
+package orus
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Dsouza10082/orus/ollama"
+)
+
+const (
+	DefaultAuditQueryLimit = 100
+	MaxAuditQueryLimit     = 1000
+	// DefaultAuditFileSize is the size at which the file sink starts a new file.
+	DefaultAuditFileSize = 64 * 1024 * 1024
+	// auditFileAge is the age at which the file sink starts a new file, so
+	// retention can prune a quiet log too.
+	auditFileAge       = 24 * time.Hour
+	auditQueueSize     = 1024
+	auditPruneInterval = time.Hour
+)
+
+// AuditRecord is one audited request: who called which endpoint, with what
+// prompt, what the model answered and how long it took.
+type AuditRecord struct {
+	ID        string           `json:"id" swaggertype:"string" example:"123e4567-e89b-12d3-a456-426614174000"`
+	Time      time.Time        `json:"time" swaggertype:"string" example:"2021-01-01T00:00:00Z"`
+	RequestID string           `json:"request_id,omitempty" swaggertype:"string"`
+	Method    string           `json:"method" swaggertype:"string" example:"POST"`
+	Endpoint  string           `json:"endpoint" swaggertype:"string" example:"/orus-api/v1/call-llm"`
+	Caller    string           `json:"caller" swaggertype:"string" example:"key:3f2a9c1b7d4e"`
+	Status    int              `json:"status" swaggertype:"integer" example:"200"`
+	Serial    string           `json:"serial,omitempty" swaggertype:"string"`
+	Model     string           `json:"model,omitempty" swaggertype:"string" example:"llama3.1:8b"`
+	Messages  []ollama.Message `json:"messages,omitempty" swaggertype:"array"`
+	Response  string           `json:"response,omitempty" swaggertype:"string"`
+	Duration  time.Duration    `json:"duration" swaggertype:"integer" example:"1500000000"`
+}
+
+// AuditQuery filters the records returned by an AuditSink. Zero fields match
+// everything; records come back newest first.
+type AuditQuery struct {
+	Since    time.Time
+	Until    time.Time
+	Endpoint string
+	Model    string
+	Caller   string
+	Limit    int
+}
+
+func (q AuditQuery) matches(record AuditRecord) bool {
+	return (q.Since.IsZero() || !record.Time.Before(q.Since)) &&
+		(q.Until.IsZero() || record.Time.Before(q.Until)) &&
+		(q.Endpoint == "" || record.Endpoint == q.Endpoint) &&
+		(q.Model == "" || record.Model == q.Model) &&
+		(q.Caller == "" || record.Caller == q.Caller)
+}
+
+// AuditSink stores audit records.
+type AuditSink interface {
+	Write(record AuditRecord) error
+	Query(query AuditQuery) ([]AuditRecord, error)
+	// Prune deletes the records older than before and returns how many
+	// records (or, for the file sink, files) were deleted.
+	Prune(before time.Time) (int, error)
+	Close() error
+}
+
+// Auditor writes audit records to its sink in the background and prunes the
+// sink according to the retention. A nil Auditor audits nothing.
+type Auditor struct {
+	sink      AuditSink
+	retention time.Duration
+	records   chan AuditRecord
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// LoadAuditor opens the sink described by config; the storage sink writes
+// to storage. The prompts and replies are encrypted as encryption says,
+// like the ones of the storage. It returns nil when auditing is off.
+func LoadAuditor(config AuditConfig, encryption EncryptionConfig, storage *SQLStore) (*Auditor, error) {
+	var sink AuditSink
+	var err error
+	switch config.Sink {
+	case "":
+		return nil, nil
+	case "file", "sqlite", "postgres":
+		cipher, err := NewCipher(encryption)
+		if err != nil {
+			return nil, err
+		}
+		if config.Sink == "file" {
+			sink, err = NewFileAuditSink(config.DSN.Reveal(), DefaultAuditFileSize, cipher)
+		} else {
+			sink, err = NewSQLAuditSink(config.Sink, config.DSN.Reveal(), cipher)
+		}
+		if err != nil {
+			return nil, err
+		}
+	case "storage":
+		if storage == nil {
+			return nil, errors.New("the storage audit sink requires the storage database, which is not open")
+		}
+		sink = storage.AuditSink()
+	default:
+		return nil, fmt.Errorf("unknown audit sink %q, expected file, sqlite, postgres or storage", config.Sink)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewAuditor(sink, config.Retention), nil
+}
+
+func NewAuditor(sink AuditSink, retention time.Duration) *Auditor {
+	a := &Auditor{
+		sink:      sink,
+		retention: retention,
+		records:   make(chan AuditRecord, auditQueueSize),
+		done:      make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// Record queues record for writing. Records are dropped, and the drop
+// logged, when the sink cannot keep up.
+func (a *Auditor) Record(record AuditRecord) {
+	if a == nil {
+		return
+	}
+	select {
+	case a.records <- record:
+	default:
+		log.Printf("Audit queue is full, dropping record for %s %s", record.Method, record.Endpoint)
+	}
+}
+
+func (a *Auditor) Query(query AuditQuery) ([]AuditRecord, error) {
+	if query.Limit <= 0 {
+		query.Limit = DefaultAuditQueryLimit
+	}
+	if query.Limit > MaxAuditQueryLimit {
+		query.Limit = MaxAuditQueryLimit
+	}
+	return a.sink.Query(query)
+}
+
+// Close writes the queued records and closes the sink.
+func (a *Auditor) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.closeOnce.Do(func() { close(a.records) })
+	<-a.done
+	return a.sink.Close()
+}
+
+func (a *Auditor) run() {
+	defer close(a.done)
+	ticker := time.NewTicker(auditPruneInterval)
+	defer ticker.Stop()
+	a.prune()
+	for {
+		select {
+		case record, ok := <-a.records:
+			if !ok {
+				return
+			}
+			if err := a.sink.Write(record); err != nil {
+				log.Println("Error writing audit record: ", err)
+			}
+		case <-ticker.C:
+			a.prune()
+		}
+	}
+}
+
+func (a *Auditor) prune() {
+	if a.retention <= 0 {
+		return
+	}
+	pruned, err := a.sink.Prune(time.Now().UTC().Add(-a.retention))
+	if err != nil {
+		log.Println("Error pruning audit records: ", err)
+		return
+	}
+	if pruned > 0 {
+		log.Printf("Pruned %d audit entries older than %s", pruned, a.retention)
+	}
+}
+
+type auditContextKey struct{}
+
+// AuditRecordFrom returns the record the audit middleware is building for
+// the request, or nil when the request is not audited.
+func AuditRecordFrom(ctx context.Context) *AuditRecord {
+	record, _ := ctx.Value(auditContextKey{}).(*AuditRecord)
+	return record
+}
+
+// CallerKey identifies the caller by a fingerprint of its API key, so keys
+// are never written to the audit log, or by its address when it sent none.
+func CallerKey(r *http.Request) string {
+	key := RequestAPIKey(r)
+	if key == "" {
+		return "ip:" + r.RemoteAddr
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "key:" + hex.EncodeToString(sum[:6])
+}
+
+// FileAuditSink appends records as JSON lines to files in a directory,
+// starting a new file daily or when the current one reaches maxSize. Pruning deletes
+// whole files, so records live until their file is older than the retention.
+// The content of the messages and the response are encrypted by cipher,
+// when it is not nil.
+type FileAuditSink struct {
+	mu      sync.Mutex
+	dir     string
+	maxSize int64
+	cipher  *Cipher
+	file    *os.File
+	size    int64
+	opened  time.Time
+}
+
+func NewFileAuditSink(dir string, maxSize int64, cipher *Cipher) (*FileAuditSink, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("error creating audit directory: %w", err)
+	}
+	return &FileAuditSink{dir: dir, maxSize: maxSize, cipher: cipher}, nil
+}
+
+func (s *FileAuditSink) Write(record AuditRecord) error {
+	if s.cipher != nil {
+		messages := make([]ollama.Message, len(record.Messages))
+		for i, message := range record.Messages {
+			message.Content = s.cipher.Encrypt(message.Content)
+			messages[i] = message
+		}
+		record.Messages = messages
+		record.Response = s.cipher.Encrypt(record.Response)
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error encoding audit record: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil || s.size+int64(len(line)) > s.maxSize || time.Since(s.opened) > auditFileAge {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+func (s *FileAuditSink) rotate() error {
+	if s.file != nil {
+		if err := s.file.Close(); err != nil {
+			return fmt.Errorf("error closing audit file: %w", err)
+		}
+	}
+	name := filepath.Join(s.dir, fmt.Sprintf("audit-%s.jsonl", time.Now().UTC().Format("20060102T150405.000000000")))
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("error opening audit file: %w", err)
+	}
+	s.file, s.size, s.opened = file, 0, time.Now()
+	return nil
+}
+
+// files returns the audit files, oldest first.
+func (s *FileAuditSink) files() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "audit-*.jsonl"))
+	sort.Strings(files)
+	return files, err
+}
+
+func (s *FileAuditSink) Query(query AuditQuery) ([]AuditRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+	records := make([]AuditRecord, 0)
+	for i := len(files) - 1; i >= 0 && len(records) < query.Limit; i-- {
+		matched, err := readAuditFile(files[i], query, s.cipher)
+		if err != nil {
+			return nil, err
+		}
+		for j := len(matched) - 1; j >= 0 && len(records) < query.Limit; j-- {
+			records = append(records, matched[j])
+		}
+	}
+	return records, nil
+}
+
+// readAuditFile reads the records of a file matching query, decrypting
+// their messages and response with cipher.
+func readAuditFile(name string, query AuditQuery, cipher *Cipher) ([]AuditRecord, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("error opening audit file: %w", err)
+	}
+	defer file.Close()
+	records := make([]AuditRecord, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxBodySize*2)
+	for scanner.Scan() {
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		if !query.matches(record) {
+			continue
+		}
+		for i := range record.Messages {
+			if record.Messages[i].Content, err = cipher.Decrypt(record.Messages[i].Content); err != nil {
+				return nil, err
+			}
+		}
+		if record.Response, err = cipher.Decrypt(record.Response); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+func (s *FileAuditSink) Prune(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files, err := s.files()
+	if err != nil {
+		return 0, err
+	}
+	pruned := 0
+	for _, name := range files {
+		if s.file != nil && name == s.file.Name() {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil || !info.ModTime().Before(before) {
+			continue
+		}
+		if err := os.Remove(name); err != nil {
+			return pruned, fmt.Errorf("error removing audit file: %w", err)
+		}
+		pruned++
+	}
+	return pruned, nil
+}
+
+func (s *FileAuditSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// RequestAPIKey returns the API key sent in the X-API-Key header or as a
+// bearer token.
+func RequestAPIKey(r *http.Request) string {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		key = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	return key
+}
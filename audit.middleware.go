@@ -0,0 +1,38 @@
+package orus
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+)
+
+// Middleware audits the requests of the routes it wraps. Handlers add the
+// model, prompt and reply through recordGeneration; the middleware adds the
+// caller, status and timing once the handler returns.
+func (a *Auditor) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		record := &AuditRecord{
+			ID:        uuid.New().String(),
+			Time:      start.UTC(),
+			RequestID: middleware.GetReqID(r.Context()),
+			Method:    r.Method,
+			Endpoint:  r.URL.Path,
+			Caller:    CallerKey(r),
+		}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), auditContextKey{}, record)))
+
+		record.Status = ww.Status()
+		record.Duration = time.Since(start)
+		a.Record(*record)
+	})
+}
@@ -0,0 +1,7 @@
+//go:build audit_postgres
+
+package orus
+
+// Registers the pgx driver for ORUS_API_AUDIT_SINK=postgres.
+// Build with: go get github.com/jackc/pgx/v5 && go build -tags audit_postgres
+import _ "github.com/jackc/pgx/v5/stdlib"
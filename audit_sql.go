@@ -0,0 +1,179 @@
+package orus
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// sqlAuditDrivers maps the audit sink kinds to database/sql driver names.
+// The drivers are linked in with the audit_sqlite and audit_postgres build
+// tags, so the default binary carries no database dependency.
+var sqlAuditDrivers = map[string]string{
+	"sqlite":   "sqlite",
+	"postgres": "pgx",
+}
+
+const auditTableSchema = `CREATE TABLE IF NOT EXISTS audit_log (
+	id         TEXT PRIMARY KEY,
+	time       TIMESTAMP NOT NULL,
+	request_id TEXT NOT NULL,
+	method     TEXT NOT NULL,
+	endpoint   TEXT NOT NULL,
+	caller     TEXT NOT NULL,
+	status     INTEGER NOT NULL,
+	serial     TEXT NOT NULL,
+	model      TEXT NOT NULL,
+	messages   TEXT NOT NULL,
+	response   TEXT NOT NULL,
+	duration   BIGINT NOT NULL
+)`
+
+// SQLAuditSink stores records in the audit_log table of a SQLite or
+// Postgres database.
+type SQLAuditSink struct {
+	db      *sql.DB
+	dialect string
+	// shared is set for the sink of a SQLStore, whose database outlives it.
+	shared bool
+	// cipher encrypts the messages and the response; nil keeps them in
+	// plain text.
+	cipher *Cipher
+}
+
+func NewSQLAuditSink(dialect string, dsn string, cipher *Cipher) (*SQLAuditSink, error) {
+	driver := sqlAuditDrivers[dialect]
+	if !driverRegistered(driver) {
+		return nil, fmt.Errorf("audit sink %q is not compiled in, build with -tags audit_%s", dialect, dialect)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error opening audit database: %w", err)
+	}
+	s := &SQLAuditSink{db: db, dialect: dialect, cipher: cipher}
+	for _, statement := range []string{
+		auditTableSchema,
+		`CREATE INDEX IF NOT EXISTS audit_log_time ON audit_log (time)`,
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("error creating audit table: %w", err)
+		}
+	}
+	return s, nil
+}
+
+func driverRegistered(driver string) bool {
+	for _, name := range sql.Drivers() {
+		if name == driver {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *SQLAuditSink) bind(query string) string {
+	return bindPlaceholders(s.dialect, query)
+}
+
+// bindPlaceholders rewrites the ? placeholders of query for the dialect.
+func bindPlaceholders(dialect string, query string) string {
+	if dialect != "postgres" {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func (s *SQLAuditSink) Write(record AuditRecord) error {
+	messages, err := json.Marshal(record.Messages)
+	if err != nil {
+		return fmt.Errorf("error encoding audit messages: %w", err)
+	}
+	_, err = s.db.Exec(s.bind(`INSERT INTO audit_log
+		(id, time, request_id, method, endpoint, caller, status, serial, model, messages, response, duration)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		record.ID, record.Time.UTC(), record.RequestID, record.Method, record.Endpoint, record.Caller,
+		record.Status, record.Serial, record.Model, s.cipher.Encrypt(string(messages)), s.cipher.Encrypt(record.Response), int64(record.Duration))
+	return err
+}
+
+func (s *SQLAuditSink) Query(query AuditQuery) ([]AuditRecord, error) {
+	conditions := make([]string, 0, 5)
+	args := make([]interface{}, 0, 6)
+	if !query.Since.IsZero() {
+		conditions = append(conditions, "time >= ?")
+		args = append(args, query.Since.UTC())
+	}
+	if !query.Until.IsZero() {
+		conditions = append(conditions, "time < ?")
+		args = append(args, query.Until.UTC())
+	}
+	for column, value := range map[string]string{"endpoint": query.Endpoint, "model": query.Model, "caller": query.Caller} {
+		if value != "" {
+			conditions = append(conditions, column+" = ?")
+			args = append(args, value)
+		}
+	}
+	statement := `SELECT id, time, request_id, method, endpoint, caller, status, serial, model, messages, response, duration FROM audit_log`
+	if len(conditions) > 0 {
+		statement += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	statement += " ORDER BY time DESC LIMIT ?"
+	args = append(args, query.Limit)
+
+	rows, err := s.db.Query(s.bind(statement), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	records := make([]AuditRecord, 0)
+	for rows.Next() {
+		var record AuditRecord
+		var messages string
+		var duration int64
+		if err := rows.Scan(&record.ID, &record.Time, &record.RequestID, &record.Method, &record.Endpoint, &record.Caller,
+			&record.Status, &record.Serial, &record.Model, &messages, &record.Response, &duration); err != nil {
+			return nil, err
+		}
+		if messages, err = s.cipher.Decrypt(messages); err != nil {
+			return nil, err
+		}
+		if record.Response, err = s.cipher.Decrypt(record.Response); err != nil {
+			return nil, err
+		}
+		if messages != "" {
+			_ = json.Unmarshal([]byte(messages), &record.Messages)
+		}
+		record.Duration = time.Duration(duration)
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func (s *SQLAuditSink) Prune(before time.Time) (int, error) {
+	result, err := s.db.Exec(s.bind(`DELETE FROM audit_log WHERE time < ?`), before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	pruned, _ := result.RowsAffected()
+	return int(pruned), nil
+}
+
+func (s *SQLAuditSink) Close() error {
+	if s.shared {
+		return nil
+	}
+	return s.db.Close()
+}
@@ -0,0 +1,7 @@
+//go:build audit_sqlite
+
+package orus
+
+// Registers the pure-Go SQLite driver for ORUS_API_AUDIT_SINK=sqlite.
+// Build with: go get modernc.org/sqlite && go build -tags audit_sqlite
+import _ "modernc.org/sqlite"
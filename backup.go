@@ -0,0 +1,465 @@
+package orus
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// BackupVersion is the version of the backup archives written. A restore
+// refuses the archives of a later version.
+const BackupVersion = 1
+
+// backupProgressStep is how many sessions, documents or images are copied
+// between two progress reports.
+const backupProgressStep = 500
+
+var (
+	ErrBackupsDisabled = errors.New("backups are disabled, the backup store could not be opened")
+	ErrBackupNotFound  = errors.New("backup not found")
+	ErrBackupRunning   = errors.New("a backup or restore is already running")
+	ErrInvalidBackup   = errors.New("invalid backup archive")
+)
+
+// The stages of a backup or a restore. A backup reads the sessions, the
+// documents and their media, then stores the archive; a restore reads the
+// archive first.
+const (
+	BackupStageSessions  = "sessions"
+	BackupStageDocuments = "documents"
+	BackupStageMedia     = "media"
+	BackupStageArchive   = "archive"
+)
+
+// The entries of a backup archive, a gzipped tar file. The manifest comes
+// first; sessions.jsonl and collections/<collection>.jsonl hold a JSON
+// value per line, and media/<id> the images linked to the documents.
+const (
+	backupManifestEntry = "manifest.json"
+	backupSessionsEntry = "sessions.jsonl"
+	backupCollectionDir = "collections/"
+	backupMediaDir      = "media/"
+)
+
+// BackupProgress reports how far a stage of a backup or a restore went, in
+// items, or in bytes for the archive.
+type BackupProgress struct {
+	Stage     string `json:"stage"`
+	Completed int64  `json:"completed"`
+	Total     int64  `json:"total"`
+}
+
+// BackupManifest describes the content of a backup archive.
+type BackupManifest struct {
+	Version   int       `json:"version" swaggertype:"integer" example:"1"`
+	CreatedAt time.Time `json:"created_at" swaggertype:"string" example:"2025-01-02T10:00:00Z"`
+	Sessions  int       `json:"sessions" swaggertype:"integer" example:"42"`
+	// Collections counts the documents of each vector collection.
+	Collections map[string]int `json:"collections" swaggertype:"object"`
+	Media       int            `json:"media" swaggertype:"integer" example:"12"`
+	// Config is the effective configuration of the server backed up, keyed
+	// like orus.yaml with its secrets masked. It is not restored: the server
+	// restored keeps its own.
+	Config map[string]interface{} `json:"config,omitempty" swaggertype:"object"`
+}
+
+// Backup is an archive of the backup store.
+type Backup struct {
+	Name      string          `json:"name" swaggertype:"string" example:"orus-20250102T100000Z.tar.gz"`
+	Size      int64           `json:"size" swaggertype:"integer" example:"5242880"`
+	CreatedAt time.Time       `json:"created_at" swaggertype:"string" example:"2025-01-02T10:00:00Z"`
+	Manifest  *BackupManifest `json:"manifest,omitempty"`
+}
+
+// progressReporter calls progress, when set, at the end of a stage and every
+// backupProgressStep items.
+func progressReporter(progress func(BackupProgress)) func(stage string, completed, total int64) {
+	return func(stage string, completed, total int64) {
+		if progress != nil && (completed == total || completed%backupProgressStep == 0) {
+			progress(BackupProgress{Stage: stage, Completed: completed, Total: total})
+		}
+	}
+}
+
+// Backup writes an archive of the sessions, of the documents of every
+// vector collection with their embeddings, of the images they link to and
+// of the configuration to the backup store. Each collection is read at a
+// single point in time, and the RAG index with no source half replaced.
+// progress, when set, is called as the stages go.
+func (s *Orus) Backup(progress func(BackupProgress)) (Backup, error) {
+	if s.Backups == nil {
+		return Backup{}, ErrBackupsDisabled
+	}
+	if !s.backupMu.TryLock() {
+		return Backup{}, ErrBackupRunning
+	}
+	defer s.backupMu.Unlock()
+	report := progressReporter(progress)
+
+	sessions, err := s.Sessions.List()
+	if err != nil {
+		return Backup{}, fmt.Errorf("error listing sessions: %w", err)
+	}
+	names := s.VectorStore.Collections()
+	collections := make(map[string][]Document, len(names))
+	for _, name := range names {
+		if s.Documents != nil && name == s.Documents.Collection {
+			collections[name] = s.Documents.Export()
+		} else {
+			collections[name] = s.VectorStore.Documents(name, nil)
+		}
+	}
+	media, err := s.backupMedia(collections, report)
+	if err != nil {
+		return Backup{}, err
+	}
+
+	now := time.Now().UTC()
+	manifest := BackupManifest{
+		Version:     BackupVersion,
+		CreatedAt:   now,
+		Sessions:    len(sessions),
+		Collections: make(map[string]int, len(collections)),
+		Media:       len(media),
+	}
+	for name, documents := range collections {
+		manifest.Collections[name] = len(documents)
+	}
+	// Encoding through YAML names the keys like the configuration file and
+	// masks the secrets
+	config, err := yaml.Marshal(s.CurrentConfig())
+	if err == nil {
+		err = yaml.Unmarshal(config, &manifest.Config)
+	}
+	if err != nil {
+		return Backup{}, fmt.Errorf("error encoding configuration: %w", err)
+	}
+
+	var buffer bytes.Buffer
+	compressed := gzip.NewWriter(&buffer)
+	archive := tar.NewWriter(compressed)
+	if err := writeBackupEntry(archive, backupManifestEntry, now, manifest); err != nil {
+		return Backup{}, err
+	}
+	values := make([]interface{}, len(sessions))
+	for i, session := range sessions {
+		values[i] = session
+		report(BackupStageSessions, int64(i+1), int64(len(sessions)))
+	}
+	if err := writeBackupEntry(archive, backupSessionsEntry, now, values...); err != nil {
+		return Backup{}, err
+	}
+	var total, completed int64
+	for _, documents := range collections {
+		total += int64(len(documents))
+	}
+	for _, name := range names {
+		values := make([]interface{}, len(collections[name]))
+		for i, document := range collections[name] {
+			values[i] = document
+			completed++
+			report(BackupStageDocuments, completed, total)
+		}
+		if err := writeBackupEntry(archive, backupCollectionDir+name+".jsonl", now, values...); err != nil {
+			return Backup{}, err
+		}
+	}
+	ids := make([]string, 0, len(media))
+	for id := range media {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if err := writeBackupFile(archive, backupMediaDir+id, now, media[id]); err != nil {
+			return Backup{}, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return Backup{}, fmt.Errorf("error writing backup archive: %w", err)
+	}
+	if err := compressed.Close(); err != nil {
+		return Backup{}, fmt.Errorf("error writing backup archive: %w", err)
+	}
+
+	backup := Backup{
+		Name:      "orus-" + now.Format("20060102T150405Z") + ".tar.gz",
+		Size:      int64(buffer.Len()),
+		CreatedAt: now,
+		Manifest:  &manifest,
+	}
+	report(BackupStageArchive, 0, backup.Size)
+	if err := s.Backups.Put(backup.Name, buffer.Bytes(), "application/gzip"); err != nil {
+		return Backup{}, fmt.Errorf("error storing backup: %w", err)
+	}
+	report(BackupStageArchive, backup.Size, backup.Size)
+	return backup, nil
+}
+
+// backupMedia reads the images the documents link to. An image missing from
+// the media store is left out of the backup.
+func (s *Orus) backupMedia(collections map[string][]Document, report func(string, int64, int64)) (map[string][]byte, error) {
+	media := make(map[string][]byte)
+	if s.Documents == nil || s.Documents.media == nil {
+		return media, nil
+	}
+	ids := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, documents := range collections {
+		for _, document := range documents {
+			for _, ref := range document.Media {
+				if !seen[ref.ID] {
+					seen[ref.ID] = true
+					ids = append(ids, ref.ID)
+				}
+			}
+		}
+	}
+	for i, id := range ids {
+		data, err := s.Documents.media.Get(id)
+		if errors.Is(err, ErrMediaNotFound) {
+			log.Printf("Media %s is missing, it is not backed up", id)
+		} else if err != nil {
+			return nil, fmt.Errorf("error reading media %s: %w", id, err)
+		} else {
+			media[id] = data
+		}
+		report(BackupStageMedia, int64(i+1), int64(len(ids)))
+	}
+	return media, nil
+}
+
+// writeBackupEntry writes values as an entry of the archive, a JSON value per
+// line.
+func writeBackupEntry(archive *tar.Writer, name string, modified time.Time, values ...interface{}) error {
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	for _, value := range values {
+		if err := encoder.Encode(value); err != nil {
+			return fmt.Errorf("error encoding %s: %w", name, err)
+		}
+	}
+	return writeBackupFile(archive, name, modified, data.Bytes())
+}
+
+func writeBackupFile(archive *tar.Writer, name string, modified time.Time, data []byte) error {
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0o600,
+		Size:     int64(len(data)),
+		ModTime:  modified,
+	}
+	if err := archive.WriteHeader(header); err != nil {
+		return fmt.Errorf("error writing backup archive: %w", err)
+	}
+	if _, err := archive.Write(data); err != nil {
+		return fmt.Errorf("error writing backup archive: %w", err)
+	}
+	return nil
+}
+
+// ListBackups returns the archives of the backup store, oldest first.
+func (s *Orus) ListBackups() ([]Backup, error) {
+	if s.Backups == nil {
+		return nil, ErrBackupsDisabled
+	}
+	blobs, err := s.Backups.List("")
+	if err != nil {
+		return nil, err
+	}
+	backups := make([]Backup, 0, len(blobs))
+	for _, blob := range blobs {
+		if !strings.HasSuffix(blob.Key, ".tar.gz") {
+			continue
+		}
+		createdAt := blob.Modified
+		taken := strings.TrimSuffix(strings.TrimPrefix(blob.Key, "orus-"), ".tar.gz")
+		if parsed, err := time.Parse("20060102T150405Z", taken); err == nil {
+			createdAt = parsed
+		}
+		backups = append(backups, Backup{Name: blob.Key, Size: blob.Size, CreatedAt: createdAt})
+	}
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.Before(backups[j].CreatedAt)
+	})
+	return backups, nil
+}
+
+// backupContents is a backup archive as read.
+type backupContents struct {
+	manifest    BackupManifest
+	sessions    []Session
+	collections map[string][]Document
+	media       map[string][]byte
+}
+
+// Restore loads the backup name into the server, as when moving to a new
+// instance: the sessions replace those of the same ID, the documents of each
+// collection of the archive replace those of the collection, and the images
+// are stored again. The archive is read whole before anything changes, so
+// a damaged archive leaves the server as it was. The configuration is not
+// restored. progress, when set, is called as the stages go.
+func (s *Orus) Restore(name string, progress func(BackupProgress)) (*BackupManifest, error) {
+	if s.Backups == nil {
+		return nil, ErrBackupsDisabled
+	}
+	if !s.backupMu.TryLock() {
+		return nil, ErrBackupRunning
+	}
+	defer s.backupMu.Unlock()
+	report := progressReporter(progress)
+
+	data, err := s.Backups.Get(name)
+	if errors.Is(err, ErrBlobNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrBackupNotFound, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading backup: %w", err)
+	}
+	report(BackupStageArchive, 0, int64(len(data)))
+	contents, err := readBackup(data)
+	if err != nil {
+		return nil, err
+	}
+	report(BackupStageArchive, int64(len(data)), int64(len(data)))
+
+	for i, session := range contents.sessions {
+		if err := s.Sessions.Import(session); err != nil {
+			return nil, fmt.Errorf("error restoring session %s: %w", session.ID, err)
+		}
+		report(BackupStageSessions, int64(i+1), int64(len(contents.sessions)))
+	}
+	names := make([]string, 0, len(contents.collections))
+	var total, completed int64
+	for name, documents := range contents.collections {
+		names = append(names, name)
+		total += int64(len(documents))
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		documents := contents.collections[name]
+		if s.Documents != nil && name == s.Documents.Collection {
+			if err := s.Documents.Restore(documents); err != nil {
+				return nil, fmt.Errorf("error restoring documents: %w", err)
+			}
+		} else {
+			s.VectorStore.DeleteWhere(name, func(Document) bool {
+				return true
+			})
+			s.VectorStore.Add(name, documents...)
+		}
+		if name == MemoryCollection && s.Memory != nil {
+			s.Memory.save()
+		}
+		completed += int64(len(documents))
+		report(BackupStageDocuments, completed, total)
+	}
+	// the media go last, as replacing the documents removes the media only
+	// the replaced ones linked to
+	ids := make([]string, 0, len(contents.media))
+	for id := range contents.media {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for i, id := range ids {
+		if s.Documents == nil || s.Documents.media == nil {
+			log.Printf("The media store is disabled, %d images are not restored", len(ids))
+			break
+		}
+		if _, err := s.Documents.media.Put(contents.media[id]); err != nil {
+			return nil, fmt.Errorf("error restoring media %s: %w", id, err)
+		}
+		report(BackupStageMedia, int64(i+1), int64(len(ids)))
+	}
+	return &contents.manifest, nil
+}
+
+// readBackup decodes a backup archive. The entries it does not know, which
+// a later version may add, are skipped.
+func readBackup(data []byte) (*backupContents, error) {
+	compressed, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	archive := tar.NewReader(compressed)
+	contents := &backupContents{
+		sessions:    make([]Session, 0),
+		collections: make(map[string][]Document),
+		media:       make(map[string][]byte),
+	}
+	for first := true; ; first = false {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			if first {
+				return nil, fmt.Errorf("%w: the archive is empty", ErrInvalidBackup)
+			}
+			return contents, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+		}
+		entry, err := io.ReadAll(archive)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidBackup, header.Name, err)
+		}
+		if first {
+			if header.Name != backupManifestEntry {
+				return nil, fmt.Errorf("%w: the archive does not start with %s", ErrInvalidBackup, backupManifestEntry)
+			}
+			if err := json.Unmarshal(entry, &contents.manifest); err != nil {
+				return nil, fmt.Errorf("%w: %s: %v", ErrInvalidBackup, header.Name, err)
+			}
+			if contents.manifest.Version > BackupVersion {
+				return nil, fmt.Errorf("%w: version %d is newer than this server, which reads version %d",
+					ErrInvalidBackup, contents.manifest.Version, BackupVersion)
+			}
+			continue
+		}
+		switch {
+		case header.Name == backupSessionsEntry:
+			contents.sessions, err = decodeBackupLines[Session](entry)
+		case strings.HasPrefix(header.Name, backupCollectionDir) && strings.HasSuffix(header.Name, ".jsonl"):
+			name := strings.TrimSuffix(strings.TrimPrefix(header.Name, backupCollectionDir), ".jsonl")
+			if name == "" || strings.Contains(name, "/") {
+				return nil, fmt.Errorf("%w: invalid collection entry %s", ErrInvalidBackup, header.Name)
+			}
+			contents.collections[name], err = decodeBackupLines[Document](entry)
+		case strings.HasPrefix(header.Name, backupMediaDir):
+			id := strings.TrimPrefix(header.Name, backupMediaDir)
+			if !isMediaID(id) {
+				return nil, fmt.Errorf("%w: invalid media entry %s", ErrInvalidBackup, header.Name)
+			}
+			contents.media[id] = entry
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidBackup, header.Name, err)
+		}
+	}
+}
+
+// decodeBackupLines decodes an entry holding a JSON value per line.
+func decodeBackupLines[T any](data []byte) ([]T, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	values := make([]T, 0)
+	for {
+		var value T
+		err := decoder.Decode(&value)
+		if errors.Is(err, io.EOF) {
+			return values, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+}
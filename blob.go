@@ -0,0 +1,185 @@
+package orus
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	BlobDisk       = "disk"
+	BlobS3         = "s3"
+	DefaultBlobDir = "./blobs/"
+)
+
+// ErrBlobNotFound is returned for a key that has no blob.
+var ErrBlobNotFound = errors.New("the blob does not exist")
+
+type BlobConfig struct {
+	// Backend is "disk", which keeps the blobs in directories of the
+	// server, or "s3", which keeps them in a bucket of S3 or of a compatible
+	// service such as MinIO, so the replicas share them.
+	Backend string `yaml:"backend"`
+	// Dir holds the directories of the disk blobs, except the media and
+	// images, which keep the directories of their own settings.
+	Dir string `yaml:"dir"`
+	// KeepUploads keeps the files uploaded for ingestion, so they can be
+	// downloaded again.
+	KeepUploads bool     `yaml:"keep_uploads"`
+	S3          S3Config `yaml:"s3"`
+}
+
+// BlobInfo describes a stored blob.
+type BlobInfo struct {
+	Key         string    `json:"key"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type,omitempty"`
+	Modified    time.Time `json:"modified"`
+}
+
+// BlobStore keeps binary objects by key: the uploaded documents and images,
+// the media of the indexed documents and the index snapshots. Keys are
+// slash separated paths.
+type BlobStore interface {
+	Put(key string, data []byte, contentType string) error
+	// Get returns the blob of key, or ErrBlobNotFound.
+	Get(key string) ([]byte, error)
+	// Stat describes the blob of key, or returns ErrBlobNotFound.
+	Stat(key string) (BlobInfo, error)
+	// Delete removes the blob of key; a missing blob is not an error.
+	Delete(key string) error
+	// List describes the blobs whose keys start with prefix, by key.
+	List(prefix string) ([]BlobInfo, error)
+}
+
+// OpenBlobStore returns the store of the blobs of a feature, name. On disk
+// they are kept in dir, or in the name directory of config.Dir when dir is
+// empty; in S3 under the name prefix.
+func OpenBlobStore(config BlobConfig, name, dir string) (BlobStore, error) {
+	switch config.Backend {
+	case "", BlobDisk:
+		if dir == "" {
+			dir = filepath.Join(config.Dir, name)
+		}
+		return NewDiskBlobStore(dir)
+	case BlobS3:
+		return NewS3BlobStore(config.S3, name+"/")
+	}
+	return nil, fmt.Errorf("unknown blob backend %q, expected disk or s3", config.Backend)
+}
+
+// UploadKey is the key of the file uploaded for source in the upload store.
+func UploadKey(source string) string {
+	sum := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(sum[:])
+}
+
+// DiskBlobStore keeps the blobs as the files of a directory, created with
+// the first blob. The content type is not kept, so Stat leaves it empty.
+type DiskBlobStore struct {
+	dir string
+}
+
+func NewDiskBlobStore(dir string) (*DiskBlobStore, error) {
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		return nil, fmt.Errorf("blob directory %s is a file", dir)
+	}
+	return &DiskBlobStore{dir: dir}, nil
+}
+
+// path returns the file of key, refusing the keys leaving the directory.
+func (s *DiskBlobStore) path(key string) (string, error) {
+	if key == "" || !fs.ValidPath(key) {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes the blob to a temporary file renamed over the key, so readers
+// never see it half written.
+func (s *DiskBlobStore) Put(key string, data []byte, _ string) error {
+	file, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+func (s *DiskBlobStore) Get(key string) ([]byte, error) {
+	file, err := s.path(key)
+	if err != nil {
+		return nil, ErrBlobNotFound
+	}
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+	return data, err
+}
+
+func (s *DiskBlobStore) Stat(key string) (BlobInfo, error) {
+	file, err := s.path(key)
+	if err != nil {
+		return BlobInfo{}, ErrBlobNotFound
+	}
+	info, err := os.Stat(file)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && info.IsDir()) {
+		return BlobInfo{}, ErrBlobNotFound
+	}
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	return BlobInfo{Key: key, Size: info.Size(), Modified: info.ModTime()}, nil
+}
+
+func (s *DiskBlobStore) Delete(key string) error {
+	file, err := s.path(key)
+	if err != nil {
+		return nil
+	}
+	if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *DiskBlobStore) List(prefix string) ([]BlobInfo, error) {
+	blobs := make([]BlobInfo, 0)
+	err := filepath.WalkDir(s.dir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || strings.HasSuffix(file, ".tmp") {
+			return err
+		}
+		relative, err := filepath.Rel(s.dir, file)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(relative)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// removed while listing
+			return nil
+		}
+		blobs = append(blobs, BlobInfo{Key: key, Size: info.Size(), Modified: info.ModTime()})
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return blobs, nil
+}
@@ -0,0 +1,311 @@
+package orus
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultS3Region  = "us-east-1"
+	DefaultS3Timeout = 30 * time.Second
+)
+
+type S3Config struct {
+	// Endpoint is the URL of the service, such as
+	// https://s3.eu-west-1.amazonaws.com or http://minio:9000.
+	Endpoint  string `yaml:"endpoint"`
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	AccessKey Secret `yaml:"access_key"`
+	SecretKey Secret `yaml:"secret_key"`
+	// PathStyle addresses the bucket in the path instead of the host name,
+	// as MinIO and most S3 compatible services expect.
+	PathStyle bool `yaml:"path_style"`
+	// Prefix starts every key, so several deployments can share a bucket.
+	Prefix string `yaml:"prefix"`
+}
+
+// S3BlobStore keeps the blobs in a bucket of S3 or of a compatible service.
+// It signs its requests with AWS Signature Version 4 itself, so the server
+// needs no SDK.
+type S3BlobStore struct {
+	client    *http.Client
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	pathStyle bool
+	prefix    string
+}
+
+// NewS3BlobStore keeps the blobs under prefix in the bucket of config. The
+// bucket is checked, so wrong credentials fail at startup rather than on the
+// first upload.
+func NewS3BlobStore(config S3Config, prefix string) (*S3BlobStore, error) {
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", config.Endpoint)
+	}
+	region := config.Region
+	if region == "" {
+		region = DefaultS3Region
+	}
+	s := &S3BlobStore{
+		client:    &http.Client{Timeout: DefaultS3Timeout},
+		endpoint:  endpoint,
+		region:    region,
+		bucket:    config.Bucket,
+		accessKey: config.AccessKey.Reveal(),
+		secretKey: config.SecretKey.Reveal(),
+		pathStyle: config.PathStyle,
+		prefix:    config.Prefix + prefix,
+	}
+	response, err := s.do(http.MethodHead, "", nil, nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("error reaching s3 bucket %s: %w", s.bucket, err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error reaching s3 bucket %s: status %d", s.bucket, response.StatusCode)
+	}
+	return s, nil
+}
+
+func (s *S3BlobStore) Put(key string, data []byte, contentType string) error {
+	response, err := s.do(http.MethodPut, s.prefix+key, nil, data, contentType)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return s3Error(response, key)
+	}
+	return nil
+}
+
+func (s *S3BlobStore) Get(key string) ([]byte, error) {
+	response, err := s.do(http.MethodGet, s.prefix+key, nil, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	switch response.StatusCode {
+	case http.StatusOK:
+		return io.ReadAll(response.Body)
+	case http.StatusNotFound:
+		return nil, ErrBlobNotFound
+	}
+	return nil, s3Error(response, key)
+}
+
+func (s *S3BlobStore) Stat(key string) (BlobInfo, error) {
+	response, err := s.do(http.MethodHead, s.prefix+key, nil, nil, "")
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	response.Body.Close()
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return BlobInfo{}, ErrBlobNotFound
+	default:
+		return BlobInfo{}, fmt.Errorf("s3 %s: status %d", key, response.StatusCode)
+	}
+	info := BlobInfo{Key: key, ContentType: response.Header.Get("Content-Type")}
+	info.Size, _ = strconv.ParseInt(response.Header.Get("Content-Length"), 10, 64)
+	info.Modified, _ = http.ParseTime(response.Header.Get("Last-Modified"))
+	return info, nil
+}
+
+func (s *S3BlobStore) Delete(key string) error {
+	response, err := s.do(http.MethodDelete, s.prefix+key, nil, nil, "")
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusNoContent && response.StatusCode != http.StatusOK && response.StatusCode != http.StatusNotFound {
+		return s3Error(response, key)
+	}
+	return nil
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List pages through ListObjectsV2, which returns the keys in order.
+func (s *S3BlobStore) List(prefix string) ([]BlobInfo, error) {
+	blobs := make([]BlobInfo, 0)
+	query := url.Values{"list-type": {"2"}, "prefix": {s.prefix + prefix}}
+	for {
+		response, err := s.do(http.MethodGet, "", query, nil, "")
+		if err != nil {
+			return nil, err
+		}
+		if response.StatusCode != http.StatusOK {
+			err := s3Error(response, prefix)
+			response.Body.Close()
+			return nil, err
+		}
+		var result s3ListResult
+		err = xml.NewDecoder(response.Body).Decode(&result)
+		response.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error decoding s3 listing: %w", err)
+		}
+		for _, object := range result.Contents {
+			blobs = append(blobs, BlobInfo{
+				Key:      strings.TrimPrefix(object.Key, s.prefix),
+				Size:     object.Size,
+				Modified: object.LastModified,
+			})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return blobs, nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+// do sends a signed request for the object key, or for the bucket when key
+// is empty.
+func (s *S3BlobStore) do(method, key string, query url.Values, body []byte, contentType string) (*http.Response, error) {
+	target := *s.endpoint
+	objectPath := "/" + key
+	if s.pathStyle {
+		objectPath = "/" + s.bucket + objectPath
+	} else {
+		target.Host = s.bucket + "." + target.Host
+	}
+	target.Path = strings.TrimSuffix(target.Path, "/") + objectPath
+	target.RawPath = s3Escape(target.Path, false)
+	target.RawQuery = s3Query(query)
+	req, err := http.NewRequest(method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	signV4(req, body, time.Now().UTC(), s.region, "s3", s.accessKey, s.secretKey)
+	return s.client.Do(req)
+}
+
+// signV4 adds the AWS Signature Version 4 of req, a request to service in
+// region, to its headers.
+func signV4(req *http.Request, body []byte, now time.Time, region, service, accessKey, secretKey string) {
+	payload := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(payload[:])
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	if contentType := req.Header.Get("Content-Type"); contentType != "" {
+		headers["content-type"] = contentType
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Escape encodes value as Signature Version 4 expects: every byte but the
+// unreserved characters, and the slashes of a path unless encodeSlash.
+func s3Escape(value string, encodeSlash bool) string {
+	var escaped strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~', b == '/' && !encodeSlash:
+			escaped.WriteByte(b)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
+
+// s3Query encodes query sorted by name, as the canonical request has it.
+func s3Query(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		for _, value := range query[name] {
+			parts = append(parts, s3Escape(name, true)+"="+s3Escape(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Error reads the message of an S3 error response.
+func s3Error(response *http.Response, key string) error {
+	var failure struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(response.Body, 64*1024))
+	if xml.Unmarshal(data, &failure) == nil && failure.Code != "" {
+		return fmt.Errorf("s3 %s: %s: %s", key, failure.Code, failure.Message)
+	}
+	return fmt.Errorf("s3 %s: status %d", key, response.StatusCode)
+}
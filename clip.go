@@ -0,0 +1,443 @@
+package orus
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"image"
+	"image/draw"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+const (
+	// ClipModel is the embedding model name of the CLIP encoders. Its text
+	// and image embeddings share a space, so either finds the other.
+	ClipModel = "clip"
+	// ImageCollection holds the embeddings of the indexed images.
+	ImageCollection       = "images"
+	DefaultClipImageSize  = 224
+	clipContextLength     = 77
+	clipStartOfText       = "<|startoftext|>"
+	clipEndOfText         = "<|endoftext|>"
+	clipEndOfWord         = "</w>"
+	clipImageInput        = "pixel_values"
+	clipImageOutput       = "image_embeds"
+	clipTextInput         = "input_ids"
+	clipTextMask          = "attention_mask"
+	clipTextOutput        = "text_embeds"
+	clipTokenizerMaxRunes = 10_000
+)
+
+// ErrClipDisabled is returned when an image or CLIP text embedding is asked
+// for and the CLIP encoders are not configured.
+var ErrClipDisabled = errors.New("image embeddings are disabled, set ORUS_API_CLIP_IMAGE_PATH")
+
+// ErrClipTextDisabled is returned for a CLIP text embedding without a text
+// encoder.
+var ErrClipTextDisabled = errors.New("CLIP text embeddings are disabled, set ORUS_API_CLIP_TEXT_PATH and ORUS_API_CLIP_TOK_PATH")
+
+var (
+	// clipMean and clipStd normalize the pixels as in CLIP training.
+	clipMean = [3]float32{0.48145466, 0.4578275, 0.40821073}
+	clipStd  = [3]float32{0.26862954, 0.26130258, 0.27577711}
+	// clipWordPattern splits text into words like the CLIP tokenizer.
+	clipWordPattern = regexp.MustCompile(`<\|startoftext\|>|<\|endoftext\|>|'s|'t|'re|'ve|'m|'ll|'d|\p{L}+|\p{N}|[^\s\p{L}\p{N}]+`)
+)
+
+// onnxMu serializes the use of the ONNX runtime, as the bge-m3 embedder
+// creates and destroys its environment on every call.
+var onnxMu sync.Mutex
+
+// ClipEmbedder embeds images, and text when it has a text encoder, with a
+// CLIP-style model exported to ONNX as an image and a text encoder.
+type ClipEmbedder struct {
+	imagePath   string
+	textPath    string
+	runtimePath string
+	imageSize   int
+	tokenizer   *clipTokenizer
+}
+
+// NewClipEmbedder returns the embedder of the CLIP encoders of config, or
+// nil when no image encoder is configured.
+func NewClipEmbedder(config EmbedderConfig) (*ClipEmbedder, error) {
+	if config.ClipImagePath == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(config.ClipImagePath); err != nil {
+		return nil, fmt.Errorf("error reading CLIP image encoder: %w", err)
+	}
+	embedder := &ClipEmbedder{
+		imagePath:   config.ClipImagePath,
+		textPath:    config.ClipTextPath,
+		runtimePath: config.OnnxRuntimePath,
+		imageSize:   config.ClipImageSize,
+	}
+	if embedder.imageSize <= 0 {
+		embedder.imageSize = DefaultClipImageSize
+	}
+	if config.ClipTextPath != "" {
+		if _, err := os.Stat(config.ClipTextPath); err != nil {
+			return nil, fmt.Errorf("error reading CLIP text encoder: %w", err)
+		}
+		tokenizer, err := loadClipTokenizer(config.ClipTokPath)
+		if err != nil {
+			return nil, err
+		}
+		embedder.tokenizer = tokenizer
+	}
+	return embedder, nil
+}
+
+// EmbedImage returns the normalized embedding of an encoded image.
+func (c *ClipEmbedder) EmbedImage(data []byte) ([]float32, error) {
+	if c == nil {
+		return nil, ErrClipDisabled
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("the image cannot be decoded: %w", err)
+	}
+	pixels := clipPixels(decoded, c.imageSize)
+	size := int64(c.imageSize)
+	var vector []float32
+	err = c.withRuntime(func() error {
+		input, err := ort.NewTensor(ort.NewShape(1, 3, size, size), pixels)
+		if err != nil {
+			return err
+		}
+		defer input.Destroy()
+		vector, err = runEncoder(c.imagePath, map[string]ort.Value{clipImageInput: input}, clipImageOutput)
+		return err
+	})
+	return vector, err
+}
+
+// EmbedText returns the normalized embedding of text with the text encoder.
+func (c *ClipEmbedder) EmbedText(text string) ([]float32, error) {
+	if c == nil {
+		return nil, ErrClipDisabled
+	}
+	if c.tokenizer == nil {
+		return nil, ErrClipTextDisabled
+	}
+	ids, mask := c.tokenizer.Encode(text)
+	var vector []float32
+	err := c.withRuntime(func() error {
+		shape := ort.NewShape(1, int64(len(ids)))
+		inputIDs, err := ort.NewTensor(shape, ids)
+		if err != nil {
+			return err
+		}
+		defer inputIDs.Destroy()
+		attentionMask, err := ort.NewTensor(shape, mask)
+		if err != nil {
+			return err
+		}
+		defer attentionMask.Destroy()
+		inputs := map[string]ort.Value{clipTextInput: inputIDs, clipTextMask: attentionMask}
+		vector, err = runEncoder(c.textPath, inputs, clipTextOutput)
+		return err
+	})
+	return vector, err
+}
+
+func (c *ClipEmbedder) withRuntime(run func() error) error {
+	onnxMu.Lock()
+	defer onnxMu.Unlock()
+	if !ort.IsInitialized() {
+		ort.SetSharedLibraryPath(c.runtimePath)
+		if err := ort.InitializeEnvironment(); err != nil {
+			return fmt.Errorf("error initializing the ONNX runtime: %w", err)
+		}
+	}
+	return run()
+}
+
+// runEncoder runs the encoder at path with the inputs it declares, which
+// must be among inputs, and returns its output named output, or its first
+// output, L2 normalized.
+func runEncoder(path string, inputs map[string]ort.Value, output string) ([]float32, error) {
+	inputInfo, outputInfo, err := ort.GetInputOutputInfo(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading encoder %s: %w", path, err)
+	}
+	if len(outputInfo) == 0 {
+		return nil, fmt.Errorf("encoder %s has no output", path)
+	}
+	names := make([]string, 0, len(inputInfo))
+	values := make([]ort.Value, 0, len(inputInfo))
+	for _, info := range inputInfo {
+		value, ok := inputs[info.Name]
+		if !ok {
+			return nil, fmt.Errorf("encoder %s has an unexpected input %q", path, info.Name)
+		}
+		names = append(names, info.Name)
+		values = append(values, value)
+	}
+	outputName := outputInfo[0].Name
+	for _, info := range outputInfo {
+		if info.Name == output {
+			outputName = output
+		}
+	}
+
+	session, err := ort.NewDynamicAdvancedSession(path, names, []string{outputName}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error loading encoder %s: %w", path, err)
+	}
+	defer session.Destroy()
+	outputs := []ort.Value{nil}
+	if err := session.Run(values, outputs); err != nil {
+		return nil, fmt.Errorf("error running encoder %s: %w", path, err)
+	}
+	defer outputs[0].Destroy()
+	tensor, ok := outputs[0].(*ort.Tensor[float32])
+	if !ok {
+		return nil, fmt.Errorf("encoder %s output %s is not a float32 tensor", path, outputName)
+	}
+	if shape := tensor.GetShape(); len(shape) != 2 || shape[0] != 1 {
+		return nil, fmt.Errorf("encoder %s output %s has shape %v, expected an embedding", path, outputName, shape)
+	}
+	vector := append([]float32(nil), tensor.GetData()...)
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	if norm > 0 {
+		scale := float32(1 / math.Sqrt(norm))
+		for i := range vector {
+			vector[i] *= scale
+		}
+	}
+	return vector, nil
+}
+
+// clipPixels resizes src so its short side is size, crops its center square
+// and returns it normalized, channels first.
+func clipPixels(src image.Image, size int) []float32 {
+	bounds := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+
+	width, height := bounds.Dx(), bounds.Dy()
+	scaledWidth, scaledHeight := size, max(height*size/width, size)
+	if width > height {
+		scaledWidth, scaledHeight = max(width*size/height, size), size
+	}
+	// average down to about the final size first, so the interpolation
+	// does not alias
+	rgba = scaleDown(rgba, max(scaledWidth, scaledHeight))
+	rgba = resizeBilinear(rgba, scaledWidth, scaledHeight)
+
+	left, top := (scaledWidth-size)/2, (scaledHeight-size)/2
+	pixels := make([]float32, 3*size*size)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			offset := (top+y)*rgba.Stride + (left+x)*4
+			for channel := 0; channel < 3; channel++ {
+				value := float32(rgba.Pix[offset+channel]) / 255
+				pixels[channel*size*size+y*size+x] = (value - clipMean[channel]) / clipStd[channel]
+			}
+		}
+	}
+	return pixels
+}
+
+// resizeBilinear returns src resized to width by height.
+func resizeBilinear(src *image.RGBA, width, height int) *image.RGBA {
+	srcWidth, srcHeight := src.Bounds().Dx(), src.Bounds().Dy()
+	if srcWidth == width && srcHeight == height {
+		return src
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		sy := math.Max(0, (float64(y)+0.5)*float64(srcHeight)/float64(height)-0.5)
+		y0 := min(int(sy), srcHeight-1)
+		y1 := min(y0+1, srcHeight-1)
+		fy := sy - float64(y0)
+		for x := 0; x < width; x++ {
+			sx := math.Max(0, (float64(x)+0.5)*float64(srcWidth)/float64(width)-0.5)
+			x0 := min(int(sx), srcWidth-1)
+			x1 := min(x0+1, srcWidth-1)
+			fx := sx - float64(x0)
+			for channel := 0; channel < 4; channel++ {
+				at := func(px, py int) float64 {
+					return float64(src.Pix[py*src.Stride+px*4+channel])
+				}
+				top := at(x0, y0)*(1-fx) + at(x1, y0)*fx
+				bottom := at(x0, y1)*(1-fx) + at(x1, y1)*fx
+				dst.Pix[y*dst.Stride+x*4+channel] = uint8(math.Round(top*(1-fy) + bottom*fy))
+			}
+		}
+	}
+	return dst
+}
+
+// clipTokenizer is the byte-level BPE tokenizer of CLIP, read from the
+// tokenizer.json of the model.
+type clipTokenizer struct {
+	vocab   map[string]int64
+	ranks   map[[2]string]int
+	bytes   [256]string
+	start   int64
+	end     int64
+	cacheMu sync.Mutex
+	cache   map[string][]int64
+}
+
+func loadClipTokenizer(path string) (*clipTokenizer, error) {
+	if path == "" {
+		return nil, errors.New("the CLIP tokenizer is required by the text encoder")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading CLIP tokenizer: %w", err)
+	}
+	var file struct {
+		Model struct {
+			Vocab  map[string]int64  `json:"vocab"`
+			Merges []json.RawMessage `json:"merges"`
+		} `json:"model"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error decoding CLIP tokenizer: %w", err)
+	}
+	tokenizer := &clipTokenizer{
+		vocab: file.Model.Vocab,
+		ranks: make(map[[2]string]int, len(file.Model.Merges)),
+		cache: make(map[string][]int64),
+	}
+	// merges are "a b" in older files and ["a", "b"] in newer ones
+	for rank, raw := range file.Model.Merges {
+		var pair []string
+		var merge string
+		if err := json.Unmarshal(raw, &merge); err == nil {
+			pair = strings.Split(merge, " ")
+		} else if err := json.Unmarshal(raw, &pair); err != nil {
+			return nil, fmt.Errorf("error decoding CLIP tokenizer merge %d: %w", rank, err)
+		}
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("invalid CLIP tokenizer merge %d", rank)
+		}
+		tokenizer.ranks[[2]string{pair[0], pair[1]}] = rank
+	}
+	var ok bool
+	if tokenizer.start, ok = tokenizer.vocab[clipStartOfText]; !ok {
+		return nil, fmt.Errorf("the CLIP tokenizer has no %s token", clipStartOfText)
+	}
+	if tokenizer.end, ok = tokenizer.vocab[clipEndOfText]; !ok {
+		return nil, fmt.Errorf("the CLIP tokenizer has no %s token", clipEndOfText)
+	}
+	// the GPT-2 mapping of bytes to printable runes
+	n := 0
+	for b := 0; b < 256; b++ {
+		if ('!' <= b && b <= '~') || (0xA1 <= b && b <= 0xAC) || (0xAE <= b && b <= 0xFF) {
+			tokenizer.bytes[b] = string(rune(b))
+		} else {
+			tokenizer.bytes[b] = string(rune(256 + n))
+			n++
+		}
+	}
+	return tokenizer, nil
+}
+
+// Encode returns the token ids of text and their attention mask, padded to
+// the context length of CLIP; longer texts are truncated.
+func (t *clipTokenizer) Encode(text string) ([]int64, []int64) {
+	text = strings.ToLower(strings.Join(strings.Fields(html.UnescapeString(text)), " "))
+	if runes := []rune(text); len(runes) > clipTokenizerMaxRunes {
+		text = string(runes[:clipTokenizerMaxRunes])
+	}
+	ids := make([]int64, 0, clipContextLength)
+	ids = append(ids, t.start)
+	for _, word := range clipWordPattern.FindAllString(text, -1) {
+		ids = append(ids, t.word(word)...)
+		if len(ids) >= clipContextLength-1 {
+			break
+		}
+	}
+	if len(ids) > clipContextLength-1 {
+		ids = ids[:clipContextLength-1]
+	}
+	ids = append(ids, t.end)
+	mask := make([]int64, clipContextLength)
+	for i := range ids {
+		mask[i] = 1
+	}
+	for len(ids) < clipContextLength {
+		ids = append(ids, t.end)
+	}
+	return ids, mask
+}
+
+// word returns the tokens of a word, merging its bytes pair by pair in the
+// order of the merges.
+func (t *clipTokenizer) word(word string) []int64 {
+	if id, ok := t.vocab[word]; ok && (word == clipStartOfText || word == clipEndOfText) {
+		return []int64{id}
+	}
+	t.cacheMu.Lock()
+	cached, ok := t.cache[word]
+	t.cacheMu.Unlock()
+	if ok {
+		return cached
+	}
+
+	symbols := make([]string, 0, len(word))
+	for i := 0; i < len(word); i++ {
+		symbols = append(symbols, t.bytes[word[i]])
+	}
+	symbols[len(symbols)-1] += clipEndOfWord
+	for len(symbols) > 1 {
+		best, bestRank := -1, math.MaxInt
+		for i := 0; i < len(symbols)-1; i++ {
+			if rank, ok := t.ranks[[2]string{symbols[i], symbols[i+1]}]; ok && rank < bestRank {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		first, second := symbols[best], symbols[best+1]
+		merged := make([]string, 0, len(symbols)-1)
+		for i := 0; i < len(symbols); i++ {
+			if i < len(symbols)-1 && symbols[i] == first && symbols[i+1] == second {
+				merged = append(merged, first+second)
+				i++
+				continue
+			}
+			merged = append(merged, symbols[i])
+		}
+		symbols = merged
+	}
+
+	ids := make([]int64, 0, len(symbols))
+	for _, symbol := range symbols {
+		if id, ok := t.vocab[symbol]; ok {
+			ids = append(ids, id)
+		}
+	}
+	t.cacheMu.Lock()
+	if len(t.cache) < 10_000 {
+		t.cache[word] = ids
+	}
+	t.cacheMu.Unlock()
+	return ids
+}
+
+func Float64s(vector []float32) []float64 {
+	converted := make([]float64, len(vector))
+	for i, v := range vector {
+		converted[i] = float64(v)
+	}
+	return converted
+}
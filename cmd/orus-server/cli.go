@@ -0,0 +1,557 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Dsouza10082/orus"
+	"github.com/Dsouza10082/orus/api"
+	"github.com/Dsouza10082/orus/ollama"
+)
+
+// RAGIndexFileName is the file, inside the agent memory path, where
+// `orus-api index` keeps the documents that `orus-api search` queries.
+const RAGIndexFileName = "rag_documents.json"
+
+const cliUsage = `Usage: orus-api <command> [flags] [arguments]
+
+Commands:
+  serve                 Start the API server (the default)
+  embed <text>          Print the embedding of text
+  index <path>...       Chunk, embed and store the text files under the paths
+  search <query>        Print the indexed chunks closest to query
+  pull <model>          Download an Ollama model
+  check                 Check the configuration, models and Ollama without serving
+  migrate               Apply or roll back the migrations of the storage schema
+  reencrypt             Encrypt the stored values again under the first encryption key
+  mcp                   Serve the index and memory to an MCP client over stdio
+
+Run "orus-api <command> -h" for the flags of a command.
+`
+
+func main() {
+	os.Exit(runCLI(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// runCLI runs the command in args and returns the exit code.
+func runCLI(args []string, stdout io.Writer, stderr io.Writer) int {
+	command := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	commands := map[string]func(args []string, stdout io.Writer) error{
+		"serve":     cliServe,
+		"embed":     cliEmbed,
+		"index":     cliIndex,
+		"search":    cliSearch,
+		"pull":      cliPull,
+		"check":     cliCheck,
+		"mcp":       cliMCP,
+		"migrate":   cliMigrate,
+		"reencrypt": cliReencrypt,
+	}
+	run, ok := commands[command]
+	if !ok {
+		if command != "help" {
+			fmt.Fprintf(stderr, "unknown command %q\n\n", command)
+		}
+		fmt.Fprint(stderr, cliUsage)
+		if command == "help" {
+			return 0
+		}
+		return 2
+	}
+	if err := run(args, stdout); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		fmt.Fprintf(stderr, "orus-api %s: %v\n", command, err)
+		return 1
+	}
+	return 0
+}
+
+// cliFlags are the flags every command accepts.
+type cliFlags struct {
+	*flag.FlagSet
+	config *string
+}
+
+func newCLIFlags(command string, usage string) cliFlags {
+	set := flag.NewFlagSet(command, flag.ContinueOnError)
+	set.Usage = func() {
+		fmt.Fprintf(set.Output(), "Usage: orus-api %s %s\n\nFlags:\n", command, usage)
+		set.PrintDefaults()
+	}
+	return cliFlags{
+		FlagSet: set,
+		config:  set.String("config", "", "YAML configuration file (default $ORUS_API_CONFIG or orus.yaml)"),
+	}
+}
+
+func (f cliFlags) loadConfig() (orus.Config, error) {
+	config, err := orus.LoadConfig(*f.config)
+	if err != nil {
+		return config, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return config, nil
+}
+
+func cliServe(args []string, stdout io.Writer) error {
+	flags := newCLIFlags("serve", "[flags]")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	config, err := flags.loadConfig()
+	if err != nil {
+		return err
+	}
+	if *flags.config != "" {
+		// Reload reads the configuration file from ORUS_API_CONFIG
+		os.Setenv("ORUS_API_CONFIG", *flags.config)
+	}
+	var opts []api.Option
+	if config.Log.Enabled() {
+		sinks, err := orus.OpenLogSinks(config.Log)
+		if err != nil {
+			return err
+		}
+		defer sinks.Close()
+		// slog and the request logs write through the log package too
+		log.SetOutput(sinks)
+		opts = append(opts, api.WithLogger(slog.Default()))
+	}
+	if config.Server.Preflight != orus.PreflightOff {
+		report := orus.RunPreflight(config)
+		log.Print(report)
+		if failed := report.Failed(); len(failed) > 0 {
+			if config.Server.Preflight == orus.PreflightStrict {
+				return fmt.Errorf("preflight failed (%d checks), refusing to start. Set ORUS_API_PREFLIGHT=warn to start anyway", len(failed))
+			}
+			log.Printf("Preflight failed (%d checks), starting in degraded mode: the failed features will error until fixed", len(failed))
+		}
+	}
+	orusApi, err := api.NewOrusAPI(config, opts...)
+	if orusApi == nil {
+		return err
+	}
+	if err != nil {
+		logDegraded(err)
+		if config.Server.Preflight == orus.PreflightStrict {
+			return errors.New("some features failed to load, refusing to start. Set ORUS_API_PREFLIGHT=warn to start anyway")
+		}
+	}
+	return orusApi.Start()
+}
+
+// newCLIOrus returns the Orus of config, logging the features that failed to
+// load; a command only fails when it uses one of them.
+func newCLIOrus(config orus.Config) (*orus.Orus, error) {
+	o, err := orus.NewOrus(config)
+	if o == nil {
+		return nil, err
+	}
+	logDegraded(err)
+	return o, nil
+}
+
+// logDegraded logs the features of a *orus.DegradedError, one per line.
+func logDegraded(err error) {
+	var degraded *orus.DegradedError
+	if errors.As(err, &degraded) {
+		for _, failure := range degraded.Failures {
+			log.Println(failure)
+		}
+	}
+}
+
+func cliEmbed(args []string, stdout io.Writer) error {
+	flags := newCLIFlags("embed", "[flags] <text>")
+	model := flags.String("model", "bge-m3", "embedding model: "+strings.Join(orus.EmbedModels, ", "))
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	text := strings.Join(flags.Args(), " ")
+	if text == "" {
+		return errors.New("text is required")
+	}
+	config, err := flags.loadConfig()
+	if err != nil {
+		return err
+	}
+	o, err := newCLIOrus(config)
+	if err != nil {
+		return err
+	}
+	if _, err := o.Embedder(*model); err != nil {
+		return fmt.Errorf("model must be one of %s", strings.Join(o.EmbedderNames(), ", "))
+	}
+	vector, err := o.Embed(*model, text)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(stdout).Encode(map[string]interface{}{
+		"model":      *model,
+		"dimensions": len(vector),
+		"embedding":  vector,
+	})
+}
+
+func cliIndex(args []string, stdout io.Writer) error {
+	flags := newCLIFlags("index", "[flags] <path>...")
+	model := flags.String("model", orus.DefaultRAGEmbedModel, "embedding model: "+strings.Join(orus.EmbedModels, ", "))
+	store := flags.String("store", "", "index file (default <agent memory path>/"+RAGIndexFileName+")")
+	size := flags.Int("chunk-size", orus.DefaultChunkSize, "chunk size in characters")
+	overlap := flags.Int("chunk-overlap", orus.DefaultChunkOverlap, "characters repeated between chunks")
+	extensions := flags.String("ext", ".md,.markdown,.txt,.rst", "comma separated extensions of the files to index")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return errors.New("at least one path is required")
+	}
+	config, err := flags.loadConfig()
+	if err != nil {
+		return err
+	}
+	o, path, err := openCLIIndex(config, *store)
+	if err != nil {
+		return err
+	}
+
+	allowed := make(map[string]bool)
+	for _, ext := range strings.Split(*extensions, ",") {
+		if ext = strings.ToLower(strings.TrimSpace(ext)); ext != "" {
+			allowed[ext] = true
+		}
+	}
+	files, chunks := 0, 0
+	for _, root := range flags.Args() {
+		err := filepath.WalkDir(root, func(name string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() || !allowed[strings.ToLower(filepath.Ext(name))] {
+				return nil
+			}
+			data, err := os.ReadFile(name)
+			if err != nil {
+				return err
+			}
+			documents, err := o.Documents.Index(name, string(data), *model, *size, *overlap)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			files++
+			chunks += len(documents)
+			fmt.Fprintf(stdout, "indexed %s (%d chunks)\n", name, len(documents))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := o.VectorStore.Save(orus.RAGCollection, path); err != nil {
+		return fmt.Errorf("error saving index: %w", err)
+	}
+	fmt.Fprintf(stdout, "%d files, %d chunks saved to %s\n", files, chunks, path)
+	return nil
+}
+
+func cliSearch(args []string, stdout io.Writer) error {
+	flags := newCLIFlags("search", "[flags] <query>")
+	model := flags.String("model", orus.DefaultRAGEmbedModel, "embedding model the documents were indexed with")
+	store := flags.String("store", "", "index file (default <agent memory path>/"+RAGIndexFileName+")")
+	limit := flags.Int("limit", orus.DefaultRAGLimit, "number of chunks to return")
+	asJSON := flags.Bool("json", false, "print the results as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	query := strings.Join(flags.Args(), " ")
+	if query == "" {
+		return errors.New("query is required")
+	}
+	config, err := flags.loadConfig()
+	if err != nil {
+		return err
+	}
+	o, _, err := openCLIIndex(config, *store)
+	if err != nil {
+		return err
+	}
+	results, err := o.Documents.Retrieve(query, *model, *limit)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		for i := range results {
+			results[i].Document.Embedding = nil
+		}
+		return json.NewEncoder(stdout).Encode(results)
+	}
+	for n, result := range results {
+		location := fmt.Sprintf("%v#%v", result.Document.Metadata["source"], orus.ChunkNumber(result.Document))
+		if citation := orus.Citation(result.Document); citation != "" {
+			location += " (" + citation + ")"
+		}
+		fmt.Fprintf(stdout, "%d. %.4f %s\n   %s\n", n+1, result.Similarity, location, snippet(result.Document.Content, 200))
+	}
+	return nil
+}
+
+// cliMCP serves the Model Context Protocol on stdin and stdout, for MCP
+// clients that start the server themselves. Nothing else may be written to
+// stdout, so the logs stay on stderr.
+func cliMCP(args []string, stdout io.Writer) error {
+	flags := newCLIFlags("mcp", "[flags]")
+	model := flags.String("model", orus.DefaultRAGEmbedModel, "embedding model the documents were indexed with")
+	store := flags.String("store", "", "index file (default <agent memory path>/"+RAGIndexFileName+")")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	config, err := flags.loadConfig()
+	if err != nil {
+		return err
+	}
+	config.Server.Verbose = false
+	o, _, err := openCLIIndex(config, *store)
+	if err != nil {
+		return err
+	}
+	server := orus.NewMCPServer(o)
+	server.EmbedModel = *model
+	return server.ServeStdio(context.Background(), os.Stdin, stdout)
+}
+
+// openCLIIndex returns an Orus whose document index is loaded from store.
+func openCLIIndex(config orus.Config, store string) (*orus.Orus, string, error) {
+	if store == "" {
+		store = filepath.Join(config.Embedder.MemoryPath, RAGIndexFileName)
+	}
+	o, err := newCLIOrus(config)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := o.VectorStore.Load(orus.RAGCollection, store); err != nil {
+		return nil, "", fmt.Errorf("error loading index %s: %w", store, err)
+	}
+	return o, store, nil
+}
+
+func snippet(text string, length int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > length {
+		return string(runes[:length]) + "..."
+	}
+	return text
+}
+
+func cliPull(args []string, stdout io.Writer) error {
+	flags := newCLIFlags("pull", "[flags] <model>")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("exactly one model is required")
+	}
+	config, err := flags.loadConfig()
+	if err != nil {
+		return err
+	}
+	client := ollama.NewOllamaClient(config.Ollama.BaseURL)
+	last := ""
+	return client.PullModel(flags.Arg(0), func(progress ollama.PullModelProgress) {
+		line := progress.Status
+		if progress.Total > 0 {
+			line = fmt.Sprintf("%s %d%%", progress.Status, progress.Completed*100/progress.Total)
+		}
+		if line != last {
+			fmt.Fprintln(stdout, line)
+			last = line
+		}
+	})
+}
+
+func cliCheck(args []string, stdout io.Writer) error {
+	flags := newCLIFlags("check", "[flags]")
+	model := flags.String("model", "", "chat model asked for one token (default the first one installed)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	config, err := flags.loadConfig()
+	if err != nil {
+		return err
+	}
+	report := orus.RunDiagnostics(config, *model)
+	fmt.Fprint(stdout, report)
+	if failed := report.Failed(); len(failed) > 0 {
+		return fmt.Errorf("%d of %d checks failed", len(failed), len(report.Checks))
+	}
+	fmt.Fprintf(stdout, "All %d checks passed\n", len(report.Checks))
+	return nil
+}
+
+// cliMigrate brings the storage schema to a version without starting the
+// server, such as back to the version of an older release before a
+// downgrade.
+func cliMigrate(args []string, stdout io.Writer) error {
+	flags := newCLIFlags("migrate", "[flags]")
+	dryRun := flags.Bool("dry-run", false, "print the migrations without running them")
+	to := flags.Int("to", -1, "schema version to migrate to, lower than the current one to roll back; -1 is the latest")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	config, err := flags.loadConfig()
+	if err != nil {
+		return err
+	}
+	migrator, err := orus.OpenMigrator(config.Storage)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+	plan, err := migrator.Plan(*to)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, plan)
+	if *dryRun || plan.Empty() {
+		return nil
+	}
+	if _, err := migrator.Migrate(*to); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "schema at version %d\n", plan.Target)
+	return nil
+}
+
+// cliReencrypt rewrites the values of the storage, the documents of the
+// vector journals, vector files and collection files, and the blobs, that
+// are not encrypted under the first key, so the keys rotated out can be
+// removed.
+func cliReencrypt(args []string, stdout io.Writer) error {
+	flags := newCLIFlags("reencrypt", "[flags]")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	config, err := flags.loadConfig()
+	if err != nil {
+		return err
+	}
+	cipher, err := orus.NewCipher(config.Storage.Encryption)
+	if err != nil {
+		return err
+	}
+	journal, err := orus.OpenVectorJournal(config.Search.JournalDir, config.Search.JournalCollections, config.Search.JournalCheckpoint, cipher)
+	if err != nil {
+		return err
+	}
+	var storage interface {
+		Reencrypt() (int, error)
+		Close() error
+	}
+	switch {
+	case config.Storage.Enabled():
+		storage, err = orus.OpenSQLStore(config.Storage)
+	case orus.IsKVStorage(config.Storage.Driver):
+		storage, err = orus.OpenKVStore(config.Storage)
+	}
+	if err != nil {
+		return err
+	}
+	if storage != nil {
+		defer storage.Close()
+		rewritten, err := storage.Reencrypt()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "%d values re-encrypted\n", rewritten)
+	}
+	if journal != nil {
+		rewritten, err := journal.Reencrypt()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "%d journaled documents re-encrypted\n", rewritten)
+	}
+	if cipher == nil {
+		return nil
+	}
+	rewritten, err := reencryptFiles(config, cipher)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "%d collection files re-encrypted\n", rewritten)
+	rewritten, err = reencryptBlobs(config, cipher)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "%d blobs re-encrypted\n", rewritten)
+	return nil
+}
+
+// reencryptFiles rewrites the vector files, the agent memory and the RAG
+// index under the first key, and returns how many there were.
+func reencryptFiles(config orus.Config, cipher *orus.Cipher) (int, error) {
+	rewritten := 0
+	for _, collection := range config.Search.MmapCollections {
+		path := filepath.Join(config.Search.MmapDir, collection+".vec")
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		file, err := orus.OpenVectorFile(path, slices.Contains(config.Search.Float16Collections, collection), cipher)
+		if err != nil {
+			return rewritten, err
+		}
+		err = errors.Join(file.Compact(), file.Close())
+		if err != nil {
+			return rewritten, fmt.Errorf("error re-encrypting vector file %s: %w", path, err)
+		}
+		rewritten++
+	}
+	for collection, name := range map[string]string{orus.MemoryCollection: orus.MemoryFileName, orus.RAGCollection: RAGIndexFileName} {
+		path := filepath.Join(config.Embedder.MemoryPath, name)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		store := orus.NewVectorStore().SetCipher(cipher)
+		err := store.Load(collection, path)
+		if err == nil {
+			err = store.Save(collection, path)
+		}
+		if err != nil {
+			return rewritten, fmt.Errorf("error re-encrypting %s: %w", path, err)
+		}
+		rewritten++
+	}
+	return rewritten, nil
+}
+
+// reencryptBlobs rewrites the uploads, snapshots and backups not encrypted
+// under the first key, and returns how many it rewrote.
+func reencryptBlobs(config orus.Config, cipher *orus.Cipher) (int, error) {
+	rewritten := 0
+	for _, name := range []string{"uploads", "snapshots", "backups"} {
+		blobs, err := orus.OpenBlobStore(config.Blobs, name, "")
+		if err != nil {
+			return rewritten, err
+		}
+		n, err := orus.ReencryptBlobs(blobs, cipher)
+		rewritten += n
+		if err != nil {
+			return rewritten, fmt.Errorf("error re-encrypting %s: %w", name, err)
+		}
+	}
+	return rewritten, nil
+}
@@ -0,0 +1,1357 @@
+package orus
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Dsouza10082/orus/ollama"
+	"github.com/joho/godotenv"
+	"go.yaml.in/yaml/v3"
+)
+
+// DefaultConfigPath is the configuration file loaded when it exists and no
+// other path is given.
+const DefaultConfigPath = "orus.yaml"
+
+// Config is the configuration of an Orus server. It is loaded once at
+// startup by LoadConfig and passed to NewOrus and NewOrusAPI.
+type Config struct {
+	// Profile is the environment profile selected with ENV_TYPE.
+	Profile   string           `yaml:"-"`
+	Server    ServerConfig     `yaml:"server"`
+	Ollama    OllamaConfig     `yaml:"ollama"`
+	Embedder  EmbedderConfig   `yaml:"embedder"`
+	Screening ScreeningSource  `yaml:"screening"`
+	PII       ollama.PIIConfig `yaml:"pii"`
+	Storage   StorageConfig    `yaml:"storage"`
+	Redis     RedisConfig      `yaml:"redis"`
+	Audit     AuditConfig      `yaml:"audit"`
+	Usage     UsageConfig      `yaml:"usage"`
+	SlowLog   SlowLogConfig    `yaml:"slow_log"`
+	Webhooks  WebhookConfig    `yaml:"webhooks"`
+	Monitor   MonitorConfig    `yaml:"monitor"`
+	Debug     DebugConfig      `yaml:"debug"`
+	Cost      CostConfig       `yaml:"cost"`
+	Log       LogConfig        `yaml:"log"`
+	Timeouts  TimeoutPolicy    `yaml:"timeouts"`
+	Limits    LimitsConfig     `yaml:"limits"`
+	Remote    RemoteConfig     `yaml:"remote"`
+	Cache     CacheConfig      `yaml:"cache"`
+	Search    SearchConfig     `yaml:"search"`
+	Tools     ToolsConfig      `yaml:"tools"`
+	WebSearch WebSearchConfig  `yaml:"web_search"`
+	Workflows WorkflowsConfig  `yaml:"workflows"`
+	Agents    AgentsConfig     `yaml:"agents"`
+	Watchdog  WatchdogConfig   `yaml:"watchdog"`
+	Streams   StreamConfig     `yaml:"streams"`
+	Images    ImagesConfig     `yaml:"images"`
+	OCR       OCRConfig        `yaml:"ocr"`
+	RAG       RAGConfig        `yaml:"rag"`
+	// ImageGeneration is read for every generation, so it is reloaded.
+	ImageGeneration ImageGenConfig `yaml:"image_generation"`
+	Video           VideoConfig    `yaml:"video"`
+	// Idempotency keeps the responses of the requests sent with an
+	// Idempotency-Key header.
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+	// Blobs keeps the uploads, the media and the index snapshots on disk or
+	// in S3.
+	Blobs BlobConfig `yaml:"blobs"`
+	// Janitor removes the expired cache entries, idempotency keys and
+	// images, and the idle sessions.
+	Janitor JanitorConfig `yaml:"janitor"`
+	// Compression compresses the JSON responses for the clients that accept
+	// it.
+	Compression CompressionConfig `yaml:"compression"`
+}
+
+type ServerConfig struct {
+	Port string `yaml:"port"`
+	// Preflight is what happens when a startup check fails: "strict",
+	// "warn" or "off".
+	Preflight string `yaml:"preflight"`
+	// UISettingsPath is the directory where playground preferences are kept.
+	UISettingsPath string `yaml:"ui_settings_path"`
+	// Verbose logs debug messages and the embedder progress.
+	Verbose bool `yaml:"verbose"`
+	// CORSOrigins are the browser origins allowed to call the API; "*"
+	// allows any.
+	CORSOrigins []string `yaml:"cors_origins"`
+	// RequireAuth rejects the requests without one of APIKeys, but for the
+	// pages of the playground, whose streams sign in at /login.
+	RequireAuth bool     `yaml:"require_auth"`
+	APIKeys     []Secret `yaml:"api_keys"`
+	// AdminKeys authorize the admin endpoints, and are API keys too.
+	AdminKeys []Secret `yaml:"admin_keys"`
+}
+
+type OllamaConfig struct {
+	BaseURL string `yaml:"base_url"`
+	// APIKey authenticates the Ollama Cloud calls.
+	APIKey        Secret `yaml:"api_key"`
+	FormatRetries int    `yaml:"format_retries"`
+	// Models restricts the local models that can be used; empty allows all.
+	Models []string `yaml:"models"`
+	// Aliases map the model names requests may use to local models.
+	Aliases   map[string]string      `yaml:"aliases"`
+	Transport ollama.TransportConfig `yaml:"transport"`
+}
+
+type EmbedderConfig struct {
+	MemoryPath      string `yaml:"memory_path"`
+	TokPath         string `yaml:"tok_path"`
+	OnnxPath        string `yaml:"onnx_path"`
+	OnnxRuntimePath string `yaml:"onnx_runtime_path"`
+	// MemoryModel and SessionModel override the embedding model of the agent
+	// memory and of the session index.
+	MemoryModel  string `yaml:"memory_model"`
+	SessionModel string `yaml:"session_model"`
+	// BatchWindow coalesces the Ollama embeddings requested within it into
+	// one call of up to BatchSize texts; 0 disables batching.
+	BatchWindow time.Duration `yaml:"batch_window"`
+	BatchSize   int           `yaml:"batch_size"`
+	// ClipImagePath and ClipTextPath are the image and text encoders of a
+	// CLIP-style model exported to ONNX, and ClipTokPath the tokenizer.json
+	// of its text encoder. An empty ClipImagePath disables image embeddings;
+	// without a text encoder images can only be found by image.
+	ClipImagePath string `yaml:"clip_image_path"`
+	ClipTextPath  string `yaml:"clip_text_path"`
+	ClipTokPath   string `yaml:"clip_tok_path"`
+	// ClipImageSize is the side of the square images the image encoder takes.
+	ClipImageSize int `yaml:"clip_image_size"`
+	// CloudProvider is "openai", "mistral" or "voyage"; empty disables the
+	// cloud embeddings. CloudModels are registered as "<provider>/<model>",
+	// and CloudURL overrides the endpoint of the provider, for another
+	// service taking the OpenAI embeddings request.
+	CloudProvider string   `yaml:"cloud_provider"`
+	CloudURL      string   `yaml:"cloud_url"`
+	CloudAPIKey   Secret   `yaml:"cloud_api_key"`
+	CloudModels   []string `yaml:"cloud_models"`
+	// CacheTTL is how long an embedding is reused for the same model and
+	// text; 0 disables the cache. CacheSize bounds the embeddings kept in
+	// memory.
+	CacheTTL  time.Duration `yaml:"cache_ttl"`
+	CacheSize int           `yaml:"cache_size"`
+}
+
+type ScreeningSource struct {
+	// Path is the screening rules file; empty disables screening.
+	Path string `yaml:"path"`
+}
+
+type ToolsConfig struct {
+	// Path is the file of the HTTP tools; the built-in tools are always
+	// registered.
+	Path string `yaml:"path"`
+	// MaxRounds is how many rounds of tool calls a request with auto_tools
+	// may run before the model has to answer.
+	MaxRounds int `yaml:"max_rounds"`
+}
+
+type WebSearchConfig struct {
+	// Provider is "searxng", "brave" or "tavily"; empty disables web search.
+	Provider string `yaml:"provider"`
+	// URL is the SearxNG instance; for the other providers it overrides
+	// their API endpoint.
+	URL    string `yaml:"url"`
+	APIKey Secret `yaml:"api_key"`
+	// Results is how many results a search returns.
+	Results int           `yaml:"results"`
+	Timeout time.Duration `yaml:"timeout"`
+	// Index embeds the web results of a RAG question into a transient
+	// collection, so they are ranked with the document chunks instead of
+	// following them.
+	Index bool `yaml:"index"`
+}
+
+type WorkflowsConfig struct {
+	// Path is a directory of YAML or JSON workflow definitions, or a single
+	// file; empty defines no workflows.
+	Path string `yaml:"path"`
+}
+
+type AgentsConfig struct {
+	// Path is the YAML or JSON file of the agents; empty defines no agents.
+	Path string `yaml:"path"`
+}
+
+type ImagesConfig struct {
+	// Dir keeps the uploaded images; empty uses a directory of the system
+	// temporary directory.
+	Dir string `yaml:"dir"`
+	// TTL is how long an uploaded image can be referenced.
+	TTL time.Duration `yaml:"ttl"`
+	// MaxDimension is the longest side uploads are scaled down to.
+	MaxDimension int `yaml:"max_dimension"`
+	// ModelDimensions is the longest side each vision model takes, by model
+	// name or family (the name without its tag). The images of a chat with
+	// one of them are scaled down to fit before they are forwarded.
+	ModelDimensions map[string]int `yaml:"model_dimensions"`
+}
+
+// MaxDimensionFor is the longest side of the images sent to model, or 0
+// when model has no limit of its own.
+func (c ImagesConfig) MaxDimensionFor(model string) int {
+	if dimension, ok := c.ModelDimensions[model]; ok {
+		return dimension
+	}
+	family, _, _ := strings.Cut(model, ":")
+	return c.ModelDimensions[family]
+}
+
+type OCRConfig struct {
+	// Engine reads the text of scanned documents: "tesseract" runs the
+	// tesseract command, "ollama" has a vision model transcribe the pages;
+	// empty disables OCR.
+	Engine string `yaml:"engine"`
+	// Languages are the tesseract languages, such as eng+por.
+	Languages string `yaml:"languages"`
+	// Model is the vision model of the ollama engine.
+	Model string `yaml:"model"`
+	// DPI is the resolution scanned PDF pages are rendered at.
+	DPI int `yaml:"dpi"`
+	// MinChars is the text below which a PDF page is read by OCR.
+	MinChars int `yaml:"min_chars"`
+}
+
+// RAGConfig is the multimodal retrieval of the RAG documents.
+type RAGConfig struct {
+	// MediaDir keeps the images extracted from the ingested documents.
+	MediaDir string `yaml:"media_dir"`
+	// CaptionModel is the vision model describing the extracted images so
+	// they can be retrieved by text; empty leaves them attached to the chunks
+	// of their page only.
+	CaptionModel string `yaml:"caption_model"`
+	// MaxImages is the number of retrieved images sent to a vision model
+	// with the question.
+	MaxImages int `yaml:"max_images"`
+}
+
+type ImageGenConfig struct {
+	// Provider is "automatic1111", "comfyui" or "openai"; empty disables
+	// image generation.
+	Provider string `yaml:"provider"`
+	// URL is the automatic1111 or ComfyUI server; for openai it overrides
+	// the images API endpoint.
+	URL    string `yaml:"url"`
+	APIKey Secret `yaml:"api_key"`
+	// Model is the checkpoint of automatic1111, the {{model}} of the
+	// ComfyUI workflow, or the openai model.
+	Model string `yaml:"model"`
+	// Workflow is the ComfyUI workflow, exported in the API format.
+	Workflow string `yaml:"workflow"`
+}
+
+// VideoConfig is the sampling and captioning of the ingested videos.
+type VideoConfig struct {
+	// Interval is the shortest time between two sampled keyframes.
+	Interval  time.Duration `yaml:"interval"`
+	MaxFrames int           `yaml:"max_frames"`
+	// MaxSize is the largest video upload in bytes. Videos are kept on disk
+	// while they are sampled, so it is above the limit of the other bodies.
+	MaxSize      int    `yaml:"max_size"`
+	CaptionModel string `yaml:"caption_model"`
+}
+
+// WatchdogConfig bounds the streaming generations of the API.
+type WatchdogConfig struct {
+	// MaxTokens aborts a generation after that many tokens; 0 is no budget.
+	MaxTokens int `yaml:"max_tokens"`
+	// Repeats aborts a generation whose last 64 bytes appear that many
+	// times in its last Window bytes; 0 disables the check.
+	Repeats int `yaml:"repeats"`
+	Window  int `yaml:"window"`
+}
+
+// StreamConfig keeps the events of the streaming generations for the
+// clients that reconnect, and batches their pieces. It is read for every
+// stream, so it is reloaded.
+type StreamConfig struct {
+	// Buffer is how many of the latest events of a stream are kept for a
+	// client resuming it with Last-Event-ID.
+	Buffer int `yaml:"buffer"`
+	// ResumeTimeout is how long a generation goes on without a client, and
+	// its events are kept once it ended; 0 stops a generation as soon as its
+	// client goes away, and streams cannot be resumed.
+	ResumeTimeout time.Duration `yaml:"resume_timeout"`
+	// Interval and MinChunkChars batch the pieces of a generation: they are
+	// sent together once Interval passed since the previous event and
+	// MinChunkChars are pending, which spares a browser an event per token
+	// of a fast model. The pieces left are sent with the next event; 0
+	// disables each condition.
+	Interval      time.Duration `yaml:"interval"`
+	MinChunkChars int           `yaml:"min_chunk_chars"`
+}
+
+const (
+	DefaultStreamBuffer        = 2000
+	DefaultStreamResumeTimeout = 30 * time.Second
+)
+
+// CompressionConfig compresses the JSON responses, such as the embedding
+// vectors and the search results, for the clients whose Accept-Encoding
+// allows it. The event streams are never compressed, as their events would
+// wait in the compressor.
+type CompressionConfig struct {
+	// Encodings are the content codings offered, "zstd" and "gzip", in the
+	// order preferred when a client accepts several; empty disables the
+	// compression.
+	Encodings []string `yaml:"encodings"`
+	// MinSize is the size in bytes below which a response is sent as is.
+	MinSize int `yaml:"min_size"`
+}
+
+const DefaultCompressionMinSize = 1024
+
+// DefaultCompressionEncodings prefers zstd, which is faster and smaller.
+func DefaultCompressionEncodings() []string {
+	return []string{"zstd", "gzip"}
+}
+
+type AuditConfig struct {
+	// Sink is "file", "sqlite", "postgres" or "storage", the database of
+	// the storage; empty disables auditing.
+	Sink string `yaml:"sink"`
+	// DSN is the directory of the file sink or the data source name.
+	DSN Secret `yaml:"dsn"`
+	// Retention is the age at which records are pruned; 0 keeps them.
+	Retention time.Duration `yaml:"retention"`
+}
+
+type DebugConfig struct {
+	// Capture keeps the exact payloads the generation routes send to
+	// Ollama, by request serial, so they can be replayed. They hold the
+	// prompts as sent, so it is off by default.
+	Capture bool `yaml:"capture"`
+	// CaptureSize is the number of requests whose payloads are kept.
+	CaptureSize int `yaml:"capture_size"`
+}
+
+type UsageConfig struct {
+	// Dir is the directory of the usage files; empty keeps the usage in
+	// memory. It is not used when the storage is a database.
+	Dir string `yaml:"dir"`
+	// Retention is the age at which records are pruned; 0 keeps them.
+	Retention time.Duration `yaml:"retention"`
+}
+
+// Secret is a setting that must not be logged, such as an API key or a DSN
+// with a password. Printing or marshalling it shows a placeholder; Reveal
+// returns the value.
+type Secret string
+
+const redactedSecret = "[redacted]"
+
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redactedSecret
+}
+
+func (s Secret) GoString() string {
+	return strconv.Quote(s.String())
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s Secret) MarshalYAML() (interface{}, error) {
+	return s.String(), nil
+}
+
+type LimitsConfig struct {
+	Generation AdmissionPolicy `yaml:"generation"`
+	Embedding  AdmissionPolicy `yaml:"embedding"`
+	Rate       RateLimitPolicy `yaml:"rate"`
+	// Streams caps the open event streams; it is reloaded.
+	Streams StreamLimitPolicy `yaml:"streams"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Server: ServerConfig{Port: "8081", Preflight: PreflightWarn, Verbose: true},
+		Ollama: OllamaConfig{
+			BaseURL:       "http://ollama:11434",
+			FormatRetries: ollama.DefaultFormatRetries,
+			Transport:     ollama.DefaultTransportConfig(),
+		},
+		Embedder: EmbedderConfig{
+			MemoryPath:      "./agent_memory/",
+			TokPath:         "onnx/tokenizer.json",
+			OnnxPath:        "onnx/model.onnx",
+			OnnxRuntimePath: "onnx/aarch64/libonnxruntime.so",
+			BatchSize:       DefaultEmbeddingBatchSize,
+			ClipImageSize:   DefaultClipImageSize,
+			CacheSize:       DefaultEmbeddingCacheSize,
+		},
+		Storage: StorageConfig{
+			Driver:          StorageMemory,
+			DSN:             DefaultStorageDSN,
+			SyncInterval:    DefaultStorageSyncInterval,
+			CompactInterval: DefaultStorageCompactInterval,
+			Migrate:         MigrateAuto,
+		},
+		Redis:    RedisConfig{Prefix: DefaultRedisPrefix, Timeout: DefaultRedisTimeout},
+		Audit:    AuditConfig{DSN: "audit"},
+		Usage:    UsageConfig{Dir: "usage"},
+		SlowLog:  SlowLogConfig{Latency: DefaultSlowLatency, Size: DefaultSlowLogSize},
+		Webhooks: WebhookConfig{Timeout: DefaultWebhookTimeout, Retries: DefaultWebhookRetries},
+		Debug:    DebugConfig{CaptureSize: DefaultPayloadLogSize},
+		Cost:     CostConfig{Currency: DefaultCostCurrency, EstimateOutputTokens: DefaultEstimateOutputTokens},
+		Log: LogConfig{
+			Console: true,
+			File:    LogFileConfig{MaxSize: DefaultLogFileMaxSize, MaxBackups: DefaultLogFileBackups, Compress: true},
+			Syslog:  LogSyslogConfig{Network: "udp", Tag: DefaultLogSyslogTag},
+			Loki:    LokiConfig{BatchWait: DefaultLokiBatchWait, BatchSize: DefaultLokiBatchSize},
+		},
+		Monitor: MonitorConfig{
+			Interval:         DefaultMonitorInterval,
+			UnreachableAfter: DefaultAlertUnreachableAt,
+			Window:           DefaultAlertWindow,
+			ErrorPercent:     DefaultAlertErrorPercent,
+			MinRequests:      DefaultAlertMinRequests,
+		},
+		Cache:    CacheConfig{MaxEntries: DefaultResponseCacheSize},
+		Search:   DefaultSearchConfig(),
+		Tools:    ToolsConfig{MaxRounds: DefaultToolRounds},
+		Timeouts: DefaultTimeoutPolicy(),
+		Limits: LimitsConfig{
+			Generation: DefaultGenerationAdmission(),
+			Embedding:  DefaultEmbeddingAdmission(),
+			Rate:       RateLimitPolicy{Window: DefaultRateLimitWindow},
+			Streams:    StreamLimitPolicy{PerCaller: DefaultStreamsPerCaller},
+		},
+		WebSearch: WebSearchConfig{
+			Results: DefaultWebResults,
+			Timeout: DefaultWebSearchTimeout,
+		},
+		Watchdog: WatchdogConfig{
+			Repeats: DefaultWatchdogRepeats,
+			Window:  DefaultWatchdogWindow,
+		},
+		Streams: StreamConfig{
+			Buffer:        DefaultStreamBuffer,
+			ResumeTimeout: DefaultStreamResumeTimeout,
+		},
+		Compression: CompressionConfig{
+			Encodings: DefaultCompressionEncodings(),
+			MinSize:   DefaultCompressionMinSize,
+		},
+		Images: ImagesConfig{
+			TTL:             DefaultImageTTL,
+			MaxDimension:    DefaultImageMaxDimension,
+			ModelDimensions: DefaultModelImageDimensions(),
+		},
+		OCR: OCRConfig{
+			Engine:    DefaultOCREngine,
+			Languages: DefaultOCRLanguages,
+			Model:     DefaultOCRModel,
+			DPI:       DefaultOCRDPI,
+			MinChars:  DefaultOCRMinChars,
+		},
+		RAG: RAGConfig{
+			MediaDir:  DefaultRAGMediaDir,
+			MaxImages: DefaultRAGMaxImages,
+		},
+		Video: VideoConfig{
+			Interval:     DefaultVideoInterval,
+			MaxFrames:    DefaultVideoMaxFrames,
+			MaxSize:      DefaultVideoMaxSize,
+			CaptionModel: DefaultVideoCaptionModel,
+		},
+		Idempotency: IdempotencyConfig{TTL: DefaultIdempotencyTTL},
+		Blobs:       BlobConfig{Backend: BlobDisk, Dir: DefaultBlobDir, S3: S3Config{Region: DefaultS3Region}},
+		Janitor:     JanitorConfig{Interval: DefaultJanitorInterval},
+	}
+}
+
+// Profiles are the built-in environment profiles. Each one changes the
+// defaults before the configuration file is read, and the file can override
+// them in its profiles section.
+var Profiles = map[string]func(config *Config){
+	"dev": func(config *Config) {
+		config.Server.Preflight = PreflightWarn
+		config.Server.Verbose = true
+		config.Server.CORSOrigins = []string{"*"}
+	},
+	"staging": func(config *Config) {
+		config.Server.Preflight = PreflightStrict
+		config.Server.Verbose = false
+	},
+	"prod": func(config *Config) {
+		config.Server.Preflight = PreflightStrict
+		config.Server.Verbose = false
+		config.Server.RequireAuth = true
+	},
+}
+
+// LoadConfig builds the configuration, each source overriding the previous:
+//
+//  1. the defaults, then the built-in profile selected with ENV_TYPE,
+//  2. the YAML file at path, or at ORUS_API_CONFIG, or orus.yaml when it
+//     exists, then its section for the profile,
+//  3. the remote document in etcd or Consul, when one is configured,
+//  4. the .env file in the working directory, when it exists,
+//  5. the process environment.
+//
+// Every invalid value is reported in the returned error, not only the first.
+func LoadConfig(path string) (Config, error) {
+	config := DefaultConfig()
+	// .env is read rather than loaded into the process environment, so a
+	// reload sees the edits made to it since startup
+	dotenv, err := godotenv.Read(".env")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return config, fmt.Errorf("error loading .env: %w", err)
+	}
+	env := &envLoader{dotenv: dotenv}
+	env.string("ENV_TYPE", &config.Profile)
+	if profile, ok := Profiles[config.Profile]; ok {
+		profile(&config)
+	}
+
+	required := true
+	if path == "" {
+		path, _ = env.lookup("ORUS_API_CONFIG")
+	}
+	if path == "" {
+		path, required = DefaultConfigPath, false
+	}
+	hasSection, err := config.loadFile(path)
+	if err != nil && (required || !errors.Is(err, fs.ErrNotExist)) {
+		return config, err
+	}
+
+	env.string("ORUS_API_REMOTE_BACKEND", &config.Remote.Backend)
+	env.string("ORUS_API_REMOTE_ENDPOINT", &config.Remote.Endpoint)
+	env.string("ORUS_API_REMOTE_KEY", &config.Remote.Key)
+	env.secret("ORUS_API_REMOTE_TOKEN", &config.Remote.Token)
+	if remote := config.Remote; remote.Backend != "" {
+		data, err := fetchRemote(remote)
+		if err != nil {
+			return config, fmt.Errorf("error loading remote config %s: %w", remote.Key, err)
+		}
+		remoteSection, err := config.loadYAML(data)
+		if err != nil {
+			return config, fmt.Errorf("error decoding remote config %s: %w", remote.Key, err)
+		}
+		hasSection = hasSection || remoteSection
+		// The remote document cannot point somewhere else
+		config.Remote = remote
+	}
+	if _, builtin := Profiles[config.Profile]; config.Profile != "" && !builtin && !hasSection {
+		env.errs = append(env.errs, fmt.Errorf("ENV_TYPE: unknown profile %q, expected dev, staging, prod or a profile of %s", config.Profile, path))
+	}
+
+	env.string("ORUS_API_PORT", &config.Server.Port)
+	env.string("ORUS_API_PREFLIGHT", &config.Server.Preflight)
+	env.string("ORUS_API_UI_SETTINGS_PATH", &config.Server.UISettingsPath)
+	env.bool("ORUS_API_VERBOSE", &config.Server.Verbose)
+	env.list("ORUS_API_CORS_ORIGINS", &config.Server.CORSOrigins)
+	env.bool("ORUS_API_REQUIRE_AUTH", &config.Server.RequireAuth)
+	env.secretList("ORUS_API_KEYS", &config.Server.APIKeys)
+	env.secretList("ORUS_API_ADMIN_KEYS", &config.Server.AdminKeys)
+	env.string("ORUS_API_OLLAMA_BASE_URL", &config.Ollama.BaseURL)
+	env.secret("OLLAMA_API_KEY", &config.Ollama.APIKey)
+	env.int("ORUS_API_FORMAT_RETRIES", &config.Ollama.FormatRetries)
+	env.list("ORUS_API_MODELS", &config.Ollama.Models)
+	env.mapping("ORUS_API_MODEL_ALIASES", &config.Ollama.Aliases)
+	env.transport("ORUS_API_OLLAMA", &config.Ollama.Transport)
+	env.string("ORUS_API_AGENT_MEMORY_PATH", &config.Embedder.MemoryPath)
+	env.string("ORUS_API_TOK_PATH", &config.Embedder.TokPath)
+	env.string("ORUS_API_ONNX_PATH", &config.Embedder.OnnxPath)
+	env.string("ORUS_API_ONNX_RUNTIME_PATH", &config.Embedder.OnnxRuntimePath)
+	env.string("ORUS_API_CLIP_IMAGE_PATH", &config.Embedder.ClipImagePath)
+	env.string("ORUS_API_CLIP_TEXT_PATH", &config.Embedder.ClipTextPath)
+	env.string("ORUS_API_CLIP_TOK_PATH", &config.Embedder.ClipTokPath)
+	env.int("ORUS_API_CLIP_IMAGE_SIZE", &config.Embedder.ClipImageSize)
+	env.string("ORUS_API_MEMORY_EMBED_MODEL", &config.Embedder.MemoryModel)
+	env.string("ORUS_API_SESSION_EMBED_MODEL", &config.Embedder.SessionModel)
+	env.duration("ORUS_API_EMBED_BATCH_WINDOW", &config.Embedder.BatchWindow)
+	env.int("ORUS_API_EMBED_BATCH_SIZE", &config.Embedder.BatchSize)
+	env.duration("ORUS_API_EMBED_CACHE_TTL", &config.Embedder.CacheTTL)
+	env.int("ORUS_API_EMBED_CACHE_SIZE", &config.Embedder.CacheSize)
+	env.string("ORUS_API_CLOUD_EMBED_PROVIDER", &config.Embedder.CloudProvider)
+	env.string("ORUS_API_CLOUD_EMBED_URL", &config.Embedder.CloudURL)
+	env.secret("ORUS_API_CLOUD_EMBED_API_KEY", &config.Embedder.CloudAPIKey)
+	env.list("ORUS_API_CLOUD_EMBED_MODELS", &config.Embedder.CloudModels)
+	env.string("ORUS_API_SCREENING_PATH", &config.Screening.Path)
+	env.string("ORUS_API_TOOLS_PATH", &config.Tools.Path)
+	env.int("ORUS_API_TOOLS_MAX_ROUNDS", &config.Tools.MaxRounds)
+	env.string("ORUS_API_WEB_SEARCH_PROVIDER", &config.WebSearch.Provider)
+	env.string("ORUS_API_WEB_SEARCH_URL", &config.WebSearch.URL)
+	env.secret("ORUS_API_WEB_SEARCH_API_KEY", &config.WebSearch.APIKey)
+	env.int("ORUS_API_WEB_SEARCH_RESULTS", &config.WebSearch.Results)
+	env.duration("ORUS_API_WEB_SEARCH_TIMEOUT", &config.WebSearch.Timeout)
+	env.bool("ORUS_API_WEB_SEARCH_INDEX", &config.WebSearch.Index)
+	env.string("ORUS_API_WORKFLOWS_PATH", &config.Workflows.Path)
+	env.string("ORUS_API_AGENTS_PATH", &config.Agents.Path)
+	env.int("ORUS_API_WATCHDOG_MAX_TOKENS", &config.Watchdog.MaxTokens)
+	env.int("ORUS_API_WATCHDOG_REPEATS", &config.Watchdog.Repeats)
+	env.int("ORUS_API_WATCHDOG_WINDOW", &config.Watchdog.Window)
+	env.int("ORUS_API_STREAM_BUFFER", &config.Streams.Buffer)
+	env.duration("ORUS_API_STREAM_RESUME_TIMEOUT", &config.Streams.ResumeTimeout)
+	env.duration("ORUS_API_STREAM_INTERVAL", &config.Streams.Interval)
+	env.int("ORUS_API_STREAM_MIN_CHUNK_CHARS", &config.Streams.MinChunkChars)
+	env.list("ORUS_API_COMPRESSION_ENCODINGS", &config.Compression.Encodings)
+	env.int("ORUS_API_COMPRESSION_MIN_SIZE", &config.Compression.MinSize)
+	env.string("ORUS_API_IMAGES_DIR", &config.Images.Dir)
+	env.duration("ORUS_API_IMAGES_TTL", &config.Images.TTL)
+	env.int("ORUS_API_IMAGES_MAX_DIMENSION", &config.Images.MaxDimension)
+	env.intMapping("ORUS_API_IMAGES_MODEL_DIMENSIONS", &config.Images.ModelDimensions)
+	env.string("ORUS_API_OCR_ENGINE", &config.OCR.Engine)
+	env.string("ORUS_API_OCR_LANGUAGES", &config.OCR.Languages)
+	env.string("ORUS_API_OCR_MODEL", &config.OCR.Model)
+	env.int("ORUS_API_OCR_DPI", &config.OCR.DPI)
+	env.int("ORUS_API_OCR_MIN_CHARS", &config.OCR.MinChars)
+	env.string("ORUS_API_RAG_MEDIA_DIR", &config.RAG.MediaDir)
+	env.string("ORUS_API_RAG_CAPTION_MODEL", &config.RAG.CaptionModel)
+	env.int("ORUS_API_RAG_MAX_IMAGES", &config.RAG.MaxImages)
+	env.string("ORUS_API_IMAGE_GEN_PROVIDER", &config.ImageGeneration.Provider)
+	env.string("ORUS_API_IMAGE_GEN_URL", &config.ImageGeneration.URL)
+	env.secret("ORUS_API_IMAGE_GEN_API_KEY", &config.ImageGeneration.APIKey)
+	env.string("ORUS_API_IMAGE_GEN_MODEL", &config.ImageGeneration.Model)
+	env.string("ORUS_API_IMAGE_GEN_WORKFLOW", &config.ImageGeneration.Workflow)
+	env.duration("ORUS_API_VIDEO_INTERVAL", &config.Video.Interval)
+	env.int("ORUS_API_VIDEO_MAX_FRAMES", &config.Video.MaxFrames)
+	env.int("ORUS_API_VIDEO_MAX_SIZE", &config.Video.MaxSize)
+	env.string("ORUS_API_VIDEO_CAPTION_MODEL", &config.Video.CaptionModel)
+	env.list("ORUS_API_PII_REDACT", &config.PII.Redact)
+	env.string("ORUS_API_PII_NER_MODEL", &config.PII.NERModel)
+	env.string("ORUS_API_STORAGE_DRIVER", &config.Storage.Driver)
+	env.secret("ORUS_API_STORAGE_DSN", &config.Storage.DSN)
+	env.duration("ORUS_API_STORAGE_SYNC_INTERVAL", &config.Storage.SyncInterval)
+	env.int("ORUS_API_STORAGE_MAX_SIZE", &config.Storage.MaxSize)
+	env.duration("ORUS_API_STORAGE_COMPACT_INTERVAL", &config.Storage.CompactInterval)
+	env.string("ORUS_API_STORAGE_MIGRATE", &config.Storage.Migrate)
+	env.secretList("ORUS_API_STORAGE_ENCRYPTION_KEYS", &config.Storage.Encryption.Keys)
+	env.string("ORUS_API_STORAGE_KMS_ENDPOINT", &config.Storage.Encryption.KMS.Endpoint)
+	env.string("ORUS_API_STORAGE_KMS_REGION", &config.Storage.Encryption.KMS.Region)
+	env.secret("ORUS_API_STORAGE_KMS_ACCESS_KEY", &config.Storage.Encryption.KMS.AccessKey)
+	env.secret("ORUS_API_STORAGE_KMS_SECRET_KEY", &config.Storage.Encryption.KMS.SecretKey)
+	env.secret("ORUS_API_REDIS_URL", &config.Redis.URL)
+	env.string("ORUS_API_REDIS_PREFIX", &config.Redis.Prefix)
+	env.duration("ORUS_API_REDIS_TIMEOUT", &config.Redis.Timeout)
+	env.string("ORUS_API_AUDIT_SINK", &config.Audit.Sink)
+	env.secret("ORUS_API_AUDIT_DSN", &config.Audit.DSN)
+	env.duration("ORUS_API_AUDIT_RETENTION", &config.Audit.Retention)
+	env.string("ORUS_API_USAGE_DIR", &config.Usage.Dir)
+	env.duration("ORUS_API_USAGE_RETENTION", &config.Usage.Retention)
+	env.duration("ORUS_API_SLOW_LATENCY", &config.SlowLog.Latency)
+	env.int("ORUS_API_SLOW_TOKENS", &config.SlowLog.Tokens)
+	env.int("ORUS_API_SLOW_LOG_SIZE", &config.SlowLog.Size)
+	env.secret("ORUS_API_WEBHOOK_SECRET", &config.Webhooks.Secret)
+	env.duration("ORUS_API_WEBHOOK_TIMEOUT", &config.Webhooks.Timeout)
+	env.int("ORUS_API_WEBHOOK_RETRIES", &config.Webhooks.Retries)
+	env.list("ORUS_API_WEBHOOK_HOSTS", &config.Webhooks.Hosts)
+	env.duration("ORUS_API_MONITOR_INTERVAL", &config.Monitor.Interval)
+	env.int("ORUS_API_ALERT_UNREACHABLE_AFTER", &config.Monitor.UnreachableAfter)
+	env.duration("ORUS_API_ALERT_WINDOW", &config.Monitor.Window)
+	env.int("ORUS_API_ALERT_ERROR_PERCENT", &config.Monitor.ErrorPercent)
+	env.int("ORUS_API_ALERT_MIN_REQUESTS", &config.Monitor.MinRequests)
+	env.secret("ORUS_API_ALERT_WEBHOOK_URL", &config.Monitor.WebhookURL)
+	env.secret("ORUS_API_ALERT_SLACK_URL", &config.Monitor.SlackURL)
+	env.bool("ORUS_API_DEBUG_CAPTURE", &config.Debug.Capture)
+	env.int("ORUS_API_DEBUG_CAPTURE_SIZE", &config.Debug.CaptureSize)
+	env.prices("ORUS_API_CLOUD_PRICES", &config.Cost.Prices)
+	env.string("ORUS_API_CLOUD_CURRENCY", &config.Cost.Currency)
+	env.int("ORUS_API_CLOUD_ESTIMATE_OUTPUT_TOKENS", &config.Cost.EstimateOutputTokens)
+	env.bool("ORUS_API_LOG_CONSOLE", &config.Log.Console)
+	env.string("ORUS_API_LOG_FILE", &config.Log.File.Path)
+	env.int("ORUS_API_LOG_FILE_MAX_SIZE", &config.Log.File.MaxSize)
+	env.int("ORUS_API_LOG_FILE_MAX_BACKUPS", &config.Log.File.MaxBackups)
+	env.bool("ORUS_API_LOG_FILE_COMPRESS", &config.Log.File.Compress)
+	env.string("ORUS_API_LOG_SYSLOG_ADDRESS", &config.Log.Syslog.Address)
+	env.string("ORUS_API_LOG_SYSLOG_NETWORK", &config.Log.Syslog.Network)
+	env.string("ORUS_API_LOG_SYSLOG_TAG", &config.Log.Syslog.Tag)
+	env.secret("ORUS_API_LOG_LOKI_URL", &config.Log.Loki.URL)
+	env.mapping("ORUS_API_LOG_LOKI_LABELS", &config.Log.Loki.Labels)
+	env.string("ORUS_API_LOG_LOKI_TENANT", &config.Log.Loki.Tenant)
+	env.duration("ORUS_API_LOG_LOKI_BATCH_WAIT", &config.Log.Loki.BatchWait)
+	env.int("ORUS_API_LOG_LOKI_BATCH_SIZE", &config.Log.Loki.BatchSize)
+	env.duration("ORUS_API_CACHE_TTL", &config.Cache.TTL)
+	env.int("ORUS_API_CACHE_SIZE", &config.Cache.MaxEntries)
+	env.duration("ORUS_API_IDEMPOTENCY_TTL", &config.Idempotency.TTL)
+	env.duration("ORUS_API_JANITOR_INTERVAL", &config.Janitor.Interval)
+	env.duration("ORUS_API_SESSION_TTL", &config.Janitor.SessionTTL)
+	env.string("ORUS_API_BLOB_BACKEND", &config.Blobs.Backend)
+	env.string("ORUS_API_BLOB_DIR", &config.Blobs.Dir)
+	env.bool("ORUS_API_BLOB_KEEP_UPLOADS", &config.Blobs.KeepUploads)
+	env.string("ORUS_API_S3_ENDPOINT", &config.Blobs.S3.Endpoint)
+	env.string("ORUS_API_S3_REGION", &config.Blobs.S3.Region)
+	env.string("ORUS_API_S3_BUCKET", &config.Blobs.S3.Bucket)
+	env.secret("ORUS_API_S3_ACCESS_KEY", &config.Blobs.S3.AccessKey)
+	env.secret("ORUS_API_S3_SECRET_KEY", &config.Blobs.S3.SecretKey)
+	env.bool("ORUS_API_S3_PATH_STYLE", &config.Blobs.S3.PathStyle)
+	env.string("ORUS_API_S3_PREFIX", &config.Blobs.S3.Prefix)
+	env.string("ORUS_API_SEARCH_KERNEL", &config.Search.Kernel)
+	env.int("ORUS_API_SEARCH_SHARDS", &config.Search.Shards)
+	env.int("ORUS_API_SEARCH_PARALLELISM", &config.Search.Parallelism)
+	env.int("ORUS_API_SEARCH_MIN_SHARD_SIZE", &config.Search.MinShardSize)
+	env.string("ORUS_API_MMAP_DIR", &config.Search.MmapDir)
+	env.list("ORUS_API_MMAP_COLLECTIONS", &config.Search.MmapCollections)
+	env.list("ORUS_API_FLOAT16_COLLECTIONS", &config.Search.Float16Collections)
+	env.string("ORUS_API_JOURNAL_DIR", &config.Search.JournalDir)
+	env.list("ORUS_API_JOURNAL_COLLECTIONS", &config.Search.JournalCollections)
+	env.int("ORUS_API_JOURNAL_CHECKPOINT", &config.Search.JournalCheckpoint)
+	env.duration("ORUS_API_TIMEOUT_READ", &config.Timeouts.Read)
+	env.duration("ORUS_API_TIMEOUT_DEFAULT", &config.Timeouts.Default)
+	env.duration("ORUS_API_TIMEOUT_EMBED", &config.Timeouts.Embed)
+	env.duration("ORUS_API_TIMEOUT_CHAT", &config.Timeouts.Chat)
+	env.duration("ORUS_API_TIMEOUT_PULL", &config.Timeouts.Pull)
+	env.duration("ORUS_API_TIMEOUT_STREAM", &config.Timeouts.Stream)
+	env.duration("ORUS_API_TIMEOUT_KEEPALIVE", &config.Timeouts.Keepalive)
+	env.admission("ORUS_API_GENERATION", &config.Limits.Generation)
+	env.admission("ORUS_API_EMBED", &config.Limits.Embedding)
+	env.int("ORUS_API_RATE_LIMIT", &config.Limits.Rate.Requests)
+	env.duration("ORUS_API_RATE_LIMIT_WINDOW", &config.Limits.Rate.Window)
+	env.int("ORUS_API_STREAM_LIMIT", &config.Limits.Streams.Total)
+	env.int("ORUS_API_STREAM_KEY_LIMIT", &config.Limits.Streams.PerCaller)
+	return config, errors.Join(append(env.errs, config.Validate())...)
+}
+
+// configFile is the layout of the configuration file: the configuration,
+// and a section per profile with the keys that profile overrides.
+type configFile struct {
+	Config   `yaml:",inline"`
+	Profiles map[string]yaml.Node `yaml:"profiles"`
+}
+
+// loadFile overlays the YAML file at path on the configuration, then its
+// section for c.Profile. Keys the configuration does not have are rejected,
+// so typos do not go unnoticed.
+// It returns whether the file has a section for the profile.
+func (c *Config) loadFile(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("error opening config file: %w", err)
+	}
+	hasSection, err := c.loadYAML(data)
+	if err != nil {
+		return false, fmt.Errorf("error decoding %s: %w", path, err)
+	}
+	return hasSection, nil
+}
+
+// loadYAML overlays a document laid out like the configuration file.
+func (c *Config) loadYAML(data []byte) (bool, error) {
+	file := configFile{Config: *c}
+	if err := decodeYAML(data, &file); err != nil {
+		return false, err
+	}
+	section, ok := file.Profiles[c.Profile]
+	if ok && c.Profile != "" {
+		// The section is encoded again so unknown keys are rejected in it too
+		data, err := yaml.Marshal(&section)
+		if err == nil {
+			err = decodeYAML(data, &file.Config)
+		}
+		if err != nil {
+			return false, fmt.Errorf("profile %s: %w", c.Profile, err)
+		}
+	}
+	*c = file.Config
+	return ok, nil
+}
+
+func decodeYAML(data []byte, v interface{}) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// Validate reports every invalid field of the configuration at once. Fields
+// are named after their environment variable.
+func (c Config) Validate() error {
+	var errs []error
+	invalid := func(key string, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port < 1 || port > 65535 {
+		invalid("ORUS_API_PORT", "must be a port number, got %q", c.Server.Port)
+	}
+	switch c.Server.Preflight {
+	case PreflightStrict, PreflightWarn, PreflightOff:
+	default:
+		invalid("ORUS_API_PREFLIGHT", "must be strict, warn or off, got %q", c.Server.Preflight)
+	}
+	if c.Server.RequireAuth && len(c.Server.APIKeys) == 0 && len(c.Server.AdminKeys) == 0 {
+		invalid("ORUS_API_KEYS", "is required when ORUS_API_REQUIRE_AUTH is set (the prod profile sets it)")
+	}
+	if u, err := url.Parse(c.Ollama.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		invalid("ORUS_API_OLLAMA_BASE_URL", "must be an http(s) URL, got %q", c.Ollama.BaseURL)
+	}
+	if c.Ollama.FormatRetries < 0 {
+		invalid("ORUS_API_FORMAT_RETRIES", "must not be negative")
+	}
+	for _, target := range c.PII.Redact {
+		if target != "cloud" && target != "storage" {
+			invalid("ORUS_API_PII_REDACT", "unknown target %q, expected cloud or storage", target)
+		}
+	}
+	for alias, model := range c.Ollama.Aliases {
+		if alias == "" || model == "" {
+			invalid("ORUS_API_MODEL_ALIASES", "aliases and models must not be empty, got %q=%q", alias, model)
+		}
+	}
+	switch c.Storage.Driver {
+	case "", StorageMemory:
+	case "sqlite", "postgres", "badger", "bolt":
+		if c.Storage.DSN == "" {
+			invalid("ORUS_API_STORAGE_DSN", "is required by the %s driver", c.Storage.Driver)
+		}
+	default:
+		invalid("ORUS_API_STORAGE_DRIVER", "unknown driver %q, expected memory, sqlite, postgres, badger or bolt", c.Storage.Driver)
+	}
+	switch c.Storage.Migrate {
+	case "", MigrateAuto, MigrateDryRun, MigrateOff:
+	default:
+		invalid("ORUS_API_STORAGE_MIGRATE", "unknown mode %q, expected auto, dry-run or off", c.Storage.Migrate)
+	}
+	encryption := c.Storage.Encryption
+	keyIDs := make(map[string]bool, len(encryption.Keys))
+	for i, entry := range encryption.Keys {
+		id, key, err := parseEncryptionKey(entry)
+		switch {
+		case err != nil:
+			invalid("ORUS_API_STORAGE_ENCRYPTION_KEYS", "key %d: %v", i+1, err)
+		case keyIDs[id]:
+			invalid("ORUS_API_STORAGE_ENCRYPTION_KEYS", "key %s is listed twice", id)
+		case encryption.KMS.Region == "" && len(key) != 16 && len(key) != 24 && len(key) != 32:
+			invalid("ORUS_API_STORAGE_ENCRYPTION_KEYS", "key %s has %d bytes, expected 16, 24 or 32", id, len(key))
+		}
+		keyIDs[id] = true
+	}
+	if encryption.KMS.Region != "" && (encryption.KMS.AccessKey == "" || encryption.KMS.SecretKey == "") {
+		invalid("ORUS_API_STORAGE_KMS_REGION", "requires ORUS_API_STORAGE_KMS_ACCESS_KEY and ORUS_API_STORAGE_KMS_SECRET_KEY")
+	}
+	switch c.Audit.Sink {
+	case "", "file", "sqlite", "postgres":
+	case "storage":
+		if !c.Storage.Enabled() {
+			invalid("ORUS_API_AUDIT_SINK", "the storage sink requires ORUS_API_STORAGE_DRIVER to be sqlite or postgres")
+		}
+	default:
+		invalid("ORUS_API_AUDIT_SINK", "unknown sink %q, expected file, sqlite, postgres or storage", c.Audit.Sink)
+	}
+	if c.Audit.Sink != "" && c.Audit.Sink != "file" && c.Audit.Sink != "storage" && c.Audit.DSN == "" {
+		invalid("ORUS_API_AUDIT_DSN", "is required by the %s sink", c.Audit.Sink)
+	}
+	if c.Audit.Retention < 0 {
+		invalid("ORUS_API_AUDIT_RETENTION", "must not be negative")
+	}
+	if c.Usage.Retention < 0 {
+		invalid("ORUS_API_USAGE_RETENTION", "must not be negative")
+	}
+	if c.Monitor.ErrorPercent < 0 || c.Monitor.ErrorPercent > 100 {
+		invalid("ORUS_API_ALERT_ERROR_PERCENT", "must be between 0 and 100, got %d", c.Monitor.ErrorPercent)
+	}
+	for key, value := range map[string]Secret{"ORUS_API_ALERT_WEBHOOK_URL": c.Monitor.WebhookURL, "ORUS_API_ALERT_SLACK_URL": c.Monitor.SlackURL} {
+		if value == "" {
+			continue
+		}
+		if u, err := url.Parse(value.Reveal()); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid(key, "must be an http(s) URL")
+		}
+	}
+	if !c.Log.Console && !c.Log.Enabled() {
+		invalid("ORUS_API_LOG_CONSOLE", "cannot be false without a log file, syslog or Loki sink, the logs would be lost")
+	}
+	if c.Log.Syslog.Address != "" && c.Log.Syslog.Address != "local" {
+		switch c.Log.Syslog.Network {
+		case "udp", "tcp":
+		default:
+			invalid("ORUS_API_LOG_SYSLOG_NETWORK", "must be udp or tcp, got %q", c.Log.Syslog.Network)
+		}
+	}
+	if c.Log.Loki.URL != "" {
+		if u, err := url.Parse(c.Log.Loki.URL.Reveal()); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid("ORUS_API_LOG_LOKI_URL", "must be an http(s) URL")
+		}
+	}
+	if c.Redis.URL != "" {
+		if u, err := url.Parse(c.Redis.URL.Reveal()); err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") || u.Host == "" {
+			invalid("ORUS_API_REDIS_URL", "must be a redis:// or rediss:// URL")
+		}
+	}
+	switch c.Blobs.Backend {
+	case "", BlobDisk:
+	case BlobS3:
+		if u, err := url.Parse(c.Blobs.S3.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid("ORUS_API_S3_ENDPOINT", "must be an http:// or https:// URL with the s3 blob backend")
+		}
+		if c.Blobs.S3.Bucket == "" {
+			invalid("ORUS_API_S3_BUCKET", "is required by the s3 blob backend")
+		}
+		if c.Blobs.S3.AccessKey == "" || c.Blobs.S3.SecretKey == "" {
+			invalid("ORUS_API_S3_ACCESS_KEY", "and ORUS_API_S3_SECRET_KEY are required by the s3 blob backend")
+		}
+	default:
+		invalid("ORUS_API_BLOB_BACKEND", "unknown backend %q, expected disk or s3", c.Blobs.Backend)
+	}
+	if c.Limits.Rate.Requests > 0 && c.Limits.Rate.Window <= 0 {
+		invalid("ORUS_API_RATE_LIMIT_WINDOW", "must be positive when ORUS_API_RATE_LIMIT is set")
+	}
+	for model, price := range c.Cost.Prices {
+		if price.Input < 0 || price.Output < 0 {
+			invalid("ORUS_API_CLOUD_PRICES", "the prices of %s must not be negative", model)
+		}
+	}
+	switch c.Remote.Backend {
+	case "":
+	case "etcd", "consul":
+		if u, err := url.Parse(c.Remote.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid("ORUS_API_REMOTE_ENDPOINT", "must be an http(s) URL, got %q", c.Remote.Endpoint)
+		}
+		if c.Remote.Key == "" {
+			invalid("ORUS_API_REMOTE_KEY", "is required by the %s backend", c.Remote.Backend)
+		}
+	default:
+		invalid("ORUS_API_REMOTE_BACKEND", "unknown backend %q, expected etcd or consul", c.Remote.Backend)
+	}
+	if c.Tools.MaxRounds < 1 {
+		invalid("ORUS_API_TOOLS_MAX_ROUNDS", "must be at least 1")
+	}
+	if c.Images.TTL <= 0 {
+		invalid("ORUS_API_IMAGES_TTL", "must be positive")
+	}
+	if c.Images.MaxDimension < 1 {
+		invalid("ORUS_API_IMAGES_MAX_DIMENSION", "must be at least 1")
+	}
+	for model, dimension := range c.Images.ModelDimensions {
+		if model == "" || dimension < 1 {
+			invalid("ORUS_API_IMAGES_MODEL_DIMENSIONS", "models must not be empty and dimensions must be at least 1, got %q=%d", model, dimension)
+		}
+	}
+	switch c.OCR.Engine {
+	case "", "tesseract":
+	case "ollama":
+		if c.OCR.Model == "" {
+			invalid("ORUS_API_OCR_MODEL", "is required by the ollama engine")
+		}
+	default:
+		invalid("ORUS_API_OCR_ENGINE", "unknown engine %q, expected tesseract or ollama", c.OCR.Engine)
+	}
+	if c.OCR.DPI < 72 || c.OCR.DPI > 1200 {
+		invalid("ORUS_API_OCR_DPI", "must be between 72 and 1200")
+	}
+	if c.OCR.MinChars < 0 {
+		invalid("ORUS_API_OCR_MIN_CHARS", "must not be negative")
+	}
+	if c.RAG.MaxImages < 0 || c.RAG.MaxImages > MaxImages {
+		invalid("ORUS_API_RAG_MAX_IMAGES", "must be between 0 and %d", MaxImages)
+	}
+	switch c.ImageGeneration.Provider {
+	case "":
+	case "automatic1111", "comfyui":
+		if u, err := url.Parse(c.ImageGeneration.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid("ORUS_API_IMAGE_GEN_URL", "must be the http(s) URL of the %s server, got %q", c.ImageGeneration.Provider, c.ImageGeneration.URL)
+		}
+		if c.ImageGeneration.Provider == "comfyui" && c.ImageGeneration.Workflow == "" {
+			invalid("ORUS_API_IMAGE_GEN_WORKFLOW", "is required by the comfyui provider")
+		}
+	case "openai":
+		if c.ImageGeneration.APIKey == "" {
+			invalid("ORUS_API_IMAGE_GEN_API_KEY", "is required by the openai provider")
+		}
+	default:
+		invalid("ORUS_API_IMAGE_GEN_PROVIDER", "unknown provider %q, expected automatic1111, comfyui or openai", c.ImageGeneration.Provider)
+	}
+	if c.Video.Interval < time.Second {
+		invalid("ORUS_API_VIDEO_INTERVAL", "must be at least 1s")
+	}
+	if c.Video.MaxFrames < 1 || c.Video.MaxFrames > MaxVideoFrames {
+		invalid("ORUS_API_VIDEO_MAX_FRAMES", "must be between 1 and %d", MaxVideoFrames)
+	}
+	if c.Video.MaxSize < MaxBodySize {
+		invalid("ORUS_API_VIDEO_MAX_SIZE", "must be at least %d bytes", MaxBodySize)
+	}
+	if strings.TrimSpace(c.Video.CaptionModel) == "" {
+		invalid("ORUS_API_VIDEO_CAPTION_MODEL", "must not be empty")
+	}
+	if c.Embedder.ClipTextPath != "" && c.Embedder.ClipImagePath == "" {
+		invalid("ORUS_API_CLIP_TEXT_PATH", "requires ORUS_API_CLIP_IMAGE_PATH")
+	}
+	if c.Embedder.ClipTextPath != "" && c.Embedder.ClipTokPath == "" {
+		invalid("ORUS_API_CLIP_TOK_PATH", "is required by the CLIP text encoder")
+	}
+	if c.Embedder.ClipImageSize < 1 {
+		invalid("ORUS_API_CLIP_IMAGE_SIZE", "must be at least 1")
+	}
+	if provider := c.Embedder.CloudProvider; provider != "" {
+		if !slices.Contains(CloudEmbedProviders, provider) {
+			invalid("ORUS_API_CLOUD_EMBED_PROVIDER", "unknown provider %q, expected %s", provider, strings.Join(CloudEmbedProviders, ", "))
+		}
+		if c.Embedder.CloudAPIKey == "" {
+			invalid("ORUS_API_CLOUD_EMBED_API_KEY", "is required by the %s provider", provider)
+		}
+		if len(c.Embedder.CloudModels) == 0 {
+			invalid("ORUS_API_CLOUD_EMBED_MODELS", "must name at least one model of the %s provider", provider)
+		}
+	}
+	if c.Watchdog.MaxTokens < 0 {
+		invalid("ORUS_API_WATCHDOG_MAX_TOKENS", "must not be negative")
+	}
+	if c.Watchdog.Repeats < 0 {
+		invalid("ORUS_API_WATCHDOG_REPEATS", "must not be negative")
+	}
+	if c.Watchdog.Repeats > 0 && c.Watchdog.Window < watchdogTail*c.Watchdog.Repeats {
+		invalid("ORUS_API_WATCHDOG_WINDOW", "must be at least %d bytes to hold %d repeats", watchdogTail*c.Watchdog.Repeats, c.Watchdog.Repeats)
+	}
+	if c.Streams.Buffer < 1 {
+		invalid("ORUS_API_STREAM_BUFFER", "must be at least 1")
+	}
+	if c.Streams.MinChunkChars < 0 {
+		invalid("ORUS_API_STREAM_MIN_CHUNK_CHARS", "must not be negative")
+	}
+	for _, encoding := range c.Compression.Encodings {
+		if encoding != "zstd" && encoding != "gzip" {
+			invalid("ORUS_API_COMPRESSION_ENCODINGS", "must list zstd or gzip, got %q", encoding)
+		}
+	}
+	if c.Compression.MinSize < 0 {
+		invalid("ORUS_API_COMPRESSION_MIN_SIZE", "must not be negative")
+	}
+	switch c.WebSearch.Provider {
+	case "":
+	case "searxng":
+		if u, err := url.Parse(c.WebSearch.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid("ORUS_API_WEB_SEARCH_URL", "must be the http(s) URL of the SearxNG instance, got %q", c.WebSearch.URL)
+		}
+	case "brave", "tavily":
+		if c.WebSearch.APIKey == "" {
+			invalid("ORUS_API_WEB_SEARCH_API_KEY", "is required by the %s provider", c.WebSearch.Provider)
+		}
+	default:
+		invalid("ORUS_API_WEB_SEARCH_PROVIDER", "unknown provider %q, expected searxng, brave or tavily", c.WebSearch.Provider)
+	}
+	if c.WebSearch.Results < 1 {
+		invalid("ORUS_API_WEB_SEARCH_RESULTS", "must be at least 1")
+	}
+	if len(c.Search.MmapCollections) > 0 && c.Search.MmapDir == "" {
+		invalid("ORUS_API_MMAP_DIR", "is required by ORUS_API_MMAP_COLLECTIONS")
+	}
+	if len(c.Search.JournalCollections) > 0 && c.Search.JournalDir == "" {
+		invalid("ORUS_API_JOURNAL_DIR", "is required by ORUS_API_JOURNAL_COLLECTIONS")
+	}
+	if c.Search.JournalCheckpoint < 1 {
+		invalid("ORUS_API_JOURNAL_CHECKPOINT", "must be at least 1")
+	}
+	if kernel := c.Search.Kernel; kernel != "" && kernel != SimilarityKernelAuto && !slices.Contains(SimilarityKernels(), kernel) {
+		invalid("ORUS_API_SEARCH_KERNEL", "kernel %q is not supported here, expected %s or one of %s",
+			kernel, SimilarityKernelAuto, strings.Join(SimilarityKernels(), ", "))
+	}
+	transport := c.Ollama.Transport
+	timeouts := []struct {
+		key     string
+		timeout time.Duration
+	}{
+		{"ORUS_API_CACHE_TTL", c.Cache.TTL},
+		{"ORUS_API_EMBED_BATCH_WINDOW", c.Embedder.BatchWindow},
+		{"ORUS_API_OLLAMA_IDLE_CONN_TIMEOUT", transport.IdleConnTimeout},
+		{"ORUS_API_OLLAMA_DIAL_TIMEOUT", transport.DialTimeout},
+		{"ORUS_API_OLLAMA_KEEP_ALIVE", transport.KeepAlive},
+		{"ORUS_API_OLLAMA_TLS_HANDSHAKE_TIMEOUT", transport.TLSHandshake},
+		{"ORUS_API_OLLAMA_RESPONSE_HEADER_TIMEOUT", transport.ResponseHeader},
+		{"ORUS_API_TIMEOUT_READ", c.Timeouts.Read},
+		{"ORUS_API_TIMEOUT_DEFAULT", c.Timeouts.Default},
+		{"ORUS_API_TIMEOUT_EMBED", c.Timeouts.Embed},
+		{"ORUS_API_TIMEOUT_CHAT", c.Timeouts.Chat},
+		{"ORUS_API_TIMEOUT_PULL", c.Timeouts.Pull},
+		{"ORUS_API_TIMEOUT_STREAM", c.Timeouts.Stream},
+		{"ORUS_API_STREAM_RESUME_TIMEOUT", c.Streams.ResumeTimeout},
+		{"ORUS_API_STREAM_INTERVAL", c.Streams.Interval},
+		{"ORUS_API_TIMEOUT_KEEPALIVE", c.Timeouts.Keepalive},
+		{"ORUS_API_WEB_SEARCH_TIMEOUT", c.WebSearch.Timeout},
+		{"ORUS_API_SLOW_LATENCY", c.SlowLog.Latency},
+		{"ORUS_API_WEBHOOK_TIMEOUT", c.Webhooks.Timeout},
+		{"ORUS_API_MONITOR_INTERVAL", c.Monitor.Interval},
+		{"ORUS_API_ALERT_WINDOW", c.Monitor.Window},
+		{"ORUS_API_LOG_LOKI_BATCH_WAIT", c.Log.Loki.BatchWait},
+		{"ORUS_API_STORAGE_SYNC_INTERVAL", c.Storage.SyncInterval},
+		{"ORUS_API_STORAGE_COMPACT_INTERVAL", c.Storage.CompactInterval},
+		{"ORUS_API_REDIS_TIMEOUT", c.Redis.Timeout},
+		{"ORUS_API_EMBED_CACHE_TTL", c.Embedder.CacheTTL},
+		{"ORUS_API_IDEMPOTENCY_TTL", c.Idempotency.TTL},
+		{"ORUS_API_JANITOR_INTERVAL", c.Janitor.Interval},
+		{"ORUS_API_SESSION_TTL", c.Janitor.SessionTTL},
+	}
+	for _, t := range timeouts {
+		if t.timeout < 0 {
+			invalid(t.key, "must not be negative")
+		}
+	}
+	connections := []struct {
+		key   string
+		value int
+	}{
+		{"ORUS_API_CACHE_SIZE", c.Cache.MaxEntries},
+		{"ORUS_API_SLOW_TOKENS", c.SlowLog.Tokens},
+		{"ORUS_API_SLOW_LOG_SIZE", c.SlowLog.Size},
+		{"ORUS_API_WEBHOOK_RETRIES", c.Webhooks.Retries},
+		{"ORUS_API_ALERT_UNREACHABLE_AFTER", c.Monitor.UnreachableAfter},
+		{"ORUS_API_ALERT_MIN_REQUESTS", c.Monitor.MinRequests},
+		{"ORUS_API_DEBUG_CAPTURE_SIZE", c.Debug.CaptureSize},
+		{"ORUS_API_CLOUD_ESTIMATE_OUTPUT_TOKENS", c.Cost.EstimateOutputTokens},
+		{"ORUS_API_LOG_FILE_MAX_SIZE", c.Log.File.MaxSize},
+		{"ORUS_API_LOG_FILE_MAX_BACKUPS", c.Log.File.MaxBackups},
+		{"ORUS_API_LOG_LOKI_BATCH_SIZE", c.Log.Loki.BatchSize},
+		{"ORUS_API_EMBED_BATCH_SIZE", c.Embedder.BatchSize},
+		{"ORUS_API_EMBED_CACHE_SIZE", c.Embedder.CacheSize},
+		{"ORUS_API_STORAGE_MAX_SIZE", c.Storage.MaxSize},
+		{"ORUS_API_RATE_LIMIT", c.Limits.Rate.Requests},
+		{"ORUS_API_STREAM_LIMIT", c.Limits.Streams.Total},
+		{"ORUS_API_STREAM_KEY_LIMIT", c.Limits.Streams.PerCaller},
+		{"ORUS_API_SEARCH_SHARDS", c.Search.Shards},
+		{"ORUS_API_SEARCH_PARALLELISM", c.Search.Parallelism},
+		{"ORUS_API_SEARCH_MIN_SHARD_SIZE", c.Search.MinShardSize},
+		{"ORUS_API_OLLAMA_MAX_IDLE_CONNS", transport.MaxIdleConns},
+		{"ORUS_API_OLLAMA_MAX_IDLE_CONNS_PER_HOST", transport.MaxIdleConnsPerHost},
+		{"ORUS_API_OLLAMA_MAX_CONNS_PER_HOST", transport.MaxConnsPerHost},
+	}
+	for _, conn := range connections {
+		if conn.value < 0 {
+			invalid(conn.key, "must not be negative")
+		}
+	}
+	admissions := []struct {
+		prefix string
+		policy AdmissionPolicy
+	}{
+		{"ORUS_API_GENERATION", c.Limits.Generation},
+		{"ORUS_API_EMBED", c.Limits.Embedding},
+	}
+	for _, a := range admissions {
+		if a.policy.Limit < 0 {
+			invalid(a.prefix+"_LIMIT", "must not be negative")
+		}
+		if a.policy.QueueDepth < 0 {
+			invalid(a.prefix+"_QUEUE", "must not be negative")
+		}
+		if a.policy.QueueTimeout < 0 {
+			invalid(a.prefix+"_QUEUE_TIMEOUT", "must not be negative")
+		}
+		if a.policy.KeyQueueDepth < 0 {
+			invalid(a.prefix+"_KEY_QUEUE", "must not be negative")
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// envLoader reads typed values from the environment, falling back to the
+// .env values, and collects the parse errors instead of stopping at the
+// first one. Unset variables leave the target untouched.
+type envLoader struct {
+	dotenv map[string]string
+	errs   []error
+}
+
+func (l *envLoader) lookup(key string) (string, bool) {
+	value, ok := os.LookupEnv(key)
+	if !ok || strings.TrimSpace(value) == "" {
+		value = l.dotenv[key]
+	}
+	value = strings.TrimSpace(value)
+	return value, value != ""
+}
+
+func (l *envLoader) string(key string, target *string) {
+	if value, ok := l.lookup(key); ok {
+		*target = value
+	}
+}
+
+func (l *envLoader) int(key string, target *int) {
+	if value, ok := l.lookup(key); ok {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			l.errs = append(l.errs, fmt.Errorf("%s: must be an integer, got %q", key, value))
+			return
+		}
+		*target = parsed
+	}
+}
+
+func (l *envLoader) bool(key string, target *bool) {
+	if value, ok := l.lookup(key); ok {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			l.errs = append(l.errs, fmt.Errorf("%s: must be true or false, got %q", key, value))
+			return
+		}
+		*target = parsed
+	}
+}
+
+func (l *envLoader) duration(key string, target *time.Duration) {
+	if value, ok := l.lookup(key); ok {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			l.errs = append(l.errs, fmt.Errorf("%s: must be a duration such as 30s or 5m, got %q", key, value))
+			return
+		}
+		*target = parsed
+	}
+}
+
+func (l *envLoader) list(key string, target *[]string) {
+	if value, ok := l.lookup(key); ok {
+		*target = splitList(value)
+	}
+}
+
+// mapping reads a comma separated list of name=value pairs.
+func (l *envLoader) mapping(key string, target *map[string]string) {
+	if value, ok := l.lookup(key); ok {
+		pairs := make(map[string]string)
+		for _, item := range splitList(value) {
+			name, mapped, found := strings.Cut(item, "=")
+			if !found {
+				l.errs = append(l.errs, fmt.Errorf("%s: expected name=value pairs, got %q", key, item))
+				return
+			}
+			pairs[strings.TrimSpace(name)] = strings.TrimSpace(mapped)
+		}
+		*target = pairs
+	}
+}
+
+// intMapping reads a comma separated list of name=number pairs.
+func (l *envLoader) intMapping(key string, target *map[string]int) {
+	pairs := make(map[string]string)
+	l.mapping(key, &pairs)
+	if len(pairs) == 0 {
+		return
+	}
+	numbers := make(map[string]int, len(pairs))
+	for name, value := range pairs {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			l.errs = append(l.errs, fmt.Errorf("%s: %s must be an integer, got %q", key, name, value))
+			return
+		}
+		numbers[name] = parsed
+	}
+	*target = numbers
+}
+
+// prices reads a comma separated list of model=input/output pairs, the
+// prices of the models per million tokens.
+func (l *envLoader) prices(key string, target *map[string]ModelPrice) {
+	pairs := make(map[string]string)
+	l.mapping(key, &pairs)
+	if len(pairs) == 0 {
+		return
+	}
+	prices := make(map[string]ModelPrice, len(pairs))
+	for name, value := range pairs {
+		input, output, found := strings.Cut(value, "/")
+		in, inErr := strconv.ParseFloat(strings.TrimSpace(input), 64)
+		out, outErr := strconv.ParseFloat(strings.TrimSpace(output), 64)
+		if !found || inErr != nil || outErr != nil {
+			l.errs = append(l.errs, fmt.Errorf("%s: %s must be input/output prices such as 0.15/0.60, got %q", key, name, value))
+			return
+		}
+		prices[name] = ModelPrice{Input: in, Output: out}
+	}
+	*target = prices
+}
+
+// splitList splits a comma or newline separated list, dropping empty items.
+func splitList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// lookupSecret returns the value of key, or the content of the file named
+// by key_FILE, as mounted by Docker and Kubernetes secrets. Errors never
+// include the value.
+func (l *envLoader) lookupSecret(key string) (string, bool) {
+	value, ok := l.lookup(key)
+	path, fromFile := l.lookup(key + "_FILE")
+	if !fromFile {
+		return value, ok
+	}
+	if ok {
+		l.errs = append(l.errs, fmt.Errorf("%s: set either %s or %s_FILE, not both", key, key, key))
+		return "", false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s_FILE: %w", key, err))
+		return "", false
+	}
+	value = strings.TrimSpace(string(data))
+	return value, value != ""
+}
+
+func (l *envLoader) secret(key string, target *Secret) {
+	if value, ok := l.lookupSecret(key); ok {
+		*target = Secret(value)
+	}
+}
+
+// secretList is a list read like a secret; in a file the items can also be
+// one per line.
+func (l *envLoader) secretList(key string, target *[]Secret) {
+	if value, ok := l.lookupSecret(key); ok {
+		items := splitList(value)
+		*target = make([]Secret, len(items))
+		for i, item := range items {
+			(*target)[i] = Secret(item)
+		}
+	}
+}
+
+// transport reads the <prefix>_MAX_IDLE_CONNS, <prefix>_MAX_IDLE_CONNS_PER_HOST,
+// <prefix>_MAX_CONNS_PER_HOST and <prefix>_*_TIMEOUT variables of a transport.
+func (l *envLoader) transport(prefix string, target *ollama.TransportConfig) {
+	l.int(prefix+"_MAX_IDLE_CONNS", &target.MaxIdleConns)
+	l.int(prefix+"_MAX_IDLE_CONNS_PER_HOST", &target.MaxIdleConnsPerHost)
+	l.int(prefix+"_MAX_CONNS_PER_HOST", &target.MaxConnsPerHost)
+	l.duration(prefix+"_IDLE_CONN_TIMEOUT", &target.IdleConnTimeout)
+	l.duration(prefix+"_DIAL_TIMEOUT", &target.DialTimeout)
+	l.duration(prefix+"_KEEP_ALIVE", &target.KeepAlive)
+	l.duration(prefix+"_TLS_HANDSHAKE_TIMEOUT", &target.TLSHandshake)
+	l.duration(prefix+"_RESPONSE_HEADER_TIMEOUT", &target.ResponseHeader)
+}
+
+// admission reads the <prefix>_LIMIT, <prefix>_QUEUE, <prefix>_QUEUE_TIMEOUT
+// and <prefix>_KEY_QUEUE variables of an admission policy.
+func (l *envLoader) admission(prefix string, target *AdmissionPolicy) {
+	l.int(prefix+"_LIMIT", &target.Limit)
+	l.int(prefix+"_QUEUE", &target.QueueDepth)
+	l.duration(prefix+"_QUEUE_TIMEOUT", &target.QueueTimeout)
+	l.int(prefix+"_KEY_QUEUE", &target.KeyQueueDepth)
+}
+
+// ==================== Configuration ====================
+
+const (
+	MaxBodySize      = 10 * 1024 * 1024 // 10MB
+	MaxConcurrent    = 100
+	StreamBufferSize = 32 * 1024
+)
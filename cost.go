@@ -0,0 +1,109 @@
+package orus
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/Dsouza10082/orus/ollama"
+)
+
+const (
+	// DefaultEstimateOutputTokens is the completion an estimate assumes when
+	// the request does not bound it with options.num_predict.
+	DefaultEstimateOutputTokens = 1024
+	DefaultCostCurrency         = "USD"
+	// charsPerToken and the overheads are rough figures: the tokenizers of
+	// the cloud models are not available, so estimates only bound the cost.
+	charsPerToken        = 4
+	messageTokenOverhead = 4
+	imageTokens          = 768
+)
+
+// ModelPrice is the price of a model per million tokens.
+type ModelPrice struct {
+	Input  float64 `yaml:"input" json:"input"`
+	Output float64 `yaml:"output" json:"output"`
+}
+
+type CostConfig struct {
+	// Prices are the prices of the cloud models by name; a model without a
+	// price has an unknown cost.
+	Prices map[string]ModelPrice `yaml:"prices"`
+	// Currency is the one of the prices, reported along with the costs.
+	Currency string `yaml:"currency"`
+	// EstimateOutputTokens is the completion an estimate assumes when the
+	// request does not set options.num_predict.
+	EstimateOutputTokens int `yaml:"estimate_output_tokens"`
+}
+
+// CostEstimate is the cost a chat may reach, or the cost it reached once
+// answered.
+type CostEstimate struct {
+	Model    string `json:"model" swaggertype:"string" example:"gpt-oss:120b"`
+	Currency string `json:"currency" swaggertype:"string" example:"USD"`
+	// Priced is false when the model has no price; the cost is then 0.
+	Priced           bool    `json:"priced" swaggertype:"boolean" example:"true"`
+	PromptTokens     int     `json:"prompt_tokens" swaggertype:"integer" example:"1200"`
+	CompletionTokens int     `json:"completion_tokens" swaggertype:"integer" example:"1024"`
+	Cost             float64 `json:"cost" swaggertype:"number" example:"0.00079"`
+}
+
+// Cost prices promptTokens and completionTokens of model.
+func (c CostConfig) Cost(model string, promptTokens, completionTokens int) CostEstimate {
+	cost := CostEstimate{
+		Model:            model,
+		Currency:         c.Currency,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+	}
+	if cost.Currency == "" {
+		cost.Currency = DefaultCostCurrency
+	}
+	price, ok := c.Prices[model]
+	if !ok {
+		return cost
+	}
+	cost.Priced = true
+	cost.Cost = (float64(promptTokens)*price.Input + float64(completionTokens)*price.Output) / 1e6
+	return cost
+}
+
+// Estimate bounds the cost of req before it is sent: its prompt tokens are
+// estimated from the length of the messages, and its completion is the
+// options.num_predict of the request or EstimateOutputTokens.
+func (c CostConfig) Estimate(req ollama.ChatRequest) CostEstimate {
+	return c.Cost(req.Model, EstimatePromptTokens(req), c.outputTokens(req))
+}
+
+func (c CostConfig) outputTokens(req ollama.ChatRequest) int {
+	switch predict := req.Options["num_predict"].(type) {
+	case float64:
+		if predict > 0 {
+			return int(predict)
+		}
+	case int:
+		if predict > 0 {
+			return predict
+		}
+	case json.Number:
+		if parsed, err := strconv.Atoi(string(predict)); err == nil && parsed > 0 {
+			return parsed
+		}
+	}
+	if c.EstimateOutputTokens > 0 {
+		return c.EstimateOutputTokens
+	}
+	return DefaultEstimateOutputTokens
+}
+
+// EstimatePromptTokens estimates the prompt tokens of req from the length
+// of its messages and the number of its images.
+func EstimatePromptTokens(req ollama.ChatRequest) int {
+	tokens := 0
+	images := len(req.Images)
+	for _, message := range req.Messages {
+		tokens += messageTokenOverhead + (len(message.Content)+charsPerToken-1)/charsPerToken
+		images += len(message.Images)
+	}
+	return tokens + images*imageTokens
+}
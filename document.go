@@ -0,0 +1,39 @@
+package orus
+
+import (
+	"time"
+)
+
+type Document struct {
+	ID        string                 `json:"id" swaggertype:"string" example:"123e4567-e89b-12d3-a456-426614174000"`
+	Content   string                 `json:"content" swaggertype:"string" example:"Hello, how are you?"`
+	Embedding []float64              `json:"embedding" swaggertype:"array" example:"[0.1, 0.2, 0.3]"`
+	Metadata  map[string]interface{} `json:"metadata" swaggertype:"object"`
+	CreatedAt time.Time              `json:"created_at" swaggertype:"string" example:"2021-01-01T00:00:00Z"`
+	// Media are the images linked to the document, such as the figures of
+	// the page a chunk was read from.
+	Media []MediaRef `json:"media,omitempty"`
+
+	// half replaces Embedding in the collections stored as float16.
+	half []uint16
+}
+
+type IndexRequest struct {
+	Content  string                 `json:"content"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+type SearchRequest struct {
+	Query string `json:"query" swaggertype:"string" example:"Hello, how are you?"`
+	Limit int    `json:"limit" swaggertype:"integer" example:"10"`
+}
+
+type SearchResult struct {
+	Document   Document `json:"document" swaggertype:"object"`
+	Similarity float64  `json:"similarity" swaggertype:"number" example:"0.95"`
+}
+
+type SearchResponse struct {
+	Results []SearchResult `json:"results"`
+	Took    string         `json:"took"`
+}
@@ -0,0 +1,132 @@
+package orus
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+// SQLDocumentStore keeps the chunks of the indexed sources in the
+// document_sources and document_chunks tables of a SQLStore. Every change of
+// a source gets the next revision of its collection, so a replica loads the
+// sources changed since the last revision it saw.
+type SQLDocumentStore struct {
+	store *SQLStore
+}
+
+func (s *SQLDocumentStore) Replace(collection, source string, documents []Document) (int64, error) {
+	var revision int64
+	err := s.store.inLockedTx(documentLock, func(tx *sql.Tx) error {
+		if err := tx.QueryRow(s.store.bind(`SELECT COALESCE(MAX(revision), 0) + 1 FROM document_sources WHERE collection = ?`),
+			collection).Scan(&revision); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(s.store.bind(`DELETE FROM document_chunks WHERE collection = ? AND source = ?`), collection, source); err != nil {
+			return err
+		}
+		for _, document := range documents {
+			metadata, err := json.Marshal(document.Metadata)
+			if err != nil {
+				return fmt.Errorf("error encoding document metadata: %w", err)
+			}
+			media, err := json.Marshal(document.Media)
+			if err != nil {
+				return fmt.Errorf("error encoding document media: %w", err)
+			}
+			if _, err := tx.Exec(s.store.bind(`INSERT INTO document_chunks
+				(collection, source, id, content, embedding, metadata, media, created_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?)`),
+				collection, source, document.ID, s.store.cipher.Encrypt(document.Content), encodeEmbedding(document.Embedding),
+				string(metadata), string(media), document.CreatedAt.UTC()); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(s.store.bind(`INSERT INTO document_sources (collection, source, revision, updated_at)
+			VALUES (?, ?, ?, ?)
+			ON CONFLICT (collection, source) DO UPDATE SET revision = excluded.revision, updated_at = excluded.updated_at`),
+			collection, source, revision, time.Now().UTC())
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return revision, nil
+}
+
+// Changes reads the sources and their chunks in one query, so a source
+// changed meanwhile is seen whole by this sync or the next one.
+func (s *SQLDocumentStore) Changes(collection string, after int64) ([]DocumentChange, int64, error) {
+	rows, err := s.store.db.Query(s.store.bind(`SELECT d.source, d.revision,
+			c.id, c.content, c.embedding, c.metadata, c.media, c.created_at
+		FROM document_sources d LEFT JOIN document_chunks c ON c.collection = d.collection AND c.source = d.source
+		WHERE d.collection = ? AND d.revision > ?
+		ORDER BY d.revision`), collection, after)
+	if err != nil {
+		return nil, after, err
+	}
+	defer rows.Close()
+	changes := make([]DocumentChange, 0)
+	revision := after
+	for rows.Next() {
+		var source string
+		var changed int64
+		var id, content, embedding, metadata, media sql.NullString
+		var createdAt sql.NullTime
+		if err := rows.Scan(&source, &changed, &id, &content, &embedding, &metadata, &media, &createdAt); err != nil {
+			return nil, after, err
+		}
+		if changed != revision {
+			changes = append(changes, DocumentChange{Source: source})
+			revision = changed
+		}
+		if !id.Valid {
+			// a removed source has no chunks
+			continue
+		}
+		document := Document{ID: id.String, CreatedAt: createdAt.Time}
+		if document.Content, err = s.store.cipher.Decrypt(content.String); err != nil {
+			return nil, after, err
+		}
+		if document.Embedding, err = decodeEmbedding(embedding.String); err != nil {
+			return nil, after, err
+		}
+		if err := json.Unmarshal([]byte(metadata.String), &document.Metadata); err != nil {
+			return nil, after, fmt.Errorf("error decoding document metadata: %w", err)
+		}
+		if err := json.Unmarshal([]byte(media.String), &document.Media); err != nil {
+			return nil, after, fmt.Errorf("error decoding document media: %w", err)
+		}
+		change := &changes[len(changes)-1]
+		change.Documents = append(change.Documents, document)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, after, err
+	}
+	return changes, revision, nil
+}
+
+// encodeEmbedding packs vector as base64 of its little-endian float64s,
+// which keeps it exact in a text column of either dialect.
+func encodeEmbedding(vector []float64) string {
+	data := make([]byte, 8*len(vector))
+	for n, value := range vector {
+		binary.LittleEndian.PutUint64(data[8*n:], math.Float64bits(value))
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func decodeEmbedding(encoded string) ([]float64, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(data)%8 != 0 {
+		return nil, fmt.Errorf("error decoding document embedding")
+	}
+	vector := make([]float64, len(data)/8)
+	for n := range vector {
+		vector[n] = math.Float64frombits(binary.LittleEndian.Uint64(data[8*n:]))
+	}
+	return vector, nil
+}
@@ -0,0 +1,351 @@
+package orus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	bge_m3 "github.com/Dsouza10082/go-bge-m3-embed"
+	"github.com/Dsouza10082/orus/ollama"
+)
+
+const (
+	// BGEM3Dimensions is the length of the bge-m3 embeddings.
+	BGEM3Dimensions = 1024
+	// DefaultCloudEmbedTimeout bounds an embedding call to a cloud provider.
+	DefaultCloudEmbedTimeout = 30 * time.Second
+
+	openAIEmbeddingsURL  = "https://api.openai.com/v1/embeddings"
+	mistralEmbeddingsURL = "https://api.mistral.ai/v1/embeddings"
+	voyageEmbeddingsURL  = "https://api.voyageai.com/v1/embeddings"
+)
+
+// CloudEmbedProviders are the cloud embedding providers, which all take the
+// OpenAI embeddings request.
+var CloudEmbedProviders = []string{"openai", "mistral", "voyage"}
+
+// Embedder embeds texts with one embedding model. Orus looks the embedders
+// up by name; see Orus.RegisterEmbedder.
+type Embedder interface {
+	// Name is the model name the requests ask for, such as "bge-m3".
+	Name() string
+	Embed(ctx context.Context, text string) ([]float64, error)
+	// EmbedBatch returns the embeddings of texts, in order.
+	EmbedBatch(ctx context.Context, texts []string) ([][]float64, error)
+	// Dimensions is the length of the embeddings, or 0 until the first one
+	// when the model does not tell it beforehand.
+	Dimensions() int
+}
+
+// dimensions is the length of the embeddings of an embedder, learned from
+// its first embedding when it is not known beforehand.
+type dimensions struct {
+	n atomic.Int64
+}
+
+func (d *dimensions) Dimensions() int {
+	return int(d.n.Load())
+}
+
+func (d *dimensions) learn(vectors ...[]float64) {
+	if len(vectors) > 0 {
+		d.n.CompareAndSwap(0, int64(len(vectors[0])))
+	}
+}
+
+// ONNXEmbedder embeds with bge-m3 on the ONNX runtime, in process.
+type ONNXEmbedder struct {
+	embedder *bge_m3.GolangBGE3M3Embedder
+}
+
+func NewONNXEmbedder(embedder *bge_m3.GolangBGE3M3Embedder) *ONNXEmbedder {
+	return &ONNXEmbedder{embedder: embedder}
+}
+
+func (e *ONNXEmbedder) Name() string {
+	return "bge-m3"
+}
+
+func (e *ONNXEmbedder) Dimensions() int {
+	return BGEM3Dimensions
+}
+
+// Quantization tells the embeddings are computed in float32.
+func (e *ONNXEmbedder) Quantization() string {
+	return "float32"
+}
+
+func (e *ONNXEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	onnxMu.Lock()
+	vector32, err := e.embedder.Embed(text)
+	onnxMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return float32sToFloat64s(vector32), nil
+}
+
+// EmbedBatch embeds the texts one by one, as the ONNX embedder has no batch
+// API.
+func (e *ONNXEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	return embedEach(ctx, e, texts)
+}
+
+// OllamaEmbedder embeds with an embedding model of the backend.
+type OllamaEmbedder struct {
+	dimensions
+	name    string
+	model   string
+	backend ollama.Backend
+	batcher *EmbeddingBatcher
+}
+
+// NewOllamaEmbedder returns the embedder named name embedding with model,
+// such as "ollama-bge-m3" with "bge-m3:latest".
+func NewOllamaEmbedder(name, model string, backend ollama.Backend) *OllamaEmbedder {
+	return &OllamaEmbedder{name: name, model: model, backend: backend}
+}
+
+// SetBatcher coalesces the texts embedded by concurrent callers; nil embeds
+// each text on its own.
+func (e *OllamaEmbedder) SetBatcher(batcher *EmbeddingBatcher) *OllamaEmbedder {
+	e.batcher = batcher
+	return e
+}
+
+func (e *OllamaEmbedder) Name() string {
+	return e.name
+}
+
+// Embed batches text with the concurrent requests when batching is enabled.
+// A batched text is not canceled with ctx, as it shares its call.
+func (e *OllamaEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	var (
+		vector []float64
+		err    error
+	)
+	if e.batcher != nil {
+		vector, err = e.batcher.Embed(text)
+	} else {
+		vector, err = e.backend.WithContext(ctx).GetEmbedding(e.model, text)
+	}
+	if err != nil {
+		return nil, err
+	}
+	e.learn(vector)
+	return vector, nil
+}
+
+func (e *OllamaEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	vectors, err := e.backend.WithContext(ctx).GetEmbeddings(e.model, texts)
+	if err != nil {
+		return nil, err
+	}
+	e.learn(vectors...)
+	return vectors, nil
+}
+
+// ClipTextEmbedder embeds text with the text encoder of the CLIP model, in
+// the space of the image embeddings.
+type ClipTextEmbedder struct {
+	dimensions
+	clip *ClipEmbedder
+}
+
+// NewClipTextEmbedder returns the embedder of clip, which fails with
+// ErrClipDisabled when clip is nil.
+func NewClipTextEmbedder(clip *ClipEmbedder) *ClipTextEmbedder {
+	return &ClipTextEmbedder{clip: clip}
+}
+
+func (e *ClipTextEmbedder) Name() string {
+	return ClipModel
+}
+
+// Quantization tells the embeddings are computed in float32.
+func (e *ClipTextEmbedder) Quantization() string {
+	return "float32"
+}
+
+func (e *ClipTextEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	vector32, err := e.clip.EmbedText(text)
+	if err != nil {
+		return nil, err
+	}
+	vector := float32sToFloat64s(vector32)
+	e.learn(vector)
+	return vector, nil
+}
+
+func (e *ClipTextEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	return embedEach(ctx, e, texts)
+}
+
+// CloudEmbedder embeds with a model of a cloud provider taking the OpenAI
+// embeddings request, such as OpenAI, Mistral or Voyage.
+type CloudEmbedder struct {
+	dimensions
+	provider string
+	model    string
+	url      string
+	apiKey   Secret
+	client   *http.Client
+}
+
+// LoadCloudEmbedders returns an embedder per cloud model of config, named
+// "<provider>/<model>" such as "openai/text-embedding-3-small". It returns
+// none when no provider is configured.
+func LoadCloudEmbedders(config EmbedderConfig) ([]*CloudEmbedder, error) {
+	var url string
+	switch config.CloudProvider {
+	case "":
+		return nil, nil
+	case "openai":
+		url = openAIEmbeddingsURL
+	case "mistral":
+		url = mistralEmbeddingsURL
+	case "voyage":
+		url = voyageEmbeddingsURL
+	default:
+		return nil, fmt.Errorf("unknown cloud embedding provider %q, expected %s", config.CloudProvider, strings.Join(CloudEmbedProviders, ", "))
+	}
+	if config.CloudURL != "" {
+		url = config.CloudURL
+	}
+	client := &http.Client{Timeout: DefaultCloudEmbedTimeout}
+	embedders := make([]*CloudEmbedder, 0, len(config.CloudModels))
+	for _, model := range config.CloudModels {
+		embedders = append(embedders, &CloudEmbedder{
+			provider: config.CloudProvider,
+			model:    model,
+			url:      url,
+			apiKey:   config.CloudAPIKey,
+			client:   client,
+		})
+	}
+	return embedders, nil
+}
+
+func (e *CloudEmbedder) Name() string {
+	return e.provider + "/" + e.model
+}
+
+func (e *CloudEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	vectors, err := e.EmbedBatch(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+func (e *CloudEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	data, err := json.Marshal(map[string]interface{}{"model": e.model, "input": texts})
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Bearer "+e.apiKey.Reveal())
+	response, err := e.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("error embedding with %s: %w", e.provider, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		err := fmt.Errorf("%s embeddings answered status %d: %s", e.provider, response.StatusCode, body)
+		if cause := ollama.StatusCause(response.StatusCode, string(body)); cause != nil {
+			err = fmt.Errorf("%w: %w", err, cause)
+		}
+		return nil, err
+	}
+	var answer struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&answer); err != nil {
+		return nil, fmt.Errorf("error decoding %s embeddings: %w", e.provider, err)
+	}
+	if len(answer.Data) != len(texts) {
+		return nil, fmt.Errorf("%s returned %d embeddings for %d texts", e.provider, len(answer.Data), len(texts))
+	}
+	vectors := make([][]float64, len(texts))
+	for _, embedding := range answer.Data {
+		if embedding.Index < 0 || embedding.Index >= len(texts) {
+			return nil, fmt.Errorf("%s returned an embedding for text %d of %d", e.provider, embedding.Index, len(texts))
+		}
+		vectors[embedding.Index] = embedding.Embedding
+	}
+	e.learn(vectors...)
+	return vectors, nil
+}
+
+// RegisterEmbedder makes embedder available by its name, replacing the one
+// of the same name, so programs embedding Orus can add their own models.
+// The embed hooks run after its calls, which the embedding cache answers
+// when it has the text.
+func (s *Orus) RegisterEmbedder(embedder Embedder) {
+	s.embeddersMu.Lock()
+	defer s.embeddersMu.Unlock()
+	s.embedders[embedder.Name()] = &hookedEmbedder{Embedder: s.EmbeddingCache.wrap(embedder), hooks: s.Hooks}
+}
+
+// Embedder returns the embedder of model, or an error wrapping
+// ollama.ErrModelNotFound when none is registered.
+func (s *Orus) Embedder(model string) (Embedder, error) {
+	s.embeddersMu.RLock()
+	defer s.embeddersMu.RUnlock()
+	embedder, ok := s.embedders[model]
+	if !ok {
+		return nil, fmt.Errorf("invalid embedding model %q: %w", model, ollama.ErrModelNotFound)
+	}
+	return embedder, nil
+}
+
+// EmbedderNames returns the names of the registered embedders, sorted.
+func (s *Orus) EmbedderNames() []string {
+	s.embeddersMu.RLock()
+	defer s.embeddersMu.RUnlock()
+	names := make([]string, 0, len(s.embedders))
+	for name := range s.embedders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// embedEach embeds texts one by one, for the embedders without a batch API.
+func embedEach(ctx context.Context, embedder Embedder, texts []string) ([][]float64, error) {
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		vector, err := embedder.Embed(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		vectors[i] = vector
+	}
+	return vectors, nil
+}
+
+func float32sToFloat64s(vector32 []float32) []float64 {
+	vector := make([]float64, len(vector32))
+	for i, v := range vector32 {
+		vector[i] = float64(v)
+	}
+	return vector
+}
@@ -0,0 +1,89 @@
+package orus
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const DefaultEmbeddingBatchSize = 32
+
+// EmbeddingBatcher coalesces the texts embedded by concurrent callers within
+// a short window into a single batched call, fanning the vectors back out.
+// A batch is sent when the window started by its first text closes, or as
+// soon as it is full.
+type EmbeddingBatcher struct {
+	window   time.Duration
+	maxBatch int
+	embed    func(texts []string) ([][]float64, error)
+
+	mu      sync.Mutex
+	pending *embeddingBatch
+}
+
+type embeddingBatch struct {
+	texts   []string
+	done    chan struct{}
+	vectors [][]float64
+	err     error
+}
+
+// NewEmbeddingBatcher returns nil, a disabled batcher, when window is not
+// positive.
+func NewEmbeddingBatcher(window time.Duration, maxBatch int, embed func(texts []string) ([][]float64, error)) *EmbeddingBatcher {
+	if window <= 0 {
+		return nil
+	}
+	if maxBatch <= 0 {
+		maxBatch = DefaultEmbeddingBatchSize
+	}
+	return &EmbeddingBatcher{window: window, maxBatch: maxBatch, embed: embed}
+}
+
+// Embed returns the embedding of text, waiting for the batch it joined.
+func (b *EmbeddingBatcher) Embed(text string) ([]float64, error) {
+	b.mu.Lock()
+	batch := b.pending
+	if batch == nil {
+		batch = &embeddingBatch{done: make(chan struct{})}
+		b.pending = batch
+		time.AfterFunc(b.window, func() { b.flush(batch) })
+	}
+	index := len(batch.texts)
+	batch.texts = append(batch.texts, text)
+	full := len(batch.texts) >= b.maxBatch
+	if full {
+		b.pending = nil
+	}
+	b.mu.Unlock()
+
+	if full {
+		b.run(batch)
+	}
+	<-batch.done
+	if batch.err != nil {
+		return nil, batch.err
+	}
+	return batch.vectors[index], nil
+}
+
+// flush sends batch when its window closes, unless it was sent when full.
+func (b *EmbeddingBatcher) flush(batch *embeddingBatch) {
+	b.mu.Lock()
+	if b.pending != batch {
+		b.mu.Unlock()
+		return
+	}
+	b.pending = nil
+	b.mu.Unlock()
+	b.run(batch)
+}
+
+func (b *EmbeddingBatcher) run(batch *embeddingBatch) {
+	defer close(batch.done)
+	vectors, err := b.embed(batch.texts)
+	if err == nil && len(vectors) != len(batch.texts) {
+		err = fmt.Errorf("expected %d embeddings, got %d", len(batch.texts), len(vectors))
+	}
+	batch.vectors, batch.err = vectors, err
+}
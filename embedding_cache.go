@@ -0,0 +1,225 @@
+package orus
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"sync"
+	"time"
+)
+
+const DefaultEmbeddingCacheSize = 10000
+
+// EmbeddingCache keeps the embeddings of the texts embedded recently, by
+// model, so indexing a document again or repeating a query does not run the
+// model. The least recently used entry is evicted when it is full. With
+// Redis the embeddings are also shared with the other replicas.
+type EmbeddingCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+	redis   *RedisClient
+	// evictions counts the entries removed, when set.
+	evictions *Evictions
+}
+
+type embeddingEntry struct {
+	key     string
+	vector  []float64
+	expires time.Time
+}
+
+// NewEmbeddingCache returns nil, a disabled cache, when ttl is not
+// positive. A nil cache leaves the embedders it wraps as they are.
+func NewEmbeddingCache(ttl time.Duration, size int) *EmbeddingCache {
+	if ttl <= 0 {
+		return nil
+	}
+	if size <= 0 {
+		size = DefaultEmbeddingCacheSize
+	}
+	return &EmbeddingCache{
+		ttl:     ttl,
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element, size),
+	}
+}
+
+// SetRedis shares the embeddings through redis, checked when an embedding
+// is not cached locally.
+func (c *EmbeddingCache) SetRedis(redis *RedisClient) *EmbeddingCache {
+	if c != nil {
+		c.redis = redis
+	}
+	return c
+}
+
+// SetEvictions counts the entries removed in evictions.
+func (c *EmbeddingCache) SetEvictions(evictions *Evictions) *EmbeddingCache {
+	if c != nil {
+		c.evictions = evictions
+	}
+	return c
+}
+
+// Expire removes the expired entries and returns how many.
+func (c *EmbeddingCache) Expire() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	expired := 0
+	for key, element := range c.entries {
+		if now.After(element.Value.(*embeddingEntry).expires) {
+			c.order.Remove(element)
+			delete(c.entries, key)
+			expired++
+		}
+	}
+	c.evictions.Add("embedding_cache", EvictExpired, expired)
+	return expired
+}
+
+// wrap answers the embeddings of embedder from the cache.
+func (c *EmbeddingCache) wrap(embedder Embedder) Embedder {
+	if c == nil {
+		return embedder
+	}
+	return &cachedEmbedder{Embedder: embedder, cache: c}
+}
+
+func embeddingKey(model, text string) string {
+	sum := sha256.Sum256([]byte(model + "\x00" + text))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *EmbeddingCache) get(key string) ([]float64, bool) {
+	c.mu.Lock()
+	element, ok := c.entries[key]
+	if ok {
+		entry := element.Value.(*embeddingEntry)
+		if time.Now().Before(entry.expires) {
+			c.order.MoveToFront(element)
+			c.mu.Unlock()
+			// the callers own the vectors they get
+			return append([]float64(nil), entry.vector...), true
+		}
+		c.order.Remove(element)
+		delete(c.entries, key)
+		c.evictions.Add("embedding_cache", EvictExpired, 1)
+	}
+	c.mu.Unlock()
+
+	if c.redis == nil {
+		return nil, false
+	}
+	data, ok, err := c.redis.Get(c.redis.Key("embedding", key))
+	if err != nil {
+		log.Printf("Error reading the shared embedding cache: %v", err)
+		return nil, false
+	}
+	if !ok {
+		return nil, false
+	}
+	vector, err := decodeEmbedding(string(data))
+	if err != nil {
+		return nil, false
+	}
+	c.keep(key, vector)
+	return vector, true
+}
+
+func (c *EmbeddingCache) put(key string, vector []float64) {
+	c.keep(key, vector)
+	if c.redis == nil {
+		return
+	}
+	if err := c.redis.Set(c.redis.Key("embedding", key), []byte(encodeEmbedding(vector)), c.ttl); err != nil {
+		log.Printf("Error writing the shared embedding cache: %v", err)
+	}
+}
+
+// keep stores vector in the local cache only.
+func (c *EmbeddingCache) keep(key string, vector []float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &embeddingEntry{key: key, vector: append([]float64(nil), vector...), expires: time.Now().Add(c.ttl)}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*embeddingEntry).key)
+		c.evictions.Add("embedding_cache", EvictCapacity, 1)
+	}
+}
+
+// cachedEmbedder embeds the texts its cache does not have.
+type cachedEmbedder struct {
+	Embedder
+	cache *EmbeddingCache
+}
+
+func (e *cachedEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	key := embeddingKey(e.Name(), text)
+	if vector, ok := e.cache.get(key); ok {
+		return vector, nil
+	}
+	vector, err := e.Embedder.Embed(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	e.cache.put(key, vector)
+	return vector, nil
+}
+
+// EmbedBatch embeds the texts missing from the cache in one batch.
+func (e *cachedEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	vectors := make([][]float64, len(texts))
+	keys := make([]string, len(texts))
+	missing := make([]int, 0, len(texts))
+	for n, text := range texts {
+		keys[n] = embeddingKey(e.Name(), text)
+		if vector, ok := e.cache.get(keys[n]); ok {
+			vectors[n] = vector
+		} else {
+			missing = append(missing, n)
+		}
+	}
+	if len(missing) == 0 {
+		return vectors, nil
+	}
+	batch := make([]string, len(missing))
+	for n, index := range missing {
+		batch[n] = texts[index]
+	}
+	embedded, err := e.Embedder.EmbedBatch(ctx, batch)
+	if err != nil {
+		return nil, err
+	}
+	for n, index := range missing {
+		if n < len(embedded) {
+			vectors[index] = embedded[n]
+			e.cache.put(keys[index], embedded[n])
+		}
+	}
+	return vectors, nil
+}
+
+func (e *cachedEmbedder) Quantization() string {
+	if quantized, ok := e.Embedder.(interface{ Quantization() string }); ok {
+		return quantized.Quantization()
+	}
+	return "float64"
+}
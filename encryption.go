@@ -0,0 +1,307 @@
+package orus
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// encryptedPrefix starts the values encrypted at rest, followed by the ID of
+// their key and the base64 of the nonce and the sealed value. A value
+// without it was stored in plain text, before encryption was enabled.
+const encryptedPrefix = "orus:enc:v1:"
+
+const kmsTimeout = 30 * time.Second
+
+// ErrEncryptionKey is returned for a value encrypted with a key that is not
+// configured.
+var ErrEncryptionKey = errors.New("the value is encrypted with a key that is not configured")
+
+type EncryptionConfig struct {
+	// Keys are the AES keys, each "id:base64" of 16, 24 or 32 random bytes.
+	// The first one encrypts the values written; the others only decrypt,
+	// so a key rotated out stays listed until `orus-api reencrypt` rewrote
+	// its values. Without keys the values are stored in plain text.
+	Keys []Secret `yaml:"keys"`
+	// KMS unwraps the keys with AWS KMS when its region is set: each key is
+	// then the ciphertext blob of a data key, so the configuration never
+	// holds the key itself.
+	KMS KMSConfig `yaml:"kms"`
+}
+
+type KMSConfig struct {
+	// Endpoint is https://kms.<region>.amazonaws.com unless set, such as
+	// for a VPC endpoint.
+	Endpoint  string `yaml:"endpoint"`
+	Region    string `yaml:"region"`
+	AccessKey Secret `yaml:"access_key"`
+	SecretKey Secret `yaml:"secret_key"`
+}
+
+// parseEncryptionKey splits an "id:base64" key.
+func parseEncryptionKey(entry Secret) (string, []byte, error) {
+	id, encoded, ok := strings.Cut(entry.Reveal(), ":")
+	if !ok || strings.TrimSpace(id) == "" {
+		return "", nil, errors.New("expected id:base64")
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return id, nil, fmt.Errorf("key %s is not base64", id)
+	}
+	return strings.TrimSpace(id), key, nil
+}
+
+// Cipher encrypts the prompts, replies and document contents a storage
+// keeps with AES-GCM, under the first key of its configuration, and
+// decrypts them with the key they name. The methods of a nil Cipher keep
+// the values in plain text.
+type Cipher struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// NewCipher returns nil, no encryption, when config has no keys.
+func NewCipher(config EncryptionConfig) (*Cipher, error) {
+	if len(config.Keys) == 0 {
+		return nil, nil
+	}
+	c := &Cipher{keys: make(map[string]cipher.AEAD, len(config.Keys))}
+	for i, entry := range config.Keys {
+		id, key, err := parseEncryptionKey(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key %d: %w", i+1, err)
+		}
+		if _, ok := c.keys[id]; ok {
+			return nil, fmt.Errorf("encryption key %s is listed twice", id)
+		}
+		if config.KMS.Region != "" {
+			if key, err = kmsDecrypt(config.KMS, key); err != nil {
+				return nil, fmt.Errorf("error unwrapping encryption key %s: %w", id, err)
+			}
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key %s: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key %s: %w", id, err)
+		}
+		c.keys[id] = aead
+		if i == 0 {
+			c.primary = id
+		}
+	}
+	return c, nil
+}
+
+// Encrypt seals value under the first key. An empty value stays empty.
+func (c *Cipher) Encrypt(value string) string {
+	if c == nil || value == "" {
+		return value
+	}
+	aead := c.keys[c.primary]
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	sealed := aead.Seal(nonce, nonce, []byte(value), nil)
+	return encryptedPrefix + c.primary + ":" + base64.StdEncoding.EncodeToString(sealed)
+}
+
+// Decrypt opens a value sealed by Encrypt, and returns a value stored in
+// plain text as it is.
+func (c *Cipher) Decrypt(value string) (string, error) {
+	rest, ok := strings.CutPrefix(value, encryptedPrefix)
+	if !ok {
+		return value, nil
+	}
+	id, encoded, _ := strings.Cut(rest, ":")
+	var aead cipher.AEAD
+	if c != nil {
+		aead = c.keys[id]
+	}
+	if aead == nil {
+		return "", fmt.Errorf("%w: %q", ErrEncryptionKey, id)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("invalid encrypted value under key %s", id)
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("error decrypting a value under key %s: %w", id, err)
+	}
+	return string(plain), nil
+}
+
+// Current reports whether value is stored as Encrypt would store it now:
+// under the first key, or in plain text without encryption.
+func (c *Cipher) Current(value string) bool {
+	if value == "" {
+		return true
+	}
+	if c == nil {
+		return !strings.HasPrefix(value, encryptedPrefix)
+	}
+	return strings.HasPrefix(value, encryptedPrefix+c.primary+":")
+}
+
+// reencrypt returns value decrypted and encrypted again under the first key,
+// and whether it changed.
+func (c *Cipher) reencrypt(value string) (string, bool, error) {
+	if c.Current(value) {
+		return value, false, nil
+	}
+	plain, err := c.Decrypt(value)
+	if err != nil {
+		return "", false, err
+	}
+	return c.Encrypt(plain), true, nil
+}
+
+// seal returns documents with their content encrypted.
+func (c *Cipher) seal(documents []Document) []Document {
+	if c == nil || len(documents) == 0 {
+		return documents
+	}
+	sealed := slices.Clone(documents)
+	for i := range sealed {
+		sealed[i].Content = c.Encrypt(sealed[i].Content)
+	}
+	return sealed
+}
+
+// open decrypts the content of documents in place.
+func (c *Cipher) open(documents []Document) error {
+	for i := range documents {
+		content, err := c.Decrypt(documents[i].Content)
+		if err != nil {
+			return err
+		}
+		documents[i].Content = content
+	}
+	return nil
+}
+
+// sealedBlobs encrypts the blobs of a BlobStore whole, for the uploads,
+// snapshots and backups, which hold documents and sessions.
+type sealedBlobs struct {
+	BlobStore
+	cipher *Cipher
+}
+
+// SealBlobs returns blobs encrypting the blobs it keeps with cipher, or
+// blobs itself when cipher is nil. A blob stored before encryption was
+// enabled is read as it is.
+func SealBlobs(blobs BlobStore, cipher *Cipher) BlobStore {
+	if cipher == nil || blobs == nil {
+		return blobs
+	}
+	return &sealedBlobs{BlobStore: blobs, cipher: cipher}
+}
+
+func (b *sealedBlobs) Put(key string, data []byte, contentType string) error {
+	return b.BlobStore.Put(key, []byte(b.cipher.Encrypt(string(data))), contentType)
+}
+
+func (b *sealedBlobs) Get(key string) ([]byte, error) {
+	data, err := b.BlobStore.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := b.cipher.Decrypt(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting blob %s: %w", key, err)
+	}
+	return []byte(plain), nil
+}
+
+// ReencryptBlobs rewrites the blobs of blobs, opened without SealBlobs,
+// that are not encrypted under the first key of cipher, and returns how
+// many it rewrote.
+func ReencryptBlobs(blobs BlobStore, cipher *Cipher) (int, error) {
+	infos, err := blobs.List("")
+	if err != nil {
+		return 0, err
+	}
+	rewritten := 0
+	for _, blob := range infos {
+		data, err := blobs.Get(blob.Key)
+		if err != nil {
+			return rewritten, err
+		}
+		sealed, changed, err := cipher.reencrypt(string(data))
+		if err != nil {
+			return rewritten, fmt.Errorf("error re-encrypting blob %s: %w", blob.Key, err)
+		}
+		if !changed {
+			continue
+		}
+		if err := blobs.Put(blob.Key, []byte(sealed), blob.ContentType); err != nil {
+			return rewritten, err
+		}
+		rewritten++
+	}
+	return rewritten, nil
+}
+
+// kmsDecrypt unwraps a data key with the Decrypt action of AWS KMS.
+func kmsDecrypt(config KMSConfig, blob []byte) ([]byte, error) {
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = "https://kms." + config.Region + ".amazonaws.com"
+	}
+	target, err := url.Parse(endpoint)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("invalid kms endpoint %q", endpoint)
+	}
+	if target.Path == "" {
+		target.Path = "/"
+	}
+	body, _ := json.Marshal(struct {
+		CiphertextBlob []byte `json:"CiphertextBlob"`
+	}{blob})
+	req, err := http.NewRequest(http.MethodPost, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService.Decrypt")
+	signV4(req, body, time.Now().UTC(), config.Region, "kms", config.AccessKey.Reveal(), config.SecretKey.Reveal())
+	response, err := (&http.Client{Timeout: kmsTimeout}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(response.Body, 64*1024))
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		var failure struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &failure) == nil && failure.Type != "" {
+			return nil, fmt.Errorf("kms: %s: %s", failure.Type, failure.Message)
+		}
+		return nil, fmt.Errorf("kms: status %d", response.StatusCode)
+	}
+	var result struct {
+		Plaintext []byte `json:"Plaintext"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("error decoding kms response: %w", err)
+	}
+	return result.Plaintext, nil
+}
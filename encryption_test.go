@@ -0,0 +1,82 @@
+package orus
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVectorStoreFilesEncryptContent(t *testing.T) {
+	dir := t.TempDir()
+	vectors := filepath.Join(dir, "docs.vec")
+	saved := filepath.Join(dir, "memory.json")
+	store := NewVectorStore().SetCipher(testCipher(t, "k1"))
+	if err := store.OpenFile("docs", vectors); err != nil {
+		t.Fatal(err)
+	}
+	store.Add("docs", Document{ID: "a", Content: "first secret", Embedding: []float64{1, 0}})
+	store.Add("memory", Document{ID: "b", Content: "second secret", Embedding: []float64{0, 1}})
+	if err := store.Save("docs", vectors); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save("memory", saved); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{vectors + ".meta", saved} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, []byte("secret")) {
+			t.Fatalf("%s holds the content in plain text: %s", filepath.Base(path), data)
+		}
+	}
+
+	reopened := NewVectorStore().SetCipher(testCipher(t, "k2", "k1"))
+	if err := reopened.OpenFile("docs", vectors); err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.Load("memory", saved); err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(reopened.Documents("docs", nil))["a"]; got != "first secret" {
+		t.Fatalf("reopened the vector file with %q", got)
+	}
+	if got := contents(reopened.Documents("memory", nil))["b"]; got != "second secret" {
+		t.Fatalf("loaded the saved collection with %q", got)
+	}
+}
+
+func TestSealBlobs(t *testing.T) {
+	disk, err := NewDiskBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := disk.Put("plain", []byte("kept before encryption"), "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	old := SealBlobs(disk, testCipher(t, "k1"))
+	if err := old.Put("sealed", []byte("a secret upload"), "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := disk.Get("sealed"); bytes.Contains(data, []byte("secret")) {
+		t.Fatalf("the blob is stored in plain text: %s", data)
+	}
+
+	// after a rotation both blobs are rewritten under the new key
+	rotated := testCipher(t, "k2", "k1")
+	if n, err := ReencryptBlobs(disk, rotated); err != nil || n != 2 {
+		t.Fatalf("re-encrypted %d blobs: %v", n, err)
+	}
+	blobs := SealBlobs(disk, testCipher(t, "k2"))
+	for key, want := range map[string]string{"plain": "kept before encryption", "sealed": "a secret upload"} {
+		data, err := blobs.Get(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Fatalf("read %q for %s, want %q", data, key, want)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package orus
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Dsouza10082/orus/ollama"
+	"github.com/google/uuid"
+)
+
+const DefaultGenerationLogSize = 10000
+
+var ErrGenerationNotFound = errors.New("generation not found")
+
+// Generation is the prompt/response pair produced for a request serial.
+type Generation struct {
+	Serial    string           `json:"serial" swaggertype:"string" example:"123e4567-e89b-12d3-a456-426614174000"`
+	Endpoint  string           `json:"endpoint" swaggertype:"string" example:"/orus-api/v1/call-llm"`
+	Model     string           `json:"model" swaggertype:"string" example:"llama3.1:8b"`
+	Messages  []ollama.Message `json:"messages" swaggertype:"array"`
+	Response  string           `json:"response" swaggertype:"string" example:"Paris is the capital of France."`
+	TimeTaken time.Duration    `json:"time_taken" swaggertype:"integer" example:"1500"`
+	CreatedAt time.Time        `json:"created_at" swaggertype:"string" example:"2021-01-01T00:00:00Z"`
+}
+
+// Prompt returns the text that identifies the prompt for aggregation:
+// the system prompt when there is one, otherwise the last user message.
+func (g *Generation) Prompt() string {
+	for _, message := range g.Messages {
+		if message.Role == "system" {
+			return message.Content
+		}
+	}
+	for i := len(g.Messages) - 1; i >= 0; i-- {
+		if g.Messages[i].Role == "user" {
+			return g.Messages[i].Content
+		}
+	}
+	return ""
+}
+
+// GenerationLog keeps the most recent generations in memory so feedback
+// can be attached to them by serial.
+type GenerationLog struct {
+	mu          sync.RWMutex
+	size        int
+	order       []string
+	generations map[string]Generation
+}
+
+func NewGenerationLog(size int) *GenerationLog {
+	if size <= 0 {
+		size = DefaultGenerationLogSize
+	}
+	return &GenerationLog{
+		size:        size,
+		order:       make([]string, 0, size),
+		generations: make(map[string]Generation, size),
+	}
+}
+
+func (l *GenerationLog) Record(generation Generation) {
+	if generation.CreatedAt.IsZero() {
+		generation.CreatedAt = time.Now().UTC()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.generations[generation.Serial]; !ok {
+		if len(l.order) >= l.size {
+			delete(l.generations, l.order[0])
+			l.order = l.order[1:]
+		}
+		l.order = append(l.order, generation.Serial)
+	}
+	l.generations[generation.Serial] = generation
+}
+
+func (l *GenerationLog) Get(serial string) (Generation, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	generation, ok := l.generations[serial]
+	if !ok {
+		return Generation{}, ErrGenerationNotFound
+	}
+	return generation, nil
+}
+
+type Feedback struct {
+	ID         string     `json:"id" swaggertype:"string" example:"123e4567-e89b-12d3-a456-426614174000"`
+	Serial     string     `json:"serial" swaggertype:"string" example:"123e4567-e89b-12d3-a456-426614174000"`
+	Thumbs     string     `json:"thumbs,omitempty" swaggertype:"string" example:"down"`
+	Score      *int       `json:"score,omitempty" swaggertype:"integer" example:"2"`
+	Comment    string     `json:"comment,omitempty" swaggertype:"string" example:"Ignored the requested format"`
+	Generation Generation `json:"generation" swaggertype:"object"`
+	CreatedAt  time.Time  `json:"created_at" swaggertype:"string" example:"2021-01-01T00:00:00Z"`
+}
+
+type FeedbackSummary struct {
+	Key          string   `json:"key" swaggertype:"string" example:"You are a helpful assistant."`
+	Count        int      `json:"count" swaggertype:"integer" example:"12"`
+	ThumbsUp     int      `json:"thumbs_up" swaggertype:"integer" example:"4"`
+	ThumbsDown   int      `json:"thumbs_down" swaggertype:"integer" example:"8"`
+	AverageScore *float64 `json:"average_score,omitempty" swaggertype:"number" example:"2.5"`
+	Comments     []string `json:"comments,omitempty" swaggertype:"array"`
+}
+
+// approval is the share of positive signals, used to rank the worst groups first.
+func (f *FeedbackSummary) approval() float64 {
+	if f.AverageScore != nil {
+		return *f.AverageScore / 5
+	}
+	if f.ThumbsUp+f.ThumbsDown == 0 {
+		return 1
+	}
+	return float64(f.ThumbsUp) / float64(f.ThumbsUp+f.ThumbsDown)
+}
+
+type FeedbackStore interface {
+	Add(feedback Feedback) (*Feedback, error)
+	List() ([]Feedback, error)
+}
+
+type MemoryFeedbackStore struct {
+	mu       sync.RWMutex
+	feedback []Feedback
+}
+
+func NewMemoryFeedbackStore() *MemoryFeedbackStore {
+	return &MemoryFeedbackStore{
+		feedback: make([]Feedback, 0),
+	}
+}
+
+func (m *MemoryFeedbackStore) Add(feedback Feedback) (*Feedback, error) {
+	feedback.ID = uuid.New().String()
+	feedback.CreatedAt = time.Now().UTC()
+	m.mu.Lock()
+	m.feedback = append(m.feedback, feedback)
+	m.mu.Unlock()
+	return &feedback, nil
+}
+
+func (m *MemoryFeedbackStore) List() ([]Feedback, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	feedback := make([]Feedback, len(m.feedback))
+	copy(feedback, m.feedback)
+	return feedback, nil
+}
+
+// SummarizeFeedback groups feedback by prompt, model or endpoint and sorts
+// the groups from the worst rated to the best rated.
+func SummarizeFeedback(feedback []Feedback, groupBy string) []FeedbackSummary {
+	groups := make(map[string]*FeedbackSummary)
+	scores := make(map[string][]int)
+	for _, entry := range feedback {
+		var key string
+		switch groupBy {
+		case "model":
+			key = entry.Generation.Model
+		case "endpoint":
+			key = entry.Generation.Endpoint
+		default:
+			key = strings.TrimSpace(entry.Generation.Prompt())
+		}
+		group, ok := groups[key]
+		if !ok {
+			group = &FeedbackSummary{Key: key}
+			groups[key] = group
+		}
+		group.Count++
+		switch entry.Thumbs {
+		case "up":
+			group.ThumbsUp++
+		case "down":
+			group.ThumbsDown++
+		}
+		if entry.Score != nil {
+			scores[key] = append(scores[key], *entry.Score)
+		}
+		if entry.Comment != "" {
+			group.Comments = append(group.Comments, entry.Comment)
+		}
+	}
+
+	summaries := make([]FeedbackSummary, 0, len(groups))
+	for key, group := range groups {
+		if values := scores[key]; len(values) > 0 {
+			total := 0
+			for _, value := range values {
+				total += value
+			}
+			average := float64(total) / float64(len(values))
+			group.AverageScore = &average
+		}
+		summaries = append(summaries, *group)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].approval() != summaries[j].approval() {
+			return summaries[i].approval() < summaries[j].approval()
+		}
+		return summaries[i].Count > summaries[j].Count
+	})
+	return summaries
+}
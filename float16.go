@@ -0,0 +1,126 @@
+package orus
+
+import (
+	"math"
+)
+
+// float16Table maps every IEEE 754 half precision value to float32, which
+// is faster than converting them bit by bit while scoring.
+var float16Table = func() *[1 << 16]float32 {
+	table := new([1 << 16]float32)
+	for h := range table {
+		table[h] = float16ToFloat32(uint16(h))
+	}
+	return table
+}()
+
+func float16ToFloat32(h uint16) float32 {
+	sign := uint32(h&0x8000) << 16
+	exponent := uint32(h>>10) & 0x1f
+	mantissa := uint32(h & 0x3ff)
+	switch {
+	case exponent == 0x1f:
+		// Infinity or NaN
+		return math.Float32frombits(sign | 0x7f800000 | mantissa<<13)
+	case exponent != 0:
+		return math.Float32frombits(sign | (exponent+127-15)<<23 | mantissa<<13)
+	case mantissa == 0:
+		return math.Float32frombits(sign)
+	}
+	// A subnormal half is a normal float32
+	exponent = 127 - 15 + 1
+	for mantissa&0x400 == 0 {
+		mantissa <<= 1
+		exponent--
+	}
+	return math.Float32frombits(sign | exponent<<23 | (mantissa&0x3ff)<<13)
+}
+
+// float32ToFloat16 rounds f to the nearest half, ties to even. Values out
+// of range become infinities.
+func float32ToFloat16(f float32) uint16 {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exponent := int(bits>>23&0xff) - 127 + 15
+	mantissa := bits & 0x7fffff
+	switch {
+	case bits&0x7fffffff > 0x7f800000:
+		return sign | 0x7e00
+	case exponent >= 0x1f:
+		return sign | 0x7c00
+	case exponent <= 0:
+		if exponent < -10 {
+			return sign
+		}
+		// Subnormal: shift the implicit bit in and round what falls off
+		mantissa |= 0x800000
+		shift := uint(14 - exponent)
+		half := uint16(mantissa >> shift)
+		rest := mantissa & (1<<shift - 1)
+		halfway := uint32(1) << (shift - 1)
+		if rest > halfway || (rest == halfway && half&1 == 1) {
+			half++
+		}
+		return sign | half
+	}
+	half := sign | uint16(exponent)<<10 | uint16(mantissa>>13)
+	rest := mantissa & 0x1fff
+	if rest > 0x1000 || (rest == 0x1000 && half&1 == 1) {
+		// A carry into the exponent is still the right rounding
+		half++
+	}
+	return half
+}
+
+// toFloat16 converts an embedding to half precision.
+func toFloat16(embedding []float64) []uint16 {
+	half := make([]uint16, len(embedding))
+	for i, value := range embedding {
+		half[i] = float32ToFloat16(float32(value))
+	}
+	return half
+}
+
+// fromFloat16 converts a half precision embedding back to float64.
+func fromFloat16(half []uint16) []float64 {
+	embedding := make([]float64, len(half))
+	for i, h := range half {
+		embedding[i] = float64(float16Table[h])
+	}
+	return embedding
+}
+
+// halfQuery scores half precision embeddings against a query, accumulating
+// in float32.
+type halfQuery struct {
+	vector []float32
+	norm   float32
+}
+
+func newHalfQuery(query []float64) halfQuery {
+	vector := make([]float32, len(query))
+	var norm float32
+	for i, value := range query {
+		vector[i] = float32(value)
+		norm += vector[i] * vector[i]
+	}
+	return halfQuery{vector: vector, norm: norm}
+}
+
+// similarity returns the cosine similarity of the query and half, 0 when
+// their dimensions differ.
+func (q halfQuery) similarity(half []uint16) float64 {
+	if len(half) != len(q.vector) || len(half) == 0 {
+		return 0
+	}
+	var dot, norm float32
+	for i, h := range half {
+		value := float16Table[h]
+		dot += q.vector[i] * value
+		norm += value * value
+	}
+	if q.norm == 0 || norm == 0 {
+		return 0
+	}
+	return float64(dot) / (math.Sqrt(float64(q.norm)) * math.Sqrt(float64(norm)))
+}
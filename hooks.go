@@ -0,0 +1,353 @@
+package orus
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Dsouza10082/orus/ollama"
+)
+
+// BeforeChatHook runs before a chat reaches the model, and may rewrite req.
+// Returning a response answers the chat without the model, as a cache does;
+// returning an error rejects it.
+type BeforeChatHook func(ctx context.Context, req *ollama.ChatRequest) (*ollama.ChatResponse, error)
+
+// AfterChatHook runs once a chat is answered or failed. The response of a
+// streamed chat holds the whole reply and the token counts of its last
+// chunk.
+type AfterChatHook func(ctx context.Context, req ollama.ChatRequest, resp *ollama.ChatResponse, err error)
+
+// ChunkHook runs on every chunk of a streamed chat before it is passed on,
+// and may rewrite it. Returning an error stops the stream.
+type ChunkHook func(ctx context.Context, chunk *ollama.ChatStreamResponse) error
+
+// EmbedHook runs once texts are embedded by model, or failed to be.
+type EmbedHook func(ctx context.Context, model string, texts []string, vectors [][]float64, err error)
+
+// Hooks run around every model call of an Orus, so programs embedding it
+// can rewrite prompts, log, cache or bill without changing the handlers.
+// The hooks of a kind run in the order they were added.
+type Hooks struct {
+	mu         sync.RWMutex
+	beforeChat []BeforeChatHook
+	afterChat  []AfterChatHook
+	chunk      []ChunkHook
+	embed      []EmbedHook
+}
+
+func NewHooks() *Hooks {
+	return &Hooks{}
+}
+
+func (h *Hooks) OnBeforeChat(hook BeforeChatHook) *Hooks {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.beforeChat = append(h.beforeChat, hook)
+	return h
+}
+
+func (h *Hooks) OnAfterChat(hook AfterChatHook) *Hooks {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.afterChat = append(h.afterChat, hook)
+	return h
+}
+
+func (h *Hooks) OnChunk(hook ChunkHook) *Hooks {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.chunk = append(h.chunk, hook)
+	return h
+}
+
+func (h *Hooks) OnEmbed(hook EmbedHook) *Hooks {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.embed = append(h.embed, hook)
+	return h
+}
+
+// snapshot returns the hooks registered so far, so a call runs the same
+// ones from start to end.
+func (h *Hooks) snapshot() *Hooks {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return &Hooks{beforeChat: h.beforeChat, afterChat: h.afterChat, chunk: h.chunk, embed: h.embed}
+}
+
+func (h *Hooks) runBeforeChat(ctx context.Context, req *ollama.ChatRequest) (*ollama.ChatResponse, error) {
+	for _, hook := range h.beforeChat {
+		resp, err := hook(ctx, req)
+		if resp != nil || err != nil {
+			return resp, err
+		}
+	}
+	return nil, nil
+}
+
+func (h *Hooks) runAfterChat(ctx context.Context, req ollama.ChatRequest, resp *ollama.ChatResponse, err error) {
+	for _, hook := range h.afterChat {
+		hook(ctx, req, resp, err)
+	}
+}
+
+func (h *Hooks) runChunk(ctx context.Context, chunk *ollama.ChatStreamResponse) error {
+	for _, hook := range h.chunk {
+		if err := hook(ctx, chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *Hooks) runEmbed(ctx context.Context, model string, texts []string, vectors [][]float64, err error) {
+	for _, hook := range h.embed {
+		hook(ctx, model, texts, vectors, err)
+	}
+}
+
+// hookedBackend runs the hooks around the calls of its backend, and times
+// the chats the backend answers for the model stats.
+type hookedBackend struct {
+	ollama.Backend
+	hooks *Hooks
+	stats *ModelStats
+	ctx   context.Context
+}
+
+// Unwrap returns the backend the hooks run around.
+func (b *hookedBackend) Unwrap() ollama.Backend {
+	return b.Backend
+}
+
+func (b *hookedBackend) WithContext(ctx context.Context) ollama.Backend {
+	return &hookedBackend{Backend: b.Backend.WithContext(ctx), hooks: b.hooks, stats: b.stats, ctx: ctx}
+}
+
+func (b *hookedBackend) Chat(req ollama.ChatRequest) (*ollama.ChatResponse, error) {
+	return b.chat(req, b.Backend.Chat)
+}
+
+func (b *hookedBackend) ChatCloud(req ollama.ChatRequest) (*ollama.ChatResponse, error) {
+	return b.chat(req, b.Backend.ChatCloud)
+}
+
+func (b *hookedBackend) chat(req ollama.ChatRequest, chat func(ollama.ChatRequest) (*ollama.ChatResponse, error)) (*ollama.ChatResponse, error) {
+	hooks := b.hooks.snapshot()
+	resp, err := hooks.runBeforeChat(b.ctx, &req)
+	if resp == nil && err == nil {
+		start := time.Now()
+		resp, err = chat(req)
+		AddPhase(b.ctx, PhaseGeneration, start)
+		b.observe(req.Model, start, 0, resp, err)
+	}
+	hooks.runAfterChat(b.ctx, req, resp, err)
+	return resp, err
+}
+
+func (b *hookedBackend) ChatStream(req ollama.ChatRequest, callback ollama.ChatStreamFunc) error {
+	return b.chatStream(req, callback, b.Backend.ChatStream)
+}
+
+func (b *hookedBackend) ChatStreamCloud(req ollama.ChatRequest, callback ollama.ChatStreamFunc) error {
+	return b.chatStream(req, callback, b.Backend.ChatStreamCloud)
+}
+
+func (b *hookedBackend) chatStream(req ollama.ChatRequest, callback ollama.ChatStreamFunc, stream func(ollama.ChatRequest, ollama.ChatStreamFunc) error) error {
+	hooks := b.hooks.snapshot()
+	cached, err := hooks.runBeforeChat(b.ctx, &req)
+	if err != nil {
+		hooks.runAfterChat(b.ctx, req, nil, err)
+		return err
+	}
+	start := time.Now()
+	reply := newStreamReply(req.Model, start)
+	onChunk := func(ctx context.Context, chunk ollama.ChatStreamResponse) error {
+		if err := hooks.runChunk(ctx, &chunk); err != nil {
+			return err
+		}
+		reply.add(chunk)
+		return callback(ctx, chunk)
+	}
+	if cached != nil {
+		// a cached reply is streamed as a single chunk
+		err = onChunk(b.ctx, ollama.ChatStreamResponse{
+			Model:           cached.Model,
+			CreatedAt:       time.Now(),
+			Message:         cached.Message,
+			Done:            true,
+			PromptEvalCount: cached.PromptEvalCount,
+			EvalCount:       cached.EvalCount,
+		})
+		if err == ollama.ErrStopStream {
+			err = nil
+		}
+	} else {
+		err = stream(req, onChunk)
+		AddPhase(b.ctx, PhaseGeneration, start)
+		if err != nil {
+			b.observe(req.Model, start, 0, nil, err)
+		} else {
+			b.observe(req.Model, start, reply.firstToken, reply.response(), nil)
+		}
+	}
+	if err != nil {
+		hooks.runAfterChat(b.ctx, req, nil, err)
+	} else {
+		hooks.runAfterChat(b.ctx, req, reply.response(), nil)
+	}
+	return err
+}
+
+// ChatStreamRaw passes the lines on untouched unless a hook may rewrite the
+// request or the chunks, in which case every line is decoded for them and
+// encoded again. The after hooks get the reply decoded from the lines.
+func (b *hookedBackend) ChatStreamRaw(req ollama.ChatRequest, line func([]byte) error) error {
+	hooks := b.hooks.snapshot()
+	if len(hooks.beforeChat) > 0 || len(hooks.chunk) > 0 {
+		return b.ChatStream(req, func(ctx context.Context, chunk ollama.ChatStreamResponse) error {
+			data, err := json.Marshal(chunk)
+			if err != nil {
+				return err
+			}
+			return line(data)
+		})
+	}
+	start := time.Now()
+	defer AddPhase(b.ctx, PhaseGeneration, start)
+	if len(hooks.afterChat) == 0 && b.stats == nil {
+		return b.Backend.ChatStreamRaw(req, line)
+	}
+	reply := newStreamReply(req.Model, start)
+	err := b.Backend.ChatStreamRaw(req, func(data []byte) error {
+		var chunk ollama.ChatStreamResponse
+		if json.Unmarshal(data, &chunk) == nil {
+			reply.add(chunk)
+		}
+		return line(data)
+	})
+	if err != nil {
+		b.observe(req.Model, start, 0, nil, err)
+	} else {
+		b.observe(req.Model, start, reply.firstToken, reply.response(), nil)
+	}
+	if err != nil {
+		hooks.runAfterChat(b.ctx, req, nil, err)
+	} else {
+		hooks.runAfterChat(b.ctx, req, reply.response(), nil)
+	}
+	return err
+}
+
+func (b *hookedBackend) GetEmbedding(model, text string) ([]float64, error) {
+	start := time.Now()
+	vector, err := b.Backend.GetEmbedding(model, text)
+	AddPhase(b.ctx, PhaseEmbedding, start)
+	var vectors [][]float64
+	if err == nil {
+		vectors = [][]float64{vector}
+	}
+	b.hooks.snapshot().runEmbed(b.ctx, model, []string{text}, vectors, err)
+	return vector, err
+}
+
+func (b *hookedBackend) GetEmbeddings(model string, texts []string) ([][]float64, error) {
+	start := time.Now()
+	vectors, err := b.Backend.GetEmbeddings(model, texts)
+	AddPhase(b.ctx, PhaseEmbedding, start)
+	b.hooks.snapshot().runEmbed(b.ctx, model, texts, vectors, err)
+	return vectors, err
+}
+
+// observe adds a chat the backend answered, or failed, to the model stats.
+// The model is the one the aliases resolve to.
+func (b *hookedBackend) observe(model string, start time.Time, firstToken time.Duration, resp *ollama.ChatResponse, err error) {
+	if b.stats == nil {
+		return
+	}
+	if client, ok := ollama.ClientOf(b.Backend); ok {
+		model = client.ResolveModel(model)
+	}
+	b.stats.Observe(modelCall(model, start, firstToken, resp, err))
+}
+
+// streamReply gathers the chunks of a streamed chat into the response the
+// after hooks get, and times its first token.
+type streamReply struct {
+	model      string
+	start      time.Time
+	firstToken time.Duration
+	content    strings.Builder
+	thinking   strings.Builder
+	last       ollama.ChatStreamResponse
+}
+
+func newStreamReply(model string, start time.Time) *streamReply {
+	return &streamReply{model: model, start: start}
+}
+
+func (r *streamReply) add(chunk ollama.ChatStreamResponse) {
+	if r.firstToken == 0 && (chunk.Message.Content != "" || chunk.Message.Thinking != "" || len(chunk.Message.ToolCalls) > 0) {
+		r.firstToken = time.Since(r.start)
+	}
+	r.content.WriteString(chunk.Message.Content)
+	r.thinking.WriteString(chunk.Message.Thinking)
+	r.last = chunk
+}
+
+func (r *streamReply) response() *ollama.ChatResponse {
+	return &ollama.ChatResponse{
+		Model:     r.model,
+		CreatedAt: r.last.CreatedAt,
+		Message: ollama.Message{
+			Role:     "assistant",
+			Content:  r.content.String(),
+			Thinking: r.thinking.String(),
+		},
+		Done:               r.last.Done,
+		TotalDuration:      r.last.TotalDuration,
+		LoadDuration:       r.last.LoadDuration,
+		PromptEvalDuration: r.last.PromptEvalDuration,
+		EvalDuration:       r.last.EvalDuration,
+		PromptEvalCount:    r.last.PromptEvalCount,
+		EvalCount:          r.last.EvalCount,
+	}
+}
+
+// hookedEmbedder runs the embed hooks after the calls of its embedder.
+type hookedEmbedder struct {
+	Embedder
+	hooks *Hooks
+}
+
+func (e *hookedEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	start := time.Now()
+	vector, err := e.Embedder.Embed(ctx, text)
+	AddPhase(ctx, PhaseEmbedding, start)
+	var vectors [][]float64
+	if err == nil {
+		vectors = [][]float64{vector}
+	}
+	e.hooks.snapshot().runEmbed(ctx, e.Name(), []string{text}, vectors, err)
+	return vector, err
+}
+
+func (e *hookedEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	start := time.Now()
+	vectors, err := e.Embedder.EmbedBatch(ctx, texts)
+	AddPhase(ctx, PhaseEmbedding, start)
+	e.hooks.snapshot().runEmbed(ctx, e.Name(), texts, vectors, err)
+	return vectors, err
+}
+
+// Quantization is the one of the embedder, "float64" unless it tells
+// another.
+func (e *hookedEmbedder) Quantization() string {
+	if quantized, ok := e.Embedder.(interface{ Quantization() string }); ok {
+		return quantized.Quantization()
+	}
+	return "float64"
+}
@@ -0,0 +1,211 @@
+package orus
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultIdempotencyTTL = 24 * time.Hour
+	// idempotencyPendingTTL bounds how long a request that never finished,
+	// because its replica stopped, holds its key.
+	idempotencyPendingTTL = 10 * time.Minute
+)
+
+var (
+	// ErrIdempotencyPending is the answer to a key whose request is running.
+	ErrIdempotencyPending = errors.New("a request with this idempotency key is in progress")
+	// ErrIdempotencyMismatch is the answer to a key used for another request.
+	ErrIdempotencyMismatch = errors.New("the idempotency key was used for another request")
+)
+
+type IdempotencyConfig struct {
+	// TTL is how long the response to an idempotency key is kept; 0 ignores
+	// the Idempotency-Key header.
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// IdempotentResponse is the response kept for an idempotency key. Status
+// is 0 while the request runs.
+type IdempotentResponse struct {
+	Fingerprint string      `json:"fingerprint"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+// IdempotencyStore keeps the responses of the requests sent with an
+// idempotency key, so a client retrying one gets the same response instead
+// of running it again. With Redis the keys are shared by the replicas.
+type IdempotencyStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]idempotencyEntry
+	redis   *RedisClient
+	// cipher encrypts the bodies kept in redis; nil keeps them in plain
+	// text.
+	cipher *Cipher
+	// evictions counts the keys removed, when set.
+	evictions *Evictions
+}
+
+type idempotencyEntry struct {
+	response IdempotentResponse
+	expires  time.Time
+}
+
+// NewIdempotencyStore returns nil, a disabled store, when config.TTL is not
+// positive.
+func NewIdempotencyStore(config IdempotencyConfig) *IdempotencyStore {
+	if config.TTL <= 0 {
+		return nil
+	}
+	return &IdempotencyStore{
+		ttl:     config.TTL,
+		entries: make(map[string]idempotencyEntry),
+	}
+}
+
+// SetRedis keeps the keys in redis instead of memory.
+func (s *IdempotencyStore) SetRedis(redis *RedisClient) *IdempotencyStore {
+	if s != nil {
+		s.redis = redis
+	}
+	return s
+}
+
+// SetCipher encrypts the bodies kept in redis with cipher.
+func (s *IdempotencyStore) SetCipher(cipher *Cipher) *IdempotencyStore {
+	if s != nil {
+		s.cipher = cipher
+	}
+	return s
+}
+
+// SetEvictions counts the keys removed in evictions.
+func (s *IdempotencyStore) SetEvictions(evictions *Evictions) *IdempotencyStore {
+	if s != nil {
+		s.evictions = evictions
+	}
+	return s
+}
+
+// Expire removes the expired keys kept in memory and returns how many; with
+// Redis the keys expire there.
+func (s *IdempotencyStore) Expire() int {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	expired := 0
+	for key, entry := range s.entries {
+		if now.After(entry.expires) {
+			delete(s.entries, key)
+			expired++
+		}
+	}
+	s.evictions.Add("idempotency", EvictExpired, expired)
+	return expired
+}
+
+func (s *IdempotencyStore) pendingTTL() time.Duration {
+	return min(s.ttl, idempotencyPendingTTL)
+}
+
+// Begin reserves key for the request of fingerprint. It returns the
+// response kept for key when the request already ran, ErrIdempotencyPending
+// when it is running and ErrIdempotencyMismatch when key was used for
+// another request. A nil response and error means the request may run, and
+// Finish or Release must follow.
+func (s *IdempotencyStore) Begin(key, fingerprint string) (*IdempotentResponse, error) {
+	if s.redis != nil {
+		return s.beginShared(key, fingerprint)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	entry, ok := s.entries[key]
+	if !ok || now.After(entry.expires) {
+		s.entries[key] = idempotencyEntry{
+			response: IdempotentResponse{Fingerprint: fingerprint},
+			expires:  now.Add(s.pendingTTL()),
+		}
+		return nil, nil
+	}
+	return kept(entry.response, fingerprint)
+}
+
+func (s *IdempotencyStore) beginShared(key, fingerprint string) (*IdempotentResponse, error) {
+	pending, _ := json.Marshal(IdempotentResponse{Fingerprint: fingerprint})
+	redisKey := s.redis.Key("idempotency", key)
+	reserved, err := s.redis.SetNX(redisKey, pending, s.pendingTTL())
+	if err != nil || reserved {
+		return nil, err
+	}
+	data, ok, err := s.redis.Get(redisKey)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		// the key expired in between, so the request can run
+		return nil, nil
+	}
+	var response IdempotentResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+	body, err := s.cipher.Decrypt(string(response.Body))
+	if err != nil {
+		return nil, err
+	}
+	response.Body = []byte(body)
+	return kept(response, fingerprint)
+}
+
+func kept(response IdempotentResponse, fingerprint string) (*IdempotentResponse, error) {
+	if response.Fingerprint != fingerprint {
+		return nil, ErrIdempotencyMismatch
+	}
+	if response.Status == 0 {
+		return nil, ErrIdempotencyPending
+	}
+	return &response, nil
+}
+
+// Finish keeps the response of the request that reserved key.
+func (s *IdempotencyStore) Finish(key string, response IdempotentResponse) {
+	if s.redis != nil {
+		response.Body = []byte(s.cipher.Encrypt(string(response.Body)))
+		data, err := json.Marshal(response)
+		if err == nil {
+			err = s.redis.Set(s.redis.Key("idempotency", key), data, s.ttl)
+		}
+		if err != nil {
+			log.Printf("Error keeping the idempotent response: %v", err)
+		}
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = idempotencyEntry{response: response, expires: time.Now().Add(s.ttl)}
+}
+
+// Release frees key for a retry, when its request failed or could not be
+// kept.
+func (s *IdempotencyStore) Release(key string) {
+	if s.redis != nil {
+		if err := s.redis.Del(s.redis.Key("idempotency", key)); err != nil {
+			log.Printf("Error releasing the idempotency key: %v", err)
+		}
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+}
@@ -0,0 +1,255 @@
+package orus
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// ImageHandlePrefix starts the handles of uploaded images. Base64 has
+	// no '_', so a handle is never mistaken for an inline image.
+	ImageHandlePrefix = "img_"
+	// DefaultImageTTL is how long an uploaded image is kept.
+	DefaultImageTTL = time.Hour
+	// DefaultImageMaxDimension is the longest side uploaded images are
+	// scaled down to.
+	DefaultImageMaxDimension = 1024
+
+	// maxImagePixels bounds the decoded size of an upload, so a small file
+	// cannot expand into gigabytes of pixels.
+	maxImagePixels = 40_000_000
+	jpegQuality    = 90
+)
+
+// ErrImageNotFound is returned for a handle that does not exist or expired.
+var ErrImageNotFound = errors.New("the image does not exist or expired")
+
+// StoredImage describes an uploaded image once normalized.
+type StoredImage struct {
+	Handle         string    `json:"handle"`
+	ContentType    string    `json:"content_type"`
+	Width          int       `json:"width"`
+	Height         int       `json:"height"`
+	OriginalWidth  int       `json:"original_width"`
+	OriginalHeight int       `json:"original_height"`
+	Size           int       `json:"size"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+// ImageStore keeps uploaded images in a blob store for a while, so chat
+// requests can reference them by handle instead of inlining them.
+type ImageStore struct {
+	blobs        BlobStore
+	ttl          time.Duration
+	maxDimension int
+}
+
+// NewImageStore keeps the images of config in its directory, or in a
+// directory of the system temporary directory, or in S3 with the s3 blob
+// backend.
+func NewImageStore(config ImagesConfig, blobConfig BlobConfig) (*ImageStore, error) {
+	dir := config.Dir
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "orus-images")
+	}
+	blobs, err := OpenBlobStore(blobConfig, "images", dir)
+	if err != nil {
+		return nil, fmt.Errorf("error creating image store: %w", err)
+	}
+	ttl := config.TTL
+	if ttl <= 0 {
+		ttl = DefaultImageTTL
+	}
+	return &ImageStore{blobs: blobs, ttl: ttl, maxDimension: config.MaxDimension}, nil
+}
+
+// Put validates an image, scales it down to the maximum dimension and
+// stores it re-encoded: as PNG when it has transparency, else as JPEG. WebP
+// images are validated and stored as sent.
+func (s *ImageStore) Put(data []byte) (StoredImage, *ValidationError) {
+	contentType := http.DetectContentType(data)
+	if !isAllowedImageType(contentType) {
+		return StoredImage{}, &ValidationError{Code: "unsupported_image_type", Message: fmt.Sprintf("Unsupported image type %s", contentType)}
+	}
+	stored := StoredImage{Handle: ImageHandlePrefix + strings.ReplaceAll(uuid.New().String(), "-", "")}
+	if contentType == "image/webp" {
+		stored.ContentType = contentType
+	} else {
+		normalized, verr := s.normalize(data, &stored)
+		if verr != nil {
+			return StoredImage{}, verr
+		}
+		data = normalized
+	}
+	if len(data) > MaxImageSize {
+		return StoredImage{}, &ValidationError{Code: "image_too_large", Message: fmt.Sprintf("The image exceeds the %d MB limit", MaxImageSize/(1024*1024))}
+	}
+	stored.Size = len(data)
+	if err := s.blobs.Put(stored.Handle, data, stored.ContentType); err != nil {
+		log.Println("Error storing image: ", err)
+		return StoredImage{}, &ValidationError{Code: "image_store_error", Message: "The image could not be stored"}
+	}
+	stored.ExpiresAt = time.Now().Add(s.ttl)
+	return stored, nil
+}
+
+func (s *ImageStore) normalize(data []byte, stored *StoredImage) ([]byte, *ValidationError) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, &ValidationError{Code: "invalid_image", Message: fmt.Sprintf("The image cannot be decoded: %v", err)}
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return nil, &ValidationError{Code: "image_too_large", Message: fmt.Sprintf("The image has more than %d pixels", maxImagePixels)}
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, &ValidationError{Code: "invalid_image", Message: fmt.Sprintf("The image cannot be decoded: %v", err)}
+	}
+	bounds := decoded.Bounds()
+	stored.OriginalWidth, stored.OriginalHeight = bounds.Dx(), bounds.Dy()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), decoded, bounds.Min, draw.Src)
+	rgba = scaleDown(rgba, s.maxDimension)
+	stored.Width, stored.Height = rgba.Bounds().Dx(), rgba.Bounds().Dy()
+
+	encoded, contentType, err := encodeImage(rgba)
+	if err != nil {
+		return nil, &ValidationError{Code: "invalid_image", Message: fmt.Sprintf("The image cannot be encoded: %v", err)}
+	}
+	stored.ContentType = contentType
+	return encoded, nil
+}
+
+// encodeImage encodes img as PNG when it has transparency, else as JPEG.
+func encodeImage(img *image.RGBA) ([]byte, string, error) {
+	var out bytes.Buffer
+	if img.Opaque() {
+		err := jpeg.Encode(&out, img, &jpeg.Options{Quality: jpegQuality})
+		return out.Bytes(), "image/jpeg", err
+	}
+	err := png.Encode(&out, img)
+	return out.Bytes(), "image/png", err
+}
+
+// scaleDown returns src scaled so its longest side is at most maxDimension,
+// each pixel averaging the source pixels it covers.
+func scaleDown(src *image.RGBA, maxDimension int) *image.RGBA {
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+	if maxDimension <= 0 || (width <= maxDimension && height <= maxDimension) {
+		return src
+	}
+	dstWidth, dstHeight := maxDimension, height*maxDimension/width
+	if height > width {
+		dstWidth, dstHeight = width*maxDimension/height, maxDimension
+	}
+	dstWidth, dstHeight = max(dstWidth, 1), max(dstHeight, 1)
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		y0, y1 := y*height/dstHeight, max((y+1)*height/dstHeight, y*height/dstHeight+1)
+		for x := 0; x < dstWidth; x++ {
+			x0, x1 := x*width/dstWidth, max((x+1)*width/dstWidth, x*width/dstWidth+1)
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					r += int(row[i])
+					g += int(row[i+1])
+					b += int(row[i+2])
+					a += int(row[i+3])
+					n++
+				}
+			}
+			offset := y*dst.Stride + x*4
+			dst.Pix[offset] = uint8(r / n)
+			dst.Pix[offset+1] = uint8(g / n)
+			dst.Pix[offset+2] = uint8(b / n)
+			dst.Pix[offset+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// Get returns the image of handle as base64, as the Ollama API takes it.
+func (s *ImageStore) Get(handle string) (string, error) {
+	if !IsImageHandle(handle) {
+		return "", ErrImageNotFound
+	}
+	info, err := s.blobs.Stat(handle)
+	if err != nil || time.Since(info.Modified) > s.ttl {
+		return "", ErrImageNotFound
+	}
+	data, err := s.blobs.Get(handle)
+	if err != nil {
+		return "", ErrImageNotFound
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// Resolve replaces the handles among images with the images they refer to.
+// A nil store resolves no handle.
+func (s *ImageStore) Resolve(images []string) ([]string, error) {
+	resolved := make([]string, len(images))
+	for i, ref := range images {
+		if !IsImageHandle(ref) {
+			resolved[i] = ref
+			continue
+		}
+		if s == nil {
+			return nil, fmt.Errorf("image %s: %w", ref, ErrImageNotFound)
+		}
+		data, err := s.Get(ref)
+		if err != nil {
+			return nil, fmt.Errorf("image %s: %w", ref, err)
+		}
+		resolved[i] = data
+	}
+	return resolved, nil
+}
+
+// Expire deletes the expired images and returns how many. Expired images
+// are refused before, so it only reclaims their space.
+func (s *ImageStore) Expire() (int, error) {
+	blobs, err := s.blobs.List(ImageHandlePrefix)
+	if err != nil {
+		return 0, err
+	}
+	expired := 0
+	for _, blob := range blobs {
+		if IsImageHandle(blob.Key) && time.Since(blob.Modified) > s.ttl {
+			if err := s.blobs.Delete(blob.Key); err != nil {
+				return expired, err
+			}
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+// IsImageHandle reports whether image is the handle of an uploaded image.
+func IsImageHandle(image string) bool {
+	id, ok := strings.CutPrefix(image, ImageHandlePrefix)
+	if !ok || len(id) != 32 {
+		return false
+	}
+	for _, c := range id {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
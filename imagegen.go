@@ -0,0 +1,434 @@
+package orus
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultImageGenSize  = 1024
+	DefaultImageGenSteps = 20
+	// DefaultOpenAIImageModel is the model of the openai provider when none
+	// is configured.
+	DefaultOpenAIImageModel = "gpt-image-1"
+
+	openAIImagesURL = "https://api.openai.com/v1/images/generations"
+	// imageGenPollInterval is how often the progress of a local generation
+	// is read.
+	imageGenPollInterval = time.Second
+)
+
+// ErrImageGenDisabled is returned when no image generation provider is
+// configured.
+var ErrImageGenDisabled = errors.New("image generation is disabled, set ORUS_API_IMAGE_GEN_PROVIDER")
+
+// ImageGenerationProgress reports a generation while it runs. Step and
+// Steps are only known to the providers that report their sampling.
+type ImageGenerationProgress struct {
+	Status string
+	Step   int
+	Steps  int
+}
+
+// ImageGenerator generates an image from a prompt. progress may be nil.
+type ImageGenerator interface {
+	Generate(ctx context.Context, request ImageGenerationRequest, progress func(ImageGenerationProgress)) ([]byte, error)
+}
+
+// NewImageGenerator returns the generator of the provider of config.
+func NewImageGenerator(config ImageGenConfig) (ImageGenerator, error) {
+	client := &http.Client{}
+	base := strings.TrimSuffix(config.URL, "/")
+	switch config.Provider {
+	case "":
+		return nil, ErrImageGenDisabled
+	case "automatic1111":
+		return &Automatic1111Generator{url: base, model: config.Model, client: client}, nil
+	case "comfyui":
+		return &ComfyUIGenerator{url: base, workflow: config.Workflow, model: config.Model, client: client}, nil
+	case "openai":
+		generator := &OpenAIImageGenerator{url: openAIImagesURL, apiKey: config.APIKey, model: config.Model, client: client}
+		if config.URL != "" {
+			generator.url = config.URL
+		}
+		if generator.model == "" {
+			generator.model = DefaultOpenAIImageModel
+		}
+		return generator, nil
+	default:
+		return nil, fmt.Errorf("unknown image generation provider %q, expected automatic1111, comfyui or openai", config.Provider)
+	}
+}
+
+// Automatic1111Generator generates with the txt2img API of a Stable
+// Diffusion web UI started with --api, reporting its sampling steps.
+type Automatic1111Generator struct {
+	url    string
+	model  string
+	client *http.Client
+}
+
+func (g *Automatic1111Generator) Generate(ctx context.Context, request ImageGenerationRequest, progress func(ImageGenerationProgress)) ([]byte, error) {
+	body := map[string]interface{}{
+		"prompt":          request.Prompt,
+		"negative_prompt": request.NegativePrompt,
+		"width":           request.Width,
+		"height":          request.Height,
+		"steps":           request.Steps,
+		"seed":            -1,
+	}
+	if request.Seed != nil {
+		body["seed"] = *request.Seed
+	}
+	if model := cmp.Or(request.Model, g.model); model != "" {
+		body["override_settings"] = map[string]string{"sd_model_checkpoint": model}
+	}
+
+	if progress != nil {
+		progress(ImageGenerationProgress{Status: "queued", Steps: request.Steps})
+		done := make(chan struct{})
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.watch(ctx, done, progress)
+		}()
+		defer wg.Wait()
+		defer close(done)
+	}
+
+	var answer struct {
+		Images []string `json:"images"`
+	}
+	if err := postImageJSON(ctx, g.client, g.url+"/sdapi/v1/txt2img", nil, body, &answer); err != nil {
+		return nil, err
+	}
+	if len(answer.Images) == 0 {
+		return nil, fmt.Errorf("automatic1111 returned no image")
+	}
+	return base64.StdEncoding.DecodeString(answer.Images[0])
+}
+
+// watch reports the sampling steps of the running generation until done.
+func (g *Automatic1111Generator) watch(ctx context.Context, done <-chan struct{}, progress func(ImageGenerationProgress)) {
+	ticker := time.NewTicker(imageGenPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, g.url+"/sdapi/v1/progress?skip_current_image=true", nil)
+		if err != nil {
+			return
+		}
+		var state struct {
+			State struct {
+				SamplingStep  int `json:"sampling_step"`
+				SamplingSteps int `json:"sampling_steps"`
+			} `json:"state"`
+		}
+		if err := doImageRequest(g.client, request, &state); err != nil {
+			continue
+		}
+		progress(ImageGenerationProgress{
+			Status: "generating",
+			Step:   state.State.SamplingStep,
+			Steps:  state.State.SamplingSteps,
+		})
+	}
+}
+
+// ComfyUIGenerator queues a workflow, exported from ComfyUI in the API
+// format, and waits for its first output image. The strings {{prompt}},
+// {{negative_prompt}} and {{model}} of the workflow are replaced by the
+// request, and the values "{{width}}", "{{height}}", "{{steps}}" and
+// "{{seed}}" by numbers.
+type ComfyUIGenerator struct {
+	url      string
+	workflow string
+	model    string
+	client   *http.Client
+}
+
+func (g *ComfyUIGenerator) Generate(ctx context.Context, request ImageGenerationRequest, progress func(ImageGenerationProgress)) ([]byte, error) {
+	raw, err := os.ReadFile(g.workflow)
+	if err != nil {
+		return nil, fmt.Errorf("error reading ComfyUI workflow: %w", err)
+	}
+	var graph interface{}
+	if err := json.Unmarshal(raw, &graph); err != nil {
+		return nil, fmt.Errorf("error parsing ComfyUI workflow: %w", err)
+	}
+	seed := rand.Int64N(1 << 48)
+	if request.Seed != nil {
+		seed = *request.Seed
+	}
+	graph = fillWorkflow(graph, map[string]string{
+		"{{prompt}}":          request.Prompt,
+		"{{negative_prompt}}": request.NegativePrompt,
+		"{{model}}":           cmp.Or(request.Model, g.model),
+	}, map[string]int64{
+		"{{width}}":  int64(request.Width),
+		"{{height}}": int64(request.Height),
+		"{{steps}}":  int64(request.Steps),
+		"{{seed}}":   seed,
+	})
+
+	var queued struct {
+		PromptID string `json:"prompt_id"`
+	}
+	body := map[string]interface{}{"prompt": graph, "client_id": uuid.New().String()}
+	if err := postImageJSON(ctx, g.client, g.url+"/prompt", nil, body, &queued); err != nil {
+		return nil, err
+	}
+	if progress != nil {
+		progress(ImageGenerationProgress{Status: "queued"})
+	}
+
+	ticker := time.NewTicker(imageGenPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+		poll, err := http.NewRequestWithContext(ctx, http.MethodGet, g.url+"/history/"+url.PathEscape(queued.PromptID), nil)
+		if err != nil {
+			return nil, fmt.Errorf("error creating request: %w", err)
+		}
+		var history map[string]struct {
+			Status struct {
+				StatusStr string `json:"status_str"`
+				Completed bool   `json:"completed"`
+			} `json:"status"`
+			Outputs map[string]struct {
+				Images []struct {
+					Filename  string `json:"filename"`
+					Subfolder string `json:"subfolder"`
+					Type      string `json:"type"`
+				} `json:"images"`
+			} `json:"outputs"`
+		}
+		if err := doImageRequest(g.client, poll, &history); err != nil {
+			return nil, err
+		}
+		entry, ok := history[queued.PromptID]
+		if !ok || (!entry.Status.Completed && entry.Status.StatusStr != "error") {
+			if progress != nil {
+				progress(ImageGenerationProgress{Status: "generating"})
+			}
+			continue
+		}
+		if entry.Status.StatusStr == "error" {
+			return nil, fmt.Errorf("the ComfyUI workflow failed")
+		}
+		for _, output := range entry.Outputs {
+			for _, image := range output.Images {
+				if image.Type == "output" {
+					return g.view(ctx, url.Values{
+						"filename":  {image.Filename},
+						"subfolder": {image.Subfolder},
+						"type":      {image.Type},
+					})
+				}
+			}
+		}
+		return nil, fmt.Errorf("the ComfyUI workflow has no output image")
+	}
+}
+
+func (g *ComfyUIGenerator) view(ctx context.Context, query url.Values) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, g.url+"/view?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	response, err := g.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading image: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ComfyUI answered status %d to the image download", response.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(response.Body, MaxBodySize))
+}
+
+// fillWorkflow replaces the placeholders of a ComfyUI workflow: texts in
+// any string, numbers in the strings that are only the placeholder.
+func fillWorkflow(value interface{}, texts map[string]string, numbers map[string]int64) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = fillWorkflow(item, texts, numbers)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = fillWorkflow(item, texts, numbers)
+		}
+	case string:
+		if number, ok := numbers[v]; ok {
+			return number
+		}
+		for placeholder, text := range texts {
+			v = strings.ReplaceAll(v, placeholder, text)
+		}
+		return v
+	}
+	return value
+}
+
+// OpenAIImageGenerator generates with the OpenAI images API, or a
+// compatible one, which reports no progress.
+type OpenAIImageGenerator struct {
+	url    string
+	apiKey Secret
+	model  string
+	client *http.Client
+}
+
+func (g *OpenAIImageGenerator) Generate(ctx context.Context, request ImageGenerationRequest, progress func(ImageGenerationProgress)) ([]byte, error) {
+	model := cmp.Or(request.Model, g.model)
+	body := map[string]interface{}{
+		"model":  model,
+		"prompt": request.Prompt,
+		"size":   fmt.Sprintf("%dx%d", request.Width, request.Height),
+		"n":      1,
+	}
+	// the dall-e models answer a URL unless asked for base64, which the
+	// gpt-image models always answer
+	if strings.HasPrefix(model, "dall-e") {
+		body["response_format"] = "b64_json"
+	}
+	if progress != nil {
+		progress(ImageGenerationProgress{Status: "generating"})
+	}
+	var answer struct {
+		Data []struct {
+			B64JSON string `json:"b64_json"`
+		} `json:"data"`
+	}
+	headers := map[string]string{"Authorization": "Bearer " + g.apiKey.Reveal()}
+	if err := postImageJSON(ctx, g.client, g.url, headers, body, &answer); err != nil {
+		return nil, err
+	}
+	if len(answer.Data) == 0 || answer.Data[0].B64JSON == "" {
+		return nil, fmt.Errorf("the image API returned no image")
+	}
+	return base64.StdEncoding.DecodeString(answer.Data[0].B64JSON)
+}
+
+func postImageJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, body, answer interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+	return doImageRequest(client, request, answer)
+}
+
+func doImageRequest(client *http.Client, request *http.Request, answer interface{}) error {
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("error generating image: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return fmt.Errorf("image generation answered status %d: %s", response.StatusCode, body)
+	}
+	if err := json.NewDecoder(response.Body).Decode(answer); err != nil {
+		return fmt.Errorf("error decoding image generation response: %w", err)
+	}
+	return nil
+}
+
+const (
+	// MaxImageGenSize is the longest side of a generated image.
+	MaxImageGenSize  = 2048
+	MaxImageGenSteps = 150
+)
+
+// ImageGenerationRequest is the body of an image generation.
+type ImageGenerationRequest struct {
+	Prompt         string `json:"prompt" swaggertype:"string" example:"A lighthouse on a cliff at dawn, oil painting"`
+	NegativePrompt string `json:"negative_prompt" swaggertype:"string" example:"blurry, text"`
+	// Model overrides the model of ORUS_API_IMAGE_GEN_MODEL.
+	Model  string `json:"model" swaggertype:"string" example:"sd_xl_base_1.0"`
+	Width  int    `json:"width" swaggertype:"integer" example:"1024"`
+	Height int    `json:"height" swaggertype:"integer" example:"1024"`
+	Steps  int    `json:"steps" swaggertype:"integer" example:"20"`
+	// Seed makes a local generation reproducible; it is random when unset.
+	Seed *int64 `json:"seed,omitempty" swaggertype:"integer" example:"42"`
+	// Output is "base64" (the default), "handle" to store the image as an
+	// upload usable in vision chats, or "raw" to answer the image itself.
+	Output string `json:"output" swaggertype:"string" example:"base64"`
+	// Stream reports the progress as events, then the image in the done
+	// event.
+	Stream bool `json:"stream" swaggertype:"boolean" example:"false"`
+}
+
+func (r *ImageGenerationRequest) Validate() *ValidationError {
+	if strings.TrimSpace(r.Prompt) == "" {
+		return &ValidationError{Code: "missing_prompt", Field: "prompt", Message: "Field 'prompt' is required"}
+	}
+	for _, field := range []struct {
+		name  string
+		value *int
+	}{{"width", &r.Width}, {"height", &r.Height}} {
+		if *field.value == 0 {
+			*field.value = DefaultImageGenSize
+		}
+		if *field.value < 64 || *field.value > MaxImageGenSize || *field.value%8 != 0 {
+			return &ValidationError{Code: "invalid_" + field.name, Field: field.name,
+				Message: fmt.Sprintf("Field '%s' must be a multiple of 8 between 64 and %d", field.name, MaxImageGenSize)}
+		}
+	}
+	if r.Steps == 0 {
+		r.Steps = DefaultImageGenSteps
+	}
+	if r.Steps < 1 || r.Steps > MaxImageGenSteps {
+		return &ValidationError{Code: "invalid_steps", Field: "steps", Message: fmt.Sprintf("Field 'steps' must be between 1 and %d", MaxImageGenSteps)}
+	}
+	if r.Seed != nil && *r.Seed < 0 {
+		return &ValidationError{Code: "invalid_seed", Field: "seed", Message: "Field 'seed' must not be negative"}
+	}
+	switch r.Output {
+	case "":
+		r.Output = "base64"
+	case "base64", "handle":
+	case "raw":
+		if r.Stream {
+			return &ValidationError{Code: "invalid_output", Field: "output", Message: "A streamed image cannot be answered raw"}
+		}
+	default:
+		return &ValidationError{Code: "invalid_output", Field: "output", Message: "Field 'output' must be base64, handle or raw"}
+	}
+	return nil
+}
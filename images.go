@@ -0,0 +1,165 @@
+package orus
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/draw"
+	"net/http"
+	"strings"
+)
+
+const (
+	MaxImageSize = 4 * 1024 * 1024 // 4MB decoded, so a few images fit in MaxBodySize once base64 encoded
+	MaxImages    = 4
+)
+
+// AllowedImageTypes are the MIME types accepted by the Ollama vision models.
+var AllowedImageTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp"}
+
+// ValidateImages checks the count, size and content type of base64 images,
+// which may be sent as data URLs, and returns them as plain base64. Handles
+// of uploaded images are returned as they are.
+func ValidateImages(images []string) ([]string, *ValidationError) {
+	if len(images) > MaxImages {
+		return nil, &ValidationError{
+			Code:    "too_many_images",
+			Message: fmt.Sprintf("At most %d images can be attached", MaxImages),
+		}
+	}
+	validated := make([]string, 0, len(images))
+	for i, image := range images {
+		// uploaded images are resolved by the handler
+		if IsImageHandle(image) {
+			validated = append(validated, image)
+			continue
+		}
+		encoded := image
+		if strings.HasPrefix(encoded, "data:") {
+			comma := strings.Index(encoded, ",")
+			if comma < 0 || !strings.HasSuffix(encoded[:comma], ";base64") {
+				return nil, &ValidationError{
+					Code:    "invalid_image",
+					Message: fmt.Sprintf("Image %d is not a base64 data URL", i+1),
+				}
+			}
+			encoded = encoded[comma+1:]
+		}
+		if base64.StdEncoding.DecodedLen(len(encoded)) > MaxImageSize+2 {
+			return nil, &ValidationError{
+				Code:    "image_too_large",
+				Message: fmt.Sprintf("Image %d exceeds the %d MB limit", i+1, MaxImageSize/(1024*1024)),
+			}
+		}
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, &ValidationError{
+				Code:    "invalid_image",
+				Message: fmt.Sprintf("Image %d is not valid base64: %v", i+1, err),
+			}
+		}
+		if len(data) > MaxImageSize {
+			return nil, &ValidationError{
+				Code:    "image_too_large",
+				Message: fmt.Sprintf("Image %d exceeds the %d MB limit", i+1, MaxImageSize/(1024*1024)),
+			}
+		}
+		contentType := http.DetectContentType(data)
+		if !isAllowedImageType(contentType) {
+			return nil, &ValidationError{
+				Code:    "unsupported_image_type",
+				Message: fmt.Sprintf("Image %d has unsupported type %s", i+1, contentType),
+			}
+		}
+		if verr := checkImage(i+1, contentType, data); verr != nil {
+			return nil, verr
+		}
+		validated = append(validated, encoded)
+	}
+	return validated, nil
+}
+
+// checkImage reads the header of an image, so a truncated or mislabeled
+// file fails here rather than in the model. WebP images cannot be decoded
+// and are taken on their signature.
+func checkImage(n int, contentType string, data []byte) *ValidationError {
+	if contentType == "image/webp" {
+		return nil
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return &ValidationError{
+			Code:    "invalid_image",
+			Message: fmt.Sprintf("Image %d is not a valid %s: %v", n, strings.TrimPrefix(contentType, "image/"), err),
+		}
+	}
+	if config.Width == 0 || config.Height == 0 {
+		return &ValidationError{
+			Code:    "invalid_image",
+			Message: fmt.Sprintf("Image %d is an empty %s", n, format),
+		}
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return &ValidationError{
+			Code:    "image_too_large",
+			Message: fmt.Sprintf("Image %d has %dx%d pixels, more than %d", n, config.Width, config.Height, maxImagePixels),
+		}
+	}
+	return nil
+}
+
+// DefaultModelImageDimensions are the longest sides taken by the vision
+// models whose encoders work at a fixed resolution; larger images only
+// cost transfer and preprocessing.
+func DefaultModelImageDimensions() map[string]int {
+	return map[string]int{
+		"llava":           672,
+		"llama3.2-vision": 1120,
+		"gemma3":          896,
+	}
+}
+
+// FitImages scales the base64 images whose longest side exceeds
+// maxDimension down to it, re-encoded as JPEG or, with transparency, as
+// PNG. The other images, the WebP images and all of them when maxDimension
+// is 0 are returned as they are.
+func FitImages(images []string, maxDimension int) ([]string, *ValidationError) {
+	if maxDimension <= 0 {
+		return images, nil
+	}
+	fitted := make([]string, len(images))
+	for i, encoded := range images {
+		fitted[i] = encoded
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, &ValidationError{Code: "invalid_image", Message: fmt.Sprintf("Image %d is not valid base64: %v", i+1, err)}
+		}
+		config, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil || (config.Width <= maxDimension && config.Height <= maxDimension) {
+			continue
+		}
+		decoded, format, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, &ValidationError{Code: "invalid_image", Message: fmt.Sprintf("Image %d is not a valid %s: %v", i+1, format, err)}
+		}
+		bounds := decoded.Bounds()
+		rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), decoded, bounds.Min, draw.Src)
+		scaled, _, err := encodeImage(scaleDown(rgba, maxDimension))
+		if err != nil {
+			return nil, &ValidationError{Code: "invalid_image", Message: fmt.Sprintf("Image %d cannot be encoded: %v", i+1, err)}
+		}
+		fitted[i] = base64.StdEncoding.EncodeToString(scaled)
+	}
+	return fitted, nil
+}
+
+func isAllowedImageType(contentType string) bool {
+	for _, allowed := range AllowedImageTypes {
+		if contentType == allowed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,203 @@
+package orus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrUnsupportedDocument is returned for a file that is neither text, a PDF
+// nor an image.
+var ErrUnsupportedDocument = errors.New("unsupported document type, expected text, PDF or an image")
+
+const (
+	// minMediaDimension skips the images too small to be figures, such as
+	// icons and rules.
+	minMediaDimension = 64
+	maxDocumentImages = 32
+)
+
+// Extraction is the text read from an ingested file.
+type Extraction struct {
+	Text        string `json:"-"`
+	ContentType string `json:"content_type"`
+	Pages       int    `json:"pages"`
+	// OCRPages are the pages, numbered from 1, whose text was recognized by
+	// OCR because they had none.
+	OCRPages []int `json:"ocr_pages"`
+	// PageTexts is the text of every page.
+	PageTexts []string `json:"-"`
+	// Images are the figures of the document, when they were requested.
+	Images []ExtractedImage `json:"-"`
+}
+
+// ExtractedImage is an image found on a page of a document.
+type ExtractedImage struct {
+	Page int
+	Data []byte
+}
+
+// ExtractText reads the text of a document for indexing. Text files are
+// taken as they are and images are read by OCR. The text layer of a PDF is
+// extracted with pdftotext, and its pages without text, which are scans,
+// are rendered with pdftoppm and read by OCR. With withImages the figures
+// of a PDF are extracted with pdfimages, and an image file is kept as a
+// figure besides its text.
+func (o *Orus) ExtractText(ctx context.Context, config OCRConfig, data []byte, withImages bool) (*Extraction, error) {
+	contentType := http.DetectContentType(data)
+	extraction := &Extraction{ContentType: contentType, OCRPages: make([]int, 0)}
+	switch {
+	case strings.HasPrefix(contentType, "text/"):
+		if !utf8.Valid(data) {
+			return nil, fmt.Errorf("the text is not valid UTF-8")
+		}
+		extraction.ContentType = "text/plain"
+		extraction.Text = string(data)
+		extraction.Pages = 1
+		extraction.PageTexts = []string{extraction.Text}
+		return extraction, nil
+	case isAllowedImageType(contentType):
+		extraction.Pages = 1
+		extraction.PageTexts = []string{""}
+		if withImages {
+			extraction.Images = []ExtractedImage{{Page: 1, Data: data}}
+		}
+		engine, err := NewOCREngine(o, config)
+		if errors.Is(err, ErrOCRDisabled) && withImages {
+			return extraction, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		text, err := engine.Recognize(ctx, data)
+		if err != nil {
+			return nil, err
+		}
+		extraction.Text = text
+		extraction.PageTexts[0] = text
+		extraction.OCRPages = append(extraction.OCRPages, 1)
+		return extraction, nil
+	case contentType == "application/pdf":
+		return o.extractPDF(ctx, config, data, extraction, withImages)
+	}
+	return nil, ErrUnsupportedDocument
+}
+
+func (o *Orus) extractPDF(ctx context.Context, config OCRConfig, data []byte, extraction *Extraction, withImages bool) (*Extraction, error) {
+	dir, err := os.MkdirTemp("", "orus-ingest-")
+	if err != nil {
+		return nil, fmt.Errorf("error creating temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "document.pdf")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return nil, fmt.Errorf("error writing document: %w", err)
+	}
+
+	output, err := runCommand(ctx, nil, "pdftotext", "-layout", "-enc", "UTF-8", path, "-")
+	if err != nil {
+		return nil, err
+	}
+	// pdftotext ends every page with a form feed
+	pages := strings.Split(strings.TrimSuffix(string(output), "\f"), "\f")
+	extraction.Pages = len(pages)
+
+	var engine OCREngine
+	for n, page := range pages {
+		if len(strings.Join(strings.Fields(page), "")) >= config.MinChars {
+			continue
+		}
+		if engine == nil {
+			if engine, err = NewOCREngine(o, config); err != nil {
+				if errors.Is(err, ErrOCRDisabled) {
+					break
+				}
+				return nil, err
+			}
+		}
+		number := strconv.Itoa(n + 1)
+		root := filepath.Join(dir, "page-"+number)
+		_, err := runCommand(ctx, nil, "pdftoppm", "-f", number, "-l", number, "-r", strconv.Itoa(config.DPI),
+			"-png", "-singlefile", path, root)
+		if err != nil {
+			return nil, err
+		}
+		image, err := os.ReadFile(root + ".png")
+		if err != nil {
+			return nil, fmt.Errorf("error reading page %d: %w", n+1, err)
+		}
+		text, err := engine.Recognize(ctx, image)
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %w", n+1, err)
+		}
+		pages[n] = text
+		extraction.OCRPages = append(extraction.OCRPages, n+1)
+	}
+
+	sb := &strings.Builder{}
+	for n, page := range pages {
+		pages[n] = strings.TrimSpace(page)
+		if pages[n] != "" {
+			sb.WriteString(pages[n])
+			sb.WriteString("\n\n")
+		}
+	}
+	extraction.Text = sb.String()
+	extraction.PageTexts = pages
+	if withImages {
+		// a document whose figures cannot be extracted is still indexed by
+		// its text
+		images, err := extractPDFImages(ctx, dir, path)
+		if err != nil {
+			log.Println("Error extracting the images of a document: ", err)
+		}
+		extraction.Images = images
+	}
+	return extraction, nil
+}
+
+// extractPDFImages extracts the figures of the PDF at path with pdfimages,
+// in page order, skipping the images too small to be figures.
+func extractPDFImages(ctx context.Context, dir, path string) ([]ExtractedImage, error) {
+	root := filepath.Join(dir, "image")
+	if _, err := runCommand(ctx, nil, "pdfimages", "-png", "-p", path, root); err != nil {
+		return nil, err
+	}
+	// with -p the images are named image-<page>-<number>.png
+	names, err := filepath.Glob(root + "-*.png")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	images := make([]ExtractedImage, 0)
+	for _, name := range names {
+		if len(images) == maxDocumentImages {
+			break
+		}
+		fields := strings.Split(strings.TrimPrefix(filepath.Base(name), "image-"), "-")
+		page, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("error reading image: %w", err)
+		}
+		size, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil || size.Width < minMediaDimension || size.Height < minMediaDimension {
+			continue
+		}
+		images = append(images, ExtractedImage{Page: page, Data: data})
+	}
+	return images, nil
+}
@@ -0,0 +1,173 @@
+package orus
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const DefaultJanitorInterval = time.Minute
+
+// The reasons an entry is evicted, as the metrics label them.
+const (
+	// EvictExpired is an entry past its TTL.
+	EvictExpired = "expired"
+	// EvictCapacity is the least recently used entry of a full cache.
+	EvictCapacity = "capacity"
+	// EvictIdle is a session without a new turn for the session TTL.
+	EvictIdle = "idle"
+)
+
+type JanitorConfig struct {
+	// Interval is how often the janitor removes what expired; 0 disables
+	// it, so the caches and stores only drop an expired entry when it is
+	// read again.
+	Interval time.Duration `yaml:"interval"`
+	// SessionTTL is how long a session is kept after its last change; 0
+	// keeps them. It is read on every run, so it is reloaded.
+	SessionTTL time.Duration `yaml:"session_ttl"`
+}
+
+// EvictionCount is how many entries of a store were evicted for a reason
+// since the server started.
+type EvictionCount struct {
+	Store  string `json:"store" swaggertype:"string" example:"response_cache"`
+	Reason string `json:"reason" swaggertype:"string" example:"expired"`
+	Count  int64  `json:"count" swaggertype:"integer" example:"42"`
+}
+
+type evictionKey struct {
+	store, reason string
+}
+
+// Evictions counts the entries removed from the caches and stores, by
+// store and reason. The methods of a nil Evictions are no-ops.
+type Evictions struct {
+	mu     sync.Mutex
+	counts map[evictionKey]int64
+}
+
+func NewEvictions() *Evictions {
+	return &Evictions{counts: make(map[evictionKey]int64)}
+}
+
+// Add counts n entries of store evicted for reason.
+func (e *Evictions) Add(store, reason string, n int) {
+	if e == nil || n <= 0 {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.counts[evictionKey{store, reason}] += int64(n)
+}
+
+// Snapshot returns the counts by store and reason.
+func (e *Evictions) Snapshot() []EvictionCount {
+	counts := make([]EvictionCount, 0)
+	if e == nil {
+		return counts
+	}
+	e.mu.Lock()
+	for key, count := range e.counts {
+		counts = append(counts, EvictionCount{Store: key.store, Reason: key.reason, Count: count})
+	}
+	e.mu.Unlock()
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Store != counts[j].Store {
+			return counts[i].Store < counts[j].Store
+		}
+		return counts[i].Reason < counts[j].Reason
+	})
+	return counts
+}
+
+// WritePrometheus writes the counts in the Prometheus text format.
+func (e *Evictions) WritePrometheus(w io.Writer) error {
+	out := &bytes.Buffer{}
+	fmt.Fprintf(out, "# HELP orus_evictions_total Entries removed from the caches and stores.\n# TYPE orus_evictions_total counter\n")
+	for _, count := range e.Snapshot() {
+		fmt.Fprintf(out, "orus_evictions_total{store=%s,reason=%s} %d\n",
+			prometheusLabel(count.Store), prometheusLabel(count.Reason), count.Count)
+	}
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// JanitorRun is what a run of the janitor removed.
+type JanitorRun struct {
+	StartedAt time.Time      `json:"started_at" swaggertype:"string" example:"2021-01-01T00:00:00Z"`
+	Duration  time.Duration  `json:"duration" swaggertype:"integer" example:"1500000"`
+	Removed   map[string]int `json:"removed" swaggertype:"object"`
+	Errors    []string       `json:"errors,omitempty" swaggertype:"array"`
+}
+
+// Janitor removes, every interval, the expired entries of the response and
+// embedding caches, the expired idempotency keys and uploaded images, and
+// the sessions idle for the session TTL, so they do not grow without bound
+// between reads.
+type Janitor struct {
+	orus *Orus
+	mu   sync.Mutex
+	last *JanitorRun
+}
+
+func NewJanitor(orus *Orus) *Janitor {
+	return &Janitor{orus: orus}
+}
+
+// Run removes what expired once and returns what it removed.
+func (j *Janitor) Run() JanitorRun {
+	s := j.orus
+	run := JanitorRun{StartedAt: time.Now().UTC(), Removed: make(map[string]int)}
+	run.Removed["response_cache"] = s.ResponseCache.Expire()
+	run.Removed["embedding_cache"] = s.EmbeddingCache.Expire()
+	run.Removed["idempotency"] = s.Idempotency.Expire()
+	if s.Images != nil {
+		removed, err := s.Images.Expire()
+		if err != nil {
+			run.Errors = append(run.Errors, fmt.Sprintf("images: %v", err))
+		}
+		s.Evictions.Add("images", EvictExpired, removed)
+		run.Removed["images"] = removed
+	}
+	if ttl := s.CurrentConfig().Janitor.SessionTTL; ttl > 0 {
+		ids, err := s.Sessions.DeleteIdle(run.StartedAt.Add(-ttl))
+		if err != nil {
+			run.Errors = append(run.Errors, fmt.Sprintf("sessions: %v", err))
+		}
+		for _, id := range ids {
+			s.SessionIndex.Remove(id)
+		}
+		s.Evictions.Add("sessions", EvictIdle, len(ids))
+		run.Removed["sessions"] = len(ids)
+	}
+	run.Duration = time.Since(run.StartedAt)
+	j.mu.Lock()
+	j.last = &run
+	j.mu.Unlock()
+	return run
+}
+
+// RunEvery runs the janitor every interval, until the process exits.
+func (j *Janitor) RunEvery(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	for range time.Tick(interval) {
+		run := j.Run()
+		for _, err := range run.Errors {
+			log.Printf("Error removing expired entries, %s", err)
+		}
+	}
+}
+
+// LastRun returns the latest run, or nil before the first.
+func (j *Janitor) LastRun() *JanitorRun {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.last
+}
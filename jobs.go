@@ -0,0 +1,62 @@
+package orus
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultJobRetention is how long the state of a finished job is kept.
+	DefaultJobRetention = 7 * 24 * time.Hour
+	// maxMemoryJobs bounds the jobs a MemoryJobStore keeps, the oldest
+	// forgotten first.
+	maxMemoryJobs = 1000
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
+// JobStore keeps the state of the jobs run in the background for a callback
+// URL, so a caller whose callback was lost can still get the result.
+type JobStore interface {
+	// Save stores the state of the job of payload.ID, replacing the one
+	// saved before.
+	Save(payload WebhookPayload) error
+	// Get returns the last state saved for the job id, or ErrJobNotFound.
+	Get(id string) (*WebhookPayload, error)
+}
+
+// MemoryJobStore keeps the state of the last jobs in memory.
+type MemoryJobStore struct {
+	mu    sync.Mutex
+	jobs  map[string]WebhookPayload
+	order []string
+}
+
+func NewMemoryJobStore() *MemoryJobStore {
+	return &MemoryJobStore{jobs: make(map[string]WebhookPayload)}
+}
+
+func (s *MemoryJobStore) Save(payload WebhookPayload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[payload.ID]; !ok {
+		s.order = append(s.order, payload.ID)
+		if len(s.order) > maxMemoryJobs {
+			delete(s.jobs, s.order[0])
+			s.order = s.order[1:]
+		}
+	}
+	s.jobs[payload.ID] = payload
+	return nil
+}
+
+func (s *MemoryJobStore) Get(id string) (*WebhookPayload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	payload, ok := s.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return &payload, nil
+}
@@ -0,0 +1,600 @@
+package orus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultStorageCompactInterval is how often an embedded key-value storage
+// reclaims the space of the values deleted or replaced.
+const DefaultStorageCompactInterval = time.Hour
+
+// ErrStorageFull is the answer to a write that would grow a storage past
+// its size limit. Removals are still accepted, so space can be freed.
+var ErrStorageFull = errors.New("storage is full")
+
+// kvDeleteBatch is how many keys a transaction removing a prefix deletes, or
+// re-encrypting the documents writes, so it stays within the transaction
+// limits of the engines.
+const kvDeleteBatch = 1000
+
+// errKVBatchFull stops a scan once a batch is read.
+var errKVBatchFull = errors.New("batch full")
+
+// kvEngines opens the embedded key-value databases by storage driver. Like
+// the SQL drivers they are linked in with the storage_<driver> build tags.
+var kvEngines = map[string]func(path string) (kvEngine, error){}
+
+// kvEngine is an embedded key-value database. Its transactions see a
+// consistent snapshot, and the writes of an Update are applied together or
+// not at all.
+type kvEngine interface {
+	View(do func(tx kvReader) error) error
+	Update(do func(tx kvWriter) error) error
+	// Size is the disk space used by the database, in bytes.
+	Size() (int64, error)
+	// Compact reclaims the space of the values deleted or replaced.
+	Compact() error
+	Close() error
+}
+
+type kvReader interface {
+	// Get returns the value of key, and false when it does not exist.
+	Get(key []byte) ([]byte, bool, error)
+	// Scan calls each with the keys starting with prefix in order, from
+	// start on when it is set. The key and value are the caller's.
+	Scan(prefix, start []byte, each func(key, value []byte) error) error
+}
+
+type kvWriter interface {
+	kvReader
+	Set(key, value []byte) error
+	Delete(key []byte) error
+}
+
+// KVStore keeps the indexed documents and the state of the jobs of a single
+// server in an embedded key-value database, such as Badger or Bolt, for
+// installs without a database server. Writes are refused with
+// ErrStorageFull once the database reaches its size limit. The layout of its
+// keys is migrated when it is opened, as the Migrate setting allows.
+type KVStore struct {
+	engine  kvEngine
+	maxSize int64
+	// cipher encrypts the content of the documents; nil keeps it in plain
+	// text.
+	cipher *Cipher
+	// mu serializes the writes, so the transactions never conflict.
+	mu sync.Mutex
+}
+
+// IsKVStorage reports whether driver is an embedded key-value storage
+// rather than a SQL database.
+func IsKVStorage(driver string) bool {
+	return driver == "badger" || driver == "bolt"
+}
+
+func OpenKVStore(config StorageConfig) (*KVStore, error) {
+	s, err := openKVStore(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrateOnOpen(s, config.Migrate); err != nil {
+		s.Close()
+		return nil, err
+	}
+	if s.cipher, err = NewCipher(config.Encryption); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// openKVStore opens the database of config without migrating it.
+func openKVStore(config StorageConfig) (*KVStore, error) {
+	if !IsKVStorage(config.Driver) {
+		return nil, fmt.Errorf("unknown storage driver %q, expected badger or bolt", config.Driver)
+	}
+	open, ok := kvEngines[config.Driver]
+	if !ok {
+		return nil, fmt.Errorf("storage driver %q is not compiled in, build with -tags storage_%s", config.Driver, config.Driver)
+	}
+	engine, err := open(config.DSN.Reveal())
+	if err != nil {
+		return nil, fmt.Errorf("error opening storage database: %w", err)
+	}
+	return &KVStore{engine: engine, maxSize: int64(config.MaxSize) << 20}, nil
+}
+
+// update runs do in a write transaction. grow tells whether the write adds
+// data, which the size limit refuses once it is reached.
+func (s *KVStore) update(grow bool, do func(tx kvWriter) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if grow && s.maxSize > 0 {
+		size, err := s.engine.Size()
+		if err != nil {
+			return err
+		}
+		if size >= s.maxSize {
+			return fmt.Errorf("%w: %d bytes used of %d", ErrStorageFull, size, s.maxSize)
+		}
+	}
+	return s.engine.Update(do)
+}
+
+// Compact removes the state of the jobs finished before the job retention
+// and reclaims the space of the values deleted or replaced.
+func (s *KVStore) Compact() error {
+	before := time.Now().Add(-DefaultJobRetention)
+	if err := s.update(false, func(tx kvWriter) error {
+		expired := make([][]byte, 0)
+		err := tx.Scan([]byte(kvJobPrefix), nil, func(key, value []byte) error {
+			var payload WebhookPayload
+			if err := json.Unmarshal(value, &payload); err != nil {
+				expired = append(expired, key)
+				return nil
+			}
+			// a job its server stopped running never finishes
+			finished := payload.FinishedAt
+			if finished.IsZero() {
+				finished = payload.StartedAt
+			}
+			if finished.Before(before) {
+				expired = append(expired, key)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range expired {
+			if err := tx.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("error removing expired jobs: %w", err)
+	}
+	return s.engine.Compact()
+}
+
+// CompactEvery compacts the store every interval, until the process exits.
+func (s *KVStore) CompactEvery(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	for range time.Tick(interval) {
+		if err := s.Compact(); err != nil {
+			log.Printf("Error compacting the storage: %v", err)
+		}
+	}
+}
+
+// Size is the disk space used by the store, in bytes.
+func (s *KVStore) Size() (int64, error) {
+	return s.engine.Size()
+}
+
+// kvMigration is a step of the layout of the keys of a KVStore, applied by up
+// and reverted by down. A step may take several transactions, and the
+// version is recorded after it, so a step must be safe to run again after
+// an interruption.
+type kvMigration struct {
+	version int
+	name    string
+	up      func(s *KVStore) error
+	down    func(s *KVStore) error
+}
+
+var kvStoreMigrations = []kvMigration{
+	// the keys of the documents and jobs are written as they come, so the
+	// first layout only has to be recorded
+	{1, "documents and jobs", nil, func(s *KVStore) error {
+		return s.deletePrefix(kvRevisionPrefix, kvSourcePrefix, kvChangePrefix, kvChunkPrefix, kvJobPrefix)
+	}},
+}
+
+// kvMigrations lists the migrations of a KVStore.
+func kvMigrations() []Migration {
+	migrations := make([]Migration, len(kvStoreMigrations))
+	for i, migration := range kvStoreMigrations {
+		migrations[i] = Migration{Version: migration.version, Name: migration.name}
+	}
+	return migrations
+}
+
+// schemaVersion returns the version of the last migration applied to the
+// store, 0 for a new one.
+func (s *KVStore) schemaVersion() (int, error) {
+	var version int
+	err := s.engine.View(func(tx kvReader) error {
+		data, ok, err := tx.Get([]byte(kvSchemaKey))
+		if err != nil || !ok {
+			return err
+		}
+		version = int(binary.BigEndian.Uint64(data))
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error reading schema version: %w", err)
+	}
+	return version, nil
+}
+
+func (s *KVStore) setSchemaVersion(version int) error {
+	return s.update(false, func(tx kvWriter) error {
+		return tx.Set([]byte(kvSchemaKey), kvRevision(int64(version)))
+	})
+}
+
+func (s *KVStore) Plan(target int) (MigrationPlan, error) {
+	current, err := s.schemaVersion()
+	if err != nil {
+		return MigrationPlan{}, err
+	}
+	return planMigrations(kvMigrations(), current, target)
+}
+
+// Migrate applies or reverts the migrations bringing the store to target.
+func (s *KVStore) Migrate(target int) (MigrationPlan, error) {
+	plan, err := s.Plan(target)
+	if err != nil {
+		return plan, err
+	}
+	for _, migration := range kvStoreMigrations {
+		if migration.version <= plan.Current || migration.version > plan.Target {
+			continue
+		}
+		if migration.up != nil {
+			if err := migration.up(s); err != nil {
+				return plan, fmt.Errorf("error applying migration %d (%s): %w", migration.version, migration.name, err)
+			}
+		}
+		if err := s.setSchemaVersion(migration.version); err != nil {
+			return plan, err
+		}
+	}
+	for i := len(kvStoreMigrations) - 1; i >= 0; i-- {
+		migration := kvStoreMigrations[i]
+		if migration.version > plan.Current || migration.version <= plan.Target {
+			continue
+		}
+		if migration.down != nil {
+			if err := migration.down(s); err != nil {
+				return plan, fmt.Errorf("error reverting migration %d (%s): %w", migration.version, migration.name, err)
+			}
+		}
+		previous := 0
+		if i > 0 {
+			previous = kvStoreMigrations[i-1].version
+		}
+		if err := s.setSchemaVersion(previous); err != nil {
+			return plan, err
+		}
+	}
+	return plan, nil
+}
+
+// Reencrypt rewrites the documents whose content is not encrypted under the
+// first key, those of a key rotated out or stored before encryption was
+// enabled, and returns how many it rewrote. Once it is done, the keys
+// rotated out can be removed from the configuration.
+func (s *KVStore) Reencrypt() (int, error) {
+	rewritten := 0
+	var start []byte
+	for {
+		keys := make([][]byte, 0, kvDeleteBatch)
+		olds := make([][]byte, 0, kvDeleteBatch)
+		values := make([][]byte, 0, kvDeleteBatch)
+		err := s.engine.View(func(tx kvReader) error {
+			return tx.Scan([]byte(kvChunkPrefix), start, func(key, data []byte) error {
+				if len(keys) == kvDeleteBatch {
+					return errKVBatchFull
+				}
+				// the next batch starts right after this key
+				start = append(bytes.Clone(key), 0)
+				var chunk kvChunk
+				if err := json.Unmarshal(data, &chunk); err != nil {
+					return fmt.Errorf("error decoding document chunk: %w", err)
+				}
+				content, changed, err := s.cipher.reencrypt(chunk.Content)
+				if err != nil || !changed {
+					return err
+				}
+				chunk.Content = content
+				value, err := json.Marshal(chunk)
+				if err != nil {
+					return fmt.Errorf("error encoding document chunk: %w", err)
+				}
+				keys = append(keys, key)
+				olds = append(olds, data)
+				values = append(values, value)
+				return nil
+			})
+		})
+		full := errors.Is(err, errKVBatchFull)
+		if err != nil && !full {
+			return rewritten, err
+		}
+		if len(keys) > 0 {
+			batch := 0
+			err := s.update(false, func(tx kvWriter) error {
+				for i, key := range keys {
+					// a chunk replaced meanwhile was written under the first key
+					current, ok, err := tx.Get(key)
+					if err != nil {
+						return err
+					}
+					if !ok || !bytes.Equal(current, olds[i]) {
+						continue
+					}
+					if err := tx.Set(key, values[i]); err != nil {
+						return err
+					}
+					batch++
+				}
+				return nil
+			})
+			if err != nil {
+				return rewritten, err
+			}
+			rewritten += batch
+		}
+		if !full {
+			return rewritten, nil
+		}
+	}
+}
+
+// deletePrefix removes the keys starting with prefixes, kvDeleteBatch keys
+// per transaction.
+func (s *KVStore) deletePrefix(prefixes ...string) error {
+	for _, prefix := range prefixes {
+		for {
+			keys := make([][]byte, 0, kvDeleteBatch)
+			err := s.engine.View(func(tx kvReader) error {
+				return tx.Scan([]byte(prefix), nil, func(key, _ []byte) error {
+					if len(keys) == kvDeleteBatch {
+						return errKVBatchFull
+					}
+					keys = append(keys, key)
+					return nil
+				})
+			})
+			if err != nil && !errors.Is(err, errKVBatchFull) {
+				return err
+			}
+			if len(keys) == 0 {
+				break
+			}
+			if err := s.update(false, func(tx kvWriter) error {
+				for _, key := range keys {
+					if err := tx.Delete(key); err != nil {
+						return err
+					}
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *KVStore) Documents() *KVDocumentStore {
+	return &KVDocumentStore{store: s}
+}
+
+func (s *KVStore) Jobs() *KVJobStore {
+	return &KVJobStore{store: s}
+}
+
+func (s *KVStore) Close() error {
+	return s.engine.Close()
+}
+
+// The keys of a KVStore. The parts after the prefix are separated by a zero
+// byte, which the names of collections and sources do not contain, and the
+// revisions are big-endian, so they scan in order.
+const (
+	// kvRevisionPrefix + collection: the last revision of the collection
+	kvRevisionPrefix = "doc/revision/"
+	// kvSourcePrefix + collection, source: the revision of the source
+	kvSourcePrefix = "doc/source/"
+	// kvChangePrefix + collection, revision: the source changed
+	kvChangePrefix = "doc/change/"
+	// kvChunkPrefix + collection, source, index: a chunk of the source
+	kvChunkPrefix = "doc/chunk/"
+	// kvJobPrefix + id: the state of a job
+	kvJobPrefix = "job/"
+	// kvSchemaKey: the version of the last migration applied
+	kvSchemaKey = "meta/schema_version"
+)
+
+func kvKey(prefix string, parts ...string) []byte {
+	return []byte(prefix + strings.Join(parts, "\x00"))
+}
+
+func kvRevision(revision int64) []byte {
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], uint64(revision))
+	return data[:]
+}
+
+func kvChunkIndex(index int) string {
+	return fmt.Sprintf("%08d", index)
+}
+
+// KVDocumentStore keeps the chunks of the indexed sources, with their
+// content, embeddings and metadata, in a KVStore. Every change of a source
+// gets the next revision of its collection and is recorded under it, so the
+// changes after a revision are read in order.
+type KVDocumentStore struct {
+	store *KVStore
+}
+
+// kvChunk is a chunk as stored, with its embedding packed like the SQL
+// storage does.
+type kvChunk struct {
+	ID        string                 `json:"id"`
+	Content   string                 `json:"content"`
+	Embedding string                 `json:"embedding"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	Media     []MediaRef             `json:"media,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+func (s *KVDocumentStore) Replace(collection, source string, documents []Document) (int64, error) {
+	var revision int64
+	err := s.store.update(len(documents) > 0, func(tx kvWriter) error {
+		last, ok, err := tx.Get(kvKey(kvRevisionPrefix, collection))
+		if err != nil {
+			return err
+		}
+		if ok {
+			revision = int64(binary.BigEndian.Uint64(last))
+		}
+		revision++
+		sourceKey := kvKey(kvSourcePrefix, collection, source)
+		previous, ok, err := tx.Get(sourceKey)
+		if err != nil {
+			return err
+		}
+		if ok {
+			// a source keeps only its last change
+			if err := tx.Delete(kvKey(kvChangePrefix, collection, string(previous))); err != nil {
+				return err
+			}
+		}
+		chunkPrefix := kvKey(kvChunkPrefix, collection, source, "")
+		stale := make([][]byte, 0)
+		if err := tx.Scan(chunkPrefix, nil, func(key, _ []byte) error {
+			stale = append(stale, key)
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, key := range stale {
+			if err := tx.Delete(key); err != nil {
+				return err
+			}
+		}
+		for n, document := range documents {
+			chunk, err := json.Marshal(kvChunk{
+				ID:        document.ID,
+				Content:   s.store.cipher.Encrypt(document.Content),
+				Embedding: encodeEmbedding(document.Embedding),
+				Metadata:  document.Metadata,
+				Media:     document.Media,
+				CreatedAt: document.CreatedAt.UTC(),
+			})
+			if err != nil {
+				return fmt.Errorf("error encoding document chunk: %w", err)
+			}
+			if err := tx.Set(kvKey(kvChunkPrefix, collection, source, kvChunkIndex(n)), chunk); err != nil {
+				return err
+			}
+		}
+		if err := tx.Set(sourceKey, kvRevision(revision)); err != nil {
+			return err
+		}
+		if err := tx.Set(kvKey(kvChangePrefix, collection, string(kvRevision(revision))), []byte(source)); err != nil {
+			return err
+		}
+		return tx.Set(kvKey(kvRevisionPrefix, collection), kvRevision(revision))
+	})
+	if err != nil {
+		return 0, err
+	}
+	return revision, nil
+}
+
+// Changes reads the changes and their chunks in one transaction, so a
+// source changed meanwhile is seen whole by this sync or the next one.
+func (s *KVDocumentStore) Changes(collection string, after int64) ([]DocumentChange, int64, error) {
+	changes := make([]DocumentChange, 0)
+	revision := after
+	err := s.store.engine.View(func(tx kvReader) error {
+		prefix := kvKey(kvChangePrefix, collection, "")
+		start := append(bytes.Clone(prefix), kvRevision(after+1)...)
+		return tx.Scan(prefix, start, func(key, value []byte) error {
+			change := DocumentChange{Source: string(value)}
+			err := tx.Scan(kvKey(kvChunkPrefix, collection, change.Source, ""), nil, func(_, data []byte) error {
+				var chunk kvChunk
+				if err := json.Unmarshal(data, &chunk); err != nil {
+					return fmt.Errorf("error decoding document chunk: %w", err)
+				}
+				document := Document{
+					ID:        chunk.ID,
+					Metadata:  chunk.Metadata,
+					Media:     chunk.Media,
+					CreatedAt: chunk.CreatedAt,
+				}
+				var err error
+				if document.Content, err = s.store.cipher.Decrypt(chunk.Content); err != nil {
+					return err
+				}
+				if document.Embedding, err = decodeEmbedding(chunk.Embedding); err != nil {
+					return err
+				}
+				change.Documents = append(change.Documents, document)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			changes = append(changes, change)
+			revision = int64(binary.BigEndian.Uint64(key[len(prefix):]))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, after, err
+	}
+	return changes, revision, nil
+}
+
+// KVJobStore keeps the state of the jobs in a KVStore, so it outlives a
+// restart. The jobs finished before DefaultJobRetention are removed when the
+// store is compacted.
+type KVJobStore struct {
+	store *KVStore
+}
+
+func (s *KVJobStore) Save(payload WebhookPayload) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error encoding job: %w", err)
+	}
+	return s.store.update(true, func(tx kvWriter) error {
+		return tx.Set(kvKey(kvJobPrefix, payload.ID), data)
+	})
+}
+
+func (s *KVJobStore) Get(id string) (*WebhookPayload, error) {
+	var payload *WebhookPayload
+	err := s.store.engine.View(func(tx kvReader) error {
+		data, ok, err := tx.Get(kvKey(kvJobPrefix, id))
+		if err != nil || !ok {
+			return err
+		}
+		payload = &WebhookPayload{}
+		return json.Unmarshal(data, payload)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if payload == nil {
+		return nil, ErrJobNotFound
+	}
+	return payload, nil
+}
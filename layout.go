@@ -0,0 +1,246 @@
+package orus
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// maxHeadingLength is the longest line taken for a heading.
+const maxHeadingLength = 80
+
+var (
+	// numberedHeadingPattern matches headings such as "3.2 Scope" or
+	// "4. Payment terms".
+	numberedHeadingPattern = regexp.MustCompile(`^(\d{1,3}(?:\.\d{1,3})*)\.?\s+\p{Lu}`)
+	markdownHeadingPattern = regexp.MustCompile(`^#{1,6}\s+\S`)
+	// pageNumberPattern matches the running page numbers of headers and
+	// footers, such as "12", "- 12 -" or "Page 12 of 40".
+	pageNumberPattern = regexp.MustCompile(`(?i)^(page\s+)?[-–—]?\s*\d{1,4}\s*[-–—]?(\s+of\s+\d{1,4})?$`)
+	// columnGapPattern separates the cells of a table laid out by
+	// pdftotext -layout.
+	columnGapPattern = regexp.MustCompile(` {2,}`)
+)
+
+// LayoutChunk is a chunk of a paged document with its place in the
+// document, for citations.
+type LayoutChunk struct {
+	Text string
+	// Page is the page the chunk was read from, numbered from 1.
+	Page int
+	// Heading is the title of the section of the chunk, and Section its
+	// number when it is numbered.
+	Heading string
+	Section string
+}
+
+type layoutBlockKind int
+
+const (
+	paragraphBlock layoutBlockKind = iota
+	headingBlock
+	tableBlock
+)
+
+type layoutBlock struct {
+	kind layoutBlockKind
+	text string
+}
+
+// ChunkLayout chunks the pages of a document, laid out by pdftotext
+// -layout, along its structure: a heading starts a new chunk, a table is
+// kept whole when it fits, and a chunk never spans two pages. Paragraphs
+// are packed into chunks of at most size characters; only a block longer
+// than size is split, repeating overlap characters. The page numbers of
+// the headers and footers are dropped.
+func ChunkLayout(pages []string, size, overlap int) []LayoutChunk {
+	if size <= 0 {
+		size = DefaultChunkSize
+	}
+	chunks := make([]LayoutChunk, 0)
+	heading, section := "", ""
+	for n, page := range pages {
+		current := make([]string, 0)
+		length := 0
+		flush := func() {
+			if length > 0 {
+				chunks = append(chunks, LayoutChunk{
+					Text:    strings.Join(current, "\n\n"),
+					Page:    n + 1,
+					Heading: heading,
+					Section: section,
+				})
+			}
+			current, length = current[:0:0], 0
+		}
+		for _, block := range layoutBlocks(page) {
+			if block.kind == headingBlock {
+				flush()
+				heading, section = parseHeading(block.text)
+				// the heading opens its chunk, so the chunk reads in context
+				current = append(current, block.text)
+				continue
+			}
+			if len(block.text) > size {
+				flush()
+				for _, piece := range ChunkText(block.text, size, overlap) {
+					current = append(current, piece)
+					length = len(piece)
+					flush()
+				}
+				continue
+			}
+			if length > 0 && chunkLength(current)+2+len(block.text) > size {
+				flush()
+			}
+			current = append(current, block.text)
+			length += len(block.text)
+		}
+		flush()
+	}
+	return chunks
+}
+
+func chunkLength(parts []string) int {
+	length := 0
+	for i, part := range parts {
+		if i > 0 {
+			length += 2
+		}
+		length += len(part)
+	}
+	return length
+}
+
+// layoutBlocks splits a page into its headings, tables and paragraphs,
+// which are separated by blank lines. The lines of a paragraph are joined
+// and the rows of a table keep their columns.
+func layoutBlocks(page string) []layoutBlock {
+	blocks := make([]layoutBlock, 0)
+	lines := make([]string, 0)
+	flush := func() {
+		defer func() { lines = make([]string, 0) }()
+		if len(lines) == 0 {
+			return
+		}
+		// a heading is not always followed by a blank line
+		if isHeading(lines[0]) {
+			blocks = append(blocks, layoutBlock{kind: headingBlock, text: strings.Join(strings.Fields(lines[0]), " ")})
+			if lines = lines[1:]; len(lines) == 0 {
+				return
+			}
+		}
+		if isTable(lines) {
+			rows := make([]string, len(lines))
+			indent := commonIndent(lines)
+			for i, line := range lines {
+				rows[i] = strings.TrimRightFunc(line[indent:], unicode.IsSpace)
+			}
+			blocks = append(blocks, layoutBlock{kind: tableBlock, text: strings.Join(rows, "\n")})
+			return
+		}
+		blocks = append(blocks, layoutBlock{kind: paragraphBlock, text: strings.Join(strings.Fields(strings.Join(lines, " ")), " ")})
+	}
+	for _, line := range strings.Split(page, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			flush()
+		case pageNumberPattern.MatchString(trimmed):
+		default:
+			lines = append(lines, strings.TrimRightFunc(line, unicode.IsSpace))
+		}
+	}
+	flush()
+	return blocks
+}
+
+// isHeading takes for a heading a short line that does not end a sentence
+// and is numbered, marked as a markdown heading or written in capitals.
+func isHeading(line string) bool {
+	line = strings.TrimSpace(line)
+	if len(line) > maxHeadingLength || strings.HasSuffix(line, ".") || strings.HasSuffix(line, ",") ||
+		columnGapPattern.MatchString(line) || pageNumberPattern.MatchString(line) {
+		return false
+	}
+	if numberedHeadingPattern.MatchString(line) || markdownHeadingPattern.MatchString(line) {
+		return true
+	}
+	letters := 0
+	for _, r := range line {
+		if unicode.IsLower(r) {
+			return false
+		}
+		if unicode.IsLetter(r) {
+			letters++
+		}
+	}
+	return letters >= 3
+}
+
+// parseHeading returns the title of a heading and its section number.
+func parseHeading(text string) (heading, section string) {
+	text = strings.TrimSpace(strings.TrimLeft(text, "#"))
+	if match := numberedHeadingPattern.FindStringSubmatch(text); match != nil {
+		return text, match[1]
+	}
+	return text, ""
+}
+
+// isTable takes for a table a block of at least two lines where two thirds
+// of the lines have a column starting at the same position. The gaps of
+// justified text do not line up, so its paragraphs are not tables.
+func isTable(lines []string) bool {
+	if len(lines) < 2 {
+		return false
+	}
+	columns := make(map[int]int)
+	for _, line := range lines {
+		for _, gap := range columnGapPattern.FindAllStringIndex(line, -1) {
+			if gap[0] > 0 && gap[1] < len(line) {
+				columns[gap[1]]++
+			}
+		}
+	}
+	for _, count := range columns {
+		if count*3 >= len(lines)*2 {
+			return true
+		}
+	}
+	return false
+}
+
+func commonIndent(lines []string) int {
+	indent := -1
+	for _, line := range lines {
+		n := len(line) - len(strings.TrimLeft(line, " "))
+		if indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	return max(indent, 0)
+}
+
+// Citation locates a chunk in its document as "page 12, section 3.2
+// Scope", from the metadata of layout chunking, or a video frame as "at
+// 00:01:23". It is empty for the chunks of documents without pages.
+func Citation(document Document) string {
+	if timecode, ok := document.Metadata["timecode"].(string); ok && timecode != "" {
+		return "at " + timecode
+	}
+	parts := make([]string, 0, 2)
+	if page := metadataInt(document, "page"); page > 0 {
+		parts = append(parts, "page "+strconv.Itoa(page))
+	}
+	heading, _ := document.Metadata["heading"].(string)
+	section, _ := document.Metadata["section"].(string)
+	switch {
+	case section != "":
+		// the heading of a numbered section starts with its number
+		parts = append(parts, "section "+heading)
+	case heading != "":
+		parts = append(parts, heading)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,441 @@
+package orus
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultLogFileMaxSize  = 100
+	DefaultLogFileBackups  = 5
+	DefaultLogSyslogTag    = "orus"
+	DefaultLokiBatchWait   = time.Second
+	DefaultLokiBatchSize   = 500
+	lokiQueueSize          = 4096
+	lokiPushTimeout        = 10 * time.Second
+	logFileTimestampLayout = "20060102T150405.000"
+)
+
+type LogConfig struct {
+	// Console keeps writing the logs to standard error, as Go does without
+	// sinks. It can only be turned off when a sink is set.
+	Console bool            `yaml:"console"`
+	File    LogFileConfig   `yaml:"file"`
+	Syslog  LogSyslogConfig `yaml:"syslog"`
+	Loki    LokiConfig      `yaml:"loki"`
+}
+
+type LogFileConfig struct {
+	// Path is the log file; empty disables the file sink.
+	Path string `yaml:"path"`
+	// MaxSize is the size in megabytes from which the file is rotated.
+	MaxSize int `yaml:"max_size"`
+	// MaxBackups is the number of rotated files kept, the oldest removed
+	// first; 0 keeps them all.
+	MaxBackups int `yaml:"max_backups"`
+	// Compress gzips the rotated files.
+	Compress bool `yaml:"compress"`
+}
+
+type LogSyslogConfig struct {
+	// Address is the host:port of the syslog server, or "local" for the
+	// daemon of the host; empty disables the syslog sink.
+	Address string `yaml:"address"`
+	// Network is "udp" or "tcp" for a remote address.
+	Network string `yaml:"network"`
+	Tag     string `yaml:"tag"`
+}
+
+type LokiConfig struct {
+	// URL is the push endpoint, such as http://loki:3100/loki/api/v1/push;
+	// empty disables the Loki sink. It may hold basic auth credentials.
+	URL Secret `yaml:"url"`
+	// Labels are the labels of the stream of the logs.
+	Labels map[string]string `yaml:"labels"`
+	// Tenant is sent as X-Scope-OrgID to a multi-tenant Loki.
+	Tenant string `yaml:"tenant"`
+	// BatchWait and BatchSize bound how long and how many lines are held
+	// before a push.
+	BatchWait time.Duration `yaml:"batch_wait"`
+	BatchSize int           `yaml:"batch_size"`
+}
+
+// Enabled reports whether a sink is set.
+func (c LogConfig) Enabled() bool {
+	return c.File.Path != "" || c.Syslog.Address != "" || c.Loki.URL != ""
+}
+
+// LogSink receives each log line. A sink must not block the caller on a
+// slow destination, nor log its own errors, which would loop.
+type LogSink interface {
+	io.Writer
+	Close() error
+}
+
+// LogSinks writes the logs to every sink, and to standard error while the
+// console is on. A sink failing does not keep the others from the line.
+type LogSinks struct {
+	sinks []LogSink
+}
+
+// OpenLogSinks opens the sinks of config. Use it as the output of the log
+// package, which slog writes to by default:
+//
+//	sinks, err := orus.OpenLogSinks(config.Log)
+//	log.SetOutput(sinks)
+//	defer sinks.Close()
+func OpenLogSinks(config LogConfig) (*LogSinks, error) {
+	s := &LogSinks{}
+	if config.Console {
+		s.sinks = append(s.sinks, consoleSink{})
+	}
+	if config.File.Path != "" {
+		file, err := openRotatingFile(config.File)
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("error opening the log file: %w", err)
+		}
+		s.sinks = append(s.sinks, file)
+	}
+	if config.Syslog.Address != "" {
+		writer, err := openSyslog(config.Syslog)
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("error connecting to syslog: %w", err)
+		}
+		s.sinks = append(s.sinks, writer)
+	}
+	if config.Loki.URL != "" {
+		s.sinks = append(s.sinks, newLokiSink(config.Loki))
+	}
+	return s, nil
+}
+
+// Add writes the logs to sink too.
+func (s *LogSinks) Add(sink LogSink) {
+	s.sinks = append(s.sinks, sink)
+}
+
+func (s *LogSinks) Write(p []byte) (int, error) {
+	var errs []error
+	for _, sink := range s.sinks {
+		if _, err := sink.Write(p); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return len(p), errors.Join(errs...)
+}
+
+// Close flushes and closes every sink.
+func (s *LogSinks) Close() error {
+	var errs []error
+	for _, sink := range s.sinks {
+		errs = append(errs, sink.Close())
+	}
+	return errors.Join(errs...)
+}
+
+type consoleSink struct{}
+
+func (consoleSink) Write(p []byte) (int, error) {
+	return os.Stderr.Write(p)
+}
+
+func (consoleSink) Close() error {
+	return nil
+}
+
+// rotatingFile appends to a file, and renames it with a timestamp once it
+// reaches its maximum size. The rotated files are compressed and pruned in
+// the background.
+type rotatingFile struct {
+	config  LogFileConfig
+	maxSize int64
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	// archiving holds the compression and pruning of the rotated files, so
+	// Close waits for them; archiveMu runs them one at a time, so a prune
+	// does not remove a file being compressed.
+	archiving sync.WaitGroup
+	archiveMu sync.Mutex
+}
+
+func openRotatingFile(config LogFileConfig) (*rotatingFile, error) {
+	if config.MaxSize <= 0 {
+		config.MaxSize = DefaultLogFileMaxSize
+	}
+	if err := os.MkdirAll(filepath.Dir(config.Path), 0o755); err != nil {
+		return nil, err
+	}
+	f := &rotatingFile{config: config, maxSize: int64(config.MaxSize) << 20}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate must be called with mu held.
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	ext := filepath.Ext(f.config.Path)
+	rotated := strings.TrimSuffix(f.config.Path, ext) + "-" + time.Now().UTC().Format(logFileTimestampLayout) + ext
+	if err := os.Rename(f.config.Path, rotated); err != nil {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.archiving.Add(1)
+	go func() {
+		defer f.archiving.Done()
+		f.archiveMu.Lock()
+		defer f.archiveMu.Unlock()
+		if f.config.Compress {
+			// a file already pruned by the job of a later rotation is gone
+			if err := compressFile(rotated); err != nil && !errors.Is(err, os.ErrNotExist) {
+				fmt.Fprintf(os.Stderr, "Error compressing the log file %s: %v\n", rotated, err)
+			}
+		}
+		f.prune()
+	}()
+	return nil
+}
+
+// prune removes the oldest rotated files beyond MaxBackups. The timestamps
+// of their names sort them by age.
+func (f *rotatingFile) prune() {
+	if f.config.MaxBackups <= 0 {
+		return
+	}
+	ext := filepath.Ext(f.config.Path)
+	prefix := strings.TrimSuffix(f.config.Path, ext) + "-"
+	matches, err := filepath.Glob(prefix + "*")
+	if err != nil {
+		return
+	}
+	var rotated []string
+	for _, match := range matches {
+		stamp := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(match, prefix), ".gz"), ext)
+		if _, err := time.Parse(logFileTimestampLayout, stamp); err == nil {
+			rotated = append(rotated, match)
+		}
+	}
+	sort.Strings(rotated)
+	for len(rotated) > f.config.MaxBackups {
+		os.Remove(rotated[0])
+		rotated = rotated[1:]
+	}
+}
+
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	var err error
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+	f.mu.Unlock()
+	f.archiving.Wait()
+	return err
+}
+
+// compressFile replaces path with path.gz.
+func compressFile(path string) error {
+	source, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	target, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	writer := gzip.NewWriter(target)
+	if _, err := io.Copy(writer, source); err != nil {
+		target.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		target.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := target.Close(); err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	return os.Remove(path)
+}
+
+// lokiSink pushes the lines to Loki in batches from a goroutine. Lines are
+// dropped when Loki cannot keep up, rather than blocking the callers.
+type lokiSink struct {
+	config  LokiConfig
+	client  *http.Client
+	entries chan [2]string
+	done    chan struct{}
+
+	mu      sync.Mutex
+	closed  bool
+	dropped int
+}
+
+func newLokiSink(config LokiConfig) *lokiSink {
+	if config.BatchWait <= 0 {
+		config.BatchWait = DefaultLokiBatchWait
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultLokiBatchSize
+	}
+	if len(config.Labels) == 0 {
+		config.Labels = map[string]string{"app": "orus"}
+	}
+	s := &lokiSink{
+		config:  config,
+		client:  &http.Client{Timeout: lokiPushTimeout},
+		entries: make(chan [2]string, lokiQueueSize),
+		done:    make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *lokiSink) Write(p []byte) (int, error) {
+	entry := [2]string{strconv.FormatInt(time.Now().UnixNano(), 10), strings.TrimRight(string(p), "\n")}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return 0, os.ErrClosed
+	}
+	select {
+	case s.entries <- entry:
+	default:
+		s.dropped++
+	}
+	return len(p), nil
+}
+
+func (s *lokiSink) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.config.BatchWait)
+	defer ticker.Stop()
+	batch := make([][2]string, 0, s.config.BatchSize)
+	for {
+		select {
+		case entry, ok := <-s.entries:
+			if !ok {
+				s.push(batch)
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) < s.config.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		s.push(batch)
+		batch = batch[:0]
+	}
+}
+
+// push sends batch, reporting the lines dropped since the last push. Its
+// errors go to standard error, as logging them would feed them back to Loki.
+func (s *lokiSink) push(batch [][2]string) {
+	s.mu.Lock()
+	dropped := s.dropped
+	s.dropped = 0
+	s.mu.Unlock()
+	if dropped > 0 {
+		batch = append(batch, [2]string{strconv.FormatInt(time.Now().UnixNano(), 10),
+			fmt.Sprintf("Loki sink dropped %d log lines, the queue was full", dropped)})
+	}
+	if len(batch) == 0 {
+		return
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"streams": []map[string]interface{}{{"stream": s.config.Labels, "values": batch}},
+	})
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, s.config.URL.Reveal(), bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error pushing %d log lines to Loki: %v\n", len(batch), err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.config.Tenant != "" {
+		req.Header.Set("X-Scope-OrgID", s.config.Tenant)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error pushing %d log lines to Loki: %v\n", len(batch), err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		fmt.Fprintf(os.Stderr, "Error pushing %d log lines to Loki: answered with status %d\n", len(batch), resp.StatusCode)
+	}
+}
+
+// Close pushes the lines still queued.
+func (s *lokiSink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.entries)
+	s.mu.Unlock()
+	<-s.done
+	return nil
+}
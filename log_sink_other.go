@@ -0,0 +1,9 @@
+//go:build !unix
+
+package orus
+
+import "errors"
+
+func openSyslog(config LogSyslogConfig) (LogSink, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
@@ -0,0 +1,19 @@
+//go:build unix
+
+package orus
+
+import "log/syslog"
+
+// openSyslog connects to the syslog server of config, or to the daemon of
+// the host for the "local" address. The lines are sent at the info level.
+func openSyslog(config LogSyslogConfig) (LogSink, error) {
+	tag := config.Tag
+	if tag == "" {
+		tag = DefaultLogSyslogTag
+	}
+	network, address := config.Network, config.Address
+	if address == "local" {
+		network, address = "", ""
+	}
+	return syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+}
@@ -0,0 +1,422 @@
+package orus
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Dsouza10082/orus/ollama"
+)
+
+// MCPProtocolVersion is the latest Model Context Protocol revision the MCP
+// server speaks; clients asking for an older supported one get theirs.
+const MCPProtocolVersion = "2025-06-18"
+
+var mcpProtocolVersions = []string{"2024-11-05", "2025-03-26", MCPProtocolVersion}
+
+// mcpDocumentScheme is the URI scheme of the indexed documents exposed as
+// MCP resources: orus://documents/<source>.
+const mcpDocumentScheme = "orus://documents/"
+
+// JSON-RPC 2.0 error codes.
+const (
+	jsonRPCParseError     = -32700
+	jsonRPCInvalidRequest = -32600
+	jsonRPCMethodNotFound = -32601
+	jsonRPCInvalidParams  = -32602
+)
+
+type jsonRPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type jsonRPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *jsonRPCError   `json:"error,omitempty"`
+}
+
+type jsonRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type mcpContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type mcpResource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// MCPServer exposes the document index, the embeddings and the agent memory
+// of an Orus as Model Context Protocol tools, and the indexed documents as
+// resources, so MCP clients such as Claude Desktop can use them. It handles
+// JSON-RPC messages; ServeStdio and the SSE routes carry them.
+type MCPServer struct {
+	orus  *Orus
+	tools *ToolRegistry
+	// EmbedModel is the model the documents were indexed with.
+	EmbedModel string
+
+	mu       sync.Mutex
+	sessions map[string]chan []byte
+}
+
+func NewMCPServer(orus *Orus) *MCPServer {
+	server := &MCPServer{
+		orus:       orus,
+		EmbedModel: DefaultRAGEmbedModel,
+		sessions:   make(map[string]chan []byte),
+	}
+	server.tools = newToolRegistry(server.mcpTools()...)
+	return server
+}
+
+// OpenSession registers the stream of an SSE session, where the answers to
+// its messages are sent.
+func (m *MCPServer) OpenSession(id string, messages chan []byte) {
+	m.mu.Lock()
+	m.sessions[id] = messages
+	m.mu.Unlock()
+}
+
+func (m *MCPServer) CloseSession(id string) {
+	m.mu.Lock()
+	delete(m.sessions, id)
+	m.mu.Unlock()
+}
+
+// Session returns the stream of an open SSE session.
+func (m *MCPServer) Session(id string) (chan []byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	messages, ok := m.sessions[id]
+	return messages, ok
+}
+
+// Handle answers one JSON-RPC message. Notifications get no answer, and
+// Handle returns nil.
+func (m *MCPServer) Handle(ctx context.Context, message []byte) []byte {
+	var request jsonRPCRequest
+	if err := json.Unmarshal(message, &request); err != nil {
+		return m.encode(jsonRPCResponse{ID: json.RawMessage("null"), Error: &jsonRPCError{Code: jsonRPCParseError, Message: err.Error()}})
+	}
+	if request.JSONRPC != "2.0" || request.Method == "" {
+		return m.encode(jsonRPCResponse{ID: orNull(request.ID), Error: &jsonRPCError{Code: jsonRPCInvalidRequest, Message: "not a JSON-RPC 2.0 request"}})
+	}
+	result, rpcErr := m.dispatch(ctx, request)
+	if len(request.ID) == 0 {
+		return nil
+	}
+	if rpcErr != nil {
+		return m.encode(jsonRPCResponse{ID: request.ID, Error: rpcErr})
+	}
+	return m.encode(jsonRPCResponse{ID: request.ID, Result: result})
+}
+
+func (m *MCPServer) encode(response jsonRPCResponse) []byte {
+	response.JSONRPC = "2.0"
+	data, err := json.Marshal(response)
+	if err != nil {
+		data, _ = json.Marshal(jsonRPCResponse{JSONRPC: "2.0", ID: response.ID, Error: &jsonRPCError{Code: -32603, Message: err.Error()}})
+	}
+	return data
+}
+
+func orNull(id json.RawMessage) json.RawMessage {
+	if len(id) == 0 {
+		return json.RawMessage("null")
+	}
+	return id
+}
+
+func (m *MCPServer) dispatch(ctx context.Context, request jsonRPCRequest) (interface{}, *jsonRPCError) {
+	switch request.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		_ = json.Unmarshal(request.Params, &params)
+		version := MCPProtocolVersion
+		if slices.Contains(mcpProtocolVersions, params.ProtocolVersion) {
+			version = params.ProtocolVersion
+		}
+		return map[string]interface{}{
+			"protocolVersion": version,
+			"capabilities": map[string]interface{}{
+				"tools":     map[string]interface{}{},
+				"resources": map[string]interface{}{},
+			},
+			"serverInfo": map[string]interface{}{"name": "orus", "version": "1.0.0"},
+			"instructions": "Orus is a local RAG server. Use search_documents to find passages of the indexed documents, " +
+				"get_document to read one, and recall_memory/remember for long-term facts about a user.",
+		}, nil
+	case "ping":
+		return map[string]interface{}{}, nil
+	case "notifications/initialized", "notifications/cancelled":
+		return nil, nil
+	case "tools/list":
+		definitions, _ := m.tools.Definitions(nil)
+		tools := make([]map[string]interface{}, len(definitions))
+		for i, definition := range definitions {
+			tools[i] = map[string]interface{}{
+				"name":        definition.Function.Name,
+				"description": definition.Function.Description,
+				"inputSchema": definition.Function.Parameters,
+			}
+		}
+		return map[string]interface{}{"tools": tools}, nil
+	case "tools/call":
+		var params struct {
+			Name      string                 `json:"name"`
+			Arguments map[string]interface{} `json:"arguments"`
+		}
+		if err := json.Unmarshal(request.Params, &params); err != nil || params.Name == "" {
+			return nil, &jsonRPCError{Code: jsonRPCInvalidParams, Message: "a tool name is required"}
+		}
+		if !slices.Contains(m.tools.Names(), params.Name) {
+			return nil, &jsonRPCError{Code: jsonRPCInvalidParams, Message: fmt.Sprintf("unknown tool %q", params.Name)}
+		}
+		// A failing tool is a result the model sees, not a protocol error
+		step := m.tools.Execute(ctx, ollama.ToolCall{Function: ollama.ToolCallFunction{Name: params.Name, Arguments: params.Arguments}})
+		if step.Error != "" {
+			return map[string]interface{}{"content": []mcpContent{{Type: "text", Text: step.Error}}, "isError": true}, nil
+		}
+		return map[string]interface{}{"content": []mcpContent{{Type: "text", Text: step.Result}}, "isError": false}, nil
+	case "resources/list":
+		sources := m.orus.Documents.Sources()
+		resources := make([]mcpResource, len(sources))
+		for i, source := range sources {
+			resources[i] = mcpResource{
+				URI:         mcpDocumentScheme + url.PathEscape(source.Source),
+				Name:        source.Source,
+				Description: fmt.Sprintf("%d chunks embedded with %s", source.Chunks, source.Model),
+				MimeType:    "text/plain",
+			}
+		}
+		return map[string]interface{}{"resources": resources}, nil
+	case "resources/read":
+		var params struct {
+			URI string `json:"uri"`
+		}
+		_ = json.Unmarshal(request.Params, &params)
+		source, ok := strings.CutPrefix(params.URI, mcpDocumentScheme)
+		if !ok {
+			return nil, &jsonRPCError{Code: jsonRPCInvalidParams, Message: fmt.Sprintf("unknown resource %q", params.URI)}
+		}
+		source, err := url.PathUnescape(source)
+		if err != nil {
+			return nil, &jsonRPCError{Code: jsonRPCInvalidParams, Message: fmt.Sprintf("unknown resource %q", params.URI)}
+		}
+		text, found := m.documentText(source)
+		if !found {
+			return nil, &jsonRPCError{Code: -32002, Message: fmt.Sprintf("resource not found: %s", params.URI)}
+		}
+		return map[string]interface{}{"contents": []map[string]interface{}{
+			{"uri": params.URI, "mimeType": "text/plain", "text": text},
+		}}, nil
+	}
+	return nil, &jsonRPCError{Code: jsonRPCMethodNotFound, Message: fmt.Sprintf("method %q is not supported", request.Method)}
+}
+
+// documentText returns the chunks of source in order, separated by blank
+// lines. Consecutive chunks repeat the few words of their overlap.
+func (m *MCPServer) documentText(source string) (string, bool) {
+	chunks := m.orus.Documents.Chunks(source)
+	if len(chunks) == 0 {
+		return "", false
+	}
+	parts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		parts[i] = chunk.Content
+	}
+	return strings.Join(parts, "\n\n"), true
+}
+
+// ServeStdio reads newline-delimited JSON-RPC messages from in and writes
+// the answers to out, until in is closed.
+func (m *MCPServer) ServeStdio(ctx context.Context, in io.Reader, out io.Writer) error {
+	reader := bufio.NewReader(in)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) > 0 {
+			if response := m.Handle(ctx, line); response != nil {
+				if _, werr := out.Write(append(response, '\n')); werr != nil {
+					return werr
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (m *MCPServer) mcpTools() []Tool {
+	text := func(value interface{}) (string, error) {
+		data, err := json.MarshalIndent(value, "", "  ")
+		return string(data), err
+	}
+	return []Tool{
+		{
+			Name:        "search_documents",
+			Description: "Searches the documents indexed in Orus and returns the passages most similar to the query, with their source and similarity.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"query": map[string]interface{}{"type": "string", "description": "What to look for"},
+					"limit": map[string]interface{}{"type": "integer", "minimum": 1.0, "maximum": 50.0, "description": "Number of passages, 4 by default"},
+				},
+				"required": []interface{}{"query"},
+			},
+			Run: func(ctx context.Context, arguments map[string]interface{}) (string, error) {
+				query, _ := arguments["query"].(string)
+				limit, _ := arguments["limit"].(float64)
+				results, err := m.orus.Documents.Retrieve(query, m.EmbedModel, int(limit))
+				if err != nil {
+					return "", err
+				}
+				if len(results) == 0 {
+					return "No indexed passage matches the query.", nil
+				}
+				sb := &strings.Builder{}
+				for n, result := range results {
+					location := fmt.Sprintf("%v#%d", result.Document.Metadata["source"], ChunkNumber(result.Document))
+					if citation := Citation(result.Document); citation != "" {
+						location += ", " + citation
+					}
+					fmt.Fprintf(sb, "[%d] %s (similarity %.3f)\n%s\n\n", n+1, location, result.Similarity, result.Document.Content)
+				}
+				return sb.String(), nil
+			},
+		},
+		{
+			Name:        "list_documents",
+			Description: "Lists the documents indexed in Orus with their number of chunks.",
+			Run: func(ctx context.Context, arguments map[string]interface{}) (string, error) {
+				return text(m.orus.Documents.Sources())
+			},
+		},
+		{
+			Name:        "get_document",
+			Description: "Returns the text of an indexed document, as its chunks in order separated by blank lines.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"source": map[string]interface{}{"type": "string", "description": "The source of the document, as listed by list_documents"},
+				},
+				"required": []interface{}{"source"},
+			},
+			Run: func(ctx context.Context, arguments map[string]interface{}) (string, error) {
+				source, _ := arguments["source"].(string)
+				content, ok := m.documentText(source)
+				if !ok {
+					return "", fmt.Errorf("document %q is not indexed", source)
+				}
+				return content, nil
+			},
+		},
+		{
+			Name:        "embed_text",
+			Description: "Returns the embedding vector of a text.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"text":  map[string]interface{}{"type": "string"},
+					"model": map[string]interface{}{"type": "string", "enum": stringsToInterfaces(m.orus.EmbedderNames()), "description": "Embedding model, bge-m3 by default"},
+				},
+				"required": []interface{}{"text"},
+			},
+			Run: func(ctx context.Context, arguments map[string]interface{}) (string, error) {
+				input, _ := arguments["text"].(string)
+				model, _ := arguments["model"].(string)
+				if model == "" {
+					model = DefaultRAGEmbedModel
+				}
+				vector, err := m.orus.Embed(model, input)
+				if err != nil {
+					return "", err
+				}
+				return text(map[string]interface{}{"model": model, "dimensions": len(vector), "embedding": vector})
+			},
+		},
+		{
+			Name:        "recall_memory",
+			Description: "Recalls the long-term memories of an agent and user relevant to a query.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"agent_id": map[string]interface{}{"type": "string"},
+					"user_id":  map[string]interface{}{"type": "string"},
+					"query":    map[string]interface{}{"type": "string"},
+				},
+				"required": []interface{}{"agent_id", "user_id", "query"},
+			},
+			Run: func(ctx context.Context, arguments map[string]interface{}) (string, error) {
+				agentID, _ := arguments["agent_id"].(string)
+				userID, _ := arguments["user_id"].(string)
+				query, _ := arguments["query"].(string)
+				memories, err := m.orus.Memory.Recall(agentID, userID, query)
+				if err != nil {
+					return "", err
+				}
+				if len(memories) == 0 {
+					return "No relevant memory.", nil
+				}
+				return MemoryMessage(memories).Content, nil
+			},
+		},
+		{
+			Name:        "remember",
+			Description: "Stores facts in the long-term memory of an agent and user. Near-duplicates of existing memories are skipped.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"agent_id": map[string]interface{}{"type": "string"},
+					"user_id":  map[string]interface{}{"type": "string"},
+					"facts":    map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "minItems": 1.0},
+				},
+				"required": []interface{}{"agent_id", "user_id", "facts"},
+			},
+			Run: func(ctx context.Context, arguments map[string]interface{}) (string, error) {
+				agentID, _ := arguments["agent_id"].(string)
+				userID, _ := arguments["user_id"].(string)
+				var facts []string
+				for _, fact := range arguments["facts"].([]interface{}) {
+					facts = append(facts, fact.(string))
+				}
+				stored, err := m.orus.Memory.Remember(agentID, userID, facts...)
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("Stored %d of %d facts.", len(stored), len(facts)), nil
+			},
+		},
+	}
+}
+
+func stringsToInterfaces(values []string) []interface{} {
+	result := make([]interface{}, len(values))
+	for i, value := range values {
+		result[i] = value
+	}
+	return result
+}
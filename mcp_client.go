@@ -0,0 +1,477 @@
+package orus
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultMCPTimeout bounds the connection to an MCP server and each of its
+// tool calls.
+const DefaultMCPTimeout = 30 * time.Second
+
+// mcpToolSeparator joins the server and tool names of an external tool, so
+// tools of different servers do not clash.
+const mcpToolSeparator = "__"
+
+// MCPServerConfig is an external MCP server whose tools are offered to the
+// models. It is started as a process speaking on stdio when Command is set,
+// or reached over streamable HTTP at URL.
+type MCPServerConfig struct {
+	Name    string            `json:"name"`
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Timeout is a duration such as "10s"; empty is DefaultMCPTimeout.
+	Timeout string `json:"timeout,omitempty"`
+	// Tools limits the tools taken from the server; empty takes them all.
+	Tools []string `json:"tools,omitempty"`
+}
+
+// mcpTransport carries the JSON-RPC messages of an MCP client.
+type mcpTransport interface {
+	// call sends a request and returns the result of its answer.
+	call(ctx context.Context, request jsonRPCRequest) (json.RawMessage, error)
+	notify(ctx context.Context, request jsonRPCRequest) error
+	close() error
+}
+
+// MCPClient is a connection to an external MCP server.
+type MCPClient struct {
+	config    MCPServerConfig
+	timeout   time.Duration
+	transport mcpTransport
+	nextID    atomic.Int64
+}
+
+type mcpRemoteTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+}
+
+// ConnectMCP starts or reaches the server of config and initializes the
+// session.
+func ConnectMCP(ctx context.Context, config MCPServerConfig) (*MCPClient, error) {
+	if !toolNamePattern.MatchString(config.Name) || strings.Contains(config.Name, mcpToolSeparator) {
+		return nil, fmt.Errorf("mcp server name %q must be letters, digits, '_' or '-', without %q", config.Name, mcpToolSeparator)
+	}
+	timeout := DefaultMCPTimeout
+	if config.Timeout != "" {
+		parsed, err := time.ParseDuration(config.Timeout)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("mcp server %q: invalid timeout %q", config.Name, config.Timeout)
+		}
+		timeout = parsed
+	}
+	client := &MCPClient{config: config, timeout: timeout}
+	switch {
+	case config.Command != "" && config.URL != "":
+		return nil, fmt.Errorf("mcp server %q: set either a command or a url", config.Name)
+	case config.Command != "":
+		transport, err := startMCPProcess(config)
+		if err != nil {
+			return nil, fmt.Errorf("mcp server %q: %w", config.Name, err)
+		}
+		client.transport = transport
+	case config.URL != "":
+		client.transport = &mcpHTTPTransport{url: config.URL, headers: config.Headers, client: &http.Client{}}
+	default:
+		return nil, fmt.Errorf("mcp server %q: a command or a url is required", config.Name)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	_, err := client.request(ctx, "initialize", map[string]interface{}{
+		"protocolVersion": MCPProtocolVersion,
+		"capabilities":    map[string]interface{}{},
+		"clientInfo":      map[string]interface{}{"name": "orus", "version": "1.0.0"},
+	})
+	if err == nil {
+		err = client.transport.notify(ctx, jsonRPCRequest{JSONRPC: "2.0", Method: "notifications/initialized"})
+	}
+	if err != nil {
+		_ = client.transport.close()
+		return nil, fmt.Errorf("mcp server %q: error initializing: %w", config.Name, err)
+	}
+	return client, nil
+}
+
+func (c *MCPClient) request(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := json.Marshal(c.nextID.Add(1))
+	return c.transport.call(ctx, jsonRPCRequest{JSONRPC: "2.0", ID: id, Method: method, Params: data})
+}
+
+// Tools lists the tools of the server as Orus tools named
+// <server>__<tool>.
+func (c *MCPClient) Tools(ctx context.Context) ([]Tool, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	var remote []mcpRemoteTool
+	cursor := ""
+	for {
+		params := map[string]interface{}{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		result, err := c.request(ctx, "tools/list", params)
+		if err != nil {
+			return nil, fmt.Errorf("mcp server %q: error listing tools: %w", c.config.Name, err)
+		}
+		var page struct {
+			Tools      []mcpRemoteTool `json:"tools"`
+			NextCursor string          `json:"nextCursor"`
+		}
+		if err := json.Unmarshal(result, &page); err != nil {
+			return nil, fmt.Errorf("mcp server %q: error decoding tools: %w", c.config.Name, err)
+		}
+		remote = append(remote, page.Tools...)
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	tools := make([]Tool, 0, len(remote))
+	for _, tool := range remote {
+		if len(c.config.Tools) > 0 && !contains(c.config.Tools, tool.Name) {
+			continue
+		}
+		name := c.config.Name + mcpToolSeparator + tool.Name
+		if !toolNamePattern.MatchString(name) {
+			log.Printf("Skipping MCP tool %q of %s: the name is not usable by the models", tool.Name, c.config.Name)
+			continue
+		}
+		remoteName := tool.Name
+		tools = append(tools, Tool{
+			Name:        name,
+			Description: tool.Description,
+			Parameters:  tool.InputSchema,
+			fromFile:    true,
+			Run: func(ctx context.Context, arguments map[string]interface{}) (string, error) {
+				return c.CallTool(ctx, remoteName, arguments)
+			},
+		})
+	}
+	return tools, nil
+}
+
+// CallTool runs a tool of the server and returns its text content. A tool
+// result flagged isError is returned as an error.
+func (c *MCPClient) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	result, err := c.request(ctx, "tools/call", map[string]interface{}{"name": name, "arguments": arguments})
+	if err != nil {
+		return "", err
+	}
+	var call struct {
+		Content []struct {
+			Type     string          `json:"type"`
+			Text     string          `json:"text"`
+			Resource json.RawMessage `json:"resource"`
+		} `json:"content"`
+		StructuredContent json.RawMessage `json:"structuredContent"`
+		IsError           bool            `json:"isError"`
+	}
+	if err := json.Unmarshal(result, &call); err != nil {
+		return "", fmt.Errorf("error decoding tool result: %w", err)
+	}
+	parts := make([]string, 0, len(call.Content))
+	for _, content := range call.Content {
+		switch content.Type {
+		case "text":
+			parts = append(parts, content.Text)
+		case "resource":
+			parts = append(parts, string(content.Resource))
+		default:
+			parts = append(parts, fmt.Sprintf("[%s content omitted]", content.Type))
+		}
+	}
+	if len(parts) == 0 && len(call.StructuredContent) > 0 {
+		parts = append(parts, string(call.StructuredContent))
+	}
+	text := strings.Join(parts, "\n")
+	if call.IsError {
+		return "", errors.New(text)
+	}
+	return text, nil
+}
+
+func (c *MCPClient) Close() error {
+	return c.transport.close()
+}
+
+// mcpProcess is an MCP server started as a child process, exchanging
+// newline-delimited JSON-RPC messages on its stdin and stdout.
+type mcpProcess struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	pending map[string]chan jsonRPCResponse
+	// done is closed with err set when the process stops answering.
+	done chan struct{}
+	err  error
+}
+
+func startMCPProcess(config MCPServerConfig) (*mcpProcess, error) {
+	cmd := exec.Command(config.Command, config.Args...)
+	cmd.Env = os.Environ()
+	for name, value := range config.Env {
+		cmd.Env = append(cmd.Env, name+"="+os.ExpandEnv(value))
+	}
+	// The server logs on stderr
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("error starting %s: %w", config.Command, err)
+	}
+	process := &mcpProcess{
+		cmd:     cmd,
+		stdin:   stdin,
+		pending: make(map[string]chan jsonRPCResponse),
+		done:    make(chan struct{}),
+	}
+	go process.read(stdout)
+	return process, nil
+}
+
+// read dispatches the answers of the process to the pending calls, until
+// its stdout closes.
+func (p *mcpProcess) read(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for scanner.Scan() {
+		var response jsonRPCResponse
+		if err := json.Unmarshal(scanner.Bytes(), &response); err != nil || len(response.ID) == 0 {
+			// Server requests and notifications are not supported
+			continue
+		}
+		p.mu.Lock()
+		answer, ok := p.pending[string(response.ID)]
+		delete(p.pending, string(response.ID))
+		p.mu.Unlock()
+		if ok {
+			answer <- response
+		}
+	}
+	err := scanner.Err()
+	if err == nil {
+		err = errors.New("the server exited")
+	}
+	p.err = err
+	close(p.done)
+	_ = p.cmd.Wait()
+}
+
+func (p *mcpProcess) call(ctx context.Context, request jsonRPCRequest) (json.RawMessage, error) {
+	answer := make(chan jsonRPCResponse, 1)
+	p.mu.Lock()
+	p.pending[string(request.ID)] = answer
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.pending, string(request.ID))
+		p.mu.Unlock()
+	}()
+	if err := p.send(request); err != nil {
+		return nil, err
+	}
+	select {
+	case response := <-answer:
+		return mcpResult(response)
+	case <-p.done:
+		return nil, p.err
+	case <-ctx.Done():
+		_ = p.send(jsonRPCRequest{JSONRPC: "2.0", Method: "notifications/cancelled",
+			Params: json.RawMessage(fmt.Sprintf(`{"requestId":%s}`, request.ID))})
+		return nil, ctx.Err()
+	}
+}
+
+func (p *mcpProcess) notify(ctx context.Context, request jsonRPCRequest) error {
+	return p.send(request)
+}
+
+func (p *mcpProcess) send(request jsonRPCRequest) error {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	_, err = p.stdin.Write(append(data, '\n'))
+	return err
+}
+
+// close closes the stdin of the process, which ends a well-behaved server,
+// and kills it when it is still running a few seconds later.
+func (p *mcpProcess) close() error {
+	err := p.stdin.Close()
+	select {
+	case <-p.done:
+	case <-time.After(5 * time.Second):
+		_ = p.cmd.Process.Kill()
+	}
+	return err
+}
+
+// mcpHTTPTransport reaches an MCP server over streamable HTTP.
+type mcpHTTPTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+
+	mu sync.Mutex
+	// session is the Mcp-Session-Id given by the server on initialize.
+	session string
+}
+
+func (t *mcpHTTPTransport) call(ctx context.Context, request jsonRPCRequest) (json.RawMessage, error) {
+	response, err := t.post(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if session := response.Header.Get("Mcp-Session-Id"); session != "" {
+		t.mu.Lock()
+		t.session = session
+		t.mu.Unlock()
+	}
+	if strings.HasPrefix(response.Header.Get("Content-Type"), "text/event-stream") {
+		return t.readEvents(response.Body, request.ID)
+	}
+	var answer jsonRPCResponse
+	if err := json.NewDecoder(response.Body).Decode(&answer); err != nil {
+		return nil, fmt.Errorf("error decoding answer: %w", err)
+	}
+	return mcpResult(answer)
+}
+
+// readEvents waits for the answer to id among the events of a streamed
+// answer.
+func (t *mcpHTTPTransport) readEvents(body io.Reader, id json.RawMessage) (json.RawMessage, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	data := &bytes.Buffer{}
+	for scanner.Scan() {
+		line := scanner.Text()
+		if value, ok := strings.CutPrefix(line, "data:"); ok {
+			data.WriteString(strings.TrimPrefix(value, " "))
+			continue
+		}
+		if line != "" || data.Len() == 0 {
+			continue
+		}
+		var answer jsonRPCResponse
+		if err := json.Unmarshal(data.Bytes(), &answer); err == nil && bytes.Equal(answer.ID, id) {
+			return mcpResult(answer)
+		}
+		data.Reset()
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("the stream ended without an answer")
+}
+
+func (t *mcpHTTPTransport) notify(ctx context.Context, request jsonRPCRequest) error {
+	response, err := t.post(ctx, request)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, response.Body)
+	return response.Body.Close()
+}
+
+func (t *mcpHTTPTransport) post(ctx context.Context, request jsonRPCRequest) (*http.Response, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json, text/event-stream")
+	httpReq.Header.Set("MCP-Protocol-Version", MCPProtocolVersion)
+	for name, value := range t.headers {
+		httpReq.Header.Set(name, os.ExpandEnv(value))
+	}
+	t.mu.Lock()
+	if t.session != "" {
+		httpReq.Header.Set("Mcp-Session-Id", t.session)
+	}
+	t.mu.Unlock()
+	response, err := t.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("error making request: %w", err)
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		response.Body.Close()
+		return nil, fmt.Errorf("mcp server answered status %d: %s", response.StatusCode, body)
+	}
+	return response, nil
+}
+
+// close ends the session, which servers without sessions ignore.
+func (t *mcpHTTPTransport) close() error {
+	t.mu.Lock()
+	session := t.session
+	t.mu.Unlock()
+	if session == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodDelete, t.url, nil)
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Mcp-Session-Id", session)
+	response, err := t.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+func mcpResult(response jsonRPCResponse) (json.RawMessage, error) {
+	if response.Error != nil {
+		return nil, fmt.Errorf("mcp error %d: %s", response.Error.Code, response.Error.Message)
+	}
+	data, err := json.Marshal(response.Result)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
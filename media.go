@@ -0,0 +1,117 @@
+package orus
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Dsouza10082/orus/ollama"
+)
+
+const (
+	// MediaImage is the type of image media.
+	MediaImage          = "image"
+	DefaultRAGMediaDir  = "./rag_media/"
+	DefaultRAGMaxImages = MaxImages
+)
+
+const captionPrompt = `Describe this image for a search index: what it shows, and any text, labels, numbers or axes it has. Answer with the description only.`
+
+// ErrMediaNotFound is returned for media that is not in the store.
+var ErrMediaNotFound = errors.New("the media does not exist")
+
+// MediaRef is a media file a document refers to, such as a figure of the
+// page a chunk comes from.
+type MediaRef struct {
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	ContentType string `json:"content_type"`
+	// Page is the page of the document the media was found on.
+	Page int `json:"page,omitempty"`
+	// Caption describes the media, when a caption model is configured.
+	Caption string `json:"caption,omitempty"`
+	// Record is the document indexing the media on its own, when it could
+	// be embedded.
+	Record string `json:"record,omitempty"`
+}
+
+// MediaStore keeps the media of the indexed documents in a blob store.
+// Media are named by their content, so a figure found in several documents
+// is stored once.
+type MediaStore struct {
+	blobs BlobStore
+}
+
+// NewMediaStore keeps the media in dir, or in S3 with the s3 blob backend.
+func NewMediaStore(config BlobConfig, dir string) (*MediaStore, error) {
+	if dir == "" {
+		dir = DefaultRAGMediaDir
+	}
+	blobs, err := OpenBlobStore(config, "media", dir)
+	if err != nil {
+		return nil, fmt.Errorf("error creating media store: %w", err)
+	}
+	return &MediaStore{blobs: blobs}, nil
+}
+
+// Put stores an image and returns its reference.
+func (m *MediaStore) Put(data []byte) (MediaRef, error) {
+	sum := sha256.Sum256(data)
+	ref := MediaRef{
+		ID:          hex.EncodeToString(sum[:16]),
+		Type:        MediaImage,
+		ContentType: http.DetectContentType(data),
+	}
+	if _, err := m.blobs.Stat(ref.ID); err == nil {
+		return ref, nil
+	}
+	if err := m.blobs.Put(ref.ID, data, ref.ContentType); err != nil {
+		return MediaRef{}, fmt.Errorf("error storing media: %w", err)
+	}
+	return ref, nil
+}
+
+func (m *MediaStore) Get(id string) ([]byte, error) {
+	if !isMediaID(id) {
+		return nil, ErrMediaNotFound
+	}
+	data, err := m.blobs.Get(id)
+	if errors.Is(err, ErrBlobNotFound) {
+		return nil, ErrMediaNotFound
+	}
+	return data, err
+}
+
+func (m *MediaStore) Delete(id string) error {
+	if !isMediaID(id) {
+		return ErrMediaNotFound
+	}
+	return m.blobs.Delete(id)
+}
+
+func isMediaID(id string) bool {
+	decoded, err := hex.DecodeString(id)
+	return err == nil && len(decoded) == 16
+}
+
+// CaptionImage has the vision model describe an image, so it can be found
+// by text.
+func (s *Orus) CaptionImage(ctx context.Context, model string, data []byte) (string, error) {
+	response, err := s.Backend.WithContext(ctx).Chat(ollama.ChatRequest{
+		Model: model,
+		Messages: []ollama.Message{{
+			Role:    "user",
+			Content: captionPrompt,
+			Images:  []string{base64.StdEncoding.EncodeToString(data)},
+		}},
+		Options: map[string]interface{}{"temperature": 0},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error captioning image with %s: %w", model, err)
+	}
+	return response.Message.Content, nil
+}
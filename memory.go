@@ -0,0 +1,201 @@
+package orus
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Dsouza10082/orus/ollama"
+)
+
+const (
+	MemoryCollection          = "agent_memory"
+	MemoryFileName            = "orus_memory.json"
+	DefaultMemoryModel        = "bge-m3"
+	DefaultMemoryLimit        = 5
+	DefaultMemorySimilarity   = 0.55
+	memoryDuplicateSimilarity = 0.95
+)
+
+const memoryExtractionPrompt = `You extract long-term memories from a conversation.
+Return only durable, salient facts worth remembering in future conversations:
+user preferences, personal details the user shared, decisions, goals and ongoing projects.
+Ignore small talk, questions without answers and anything only relevant to this exchange.
+Write each fact as a short standalone sentence in the third person.
+Respond with JSON in the form {"facts": ["..."]}. Use an empty list when there is nothing to remember.`
+
+// AgentMemory stores salient facts from conversations in a dedicated vector
+// collection, scoped by agent and user, and recalls the relevant ones for new prompts.
+type AgentMemory struct {
+	orus          *Orus
+	store         *VectorStore
+	path          string
+	EmbedModel    string
+	Limit         int
+	MinSimilarity float64
+	saveMu        sync.Mutex
+}
+
+// NewAgentMemory creates the memory module. When dir is not empty the
+// collection is loaded from and persisted to a JSON file inside it.
+func NewAgentMemory(orus *Orus, store *VectorStore, dir string) *AgentMemory {
+	memory := &AgentMemory{
+		orus:          orus,
+		store:         store,
+		EmbedModel:    DefaultMemoryModel,
+		Limit:         DefaultMemoryLimit,
+		MinSimilarity: DefaultMemorySimilarity,
+	}
+	if dir != "" {
+		memory.path = filepath.Join(dir, MemoryFileName)
+		if err := store.Load(MemoryCollection, memory.path); err != nil {
+			log.Println("Error loading agent memory: ", err)
+		}
+	}
+	return memory
+}
+
+func (m *AgentMemory) SetEmbedModel(model string) *AgentMemory {
+	if model != "" {
+		m.EmbedModel = model
+	}
+	return m
+}
+
+func memoryFilter(agentID, userID string) func(Document) bool {
+	return func(document Document) bool {
+		return document.Metadata["agent_id"] == agentID && document.Metadata["user_id"] == userID
+	}
+}
+
+// Extract asks the model for the salient facts of an exchange.
+func (m *AgentMemory) Extract(model string, messages []ollama.Message) ([]string, error) {
+	transcript := &strings.Builder{}
+	for _, message := range messages {
+		if message.Role == "system" {
+			continue
+		}
+		fmt.Fprintf(transcript, "%s: %s\n", message.Role, message.Content)
+	}
+	response, err := m.orus.Backend.Chat(ollama.ChatRequest{
+		Model: model,
+		Messages: []ollama.Message{
+			{Role: "system", Content: memoryExtractionPrompt},
+			{Role: "user", Content: transcript.String()},
+		},
+		Format: ollama.FormatJSON,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var extracted struct {
+		Facts []string `json:"facts"`
+	}
+	if err := json.Unmarshal([]byte(response.Message.Content), &extracted); err != nil {
+		return nil, fmt.Errorf("error decoding extracted facts: %w", err)
+	}
+	facts := make([]string, 0, len(extracted.Facts))
+	for _, fact := range extracted.Facts {
+		if fact = strings.TrimSpace(fact); fact != "" {
+			facts = append(facts, fact)
+		}
+	}
+	return facts, nil
+}
+
+// Remember embeds and stores facts for the agent/user pair, skipping
+// facts that are near-duplicates of an existing memory.
+func (m *AgentMemory) Remember(agentID, userID string, facts ...string) ([]Document, error) {
+	filter := memoryFilter(agentID, userID)
+	stored := make([]Document, 0, len(facts))
+	for _, fact := range facts {
+		vector, err := m.orus.Embed(m.EmbedModel, fact)
+		if err != nil {
+			return stored, err
+		}
+		if existing := m.store.Search(MemoryCollection, vector, 1, filter); len(existing) > 0 && existing[0].Similarity >= memoryDuplicateSimilarity {
+			continue
+		}
+		documents := m.store.Add(MemoryCollection, Document{
+			Content:   fact,
+			Embedding: vector,
+			Metadata: map[string]interface{}{
+				"agent_id": agentID,
+				"user_id":  userID,
+				"model":    m.EmbedModel,
+			},
+		})
+		stored = append(stored, documents...)
+	}
+	if len(stored) > 0 {
+		m.save()
+	}
+	return stored, nil
+}
+
+// RememberConversation extracts facts from the exchange with model and stores them.
+func (m *AgentMemory) RememberConversation(agentID, userID, model string, messages []ollama.Message) ([]Document, error) {
+	facts, err := m.Extract(model, messages)
+	if err != nil {
+		return nil, err
+	}
+	return m.Remember(agentID, userID, facts...)
+}
+
+// Recall returns the memories of the agent/user pair most relevant to query.
+func (m *AgentMemory) Recall(agentID, userID, query string) ([]SearchResult, error) {
+	vector, err := m.orus.Embed(m.EmbedModel, query)
+	if err != nil {
+		return nil, err
+	}
+	results := m.store.Search(MemoryCollection, vector, m.Limit, memoryFilter(agentID, userID))
+	relevant := results[:0]
+	for _, result := range results {
+		if result.Similarity >= m.MinSimilarity {
+			relevant = append(relevant, result)
+		}
+	}
+	return relevant, nil
+}
+
+func (m *AgentMemory) List(agentID, userID string) []Document {
+	return m.store.Documents(MemoryCollection, memoryFilter(agentID, userID))
+}
+
+// Forget removes the memories of ids that belong to the agent/user pair;
+// the memories of other pairs are left alone.
+func (m *AgentMemory) Forget(agentID, userID string, ids ...string) int {
+	inScope := memoryFilter(agentID, userID)
+	removed := m.store.DeleteWhere(MemoryCollection, func(document Document) bool {
+		return slices.Contains(ids, document.ID) && inScope(document)
+	})
+	if removed > 0 {
+		m.save()
+	}
+	return removed
+}
+
+func (m *AgentMemory) save() {
+	if m.path == "" {
+		return
+	}
+	m.saveMu.Lock()
+	defer m.saveMu.Unlock()
+	if err := m.store.Save(MemoryCollection, m.path); err != nil {
+		log.Println("Error saving agent memory: ", err)
+	}
+}
+
+// MemoryMessage renders recalled memories as a system message to prepend to a chat.
+func MemoryMessage(memories []SearchResult) ollama.Message {
+	sb := &strings.Builder{}
+	sb.WriteString("Relevant memories from previous conversations with this user:\n")
+	for _, memory := range memories {
+		fmt.Fprintf(sb, "- %s\n", memory.Document.Content)
+	}
+	return ollama.Message{Role: "system", Content: sb.String()}
+}
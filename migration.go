@@ -0,0 +1,144 @@
+package orus
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// How a storage whose schema lacks migrations is opened at startup.
+const (
+	// MigrateAuto applies the migrations the schema lacks.
+	MigrateAuto = "auto"
+	// MigrateDryRun logs the migrations the schema lacks and applies none,
+	// so the storage is not opened until they are applied.
+	MigrateDryRun = "dry-run"
+	// MigrateOff applies none, leaving them to `orus-api migrate`.
+	MigrateOff = "off"
+)
+
+var (
+	// ErrSchemaBehind is returned when opening a storage lacking migrations
+	// without applying them.
+	ErrSchemaBehind = errors.New("the storage schema lacks migrations")
+	// ErrSchemaAhead is returned when opening a storage migrated by a later
+	// version of the server, which has to roll it back first.
+	ErrSchemaAhead = errors.New("the storage schema is newer than this server")
+)
+
+// Migration is a versioned change of the schema of a storage. Applying it
+// brings the schema from the previous version to Version, and reverting it
+// back.
+type Migration struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+}
+
+// MigrationPlan is what bringing the schema of a storage from its Current
+// version to the Target one does: the migrations to Apply in order when
+// going up, or to Revert in order when going down.
+type MigrationPlan struct {
+	Current int         `json:"current"`
+	Target  int         `json:"target"`
+	Apply   []Migration `json:"apply,omitempty"`
+	Revert  []Migration `json:"revert,omitempty"`
+}
+
+// Empty reports whether the schema is at the target version already.
+func (p MigrationPlan) Empty() bool {
+	return len(p.Apply) == 0 && len(p.Revert) == 0
+}
+
+func (p MigrationPlan) String() string {
+	if p.Empty() {
+		return fmt.Sprintf("schema at version %d, nothing to migrate", p.Current)
+	}
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "schema from version %d to %d:", p.Current, p.Target)
+	for _, migration := range p.Apply {
+		fmt.Fprintf(sb, "\n  apply %d %s", migration.Version, migration.Name)
+	}
+	for _, migration := range p.Revert {
+		fmt.Fprintf(sb, "\n  revert %d %s", migration.Version, migration.Name)
+	}
+	return sb.String()
+}
+
+// Migrator is a storage whose schema is versioned by migrations, such as
+// the SQL and key-value storages.
+type Migrator interface {
+	// Plan returns what migrating the schema to target does, without doing
+	// it. A negative target is the latest version.
+	Plan(target int) (MigrationPlan, error)
+	// Migrate applies or reverts the migrations bringing the schema to
+	// target, each in a transaction of its own, and returns what it did.
+	Migrate(target int) (MigrationPlan, error)
+	Close() error
+}
+
+// OpenMigrator opens the storage of config without migrating it, to plan or
+// run its migrations, such as a rollback before a downgrade.
+func OpenMigrator(config StorageConfig) (Migrator, error) {
+	switch {
+	case config.Enabled():
+		return openSQLStore(config)
+	case IsKVStorage(config.Driver):
+		return openKVStore(config)
+	}
+	return nil, fmt.Errorf("storage driver %q keeps no schema", config.Driver)
+}
+
+// planMigrations returns the plan bringing a schema at version current to
+// target among migrations, sorted by version.
+func planMigrations(migrations []Migration, current, target int) (MigrationPlan, error) {
+	latest := 0
+	if len(migrations) > 0 {
+		latest = migrations[len(migrations)-1].Version
+	}
+	if target < 0 {
+		target = latest
+	}
+	plan := MigrationPlan{Current: current, Target: target}
+	if current > latest {
+		return plan, fmt.Errorf("%w: it is at version %d, this server knows up to %d; roll it back with the migrate command of the later version",
+			ErrSchemaAhead, current, latest)
+	}
+	if target > latest {
+		return plan, fmt.Errorf("unknown schema version %d, the latest is %d", target, latest)
+	}
+	for _, migration := range migrations {
+		if migration.Version > current && migration.Version <= target {
+			plan.Apply = append(plan.Apply, migration)
+		}
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		if migration := migrations[i]; migration.Version <= current && migration.Version > target {
+			plan.Revert = append(plan.Revert, migration)
+		}
+	}
+	return plan, nil
+}
+
+// migrateOnOpen brings the schema of a storage being opened to the latest
+// version as mode allows.
+func migrateOnOpen(migrator Migrator, mode string) error {
+	plan, err := migrator.Plan(-1)
+	if err != nil {
+		return err
+	}
+	if plan.Empty() {
+		return nil
+	}
+	switch mode {
+	case MigrateDryRun:
+		log.Printf("Storage migrations not applied (dry run), %s", plan)
+		return fmt.Errorf("%w: %d migrations to apply, dry run", ErrSchemaBehind, len(plan.Apply))
+	case MigrateOff:
+		return fmt.Errorf("%w: %d migrations to apply, run orus-api migrate", ErrSchemaBehind, len(plan.Apply))
+	}
+	if _, err := migrator.Migrate(-1); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,306 @@
+package orus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Dsouza10082/orus/ollama"
+)
+
+// The bucket upper bounds of the distributions of the model stats.
+var (
+	LatencyBuckets         = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60, 120, 300}
+	FirstTokenBuckets      = []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10, 30}
+	TokensPerSecondBuckets = []float64{1, 2.5, 5, 10, 15, 20, 30, 40, 60, 80, 100, 150, 200, 300}
+)
+
+// ModelCall is a chat answered by a model, as timed by the backend.
+type ModelCall struct {
+	Model string
+	// Latency is the time from the call to the end of the reply.
+	Latency time.Duration
+	// FirstToken is the time to the first chunk with content of a streamed
+	// chat, or the load and prompt evaluation times Ollama reports for a
+	// chat answered at once; 0 when unknown.
+	FirstToken time.Duration
+	// EvalDuration is the generation time Ollama reports; when it does not,
+	// as Ollama Cloud may not, the speed is measured from FirstToken on.
+	EvalDuration     time.Duration
+	PromptTokens     int
+	CompletionTokens int
+	Err              error
+}
+
+// TokensPerSecond is the generation speed of the call, or 0 when it is
+// unknown.
+func (c ModelCall) TokensPerSecond() float64 {
+	generation := c.EvalDuration
+	if generation <= 0 && c.FirstToken > 0 {
+		generation = c.Latency - c.FirstToken
+	}
+	if generation <= 0 || c.CompletionTokens == 0 {
+		return 0
+	}
+	return float64(c.CompletionTokens) / generation.Seconds()
+}
+
+// histogram counts observations in buckets of upper bounds, as Prometheus
+// does. It is guarded by the lock of its ModelStats.
+type histogram struct {
+	bounds []float64
+	// counts has a count per bound, and a last one for the observations
+	// above every bound.
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(value float64) {
+	h.counts[sort.SearchFloat64s(h.bounds, value)]++
+	h.count++
+	h.sum += value
+}
+
+// quantile estimates the q quantile by interpolating within its bucket, as
+// histogram_quantile does. It returns the highest bound when the quantile
+// is above every bound, and 0 without observations.
+func (h *histogram) quantile(q float64) float64 {
+	if h.count == 0 {
+		return 0
+	}
+	rank := q * float64(h.count)
+	var cumulative uint64
+	for i, count := range h.counts {
+		if float64(cumulative+count) < rank || count == 0 {
+			cumulative += count
+			continue
+		}
+		if i == len(h.bounds) {
+			return h.bounds[len(h.bounds)-1]
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = h.bounds[i-1]
+		}
+		return lower + (h.bounds[i]-lower)*(rank-float64(cumulative))/float64(count)
+	}
+	return h.bounds[len(h.bounds)-1]
+}
+
+// HistogramBucket is a bucket of a distribution; Count is cumulative, so
+// the bucket "+Inf" counts every observation.
+type HistogramBucket struct {
+	Le    string `json:"le" swaggertype:"string" example:"2.5"`
+	Count uint64 `json:"count" swaggertype:"integer" example:"12"`
+}
+
+// Distribution summarizes a histogram.
+type Distribution struct {
+	Count   uint64            `json:"count" swaggertype:"integer" example:"42"`
+	Mean    float64           `json:"mean" swaggertype:"number" example:"3.2"`
+	P50     float64           `json:"p50" swaggertype:"number" example:"2.8"`
+	P90     float64           `json:"p90" swaggertype:"number" example:"6.1"`
+	P99     float64           `json:"p99" swaggertype:"number" example:"9.7"`
+	Buckets []HistogramBucket `json:"buckets"`
+}
+
+func (h *histogram) distribution() Distribution {
+	d := Distribution{
+		Count:   h.count,
+		P50:     h.quantile(0.5),
+		P90:     h.quantile(0.9),
+		P99:     h.quantile(0.99),
+		Buckets: make([]HistogramBucket, 0, len(h.counts)),
+	}
+	if h.count > 0 {
+		d.Mean = h.sum / float64(h.count)
+	}
+	var cumulative uint64
+	for i, count := range h.counts {
+		cumulative += count
+		d.Buckets = append(d.Buckets, HistogramBucket{Le: h.bucketLabel(i), Count: cumulative})
+	}
+	return d
+}
+
+func (h *histogram) bucketLabel(i int) string {
+	if i == len(h.bounds) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(h.bounds[i], 'g', -1, 64)
+}
+
+// ModelStat is what the stats know of a model since the server started.
+type ModelStat struct {
+	Model            string `json:"model" swaggertype:"string" example:"llama3.1:8b"`
+	Requests         int    `json:"requests" swaggertype:"integer" example:"42"`
+	Errors           int    `json:"errors" swaggertype:"integer" example:"1"`
+	PromptTokens     int    `json:"prompt_tokens" swaggertype:"integer" example:"12800"`
+	CompletionTokens int    `json:"completion_tokens" swaggertype:"integer" example:"9000"`
+	// The distributions count the calls that succeeded; the time to first
+	// token and the speed only those where they are known.
+	Latency         Distribution `json:"latency_seconds"`
+	FirstToken      Distribution `json:"time_to_first_token_seconds"`
+	TokensPerSecond Distribution `json:"tokens_per_second"`
+}
+
+type modelStat struct {
+	requests         int
+	errors           int
+	promptTokens     int
+	completionTokens int
+	latency          *histogram
+	firstToken       *histogram
+	tokensPerSecond  *histogram
+}
+
+// ModelStats keeps the latency, time to first token and generation speed
+// of the chats of each model, in memory since the server started.
+type ModelStats struct {
+	mu     sync.Mutex
+	models map[string]*modelStat
+}
+
+func NewModelStats() *ModelStats {
+	return &ModelStats{models: make(map[string]*modelStat)}
+}
+
+// Observe counts call. Canceled calls are left out: their latency is the
+// one of the caller.
+func (s *ModelStats) Observe(call ModelCall) {
+	if errors.Is(call.Err, context.Canceled) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stat, ok := s.models[call.Model]
+	if !ok {
+		stat = &modelStat{
+			latency:         newHistogram(LatencyBuckets),
+			firstToken:      newHistogram(FirstTokenBuckets),
+			tokensPerSecond: newHistogram(TokensPerSecondBuckets),
+		}
+		s.models[call.Model] = stat
+	}
+	stat.requests++
+	if call.Err != nil {
+		stat.errors++
+		return
+	}
+	stat.promptTokens += call.PromptTokens
+	stat.completionTokens += call.CompletionTokens
+	stat.latency.observe(call.Latency.Seconds())
+	if call.FirstToken > 0 {
+		stat.firstToken.observe(call.FirstToken.Seconds())
+	}
+	if speed := call.TokensPerSecond(); speed > 0 {
+		stat.tokensPerSecond.observe(speed)
+	}
+}
+
+// Snapshot returns the stats of every model, by name.
+func (s *ModelStats) Snapshot() []ModelStat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := make([]ModelStat, 0, len(s.models))
+	for model, stat := range s.models {
+		stats = append(stats, ModelStat{
+			Model:            model,
+			Requests:         stat.requests,
+			Errors:           stat.errors,
+			PromptTokens:     stat.promptTokens,
+			CompletionTokens: stat.completionTokens,
+			Latency:          stat.latency.distribution(),
+			FirstToken:       stat.firstToken.distribution(),
+			TokensPerSecond:  stat.tokensPerSecond.distribution(),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Model < stats[j].Model })
+	return stats
+}
+
+// WritePrometheus writes the stats in the Prometheus text format.
+func (s *ModelStats) WritePrometheus(w io.Writer) error {
+	// the text is built under the lock and written after, so a slow scraper
+	// does not hold the chats up
+	out := &bytes.Buffer{}
+	s.mu.Lock()
+	models := make([]string, 0, len(s.models))
+	for model := range s.models {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	counters := []struct {
+		name, help string
+		value      func(stat *modelStat) int
+	}{
+		{"orus_model_requests_total", "Chats sent to the model.", func(stat *modelStat) int { return stat.requests }},
+		{"orus_model_errors_total", "Chats of the model that failed.", func(stat *modelStat) int { return stat.errors }},
+		{"orus_model_prompt_tokens_total", "Prompt tokens evaluated by the model.", func(stat *modelStat) int { return stat.promptTokens }},
+		{"orus_model_completion_tokens_total", "Tokens generated by the model.", func(stat *modelStat) int { return stat.completionTokens }},
+	}
+	for _, metric := range counters {
+		fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s counter\n", metric.name, metric.help, metric.name)
+		for _, model := range models {
+			fmt.Fprintf(out, "%s{model=%s} %d\n", metric.name, prometheusLabel(model), metric.value(s.models[model]))
+		}
+	}
+	histograms := []struct {
+		name, help string
+		of         func(stat *modelStat) *histogram
+	}{
+		{"orus_model_latency_seconds", "Time from a chat to the end of its reply.", func(stat *modelStat) *histogram { return stat.latency }},
+		{"orus_model_time_to_first_token_seconds", "Time from a chat to its first token.", func(stat *modelStat) *histogram { return stat.firstToken }},
+		{"orus_model_tokens_per_second", "Generation speed of a chat.", func(stat *modelStat) *histogram { return stat.tokensPerSecond }},
+	}
+	for _, metric := range histograms {
+		fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s histogram\n", metric.name, metric.help, metric.name)
+		for _, model := range models {
+			h := metric.of(s.models[model])
+			label := prometheusLabel(model)
+			var cumulative uint64
+			for i, count := range h.counts {
+				cumulative += count
+				fmt.Fprintf(out, "%s_bucket{model=%s,le=%q} %d\n", metric.name, label, h.bucketLabel(i), cumulative)
+			}
+			fmt.Fprintf(out, "%s_sum{model=%s} %s\n", metric.name, label, strconv.FormatFloat(h.sum, 'g', -1, 64))
+			fmt.Fprintf(out, "%s_count{model=%s} %d\n", metric.name, label, h.count)
+		}
+	}
+	s.mu.Unlock()
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// prometheusLabel quotes a label value, escaping as the text format wants.
+func prometheusLabel(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
+
+// modelCall returns the call of model that started at start, from its reply
+// or error.
+func modelCall(model string, start time.Time, firstToken time.Duration, resp *ollama.ChatResponse, err error) ModelCall {
+	call := ModelCall{Model: model, Latency: time.Since(start), FirstToken: firstToken, Err: err}
+	if resp == nil {
+		return call
+	}
+	if call.FirstToken <= 0 && resp.PromptEvalDuration > 0 {
+		call.FirstToken = time.Duration(resp.LoadDuration + resp.PromptEvalDuration)
+	}
+	call.EvalDuration = time.Duration(resp.EvalDuration)
+	call.PromptTokens = resp.PromptEvalCount
+	call.CompletionTokens = resp.EvalCount
+	return call
+}
@@ -0,0 +1,334 @@
+package orus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Dsouza10082/orus/ollama"
+)
+
+const (
+	DefaultMonitorInterval    = 30 * time.Second
+	DefaultAlertWindow        = 5 * time.Minute
+	DefaultAlertErrorPercent  = 50
+	DefaultAlertMinRequests   = 10
+	DefaultAlertUnreachableAt = 2
+	monitorProbeTimeout       = 5 * time.Second
+	alertDeliveryTimeout      = 10 * time.Second
+)
+
+// The alerts of the monitor.
+const (
+	// AlertOllamaUnreachable fires when Ollama failed the last probes.
+	AlertOllamaUnreachable = "ollama_unreachable"
+	// AlertErrorRate fires when too many model calls failed in the window.
+	AlertErrorRate = "error_rate"
+)
+
+type MonitorConfig struct {
+	// Interval is the time between two probes of Ollama; 0 disables the
+	// probes, and the unreachable alert with them.
+	Interval time.Duration `yaml:"interval"`
+	// UnreachableAfter is the number of failed probes in a row from which
+	// Ollama is unreachable.
+	UnreachableAfter int `yaml:"unreachable_after"`
+	// Window is the time over which the error rate is computed.
+	Window time.Duration `yaml:"window"`
+	// ErrorPercent is the percentage of failed model calls from which the
+	// error rate alert fires; 0 disables it.
+	ErrorPercent int `yaml:"error_percent"`
+	// MinRequests is the number of model calls in the window below which
+	// the error rate is not judged.
+	MinRequests int `yaml:"min_requests"`
+	// WebhookURL receives the alerts as JSON, signed as the job webhooks
+	// when a webhook secret is set; SlackURL is a Slack incoming webhook.
+	WebhookURL Secret `yaml:"webhook_url"`
+	SlackURL   Secret `yaml:"slack_url"`
+}
+
+// Alert is the state of one alert of the monitor.
+type Alert struct {
+	Name   string `json:"name" swaggertype:"string" example:"ollama_unreachable"`
+	Firing bool   `json:"firing" swaggertype:"boolean" example:"true"`
+	// Since is when the alert last fired or resolved.
+	Since   time.Time `json:"since" swaggertype:"string" example:"2021-01-01T00:00:00Z"`
+	Message string    `json:"message,omitempty" swaggertype:"string"`
+}
+
+// MonitorState is what the monitor knows of the dependencies.
+type MonitorState struct {
+	// Status is "degraded" while an alert fires, "healthy" otherwise.
+	Status string      `json:"status" swaggertype:"string" example:"healthy"`
+	Ollama OllamaState `json:"ollama"`
+	Calls  CallsState  `json:"calls"`
+	Alerts []Alert     `json:"alerts"`
+}
+
+type OllamaState struct {
+	Reachable bool   `json:"reachable" swaggertype:"boolean" example:"true"`
+	Version   string `json:"version,omitempty" swaggertype:"string" example:"0.5.7"`
+	// LastProbe is zero until the first probe.
+	LastProbe time.Time `json:"last_probe" swaggertype:"string" example:"2021-01-01T00:00:00Z"`
+	LastError string    `json:"last_error,omitempty" swaggertype:"string"`
+	// Failures is the number of failed probes in a row.
+	Failures int `json:"consecutive_failures" swaggertype:"integer" example:"0"`
+}
+
+// CallsState counts the model calls of the last window.
+type CallsState struct {
+	Window       string `json:"window" swaggertype:"string" example:"5m0s"`
+	Requests     int    `json:"requests" swaggertype:"integer" example:"120"`
+	Errors       int    `json:"errors" swaggertype:"integer" example:"3"`
+	ErrorPercent int    `json:"error_percent" swaggertype:"integer" example:"2"`
+}
+
+// AlertNotification is posted to the alert URLs when an alert fires or
+// resolves.
+type AlertNotification struct {
+	Alert   string    `json:"alert"`
+	Status  string    `json:"status"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// callOutcome is a model call seen by the monitor.
+type callOutcome struct {
+	at     time.Time
+	failed bool
+}
+
+// Monitor tracks the reachability of Ollama and the error rate of the model
+// calls, and alerts when they cross the thresholds of its config.
+type Monitor struct {
+	config  MonitorConfig
+	secret  Secret
+	backend ollama.Backend
+	client  *http.Client
+
+	mu        sync.Mutex
+	reachable bool
+	version   string
+	lastProbe time.Time
+	lastError string
+	failures  int
+	calls     []callOutcome
+	alerts    map[string]*Alert
+}
+
+// NewMonitor returns the monitor of backend. It probes backend every
+// interval of config until ctx is done; alerts are signed with secret when
+// it is not empty.
+func NewMonitor(ctx context.Context, config MonitorConfig, secret Secret, backend ollama.Backend) *Monitor {
+	if config.Window <= 0 {
+		config.Window = DefaultAlertWindow
+	}
+	if config.UnreachableAfter <= 0 {
+		config.UnreachableAfter = DefaultAlertUnreachableAt
+	}
+	m := &Monitor{
+		config:    config,
+		secret:    secret,
+		backend:   backend,
+		client:    &http.Client{Timeout: alertDeliveryTimeout},
+		reachable: true,
+		alerts: map[string]*Alert{
+			AlertOllamaUnreachable: {Name: AlertOllamaUnreachable},
+			AlertErrorRate:         {Name: AlertErrorRate},
+		},
+	}
+	if config.Interval > 0 {
+		go m.run(ctx)
+	}
+	return m
+}
+
+func (m *Monitor) run(ctx context.Context) {
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+	m.Probe(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Probe(ctx)
+		}
+	}
+}
+
+// Probe asks Ollama for its version, and alerts when it failed
+// UnreachableAfter times in a row or answers again.
+func (m *Monitor) Probe(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, monitorProbeTimeout)
+	defer cancel()
+	version, err := m.backend.WithContext(ctx).Version()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastProbe = time.Now().UTC()
+	if err != nil {
+		m.failures++
+		m.lastError = err.Error()
+		if m.failures >= m.config.UnreachableAfter {
+			m.reachable = false
+		}
+	} else {
+		m.failures = 0
+		m.lastError = ""
+		m.reachable = true
+		m.version = version
+	}
+	message := fmt.Sprintf("Ollama answers again, version %s", m.version)
+	if !m.reachable {
+		message = fmt.Sprintf("Ollama failed %d probes in a row: %s", m.failures, m.lastError)
+	}
+	m.set(AlertOllamaUnreachable, !m.reachable, message)
+}
+
+// Observe counts a model call that failed with err, or succeeded when err
+// is nil. Canceled calls and the errors of the caller, such as an unknown
+// model, are not failures of the dependencies and are not counted.
+func (m *Monitor) Observe(err error) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, ollama.ErrModelNotFound) || errors.Is(err, ollama.ErrContextTooLong) {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	m.calls = append(m.calls, callOutcome{at: now, failed: err != nil})
+	requests, failed := m.window(now)
+	if m.config.ErrorPercent <= 0 || requests < m.config.MinRequests {
+		m.set(AlertErrorRate, false, fmt.Sprintf("%d model calls in the last %s, too few to judge", requests, m.config.Window))
+		return
+	}
+	percent := failed * 100 / requests
+	m.set(AlertErrorRate, percent >= m.config.ErrorPercent,
+		fmt.Sprintf("%d%% of the %d model calls of the last %s failed", percent, requests, m.config.Window))
+}
+
+// window drops the calls older than the window and counts the others. It
+// must be called with mu held.
+func (m *Monitor) window(now time.Time) (requests, failed int) {
+	cutoff := now.Add(-m.config.Window)
+	first := 0
+	for first < len(m.calls) && m.calls[first].at.Before(cutoff) {
+		first++
+	}
+	m.calls = m.calls[first:]
+	for _, call := range m.calls {
+		if call.failed {
+			failed++
+		}
+	}
+	return len(m.calls), failed
+}
+
+// set moves alert to firing, and notifies with message when it changed. It
+// must be called with mu held.
+func (m *Monitor) set(name string, firing bool, message string) {
+	alert := m.alerts[name]
+	if alert.Firing == firing {
+		return
+	}
+	alert.Firing = firing
+	alert.Since = time.Now().UTC()
+	status := "resolved"
+	alert.Message = ""
+	if firing {
+		alert.Message = message
+		status = "firing"
+	}
+	log.Printf("Alert %s %s: %s", name, status, message)
+	go m.notify(AlertNotification{Alert: name, Status: status, Message: message, Time: alert.Since})
+}
+
+// notify posts notification to the alert URLs; failures are logged.
+func (m *Monitor) notify(notification AlertNotification) {
+	if url := m.config.WebhookURL.Reveal(); url != "" {
+		body, _ := json.Marshal(notification)
+		if err := m.post(url, body, true); err != nil {
+			log.Printf("Error posting alert %s to the webhook: %v", notification.Alert, err)
+		}
+	}
+	if url := m.config.SlackURL.Reveal(); url != "" {
+		body, _ := json.Marshal(map[string]string{
+			"text": fmt.Sprintf("[Orus] %s %s: %s", notification.Alert, notification.Status, notification.Message),
+		})
+		if err := m.post(url, body, false); err != nil {
+			log.Printf("Error posting alert %s to Slack: %v", notification.Alert, err)
+		}
+	}
+}
+
+func (m *Monitor) post(url string, body []byte, sign bool) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if sign && m.secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(WebhookEventHeader, "alert")
+		req.Header.Set(WebhookTimestampHeader, timestamp)
+		req.Header.Set(WebhookSignatureHeader, SignWebhook(m.secret.Reveal(), timestamp, body))
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("answered with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// State returns the state of the dependencies and of the alerts. The status
+// is "degraded" while an alert fires.
+func (m *Monitor) State() MonitorState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	requests, failed := m.window(time.Now())
+	state := MonitorState{
+		Status: "healthy",
+		Ollama: OllamaState{
+			Reachable: m.reachable,
+			Version:   m.version,
+			LastProbe: m.lastProbe,
+			LastError: m.lastError,
+			Failures:  m.failures,
+		},
+		Calls:  CallsState{Window: m.config.Window.String(), Requests: requests, Errors: failed},
+		Alerts: make([]Alert, 0, len(m.alerts)),
+	}
+	if requests > 0 {
+		state.Calls.ErrorPercent = failed * 100 / requests
+	}
+	for _, name := range []string{AlertOllamaUnreachable, AlertErrorRate} {
+		alert := *m.alerts[name]
+		if alert.Firing {
+			state.Status = "degraded"
+		}
+		state.Alerts = append(state.Alerts, alert)
+	}
+	return state
+}
+
+// monitorHooks counts every chat and embedding in the error rate of
+// monitor.
+func monitorHooks(hooks *Hooks, monitor *Monitor) {
+	hooks.OnAfterChat(func(ctx context.Context, req ollama.ChatRequest, resp *ollama.ChatResponse, err error) {
+		monitor.Observe(err)
+	})
+	hooks.OnEmbed(func(ctx context.Context, model string, texts []string, vectors [][]float64, err error) {
+		monitor.Observe(err)
+	})
+}
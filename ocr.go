@@ -0,0 +1,130 @@
+package orus
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/Dsouza10082/orus/ollama"
+)
+
+const (
+	DefaultOCREngine    = "tesseract"
+	DefaultOCRLanguages = "eng"
+	DefaultOCRModel     = "llama3.2-vision"
+	// DefaultOCRDPI is the resolution scanned PDF pages are rendered at.
+	DefaultOCRDPI = 300
+	// DefaultOCRMinChars is the text below which a PDF page is taken for a
+	// scan and read by OCR.
+	DefaultOCRMinChars = 20
+)
+
+const ocrPrompt = `Transcribe all the text of this image exactly as written, in reading order. Keep the line breaks and the paragraphs. Answer with the text only, without any comment; answer with nothing if the image has no text.`
+
+// ErrOCRDisabled is returned when a document needs OCR and no engine is
+// configured.
+var ErrOCRDisabled = errors.New("OCR is disabled, set ORUS_API_OCR_ENGINE to read scanned documents")
+
+// OCREngine recognizes the text of an image.
+type OCREngine interface {
+	Recognize(ctx context.Context, image []byte) (string, error)
+}
+
+// NewOCREngine returns the engine of config, or ErrOCRDisabled when it has
+// none.
+func NewOCREngine(orus *Orus, config OCRConfig) (OCREngine, error) {
+	switch config.Engine {
+	case "":
+		return nil, ErrOCRDisabled
+	case "tesseract":
+		return &tesseractOCR{languages: config.Languages}, nil
+	case "ollama":
+		return &ollamaOCR{client: orus.Backend, model: config.Model}, nil
+	}
+	return nil, fmt.Errorf("unknown OCR engine %q", config.Engine)
+}
+
+// tesseractOCR runs the tesseract command, which must be installed.
+type tesseractOCR struct {
+	languages string
+}
+
+func (t *tesseractOCR) Recognize(ctx context.Context, image []byte) (string, error) {
+	args := []string{"stdin", "stdout"}
+	if t.languages != "" {
+		args = append(args, "-l", t.languages)
+	}
+	output, err := runCommand(ctx, bytes.NewReader(image), "tesseract", args...)
+	if err != nil {
+		return "", err
+	}
+	return string(output), nil
+}
+
+// ollamaOCR has a vision model transcribe the image.
+type ollamaOCR struct {
+	client ollama.Backend
+	model  string
+}
+
+func (o *ollamaOCR) Recognize(ctx context.Context, image []byte) (string, error) {
+	response, err := o.client.WithContext(ctx).Chat(ollama.ChatRequest{
+		Model: o.model,
+		Messages: []ollama.Message{{
+			Role:    "user",
+			Content: ocrPrompt,
+			Images:  []string{base64.StdEncoding.EncodeToString(image)},
+		}},
+		Options: map[string]interface{}{"temperature": 0},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error recognizing text with %s: %w", o.model, err)
+	}
+	return response.Message.Content, nil
+}
+
+// runCommand runs name with stdin and returns its output. Its error carries
+// what the command wrote to stderr.
+func runCommand(ctx context.Context, stdin *bytes.Reader, name string, args ...string) ([]byte, error) {
+	stdout, _, err := runCommandStderr(ctx, stdin, name, args...)
+	return stdout, err
+}
+
+// runCommandStderr is runCommand for the commands that report on stderr,
+// such as ffmpeg, and also returns what they wrote there.
+func runCommandStderr(ctx context.Context, stdin *bytes.Reader, name string, args ...string) ([]byte, []byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, nil, fmt.Errorf("the %s command is not installed: %w", name, err)
+		}
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		if message := strings.TrimSpace(lastLines(stderr.String(), 5)); message != "" {
+			return nil, nil, fmt.Errorf("%s failed: %w: %s", name, err, message)
+		}
+		return nil, nil, fmt.Errorf("%s failed: %w", name, err)
+	}
+	return stdout.Bytes(), stderr.Bytes(), nil
+}
+
+// lastLines keeps the last n lines of the output of a command, where a
+// verbose command such as ffmpeg reports its failure.
+func lastLines(output string, n int) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,74 @@
+package ollama
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrStopStream is returned by a ChatStreamFunc to end the stream early
+// without an error, such as when the reply it waited for is complete.
+var ErrStopStream = errors.New("stream stopped")
+
+// ChatStreamFunc receives the chunks of a streamed chat, the last one with
+// Done set, and the context of the backend. Returning an error stops the
+// stream and aborts the generation.
+type ChatStreamFunc func(ctx context.Context, chunk ChatStreamResponse) error
+
+// ChatBackend runs the chats of a model server and manages its models.
+type ChatBackend interface {
+	Chat(req ChatRequest) (*ChatResponse, error)
+	// ChatCloud runs the chat on the cloud models of the server, if any.
+	ChatCloud(req ChatRequest) (*ChatResponse, error)
+	// ChatStream returns the error of callback, or nil when it returns
+	// ErrStopStream.
+	ChatStream(req ChatRequest, callback ChatStreamFunc) error
+	ChatStreamCloud(req ChatRequest, callback ChatStreamFunc) error
+	// ChatStreamRaw passes the chunks on as the JSON lines of the Ollama
+	// chat API.
+	ChatStreamRaw(req ChatRequest, line func([]byte) error) error
+	// Capabilities lists what model can do, such as "completion", "vision"
+	// or "tools".
+	Capabilities(model string) ([]string, error)
+	ListModels() ([]string, error)
+	ListModelDetails() ([]ModelInfo, error)
+	PullModel(model string, callback func(PullModelProgress)) error
+	DeleteModel(model string) error
+	// ResolveModel returns the model an alias maps to, or model itself.
+	ResolveModel(model string) string
+	Version() (string, error)
+}
+
+// EmbeddingBackend embeds texts with the embedding models of a model
+// server.
+type EmbeddingBackend interface {
+	GetEmbedding(model, text string) ([]float64, error)
+	GetEmbeddings(model string, texts []string) ([][]float64, error)
+}
+
+// Backend is the model server Orus generates and embeds with.
+// OllamaClient is the one Orus ships; orustest.Backend is a deterministic
+// fake for tests without a live Ollama.
+type Backend interface {
+	ChatBackend
+	EmbeddingBackend
+	// WithContext returns a copy of the backend whose calls are bound to
+	// ctx, so they stop when the request is canceled.
+	WithContext(ctx context.Context) Backend
+}
+
+var _ Backend = (*OllamaClient)(nil)
+
+// ClientOf returns the OllamaClient of backend, looking through the
+// backends that wrap another one with an Unwrap method.
+func ClientOf(backend Backend) (*OllamaClient, bool) {
+	for {
+		switch b := backend.(type) {
+		case *OllamaClient:
+			return b, true
+		case interface{ Unwrap() Backend }:
+			backend = b.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
@@ -0,0 +1,868 @@
+package ollama
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// rawStreamBufferSize holds the usual chunk of a streamed chat, so most are
+// forwarded without copying.
+const rawStreamBufferSize = 64 * 1024
+
+type OllamaClient struct {
+	baseURL    string
+	httpClient *http.Client
+	// settings is shared by the copies made by WithContext, so a reload
+	// reaches the requests already holding one.
+	settings *atomic.Pointer[ollamaSettings]
+	redactor *PIIRedactor
+	ctx      context.Context
+}
+
+// ollamaSettings are the client settings that can change at runtime.
+type ollamaSettings struct {
+	apiKey        string
+	formatRetries int
+	// models are the local models that may be used; empty allows all.
+	models []string
+	// aliases map request model names to local models.
+	aliases map[string]string
+}
+
+type PullModelProgress struct {
+	Status    string `json:"status"`
+	Digest    string `json:"digest,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+	Completed int64  `json:"completed,omitempty"`
+}
+
+type ChatStreamResponse struct {
+	Model              string    `json:"model"`
+	Message            Message   `json:"message"`
+	CreatedAt          time.Time `json:"created_at"`
+	Done               bool      `json:"done"`
+	Progress           int       `json:"progress"`
+	Total              int64     `json:"total,omitempty"`
+	Completed          int64     `json:"completed,omitempty"`
+	TotalDuration      int64     `json:"total_duration,omitempty"`
+	LoadDuration       int64     `json:"load_duration,omitempty"`
+	PromptEvalDuration int64     `json:"prompt_eval_duration,omitempty"`
+	EvalDuration       int64     `json:"eval_duration,omitempty"`
+	PromptEvalCount    int       `json:"prompt_eval_count,omitempty"`
+	EvalCount          int       `json:"eval_count,omitempty"`
+}
+
+// ModelInfo describes a model installed on the Ollama host.
+type ModelInfo struct {
+	Name       string    `json:"name" swaggertype:"string" example:"llama3.1:8b"`
+	Size       int64     `json:"size" swaggertype:"integer" example:"4920753328"`
+	Digest     string    `json:"digest" swaggertype:"string" example:"46e0c10c039e019119339687c3c1757cc81b9da49709a3b3924863ba87ca666e"`
+	ModifiedAt time.Time `json:"modified_at" swaggertype:"string" example:"2021-01-01T00:00:00Z"`
+	Details    struct {
+		Family            string `json:"family,omitempty"`
+		ParameterSize     string `json:"parameter_size,omitempty"`
+		QuantizationLevel string `json:"quantization_level,omitempty"`
+	} `json:"details" swaggertype:"object"`
+}
+
+// withMessageImages moves the request images onto the last user message,
+// which is where the Ollama chat API reads them from.
+func withMessageImages(req ChatRequest) ChatRequest {
+	if len(req.Images) == 0 {
+		return req
+	}
+	messages := make([]Message, len(req.Messages))
+	copy(messages, req.Messages)
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			messages[i].Images = append(append([]string{}, messages[i].Images...), req.Images...)
+			break
+		}
+	}
+	req.Messages = messages
+	req.Images = nil
+	return req
+}
+
+func NewOllamaClient(baseURL string) *OllamaClient {
+	settings := &atomic.Pointer[ollamaSettings]{}
+	settings.Store(&ollamaSettings{formatRetries: DefaultFormatRetries})
+	return &OllamaClient{
+		baseURL: baseURL,
+		httpClient: &http.Client{Transport: DefaultTransportConfig().NewTransport()},
+		settings:   settings,
+		ctx:        context.Background(),
+	}
+}
+
+// WithContext returns a copy of the client whose requests are bound to ctx,
+// so the deadline and cancellation of the incoming HTTP request reach Ollama.
+func (c *OllamaClient) WithContext(ctx context.Context) Backend {
+	client := *c
+	client.ctx = ctx
+	return &client
+}
+
+// SetTransport replaces the connection pool of the client. It must be called
+// before the client is used.
+func (c *OllamaClient) SetTransport(config TransportConfig) *OllamaClient {
+	c.httpClient = &http.Client{Transport: config.NewTransport()}
+	return c
+}
+
+// SetAPIKey sets the Ollama Cloud API key used by the cloud calls. It is
+// safe to call while requests are running.
+func (c *OllamaClient) SetAPIKey(apiKey string) *OllamaClient {
+	settings := *c.settings.Load()
+	settings.apiKey = apiKey
+	c.settings.Store(&settings)
+	return c
+}
+
+// SetFormatRetries sets how many times Chat and ChatCloud ask the model to
+// repair a reply that does not match the requested format. It is safe to
+// call while requests are running.
+func (c *OllamaClient) SetFormatRetries(retries int) *OllamaClient {
+	if retries >= 0 {
+		settings := *c.settings.Load()
+		settings.formatRetries = retries
+		c.settings.Store(&settings)
+	}
+	return c
+}
+
+// SetModels restricts the local models that can be generated with, pulled
+// and listed. An entry without a tag allows every tag of the model; an empty
+// list allows all models. It is safe to call while requests are running.
+func (c *OllamaClient) SetModels(models []string) *OllamaClient {
+	settings := *c.settings.Load()
+	settings.models = models
+	c.settings.Store(&settings)
+	return c
+}
+
+// SetAliases maps model names to the local models the requests naming them
+// are sent to, so clients can ask for "fast" or "default" and operators pick
+// the model. It is safe to call while requests are running.
+func (c *OllamaClient) SetAliases(aliases map[string]string) *OllamaClient {
+	settings := *c.settings.Load()
+	settings.aliases = aliases
+	c.settings.Store(&settings)
+	return c
+}
+
+// ResolveModel returns the local model an alias maps to, or model itself.
+func (c *OllamaClient) ResolveModel(model string) string {
+	if target, ok := c.settings.Load().aliases[model]; ok {
+		return target
+	}
+	return model
+}
+
+func (c *OllamaClient) modelAllowed(model string) bool {
+	models := c.settings.Load().models
+	if len(models) == 0 {
+		return true
+	}
+	name, _, tagged := strings.Cut(model, ":")
+	for _, allowed := range models {
+		if allowed == model || allowed == name || (!tagged && allowed == model+":latest") {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *OllamaClient) checkModel(model string) error {
+	if !c.modelAllowed(model) {
+		return fmt.Errorf("model %q is not one of the allowed local models", model)
+	}
+	return nil
+}
+
+func (c *OllamaClient) Generate(req GenerateRequest) (*GenerateResponse, error) {
+	req.Model = c.ResolveModel(req.Model)
+	if err := c.checkModel(req.Model); err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("%s/api/generate", c.baseURL)
+
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("error serializing request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(c.ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, requestError(c.ctx, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, statusError(resp.StatusCode, body)
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	var finalResponse GenerateResponse
+
+	for decoder.More() {
+		var genResp GenerateResponse
+		if err := decoder.Decode(&genResp); err != nil {
+			return nil, fmt.Errorf("error decoding response: %w", err)
+		}
+		finalResponse.Response += genResp.Response
+		finalResponse.Model = genResp.Model
+		finalResponse.CreatedAt = genResp.CreatedAt
+		finalResponse.Done = genResp.Done
+
+		if genResp.Done {
+			break
+		}
+	}
+
+	return &finalResponse, nil
+}
+
+// Chat sends a non-streaming chat request. When req.Format is set the reply
+// is validated against it and sent back with a repair prompt until it
+// matches or the format retries are exhausted.
+func (c *OllamaClient) Chat(req ChatRequest) (*ChatResponse, error) {
+	return c.chatWithFormat(req, c.chat)
+}
+
+// ChatCloud is Chat against Ollama Cloud.
+// SetPIIRedactor makes the cloud calls redact personal data from the prompt
+// when the redactor targets the cloud. Placeholders in the reply are restored.
+func (c *OllamaClient) SetPIIRedactor(redactor *PIIRedactor) *OllamaClient {
+	c.redactor = redactor
+	return c
+}
+
+func (c *OllamaClient) ChatCloud(req ChatRequest) (*ChatResponse, error) {
+	req, redaction := c.redactForCloud(req)
+	resp, err := c.chatWithFormat(req, c.chatCloud)
+	if err == nil && redaction != nil {
+		resp.Message.Content = redaction.Restore(resp.Message.Content)
+		resp.Message.Thinking = redaction.Restore(resp.Message.Thinking)
+	}
+	return resp, err
+}
+
+// redactForCloud returns req with its messages redacted, and the redaction
+// to restore the reply with, or nil when nothing was redacted.
+func (c *OllamaClient) redactForCloud(req ChatRequest) (ChatRequest, *Redaction) {
+	if c.redactor == nil || !c.redactor.Cloud {
+		return req, nil
+	}
+	messages, redaction := c.redactor.RedactMessages(c.ctx, req.Messages)
+	if redaction.Len() == 0 {
+		return req, nil
+	}
+	req.Messages = messages
+	return req, redaction
+}
+
+func (c *OllamaClient) chatWithFormat(req ChatRequest, chat func(ChatRequest) (*ChatResponse, error)) (*ChatResponse, error) {
+	req = withMessageImages(req)
+	req.Images = nil
+	resp, err := chat(req)
+	if err != nil || len(req.Format) == 0 {
+		return resp, err
+	}
+	retries := c.settings.Load().formatRetries
+	if req.FormatRetries != nil {
+		retries = *req.FormatRetries
+	}
+	messages := req.Messages
+	failures := make([]string, 0)
+	for attempt := 0; ; attempt++ {
+		// A reply calling tools has no content yet; the format applies to the
+		// answer that follows the tool results
+		if len(resp.Message.ToolCalls) > 0 {
+			return resp, nil
+		}
+		formatErr := req.Format.Check(resp.Message.Content)
+		if formatErr == nil {
+			return resp, nil
+		}
+		failures = append(failures, formatErr.Error())
+		if attempt >= retries {
+			return nil, &FormatFailure{Attempts: attempt + 1, Errors: failures, Content: resp.Message.Content, err: formatErr}
+		}
+		messages = append(messages[:len(messages):len(messages)],
+			Message{Role: "assistant", Content: resp.Message.Content},
+			req.Format.repairMessage(formatErr),
+		)
+		req.Messages = messages
+		if resp, err = chat(req); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *OllamaClient) chat(req ChatRequest) (*ChatResponse, error) {
+	req.Model = c.ResolveModel(req.Model)
+	if err := c.checkModel(req.Model); err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("%s/api/chat", c.baseURL)
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("error serializing request: %w", err)
+	}
+	capturePayload(c.ctx, url, jsonData)
+
+	httpReq, err := http.NewRequestWithContext(c.ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, requestError(c.ctx, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, statusError(resp.StatusCode, body)
+	}
+	return readChatResponse(resp.Body)
+}
+
+func (c *OllamaClient) chatCloud(req ChatRequest) (*ChatResponse, error) {
+	url := cloudChatURL
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("error serializing request: %w", err)
+	}
+	capturePayload(c.ctx, url, jsonData)
+	httpReq, err := http.NewRequestWithContext(c.ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+c.settings.Load().apiKey)
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, requestError(c.ctx, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, statusError(resp.StatusCode, body)
+	}
+	return readChatResponse(resp.Body)
+}
+
+// readChatResponse reads a chat reply, whole or streamed, into one response.
+func readChatResponse(body io.Reader) (*ChatResponse, error) {
+	decoder := json.NewDecoder(body)
+	var finalResponse ChatResponse
+	var fullContent string
+	var fullThinking string
+	for decoder.More() {
+		var chatResp ChatResponse
+		if err := decoder.Decode(&chatResp); err != nil {
+			return nil, fmt.Errorf("error decoding response: %w", err)
+		}
+		fullContent += chatResp.Message.Content
+		fullThinking += chatResp.Message.Thinking
+		finalResponse.Message.ToolCalls = append(finalResponse.Message.ToolCalls, chatResp.Message.ToolCalls...)
+		finalResponse.Model = chatResp.Model
+		finalResponse.CreatedAt = chatResp.CreatedAt
+		finalResponse.Done = chatResp.Done
+		finalResponse.Message.Role = chatResp.Message.Role
+
+		if chatResp.Done {
+			finalResponse.TotalDuration = chatResp.TotalDuration
+			finalResponse.LoadDuration = chatResp.LoadDuration
+			finalResponse.PromptEvalDuration = chatResp.PromptEvalDuration
+			finalResponse.EvalDuration = chatResp.EvalDuration
+			finalResponse.PromptEvalCount = chatResp.PromptEvalCount
+			finalResponse.EvalCount = chatResp.EvalCount
+			break
+		}
+	}
+	finalResponse.Message.Content = fullContent
+	finalResponse.Message.Thinking = fullThinking
+	return &finalResponse, nil
+}
+
+// ChatStream streams the chunks of a chat to callback until the chunk with
+// Done set. An error of callback stops the stream and aborts the generation;
+// ChatStream returns it, or nil for ErrStopStream.
+func (c *OllamaClient) ChatStream(req ChatRequest, callback ChatStreamFunc) error {
+	req.Model = c.ResolveModel(req.Model)
+	if err := c.checkModel(req.Model); err != nil {
+		return err
+	}
+	req = withMessageImages(req)
+	req.Stream = true
+	url := fmt.Sprintf("%s/api/chat", c.baseURL)
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("error serializing request: %w", err)
+	}
+	capturePayload(c.ctx, url, jsonData)
+	httpReq, err := http.NewRequestWithContext(c.ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return requestError(c.ctx, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return statusError(resp.StatusCode, body)
+	}
+	return c.readChatStream(resp.Body, req.Model, callback)
+}
+
+func (c *OllamaClient) ChatStreamCloud(req ChatRequest, callback ChatStreamFunc) error {
+	req = withMessageImages(req)
+	req, redaction := c.redactForCloud(req)
+	if redaction != nil {
+		callback = restoreChatStream(redaction, callback)
+	}
+	req.Stream = true
+	url := cloudChatURL
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("error serializing request: %w", err)
+	}
+	capturePayload(c.ctx, url, jsonData)
+	httpReq, err := http.NewRequestWithContext(c.ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+c.settings.Load().apiKey)
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return requestError(c.ctx, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return statusError(resp.StatusCode, body)
+	}
+	return c.readChatStream(resp.Body, req.Model, callback)
+}
+
+// ChatStreamRaw streams a chat like ChatStream, but hands each NDJSON line of
+// the Ollama response to line as is, without decoding it. The slice is only
+// valid until line returns.
+func (c *OllamaClient) ChatStreamRaw(req ChatRequest, line func([]byte) error) error {
+	req.Model = c.ResolveModel(req.Model)
+	if err := c.checkModel(req.Model); err != nil {
+		return err
+	}
+	req = withMessageImages(req)
+	req.Stream = true
+	url := fmt.Sprintf("%s/api/chat", c.baseURL)
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("error serializing request: %w", err)
+	}
+	capturePayload(c.ctx, url, jsonData)
+	httpReq, err := http.NewRequestWithContext(c.ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return requestError(c.ctx, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return statusError(resp.StatusCode, body)
+	}
+	return c.readRawChatStream(resp.Body, line)
+}
+
+// readRawChatStream splits body into lines, read in place from the buffer
+// unless a line is longer than it.
+func (c *OllamaClient) readRawChatStream(body io.Reader, line func([]byte) error) error {
+	reader := bufio.NewReaderSize(body, rawStreamBufferSize)
+	var long []byte
+	for {
+		if err := c.ctx.Err(); err != nil {
+			return err
+		}
+		data, err := reader.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			long = append(long, data...)
+			continue
+		}
+		if long != nil {
+			data, long = append(long, data...), nil
+		}
+		if data = bytes.TrimSpace(data); len(data) > 0 {
+			if lineErr := line(data); lineErr != nil {
+				return lineErr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			if ctxErr := c.ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			return fmt.Errorf("error reading response: %w: %w", ErrStreamClosed, err)
+		}
+	}
+}
+
+// restoreChatStream wraps a stream callback so the placeholders of redaction
+// are restored, even when a placeholder is split across chunks.
+func restoreChatStream(redaction *Redaction, callback ChatStreamFunc) ChatStreamFunc {
+	content, thinking := redaction.Restorer(), redaction.Restorer()
+	return func(ctx context.Context, chunk ChatStreamResponse) error {
+		chunk.Message.Content = content.Write(chunk.Message.Content)
+		chunk.Message.Thinking = thinking.Write(chunk.Message.Thinking)
+		if chunk.Done {
+			chunk.Message.Content += content.Flush()
+			chunk.Message.Thinking += thinking.Flush()
+		}
+		return callback(ctx, chunk)
+	}
+}
+
+// readChatStream forwards the chunks of a streamed chat to the callback. It
+// stops as soon as the client context is done or the callback fails;
+// returning closes the response body, which makes Ollama abort the
+// generation.
+func (c *OllamaClient) readChatStream(body io.Reader, model string, callback ChatStreamFunc) error {
+	decoder := json.NewDecoder(body)
+	for decoder.More() {
+		if err := c.ctx.Err(); err != nil {
+			return err
+		}
+		var chatResp ChatStreamResponse
+		if err := decoder.Decode(&chatResp); err != nil {
+			if ctxErr := c.ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			return streamError(err)
+		}
+		chatResp.Model = model
+		chatResp.CreatedAt = time.Now()
+		if err := callback(c.ctx, chatResp); err != nil {
+			if errors.Is(err, ErrStopStream) {
+				return nil
+			}
+			return err
+		}
+		if chatResp.Done {
+			return nil
+		}
+	}
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w before the last chunk", ErrStreamClosed)
+}
+
+// streamError is the error of a chunk that could not be decoded, which
+// wraps ErrStreamClosed when the stream broke off rather than sent an
+// invalid chunk.
+func streamError(err error) error {
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &syntaxError) || errors.As(err, &typeError) {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	return fmt.Errorf("error decoding response: %w: %w", ErrStreamClosed, err)
+}
+
+// IsCanceled reports whether err comes from a request whose client went away,
+// in which case there is nobody left to report the error to.
+func IsCanceled(err error) bool {
+	return errors.Is(err, context.Canceled)
+}
+
+// GetEmbedding obtém embeddings de um texto
+func (c *OllamaClient) GetEmbedding(model, text string) ([]float64, error) {
+	url := fmt.Sprintf("%s/api/embeddings", c.baseURL)
+
+	reqData := map[string]string{
+		"model":  model,
+		"prompt": text,
+	}
+
+	jsonData, err := json.Marshal(reqData)
+	if err != nil {
+		return nil, fmt.Errorf("error serializing request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(c.ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, requestError(c.ctx, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, statusError(resp.StatusCode, body)
+	}
+
+	var embResp EmbeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&embResp); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+
+	return embResp.Embedding, nil
+}
+
+// GetEmbeddings embeds texts in one call to /api/embed. Its vectors are
+// normalized, unlike those of GetEmbedding, which only matters to
+// comparisons that are not by cosine similarity.
+func (c *OllamaClient) GetEmbeddings(model string, texts []string) ([][]float64, error) {
+	url := fmt.Sprintf("%s/api/embed", c.baseURL)
+
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"model": model,
+		"input": texts,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error serializing request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(c.ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, requestError(c.ctx, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, statusError(resp.StatusCode, body)
+	}
+
+	var embResp struct {
+		Embeddings [][]float64 `json:"embeddings"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&embResp); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+	if len(embResp.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings from Ollama, got %d", len(texts), len(embResp.Embeddings))
+	}
+	return embResp.Embeddings, nil
+}
+
+// Version returns the version of the Ollama server, which also tells that it
+// is reachable.
+func (c *OllamaClient) Version() (string, error) {
+	url := fmt.Sprintf("%s/api/version", c.baseURL)
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", requestError(c.ctx, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", statusError(resp.StatusCode, nil)
+	}
+	var version struct {
+		Version string `json:"version"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&version); err != nil {
+		return "", fmt.Errorf("error decoding response: %w", err)
+	}
+	return version.Version, nil
+}
+
+// Capabilities returns what model can do, such as "completion", "vision"
+// or "tools", as reported by Ollama.
+func (c *OllamaClient) Capabilities(model string) ([]string, error) {
+	url := fmt.Sprintf("%s/api/show", c.baseURL)
+	jsonData, err := json.Marshal(map[string]string{"model": c.ResolveModel(model)})
+	if err != nil {
+		return nil, fmt.Errorf("error serializing request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodPost, url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, requestError(c.ctx, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode, nil)
+	}
+	var show struct {
+		Capabilities []string `json:"capabilities"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&show); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+	return show.Capabilities, nil
+}
+
+// ListModels lista modelos disponíveis
+func (c *OllamaClient) ListModels() ([]string, error) {
+	details, err := c.ListModelDetails()
+	if err != nil {
+		return nil, err
+	}
+
+	models := make([]string, len(details))
+	for i, m := range details {
+		models[i] = m.Name
+	}
+
+	return models, nil
+}
+
+// ListModelDetails returns the installed models with their size and digest
+func (c *OllamaClient) ListModelDetails() ([]ModelInfo, error) {
+	url := fmt.Sprintf("%s/api/tags", c.baseURL)
+
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, requestError(c.ctx, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode, nil)
+	}
+
+	var result struct {
+		Models []ModelInfo `json:"models"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+
+	models := result.Models[:0]
+	for _, model := range result.Models {
+		if c.modelAllowed(model.Name) {
+			models = append(models, model)
+		}
+	}
+	return models, nil
+}
+
+// DeleteModel removes an installed model from the Ollama host
+func (c *OllamaClient) DeleteModel(modelName string) error {
+	url := fmt.Sprintf("%s/api/delete", c.baseURL)
+
+	jsonData, err := json.Marshal(map[string]string{"model": modelName})
+	if err != nil {
+		return fmt.Errorf("error serializing request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodDelete, url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return requestError(c.ctx, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return statusError(resp.StatusCode, body)
+	}
+
+	return nil
+}
+
+func (c *OllamaClient) PullModel(modelName string, progressCallback func(PullModelProgress)) error {
+	if err := c.checkModel(modelName); err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/api/pull", c.baseURL)
+
+	reqData := map[string]interface{}{
+		"name":   modelName,
+		"stream": true,
+	}
+
+	jsonData, _ := json.Marshal(reqData)
+	req, err := http.NewRequestWithContext(c.ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return requestError(c.ctx, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return statusError(resp.StatusCode, body)
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	for decoder.More() {
+		var progress PullModelProgress
+		if err := decoder.Decode(&progress); err != nil {
+			return err
+		}
+
+		if progressCallback != nil {
+			progressCallback(progress)
+		}
+
+		if progress.Status == "success" {
+			break
+		}
+	}
+
+	return nil
+}
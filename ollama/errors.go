@@ -0,0 +1,72 @@
+package ollama
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrModelNotFound is wrapped by the errors of a model the server does
+	// not have, such as one not pulled yet.
+	ErrModelNotFound = errors.New("model not found")
+	// ErrOllamaUnavailable is wrapped by the errors of a server that cannot
+	// be reached or is overloaded.
+	ErrOllamaUnavailable = errors.New("ollama unavailable")
+	// ErrContextTooLong is wrapped by the errors of a prompt or text longer
+	// than the context of the model.
+	ErrContextTooLong = errors.New("context too long")
+	// ErrStreamClosed is wrapped by the errors of a stream that ended before
+	// its last chunk.
+	ErrStreamClosed = errors.New("stream closed")
+)
+
+// StatusError is the error of a request the server answered with a status
+// other than 200. It unwraps to ErrModelNotFound, ErrOllamaUnavailable or
+// ErrContextTooLong when the status or body tells one of them.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("error from Ollama (status %d)", e.StatusCode)
+	}
+	return fmt.Sprintf("error from Ollama (status %d): %s", e.StatusCode, e.Body)
+}
+
+func (e *StatusError) Unwrap() error {
+	return StatusCause(e.StatusCode, e.Body)
+}
+
+// StatusCause returns the sentinel error of a response of status with body,
+// or nil when it tells none, for the servers taking the Ollama or OpenAI
+// requests.
+func StatusCause(status int, body string) error {
+	lower := strings.ToLower(body)
+	switch {
+	case strings.Contains(lower, "context length") || strings.Contains(lower, "context window") || strings.Contains(lower, "too long"):
+		return ErrContextTooLong
+	case status == http.StatusNotFound:
+		return ErrModelNotFound
+	case status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout:
+		return ErrOllamaUnavailable
+	}
+	return nil
+}
+
+func statusError(status int, body []byte) error {
+	return &StatusError{StatusCode: status, Body: string(body)}
+}
+
+// requestError is the error of a request that got no response, which wraps
+// ErrOllamaUnavailable unless ctx was done.
+func requestError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("error making request: %w", err)
+	}
+	return fmt.Errorf("error making request: %w: %w", ErrOllamaUnavailable, err)
+}
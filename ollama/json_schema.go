@@ -0,0 +1,304 @@
+package ollama
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultFormatRetries is how many times a reply that does not match the
+// requested format is sent back to the model with a repair prompt.
+const DefaultFormatRetries = 2
+
+// ResponseFormat is the Ollama format parameter: either the string "json"
+// or a JSON Schema object constraining the reply.
+type ResponseFormat []byte
+
+// FormatJSON asks the model for any valid JSON.
+var FormatJSON = ResponseFormat(`"json"`)
+
+func (f ResponseFormat) MarshalJSON() ([]byte, error) {
+	if len(f) == 0 {
+		return []byte("null"), nil
+	}
+	return f, nil
+}
+
+func (f *ResponseFormat) UnmarshalJSON(data []byte) error {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.Equal(trimmed, []byte("null")) || bytes.Equal(trimmed, []byte(`""`)) {
+		*f = nil
+		return nil
+	}
+	*f = append((*f)[:0], trimmed...)
+	return nil
+}
+
+// IsJSON reports whether the format is the plain "json" mode.
+func (f ResponseFormat) IsJSON() bool {
+	var mode string
+	return json.Unmarshal(f, &mode) == nil && mode == "json"
+}
+
+// Schema returns the JSON Schema of the format, or nil when the format is
+// empty or the plain "json" mode.
+func (f ResponseFormat) Schema() map[string]interface{} {
+	var schema map[string]interface{}
+	if len(f) == 0 || json.Unmarshal(f, &schema) != nil {
+		return nil
+	}
+	return schema
+}
+
+// Validate checks that the format is either "json" or a JSON Schema object.
+func (f ResponseFormat) Validate() error {
+	if len(f) == 0 || f.IsJSON() || f.Schema() != nil {
+		return nil
+	}
+	return fmt.Errorf("format must be \"json\" or a JSON schema object")
+}
+
+// Check reports why content does not satisfy the format, or nil when it does.
+func (f ResponseFormat) Check(content string) error {
+	if len(f) == 0 {
+		return nil
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(content)), &value); err != nil {
+		return fmt.Errorf("reply is not valid JSON: %w", err)
+	}
+	if schema := f.Schema(); schema != nil {
+		return ValidateSchema(schema, value)
+	}
+	return nil
+}
+
+// repairMessage asks the model to fix a reply that failed Check.
+func (f ResponseFormat) repairMessage(err error) Message {
+	prompt := fmt.Sprintf("Your previous reply was rejected: %s.\nReply again with only the corrected JSON, without any explanation or markdown.", err)
+	if f.Schema() != nil {
+		prompt += "\nThe JSON must satisfy this schema:\n" + string(f)
+	}
+	return Message{Role: "user", Content: prompt}
+}
+
+// ValidateSchema validates a decoded JSON value against a JSON Schema. It
+// supports the keywords models are usually constrained with: type, enum,
+// const, properties, required, additionalProperties, items, the string,
+// number and array bounds, pattern and the allOf/anyOf/oneOf combinators.
+func ValidateSchema(schema map[string]interface{}, value interface{}) error {
+	return validateSchema(schema, value, "$")
+}
+
+func validateSchema(schema map[string]interface{}, value interface{}, path string) error {
+	if types, ok := schema["type"]; ok && !matchesType(types, value) {
+		return fmt.Errorf("%s: expected %v, got %s", path, types, jsonType(value))
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, candidate := range enum {
+			if reflect.DeepEqual(candidate, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: must be one of %v", path, enum)
+		}
+	}
+	if constant, ok := schema["const"]; ok && !reflect.DeepEqual(constant, value) {
+		return fmt.Errorf("%s: must be %v", path, constant)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if err := validateObject(schema, v, path); err != nil {
+			return err
+		}
+	case []interface{}:
+		if err := validateArray(schema, v, path); err != nil {
+			return err
+		}
+	case string:
+		length := float64(len([]rune(v)))
+		if min, ok := schema["minLength"].(float64); ok && length < min {
+			return fmt.Errorf("%s: must be at least %v characters", path, min)
+		}
+		if max, ok := schema["maxLength"].(float64); ok && length > max {
+			return fmt.Errorf("%s: must be at most %v characters", path, max)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("%s: invalid pattern %q: %w", path, pattern, err)
+			}
+			if !re.MatchString(v) {
+				return fmt.Errorf("%s: must match %q", path, pattern)
+			}
+		}
+	case float64:
+		if min, ok := schema["minimum"].(float64); ok && v < min {
+			return fmt.Errorf("%s: must be >= %v", path, min)
+		}
+		if max, ok := schema["maximum"].(float64); ok && v > max {
+			return fmt.Errorf("%s: must be <= %v", path, max)
+		}
+		if min, ok := schema["exclusiveMinimum"].(float64); ok && v <= min {
+			return fmt.Errorf("%s: must be > %v", path, min)
+		}
+		if max, ok := schema["exclusiveMaximum"].(float64); ok && v >= max {
+			return fmt.Errorf("%s: must be < %v", path, max)
+		}
+	}
+
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			if subSchema, ok := sub.(map[string]interface{}); ok {
+				if err := validateSchema(subSchema, value, path); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok && countMatches(anyOf, value, path) == 0 {
+		return fmt.Errorf("%s: does not match any of the allowed schemas", path)
+	}
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok && countMatches(oneOf, value, path) != 1 {
+		return fmt.Errorf("%s: must match exactly one of the allowed schemas", path)
+	}
+	return nil
+}
+
+func validateObject(schema map[string]interface{}, object map[string]interface{}, path string) error {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, name := range required {
+			key, _ := name.(string)
+			if _, ok := object[key]; !ok {
+				return fmt.Errorf("%s: missing required property %q", path, key)
+			}
+		}
+	}
+	properties, _ := schema["properties"].(map[string]interface{})
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		childPath := path + "." + key
+		if propertySchema, ok := properties[key].(map[string]interface{}); ok {
+			if err := validateSchema(propertySchema, object[key], childPath); err != nil {
+				return err
+			}
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				return fmt.Errorf("%s: property is not allowed", childPath)
+			}
+		case map[string]interface{}:
+			if err := validateSchema(additional, object[key], childPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateArray(schema map[string]interface{}, array []interface{}, path string) error {
+	length := float64(len(array))
+	if min, ok := schema["minItems"].(float64); ok && length < min {
+		return fmt.Errorf("%s: must have at least %v items", path, min)
+	}
+	if max, ok := schema["maxItems"].(float64); ok && length > max {
+		return fmt.Errorf("%s: must have at most %v items", path, max)
+	}
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		for i, item := range array {
+			if err := validateSchema(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func countMatches(schemas []interface{}, value interface{}, path string) int {
+	matches := 0
+	for _, sub := range schemas {
+		if subSchema, ok := sub.(map[string]interface{}); ok && validateSchema(subSchema, value, path) == nil {
+			matches++
+		}
+	}
+	return matches
+}
+
+func matchesType(types interface{}, value interface{}) bool {
+	switch t := types.(type) {
+	case string:
+		return matchesSingleType(t, value)
+	case []interface{}:
+		for _, candidate := range t {
+			if name, ok := candidate.(string); ok && matchesSingleType(name, value) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchesSingleType(name string, value interface{}) bool {
+	actual := jsonType(value)
+	switch name {
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == math.Trunc(number)
+	case "number":
+		return actual == "number"
+	default:
+		return actual == name
+	}
+}
+
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// FormatFailure is returned when a reply still does not match its format
+// after the repair retries. Errors holds why each attempt was rejected.
+type FormatFailure struct {
+	Attempts int      `json:"attempts"`
+	Errors   []string `json:"errors"`
+	// Content is the last reply of the model.
+	Content string `json:"content"`
+	err     error
+}
+
+func (f *FormatFailure) Error() string {
+	return fmt.Sprintf("reply does not match the requested format after %d attempts: %s", f.Attempts, f.err)
+}
+
+func (f *FormatFailure) Unwrap() error {
+	return f.err
+}
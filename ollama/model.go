@@ -0,0 +1,88 @@
+package ollama
+
+import "time"
+
+type ChatRequest struct {
+	Model    string    `json:"model" swaggertype:"string" example:"llama3.1:8b"`
+	Messages []Message `json:"messages" swaggertype:"array" example:"[{role: 'user', content: 'Hello, how are you?'}]"`
+	Stream   bool      `json:"stream" swaggertype:"boolean" example:"true"`
+	Format   ResponseFormat `json:"format,omitempty" swaggertype:"object" example:"json"`
+	Think    bool      `json:"think" swaggertype:"boolean" example:"true"`
+	Images   []string    `json:"images" swaggertype:"array" example:"['base64 encoded image 1', 'base64 encoded image 2']"`
+	Options  map[string]interface{} `json:"options,omitempty" swaggertype:"object" example:"{temperature: 0.7}"`
+	Tools    []ToolDefinition `json:"tools,omitempty" swaggertype:"array"`
+	// FormatRetries overrides ORUS_API_FORMAT_RETRIES for the request.
+	FormatRetries *int `json:"-"`
+}
+
+type Message struct {
+	Role     string   `json:"role" swaggertype:"string" example:"user"`
+	Content  string   `json:"content" swaggertype:"string" example:"Hello, how are you?"`
+	Thinking string   `json:"thinking,omitempty" swaggertype:"string" example:"The user is greeting me."`
+	Images   []string `json:"images,omitempty" swaggertype:"array" example:"['base64 encoded image']"`
+	// ToolCalls are the tools an assistant message asks to run, and ToolName
+	// is the tool whose result a tool message carries.
+	ToolCalls []ToolCall `json:"tool_calls,omitempty" swaggertype:"array"`
+	ToolName  string     `json:"tool_name,omitempty" swaggertype:"string" example:"current_time"`
+}
+
+// ToolDefinition describes a tool to the model, in the Ollama format.
+type ToolDefinition struct {
+	Type     string       `json:"type"`
+	Function ToolFunction `json:"function"`
+}
+
+type ToolFunction struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty" swaggertype:"object"`
+}
+
+type ToolCall struct {
+	Function ToolCallFunction `json:"function"`
+}
+
+type ToolCallFunction struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+type ChatResponse struct {
+	Model              string    `json:"model" swaggertype:"string" example:"llama3.1:8b"`
+	Message            Message   `json:"message" swaggertype:"object" example:"{role: 'user', content: 'Hello, how are you?'}"`
+	CreatedAt          time.Time `json:"created_at" swaggertype:"object"`
+	Done               bool      `json:"done" swaggertype:"boolean" example:"true"`
+	TotalDuration      int64     `json:"total_duration,omitempty" swaggertype:"integer" example:"5043500667"`
+	LoadDuration       int64     `json:"load_duration,omitempty" swaggertype:"integer" example:"1200000"`
+	PromptEvalDuration int64     `json:"prompt_eval_duration,omitempty" swaggertype:"integer" example:"180000000"`
+	EvalDuration       int64     `json:"eval_duration,omitempty" swaggertype:"integer" example:"4800000000"`
+	PromptEvalCount    int       `json:"prompt_eval_count,omitempty" swaggertype:"integer" example:"26"`
+	EvalCount          int       `json:"eval_count,omitempty" swaggertype:"integer" example:"290"`
+}
+
+type EmbeddingRequest struct {
+	Model  string `json:"model" swaggertype:"string" example:"llama3.1:8b"`
+	Prompt string `json:"prompt" swaggertype:"string" example:"Hello, how are you?"`
+}
+
+type EmbeddingResponse struct {
+	Embedding []float64 `json:"embedding" swaggertype:"array" example:"[0.1, 0.2, 0.3]"`
+}
+
+type GenerateRequest struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+	Stream bool   `json:"stream"`
+}
+
+type GenerateResponse struct {
+	Model     string    `json:"model"`
+	Response  string    `json:"response"`
+	CreatedAt time.Time `json:"created_at"`
+	Done      bool      `json:"done"`
+}
+
+type ErrorResponse struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,104 @@
+package ollama
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// cloudChatURL is the chat endpoint of Ollama Cloud.
+const cloudChatURL = "https://ollama.com/api/chat"
+
+// Payload is the body of a chat request as it was sent to the server, after
+// the aliases, the images and the PII redaction were applied.
+type Payload struct {
+	URL    string          `json:"url" swaggertype:"string" example:"http://ollama:11434/api/chat"`
+	Body   json.RawMessage `json:"body" swaggertype:"object"`
+	SentAt time.Time       `json:"sent_at" swaggertype:"string" example:"2021-01-01T00:00:00Z"`
+}
+
+// PayloadCapture collects the chat payloads sent with a context, such as
+// the format repairs and tool rounds of one request.
+type PayloadCapture struct {
+	mu       sync.Mutex
+	payloads []Payload
+}
+
+type payloadCaptureKey struct{}
+
+// WithPayloadCapture returns a context whose chat payloads are kept by the
+// returned capture.
+func WithPayloadCapture(ctx context.Context) (context.Context, *PayloadCapture) {
+	capture := &PayloadCapture{}
+	return context.WithValue(ctx, payloadCaptureKey{}, capture), capture
+}
+
+// PayloadCaptureFrom returns the capture of ctx, or nil.
+func PayloadCaptureFrom(ctx context.Context) *PayloadCapture {
+	capture, _ := ctx.Value(payloadCaptureKey{}).(*PayloadCapture)
+	return capture
+}
+
+// Payloads returns the payloads sent so far, in order.
+func (c *PayloadCapture) Payloads() []Payload {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Payload(nil), c.payloads...)
+}
+
+// capturePayload keeps body when ctx captures the payloads. It is copied, as
+// the caller may reuse it.
+func capturePayload(ctx context.Context, url string, body []byte) {
+	capture := PayloadCaptureFrom(ctx)
+	if capture == nil {
+		return
+	}
+	capture.mu.Lock()
+	defer capture.mu.Unlock()
+	capture.payloads = append(capture.payloads, Payload{URL: url, Body: bytes.Clone(body), SentAt: time.Now().UTC()})
+}
+
+// Replay sends payload again as it was, to the model given instead of the
+// one of the payload when it is not empty, and returns the whole reply. A
+// streamed payload is read to its end. The aliases, allowed models and
+// format retries do not apply: the server gets the exact body.
+func (c *OllamaClient) Replay(payload Payload, model string) (*ChatResponse, error) {
+	if payload.URL != cloudChatURL && payload.URL != fmt.Sprintf("%s/api/chat", c.baseURL) {
+		return nil, fmt.Errorf("cannot replay a payload sent to %s", payload.URL)
+	}
+	body := []byte(payload.Body)
+	if model != "" {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return nil, fmt.Errorf("error decoding payload: %w", err)
+		}
+		fields["model"], _ = json.Marshal(model)
+		var err error
+		if body, err = json.Marshal(fields); err != nil {
+			return nil, fmt.Errorf("error serializing request: %w", err)
+		}
+	}
+	httpReq, err := http.NewRequestWithContext(c.ctx, "POST", payload.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if payload.URL == cloudChatURL {
+		httpReq.Header.Set("Authorization", "Bearer "+c.settings.Load().apiKey)
+	}
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, requestError(c.ctx, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, statusError(resp.StatusCode, body)
+	}
+	return readChatResponse(resp.Body)
+}
@@ -0,0 +1,258 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type PIIConfig struct {
+	// Redact lists the redaction targets: "cloud" and/or "storage".
+	Redact   []string `yaml:"redact"`
+	NERModel string   `yaml:"ner_model"`
+}
+
+// PIIKind is the kind of personal data a placeholder stands for.
+type PIIKind string
+
+const (
+	PIIEmail PIIKind = "EMAIL"
+	PIIPhone PIIKind = "PHONE"
+	PIICard  PIIKind = "CARD"
+	PIIID    PIIKind = "ID"
+	PIIName  PIIKind = "NAME"
+)
+
+// piiPattern matches one kind of personal data. When the expression has a
+// capture group only the group is redacted, so context words are kept.
+type piiPattern struct {
+	kind  PIIKind
+	re    *regexp.Regexp
+	valid func(string) bool
+}
+
+// piiPatterns run in order: identifiers and card numbers go before phone
+// numbers, which would otherwise swallow their digits.
+var piiPatterns = []piiPattern{
+	{kind: PIIEmail, re: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)},
+	{kind: PIICard, re: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), valid: luhnValid},
+	{kind: PIIID, re: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)},                                       // US SSN
+	{kind: PIIID, re: regexp.MustCompile(`\b\d{3}\.\d{3}\.\d{3}-\d{2}\b`)},                               // BR CPF
+	{kind: PIIID, re: regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){3,7}(?: ?[A-Z0-9]{1,3})?\b`)}, // IBAN
+	{kind: PIIPhone, re: regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?(?:\(\d{2,4}\)[\s.-]?)?\b\d{3,5}[\s.-]?\d{4}\b`)},
+	{kind: PIIName, re: regexp.MustCompile(`\b(?:Mr|Mrs|Ms|Miss|Dr|Prof)\.?\s+([A-Z][a-z]+(?:\s+[A-Z][a-z]+)?)`)},
+	{kind: PIIName, re: regexp.MustCompile(`(?i:\bmy name is|\bi am|\bi'm|\bthis is)\s+([A-Z][a-z]+(?:\s+[A-Z][a-z]+)?)`)},
+}
+
+// PIIRedactor replaces personal data with placeholders such as [EMAIL_1]
+// before prompts leave the host or are stored.
+type PIIRedactor struct {
+	client   Backend
+	nerModel string
+	// Cloud redacts the prompts sent to Ollama Cloud; the placeholders in
+	// the reply are restored before it is returned.
+	Cloud bool
+	// Storage redacts the prompts and replies kept in the generation log.
+	Storage bool
+}
+
+// NewPIIRedactor returns the redactor for config, or nil when redaction is
+// off. The NER model, when set, runs on client.
+func NewPIIRedactor(client Backend, config PIIConfig) *PIIRedactor {
+	redactor := &PIIRedactor{client: client, nerModel: config.NERModel}
+	for _, target := range config.Redact {
+		switch target {
+		case "cloud":
+			redactor.Cloud = true
+		case "storage":
+			redactor.Storage = true
+		}
+	}
+	if !redactor.Cloud && !redactor.Storage {
+		return nil
+	}
+	return redactor
+}
+
+// RedactMessages returns a copy of messages with personal data replaced and
+// the redaction needed to restore it. Names are looked up with the NER model
+// when one is configured.
+func (p *PIIRedactor) RedactMessages(ctx context.Context, messages []Message) ([]Message, *Redaction) {
+	redaction := NewRedaction()
+	if p.nerModel != "" {
+		names, err := p.names(ctx, messages)
+		if err != nil {
+			log.Println("Error detecting names, using patterns only: ", err)
+		}
+		redaction.addNames(names)
+	}
+	redacted := make([]Message, len(messages))
+	for i, message := range messages {
+		message.Content = redaction.Redact(message.Content)
+		redacted[i] = message
+	}
+	return redacted, redaction
+}
+
+var piiNamesFormat = ResponseFormat(`{"type":"object","properties":{"names":{"type":"array","items":{"type":"string"}}},"required":["names"]}`)
+
+const piiNamesPrompt = `List the full names of real people mentioned in the text. Answer with a JSON object: {"names": ["..."]}. Answer {"names": []} when there are none.`
+
+// names asks the local NER model for the person names in the user messages.
+func (p *PIIRedactor) names(ctx context.Context, messages []Message) ([]string, error) {
+	parts := make([]string, 0, len(messages))
+	for _, message := range messages {
+		if message.Role != "system" {
+			parts = append(parts, message.Content)
+		}
+	}
+	response, err := p.client.WithContext(ctx).Chat(ChatRequest{
+		Model: p.nerModel,
+		Messages: []Message{
+			{Role: "system", Content: piiNamesPrompt},
+			{Role: "user", Content: strings.Join(parts, "\n")},
+		},
+		Format: piiNamesFormat,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var found struct {
+		Names []string `json:"names"`
+	}
+	if err := json.Unmarshal([]byte(response.Message.Content), &found); err != nil {
+		return nil, fmt.Errorf("error decoding names: %w", err)
+	}
+	return found.Names, nil
+}
+
+// Redaction maps the placeholders of one call back to the values they
+// replaced. The same value always gets the same placeholder.
+type Redaction struct {
+	placeholders map[string]string
+	values       map[string]string
+	counts       map[PIIKind]int
+	names        []string
+}
+
+func NewRedaction() *Redaction {
+	return &Redaction{
+		placeholders: make(map[string]string),
+		values:       make(map[string]string),
+		counts:       make(map[PIIKind]int),
+	}
+}
+
+// Len returns the number of distinct values redacted so far.
+func (r *Redaction) Len() int {
+	return len(r.values)
+}
+
+func (r *Redaction) addNames(names []string) {
+	for _, name := range names {
+		if name = strings.TrimSpace(name); len(name) > 1 {
+			r.names = append(r.names, name)
+		}
+	}
+	// longest first, so "Ada Lovelace" wins over "Ada"
+	sort.Slice(r.names, func(i, j int) bool { return len(r.names[i]) > len(r.names[j]) })
+}
+
+func (r *Redaction) placeholder(kind PIIKind, value string) string {
+	if placeholder, ok := r.placeholders[value]; ok {
+		return placeholder
+	}
+	r.counts[kind]++
+	placeholder := fmt.Sprintf("[%s_%d]", kind, r.counts[kind])
+	r.placeholders[value] = placeholder
+	r.values[placeholder] = value
+	return placeholder
+}
+
+// Redact replaces the personal data in text with placeholders.
+func (r *Redaction) Redact(text string) string {
+	for _, name := range r.names {
+		text = strings.ReplaceAll(text, name, r.placeholder(PIIName, name))
+	}
+	for _, pattern := range piiPatterns {
+		text = pattern.re.ReplaceAllStringFunc(text, func(match string) string {
+			value := match
+			if pattern.re.NumSubexp() > 0 {
+				value = pattern.re.FindStringSubmatch(match)[1]
+			}
+			if pattern.valid != nil && !pattern.valid(value) {
+				return match
+			}
+			return strings.Replace(match, value, r.placeholder(pattern.kind, value), 1)
+		})
+	}
+	return text
+}
+
+// Restore puts the original values back in place of the placeholders.
+func (r *Redaction) Restore(text string) string {
+	if len(r.values) == 0 || !strings.Contains(text, "[") {
+		return text
+	}
+	for placeholder, value := range r.values {
+		text = strings.ReplaceAll(text, placeholder, value)
+	}
+	return text
+}
+
+// Restorer restores placeholders in streamed text, holding back a
+// placeholder split across chunks until it is complete.
+func (r *Redaction) Restorer() *Restorer {
+	return &Restorer{redaction: r}
+}
+
+type Restorer struct {
+	redaction *Redaction
+	pending   string
+}
+
+// maxPlaceholderLen bounds how much text is held back waiting for a "]".
+const maxPlaceholderLen = 16
+
+func (s *Restorer) Write(chunk string) string {
+	s.pending += chunk
+	open := strings.LastIndex(s.pending, "[")
+	if open < 0 || strings.Contains(s.pending[open:], "]") || len(s.pending)-open > maxPlaceholderLen {
+		return s.Flush()
+	}
+	ready := s.pending[:open]
+	s.pending = s.pending[open:]
+	return s.redaction.Restore(ready)
+}
+
+// Flush returns the text still held back.
+func (s *Restorer) Flush() string {
+	text := s.redaction.Restore(s.pending)
+	s.pending = ""
+	return text
+}
+
+// luhnValid filters card-like digit runs down to real card numbers.
+func luhnValid(number string) bool {
+	sum, digits := 0, 0
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c == ' ' || c == '-' {
+			continue
+		}
+		d := int(c - '0')
+		if digits%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+	}
+	return digits >= 13 && sum%10 == 0
+}
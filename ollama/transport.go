@@ -0,0 +1,63 @@
+package ollama
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// TransportConfig tunes the connections of the Ollama client. The whole
+// request is bounded by the route timeouts, so these only cover the phases
+// of a connection and a zero duration leaves the phase unbounded.
+type TransportConfig struct {
+	// MaxIdleConns is the number of idle connections kept across hosts.
+	MaxIdleConns int `yaml:"max_idle_conns"`
+	// MaxIdleConnsPerHost is the number of idle connections kept to Ollama,
+	// which bounds the reuse under concurrent load. Go defaults to 2.
+	MaxIdleConnsPerHost int `yaml:"max_idle_conns_per_host"`
+	// MaxConnsPerHost caps the connections to Ollama; 0 is unlimited.
+	MaxConnsPerHost int           `yaml:"max_conns_per_host"`
+	IdleConnTimeout time.Duration `yaml:"idle_conn_timeout"`
+	DialTimeout     time.Duration `yaml:"dial_timeout"`
+	KeepAlive       time.Duration `yaml:"keep_alive"`
+	TLSHandshake    time.Duration `yaml:"tls_handshake_timeout"`
+	// ResponseHeader bounds the wait for the response headers. A
+	// non-streaming chat only gets them when the generation is complete, so
+	// it must be longer than the slowest generation; 0 leaves it to the
+	// route timeouts. Streamed bodies are not bounded by it.
+	ResponseHeader time.Duration `yaml:"response_header_timeout"`
+}
+
+func DefaultTransportConfig() TransportConfig {
+	return TransportConfig{
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 32,
+		MaxConnsPerHost:     0,
+		IdleConnTimeout:     90 * time.Second,
+		DialTimeout:         10 * time.Second,
+		KeepAlive:           30 * time.Second,
+		TLSHandshake:        10 * time.Second,
+		ResponseHeader:      0,
+	}
+}
+
+// NewTransport returns an http.Transport with the configured pool and
+// timeouts.
+func (t TransportConfig) NewTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   t.DialTimeout,
+		KeepAlive: t.KeepAlive,
+	}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          t.MaxIdleConns,
+		MaxIdleConnsPerHost:   t.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       t.MaxConnsPerHost,
+		IdleConnTimeout:       t.IdleConnTimeout,
+		TLSHandshakeTimeout:   t.TLSHandshake,
+		ResponseHeaderTimeout: t.ResponseHeader,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
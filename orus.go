@@ -1,38 +1,386 @@
-package main
+package orus
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	bge_m3 "github.com/Dsouza10082/go-bge-m3-embed"
-	"github.com/joho/godotenv"
+	"github.com/Dsouza10082/orus/ollama"
 )
 
 type Orus struct {
+	// config is the snapshot of the configuration in effect, swapped on reload.
+	config        atomic.Pointer[Config]
 	BGEM3Embedder *bge_m3.GolangBGE3M3Embedder
-	OrusAPI       *OrusAPI
-	OllamaClient  *OllamaClient
+	// Clip is nil when no CLIP image encoder is configured.
+	Clip          *ClipEmbedder
+	Backend       ollama.Backend
+	Sessions      SessionStore
+	// Storage is nil when the state is kept in memory.
+	Storage       *SQLStore
+	// KV is the embedded key-value storage of the documents and jobs; nil
+	// unless the storage driver is badger or bolt.
+	KV            *KVStore
+	VectorStore   *VectorStore
+	Memory        *AgentMemory
+	SessionIndex  *SessionIndex
+	Generations   *GenerationLog
+	// Payloads are the upstream payloads captured in debug mode.
+	Payloads      *PayloadLog
+	Feedback      FeedbackStore
+	// APIKeys are the keys created through the API, accepted along with
+	// the keys of the configuration.
+	APIKeys       APIKeyStore
+	Documents     *DocumentIndex
+	UISettings    UISettingsStore
+	Screener      *Screener
+	Tools         *ToolRegistry
+	// WebSearch is nil when no web search provider is configured.
+	WebSearch     WebSearcher
+	Workflows     *Workflows
+	Agents        *Agents
+	// Images is nil when the image directory cannot be created.
+	Images        *ImageStore
+	// Uploads keeps the files uploaded for ingestion; nil unless they are
+	// kept.
+	Uploads       BlobStore
+	// Snapshots keeps the snapshots of the vector collections.
+	Snapshots     BlobStore
+	// Backups keeps the backup archives.
+	Backups       BlobStore
+	PII           *ollama.PIIRedactor
+	Audit         *Auditor
+	// Usage is nil when the usage directory cannot be created.
+	Usage         *UsageLog
+	SlowRequests  *SlowLog
+	// Webhooks is nil when no webhook secret is configured.
+	Webhooks      *Webhooks
+	// Monitor tracks Ollama and the model calls, and alerts when they
+	// degrade.
+	Monitor       *Monitor
+	// ModelStats times the chats of each model.
+	ModelStats    *ModelStats
+	ResponseCache *ResponseCache
+	// EmbeddingCache is nil when embeddings are not cached.
+	EmbeddingCache *EmbeddingCache
+	// Idempotency is nil when the Idempotency-Key header is ignored.
+	Idempotency   *IdempotencyStore
+	// Evictions counts the entries removed from the caches and stores.
+	Evictions     *Evictions
+	// Janitor removes the expired entries and the idle sessions.
+	Janitor       *Janitor
+	// Redis is nil when the caches, idempotency keys and rate limits are
+	// kept by each replica.
+	Redis         *RedisClient
+	// Hooks run around every chat and embedding of Backend and the
+	// embedders.
+	Hooks         *Hooks
+	// embedders are the embedding models by name.
+	embeddersMu sync.RWMutex
+	embedders   map[string]Embedder
+	// backupMu lets a single backup or restore run at a time.
+	backupMu sync.Mutex
 }
 
-func NewOrus() *Orus {
+// NewOrus returns the Orus of config, generating and embedding with its
+// Ollama. It fails when config is invalid. A feature that fails to load is
+// disabled and reported in a *DegradedError returned along with the Orus,
+// which serves the other features, so the program decides whether to run
+// degraded.
+func NewOrus(config Config) (*Orus, error) {
+	ollamaClient := ollama.NewOllamaClient(config.Ollama.BaseURL).
+		SetAPIKey(config.Ollama.APIKey.Reveal()).
+		SetFormatRetries(config.Ollama.FormatRetries).
+		SetModels(config.Ollama.Models).
+		SetAliases(config.Ollama.Aliases).
+		SetTransport(config.Ollama.Transport)
+	return NewOrusWithBackend(config, ollamaClient)
+}
+
+// DegradedError lists the features of an Orus that failed to load and are
+// disabled.
+type DegradedError struct {
+	Failures []error
+}
+
+func (e *DegradedError) Error() string {
+	messages := make([]string, len(e.Failures))
+	for i, failure := range e.Failures {
+		messages[i] = failure.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e *DegradedError) Unwrap() []error {
+	return e.Failures
+}
+
+// NewOrusWithBackend is NewOrus generating and embedding with backend
+// instead of the Ollama of the configuration, such as orustest.Backend in
+// tests. The PII redaction of the cloud prompts only applies to an
+// OllamaClient.
+func NewOrusWithBackend(config Config, backend ollama.Backend) (*Orus, error) {
+	if backend == nil {
+		return nil, errors.New("a backend is required")
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	degraded := &DegradedError{}
+	fail := func(format string, args ...interface{}) {
+		degraded.Failures = append(degraded.Failures, fmt.Errorf(format, args...))
+	}
 	bge_m3_embedder := bge_m3.NewGolangBGE3M3Embedder().
-		SetMemoryPath(LoadEnv("ORUS_API_AGENT_MEMORY_PATH")).
-		SetTokPath(LoadEnv("ORUS_API_TOK_PATH")).
-		SetOnnxPath(LoadEnv("ORUS_API_ONNX_PATH")).
-		SetRuntimePath(LoadEnv("ORUS_API_ONNX_RUNTIME_PATH"))
-	bge_m3_embedder.EmbeddingModel.SetOnnxModelPath(LoadEnv("ORUS_API_ONNX_PATH"))
-	bge_m3_embedder.Verbose = true
-	ollamaClient := NewOllamaClient(LoadEnv("ORUS_API_OLLAMA_BASE_URL"))
-	return &Orus{
+		SetMemoryPath(config.Embedder.MemoryPath).
+		SetTokPath(config.Embedder.TokPath).
+		SetOnnxPath(config.Embedder.OnnxPath).
+		SetRuntimePath(config.Embedder.OnnxRuntimePath)
+	bge_m3_embedder.EmbeddingModel.SetOnnxModelPath(config.Embedder.OnnxPath)
+	bge_m3_embedder.Verbose = config.Server.Verbose
+	pii := ollama.NewPIIRedactor(backend, config.PII)
+	if ollamaClient, ok := backend.(*ollama.OllamaClient); ok {
+		ollamaClient.SetPIIRedactor(pii)
+	}
+	hooks := NewHooks()
+	stats := NewModelStats()
+	evictions := NewEvictions()
+	orus := &Orus{
 		BGEM3Embedder: bge_m3_embedder,
-		OllamaClient: ollamaClient,
+		Backend:      &hookedBackend{Backend: backend, hooks: hooks, stats: stats, ctx: context.Background()},
+		Hooks:        hooks,
+		ModelStats:   stats,
+		PII:          pii,
+		Sessions:     NewMemorySessionStore(),
+		VectorStore:  NewVectorStore().SetSearch(config.Search).SetFloat16(config.Search.Float16Collections...),
+		Generations:  NewGenerationLog(DefaultGenerationLogSize),
+		Payloads:     NewPayloadLog(config.Debug.CaptureSize),
+		Feedback:     NewMemoryFeedbackStore(),
+		APIKeys:      NewMemoryAPIKeyStore(),
+		ResponseCache: NewResponseCache(config.Cache).SetEvictions(evictions),
+		EmbeddingCache: NewEmbeddingCache(config.Embedder.CacheTTL, config.Embedder.CacheSize).SetEvictions(evictions),
+		Idempotency:  NewIdempotencyStore(config.Idempotency).SetEvictions(evictions),
+		Evictions:    evictions,
+		UISettings:   NewMemoryUISettingsStore(config.Server.UISettingsPath),
+		SlowRequests: NewSlowLog(config.SlowLog),
+		Webhooks:     NewWebhooks(config.Webhooks),
+	}
+	slowLogHooks(hooks)
+	orus.Monitor = NewMonitor(context.Background(), config.Monitor, config.Webhooks.Secret, orus.Backend)
+	monitorHooks(hooks, orus.Monitor)
+	// the files, blobs and shared caches holding prompts and documents are
+	// encrypted like the storage, and not kept when its keys cannot be read
+	cipher, cipherErr := NewCipher(config.Storage.Encryption)
+	if cipherErr != nil {
+		fail("error reading the encryption keys, the vector files and journals, the agent memory file, the uploads, snapshots and backups and the shared replies are disabled: %w", cipherErr)
+	}
+	orus.VectorStore.SetCipher(cipher)
+	redis, err := NewRedisClient(config.Redis)
+	if err != nil {
+		fail("error connecting to redis, the caches and limits are kept by this replica: %w", err)
+	} else if redis != nil {
+		orus.Redis = redis
+		if cipherErr == nil {
+			orus.ResponseCache.SetRedis(redis).SetCipher(cipher)
+			orus.Idempotency.SetRedis(redis).SetCipher(cipher)
+		}
+		orus.EmbeddingCache.SetRedis(redis)
+	}
+	if config.Storage.Enabled() {
+		storage, err := OpenSQLStore(config.Storage)
+		if err != nil {
+			fail("error opening storage, sessions, feedback, usage, documents and API keys are kept in memory: %w", err)
+		} else {
+			orus.Storage = storage
+			orus.Sessions = storage.Sessions()
+			orus.Feedback = storage.Feedback()
+			orus.APIKeys = storage.APIKeys()
+		}
+	}
+	if IsKVStorage(config.Storage.Driver) {
+		kv, err := OpenKVStore(config.Storage)
+		if err != nil {
+			fail("error opening storage, documents and jobs are kept in memory: %w", err)
+		} else {
+			orus.KV = kv
+			orus.Webhooks.SetJobs(kv.Jobs())
+			go kv.CompactEvery(config.Storage.CompactInterval)
+		}
+	}
+	kernel, err := UseSimilarityKernel(config.Search.Kernel)
+	if err != nil {
+		fail("error selecting similarity kernel, using the generic one: %w", err)
+	} else if config.Server.Verbose {
+		log.Println("Similarity kernel: ", kernel)
+	}
+	orus.config.Store(&config)
+	if cipherErr == nil {
+		for _, collection := range config.Search.MmapCollections {
+			path := filepath.Join(config.Search.MmapDir, collection+".vec")
+			if err := orus.VectorStore.OpenFile(collection, path); err != nil {
+				fail("error opening vector file, %s is kept in memory: %w", collection, err)
+			}
+		}
+		journal, err := OpenVectorJournal(config.Search.JournalDir, config.Search.JournalCollections, config.Search.JournalCheckpoint, cipher)
+		if err != nil {
+			fail("error opening the vector journal, the collections are not journaled: %w", err)
+		} else {
+			orus.VectorStore.SetJournal(journal)
+		}
+	}
+	orus.embedders = make(map[string]Embedder)
+	orus.RegisterEmbedder(NewONNXEmbedder(bge_m3_embedder))
+	for name, model := range map[string]string{"nomic-embed-text:latest": "nomic-embed-text:latest", "ollama-bge-m3": "bge-m3:latest"} {
+		embed := func(texts []string) ([][]float64, error) {
+			return backend.GetEmbeddings(model, texts)
+		}
+		batcher := NewEmbeddingBatcher(config.Embedder.BatchWindow, config.Embedder.BatchSize, embed)
+		orus.RegisterEmbedder(NewOllamaEmbedder(name, model, backend).SetBatcher(batcher))
+	}
+	cloudEmbedders, err := LoadCloudEmbedders(config.Embedder)
+	if err != nil {
+		fail("error loading cloud embedders, cloud embeddings are disabled: %w", err)
+	}
+	for _, embedder := range cloudEmbedders {
+		orus.RegisterEmbedder(embedder)
+	}
+	memoryPath := config.Embedder.MemoryPath
+	if cipherErr != nil {
+		memoryPath = ""
+	}
+	orus.Memory = NewAgentMemory(orus, orus.VectorStore, memoryPath).
+		SetEmbedModel(config.Embedder.MemoryModel)
+	orus.SessionIndex = NewSessionIndex(orus, orus.VectorStore).
+		SetEmbedModel(config.Embedder.SessionModel)
+	orus.Documents = NewDocumentIndex(orus, orus.VectorStore, RAGCollection)
+	media, err := NewMediaStore(config.Blobs, config.RAG.MediaDir)
+	if err != nil {
+		fail("error creating media store, document images are not indexed: %w", err)
+	} else {
+		orus.Documents.SetMedia(media)
+	}
+	if orus.Storage != nil {
+		orus.Documents.SetStore(orus.Storage.Documents())
+		if err := orus.Documents.Sync(); err != nil {
+			fail("error loading the shared documents: %w", err)
+		}
+		go orus.Documents.SyncEvery(config.Storage.SyncInterval)
+	}
+	if orus.KV != nil {
+		// a single server only loads its documents at startup
+		orus.Documents.SetStore(orus.KV.Documents())
+		if err := orus.Documents.Sync(); err != nil {
+			fail("error loading the stored documents: %w", err)
+		}
+	}
+	replayed, err := orus.VectorStore.Recover()
+	if err != nil {
+		fail("error replaying the vector journal, the collections may miss their latest changes: %w", err)
+	} else if replayed > 0 {
+		log.Printf("Replayed %d journaled changes of the vector collections", replayed)
+	}
+	screener, err := LoadScreener(orus.Backend, config.Screening.Path)
+	if err != nil {
+		fail("error loading screening config, screening is disabled: %w", err)
 	}
+	orus.Screener = screener
+	tools, err := LoadToolRegistry(config.Tools.Path)
+	if err != nil {
+		fail("error loading tools file, only the built-in tools are available: %w", err)
+	}
+	orus.Tools = tools
+	webSearch, err := LoadWebSearcher(config.WebSearch)
+	if err != nil {
+		fail("error loading web search, web search is disabled: %w", err)
+	}
+	if webSearch != nil {
+		orus.WebSearch = webSearch
+		_ = tools.Register(webSearchTool(webSearch, config.WebSearch.Results))
+	}
+	workflows, err := LoadWorkflows(orus, config.Workflows.Path)
+	if err != nil {
+		fail("error loading workflows: %w", err)
+	}
+	orus.Workflows = workflows
+	agents, err := LoadAgents(orus, config.Agents.Path)
+	if err != nil {
+		fail("error loading agents: %w", err)
+	}
+	orus.Agents = agents
+	images, err := NewImageStore(config.Images, config.Blobs)
+	if err != nil {
+		fail("error creating image store, image uploads are disabled: %w", err)
+	}
+	orus.Images = images
+	if config.Blobs.KeepUploads && cipherErr == nil {
+		uploads, err := OpenBlobStore(config.Blobs, "uploads", "")
+		if err != nil {
+			fail("error opening the upload store, uploaded documents are not kept: %w", err)
+		} else {
+			orus.Uploads = SealBlobs(uploads, cipher)
+		}
+	}
+	if cipherErr == nil {
+		snapshots, err := OpenBlobStore(config.Blobs, "snapshots", "")
+		if err != nil {
+			fail("error opening the snapshot store, snapshots are disabled: %w", err)
+		} else {
+			orus.Snapshots = SealBlobs(snapshots, cipher)
+		}
+		backups, err := OpenBlobStore(config.Blobs, "backups", "")
+		if err != nil {
+			fail("error opening the backup store, backups are disabled: %w", err)
+		} else {
+			orus.Backups = SealBlobs(backups, cipher)
+		}
+	}
+	clip, err := NewClipEmbedder(config.Embedder)
+	if err != nil {
+		fail("error loading CLIP encoders, image embeddings are disabled: %w", err)
+	}
+	orus.Clip = clip
+	orus.RegisterEmbedder(NewClipTextEmbedder(clip))
+	auditor, err := LoadAuditor(config.Audit, config.Storage.Encryption, orus.Storage)
+	if err != nil {
+		fail("error loading audit sink, auditing is disabled: %w", err)
+	}
+	orus.Audit = auditor
+	usage, err := LoadUsageLog(config.Usage, orus.Storage)
+	if err != nil {
+		fail("error opening usage log, usage is not recorded: %w", err)
+	} else {
+		orus.Usage = usage
+		usageHooks(hooks)
+	}
+	orus.Janitor = NewJanitor(orus)
+	go orus.Janitor.RunEvery(config.Janitor.Interval)
+	if len(degraded.Failures) > 0 {
+		return orus, degraded
+	}
+	return orus, nil
+}
+
+// CurrentConfig returns the configuration in effect, including the settings
+// changed by the last reload.
+func (s *Orus) CurrentConfig() Config {
+	return *s.config.Load()
+}
+
+// SetConfig puts config in effect, for the settings read on every request.
+func (s *Orus) SetConfig(config Config) {
+	s.config.Store(&config)
 }
 
 func (s *Orus) EmbedWithBGE_M3(text string) ([]float32, error) {
+	onnxMu.Lock()
 	vector, err := s.BGEM3Embedder.Embed(text)
+	onnxMu.Unlock()
 	if err != nil {
 		log.Println("Error embedding text: ", err)
 		return nil, err
@@ -41,7 +389,7 @@ func (s *Orus) EmbedWithBGE_M3(text string) ([]float32, error) {
 }
 
 func (s *Orus) EmbedWithOllama(text string) ([]float64, error) {
-	vector, err := s.OllamaClient.GetEmbedding("nomic-embed-text", text)
+	vector, err := s.Backend.GetEmbedding("nomic-embed-text", text)
 	if err != nil {
 		log.Println("Error embedding text: ", err)
 		return nil, err
@@ -49,8 +397,17 @@ func (s *Orus) EmbedWithOllama(text string) ([]float64, error) {
 	return vector, nil
 }
 
-func (s *Orus) CallLLM(model string, messages []Message, stream bool) (string, error) {
-	response, err := s.OllamaClient.Chat(ChatRequest{
+// Embed returns the embedding of text using one of the models accepted by /embed-text.
+func (s *Orus) Embed(model string, text string) ([]float64, error) {
+	embedder, err := s.Embedder(model)
+	if err != nil {
+		return nil, err
+	}
+	return embedder.Embed(context.Background(), text)
+}
+
+func (s *Orus) CallLLM(model string, messages []ollama.Message, stream bool) (string, error) {
+	response, err := s.Backend.Chat(ollama.ChatRequest{
 		Model: model,
 		Messages: messages,
 		Stream: stream,
@@ -64,12 +421,12 @@ func (s *Orus) CallLLM(model string, messages []Message, stream bool) (string, e
 
 func (s *Orus) PullLLMModel(model string) (string, error) {
 
-	progressCallback := func(progress PullModelProgress) {
+	progressCallback := func(progress ollama.PullModelProgress) {
 		data, _ := json.Marshal(progress)
 		fmt.Println(string(data))
 	}
 
-	err := s.OllamaClient.PullModel(model, progressCallback)
+	err := s.Backend.PullModel(model, progressCallback)
 	if err != nil {
 		return "Error pulling model: " + err.Error(), err
 	}
@@ -77,16 +434,8 @@ func (s *Orus) PullLLMModel(model string) (string, error) {
 	return "Model pulled successfully", nil
 }
 
-func LoadEnv(key string) string {
-	err := godotenv.Load(".env")
-	if err != nil {
-		log.Println("Error loading.env file " + err.Error())
-		return ""
-	}
-	value := os.Getenv(key)
-	if value == "" {
-		log.Println("Environment variable " + key + " is not set")
-		return ""
-	}
-	return value
-}
+// ==================== Request Types ====================
+
+// EmbedModels are the built-in embedding models; EmbedderNames adds the
+// cloud models and the embedders registered by the program.
+var EmbedModels = []string{"bge-m3", "nomic-embed-text:latest", "ollama-bge-m3", ClipModel}
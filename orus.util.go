@@ -1,8 +1,20 @@
-package main
+package orus
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
 func ConvertInterfaceToStrings(input []interface{}) []string {
 	result := make([]string, 0, len(input))
 	for _, val := range input {
@@ -13,4 +25,20 @@ func ConvertInterfaceToStrings(input []interface{}) []string {
 		}
 	}
 	return result
-}
\ No newline at end of file
+}
+
+// SplitThinking separates the reasoning that models such as deepseek-r1 wrap
+// in <think> tags from the final answer. While the closing tag has not been
+// streamed yet the whole content is reasoning.
+func SplitThinking(content string) (thinking string, answer string) {
+	trimmed := strings.TrimLeft(content, " \t\r\n")
+	if !strings.HasPrefix(trimmed, "<think>") {
+		return "", content
+	}
+	trimmed = strings.TrimPrefix(trimmed, "<think>")
+	end := strings.Index(trimmed, "</think>")
+	if end < 0 {
+		return strings.TrimSpace(trimmed), ""
+	}
+	return strings.TrimSpace(trimmed[:end]), strings.TrimLeft(trimmed[end+len("</think>"):], " \t\r\n")
+}
@@ -0,0 +1,119 @@
+package orusclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Dsouza10082/orus/ollama"
+)
+
+// ChatRequest is a chat with a local model, sent to /orus-api/v1/call-llm.
+type ChatRequest struct {
+	Model    string
+	Messages []ollama.Message
+	Think    bool
+	// Format is ollama.FormatJSON or a JSON Schema the reply must match.
+	Format ollama.ResponseFormat
+	// Images are base64 images or the handles of uploaded images, for
+	// vision models.
+	Images  []string
+	Options map[string]interface{}
+	// AutoTools runs the tools the model calls on the server; Tools picks
+	// the registered tools offered to the model, or all of them when empty.
+	AutoTools bool
+	Tools     []string
+	// RespondAs is a Go type or JSON Schema the reply must match, decoded
+	// into ChatResponse.Result.
+	RespondAs     json.RawMessage
+	RepairRetries *int
+	// Transforms post-process the reply, in order, such as
+	// "sanitize_markdown" or "mask_profanity".
+	Transforms []string
+}
+
+// ChatResponse is the reply of a chat.
+type ChatResponse struct {
+	Content string `json:"content"`
+	Serial  string `json:"serial"`
+	Model   string `json:"model"`
+	// Cache is "hit", "miss" or "bypass" when the response cache is on.
+	Cache string `json:"cache,omitempty"`
+	// Result is the reply decoded along RespondAs.
+	Result    json.RawMessage `json:"result,omitempty"`
+	TimeTaken string          `json:"time_taken"`
+}
+
+type chatBody struct {
+	Model         string                 `json:"model"`
+	Think         bool                   `json:"think"`
+	Messages      []ollama.Message       `json:"messages"`
+	Stream        bool                   `json:"stream"`
+	Format        ollama.ResponseFormat  `json:"format,omitempty"`
+	Images        []string               `json:"images,omitempty"`
+	Options       map[string]interface{} `json:"options,omitempty"`
+	AutoTools     bool                   `json:"auto_tools,omitempty"`
+	Tools         []string               `json:"tools,omitempty"`
+	RespondAs     json.RawMessage        `json:"respond_as,omitempty"`
+	RepairRetries *int                   `json:"repair_retries,omitempty"`
+	Transforms    []string               `json:"transforms,omitempty"`
+}
+
+func (r ChatRequest) body(stream bool) interface{} {
+	return map[string]interface{}{
+		"created": time.Now().UTC().Format(time.RFC3339),
+		"body": chatBody{
+			Model:         r.Model,
+			Think:         r.Think,
+			Messages:      r.Messages,
+			Stream:        stream,
+			Format:        r.Format,
+			Images:        r.Images,
+			Options:       r.Options,
+			AutoTools:     r.AutoTools,
+			Tools:         r.Tools,
+			RespondAs:     r.RespondAs,
+			RepairRetries: r.RepairRetries,
+			Transforms:    r.Transforms,
+		},
+	}
+}
+
+// Chat sends a chat and waits for the whole reply.
+func (c *Client) Chat(ctx context.Context, request ChatRequest) (*ChatResponse, error) {
+	resp, err := c.postJSON(ctx, "/orus-api/v1/call-llm", request.body(false), "application/json")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, apiError(resp)
+	}
+	defer resp.Body.Close()
+	// the reply of a chat is not wrapped in data
+	var answer struct {
+		ChatResponse
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+		Error   string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+	if !answer.Success {
+		return nil, &APIError{StatusCode: resp.StatusCode, Code: answer.Error, Message: answer.Message}
+	}
+	return &answer.ChatResponse, nil
+}
+
+// ChatStream sends a chat whose reply is streamed as token and thinking
+// events, or partial events with a JSON format, then a done event with the
+// whole reply.
+func (c *Client) ChatStream(ctx context.Context, request ChatRequest) (*Stream, error) {
+	resp, err := c.postJSON(ctx, "/orus-api/v1/call-llm", request.body(true), "text/event-stream")
+	if err != nil {
+		return nil, err
+	}
+	return newStream(resp)
+}
@@ -0,0 +1,203 @@
+// Package orusclient is a Go client of the Orus HTTP API.
+package orusclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultRetries is how many times a request refused by a busy server,
+	// or that could not connect, is sent again.
+	DefaultRetries      = 3
+	DefaultRetryBackoff = 500 * time.Millisecond
+	// maxRetryWait caps the wait before a retry, whatever Retry-After asks.
+	maxRetryWait = 30 * time.Second
+)
+
+// Client calls an Orus server. It is safe for concurrent use once
+// configured.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	apiKey     string
+	priority   string
+	retries    int
+	backoff    time.Duration
+}
+
+// NewClient returns a client of the Orus server at baseURL, such as
+// "http://localhost:8081".
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{},
+		retries:    DefaultRetries,
+		backoff:    DefaultRetryBackoff,
+	}
+}
+
+// SetAPIKey sets the key sent in the X-API-Key header, for servers started
+// with ORUS_API_REQUIRE_AUTH.
+func (c *Client) SetAPIKey(apiKey string) *Client {
+	c.apiKey = apiKey
+	return c
+}
+
+// SetHTTPClient replaces the HTTP client. Its Timeout also bounds the
+// streams, so deadlines are better set on the contexts.
+func (c *Client) SetHTTPClient(httpClient *http.Client) *Client {
+	c.httpClient = httpClient
+	return c
+}
+
+// SetPriority sends the X-Orus-Priority header: "low", "normal" or "high".
+// Batch jobs should send "low".
+func (c *Client) SetPriority(priority string) *Client {
+	c.priority = priority
+	return c
+}
+
+// SetRetries sets how many times a request is retried, waiting backoff and
+// then twice as long at each attempt, or what the Retry-After header asks.
+func (c *Client) SetRetries(retries int, backoff time.Duration) *Client {
+	if retries >= 0 {
+		c.retries = retries
+	}
+	if backoff > 0 {
+		c.backoff = backoff
+	}
+	return c
+}
+
+// APIError is an error answered by the server, or sent as the error event
+// of a stream.
+type APIError struct {
+	StatusCode int
+	// Code is the machine readable error, such as "server_busy".
+	Code    string
+	Message string
+}
+
+func (e *APIError) Error() string {
+	switch {
+	case e.Message == "":
+		return fmt.Sprintf("orus: %s (status %d)", e.Code, e.StatusCode)
+	case e.Code == "":
+		return "orus: " + e.Message
+	}
+	return fmt.Sprintf("orus: %s (%s)", e.Message, e.Code)
+}
+
+// response is the envelope of the JSON answers of the API.
+type response struct {
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Error   string          `json:"error"`
+	Data    json.RawMessage `json:"data"`
+}
+
+func (c *Client) postJSON(ctx context.Context, path string, body interface{}, accept string) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("error serializing request: %w", err)
+	}
+	return c.do(ctx, http.MethodPost, path, "application/json", accept, data)
+}
+
+// do sends a request, again while the server is busy or cannot be reached.
+// A request is only retried when it was not run: a 429 or 503 is answered
+// before a generation starts, and a refused connection sent nothing.
+func (c *Client) do(ctx context.Context, method, path, contentType, accept string, body []byte) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("error creating request: %w", err)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if c.apiKey != "" {
+			req.Header.Set("X-API-Key", c.apiKey)
+		}
+		if c.priority != "" {
+			req.Header.Set("X-Orus-Priority", c.priority)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if attempt >= c.retries || !retryable(resp, err) {
+			if err != nil {
+				return nil, fmt.Errorf("error making request: %w", err)
+			}
+			return resp, nil
+		}
+		wait := c.backoff << attempt
+		if resp != nil {
+			if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+				wait = time.Duration(seconds) * time.Second
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		timer := time.NewTimer(min(wait, maxRetryWait))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		var opError *net.OpError
+		return errors.As(err, &opError) && opError.Op == "dial"
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable
+}
+
+// decode reads the data of a JSON answer into v, or the error it reports.
+func decode(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	var answer response
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		if resp.StatusCode >= http.StatusBadRequest {
+			return &APIError{StatusCode: resp.StatusCode, Code: http.StatusText(resp.StatusCode)}
+		}
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest || !answer.Success {
+		return &APIError{StatusCode: resp.StatusCode, Code: answer.Error, Message: answer.Message}
+	}
+	if v == nil {
+		return nil
+	}
+	if err := json.Unmarshal(answer.Data, v); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	return nil
+}
+
+// apiError reads the error of an answer that is not the expected one.
+func apiError(resp *http.Response) error {
+	defer resp.Body.Close()
+	var answer response
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if json.Unmarshal(body, &answer) != nil {
+		return &APIError{StatusCode: resp.StatusCode, Code: http.StatusText(resp.StatusCode), Message: strings.TrimSpace(string(body))}
+	}
+	return &APIError{StatusCode: resp.StatusCode, Code: answer.Error, Message: answer.Message}
+}
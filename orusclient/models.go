@@ -0,0 +1,39 @@
+package orusclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// PullProgress is the progress of a model download.
+type PullProgress struct {
+	Status    string `json:"status"`
+	Digest    string `json:"digest,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+	Completed int64  `json:"completed,omitempty"`
+}
+
+// PullModel downloads an Ollama model on the server, calling progress, when
+// not nil, as the download goes.
+func (c *Client) PullModel(ctx context.Context, name string, progress func(PullProgress)) error {
+	resp, err := c.postJSON(ctx, "/orus-api/v1/ollama-pull-model", map[string]string{"name": name}, "text/event-stream")
+	if err != nil {
+		return err
+	}
+	stream, err := newStream(resp)
+	if err != nil {
+		return err
+	}
+	for event := range stream.Events() {
+		if event.Type != "progress" || progress == nil {
+			continue
+		}
+		var update PullProgress
+		if err := json.Unmarshal(event.Data, &update); err != nil {
+			return fmt.Errorf("error decoding progress event: %w", err)
+		}
+		progress(update)
+	}
+	return stream.Err()
+}
@@ -0,0 +1,134 @@
+package orusclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+)
+
+// Embed returns the embedding of text by model, such as "bge-m3".
+func (c *Client) Embed(ctx context.Context, model, text string) ([]float64, error) {
+	resp, err := c.postJSON(ctx, "/orus-api/v1/embed-text", map[string]string{"model": model, "text": text}, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var data struct {
+		Vector []float64 `json:"vector"`
+	}
+	if err := decode(resp, &data); err != nil {
+		return nil, err
+	}
+	return data.Vector, nil
+}
+
+// IndexRequest is a document to ingest into the RAG index.
+type IndexRequest struct {
+	// Source names the document; its previous chunks are replaced. It
+	// defaults to Filename.
+	Source   string
+	Filename string
+	// Content is the text, PDF or image to index.
+	Content    io.Reader
+	EmbedModel string
+	// ChunkSize and ChunkOverlap are in characters; 0 keeps the defaults of
+	// the server.
+	ChunkSize    int
+	ChunkOverlap int
+	// Images keeps the images of the document, which the server does by
+	// default.
+	Images *bool
+}
+
+// IndexResult tells how a document was indexed.
+type IndexResult struct {
+	Source       string `json:"source"`
+	Model        string `json:"model"`
+	Chunks       int    `json:"chunks"`
+	Images       int    `json:"images"`
+	ImageRecords int    `json:"image_records"`
+}
+
+// Index uploads a document to the RAG index. Scans and images are read by
+// OCR on the server.
+func (c *Client) Index(ctx context.Context, request IndexRequest) (*IndexResult, error) {
+	// the form is built in memory, so it can be sent again on a retry
+	form := &bytes.Buffer{}
+	writer := multipart.NewWriter(form)
+	part, err := writer.CreateFormFile("file", request.Filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, request.Content); err != nil {
+		return nil, fmt.Errorf("error reading document: %w", err)
+	}
+	fields := map[string]string{"source": request.Source, "embed_model": request.EmbedModel}
+	if request.ChunkSize > 0 {
+		fields["chunk_size"] = strconv.Itoa(request.ChunkSize)
+	}
+	if request.ChunkOverlap > 0 {
+		fields["chunk_overlap"] = strconv.Itoa(request.ChunkOverlap)
+	}
+	if request.Images != nil {
+		fields["images"] = strconv.FormatBool(*request.Images)
+	}
+	for name, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := writer.WriteField(name, value); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, "/orus-api/v1/documents", writer.FormDataContentType(), "application/json", form.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	result := &IndexResult{}
+	if err := decode(resp, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SearchRequest is a search among the ingested documents.
+type SearchRequest struct {
+	Query string `json:"query"`
+	// EmbedModel must be the model the documents were indexed with.
+	EmbedModel string `json:"embed_model,omitempty"`
+	Limit      int    `json:"limit,omitempty"`
+}
+
+// SearchResult is a chunk found by a search.
+type SearchResult struct {
+	Source string `json:"source"`
+	Chunk  int    `json:"chunk"`
+	// Citation locates the chunk in its document, such as "page 12,
+	// section 3.2 Fees".
+	Citation   string  `json:"citation,omitempty"`
+	Content    string  `json:"content"`
+	Similarity float64 `json:"similarity"`
+}
+
+// Search returns the chunks of the ingested documents closest to the
+// query, most similar first.
+func (c *Client) Search(ctx context.Context, request SearchRequest) ([]SearchResult, error) {
+	resp, err := c.postJSON(ctx, "/orus-api/v1/documents/search", request, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var data struct {
+		Results []SearchResult `json:"results"`
+	}
+	if err := decode(resp, &data); err != nil {
+		return nil, err
+	}
+	return data.Results, nil
+}
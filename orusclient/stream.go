@@ -0,0 +1,226 @@
+package orusclient
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Event is an event of a stream, other than the done, error and aborted
+// events ending it.
+type Event struct {
+	// Type is the name of the event: "token", "thinking", "partial",
+	// "progress", "tool_call", "tool", "usage", "step", "agent" or "chunk".
+	Type string
+	Seq  int64
+	// Content is the text of a token or thinking event.
+	Content string
+	// Value is the reply so far of a partial event, sent instead of the
+	// tokens of a chat with a JSON format.
+	Value json.RawMessage
+	// Data is the JSON payload of the event.
+	Data json.RawMessage
+}
+
+// Done is the done event ending a stream successfully.
+type Done struct {
+	Message          string `json:"message"`
+	Serial           string `json:"serial,omitempty"`
+	RequestID        string `json:"request_id,omitempty"`
+	Model            string `json:"model,omitempty"`
+	Content          string `json:"content,omitempty"`
+	Thinking         string `json:"thinking,omitempty"`
+	PromptTokens     int    `json:"prompt_tokens,omitempty"`
+	CompletionTokens int    `json:"completion_tokens,omitempty"`
+	// FormatError tells why the reply does not match the requested format.
+	FormatError string `json:"format_error,omitempty"`
+	TimeTaken   string `json:"time_taken"`
+}
+
+// AbortedError ends a stream whose generation was stopped by the watchdog
+// of the server. The tokens received before it stay valid.
+type AbortedError struct {
+	// Reason is "max_tokens" or "repetition".
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+	Tokens  int    `json:"tokens"`
+}
+
+func (e *AbortedError) Error() string {
+	return "orus: " + e.Message
+}
+
+// Stream reads the Server-Sent Events of a streaming endpoint:
+//
+//	for stream.Next() {
+//		fmt.Print(stream.Event().Content)
+//	}
+//	if err := stream.Err(); err != nil {
+//		...
+//	}
+//
+// A stream must be closed, unless it was read to its end.
+type Stream struct {
+	body   io.ReadCloser
+	reader *bufio.Reader
+	event  Event
+	done   *Done
+	err    error
+}
+
+func newStream(resp *http.Response) (*Stream, error) {
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return nil, apiError(resp)
+	}
+	return &Stream{body: resp.Body, reader: bufio.NewReader(resp.Body)}, nil
+}
+
+// Next reads the next event, returning false at the end of the stream or
+// on an error.
+func (s *Stream) Next() bool {
+	if s.done != nil || s.err != nil {
+		return false
+	}
+	for {
+		name, id, data, err := s.read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			s.fail(fmt.Errorf("error reading stream: %w", err))
+			return false
+		}
+		switch name {
+		case "done":
+			var done Done
+			if err := json.Unmarshal(data, &done); err != nil {
+				s.fail(fmt.Errorf("error decoding done event: %w", err))
+				return false
+			}
+			s.done = &done
+			s.Close()
+			return false
+		case "error":
+			var payload struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			}
+			_ = json.Unmarshal(data, &payload)
+			s.fail(&APIError{StatusCode: http.StatusOK, Code: payload.Code, Message: payload.Message})
+			return false
+		case "aborted":
+			aborted := &AbortedError{}
+			_ = json.Unmarshal(data, aborted)
+			s.fail(aborted)
+			return false
+		case "":
+			// a comment or an event without data
+			continue
+		}
+		s.event = Event{Type: name, Seq: id, Data: data}
+		if name == "token" || name == "thinking" {
+			var payload struct {
+				Content string `json:"content"`
+			}
+			_ = json.Unmarshal(data, &payload)
+			s.event.Content = payload.Content
+		}
+		if name == "partial" {
+			var payload struct {
+				Value json.RawMessage `json:"value"`
+			}
+			_ = json.Unmarshal(data, &payload)
+			s.event.Value = payload.Value
+		}
+		return true
+	}
+}
+
+// Event returns the event read by the last call to Next.
+func (s *Stream) Event() Event {
+	return s.event
+}
+
+// Done returns the done event, once the stream ended successfully.
+func (s *Stream) Done() *Done {
+	return s.done
+}
+
+// Err returns the error that ended the stream: an *APIError for an error
+// event, an *AbortedError when the watchdog stopped the generation, or
+// the error reading the stream.
+func (s *Stream) Err() error {
+	return s.err
+}
+
+// Close stops reading the stream, which cancels the request on the server.
+func (s *Stream) Close() error {
+	return s.body.Close()
+}
+
+// Events iterates over the events of the stream, which is closed when the
+// loop ends. Err tells how the stream ended.
+func (s *Stream) Events() iter.Seq[Event] {
+	return func(yield func(Event) bool) {
+		defer s.Close()
+		for s.Next() {
+			if !yield(s.event) {
+				return
+			}
+		}
+	}
+}
+
+// Channel sends the events of the stream on a channel, closed at the end
+// of the stream. The channel must be drained, or the stream closed, for
+// its goroutine to end; Err tells how the stream ended once it is closed.
+func (s *Stream) Channel() <-chan Event {
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		for event := range s.Events() {
+			events <- event
+		}
+	}()
+	return events
+}
+
+func (s *Stream) fail(err error) {
+	s.err = err
+	s.Close()
+}
+
+// read reads an event up to the blank line ending it. The name of an event
+// without data is empty.
+func (s *Stream) read() (name string, id int64, data []byte, err error) {
+	lines := make([]string, 0, 1)
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil && (line == "" || !errors.Is(err, io.EOF)) {
+			return "", 0, nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if len(lines) == 0 {
+				name = ""
+			}
+			return name, id, []byte(strings.Join(lines, "\n")), nil
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			name = value
+		case "id":
+			id, _ = strconv.ParseInt(value, 10, 64)
+		case "data":
+			lines = append(lines, value)
+		}
+	}
+}
@@ -0,0 +1,377 @@
+// Package orustest provides a deterministic model backend, so programs
+// embedding Orus, and Orus itself, can be tested without a live Ollama.
+package orustest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Dsouza10082/orus/ollama"
+)
+
+// DefaultDimensions is the length of the embeddings of a Backend.
+const DefaultDimensions = 64
+
+// Backend is an ollama.Backend answering without a model. A chat is
+// answered with the reply set by SetReply or, by default, with an echo of
+// the last user message, streamed word by word. A text is embedded by
+// hashing its words, so texts sharing words are similar. The requests
+// received are recorded for assertions.
+type Backend struct {
+	// state is shared by the copies made by WithContext.
+	*state
+	ctx context.Context
+}
+
+type state struct {
+	mu           sync.Mutex
+	reply        string
+	err          error
+	dimensions   int
+	models       []string
+	capabilities map[string][]string
+	requests     []ollama.ChatRequest
+	embedded     []string
+}
+
+// NewBackend returns a backend with a chat model and the Ollama embedding
+// models installed.
+func NewBackend() *Backend {
+	return &Backend{
+		state: &state{
+			dimensions:   DefaultDimensions,
+			models:       []string{"llama3.1:8b", "nomic-embed-text:latest", "bge-m3:latest"},
+			capabilities: make(map[string][]string),
+		},
+		ctx: context.Background(),
+	}
+}
+
+var _ ollama.Backend = (*Backend)(nil)
+
+// SetReply sets the reply of every chat; empty echoes the last user
+// message.
+func (b *Backend) SetReply(reply string) *Backend {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reply = reply
+	return b
+}
+
+// SetError makes every call fail with err, until it is set back to nil.
+func (b *Backend) SetError(err error) *Backend {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.err = err
+	return b
+}
+
+// SetModels sets the installed models.
+func (b *Backend) SetModels(models ...string) *Backend {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.models = models
+	return b
+}
+
+// SetCapabilities sets the capabilities of model, which are "completion"
+// by default.
+func (b *Backend) SetCapabilities(model string, capabilities ...string) *Backend {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.capabilities[model] = capabilities
+	return b
+}
+
+// SetDimensions sets the length of the embeddings.
+func (b *Backend) SetDimensions(dimensions int) *Backend {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if dimensions > 0 {
+		b.dimensions = dimensions
+	}
+	return b
+}
+
+// Requests returns the chat requests received, in order.
+func (b *Backend) Requests() []ollama.ChatRequest {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.requests)
+}
+
+// Embedded returns the texts embedded, in order.
+func (b *Backend) Embedded() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.embedded)
+}
+
+func (b *Backend) WithContext(ctx context.Context) ollama.Backend {
+	return &Backend{state: b.state, ctx: ctx}
+}
+
+// check returns the error set by SetError, or the error of the context.
+func (b *Backend) check() error {
+	b.mu.Lock()
+	err := b.err
+	b.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return b.ctx.Err()
+}
+
+func (b *Backend) answer(req ollama.ChatRequest) (string, error) {
+	if err := b.check(); err != nil {
+		return "", err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.requests = append(b.requests, req)
+	if b.reply != "" {
+		return b.reply, nil
+	}
+	if len(req.Format) > 0 {
+		return "{}", nil
+	}
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i].Role == "user" {
+			return req.Messages[i].Content, nil
+		}
+	}
+	return "", nil
+}
+
+func (b *Backend) Chat(req ollama.ChatRequest) (*ollama.ChatResponse, error) {
+	reply, err := b.answer(req)
+	if err != nil {
+		return nil, err
+	}
+	return &ollama.ChatResponse{
+		Model:           req.Model,
+		Message:         ollama.Message{Role: "assistant", Content: reply},
+		CreatedAt:       time.Now(),
+		Done:            true,
+		PromptEvalCount: promptTokens(req),
+		EvalCount:       len(strings.Fields(reply)),
+	}, nil
+}
+
+func (b *Backend) ChatCloud(req ollama.ChatRequest) (*ollama.ChatResponse, error) {
+	return b.Chat(req)
+}
+
+// ChatStream streams the reply one word, with the space before it, per
+// chunk, then an empty chunk with Done set.
+func (b *Backend) ChatStream(req ollama.ChatRequest, callback ollama.ChatStreamFunc) error {
+	reply, err := b.answer(req)
+	if err != nil {
+		return err
+	}
+	chunks := splitWords(reply)
+	responses := make([]ollama.ChatStreamResponse, 0, len(chunks)+1)
+	for _, chunk := range chunks {
+		responses = append(responses, ollama.ChatStreamResponse{
+			Model:     req.Model,
+			Message:   ollama.Message{Role: "assistant", Content: chunk},
+			CreatedAt: time.Now(),
+		})
+	}
+	responses = append(responses, ollama.ChatStreamResponse{
+		Model:           req.Model,
+		Message:         ollama.Message{Role: "assistant"},
+		CreatedAt:       time.Now(),
+		Done:            true,
+		PromptEvalCount: promptTokens(req),
+		EvalCount:       len(chunks),
+	})
+	for _, response := range responses {
+		if err := b.ctx.Err(); err != nil {
+			return err
+		}
+		if err := callback(b.ctx, response); err != nil {
+			if errors.Is(err, ollama.ErrStopStream) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Backend) ChatStreamCloud(req ollama.ChatRequest, callback ollama.ChatStreamFunc) error {
+	return b.ChatStream(req, callback)
+}
+
+func (b *Backend) ChatStreamRaw(req ollama.ChatRequest, line func([]byte) error) error {
+	return b.ChatStream(req, func(ctx context.Context, chunk ollama.ChatStreamResponse) error {
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			return err
+		}
+		return line(append(data, '\n'))
+	})
+}
+
+func (b *Backend) Capabilities(model string) ([]string, error) {
+	if err := b.check(); err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if capabilities, ok := b.capabilities[model]; ok {
+		return slices.Clone(capabilities), nil
+	}
+	return []string{"completion"}, nil
+}
+
+func (b *Backend) ListModels() ([]string, error) {
+	if err := b.check(); err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.models), nil
+}
+
+func (b *Backend) ListModelDetails() ([]ollama.ModelInfo, error) {
+	models, err := b.ListModels()
+	if err != nil {
+		return nil, err
+	}
+	details := make([]ollama.ModelInfo, len(models))
+	for i, model := range models {
+		details[i] = ollama.ModelInfo{Name: model, Digest: fmt.Sprintf("%x", hashString(model))}
+		if strings.Contains(model, "embed") || strings.HasPrefix(model, "bge") {
+			details[i].Details.Family = "bert"
+		} else {
+			details[i].Details.Family = "llama"
+		}
+	}
+	return details, nil
+}
+
+// PullModel reports the steps of a download and installs the model.
+func (b *Backend) PullModel(model string, callback func(ollama.PullModelProgress)) error {
+	if err := b.check(); err != nil {
+		return err
+	}
+	for _, status := range []string{"pulling manifest", "downloading", "success"} {
+		if callback != nil {
+			callback(ollama.PullModelProgress{Status: status, Total: 1, Completed: 1})
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !slices.Contains(b.models, model) {
+		b.models = append(b.models, model)
+	}
+	return nil
+}
+
+func (b *Backend) DeleteModel(model string) error {
+	if err := b.check(); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	i := slices.Index(b.models, model)
+	if i < 0 {
+		return fmt.Errorf("model %q not found", model)
+	}
+	b.models = slices.Delete(b.models, i, i+1)
+	return nil
+}
+
+func (b *Backend) ResolveModel(model string) string {
+	return model
+}
+
+func (b *Backend) Version() (string, error) {
+	if err := b.check(); err != nil {
+		return "", err
+	}
+	return "orustest", nil
+}
+
+func (b *Backend) GetEmbedding(model, text string) ([]float64, error) {
+	embeddings, err := b.GetEmbeddings(model, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return embeddings[0], nil
+}
+
+func (b *Backend) GetEmbeddings(model string, texts []string) ([][]float64, error) {
+	if err := b.check(); err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.embedded = append(b.embedded, texts...)
+	embeddings := make([][]float64, len(texts))
+	for i, text := range texts {
+		embeddings[i] = embed(text, b.dimensions)
+	}
+	return embeddings, nil
+}
+
+// embed adds a unit per word at the position of its hash and normalizes
+// the sum. An empty text is embedded as the first axis.
+func embed(text string, dimensions int) []float64 {
+	vector := make([]float64, dimensions)
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		vector[hashString(word)%uint64(dimensions)]++
+	}
+	norm := 0.0
+	for _, v := range vector {
+		norm += v * v
+	}
+	if norm == 0 {
+		vector[0] = 1
+		return vector
+	}
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i] /= norm
+	}
+	return vector
+}
+
+func hashString(s string) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(s))
+	return hash.Sum64()
+}
+
+func splitWords(text string) []string {
+	words := make([]string, 0)
+	start := 0
+	for i := 1; i < len(text); i++ {
+		if text[i] == ' ' && text[i-1] != ' ' {
+			words = append(words, text[start:i])
+			start = i
+		}
+	}
+	if start < len(text) {
+		words = append(words, text[start:])
+	}
+	return words
+}
+
+func promptTokens(req ollama.ChatRequest) int {
+	tokens := 0
+	for _, message := range req.Messages {
+		tokens += len(strings.Fields(message.Content))
+	}
+	return tokens
+}
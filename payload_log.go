@@ -0,0 +1,69 @@
+package orus
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Dsouza10082/orus/ollama"
+)
+
+const DefaultPayloadLogSize = 500
+
+var ErrPayloadsNotFound = errors.New("no payloads captured for this serial")
+
+// CapturedRequest is what a request serial sent upstream: a payload per
+// chat, so several for a request repairing its format or calling tools.
+type CapturedRequest struct {
+	Serial    string           `json:"serial" swaggertype:"string" example:"123e4567-e89b-12d3-a456-426614174000"`
+	Endpoint  string           `json:"endpoint" swaggertype:"string" example:"/orus-api/v1/call-llm"`
+	Model     string           `json:"model" swaggertype:"string" example:"llama3.1:8b"`
+	Payloads  []ollama.Payload `json:"payloads" swaggertype:"array"`
+	CreatedAt time.Time        `json:"created_at" swaggertype:"string" example:"2021-01-01T00:00:00Z"`
+}
+
+// PayloadLog keeps the payloads of the most recent requests captured in
+// debug mode, so a reported answer can be replayed.
+type PayloadLog struct {
+	mu       sync.RWMutex
+	size     int
+	order    []string
+	requests map[string]CapturedRequest
+}
+
+func NewPayloadLog(size int) *PayloadLog {
+	if size <= 0 {
+		size = DefaultPayloadLogSize
+	}
+	return &PayloadLog{
+		size:     size,
+		order:    make([]string, 0, size),
+		requests: make(map[string]CapturedRequest, size),
+	}
+}
+
+func (l *PayloadLog) Record(request CapturedRequest) {
+	if request.CreatedAt.IsZero() {
+		request.CreatedAt = time.Now().UTC()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.requests[request.Serial]; !ok {
+		if len(l.order) >= l.size {
+			delete(l.requests, l.order[0])
+			l.order = l.order[1:]
+		}
+		l.order = append(l.order, request.Serial)
+	}
+	l.requests[request.Serial] = request
+}
+
+func (l *PayloadLog) Get(serial string) (CapturedRequest, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	request, ok := l.requests[serial]
+	if !ok {
+		return CapturedRequest{}, ErrPayloadsNotFound
+	}
+	return request, nil
+}
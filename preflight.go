@@ -0,0 +1,283 @@
+package orus
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Dsouza10082/orus/ollama"
+)
+
+// Preflight modes, set with ORUS_API_PREFLIGHT.
+const (
+	// PreflightStrict refuses to start when a check fails.
+	PreflightStrict = "strict"
+	// PreflightWarn reports failed checks and starts in a degraded mode.
+	PreflightWarn = "warn"
+	// PreflightOff skips the checks.
+	PreflightOff = "off"
+)
+
+const preflightOllamaTimeout = 5 * time.Second
+
+// PreflightCheck is the outcome of one startup check.
+type PreflightCheck struct {
+	Name   string
+	Target string
+	Detail string
+	Err    error
+	// Hint tells how to fix a failed check.
+	Hint string
+}
+
+type PreflightReport struct {
+	Checks []PreflightCheck
+}
+
+// Failed returns the failed checks.
+func (r *PreflightReport) Failed() []PreflightCheck {
+	failed := make([]PreflightCheck, 0)
+	for _, check := range r.Checks {
+		if check.Err != nil {
+			failed = append(failed, check)
+		}
+	}
+	return failed
+}
+
+func (r *PreflightReport) String() string {
+	var b strings.Builder
+	b.WriteString("Preflight report:\n")
+	for _, check := range r.Checks {
+		status, detail := "ok  ", check.Detail
+		if check.Err != nil {
+			status, detail = "FAIL", check.Err.Error()
+		}
+		fmt.Fprintf(&b, "  [%s] %-18s %s", status, check.Name, check.Target)
+		if detail != "" {
+			fmt.Fprintf(&b, " (%s)", detail)
+		}
+		b.WriteString("\n")
+		if check.Err != nil && check.Hint != "" {
+			fmt.Fprintf(&b, "         -> %s\n", check.Hint)
+		}
+	}
+	return b.String()
+}
+
+// RunPreflight checks that the files the server needs are readable, that its
+// directories are writable and that Ollama answers.
+func RunPreflight(config Config) *PreflightReport {
+	report := &PreflightReport{}
+	add := func(check PreflightCheck) {
+		report.Checks = append(report.Checks, check)
+	}
+
+	embedder := config.Embedder
+	add(checkReadableFile("onnx_path", embedder.OnnxPath,
+		"set ORUS_API_ONNX_PATH to the BGE-M3 model.onnx"))
+	add(checkReadableFile("tok_path", embedder.TokPath,
+		"set ORUS_API_TOK_PATH to the BGE-M3 tokenizer.json"))
+	add(checkReadableFile("onnx_runtime_path", embedder.OnnxRuntimePath,
+		"set ORUS_API_ONNX_RUNTIME_PATH to the libonnxruntime of this platform (e.g. onnx/linux-x64/libonnxruntime.so)"))
+	add(checkWritableDir("memory_path", embedder.MemoryPath,
+		"set ORUS_API_AGENT_MEMORY_PATH to a writable directory"))
+	if config.Server.UISettingsPath != "" {
+		add(checkWritableDir("ui_settings_path", config.Server.UISettingsPath,
+			"set ORUS_API_UI_SETTINGS_PATH to a writable directory, or unset it to keep preferences in memory"))
+	}
+	if config.Screening.Path != "" {
+		add(checkReadableFile("screening_path", config.Screening.Path,
+			"set ORUS_API_SCREENING_PATH to the screening rules file, or unset it to disable screening"))
+	}
+	add(checkOllama(config.Ollama.BaseURL))
+	return report
+}
+
+func checkReadableFile(name string, path string, hint string) PreflightCheck {
+	check := PreflightCheck{Name: name, Target: path, Hint: hint}
+	file, err := os.Open(path)
+	if err != nil {
+		check.Err = err
+		return check
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	switch {
+	case err != nil:
+		check.Err = err
+	case info.IsDir():
+		check.Err = fmt.Errorf("is a directory, expected a file")
+	case info.Size() == 0:
+		check.Err = fmt.Errorf("file is empty")
+	default:
+		check.Detail = fmt.Sprintf("%d bytes", info.Size())
+	}
+	return check
+}
+
+// checkWritableDir creates the directory when it is missing, as the stores
+// would, and checks a file can be written in it.
+func checkWritableDir(name string, dir string, hint string) PreflightCheck {
+	check := PreflightCheck{Name: name, Target: dir, Hint: hint}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		check.Err = err
+		return check
+	}
+	probe, err := os.CreateTemp(dir, ".orus-preflight-*")
+	if err != nil {
+		check.Err = fmt.Errorf("not writable: %w", err)
+		return check
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	if abs, err := filepath.Abs(dir); err == nil && abs != dir {
+		check.Detail = abs
+	}
+	return check
+}
+
+func checkOllama(baseURL string) PreflightCheck {
+	check := PreflightCheck{
+		Name:   "ollama",
+		Target: baseURL,
+		Hint:   "start Ollama or set ORUS_API_OLLAMA_BASE_URL to its address (http://localhost:11434 outside Docker)",
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), preflightOllamaTimeout)
+	defer cancel()
+	client := ollama.NewOllamaClient(baseURL).WithContext(ctx)
+	version, err := client.Version()
+	if err != nil {
+		check.Err = err
+		return check
+	}
+	check.Detail = "version " + version
+	if models, err := client.ListModels(); err == nil {
+		check.Detail += fmt.Sprintf(", %d models", len(models))
+	}
+	return check
+}
+
+const diagnosticGenerationTimeout = 2 * time.Minute
+
+// RunDiagnostics runs the preflight checks and then exercises the stack end
+// to end: it loads the BGE-M3 model with a tiny embedding and asks model for
+// a single token. An empty model uses the first chat model installed in
+// Ollama.
+func RunDiagnostics(config Config, model string) *PreflightReport {
+	report := RunPreflight(config)
+	failed := make(map[string]bool)
+	for _, check := range report.Failed() {
+		failed[check.Name] = true
+	}
+	orus, err := NewOrus(config)
+	report.Checks = append(report.Checks, PreflightCheck{
+		Name:   "features",
+		Target: "orus",
+		Detail: "all loaded",
+		Err:    err,
+		Hint:   "fix or unset the settings of the disabled features",
+	})
+	if orus == nil {
+		return report
+	}
+	if failed["onnx_path"] || failed["tok_path"] || failed["onnx_runtime_path"] {
+		report.Checks = append(report.Checks, skippedCheck("bge_m3_embedding", "bge-m3", "the BGE-M3 files"))
+	} else {
+		report.Checks = append(report.Checks, checkEmbedding(orus))
+	}
+	if failed["ollama"] {
+		target := model
+		if target == "" {
+			target = "first chat model"
+		}
+		report.Checks = append(report.Checks, skippedCheck("generation", target, "ollama"))
+	} else {
+		report.Checks = append(report.Checks, checkGeneration(orus.Backend, model))
+	}
+	return report
+}
+
+// skippedCheck is a failed check that was not run because a check it depends
+// on failed first.
+func skippedCheck(name string, target string, dependency string) PreflightCheck {
+	return PreflightCheck{Name: name, Target: target, Err: fmt.Errorf("skipped, %s failed", dependency)}
+}
+
+// checkEmbedding recovers from a panic, which is how a missing or mismatched
+// ONNX runtime library surfaces.
+func checkEmbedding(orus *Orus) (check PreflightCheck) {
+	check = PreflightCheck{
+		Name:   "bge_m3_embedding",
+		Target: "bge-m3",
+		Hint:   "check ORUS_API_ONNX_RUNTIME_PATH matches this OS and architecture (linux-x64, aarch64, darwin) and that the model and tokenizer are the BGE-M3 ones",
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			check.Err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	startTime := time.Now()
+	vector, err := orus.EmbedWithBGE_M3("orus check")
+	switch {
+	case err != nil:
+		check.Err = err
+	case len(vector) == 0:
+		check.Err = fmt.Errorf("empty embedding")
+	default:
+		check.Detail = fmt.Sprintf("%d dimensions in %s", len(vector), time.Since(startTime).Round(time.Millisecond))
+	}
+	return check
+}
+
+func checkGeneration(client ollama.Backend, model string) PreflightCheck {
+	check := PreflightCheck{
+		Name:   "generation",
+		Target: "first chat model",
+		Hint:   "pull a chat model (orus-api pull llama3.1:8b) or pass its name with -model",
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), diagnosticGenerationTimeout)
+	defer cancel()
+	client = client.WithContext(ctx)
+	if model != "" {
+		check.Target = model
+	} else {
+		details, err := client.ListModelDetails()
+		if err != nil {
+			check.Err = err
+			return check
+		}
+		for _, info := range details {
+			if !isEmbeddingModel(info) {
+				model = info.Name
+				break
+			}
+		}
+		if model == "" {
+			check.Err = fmt.Errorf("no chat model installed")
+			return check
+		}
+		check.Target = model
+	}
+	startTime := time.Now()
+	response, err := client.Chat(ollama.ChatRequest{
+		Model:    model,
+		Messages: []ollama.Message{{Role: "user", Content: "Reply with OK."}},
+		Options:  map[string]interface{}{"num_predict": 1},
+	})
+	if err != nil {
+		check.Err = err
+		return check
+	}
+	check.Detail = fmt.Sprintf("%q in %s", response.Message.Content, time.Since(startTime).Round(time.Millisecond))
+	return check
+}
+
+func isEmbeddingModel(model ollama.ModelInfo) bool {
+	name := strings.ToLower(model.Name)
+	return strings.Contains(name, "embed") || strings.Contains(name, "bge") ||
+		strings.HasSuffix(model.Details.Family, "bert")
+}
@@ -0,0 +1,599 @@
+package orus
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Dsouza10082/orus/ollama"
+	"github.com/google/uuid"
+)
+
+const (
+	RAGCollection        = "rag_documents"
+	DefaultRAGEmbedModel = "bge-m3"
+	DefaultChunkSize     = 800
+	DefaultChunkOverlap  = 100
+	DefaultRAGLimit      = 4
+)
+
+const ragSystemPrompt = `Answer the question using only the numbered context passages below.
+Cite the passages you used as [n], with their page and section when they are given. If the context does not contain the answer, say so.`
+
+const ragImagesPrompt = `The images attached to the question are figures of the pages the passages come from, most relevant first.`
+
+// DocumentIndex chunks and embeds documents into a vector store collection
+// and retrieves the chunks closest to a question.
+type DocumentIndex struct {
+	orus       *Orus
+	store      *VectorStore
+	media      *MediaStore
+	Collection string
+
+	// shared is the store the replicas exchange their sources through, nil
+	// when the index is local to the server.
+	shared DocumentStore
+	// syncMu orders the changes of the index with the changes it loads,
+	// up to revision.
+	syncMu   sync.Mutex
+	revision int64
+}
+
+// DocumentStore keeps the chunks of the indexed sources where every replica
+// of the server can load them.
+type DocumentStore interface {
+	// Replace stores documents as the chunks of source, or removes source
+	// when there are none, and returns the revision of the change.
+	Replace(collection, source string, documents []Document) (int64, error)
+	// Changes returns the sources changed after revision, and the revision
+	// of the last change.
+	Changes(collection string, after int64) ([]DocumentChange, int64, error)
+}
+
+// DocumentChange is the new content of a source; a source without documents
+// was removed.
+type DocumentChange struct {
+	Source    string
+	Documents []Document
+}
+
+// DocumentSource summarizes the chunks indexed for one source document.
+type DocumentSource struct {
+	Source string `json:"source" swaggertype:"string" example:"handbook.md"`
+	Model  string `json:"model" swaggertype:"string" example:"bge-m3"`
+	Chunks int    `json:"chunks" swaggertype:"integer" example:"12"`
+	Images int    `json:"images,omitempty" swaggertype:"integer" example:"3"`
+}
+
+func NewDocumentIndex(orus *Orus, store *VectorStore, collection string) *DocumentIndex {
+	return &DocumentIndex{
+		orus:       orus,
+		store:      store,
+		Collection: collection,
+	}
+}
+
+// SetMedia keeps the images of the indexed documents in media.
+func (i *DocumentIndex) SetMedia(media *MediaStore) *DocumentIndex {
+	i.media = media
+	return i
+}
+
+// SetStore shares the sources of the index with the replicas using store.
+// The media directory has to be shared as well for them to see the images.
+func (i *DocumentIndex) SetStore(store DocumentStore) *DocumentIndex {
+	i.shared = store
+	return i
+}
+
+// Sync loads the sources the other replicas changed since the last sync.
+func (i *DocumentIndex) Sync() error {
+	if i.shared == nil {
+		return nil
+	}
+	i.syncMu.Lock()
+	defer i.syncMu.Unlock()
+	changes, revision, err := i.shared.Changes(i.Collection, i.revision)
+	if err != nil {
+		return fmt.Errorf("error loading document changes: %w", err)
+	}
+	for _, change := range changes {
+		source := change.Source
+		// the media are left to the replica that made the change, which may
+		// have stored them again for the new chunks
+		i.store.DeleteWhere(i.Collection, func(document Document) bool {
+			return document.Metadata["source"] == source
+		})
+		if len(change.Documents) > 0 {
+			i.store.Add(i.Collection, change.Documents...)
+		}
+	}
+	i.revision = revision
+	return nil
+}
+
+// SyncEvery runs Sync every interval, until the process exits. It returns
+// at once when interval is not positive.
+func (i *DocumentIndex) SyncEvery(interval time.Duration) {
+	if i.shared == nil || interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := i.Sync(); err != nil {
+			log.Printf("Error syncing documents: %v", err)
+		}
+	}
+}
+
+// replace swaps the chunks of source for documents, and shares them with
+// the other replicas.
+func (i *DocumentIndex) replace(source string, documents []Document) ([]Document, error) {
+	i.syncMu.Lock()
+	defer i.syncMu.Unlock()
+	i.removeWhere(func(document Document) bool {
+		return document.Metadata["source"] == source
+	})
+	added := i.store.Add(i.Collection, documents...)
+	if err := i.share(source, added); err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+// share stores the change of source in the shared store. The revision of
+// the index follows it when no other replica changed a source in between,
+// so the change is not loaded back.
+func (i *DocumentIndex) share(source string, documents []Document) error {
+	if i.shared == nil {
+		return nil
+	}
+	revision, err := i.shared.Replace(i.Collection, source, documents)
+	if err != nil {
+		return fmt.Errorf("error sharing the documents of %s: %w", source, err)
+	}
+	if revision == i.revision+1 {
+		i.revision = revision
+	}
+	return nil
+}
+
+// IngestProgress reports how far a stage of an ingestion went, in items:
+// the images of a document, its chunks or the frames of a video.
+type IngestProgress struct {
+	Stage     string `json:"stage"`
+	Completed int64  `json:"completed"`
+	Total     int64  `json:"total"`
+	// ETA is how long the stage should still take, at its rate so far.
+	ETA time.Duration `json:"eta"`
+}
+
+// ingestReporter reports the progress of the stages of an ingestion to
+// progress, which may be nil, timing each stage from its first report.
+func ingestReporter(progress func(IngestProgress)) func(stage string, completed, total int) {
+	var current string
+	var start time.Time
+	return func(stage string, completed, total int) {
+		if progress == nil {
+			return
+		}
+		if stage != current {
+			current, start = stage, time.Now()
+		}
+		report := IngestProgress{Stage: stage, Completed: int64(completed), Total: int64(total)}
+		if completed > 0 && completed < total {
+			report.ETA = time.Since(start) / time.Duration(completed) * time.Duration(total-completed)
+		}
+		progress(report)
+	}
+}
+
+// Index replaces the chunks of source with the chunks of text embedded with model.
+func (i *DocumentIndex) Index(source, text, model string, size, overlap int) ([]Document, error) {
+	return i.indexText(source, text, model, size, overlap, ingestReporter(nil))
+}
+
+func (i *DocumentIndex) indexText(source, text, model string, size, overlap int, report func(stage string, completed, total int)) ([]Document, error) {
+	chunks := ChunkText(text, size, overlap)
+	documents := make([]Document, 0, len(chunks))
+	report("embedding", 0, len(chunks))
+	for n, chunk := range chunks {
+		vector, err := i.orus.Embed(model, chunk)
+		if err != nil {
+			return nil, err
+		}
+		report("embedding", n+1, len(chunks))
+		documents = append(documents, Document{
+			Content:   chunk,
+			Embedding: vector,
+			Metadata: map[string]interface{}{
+				"source": source,
+				"chunk":  n,
+				"model":  model,
+			},
+		})
+	}
+	return i.replace(source, documents)
+}
+
+// IndexExtraction replaces the chunks of source with the chunks of an
+// extraction embedded with model. A PDF is chunked along its layout, with
+// the page, heading and section of every chunk in its metadata. The images
+// are kept in the media store and linked to the chunks of their page. An
+// image is also indexed as a record of its own, linked to those chunks,
+// when it can be embedded: by the image encoder when model is clip, or by
+// the caption of captionModel. progress, when not nil, sees the images and
+// then the chunks as they are embedded.
+func (i *DocumentIndex) IndexExtraction(ctx context.Context, source string, extraction *Extraction, model, captionModel string, size, overlap int, progress func(IngestProgress)) ([]Document, error) {
+	report := ingestReporter(progress)
+	paged := extraction.ContentType == "application/pdf"
+	if !paged && (len(extraction.Images) == 0 || i.media == nil) {
+		return i.indexText(source, extraction.Text, model, size, overlap, report)
+	}
+
+	pageMedia := make(map[int][]MediaRef)
+	records := make([]Document, 0)
+	if i.media != nil {
+		report("images", 0, len(extraction.Images))
+	}
+	for n, extracted := range extraction.Images {
+		if i.media == nil {
+			break
+		}
+		ref, err := i.media.Put(extracted.Data)
+		if err != nil {
+			return nil, err
+		}
+		ref.Page = extracted.Page
+		if captionModel != "" {
+			if ref.Caption, err = i.orus.CaptionImage(ctx, captionModel, extracted.Data); err != nil {
+				return nil, err
+			}
+		}
+		var vector []float64
+		switch {
+		case model == ClipModel:
+			embedding, err := i.orus.Clip.EmbedImage(extracted.Data)
+			if err != nil {
+				return nil, err
+			}
+			vector = Float64s(embedding)
+		case ref.Caption != "":
+			if vector, err = i.orus.Embed(model, ref.Caption); err != nil {
+				return nil, err
+			}
+		}
+		if vector != nil {
+			ref.Record = uuid.New().String()
+			records = append(records, Document{
+				ID:        ref.Record,
+				Content:   ref.Caption,
+				Embedding: vector,
+				Metadata: map[string]interface{}{
+					"source": source,
+					"model":  model,
+					"kind":   MediaImage,
+					"page":   ref.Page,
+				},
+				Media: []MediaRef{ref},
+			})
+		}
+		pageMedia[ref.Page] = append(pageMedia[ref.Page], ref)
+		report("images", n+1, len(extraction.Images))
+	}
+
+	var chunks []LayoutChunk
+	if paged {
+		chunks = ChunkLayout(extraction.PageTexts, size, overlap)
+	} else {
+		for n, text := range extraction.PageTexts {
+			for _, chunk := range ChunkText(text, size, overlap) {
+				chunks = append(chunks, LayoutChunk{Text: chunk, Page: n + 1})
+			}
+		}
+	}
+	documents := make([]Document, 0, len(chunks))
+	pageChunks := make(map[int][]string)
+	report("embedding", 0, len(chunks))
+	for _, chunk := range chunks {
+		vector, err := i.orus.Embed(model, chunk.Text)
+		if err != nil {
+			return nil, err
+		}
+		report("embedding", len(documents)+1, len(chunks))
+		id := uuid.New().String()
+		pageChunks[chunk.Page] = append(pageChunks[chunk.Page], id)
+		metadata := map[string]interface{}{
+			"source": source,
+			"chunk":  len(documents),
+			"model":  model,
+			"page":   chunk.Page,
+		}
+		if chunk.Heading != "" {
+			metadata["heading"] = chunk.Heading
+		}
+		if chunk.Section != "" {
+			metadata["section"] = chunk.Section
+		}
+		documents = append(documents, Document{
+			ID:        id,
+			Content:   chunk.Text,
+			Embedding: vector,
+			Metadata:  metadata,
+			Media:     pageMedia[chunk.Page],
+		})
+	}
+	for n := range records {
+		page := records[n].Media[0].Page
+		records[n].Metadata["chunks"] = append(make([]string, 0), pageChunks[page]...)
+	}
+
+	return i.replace(source, append(documents, records...))
+}
+
+// Retrieve returns the limit chunks most similar to query among the chunks
+// embedded with the same model.
+func (i *DocumentIndex) Retrieve(query, model string, limit int) ([]SearchResult, error) {
+	if limit <= 0 {
+		limit = DefaultRAGLimit
+	}
+	vector, err := i.orus.Embed(model, query)
+	if err != nil {
+		return nil, err
+	}
+	return i.store.Search(i.Collection, vector, limit, func(document Document) bool {
+		return document.Metadata["model"] == model
+	}), nil
+}
+
+// Chunks returns the chunks of source in document order, without the
+// records of its images.
+func (i *DocumentIndex) Chunks(source string) []Document {
+	documents := i.store.Documents(i.Collection, func(document Document) bool {
+		return document.Metadata["source"] == source && !IsImageRecord(document)
+	})
+	sort.SliceStable(documents, func(a, b int) bool {
+		return ChunkNumber(documents[a]) < ChunkNumber(documents[b])
+	})
+	return documents
+}
+
+func (i *DocumentIndex) Sources() []DocumentSource {
+	counts := make(map[string]*DocumentSource)
+	for _, document := range i.store.Documents(i.Collection, nil) {
+		source, _ := document.Metadata["source"].(string)
+		entry, ok := counts[source]
+		if !ok {
+			model, _ := document.Metadata["model"].(string)
+			entry = &DocumentSource{Source: source, Model: model}
+			counts[source] = entry
+		}
+		if IsImageRecord(document) {
+			entry.Images++
+		} else {
+			entry.Chunks++
+		}
+	}
+	sources := make([]DocumentSource, 0, len(counts))
+	for _, entry := range counts {
+		sources = append(sources, *entry)
+	}
+	sort.Slice(sources, func(a, b int) bool {
+		return sources[a].Source < sources[b].Source
+	})
+	return sources
+}
+
+func (i *DocumentIndex) Remove(source string) int {
+	i.syncMu.Lock()
+	defer i.syncMu.Unlock()
+	removed := i.removeWhere(func(document Document) bool {
+		return document.Metadata["source"] == source
+	})
+	if err := i.share(source, nil); err != nil {
+		log.Printf("Error removing shared documents: %v", err)
+	}
+	return removed
+}
+
+func (i *DocumentIndex) Clear() int {
+	sources := i.Sources()
+	i.syncMu.Lock()
+	defer i.syncMu.Unlock()
+	removed := i.removeWhere(func(Document) bool {
+		return true
+	})
+	for _, source := range sources {
+		if err := i.share(source.Source, nil); err != nil {
+			log.Printf("Error removing shared documents: %v", err)
+		}
+	}
+	return removed
+}
+
+// Export returns every document of the index, with no source half
+// replaced by a change running meanwhile.
+func (i *DocumentIndex) Export() []Document {
+	i.syncMu.Lock()
+	defer i.syncMu.Unlock()
+	return i.store.Documents(i.Collection, nil)
+}
+
+// Restore replaces the documents of the index with documents, source by
+// source, and removes the sources they do not have. The changes are shared
+// with the other replicas like those of an ingestion.
+func (i *DocumentIndex) Restore(documents []Document) error {
+	bySource := make(map[string][]Document)
+	order := make([]string, 0)
+	for _, document := range documents {
+		source, _ := document.Metadata["source"].(string)
+		if _, ok := bySource[source]; !ok {
+			order = append(order, source)
+		}
+		bySource[source] = append(bySource[source], document)
+	}
+	for _, source := range i.Sources() {
+		if _, ok := bySource[source.Source]; !ok {
+			i.Remove(source.Source)
+		}
+	}
+	for _, source := range order {
+		if _, err := i.replace(source, bySource[source]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeWhere deletes the documents matching filter, and the media only
+// they referenced.
+func (i *DocumentIndex) removeWhere(filter func(Document) bool) int {
+	if i.media == nil {
+		return i.store.DeleteWhere(i.Collection, filter)
+	}
+	orphans := make(map[string]bool)
+	for _, document := range i.store.Documents(i.Collection, filter) {
+		for _, ref := range document.Media {
+			orphans[ref.ID] = true
+		}
+	}
+	removed := i.store.DeleteWhere(i.Collection, filter)
+	if len(orphans) == 0 {
+		return removed
+	}
+	for _, document := range i.store.Documents(i.Collection, nil) {
+		for _, ref := range document.Media {
+			delete(orphans, ref.ID)
+		}
+	}
+	for id := range orphans {
+		if err := i.media.Delete(id); err != nil {
+			log.Printf("Error deleting media %s: %v", id, err)
+		}
+	}
+	return removed
+}
+
+// Images returns up to max images linked to the retrieved documents, most
+// relevant first, as base64 for a vision model.
+func (i *DocumentIndex) Images(results []SearchResult, max int) []string {
+	images := make([]string, 0)
+	if i.media == nil {
+		return images
+	}
+	seen := make(map[string]bool)
+	for _, result := range results {
+		for _, ref := range result.Document.Media {
+			if len(images) >= max {
+				return images
+			}
+			if ref.Type != MediaImage || seen[ref.ID] {
+				continue
+			}
+			seen[ref.ID] = true
+			data, err := i.media.Get(ref.ID)
+			if err != nil {
+				log.Printf("Error reading media %s: %v", ref.ID, err)
+				continue
+			}
+			images = append(images, base64.StdEncoding.EncodeToString(data))
+		}
+	}
+	return images
+}
+
+func IsImageRecord(document Document) bool {
+	return document.Metadata["kind"] == MediaImage
+}
+
+// ChunkNumber reads the chunk position.
+func ChunkNumber(document Document) int {
+	return metadataInt(document, "chunk")
+}
+
+// metadataInt reads a number of the metadata, which is an int when stored
+// in memory and a float64 after a JSON round trip.
+func metadataInt(document Document, key string) int {
+	switch n := document.Metadata[key].(type) {
+	case int:
+		return n
+	case float64:
+		return int(n)
+	}
+	return 0
+}
+
+// ChunkText splits text into chunks of at most size characters, breaking on
+// whitespace and repeating up to overlap characters between consecutive chunks.
+func ChunkText(text string, size, overlap int) []string {
+	if size <= 0 {
+		size = DefaultChunkSize
+	}
+	if overlap < 0 || overlap >= size {
+		overlap = 0
+	}
+	chunks := make([]string, 0)
+	current := make([]string, 0)
+	length := 0
+	for _, word := range strings.Fields(text) {
+		if length > 0 && length+1+len(word) > size {
+			chunks = append(chunks, strings.Join(current, " "))
+			kept := 0
+			start := len(current)
+			for start > 0 && kept+len(current[start-1])+1 <= overlap {
+				start--
+				kept += len(current[start]) + 1
+			}
+			current = append(current[:0:0], current[start:]...)
+			length = kept - 1
+			if length < 0 {
+				length = 0
+			}
+		}
+		if length > 0 {
+			length++
+		}
+		current = append(current, word)
+		length += len(word)
+	}
+	if len(current) > 0 {
+		chunks = append(chunks, strings.Join(current, " "))
+	}
+	return chunks
+}
+
+// RAGMessages builds the chat messages answering question from the
+// retrieved chunks, and the images of their pages for a vision model.
+func RAGMessages(question string, results []SearchResult, images []string) []ollama.Message {
+	sb := &strings.Builder{}
+	sb.WriteString(ragSystemPrompt)
+	if len(images) > 0 {
+		sb.WriteString("\n")
+		sb.WriteString(ragImagesPrompt)
+	}
+	sb.WriteString("\n\nContext:\n")
+	for n, result := range results {
+		switch citation := Citation(result.Document); {
+		case IsImageRecord(result.Document):
+			fmt.Fprintf(sb, "[%d] (figure of %s) %s\n\n", n+1, citation, result.Document.Content)
+		case citation != "":
+			fmt.Fprintf(sb, "[%d] (%s) %s\n\n", n+1, citation, result.Document.Content)
+		default:
+			fmt.Fprintf(sb, "[%d] %s\n\n", n+1, result.Document.Content)
+		}
+	}
+	user := ollama.Message{Role: "user", Content: question}
+	if len(images) > 0 {
+		user.Images = images
+	}
+	return []ollama.Message{
+		{Role: "system", Content: sb.String()},
+		user,
+	}
+}
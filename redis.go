@@ -0,0 +1,310 @@
+package orus
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultRedisPrefix  = "orus:"
+	DefaultRedisTimeout = 2 * time.Second
+	redisMaxIdle        = 8
+)
+
+// RedisConfig shares the hot state of the replicas of a server through
+// Redis: the response and embedding caches, the idempotency keys and the
+// rate limit counters. Without a URL that state is kept by each replica.
+type RedisConfig struct {
+	// URL is redis://[user:password@]host:port[/db], or rediss:// for TLS.
+	URL Secret `yaml:"url"`
+	// Prefix starts every key, so several deployments can share a database.
+	Prefix string `yaml:"prefix"`
+	// Timeout bounds the connection and every command.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// RedisClient runs commands on a Redis server over a small pool of
+// connections. It speaks the RESP protocol itself, so the server needs no
+// client library.
+type RedisClient struct {
+	address  string
+	username string
+	password string
+	db       int
+	tls      *tls.Config
+	prefix   string
+	timeout  time.Duration
+	idle     chan *redisConn
+}
+
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewRedisClient returns nil when config has no URL. The server is pinged,
+// so an unreachable one fails at startup rather than on the first request.
+func NewRedisClient(config RedisConfig) (*RedisClient, error) {
+	if config.URL == "" {
+		return nil, nil
+	}
+	parsed, err := url.Parse(config.URL.Reveal())
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %w", err)
+	}
+	c := &RedisClient{
+		address: parsed.Host,
+		prefix:  config.Prefix,
+		timeout: config.Timeout,
+		idle:    make(chan *redisConn, redisMaxIdle),
+	}
+	switch parsed.Scheme {
+	case "redis":
+	case "rediss":
+		c.tls = &tls.Config{ServerName: parsed.Hostname()}
+	default:
+		return nil, fmt.Errorf("invalid redis url scheme %q, expected redis or rediss", parsed.Scheme)
+	}
+	if parsed.Port() == "" {
+		c.address = net.JoinHostPort(parsed.Hostname(), "6379")
+	}
+	if parsed.User != nil {
+		c.username = parsed.User.Username()
+		c.password, _ = parsed.User.Password()
+	}
+	if db := strings.Trim(parsed.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid redis database %q", db)
+		}
+	}
+	if c.timeout <= 0 {
+		c.timeout = DefaultRedisTimeout
+	}
+	if _, err := c.Do("PING"); err != nil {
+		return nil, fmt.Errorf("error connecting to redis: %w", err)
+	}
+	return c, nil
+}
+
+// Key prefixes the parts of a key, joined with colons.
+func (c *RedisClient) Key(parts ...string) string {
+	return c.prefix + strings.Join(parts, ":")
+}
+
+// Do runs a command and returns its reply: a string, an int64, a []interface{}
+// or nil. An error reply is returned as an error.
+func (c *RedisClient) Do(args ...string) (interface{}, error) {
+	conn, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := conn.do(c.timeout, args...)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		// the connection may be left in the middle of a reply
+		conn.conn.Close()
+		return nil, err
+	}
+	c.put(conn)
+	return reply, err
+}
+
+// Get returns the value of key, and false when it does not exist.
+func (c *RedisClient) Get(key string) ([]byte, bool, error) {
+	reply, err := c.Do("GET", key)
+	if err != nil {
+		return nil, false, err
+	}
+	if reply == nil {
+		return nil, false, nil
+	}
+	value, _ := reply.(string)
+	return []byte(value), true, nil
+}
+
+// Set stores value at key, expiring after ttl when it is positive.
+func (c *RedisClient) Set(key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, err := c.Do(args...)
+	return err
+}
+
+// SetNX stores value at key unless it exists, and reports whether it did.
+func (c *RedisClient) SetNX(key string, value []byte, ttl time.Duration) (bool, error) {
+	reply, err := c.Do("SET", key, string(value), "NX", "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return false, err
+	}
+	return reply != nil, nil
+}
+
+func (c *RedisClient) Del(keys ...string) error {
+	_, err := c.Do(append([]string{"DEL"}, keys...)...)
+	return err
+}
+
+// incrWindow increments a counter, setting its expiry when it is created,
+// so the counter of a window goes away with it.
+const incrWindow = `local n = redis.call('INCR', KEYS[1])
+if n == 1 then redis.call('PEXPIRE', KEYS[1], ARGV[1]) end
+return {n, redis.call('PTTL', KEYS[1])}`
+
+// Incr increments the counter key, which expires ttl after its first
+// increment, and returns its value and the time left before it expires.
+func (c *RedisClient) Incr(key string, ttl time.Duration) (int64, time.Duration, error) {
+	reply, err := c.Do("EVAL", incrWindow, "1", key, strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return 0, 0, err
+	}
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return 0, 0, fmt.Errorf("unexpected redis reply %v", reply)
+	}
+	count, _ := values[0].(int64)
+	left, _ := values[1].(int64)
+	if left < 0 {
+		left = ttl.Milliseconds()
+	}
+	return count, time.Duration(left) * time.Millisecond, nil
+}
+
+func (c *RedisClient) Close() error {
+	for {
+		select {
+		case conn := <-c.idle:
+			conn.conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (c *RedisClient) get() (*redisConn, error) {
+	select {
+	case conn := <-c.idle:
+		return conn, nil
+	default:
+	}
+	dialer := &net.Dialer{Timeout: c.timeout}
+	var conn net.Conn
+	var err error
+	if c.tls != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.address, c.tls)
+	} else {
+		conn, err = dialer.Dial("tcp", c.address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rc := &redisConn{conn: conn, reader: bufio.NewReader(conn)}
+	if c.password != "" {
+		args := []string{"AUTH", c.password}
+		if c.username != "" {
+			args = []string{"AUTH", c.username, c.password}
+		}
+		if _, err := rc.do(c.timeout, args...); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("redis authentication failed: %w", err)
+		}
+	}
+	if c.db != 0 {
+		if _, err := rc.do(c.timeout, "SELECT", strconv.Itoa(c.db)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return rc, nil
+}
+
+func (c *RedisClient) put(conn *redisConn) {
+	select {
+	case c.idle <- conn:
+	default:
+		conn.conn.Close()
+	}
+}
+
+// redisError is an error reply of the server.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+func (rc *redisConn) do(timeout time.Duration, args ...string) (interface{}, error) {
+	rc.conn.SetDeadline(time.Now().Add(timeout))
+	var command strings.Builder
+	fmt.Fprintf(&command, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&command, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(rc.conn, command.String()); err != nil {
+		return nil, err
+	}
+	return rc.read()
+}
+
+func (rc *redisConn) read() (interface{}, error) {
+	line, err := rc.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("empty redis reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(rc.reader, data); err != nil {
+			return nil, err
+		}
+		return string(data[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		values := make([]interface{}, count)
+		for n := range values {
+			value, err := rc.read()
+			var replyErr redisError
+			switch {
+			case errors.As(err, &replyErr):
+				// the rest of the array is read, so the connection stays usable
+				values[n] = replyErr
+			case err != nil:
+				return nil, err
+			default:
+				values[n] = value
+			}
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("unexpected redis reply %q", line)
+}
@@ -0,0 +1,213 @@
+package orus
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	remoteFetchTimeout = 5 * time.Second
+	// consulWait is how long a Consul blocking query waits for a change.
+	consulWait         = "5m"
+	RemoteRetryBackoff = 5 * time.Second
+)
+
+// RemoteConfig names a YAML document, laid out like orus.yaml, kept in etcd
+// or Consul so a fleet of servers shares it.
+type RemoteConfig struct {
+	// Backend is "etcd" or "consul"; empty disables the remote source.
+	Backend  string `yaml:"backend"`
+	Endpoint string `yaml:"endpoint"`
+	Key      string `yaml:"key"`
+	Token    Secret `yaml:"token"`
+}
+
+// RemoteSource reads the remote configuration document.
+type RemoteSource interface {
+	// Fetch returns the document and its version. A non-zero after waits
+	// until the version differs from after, or the backend gives up
+	// waiting and returns the same version.
+	Fetch(ctx context.Context, after uint64) ([]byte, uint64, error)
+}
+
+func NewRemoteSource(config RemoteConfig) (RemoteSource, error) {
+	endpoint := strings.TrimSuffix(config.Endpoint, "/")
+	client := &http.Client{}
+	switch config.Backend {
+	case "etcd":
+		return &EtcdSource{endpoint: endpoint, key: config.Key, token: config.Token, client: client}, nil
+	case "consul":
+		return &ConsulSource{endpoint: endpoint, key: strings.TrimPrefix(config.Key, "/"), token: config.Token, client: client}, nil
+	default:
+		return nil, fmt.Errorf("unknown remote config backend %q", config.Backend)
+	}
+}
+
+// fetchRemote returns the current remote document.
+func fetchRemote(config RemoteConfig) ([]byte, error) {
+	source, err := NewRemoteSource(config)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), remoteFetchTimeout)
+	defer cancel()
+	data, _, err := source.Fetch(ctx, 0)
+	return data, err
+}
+
+// ConsulSource reads the document from the Consul KV store, watching it with
+// blocking queries.
+type ConsulSource struct {
+	endpoint string
+	key      string
+	token    Secret
+	client   *http.Client
+}
+
+func (s *ConsulSource) Fetch(ctx context.Context, after uint64) ([]byte, uint64, error) {
+	query := url.Values{"raw": {""}}
+	if after > 0 {
+		query.Set("index", strconv.FormatUint(after, 10))
+		query.Set("wait", consulWait)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("%s/v1/kv/%s?%s", s.endpoint, s.key, query.Encode()), nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error creating request: %w", err)
+	}
+	if s.token != "" {
+		req.Header.Set("X-Consul-Token", s.token.Reveal())
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	index, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		// A missing key is an empty document, so it can be created later
+		return nil, index, nil
+	default:
+		body, _ := io.ReadAll(resp.Body)
+		return nil, 0, fmt.Errorf("error from Consul (status %d): %s", resp.StatusCode, string(body))
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error reading response: %w", err)
+	}
+	return data, index, nil
+}
+
+// EtcdSource reads the document from etcd through its v3 JSON gateway,
+// watching the key for changes.
+type EtcdSource struct {
+	endpoint string
+	key      string
+	token    Secret
+	client   *http.Client
+}
+
+func (s *EtcdSource) Fetch(ctx context.Context, after uint64) ([]byte, uint64, error) {
+	if after > 0 {
+		if err := s.watch(ctx, after); err != nil {
+			return nil, 0, err
+		}
+	}
+	var result struct {
+		Header struct {
+			Revision uint64 `json:"revision,string"`
+		} `json:"header"`
+		Kvs []struct {
+			Value       []byte `json:"value"`
+			ModRevision uint64 `json:"mod_revision,string"`
+		} `json:"kvs"`
+	}
+	resp, err := s.post(ctx, "/v3/kv/range", map[string]interface{}{"key": s.encodedKey()})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, 0, fmt.Errorf("error decoding response: %w", err)
+	}
+	if len(result.Kvs) == 0 {
+		// A missing key is an empty document, so it can be created later
+		return nil, result.Header.Revision, nil
+	}
+	return result.Kvs[0].Value, result.Kvs[0].ModRevision, nil
+}
+
+// watch returns after the key changes past revision.
+func (s *EtcdSource) watch(ctx context.Context, revision uint64) error {
+	resp, err := s.post(ctx, "/v3/watch", map[string]interface{}{
+		"create_request": map[string]interface{}{
+			"key":            s.encodedKey(),
+			"start_revision": strconv.FormatUint(revision+1, 10),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var message struct {
+			Result struct {
+				Events []json.RawMessage `json:"events"`
+			} `json:"result"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := decoder.Decode(&message); err != nil {
+			return fmt.Errorf("error reading watch: %w", err)
+		}
+		if message.Error != nil {
+			return fmt.Errorf("error from etcd: %s", message.Error.Message)
+		}
+		if len(message.Result.Events) > 0 {
+			return nil
+		}
+	}
+}
+
+func (s *EtcdSource) encodedKey() string {
+	return base64.StdEncoding.EncodeToString([]byte(s.key))
+}
+
+func (s *EtcdSource) post(ctx context.Context, path string, body interface{}) (*http.Response, error) {
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("error serializing request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint+path, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", s.token.Reveal())
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making request: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("error from etcd (status %d): %s", resp.StatusCode, string(body))
+	}
+	return resp, nil
+}
@@ -0,0 +1,250 @@
+package orus
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Dsouza10082/orus/ollama"
+)
+
+const DefaultResponseCacheSize = 1000
+
+// CacheStatus tells how the response cache answered a request.
+type CacheStatus string
+
+const (
+	// CacheHit is a reply served from the cache.
+	CacheHit CacheStatus = "hit"
+	// CacheMiss is a deterministic request sent to the model and cached.
+	CacheMiss CacheStatus = "miss"
+	// CacheBypass is a request that is not deterministic, so not cached.
+	CacheBypass CacheStatus = "bypass"
+)
+
+// CacheConfig enables the response cache.
+type CacheConfig struct {
+	// TTL is how long a reply is served from the cache; 0 disables it.
+	TTL        time.Duration `yaml:"ttl"`
+	MaxEntries int           `yaml:"max_entries"`
+}
+
+// ResponseCache keeps the replies to deterministic chat requests, those
+// with temperature 0 or a fixed seed, so repeating one does not run the
+// model again. The least recently used entry is evicted when it is full.
+// With Redis the replies are also shared with the other replicas.
+type ResponseCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+	redis   *RedisClient
+	// cipher encrypts the replies shared through redis; nil keeps them in
+	// plain text.
+	cipher *Cipher
+	// evictions counts the entries removed, when set.
+	evictions *Evictions
+}
+
+type cacheEntry struct {
+	key      string
+	response ollama.ChatResponse
+	expires  time.Time
+}
+
+// NewResponseCache returns nil, a disabled cache, when config.TTL is not
+// positive. The methods of a nil cache are no-ops.
+func NewResponseCache(config CacheConfig) *ResponseCache {
+	if config.TTL <= 0 {
+		return nil
+	}
+	size := config.MaxEntries
+	if size <= 0 {
+		size = DefaultResponseCacheSize
+	}
+	return &ResponseCache{
+		ttl:     config.TTL,
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element, size),
+	}
+}
+
+// SetRedis shares the replies through redis, checked when a reply is not
+// cached locally.
+func (c *ResponseCache) SetRedis(redis *RedisClient) *ResponseCache {
+	if c != nil {
+		c.redis = redis
+	}
+	return c
+}
+
+// SetCipher encrypts the replies shared through redis with cipher.
+func (c *ResponseCache) SetCipher(cipher *Cipher) *ResponseCache {
+	if c != nil {
+		c.cipher = cipher
+	}
+	return c
+}
+
+// SetEvictions counts the entries removed in evictions.
+func (c *ResponseCache) SetEvictions(evictions *Evictions) *ResponseCache {
+	if c != nil {
+		c.evictions = evictions
+	}
+	return c
+}
+
+// Expire removes the expired entries and returns how many.
+func (c *ResponseCache) Expire() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	expired := 0
+	for key, element := range c.entries {
+		if now.After(element.Value.(*cacheEntry).expires) {
+			c.order.Remove(element)
+			delete(c.entries, key)
+			expired++
+		}
+	}
+	c.evictions.Add("response_cache", EvictExpired, expired)
+	return expired
+}
+
+// Chat answers req from the cache when it is deterministic, and otherwise
+// calls chat, caching its reply when req is deterministic. backend keeps
+// the replies of different backends for the same model apart.
+func (c *ResponseCache) Chat(backend string, req ollama.ChatRequest, chat func(ollama.ChatRequest) (*ollama.ChatResponse, error)) (*ollama.ChatResponse, CacheStatus, error) {
+	if c == nil {
+		response, err := chat(req)
+		return response, "", err
+	}
+	if !deterministic(req) {
+		response, err := chat(req)
+		return response, CacheBypass, err
+	}
+	key := cacheKey(backend, req)
+	if response, ok := c.get(key); ok {
+		return &response, CacheHit, nil
+	}
+	if response, ok := c.getShared(key); ok {
+		c.put(key, response)
+		return &response, CacheHit, nil
+	}
+	response, err := chat(req)
+	if err != nil {
+		return nil, CacheMiss, err
+	}
+	c.put(key, *response)
+	c.putShared(key, *response)
+	return response, CacheMiss, nil
+}
+
+// getShared and putShared go through Redis, whose errors only cost a miss.
+func (c *ResponseCache) getShared(key string) (ollama.ChatResponse, bool) {
+	var response ollama.ChatResponse
+	if c.redis == nil {
+		return response, false
+	}
+	data, ok, err := c.redis.Get(c.redis.Key("response", key))
+	if err != nil {
+		log.Printf("Error reading the shared response cache: %v", err)
+		return response, false
+	}
+	if !ok {
+		return response, false
+	}
+	// a reply under a key no longer configured is a miss
+	plain, err := c.cipher.Decrypt(string(data))
+	if err != nil || json.Unmarshal([]byte(plain), &response) != nil {
+		return response, false
+	}
+	return response, true
+}
+
+func (c *ResponseCache) putShared(key string, response ollama.ChatResponse) {
+	if c.redis == nil {
+		return
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		return
+	}
+	if err := c.redis.Set(c.redis.Key("response", key), []byte(c.cipher.Encrypt(string(data))), c.ttl); err != nil {
+		log.Printf("Error writing the shared response cache: %v", err)
+	}
+}
+
+func (c *ResponseCache) get(key string) (ollama.ChatResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return ollama.ChatResponse{}, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		c.evictions.Add("response_cache", EvictExpired, 1)
+		return ollama.ChatResponse{}, false
+	}
+	c.order.MoveToFront(element)
+	return entry.response, true
+}
+
+func (c *ResponseCache) put(key string, response ollama.ChatResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &cacheEntry{key: key, response: response, expires: time.Now().Add(c.ttl)}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+		c.evictions.Add("response_cache", EvictCapacity, 1)
+	}
+}
+
+// deterministic reports whether req asks for temperature 0 or a fixed seed.
+func deterministic(req ollama.ChatRequest) bool {
+	if seed, ok := req.Options["seed"]; ok && seed != nil {
+		return true
+	}
+	switch temperature := req.Options["temperature"].(type) {
+	case float64:
+		return temperature == 0
+	case int:
+		return temperature == 0
+	}
+	return false
+}
+
+// cacheKey hashes everything that shapes the reply.
+func cacheKey(backend string, req ollama.ChatRequest) string {
+	data, _ := json.Marshal(struct {
+		Backend  string                 `json:"backend"`
+		Model    string                 `json:"model"`
+		Messages []ollama.Message       `json:"messages"`
+		Images   []string               `json:"images"`
+		Think    bool                   `json:"think"`
+		Format   ollama.ResponseFormat  `json:"format"`
+		Options  map[string]interface{} `json:"options"`
+	}{backend, req.Model, req.Messages, req.Images, req.Think, req.Format, req.Options})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,375 @@
+package orus
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Dsouza10082/orus/ollama"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrTurnNotFound    = errors.New("turn not found")
+)
+
+// SessionTurn is a single message exchanged inside a session.
+// Turns form a tree through ParentID so a session can hold several
+// alternative continuations; the session HeadID selects the active branch.
+// Assistant turns carry the model, parameters and token counts
+// reported by Ollama for the generation that produced them.
+type SessionTurn struct {
+	ID               string                 `json:"id" swaggertype:"string" example:"123e4567-e89b-12d3-a456-426614174000"`
+	ParentID         string                 `json:"parent_id,omitempty" swaggertype:"string" example:"123e4567-e89b-12d3-a456-426614174000"`
+	Role             string                 `json:"role" swaggertype:"string" example:"assistant"`
+	Content          string                 `json:"content" swaggertype:"string" example:"Hello! How can I help?"`
+	Model            string                 `json:"model,omitempty" swaggertype:"string" example:"llama3.1:8b"`
+	Parameters       map[string]interface{} `json:"parameters,omitempty" swaggertype:"object"`
+	PromptTokens     int                    `json:"prompt_tokens,omitempty" swaggertype:"integer" example:"26"`
+	CompletionTokens int                    `json:"completion_tokens,omitempty" swaggertype:"integer" example:"290"`
+	Duration         time.Duration          `json:"duration,omitempty" swaggertype:"integer" example:"1500"`
+	CreatedAt        time.Time              `json:"created_at" swaggertype:"string" example:"2021-01-01T00:00:00Z"`
+}
+
+const (
+	ProviderOllama      = "ollama"
+	ProviderOllamaCloud = "ollama-cloud"
+)
+
+// SessionSettings are the defaults applied to every chat inside a session,
+// so clients only need to send the user message.
+type SessionSettings struct {
+	Model        string                `json:"model,omitempty" swaggertype:"string" example:"llama3.1:8b"`
+	Provider     string                `json:"provider,omitempty" swaggertype:"string" example:"ollama"`
+	Temperature  *float64              `json:"temperature,omitempty" swaggertype:"number" example:"0.7"`
+	SystemPrompt string                `json:"system_prompt,omitempty" swaggertype:"string" example:"You are a helpful assistant."`
+	Think        bool                  `json:"think,omitempty" swaggertype:"boolean" example:"false"`
+	Format       ollama.ResponseFormat `json:"format,omitempty" swaggertype:"object" example:"json"`
+}
+
+// SessionSettingsUpdate holds optional overrides; nil fields keep the current value.
+type SessionSettingsUpdate struct {
+	Model        *string                `json:"model,omitempty"`
+	Provider     *string                `json:"provider,omitempty"`
+	Temperature  *float64               `json:"temperature,omitempty"`
+	SystemPrompt *string                `json:"system_prompt,omitempty"`
+	Think        *bool                  `json:"think,omitempty"`
+	Format       *ollama.ResponseFormat `json:"format,omitempty"`
+}
+
+// Apply returns the settings overridden by the non-nil fields of update.
+func (s SessionSettings) Apply(update SessionSettingsUpdate) SessionSettings {
+	if update.Model != nil {
+		s.Model = *update.Model
+	}
+	if update.Provider != nil {
+		s.Provider = *update.Provider
+	}
+	if update.Temperature != nil {
+		temperature := *update.Temperature
+		s.Temperature = &temperature
+	}
+	if update.SystemPrompt != nil {
+		s.SystemPrompt = *update.SystemPrompt
+	}
+	if update.Think != nil {
+		s.Think = *update.Think
+	}
+	if update.Format != nil {
+		s.Format = *update.Format
+	}
+	return s
+}
+
+func (s SessionSettings) Validate() *ValidationError {
+	switch s.Provider {
+	case "", ProviderOllama, ProviderOllamaCloud:
+	default:
+		return &ValidationError{Code: "invalid_provider", Field: "provider", Message: "Field 'provider' must be 'ollama' or 'ollama-cloud'"}
+	}
+	if s.Temperature != nil && (*s.Temperature < 0 || *s.Temperature > 2) {
+		return &ValidationError{Code: "invalid_temperature", Field: "temperature", Message: "Field 'temperature' must be between 0 and 2"}
+	}
+	if err := s.Format.Validate(); err != nil {
+		return &ValidationError{Code: "invalid_format", Field: "format", Message: "Field 'format' must be 'json' or a JSON schema object"}
+	}
+	return nil
+}
+
+// Parameters returns the generation parameters recorded on assistant turns.
+func (s SessionSettings) Parameters() map[string]interface{} {
+	parameters := map[string]interface{}{
+		"provider": s.Provider,
+		"think":    s.Think,
+		"format":   s.Format,
+	}
+	if s.Provider == "" {
+		parameters["provider"] = ProviderOllama
+	}
+	if s.Temperature != nil {
+		parameters["temperature"] = *s.Temperature
+	}
+	return parameters
+}
+
+type Session struct {
+	ID        string          `json:"id" swaggertype:"string" example:"123e4567-e89b-12d3-a456-426614174000"`
+	Title     string          `json:"title" swaggertype:"string" example:"Pricing model discussion"`
+	AgentID   string          `json:"agent_id,omitempty" swaggertype:"string" example:"support-bot"`
+	UserID    string          `json:"user_id,omitempty" swaggertype:"string" example:"user-42"`
+	Settings  SessionSettings `json:"settings" swaggertype:"object"`
+	HeadID    string          `json:"head_id,omitempty" swaggertype:"string" example:"123e4567-e89b-12d3-a456-426614174000"`
+	Turns     []SessionTurn   `json:"turns" swaggertype:"array"`
+	CreatedAt time.Time       `json:"created_at" swaggertype:"string" example:"2021-01-01T00:00:00Z"`
+	UpdatedAt time.Time       `json:"updated_at" swaggertype:"string" example:"2021-01-01T00:00:00Z"`
+}
+
+// Turn returns the turn with the given ID.
+func (s *Session) Turn(id string) (*SessionTurn, bool) {
+	for i := range s.Turns {
+		if s.Turns[i].ID == id {
+			return &s.Turns[i], true
+		}
+	}
+	return nil, false
+}
+
+// Path returns the turns from the root of the tree down to turnID.
+func (s *Session) Path(turnID string) []SessionTurn {
+	index := make(map[string]int, len(s.Turns))
+	for i, turn := range s.Turns {
+		index[turn.ID] = i
+	}
+	path := make([]SessionTurn, 0)
+	for id := turnID; id != ""; {
+		i, ok := index[id]
+		if !ok {
+			break
+		}
+		path = append(path, s.Turns[i])
+		id = s.Turns[i].ParentID
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// Branch returns the active branch, from the root down to HeadID.
+func (s *Session) Branch() []SessionTurn {
+	return s.Path(s.HeadID)
+}
+
+// Children returns the turns whose parent is turnID, in creation order.
+func (s *Session) Children(turnID string) []SessionTurn {
+	children := make([]SessionTurn, 0)
+	for _, turn := range s.Turns {
+		if turn.ParentID == turnID {
+			children = append(children, turn)
+		}
+	}
+	return children
+}
+
+// Messages returns the active branch in the format expected by ChatRequest.
+func (s *Session) Messages() []ollama.Message {
+	return TurnMessages(s.Branch())
+}
+
+func TurnMessages(turns []SessionTurn) []ollama.Message {
+	messages := make([]ollama.Message, 0, len(turns))
+	for _, turn := range turns {
+		messages = append(messages, ollama.Message{Role: turn.Role, Content: turn.Content})
+	}
+	return messages
+}
+
+// TokenUsage sums the prompt and completion tokens of the turns of the
+// active branch, the conversation as it stands; the answers replaced by a
+// regeneration and the abandoned branches are not counted.
+func (s *Session) TokenUsage() (promptTokens int, completionTokens int) {
+	for _, turn := range s.Branch() {
+		promptTokens += turn.PromptTokens
+		completionTokens += turn.CompletionTokens
+	}
+	return promptTokens, completionTokens
+}
+
+func (s *Session) clone() *Session {
+	c := *s
+	c.Turns = make([]SessionTurn, len(s.Turns))
+	copy(c.Turns, s.Turns)
+	return &c
+}
+
+// SessionStore persists conversations. Implementations must return copies
+// so callers can read sessions without holding any store lock.
+type SessionStore interface {
+	Create(session Session) (*Session, error)
+	Get(id string) (*Session, error)
+	List() ([]*Session, error)
+	AppendTurns(id string, turns ...SessionTurn) (*Session, error)
+	SetHead(id string, turnID string) (*Session, error)
+	UpdateSettings(id string, settings SessionSettings) (*Session, error)
+	Delete(id string) error
+	// DeleteIdle removes the sessions last updated before before and
+	// returns their IDs.
+	DeleteIdle(before time.Time) ([]string, error)
+	// Import stores session as it is, with its ID, turns and times,
+	// replacing the session of the same ID, as a restore does.
+	Import(session Session) error
+}
+
+type MemorySessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]*Session
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: make(map[string]*Session),
+	}
+}
+
+// Create stores a new session built from the given template.
+// ID, timestamps and turns are always assigned by the store.
+func (m *MemorySessionStore) Create(session Session) (*Session, error) {
+	now := time.Now().UTC()
+	session.ID = uuid.New().String()
+	session.Turns = make([]SessionTurn, 0)
+	session.CreatedAt = now
+	session.UpdatedAt = now
+	m.mu.Lock()
+	m.sessions[session.ID] = &session
+	m.mu.Unlock()
+	return session.clone(), nil
+}
+
+func (m *MemorySessionStore) Get(id string) (*Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	session, ok := m.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	return session.clone(), nil
+}
+
+func (m *MemorySessionStore) List() ([]*Session, error) {
+	m.mu.RLock()
+	sessions := make([]*Session, 0, len(m.sessions))
+	for _, session := range m.sessions {
+		sessions = append(sessions, session.clone())
+	}
+	m.mu.RUnlock()
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].UpdatedAt.After(sessions[j].UpdatedAt)
+	})
+	return sessions, nil
+}
+
+// AppendTurns adds turns as a chain below the current head (or below the
+// ParentID of the first turn when it is set) and moves the head to the last one.
+func (m *MemorySessionStore) AppendTurns(id string, turns ...SessionTurn) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	now := time.Now().UTC()
+	chain, headID, err := chainTurns(session, turns, now)
+	if err != nil {
+		return nil, err
+	}
+	session.Turns = append(session.Turns, chain...)
+	session.HeadID = headID
+	session.UpdatedAt = now
+	return session.clone(), nil
+}
+
+// chainTurns links turns as a chain below the head of session, assigning
+// the missing IDs and times, and returns them with the new head.
+func chainTurns(session *Session, turns []SessionTurn, now time.Time) ([]SessionTurn, string, error) {
+	parentID := session.HeadID
+	chain := make([]SessionTurn, 0, len(turns))
+	for _, turn := range turns {
+		if turn.ID == "" {
+			turn.ID = uuid.New().String()
+		}
+		if turn.ParentID == "" {
+			turn.ParentID = parentID
+		} else if _, ok := session.Turn(turn.ParentID); !ok && turn.ParentID != parentID {
+			return nil, "", ErrTurnNotFound
+		}
+		if turn.CreatedAt.IsZero() {
+			turn.CreatedAt = now
+		}
+		chain = append(chain, turn)
+		parentID = turn.ID
+	}
+	return chain, parentID, nil
+}
+
+// SetHead selects the active branch. An empty turnID starts a new root branch.
+func (m *MemorySessionStore) SetHead(id string, turnID string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	if turnID != "" {
+		if _, ok := session.Turn(turnID); !ok {
+			return nil, ErrTurnNotFound
+		}
+	}
+	session.HeadID = turnID
+	session.UpdatedAt = time.Now().UTC()
+	return session.clone(), nil
+}
+
+func (m *MemorySessionStore) UpdateSettings(id string, settings SessionSettings) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	session.Settings = settings
+	session.UpdatedAt = time.Now().UTC()
+	return session.clone(), nil
+}
+
+func (m *MemorySessionStore) Import(session Session) error {
+	stored := session.clone()
+	m.mu.Lock()
+	m.sessions[session.ID] = stored
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *MemorySessionStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.sessions[id]; !ok {
+		return ErrSessionNotFound
+	}
+	delete(m.sessions, id)
+	return nil
+}
+
+func (m *MemorySessionStore) DeleteIdle(before time.Time) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ids := make([]string, 0)
+	for id, session := range m.sessions {
+		if session.UpdatedAt.Before(before) {
+			delete(m.sessions, id)
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
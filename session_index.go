@@ -0,0 +1,141 @@
+package orus
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+)
+
+const (
+	SessionTurnsCollection    = "session_turns"
+	DefaultSessionEmbedModel  = "bge-m3"
+	DefaultSessionSearchLimit = 10
+)
+
+// SessionIndex embeds conversation turns into the vector store so past
+// exchanges can be found by meaning rather than by exact words.
+type SessionIndex struct {
+	orus       *Orus
+	store      *VectorStore
+	EmbedModel string
+}
+
+type SessionSearchResult struct {
+	SessionID    string      `json:"session_id" swaggertype:"string" example:"123e4567-e89b-12d3-a456-426614174000"`
+	SessionTitle string      `json:"session_title" swaggertype:"string" example:"Pricing model discussion"`
+	Turn         SessionTurn `json:"turn" swaggertype:"object"`
+	Similarity   float64     `json:"similarity" swaggertype:"number" example:"0.87"`
+}
+
+func NewSessionIndex(orus *Orus, store *VectorStore) *SessionIndex {
+	return &SessionIndex{
+		orus:       orus,
+		store:      store,
+		EmbedModel: DefaultSessionEmbedModel,
+	}
+}
+
+func (i *SessionIndex) SetEmbedModel(model string) *SessionIndex {
+	if model != "" {
+		i.EmbedModel = model
+	}
+	return i
+}
+
+// Index embeds the given turns of a session. Turns with empty content are skipped.
+func (i *SessionIndex) Index(session *Session, turns ...SessionTurn) error {
+	for _, turn := range turns {
+		if strings.TrimSpace(turn.Content) == "" {
+			continue
+		}
+		vector, err := i.orus.Embed(i.EmbedModel, turn.Content)
+		if err != nil {
+			return err
+		}
+		i.store.Add(SessionTurnsCollection, Document{
+			ID:        turn.ID,
+			Content:   turn.Content,
+			Embedding: vector,
+			// the turn is kept as plain values, which survive the JSON of
+			// the journal, the checkpoints and the backups
+			Metadata: map[string]interface{}{
+				"session_id":    session.ID,
+				"session_title": session.Title,
+				"parent_id":     turn.ParentID,
+				"role":          turn.Role,
+				"model":         turn.Model,
+			},
+			CreatedAt: turn.CreatedAt,
+		})
+	}
+	return nil
+}
+
+// IndexAsync indexes turns in the background, logging failures.
+func (i *SessionIndex) IndexAsync(session *Session, turns ...SessionTurn) {
+	go func() {
+		if err := i.Index(session, turns...); err != nil {
+			log.Println("Error indexing session turns: ", err)
+		}
+	}()
+}
+
+// Search returns the turns most similar to query, optionally restricted to one session.
+func (i *SessionIndex) Search(query string, limit int, sessionID string) ([]SessionSearchResult, error) {
+	if limit <= 0 {
+		limit = DefaultSessionSearchLimit
+	}
+	vector, err := i.orus.Embed(i.EmbedModel, query)
+	if err != nil {
+		return nil, err
+	}
+	var filter func(Document) bool
+	if sessionID != "" {
+		filter = func(document Document) bool {
+			return document.Metadata["session_id"] == sessionID
+		}
+	}
+	results := i.store.Search(SessionTurnsCollection, vector, limit, filter)
+	matches := make([]SessionSearchResult, 0, len(results))
+	for _, result := range results {
+		sessionID, _ := result.Document.Metadata["session_id"].(string)
+		title, _ := result.Document.Metadata["session_title"].(string)
+		matches = append(matches, SessionSearchResult{
+			SessionID:    sessionID,
+			SessionTitle: title,
+			Turn:         indexedTurn(result.Document),
+			Similarity:   result.Similarity,
+		})
+	}
+	return matches, nil
+}
+
+// indexedTurn rebuilds the turn of an indexed document. The turns indexed
+// before the plain values kept the whole turn under "turn", a SessionTurn
+// in memory and a map once read back from JSON.
+func indexedTurn(document Document) SessionTurn {
+	turn := SessionTurn{
+		ID:        document.ID,
+		Content:   document.Content,
+		CreatedAt: document.CreatedAt,
+	}
+	turn.ParentID, _ = document.Metadata["parent_id"].(string)
+	turn.Role, _ = document.Metadata["role"].(string)
+	turn.Model, _ = document.Metadata["model"].(string)
+	switch legacy := document.Metadata["turn"].(type) {
+	case SessionTurn:
+		return legacy
+	case map[string]interface{}:
+		if data, err := json.Marshal(legacy); err == nil {
+			_ = json.Unmarshal(data, &turn)
+		}
+	}
+	return turn
+}
+
+// Remove drops every indexed turn of a session.
+func (i *SessionIndex) Remove(sessionID string) int {
+	return i.store.DeleteWhere(SessionTurnsCollection, func(document Document) bool {
+		return document.Metadata["session_id"] == sessionID
+	})
+}
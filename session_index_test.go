@@ -0,0 +1,91 @@
+package orus
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Dsouza10082/orus/orustest"
+)
+
+func testOrus(t *testing.T) *Orus {
+	t.Helper()
+	dir := t.TempDir()
+	config := DefaultConfig()
+	config.Embedder.MemoryPath = filepath.Join(dir, "agent_memory")
+	config.Usage.Dir = filepath.Join(dir, "usage")
+	config.RAG.MediaDir = filepath.Join(dir, "media")
+	// the ONNX embedder and the other optional features fail to load here
+	o, err := NewOrusWithBackend(config, orustest.NewBackend())
+	if o == nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+func TestSessionIndexSearchAfterRecovery(t *testing.T) {
+	o := testOrus(t)
+	dir := t.TempDir()
+	journaled := func() *VectorStore {
+		journal, err := OpenVectorJournal(dir, []string{SessionTurnsCollection}, 100, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return NewVectorStore().SetJournal(journal)
+	}
+	session := &Session{ID: "s1", Title: "Pricing"}
+	turn := SessionTurn{
+		ID:        "t2",
+		ParentID:  "t1",
+		Role:      "assistant",
+		Content:   "the pricing model is per seat",
+		Model:     "llama3.1:8b",
+		CreatedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	index := NewSessionIndex(o, journaled()).SetEmbedModel("nomic-embed-text:latest")
+	if err := index.Index(session, turn); err != nil {
+		t.Fatal(err)
+	}
+
+	// the turns are read back from the JSON of the journal, as after a restart
+	store := journaled()
+	if _, err := store.Recover(); err != nil {
+		t.Fatal(err)
+	}
+	for name, index := range map[string]*SessionIndex{
+		"indexed":   index,
+		"recovered": NewSessionIndex(o, store).SetEmbedModel("nomic-embed-text:latest"),
+	} {
+		results, err := index.Search("pricing model", 5, "s1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 {
+			t.Fatalf("%s: found %d turns, want 1", name, len(results))
+		}
+		got := results[0]
+		if got.SessionID != "s1" || got.SessionTitle != "Pricing" {
+			t.Fatalf("%s: found the session %q %q", name, got.SessionID, got.SessionTitle)
+		}
+		if got.Turn.ID != turn.ID || got.Turn.ParentID != turn.ParentID || got.Turn.Role != turn.Role ||
+			got.Turn.Content != turn.Content || got.Turn.Model != turn.Model || !got.Turn.CreatedAt.Equal(turn.CreatedAt) {
+			t.Fatalf("%s: found the turn %+v, want %+v", name, got.Turn, turn)
+		}
+	}
+}
+
+func TestIndexedTurnLegacy(t *testing.T) {
+	// a turn indexed whole, read back from JSON
+	document := Document{
+		ID:      "t1",
+		Content: "hello",
+		Metadata: map[string]interface{}{
+			"session_id": "s1",
+			"turn":       map[string]interface{}{"id": "t1", "role": "user", "content": "hello", "prompt_tokens": float64(12)},
+		},
+	}
+	turn := indexedTurn(document)
+	if turn.ID != "t1" || turn.Role != "user" || turn.Content != "hello" || turn.PromptTokens != 12 {
+		t.Fatalf("read %+v", turn)
+	}
+}
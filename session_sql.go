@@ -0,0 +1,334 @@
+package orus
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SQLSessionStore keeps the sessions in the sessions and session_turns
+// tables of a SQLStore, a row per turn in the order they were appended.
+type SQLSessionStore struct {
+	store *SQLStore
+}
+
+// sqlQuerier is a database or a transaction.
+type sqlQuerier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+const sessionColumns = `id, title, agent_id, user_id, settings, head_id, created_at, updated_at`
+
+const turnColumns = `session_id, id, parent_id, role, content, model, parameters, prompt_tokens, completion_tokens, duration, created_at`
+
+// Create stores a new session built from the given template.
+// ID, timestamps and turns are always assigned by the store.
+func (s *SQLSessionStore) Create(session Session) (*Session, error) {
+	now := time.Now().UTC()
+	session.ID = uuid.New().String()
+	session.Turns = make([]SessionTurn, 0)
+	session.CreatedAt = now
+	session.UpdatedAt = now
+	settings, err := json.Marshal(session.Settings)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding session settings: %w", err)
+	}
+	_, err = s.store.db.Exec(s.store.bind(`INSERT INTO sessions (`+sessionColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`),
+		session.ID, s.store.cipher.Encrypt(session.Title), session.AgentID, session.UserID, string(settings), session.HeadID, session.CreatedAt, session.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (s *SQLSessionStore) Get(id string) (*Session, error) {
+	return s.get(s.store.db, id, "")
+}
+
+// get reads the session id; lock is appended to the query of the session
+// row, so a transaction can hold the row while it changes the session.
+func (s *SQLSessionStore) get(q sqlQuerier, id string, lock string) (*Session, error) {
+	session, err := scanSession(s.store.cipher, q.QueryRow(s.store.bind(`SELECT `+sessionColumns+` FROM sessions WHERE id = ?`+lock), id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	rows, err := q.Query(s.store.bind(`SELECT `+turnColumns+` FROM session_turns WHERE session_id = ? ORDER BY seq`), id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		_, turn, err := scanTurn(s.store.cipher, rows)
+		if err != nil {
+			return nil, err
+		}
+		session.Turns = append(session.Turns, turn)
+	}
+	return session, rows.Err()
+}
+
+func (s *SQLSessionStore) List() ([]*Session, error) {
+	rows, err := s.store.db.Query(`SELECT ` + sessionColumns + ` FROM sessions ORDER BY updated_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]*Session, 0)
+	byID := make(map[string]*Session)
+	for rows.Next() {
+		session, err := scanSession(s.store.cipher, rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		sessions = append(sessions, session)
+		byID[session.ID] = session
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	turns, err := s.store.db.Query(`SELECT ` + turnColumns + ` FROM session_turns ORDER BY session_id, seq`)
+	if err != nil {
+		return nil, err
+	}
+	defer turns.Close()
+	for turns.Next() {
+		sessionID, turn, err := scanTurn(s.store.cipher, turns)
+		if err != nil {
+			return nil, err
+		}
+		if session, ok := byID[sessionID]; ok {
+			session.Turns = append(session.Turns, turn)
+		}
+	}
+	return sessions, turns.Err()
+}
+
+// AppendTurns adds turns as a chain below the current head (or below the
+// ParentID of the first turn when it is set) and moves the head to the last one.
+func (s *SQLSessionStore) AppendTurns(id string, turns ...SessionTurn) (*Session, error) {
+	tx, err := s.store.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	session, err := s.get(tx, id, s.store.forUpdate())
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	chain, headID, err := chainTurns(session, turns, now)
+	if err != nil {
+		return nil, err
+	}
+	for i, turn := range chain {
+		parameters, err := json.Marshal(turn.Parameters)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding turn parameters: %w", err)
+		}
+		if _, err := tx.Exec(s.store.bind(`INSERT INTO session_turns (seq, `+turnColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+			len(session.Turns)+i, id, turn.ID, turn.ParentID, turn.Role, s.store.cipher.Encrypt(turn.Content), turn.Model, string(parameters),
+			turn.PromptTokens, turn.CompletionTokens, int64(turn.Duration), turn.CreatedAt.UTC()); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.Exec(s.store.bind(`UPDATE sessions SET head_id = ?, updated_at = ? WHERE id = ?`), headID, now, id); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	session.Turns = append(session.Turns, chain...)
+	session.HeadID = headID
+	session.UpdatedAt = now
+	return session, nil
+}
+
+// SetHead selects the active branch. An empty turnID starts a new root branch.
+func (s *SQLSessionStore) SetHead(id string, turnID string) (*Session, error) {
+	return s.update(id, func(tx *sql.Tx, session *Session) error {
+		if turnID != "" {
+			if _, ok := session.Turn(turnID); !ok {
+				return ErrTurnNotFound
+			}
+		}
+		session.HeadID = turnID
+		_, err := tx.Exec(s.store.bind(`UPDATE sessions SET head_id = ?, updated_at = ? WHERE id = ?`), turnID, session.UpdatedAt, id)
+		return err
+	})
+}
+
+func (s *SQLSessionStore) UpdateSettings(id string, settings SessionSettings) (*Session, error) {
+	encoded, err := json.Marshal(settings)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding session settings: %w", err)
+	}
+	return s.update(id, func(tx *sql.Tx, session *Session) error {
+		session.Settings = settings
+		_, err := tx.Exec(s.store.bind(`UPDATE sessions SET settings = ?, updated_at = ? WHERE id = ?`), string(encoded), session.UpdatedAt, id)
+		return err
+	})
+}
+
+// update runs change on the session id in a transaction, with its
+// UpdatedAt already set to now.
+func (s *SQLSessionStore) update(id string, change func(tx *sql.Tx, session *Session) error) (*Session, error) {
+	tx, err := s.store.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	session, err := s.get(tx, id, s.store.forUpdate())
+	if err != nil {
+		return nil, err
+	}
+	session.UpdatedAt = time.Now().UTC()
+	if err := change(tx, session); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (s *SQLSessionStore) Delete(id string) error {
+	tx, err := s.store.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	result, err := tx.Exec(s.store.bind(`DELETE FROM sessions WHERE id = ?`), id)
+	if err != nil {
+		return err
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return ErrSessionNotFound
+	}
+	if _, err := tx.Exec(s.store.bind(`DELETE FROM session_turns WHERE session_id = ?`), id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteIdle removes the idle sessions in a transaction, so a session
+// updated meanwhile is either kept or reported.
+func (s *SQLSessionStore) DeleteIdle(before time.Time) ([]string, error) {
+	tx, err := s.store.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	rows, err := tx.Query(s.store.bind(`SELECT id FROM sessions WHERE updated_at < ?`+s.store.forUpdate()), before.UTC())
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if _, err := tx.Exec(s.store.bind(`DELETE FROM session_turns WHERE session_id = ?`), id); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(s.store.bind(`DELETE FROM sessions WHERE id = ?`), id); err != nil {
+			return nil, err
+		}
+	}
+	return ids, tx.Commit()
+}
+
+func (s *SQLSessionStore) Import(session Session) error {
+	settings, err := json.Marshal(session.Settings)
+	if err != nil {
+		return fmt.Errorf("error encoding session settings: %w", err)
+	}
+	tx, err := s.store.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(s.store.bind(`DELETE FROM session_turns WHERE session_id = ?`), session.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(s.store.bind(`DELETE FROM sessions WHERE id = ?`), session.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(s.store.bind(`INSERT INTO sessions (`+sessionColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`),
+		session.ID, s.store.cipher.Encrypt(session.Title), session.AgentID, session.UserID, string(settings), session.HeadID,
+		session.CreatedAt.UTC(), session.UpdatedAt.UTC()); err != nil {
+		return err
+	}
+	for i, turn := range session.Turns {
+		parameters, err := json.Marshal(turn.Parameters)
+		if err != nil {
+			return fmt.Errorf("error encoding turn parameters: %w", err)
+		}
+		if _, err := tx.Exec(s.store.bind(`INSERT INTO session_turns (seq, `+turnColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+			i, session.ID, turn.ID, turn.ParentID, turn.Role, s.store.cipher.Encrypt(turn.Content), turn.Model, string(parameters),
+			turn.PromptTokens, turn.CompletionTokens, int64(turn.Duration), turn.CreatedAt.UTC()); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+type sqlScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanSession reads a session row, decrypting its title with cipher.
+func scanSession(cipher *Cipher, row sqlScanner) (*Session, error) {
+	session := &Session{Turns: make([]SessionTurn, 0)}
+	var settings string
+	if err := row.Scan(&session.ID, &session.Title, &session.AgentID, &session.UserID, &settings, &session.HeadID,
+		&session.CreatedAt, &session.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(settings), &session.Settings); err != nil {
+		return nil, fmt.Errorf("error decoding session settings: %w", err)
+	}
+	var err error
+	if session.Title, err = cipher.Decrypt(session.Title); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// scanTurn reads a turn row, decrypting its content with cipher.
+func scanTurn(cipher *Cipher, row sqlScanner) (string, SessionTurn, error) {
+	var sessionID, parameters string
+	var turn SessionTurn
+	var duration int64
+	if err := row.Scan(&sessionID, &turn.ID, &turn.ParentID, &turn.Role, &turn.Content, &turn.Model, &parameters,
+		&turn.PromptTokens, &turn.CompletionTokens, &duration, &turn.CreatedAt); err != nil {
+		return "", turn, err
+	}
+	if err := json.Unmarshal([]byte(parameters), &turn.Parameters); err != nil {
+		return "", turn, fmt.Errorf("error decoding turn parameters: %w", err)
+	}
+	turn.Duration = time.Duration(duration)
+	var err error
+	if turn.Content, err = cipher.Decrypt(turn.Content); err != nil {
+		return "", turn, err
+	}
+	return sessionID, turn, nil
+}
@@ -0,0 +1,195 @@
+package orus
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// SimilarityKernelAuto benchmarks the kernels supported by the CPU and uses
+// the fastest.
+const SimilarityKernelAuto = "auto"
+
+// similarityKernel computes the distances of the vector search. Every kernel
+// returns the same results up to the rounding of the summation order.
+type similarityKernel struct {
+	name string
+	// dotNorms returns the dot product of a and b and their squared norms,
+	// in one pass for cosine similarity.
+	dotNorms  func(a, b []float64) (dot, normA, normB float64)
+	squaredL2 func(a, b []float64) float64
+}
+
+// similarityKernels lists the kernels in order of preference; the assembly
+// ones are added by the files of the architectures that have them.
+var similarityKernels = []similarityKernel{
+	{name: "generic", dotNorms: dotNormsGeneric, squaredL2: squaredL2Generic},
+	{name: "unrolled", dotNorms: dotNormsUnrolled, squaredL2: squaredL2Unrolled},
+}
+
+var activeKernel atomic.Pointer[similarityKernel]
+
+func init() {
+	activeKernel.Store(&similarityKernels[0])
+}
+
+// SimilarityKernels returns the names of the kernels supported by the CPU.
+func SimilarityKernels() []string {
+	names := make([]string, len(similarityKernels))
+	for i, kernel := range similarityKernels {
+		names[i] = kernel.name
+	}
+	return names
+}
+
+// UseSimilarityKernel selects the kernel used by the vector search and
+// returns its name. SimilarityKernelAuto, or an empty name, picks the
+// fastest on this CPU.
+func UseSimilarityKernel(name string) (string, error) {
+	if name == "" || name == SimilarityKernelAuto {
+		kernel := fastestKernel()
+		activeKernel.Store(kernel)
+		return kernel.name, nil
+	}
+	for i := range similarityKernels {
+		if similarityKernels[i].name == name {
+			activeKernel.Store(&similarityKernels[i])
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("similarity kernel %q is not supported here, expected one of %s, %s",
+		name, SimilarityKernelAuto, strings.Join(SimilarityKernels(), ", "))
+}
+
+// fastestKernel times every kernel on vectors of the size of the usual
+// embedding models.
+func fastestKernel() *similarityKernel {
+	const dimensions, rounds = 1024, 2000
+	a := make([]float64, dimensions)
+	b := make([]float64, dimensions)
+	for i := range a {
+		a[i] = math.Sin(float64(i))
+		b[i] = math.Cos(float64(i))
+	}
+	type timing struct {
+		kernel  *similarityKernel
+		elapsed time.Duration
+	}
+	timings := make([]timing, len(similarityKernels))
+	var sink float64
+	for i := range similarityKernels {
+		kernel := &similarityKernels[i]
+		start := time.Now()
+		for range rounds {
+			dot, _, _ := kernel.dotNorms(a, b)
+			sink += dot + kernel.squaredL2(a, b)
+		}
+		timings[i] = timing{kernel, time.Since(start)}
+	}
+	_ = sink
+	// The stable sort keeps the order of preference between equal timings
+	sort.SliceStable(timings, func(i, j int) bool {
+		return timings[i].elapsed < timings[j].elapsed
+	})
+	return timings[0].kernel
+}
+
+func CosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	dot, normA, normB := activeKernel.Load().dotNorms(a, b)
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// DotProduct returns 0 for vectors of different dimensions.
+func DotProduct(a, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	dot, _, _ := activeKernel.Load().dotNorms(a, b)
+	return dot
+}
+
+// L2Distance returns +Inf for vectors of different dimensions, so they
+// never rank as near.
+func L2Distance(a, b []float64) float64 {
+	if len(a) != len(b) {
+		return math.Inf(1)
+	}
+	return math.Sqrt(activeKernel.Load().squaredL2(a, b))
+}
+
+func dotNormsGeneric(a, b []float64) (dot, normA, normB float64) {
+	b = b[:len(a)]
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	return dot, normA, normB
+}
+
+func squaredL2Generic(a, b []float64) float64 {
+	b = b[:len(a)]
+	var sum float64
+	for i := range a {
+		d := a[i] - b[i]
+		sum += d * d
+	}
+	return sum
+}
+
+// dotNormsUnrolled keeps four independent sums, so the additions of
+// consecutive elements do not wait on each other.
+func dotNormsUnrolled(a, b []float64) (dot, normA, normB float64) {
+	b = b[:len(a)]
+	var d0, d1, d2, d3, a0, a1, a2, a3, b0, b1, b2, b3 float64
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		x, y := a[i:i+4:i+4], b[i:i+4:i+4]
+		d0 += x[0] * y[0]
+		d1 += x[1] * y[1]
+		d2 += x[2] * y[2]
+		d3 += x[3] * y[3]
+		a0 += x[0] * x[0]
+		a1 += x[1] * x[1]
+		a2 += x[2] * x[2]
+		a3 += x[3] * x[3]
+		b0 += y[0] * y[0]
+		b1 += y[1] * y[1]
+		b2 += y[2] * y[2]
+		b3 += y[3] * y[3]
+	}
+	for ; i < len(a); i++ {
+		d0 += a[i] * b[i]
+		a0 += a[i] * a[i]
+		b0 += b[i] * b[i]
+	}
+	return d0 + d1 + d2 + d3, a0 + a1 + a2 + a3, b0 + b1 + b2 + b3
+}
+
+func squaredL2Unrolled(a, b []float64) float64 {
+	b = b[:len(a)]
+	var s0, s1, s2, s3 float64
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		x, y := a[i:i+4:i+4], b[i:i+4:i+4]
+		e0, e1, e2, e3 := x[0]-y[0], x[1]-y[1], x[2]-y[2], x[3]-y[3]
+		s0 += e0 * e0
+		s1 += e1 * e1
+		s2 += e2 * e2
+		s3 += e3 * e3
+	}
+	for ; i < len(a); i++ {
+		e := a[i] - b[i]
+		s0 += e * e
+	}
+	return s0 + s1 + s2 + s3
+}
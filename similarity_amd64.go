@@ -0,0 +1,46 @@
+//go:build amd64 && !purego
+
+package orus
+
+// The AVX2 kernels are in similarity_amd64.s; build with the purego tag to
+// leave them out.
+
+func init() {
+	if hasAVX2FMA() {
+		similarityKernels = append(similarityKernels, similarityKernel{
+			name:      "avx2",
+			dotNorms:  dotNormsAVX2,
+			squaredL2: squaredL2AVX2,
+		})
+	}
+}
+
+// hasAVX2FMA reports whether the CPU has AVX2 and FMA and the OS saves the
+// YMM registers.
+func hasAVX2FMA() bool {
+	maxLeaf, _, _, _ := cpuid(0, 0)
+	if maxLeaf < 7 {
+		return false
+	}
+	_, _, ecx1, _ := cpuid(1, 0)
+	const fma, osxsave, avx = 1 << 12, 1 << 27, 1 << 28
+	if ecx1&(fma|osxsave|avx) != fma|osxsave|avx {
+		return false
+	}
+	if xcr0, _ := xgetbv(); xcr0&6 != 6 {
+		return false
+	}
+	_, ebx7, _, _ := cpuid(7, 0)
+	const avx2 = 1 << 5
+	return ebx7&avx2 != 0
+}
+
+func cpuid(leaf, subleaf uint32) (eax, ebx, ecx, edx uint32)
+
+func xgetbv() (eax, edx uint32)
+
+//go:noescape
+func dotNormsAVX2(a, b []float64) (dot, normA, normB float64)
+
+//go:noescape
+func squaredL2AVX2(a, b []float64) float64
@@ -0,0 +1,118 @@
+//go:build amd64 && !purego
+
+#include "textflag.h"
+
+// func cpuid(leaf, subleaf uint32) (eax, ebx, ecx, edx uint32)
+TEXT ·cpuid(SB), NOSPLIT, $0-24
+	MOVL leaf+0(FP), AX
+	MOVL subleaf+4(FP), CX
+	CPUID
+	MOVL AX, eax+8(FP)
+	MOVL BX, ebx+12(FP)
+	MOVL CX, ecx+16(FP)
+	MOVL DX, edx+20(FP)
+	RET
+
+// func xgetbv() (eax, edx uint32)
+TEXT ·xgetbv(SB), NOSPLIT, $0-8
+	MOVL $0, CX
+	XGETBV
+	MOVL AX, eax+0(FP)
+	MOVL DX, edx+4(FP)
+	RET
+
+// func dotNormsAVX2(a, b []float64) (dot, normA, normB float64)
+// b must be at least as long as a.
+TEXT ·dotNormsAVX2(SB), NOSPLIT, $0-72
+	MOVQ a_base+0(FP), SI
+	MOVQ a_len+8(FP), CX
+	MOVQ b_base+24(FP), DI
+	VXORPD Y0, Y0, Y0
+	VXORPD Y1, Y1, Y1
+	VXORPD Y2, Y2, Y2
+	MOVQ CX, BX
+	SHRQ $2, BX
+	JZ   dotreduce
+
+dotloop:
+	VMOVUPD     (SI), Y3
+	VMOVUPD     (DI), Y4
+	VFMADD231PD Y3, Y4, Y0
+	VFMADD231PD Y3, Y3, Y1
+	VFMADD231PD Y4, Y4, Y2
+	ADDQ        $32, SI
+	ADDQ        $32, DI
+	DECQ        BX
+	JNZ         dotloop
+
+dotreduce:
+	VEXTRACTF128 $1, Y0, X3
+	VADDPD       X3, X0, X0
+	VHADDPD      X0, X0, X0
+	VEXTRACTF128 $1, Y1, X3
+	VADDPD       X3, X1, X1
+	VHADDPD      X1, X1, X1
+	VEXTRACTF128 $1, Y2, X3
+	VADDPD       X3, X2, X2
+	VHADDPD      X2, X2, X2
+	ANDQ         $3, CX
+	JZ           dotdone
+
+dottail:
+	VMOVSD      (SI), X3
+	VMOVSD      (DI), X4
+	VFMADD231SD X3, X4, X0
+	VFMADD231SD X3, X3, X1
+	VFMADD231SD X4, X4, X2
+	ADDQ        $8, SI
+	ADDQ        $8, DI
+	DECQ        CX
+	JNZ         dottail
+
+dotdone:
+	VZEROUPPER
+	MOVSD X0, dot+48(FP)
+	MOVSD X1, normA+56(FP)
+	MOVSD X2, normB+64(FP)
+	RET
+
+// func squaredL2AVX2(a, b []float64) float64
+// b must be at least as long as a.
+TEXT ·squaredL2AVX2(SB), NOSPLIT, $0-56
+	MOVQ a_base+0(FP), SI
+	MOVQ a_len+8(FP), CX
+	MOVQ b_base+24(FP), DI
+	VXORPD Y0, Y0, Y0
+	MOVQ CX, BX
+	SHRQ $2, BX
+	JZ   l2reduce
+
+l2loop:
+	VMOVUPD     (SI), Y3
+	VSUBPD      (DI), Y3, Y3
+	VFMADD231PD Y3, Y3, Y0
+	ADDQ        $32, SI
+	ADDQ        $32, DI
+	DECQ        BX
+	JNZ         l2loop
+
+l2reduce:
+	VEXTRACTF128 $1, Y0, X3
+	VADDPD       X3, X0, X0
+	VHADDPD      X0, X0, X0
+	ANDQ         $3, CX
+	JZ           l2done
+
+l2tail:
+	VMOVSD      (SI), X3
+	VSUBSD      (DI), X3, X3
+	VFMADD231SD X3, X3, X0
+	ADDQ        $8, SI
+	ADDQ        $8, DI
+	DECQ        CX
+	JNZ         l2tail
+
+l2done:
+	VZEROUPPER
+	MOVSD X0, ret+48(FP)
+	RET
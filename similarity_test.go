@@ -0,0 +1,118 @@
+package orus
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func randomVector(rng *rand.Rand, n int) []float64 {
+	v := make([]float64, n)
+	for i := range v {
+		v[i] = rng.NormFloat64()
+	}
+	return v
+}
+
+// closeTo allows for the rounding of another summation order, relative to
+// the sum of the magnitudes of the terms.
+func closeTo(got, want, magnitude float64) bool {
+	return math.Abs(got-want) <= 1e-12*math.Max(magnitude, 1)
+}
+
+func absSum(a, b []float64, term func(x, y float64) float64) float64 {
+	var sum float64
+	for i := range a {
+		sum += math.Abs(term(a[i], b[i]))
+	}
+	return sum
+}
+
+func TestSimilarityKernels(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, kernel := range similarityKernels {
+		t.Run(kernel.name, func(t *testing.T) {
+			for n := 0; n < 70; n++ {
+				// b is longer than a and both start unaligned, as the
+				// kernels only read the first len(a) elements of b
+				a := randomVector(rng, n+1)[1:]
+				b := randomVector(rng, n+5)[1:]
+
+				dot, normA, normB := kernel.dotNorms(a, b)
+				wantDot, wantNormA, wantNormB := dotNormsGeneric(a, b)
+				if !closeTo(dot, wantDot, absSum(a, b, func(x, y float64) float64 { return x * y })) {
+					t.Errorf("n=%d: dot %v, want %v", n, dot, wantDot)
+				}
+				if !closeTo(normA, wantNormA, wantNormA) || !closeTo(normB, wantNormB, wantNormB) {
+					t.Errorf("n=%d: norms %v %v, want %v %v", n, normA, normB, wantNormA, wantNormB)
+				}
+				got, want := kernel.squaredL2(a, b), squaredL2Generic(a, b)
+				if !closeTo(got, want, want) {
+					t.Errorf("n=%d: squared L2 %v, want %v", n, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSimilarityUnequalLengths(t *testing.T) {
+	defer activeKernel.Store(activeKernel.Load())
+	a, b := []float64{1, 2, 3, 4, 5}, []float64{1, 2, 3, 4}
+	for i := range similarityKernels {
+		activeKernel.Store(&similarityKernels[i])
+		if got := CosineSimilarity(a, b); got != 0 {
+			t.Errorf("%s: cosine similarity %v, want 0", similarityKernels[i].name, got)
+		}
+		if got := DotProduct(b, a); got != 0 {
+			t.Errorf("%s: dot product %v, want 0", similarityKernels[i].name, got)
+		}
+		if got := L2Distance(a, b); !math.IsInf(got, 1) {
+			t.Errorf("%s: L2 distance %v, want +Inf", similarityKernels[i].name, got)
+		}
+	}
+}
+
+func TestUseSimilarityKernel(t *testing.T) {
+	defer activeKernel.Store(activeKernel.Load())
+	for _, name := range SimilarityKernels() {
+		if got, err := UseSimilarityKernel(name); err != nil || got != name {
+			t.Fatalf("UseSimilarityKernel(%q) = %q, %v", name, got, err)
+		}
+	}
+	if got, err := UseSimilarityKernel(SimilarityKernelAuto); err != nil || got == "" {
+		t.Fatalf("UseSimilarityKernel(auto) = %q, %v", got, err)
+	}
+	if _, err := UseSimilarityKernel("no-such-kernel"); err == nil {
+		t.Fatal("selected a kernel that does not exist")
+	}
+}
+
+func BenchmarkDotNorms(b *testing.B) {
+	benchmarkKernels(b, func(kernel similarityKernel, x, y []float64) float64 {
+		dot, _, _ := kernel.dotNorms(x, y)
+		return dot
+	})
+}
+
+func BenchmarkSquaredL2(b *testing.B) {
+	benchmarkKernels(b, func(kernel similarityKernel, x, y []float64) float64 {
+		return kernel.squaredL2(x, y)
+	})
+}
+
+func benchmarkKernels(b *testing.B, run func(kernel similarityKernel, x, y []float64) float64) {
+	rng := rand.New(rand.NewSource(1))
+	for _, dimensions := range []int{384, 768, 1024} {
+		x, y := randomVector(rng, dimensions), randomVector(rng, dimensions)
+		for _, kernel := range similarityKernels {
+			b.Run(kernel.name+"/"+strconv.Itoa(dimensions), func(b *testing.B) {
+				var sink float64
+				for range b.N {
+					sink += run(kernel, x, y)
+				}
+				_ = sink
+			})
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package orus
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Dsouza10082/orus/ollama"
+)
+
+const (
+	// DefaultSlowLatency is the duration from which a request is slow.
+	DefaultSlowLatency = 10 * time.Second
+	// DefaultSlowLogSize is the number of slow requests kept.
+	DefaultSlowLogSize    = 200
+	DefaultSlowQueryLimit = 50
+)
+
+// The phases of a request timed for the slow log. They add up the calls of
+// the phase, so a request calling models concurrently can spend more time
+// generating than it ran.
+const (
+	PhaseQueue      = "queue"
+	PhaseEmbedding  = "embedding"
+	PhaseGeneration = "generation"
+)
+
+type SlowLogConfig struct {
+	// Latency is the duration from which a request is slow; 0 disables it.
+	Latency time.Duration `yaml:"latency"`
+	// Tokens is the number of prompt and completion tokens from which a
+	// request is slow; 0 disables it.
+	Tokens int `yaml:"tokens"`
+	// Size is the number of slow requests kept, the oldest dropped first.
+	Size int `yaml:"size"`
+}
+
+// SlowRequest is a request over a threshold of the slow log, with what it
+// asked for and where its time went.
+type SlowRequest struct {
+	Time      time.Time `json:"time" swaggertype:"string" example:"2021-01-01T00:00:00Z"`
+	RequestID string    `json:"request_id,omitempty" swaggertype:"string"`
+	Method    string    `json:"method" swaggertype:"string" example:"POST"`
+	// Route is the route pattern, such as /orus-api/v1/sessions/{id}/chat.
+	Route  string `json:"route" swaggertype:"string" example:"/orus-api/v1/call-llm"`
+	Caller string `json:"caller" swaggertype:"string" example:"key:3f2a9c1b7d4e"`
+	Status int    `json:"status" swaggertype:"integer" example:"200"`
+	// Models are the models the request called, in order.
+	Models []string `json:"models,omitempty" swaggertype:"array" example:"llama3.1:8b"`
+	// PromptChars is the size of the prompts sent to the models.
+	PromptChars      int           `json:"prompt_chars" swaggertype:"integer" example:"5120"`
+	PromptTokens     int           `json:"prompt_tokens" swaggertype:"integer" example:"1280"`
+	CompletionTokens int           `json:"completion_tokens" swaggertype:"integer" example:"900"`
+	Duration         time.Duration `json:"duration" swaggertype:"integer" example:"15000000000"`
+	// Phases are the durations of the queue, embedding and generation
+	// phases the request went through.
+	Phases map[string]time.Duration `json:"phases" swaggertype:"object"`
+	// Reasons are the thresholds exceeded: "latency" or "tokens".
+	Reasons []string `json:"reasons" swaggertype:"array" example:"latency"`
+}
+
+// SlowLog keeps the most recent slow requests in memory, for triage.
+type SlowLog struct {
+	config  atomic.Pointer[SlowLogConfig]
+	mu      sync.Mutex
+	entries []SlowRequest
+	next    int
+	full    bool
+}
+
+func NewSlowLog(config SlowLogConfig) *SlowLog {
+	l := &SlowLog{}
+	l.SetConfig(config)
+	return l
+}
+
+// SetConfig replaces the thresholds and the size, keeping the most recent
+// requests that fit.
+func (l *SlowLog) SetConfig(config SlowLogConfig) {
+	if config.Size <= 0 {
+		config.Size = DefaultSlowLogSize
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.entries == nil || len(l.entries) != config.Size {
+		recent := l.recent(config.Size)
+		l.entries = make([]SlowRequest, config.Size)
+		l.next, l.full = 0, false
+		for i := len(recent) - 1; i >= 0; i-- {
+			l.add(recent[i])
+		}
+	}
+	l.config.Store(&config)
+}
+
+func (l *SlowLog) Config() SlowLogConfig {
+	return *l.config.Load()
+}
+
+// Record keeps request when it exceeds a threshold, and reports whether it
+// did.
+func (l *SlowLog) Record(request SlowRequest) bool {
+	config := l.Config()
+	request.Reasons = request.Reasons[:0]
+	if config.Latency > 0 && request.Duration >= config.Latency {
+		request.Reasons = append(request.Reasons, "latency")
+	}
+	if config.Tokens > 0 && request.PromptTokens+request.CompletionTokens >= config.Tokens {
+		request.Reasons = append(request.Reasons, "tokens")
+	}
+	if len(request.Reasons) == 0 {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.add(request)
+	return true
+}
+
+func (l *SlowLog) add(request SlowRequest) {
+	l.entries[l.next] = request
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Recent returns at most limit slow requests, newest first.
+func (l *SlowLog) Recent(limit int) []SlowRequest {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.recent(limit)
+}
+
+func (l *SlowLog) recent(limit int) []SlowRequest {
+	count := l.next
+	if l.full {
+		count = len(l.entries)
+	}
+	if limit < count {
+		count = limit
+	}
+	recent := make([]SlowRequest, 0, count)
+	for i := 1; i <= count; i++ {
+		recent = append(recent, l.entries[(l.next-i+len(l.entries))%len(l.entries)])
+	}
+	return recent
+}
+
+// requestTimings gathers the phases, models and tokens of a request while
+// its model calls run, possibly concurrently.
+type requestTimings struct {
+	mu               sync.Mutex
+	phases           map[string]time.Duration
+	models           []string
+	promptChars      int
+	promptTokens     int
+	completionTokens int
+}
+
+type timingsContextKey struct{}
+
+func timingsFrom(ctx context.Context) *requestTimings {
+	timings, _ := ctx.Value(timingsContextKey{}).(*requestTimings)
+	return timings
+}
+
+// AddPhase adds the time since start to phase of the request of ctx, when
+// the slow log times it.
+func AddPhase(ctx context.Context, phase string, start time.Time) {
+	timings := timingsFrom(ctx)
+	if timings == nil {
+		return
+	}
+	elapsed := time.Since(start)
+	timings.mu.Lock()
+	defer timings.mu.Unlock()
+	timings.phases[phase] += elapsed
+}
+
+// addModelCall adds a call of model with a prompt of promptChars to the
+// request of ctx.
+func addModelCall(ctx context.Context, model string, promptChars, promptTokens, completionTokens int) {
+	timings := timingsFrom(ctx)
+	if timings == nil {
+		return
+	}
+	timings.mu.Lock()
+	defer timings.mu.Unlock()
+	if !slices.Contains(timings.models, model) {
+		timings.models = append(timings.models, model)
+	}
+	timings.promptChars += promptChars
+	timings.promptTokens += promptTokens
+	timings.completionTokens += completionTokens
+}
+
+// slowLogHooks adds every chat and embedding to the request of their
+// context.
+func slowLogHooks(hooks *Hooks) {
+	hooks.OnAfterChat(func(ctx context.Context, req ollama.ChatRequest, resp *ollama.ChatResponse, err error) {
+		promptChars := 0
+		for _, message := range req.Messages {
+			promptChars += len(message.Content)
+		}
+		if resp == nil {
+			addModelCall(ctx, req.Model, promptChars, 0, 0)
+			return
+		}
+		addModelCall(ctx, req.Model, promptChars, resp.PromptEvalCount, resp.EvalCount)
+	})
+	hooks.OnEmbed(func(ctx context.Context, model string, texts []string, vectors [][]float64, err error) {
+		promptChars := 0
+		for _, text := range texts {
+			promptChars += len(text)
+		}
+		addModelCall(ctx, model, promptChars, 0, 0)
+	})
+}
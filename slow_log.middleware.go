@@ -0,0 +1,45 @@
+package orus
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Middleware times the requests of the routes it wraps and records those
+// over a threshold. It must run before the admission, so the time queued
+// counts.
+func (l *SlowLog) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		timings := &requestTimings{phases: make(map[string]time.Duration)}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), timingsContextKey{}, timings)))
+
+		route := r.URL.Path
+		if routeContext := chi.RouteContext(r.Context()); routeContext != nil && routeContext.RoutePattern() != "" {
+			route = routeContext.RoutePattern()
+		}
+		timings.mu.Lock()
+		defer timings.mu.Unlock()
+		l.Record(SlowRequest{
+			Time:             start.UTC(),
+			RequestID:        middleware.GetReqID(r.Context()),
+			Method:           r.Method,
+			Route:            route,
+			Caller:           usageCaller(r),
+			Status:           ww.Status(),
+			Models:           timings.models,
+			PromptChars:      timings.promptChars,
+			PromptTokens:     timings.promptTokens,
+			CompletionTokens: timings.completionTokens,
+			Duration:         time.Since(start),
+			Phases:           maps.Clone(timings.phases),
+		})
+	})
+}
@@ -0,0 +1,90 @@
+package orus
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrSnapshotsDisabled is returned when the snapshot store cannot be opened.
+var ErrSnapshotsDisabled = errors.New("snapshots are disabled, the snapshot store could not be opened")
+
+// Snapshot is a copy of a vector collection kept in the snapshot store, in
+// the JSON format of VectorStore.Save, so it can be loaded with
+// VectorStore.Load.
+type Snapshot struct {
+	// Name is the key of the snapshot: the collection and the time it was
+	// taken.
+	Name       string    `json:"name" swaggertype:"string" example:"rag_documents/20250102T100000Z.json"`
+	Collection string    `json:"collection" swaggertype:"string" example:"rag_documents"`
+	Documents  int       `json:"documents,omitempty" swaggertype:"integer" example:"1200"`
+	Size       int64     `json:"size" swaggertype:"integer" example:"5242880"`
+	CreatedAt  time.Time `json:"created_at" swaggertype:"string" example:"2025-01-02T10:00:00Z"`
+}
+
+// SnapshotCollection writes the documents of collection, embeddings
+// included, to the snapshot store.
+func (s *Orus) SnapshotCollection(collection string) (Snapshot, error) {
+	if s.Snapshots == nil {
+		return Snapshot{}, ErrSnapshotsDisabled
+	}
+	if !slices.Contains(s.VectorStore.Collections(), collection) {
+		return Snapshot{}, fmt.Errorf("%w: %s", ErrCollectionNotFound, collection)
+	}
+	documents := s.VectorStore.Documents(collection, nil)
+	data, err := json.Marshal(documents)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("error encoding snapshot: %w", err)
+	}
+	now := time.Now().UTC()
+	snapshot := Snapshot{
+		Name:       collection + "/" + now.Format("20060102T150405Z") + ".json",
+		Collection: collection,
+		Documents:  len(documents),
+		Size:       int64(len(data)),
+		CreatedAt:  now,
+	}
+	if err := s.Snapshots.Put(snapshot.Name, data, "application/json"); err != nil {
+		return Snapshot{}, fmt.Errorf("error storing snapshot: %w", err)
+	}
+	return snapshot, nil
+}
+
+// ListSnapshots returns the snapshots of collection, or of every collection
+// when it is empty, oldest first.
+func (s *Orus) ListSnapshots(collection string) ([]Snapshot, error) {
+	if s.Snapshots == nil {
+		return nil, ErrSnapshotsDisabled
+	}
+	prefix := ""
+	if collection != "" {
+		prefix = collection + "/"
+	}
+	blobs, err := s.Snapshots.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	snapshots := make([]Snapshot, 0, len(blobs))
+	for _, blob := range blobs {
+		name, ok := strings.CutSuffix(blob.Key, ".json")
+		if !ok {
+			continue
+		}
+		collection, taken, ok := strings.Cut(name, "/")
+		if !ok {
+			continue
+		}
+		createdAt, err := time.Parse("20060102T150405Z", taken)
+		if err != nil {
+			createdAt = blob.Modified
+		}
+		snapshots = append(snapshots, Snapshot{Name: blob.Key, Collection: collection, Size: blob.Size, CreatedAt: createdAt})
+	}
+	slices.SortFunc(snapshots, func(a, b Snapshot) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return snapshots, nil
+}
@@ -0,0 +1,114 @@
+//go:build storage_badger
+
+package orus
+
+// Registers BadgerDB for ORUS_API_STORAGE_DRIVER=badger.
+// Build with: go get github.com/dgraph-io/badger/v4 && go build -tags storage_badger
+import (
+	"errors"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+func init() {
+	kvEngines["badger"] = openBadger
+}
+
+// badgerEngine keeps the store in the Badger directory of the DSN.
+type badgerEngine struct {
+	db *badger.DB
+}
+
+func openBadger(path string) (kvEngine, error) {
+	db, err := badger.Open(badger.DefaultOptions(path).WithLogger(nil))
+	if err != nil {
+		return nil, err
+	}
+	return &badgerEngine{db: db}, nil
+}
+
+func (e *badgerEngine) View(do func(tx kvReader) error) error {
+	return e.db.View(func(txn *badger.Txn) error {
+		return do(badgerTx{txn: txn})
+	})
+}
+
+func (e *badgerEngine) Update(do func(tx kvWriter) error) error {
+	return e.db.Update(func(txn *badger.Txn) error {
+		return do(badgerTx{txn: txn})
+	})
+}
+
+// Size is refreshed by Badger every minute, so the size limit may be passed
+// by the writes of that minute.
+func (e *badgerEngine) Size() (int64, error) {
+	lsm, vlog := e.db.Size()
+	return lsm + vlog, nil
+}
+
+// Compact rewrites the value log files that are mostly stale, until none is
+// left.
+func (e *badgerEngine) Compact() error {
+	for {
+		err := e.db.RunValueLogGC(0.5)
+		if errors.Is(err, badger.ErrNoRewrite) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (e *badgerEngine) Close() error {
+	return e.db.Close()
+}
+
+type badgerTx struct {
+	txn *badger.Txn
+}
+
+func (t badgerTx) Get(key []byte) ([]byte, bool, error) {
+	item, err := t.txn.Get(key)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	value, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (t badgerTx) Scan(prefix, start []byte, each func(key, value []byte) error) error {
+	options := badger.DefaultIteratorOptions
+	options.Prefix = prefix
+	iterator := t.txn.NewIterator(options)
+	defer iterator.Close()
+	seek := prefix
+	if start != nil {
+		seek = start
+	}
+	for iterator.Seek(seek); iterator.ValidForPrefix(prefix); iterator.Next() {
+		item := iterator.Item()
+		value, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		if err := each(item.KeyCopy(nil), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t badgerTx) Set(key, value []byte) error {
+	return t.txn.Set(key, value)
+}
+
+func (t badgerTx) Delete(key []byte) error {
+	return t.txn.Delete(key)
+}
@@ -0,0 +1,108 @@
+//go:build storage_bolt
+
+package orus
+
+// Registers bbolt for ORUS_API_STORAGE_DRIVER=bolt.
+// Build with: go get go.etcd.io/bbolt && go build -tags storage_bolt
+import (
+	"bytes"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func init() {
+	kvEngines["bolt"] = openBolt
+}
+
+// boltBucket holds every key of the store.
+var boltBucket = []byte("orus")
+
+// boltEngine keeps the store in the Bolt file of the DSN.
+type boltEngine struct {
+	db *bolt.DB
+}
+
+func openBolt(path string) (kvEngine, error) {
+	// a second process opening the file waits for the lock, so it fails
+	// instead of hanging
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltEngine{db: db}, nil
+}
+
+func (e *boltEngine) View(do func(tx kvReader) error) error {
+	return e.db.View(func(tx *bolt.Tx) error {
+		return do(boltTx{bucket: tx.Bucket(boltBucket)})
+	})
+}
+
+func (e *boltEngine) Update(do func(tx kvWriter) error) error {
+	return e.db.Update(func(tx *bolt.Tx) error {
+		return do(boltTx{bucket: tx.Bucket(boltBucket)})
+	})
+}
+
+func (e *boltEngine) Size() (int64, error) {
+	var size int64
+	err := e.db.View(func(tx *bolt.Tx) error {
+		size = tx.Size()
+		return nil
+	})
+	return size, err
+}
+
+// Compact has nothing to do: Bolt reuses the pages freed by deletes, though
+// the file does not shrink.
+func (e *boltEngine) Compact() error {
+	return nil
+}
+
+func (e *boltEngine) Close() error {
+	return e.db.Close()
+}
+
+// boltTx copies what it reads, as Bolt's slices are only valid in the
+// transaction.
+type boltTx struct {
+	bucket *bolt.Bucket
+}
+
+func (t boltTx) Get(key []byte) ([]byte, bool, error) {
+	value := t.bucket.Get(key)
+	if value == nil {
+		return nil, false, nil
+	}
+	return bytes.Clone(value), true, nil
+}
+
+func (t boltTx) Scan(prefix, start []byte, each func(key, value []byte) error) error {
+	cursor := t.bucket.Cursor()
+	seek := prefix
+	if start != nil {
+		seek = start
+	}
+	for key, value := cursor.Seek(seek); key != nil && bytes.HasPrefix(key, prefix); key, value = cursor.Next() {
+		if err := each(bytes.Clone(key), bytes.Clone(value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t boltTx) Set(key, value []byte) error {
+	return t.bucket.Put(key, value)
+}
+
+func (t boltTx) Delete(key []byte) error {
+	return t.bucket.Delete(key)
+}
@@ -0,0 +1,7 @@
+//go:build storage_postgres
+
+package orus
+
+// Registers the pgx driver for ORUS_API_STORAGE_DRIVER=postgres.
+// Build with: go get github.com/jackc/pgx/v5 && go build -tags storage_postgres
+import _ "github.com/jackc/pgx/v5/stdlib"
@@ -0,0 +1,695 @@
+package orus
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	StorageMemory     = "memory"
+	DefaultStorageDSN = "orus.db"
+	// DefaultStorageSyncInterval is how often the documents indexed by the
+	// other replicas sharing the storage are loaded.
+	DefaultStorageSyncInterval = 10 * time.Second
+)
+
+// The advisory locks serializing the replicas sharing a Postgres database.
+const (
+	migrationLock int64 = 0x6f727573 + iota
+	documentLock
+)
+
+// sqlStorageDrivers maps the storage drivers to database/sql driver names.
+// The drivers are linked in with the storage_<driver> build tags, so the
+// default binary carries no database dependency.
+var sqlStorageDrivers = map[string]string{
+	"sqlite":   "sqlite",
+	"postgres": "pgx",
+}
+
+type StorageConfig struct {
+	// Driver is "memory", which loses the state on restart, or "sqlite" or
+	// "postgres", which keep the sessions, feedback, usage, documents and
+	// API keys in the database of DSN. Replicas sharing a Postgres database
+	// share that state. "badger" and "bolt" keep the documents and the jobs
+	// of a single server in an embedded key-value database instead.
+	Driver string `yaml:"driver"`
+	// DSN is the data source name of the database, such as the path of the
+	// SQLite file or a Postgres URL, or the Badger directory or Bolt file.
+	DSN Secret `yaml:"dsn"`
+	// SyncInterval is how often the documents indexed by the other replicas
+	// are loaded; 0 loads them at startup only.
+	SyncInterval time.Duration `yaml:"sync_interval"`
+	// MaxSize is the size in megabytes past which a key-value storage
+	// refuses new documents and jobs; 0 is no limit.
+	MaxSize int `yaml:"max_size"`
+	// CompactInterval is how often a key-value storage reclaims the space of
+	// what was removed; 0 never does.
+	CompactInterval time.Duration `yaml:"compact_interval"`
+	// Migrate is how the migrations the schema lacks are run at startup:
+	// "auto" applies them, "dry-run" logs them and "off" leaves them to
+	// `orus-api migrate`. The storage is only opened once they are applied.
+	Migrate string `yaml:"migrate"`
+	// Encryption encrypts the session titles and turns, the generations
+	// of the feedback, the content of the documents and the prompts and
+	// replies of the audit log before they are stored, and the documents,
+	// blobs and shared replies Orus keeps outside the storage.
+	Encryption EncryptionConfig `yaml:"encryption"`
+}
+
+// Enabled reports whether the state is kept in a SQL database.
+func (c StorageConfig) Enabled() bool {
+	return c.Driver != "" && c.Driver != StorageMemory && !IsKVStorage(c.Driver)
+}
+
+// sqlMigration is a step of the schema of a SQLStore, applied by its
+// statements and reverted by its down statements. The migrations applied
+// to a database are recorded in its schema_migrations table by version, so
+// each runs once, in order.
+type sqlMigration struct {
+	version    int
+	name       string
+	statements []string
+	down       []string
+}
+
+var sqlStoreMigrations = []sqlMigration{
+	{1, "sessions", []string{
+		`CREATE TABLE IF NOT EXISTS sessions (
+			id         TEXT PRIMARY KEY,
+			title      TEXT NOT NULL,
+			agent_id   TEXT NOT NULL,
+			user_id    TEXT NOT NULL,
+			settings   TEXT NOT NULL,
+			head_id    TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS session_turns (
+			session_id        TEXT NOT NULL,
+			seq               INTEGER NOT NULL,
+			id                TEXT NOT NULL,
+			parent_id         TEXT NOT NULL,
+			role              TEXT NOT NULL,
+			content           TEXT NOT NULL,
+			model             TEXT NOT NULL,
+			parameters        TEXT NOT NULL,
+			prompt_tokens     INTEGER NOT NULL,
+			completion_tokens INTEGER NOT NULL,
+			duration          BIGINT NOT NULL,
+			created_at        TIMESTAMP NOT NULL,
+			PRIMARY KEY (session_id, seq)
+		)`,
+	}, []string{
+		`DROP TABLE IF EXISTS session_turns`,
+		`DROP TABLE IF EXISTS sessions`,
+	}},
+	{2, "feedback", []string{
+		`CREATE TABLE IF NOT EXISTS feedback (
+			id         TEXT PRIMARY KEY,
+			serial     TEXT NOT NULL,
+			thumbs     TEXT NOT NULL,
+			score      INTEGER,
+			comment    TEXT NOT NULL,
+			generation TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		)`,
+	}, []string{
+		`DROP TABLE IF EXISTS feedback`,
+	}},
+	{3, "usage", []string{
+		`CREATE TABLE IF NOT EXISTS usage_records (
+			time              TIMESTAMP NOT NULL,
+			request_id        TEXT NOT NULL,
+			endpoint          TEXT NOT NULL,
+			caller            TEXT NOT NULL,
+			model             TEXT NOT NULL,
+			status            INTEGER NOT NULL,
+			prompt_tokens     INTEGER NOT NULL,
+			completion_tokens INTEGER NOT NULL,
+			duration          BIGINT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS usage_records_time ON usage_records (time)`,
+	}, []string{
+		`DROP TABLE IF EXISTS usage_records`,
+	}},
+	{4, "audit", []string{
+		auditTableSchema,
+		`CREATE INDEX IF NOT EXISTS audit_log_time ON audit_log (time)`,
+	}, []string{
+		`DROP TABLE IF EXISTS audit_log`,
+	}},
+	// a source removed keeps its row, without chunks, so the replicas
+	// remove it too
+	{5, "documents", []string{
+		`CREATE TABLE IF NOT EXISTS document_sources (
+			collection TEXT NOT NULL,
+			source     TEXT NOT NULL,
+			revision   BIGINT NOT NULL,
+			updated_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (collection, source)
+		)`,
+		`CREATE INDEX IF NOT EXISTS document_sources_revision ON document_sources (collection, revision)`,
+		`CREATE TABLE IF NOT EXISTS document_chunks (
+			collection TEXT NOT NULL,
+			source     TEXT NOT NULL,
+			id         TEXT NOT NULL,
+			content    TEXT NOT NULL,
+			embedding  TEXT NOT NULL,
+			metadata   TEXT NOT NULL,
+			media      TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (collection, id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS document_chunks_source ON document_chunks (collection, source)`,
+	}, []string{
+		`DROP TABLE IF EXISTS document_chunks`,
+		`DROP TABLE IF EXISTS document_sources`,
+	}},
+	{6, "api_keys", []string{
+		`CREATE TABLE IF NOT EXISTS api_keys (
+			id         TEXT PRIMARY KEY,
+			name       TEXT NOT NULL,
+			prefix     TEXT NOT NULL,
+			digest     TEXT NOT NULL UNIQUE,
+			created_at TIMESTAMP NOT NULL
+		)`,
+	}, []string{
+		`DROP TABLE IF EXISTS api_keys`,
+	}},
+	// the janitor looks the idle sessions up by their last update
+	{7, "sessions_updated_at", []string{
+		`CREATE INDEX IF NOT EXISTS sessions_updated_at ON sessions (updated_at)`,
+	}, []string{
+		`DROP INDEX IF EXISTS sessions_updated_at`,
+	}},
+}
+
+// sqlMigrations lists the migrations of a SQLStore.
+func sqlMigrations() []Migration {
+	migrations := make([]Migration, len(sqlStoreMigrations))
+	for i, migration := range sqlStoreMigrations {
+		migrations[i] = Migration{Version: migration.version, Name: migration.name}
+	}
+	return migrations
+}
+
+// SQLStore keeps the sessions, feedback, usage, audit records, documents
+// and API keys of a server in a database, so they survive restarts and are
+// shared by the replicas using the same Postgres database. Its schema is
+// migrated when it is opened, as the Migrate setting allows.
+type SQLStore struct {
+	db      *sql.DB
+	dialect string
+	// cipher encrypts the prompts, replies and documents; nil keeps them in
+	// plain text.
+	cipher *Cipher
+}
+
+func OpenSQLStore(config StorageConfig) (*SQLStore, error) {
+	s, err := openSQLStore(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrateOnOpen(s, config.Migrate); err != nil {
+		s.Close()
+		return nil, err
+	}
+	if s.cipher, err = NewCipher(config.Encryption); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// openSQLStore opens the database of config without migrating it.
+func openSQLStore(config StorageConfig) (*SQLStore, error) {
+	driver, ok := sqlStorageDrivers[config.Driver]
+	if !ok {
+		return nil, fmt.Errorf("unknown storage driver %q, expected memory, sqlite or postgres", config.Driver)
+	}
+	if !driverRegistered(driver) {
+		return nil, fmt.Errorf("storage driver %q is not compiled in, build with -tags storage_%s", config.Driver, config.Driver)
+	}
+	db, err := sql.Open(driver, config.DSN.Reveal())
+	if err != nil {
+		return nil, fmt.Errorf("error opening storage database: %w", err)
+	}
+	if config.Driver == "sqlite" {
+		// SQLite has a single writer: one connection queues the transactions
+		// instead of failing them as busy
+		db.SetMaxOpenConns(1)
+	}
+	return &SQLStore{db: db, dialect: config.Driver}, nil
+}
+
+func (s *SQLStore) bind(query string) string {
+	return bindPlaceholders(s.dialect, query)
+}
+
+// lock serializes the transactions of the replicas sharing a Postgres
+// database on key until tx ends. SQLite has a single writer already.
+func (s *SQLStore) lock(tx *sql.Tx, key int64) error {
+	if s.dialect != "postgres" {
+		return nil
+	}
+	_, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, key)
+	return err
+}
+
+// forUpdate locks the rows a transaction reads until it ends, where the
+// dialect can.
+func (s *SQLStore) forUpdate() string {
+	if s.dialect != "postgres" {
+		return ""
+	}
+	return " FOR UPDATE"
+}
+
+// schemaVersion returns the version of the last migration applied to the
+// database, creating the schema_migrations table of a new one.
+func (s *SQLStore) schemaVersion() (int, error) {
+	if err := s.inLockedTx(migrationLock, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL
+		)`)
+		return err
+	}); err != nil {
+		return 0, fmt.Errorf("error creating schema_migrations table: %w", err)
+	}
+	var current int
+	if err := s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return 0, fmt.Errorf("error reading schema version: %w", err)
+	}
+	return current, nil
+}
+
+func (s *SQLStore) Plan(target int) (MigrationPlan, error) {
+	current, err := s.schemaVersion()
+	if err != nil {
+		return MigrationPlan{}, err
+	}
+	return planMigrations(sqlMigrations(), current, target)
+}
+
+// Migrate applies or reverts the migrations bringing the database to
+// target. Replicas migrating together take turns, each migration checked
+// again under the lock.
+func (s *SQLStore) Migrate(target int) (MigrationPlan, error) {
+	plan, err := s.Plan(target)
+	if err != nil {
+		return plan, err
+	}
+	for _, migration := range sqlStoreMigrations {
+		if migration.version > plan.Current && migration.version <= plan.Target {
+			if err := s.apply(migration); err != nil {
+				return plan, fmt.Errorf("error applying migration %d (%s): %w", migration.version, migration.name, err)
+			}
+		}
+	}
+	for i := len(sqlStoreMigrations) - 1; i >= 0; i-- {
+		migration := sqlStoreMigrations[i]
+		if migration.version <= plan.Current && migration.version > plan.Target {
+			if err := s.revert(migration); err != nil {
+				return plan, fmt.Errorf("error reverting migration %d (%s): %w", migration.version, migration.name, err)
+			}
+		}
+	}
+	return plan, nil
+}
+
+func (s *SQLStore) apply(migration sqlMigration) error {
+	return s.inLockedTx(migrationLock, func(tx *sql.Tx) error {
+		var applied int
+		if err := tx.QueryRow(s.bind(`SELECT COUNT(*) FROM schema_migrations WHERE version = ?`), migration.version).Scan(&applied); err != nil {
+			return err
+		}
+		if applied > 0 {
+			return nil
+		}
+		for _, statement := range migration.statements {
+			if _, err := tx.Exec(statement); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(s.bind(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`),
+			migration.version, migration.name, time.Now().UTC())
+		return err
+	})
+}
+
+func (s *SQLStore) revert(migration sqlMigration) error {
+	return s.inLockedTx(migrationLock, func(tx *sql.Tx) error {
+		var applied int
+		if err := tx.QueryRow(s.bind(`SELECT COUNT(*) FROM schema_migrations WHERE version = ?`), migration.version).Scan(&applied); err != nil {
+			return err
+		}
+		if applied == 0 {
+			return nil
+		}
+		for _, statement := range migration.down {
+			if _, err := tx.Exec(statement); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(s.bind(`DELETE FROM schema_migrations WHERE version = ?`), migration.version)
+		return err
+	})
+}
+
+// inLockedTx runs do in a transaction holding the lock key, committed when
+// do succeeds.
+func (s *SQLStore) inLockedTx(key int64, do func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := s.lock(tx, key); err != nil {
+		return err
+	}
+	if err := do(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) Sessions() *SQLSessionStore {
+	return &SQLSessionStore{store: s}
+}
+
+func (s *SQLStore) Feedback() *SQLFeedbackStore {
+	return &SQLFeedbackStore{store: s}
+}
+
+func (s *SQLStore) Usage() *SQLUsageStore {
+	return &SQLUsageStore{store: s}
+}
+
+func (s *SQLStore) Documents() *SQLDocumentStore {
+	return &SQLDocumentStore{store: s}
+}
+
+func (s *SQLStore) APIKeys() *SQLAPIKeyStore {
+	return &SQLAPIKeyStore{store: s}
+}
+
+// AuditSink returns a sink writing to the audit_log table of the store,
+// which closing leaves open.
+func (s *SQLStore) AuditSink() *SQLAuditSink {
+	return &SQLAuditSink{db: s.db, dialect: s.dialect, shared: true, cipher: s.cipher}
+}
+
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+// encryptedColumn is a column the cipher of a SQLStore encrypts, with the
+// columns of the key of its rows.
+type encryptedColumn struct {
+	table, column string
+	key           []string
+}
+
+var encryptedColumns = []encryptedColumn{
+	{"sessions", "title", []string{"id"}},
+	{"session_turns", "content", []string{"session_id", "seq"}},
+	{"feedback", "generation", []string{"id"}},
+	{"document_chunks", "content", []string{"collection", "id"}},
+	{"audit_log", "messages", []string{"id"}},
+	{"audit_log", "response", []string{"id"}},
+}
+
+// reencryptBatch is how many values a transaction of Reencrypt rewrites.
+const reencryptBatch = 500
+
+// Reencrypt rewrites the values that are not encrypted under the first key,
+// those of a key rotated out or stored before encryption was enabled, and
+// returns how many it rewrote. Once it is done, the keys rotated out can be
+// removed from the configuration.
+func (s *SQLStore) Reencrypt() (int, error) {
+	rewritten := 0
+	for _, column := range encryptedColumns {
+		n, err := s.reencryptColumn(column)
+		rewritten += n
+		if err != nil {
+			return rewritten, fmt.Errorf("error re-encrypting %s.%s: %w", column.table, column.column, err)
+		}
+	}
+	return rewritten, nil
+}
+
+// reencryptColumn rewrites the values of column. A value changed since it
+// was read is left as it is, as it was written under the first key.
+func (s *SQLStore) reencryptColumn(column encryptedColumn) (int, error) {
+	type rewrite struct {
+		key        []interface{}
+		old, value string
+	}
+	rows, err := s.db.Query(`SELECT ` + strings.Join(column.key, ", ") + `, ` + column.column + ` FROM ` + column.table)
+	if err != nil {
+		return 0, err
+	}
+	rewrites := make([]rewrite, 0)
+	for rows.Next() {
+		entry := rewrite{key: make([]interface{}, len(column.key))}
+		dest := make([]interface{}, 0, len(column.key)+1)
+		for i := range entry.key {
+			dest = append(dest, &entry.key[i])
+		}
+		if err := rows.Scan(append(dest, &entry.old)...); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		var changed bool
+		if entry.value, changed, err = s.cipher.reencrypt(entry.old); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if changed {
+			rewrites = append(rewrites, entry)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	update := s.bind(`UPDATE ` + column.table + ` SET ` + column.column + ` = ? WHERE ` +
+		strings.Join(column.key, ` = ? AND `) + ` = ? AND ` + column.column + ` = ?`)
+	rewritten := 0
+	for start := 0; start < len(rewrites); start += reencryptBatch {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return rewritten, err
+		}
+		batch := 0
+		for _, entry := range rewrites[start:min(start+reencryptBatch, len(rewrites))] {
+			args := append(append([]interface{}{entry.value}, entry.key...), entry.old)
+			result, err := tx.Exec(update, args...)
+			if err != nil {
+				tx.Rollback()
+				return rewritten, err
+			}
+			updated, _ := result.RowsAffected()
+			batch += int(updated)
+		}
+		if err := tx.Commit(); err != nil {
+			return rewritten, err
+		}
+		rewritten += batch
+	}
+	return rewritten, nil
+}
+
+// SQLFeedbackStore keeps the feedback in the feedback table of a SQLStore.
+type SQLFeedbackStore struct {
+	store *SQLStore
+}
+
+func (s *SQLFeedbackStore) Add(feedback Feedback) (*Feedback, error) {
+	feedback.ID = uuid.New().String()
+	feedback.CreatedAt = time.Now().UTC()
+	generation, err := json.Marshal(feedback.Generation)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding feedback generation: %w", err)
+	}
+	var score sql.NullInt64
+	if feedback.Score != nil {
+		score = sql.NullInt64{Int64: int64(*feedback.Score), Valid: true}
+	}
+	_, err = s.store.db.Exec(s.store.bind(`INSERT INTO feedback
+		(id, serial, thumbs, score, comment, generation, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`),
+		feedback.ID, feedback.Serial, feedback.Thumbs, score, feedback.Comment, s.store.cipher.Encrypt(string(generation)), feedback.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &feedback, nil
+}
+
+// List returns the feedback oldest first, as it was added.
+func (s *SQLFeedbackStore) List() ([]Feedback, error) {
+	rows, err := s.store.db.Query(`SELECT id, serial, thumbs, score, comment, generation, created_at
+		FROM feedback ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	feedback := make([]Feedback, 0)
+	for rows.Next() {
+		var entry Feedback
+		var score sql.NullInt64
+		var generation string
+		if err := rows.Scan(&entry.ID, &entry.Serial, &entry.Thumbs, &score, &entry.Comment, &generation, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		if score.Valid {
+			value := int(score.Int64)
+			entry.Score = &value
+		}
+		if generation, err = s.store.cipher.Decrypt(generation); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(generation), &entry.Generation); err != nil {
+			return nil, fmt.Errorf("error decoding feedback generation: %w", err)
+		}
+		feedback = append(feedback, entry)
+	}
+	return feedback, rows.Err()
+}
+
+// SQLUsageStore keeps the usage in the usage_records table of a SQLStore.
+type SQLUsageStore struct {
+	store *SQLStore
+}
+
+func (s *SQLUsageStore) Write(records ...UsageRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	tx, err := s.store.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, record := range records {
+		if _, err := tx.Exec(s.store.bind(`INSERT INTO usage_records
+			(time, request_id, endpoint, caller, model, status, prompt_tokens, completion_tokens, duration)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+			record.Time.UTC(), record.RequestID, record.Endpoint, record.Caller, record.Model, record.Status,
+			record.PromptTokens, record.CompletionTokens, int64(record.Duration)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLUsageStore) Query(since, until time.Time) ([]UsageRecord, error) {
+	statement := `SELECT time, request_id, endpoint, caller, model, status, prompt_tokens, completion_tokens, duration
+		FROM usage_records WHERE 1 = 1`
+	args := make([]interface{}, 0, 2)
+	if !since.IsZero() {
+		statement += " AND time >= ?"
+		args = append(args, since.UTC())
+	}
+	if !until.IsZero() {
+		statement += " AND time < ?"
+		args = append(args, until.UTC())
+	}
+	statement += " ORDER BY time"
+	rows, err := s.store.db.Query(s.store.bind(statement), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	records := make([]UsageRecord, 0)
+	for rows.Next() {
+		var record UsageRecord
+		var duration int64
+		if err := rows.Scan(&record.Time, &record.RequestID, &record.Endpoint, &record.Caller, &record.Model, &record.Status,
+			&record.PromptTokens, &record.CompletionTokens, &duration); err != nil {
+			return nil, err
+		}
+		record.Duration = time.Duration(duration)
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func (s *SQLUsageStore) Prune(before time.Time) (int, error) {
+	result, err := s.store.db.Exec(s.store.bind(`DELETE FROM usage_records WHERE time < ?`), before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	pruned, _ := result.RowsAffected()
+	return int(pruned), nil
+}
+
+// SQLAPIKeyStore keeps the API keys in the api_keys table of a SQLStore, so
+// a key created on a replica is accepted by all of them.
+type SQLAPIKeyStore struct {
+	store *SQLStore
+}
+
+func (s *SQLAPIKeyStore) Create(name string) (*APIKey, string, error) {
+	record, key, digest, err := newAPIKey(name)
+	if err != nil {
+		return nil, "", err
+	}
+	_, err = s.store.db.Exec(s.store.bind(`INSERT INTO api_keys (id, name, prefix, digest, created_at) VALUES (?, ?, ?, ?, ?)`),
+		record.ID, record.Name, record.Prefix, digest, record.CreatedAt)
+	if err != nil {
+		return nil, "", err
+	}
+	return &record, key, nil
+}
+
+// List returns the keys oldest first.
+func (s *SQLAPIKeyStore) List() ([]APIKey, error) {
+	rows, err := s.store.db.Query(`SELECT id, name, prefix, created_at FROM api_keys ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := make([]APIKey, 0)
+	for rows.Next() {
+		var key APIKey
+		if err := rows.Scan(&key.ID, &key.Name, &key.Prefix, &key.CreatedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (s *SQLAPIKeyStore) Revoke(id string) error {
+	result, err := s.store.db.Exec(s.store.bind(`DELETE FROM api_keys WHERE id = ?`), id)
+	if err != nil {
+		return err
+	}
+	if revoked, _ := result.RowsAffected(); revoked == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func (s *SQLAPIKeyStore) Lookup(key string) (*APIKey, error) {
+	var record APIKey
+	err := s.store.db.QueryRow(s.store.bind(`SELECT id, name, prefix, created_at FROM api_keys WHERE digest = ?`), apiKeyDigest(key)).
+		Scan(&record.ID, &record.Name, &record.Prefix, &record.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
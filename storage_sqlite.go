@@ -0,0 +1,7 @@
+//go:build storage_sqlite
+
+package orus
+
+// Registers the pure-Go SQLite driver for ORUS_API_STORAGE_DRIVER=sqlite.
+// Build with: go get modernc.org/sqlite && go build -tags storage_sqlite
+import _ "modernc.org/sqlite"
@@ -0,0 +1,52 @@
+package orus
+
+import (
+	"time"
+)
+
+// WriteTimeoutGrace leaves room to write the timeout error after the request
+// context of a route has expired.
+const WriteTimeoutGrace = 5 * time.Second
+
+// TimeoutPolicy is the time budget of each route class. A zero duration
+// leaves the class unbounded.
+type TimeoutPolicy struct {
+	// Read bounds reading the request headers and body.
+	Read time.Duration `yaml:"read"`
+	// Default applies to routes without a more specific class.
+	Default time.Duration `yaml:"default"`
+	// Embed applies to routes that compute embeddings.
+	Embed time.Duration `yaml:"embed"`
+	// Chat applies to routes that wait for a model generation.
+	Chat time.Duration `yaml:"chat"`
+	// Pull applies to model downloads, which can take a long time on slow links.
+	Pull time.Duration `yaml:"pull"`
+	// Stream applies to the SSE routes of the UI. They are exempt from the
+	// write timeout and are only bounded by this deadline, if any.
+	Stream time.Duration `yaml:"stream"`
+	// Keepalive is how long an event stream may stay silent before a
+	// comment is written on it, so proxies do not drop the connection while
+	// a model loads or thinks. 0 disables the comments.
+	Keepalive time.Duration `yaml:"keepalive"`
+}
+
+func DefaultTimeoutPolicy() TimeoutPolicy {
+	return TimeoutPolicy{
+		Read:      60 * time.Second,
+		Default:   30 * time.Second,
+		Embed:     60 * time.Second,
+		Chat:      540 * time.Second,
+		Pull:      60 * time.Minute,
+		Stream:    0,
+		Keepalive: 15 * time.Second,
+	}
+}
+
+// WriteTimeout is the server write timeout. Routes with a longer budget
+// extend their own write deadline and SSE routes clear it.
+func (p TimeoutPolicy) WriteTimeout() time.Duration {
+	if p.Default <= 0 {
+		return 0
+	}
+	return p.Default + WriteTimeoutGrace
+}
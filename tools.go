@@ -0,0 +1,458 @@
+package orus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Dsouza10082/orus/ollama"
+)
+
+const (
+	// DefaultToolRounds is how many times the model may call tools before
+	// it has to answer.
+	DefaultToolRounds = 5
+	// DefaultToolTimeout bounds an HTTP tool call.
+	DefaultToolTimeout = 30 * time.Second
+	// maxToolResultSize caps the result of an HTTP tool sent to the model.
+	maxToolResultSize = 64 * 1024
+)
+
+// ErrToolRounds is returned when the model keeps calling tools after the
+// allowed rounds.
+var ErrToolRounds = errors.New("the model was still calling tools after the allowed rounds")
+
+var toolNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// Tool is a function the model can call. Parameters is the JSON Schema of
+// its arguments, which are validated against it before Run.
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  map[string]interface{}
+	Run         func(ctx context.Context, arguments map[string]interface{}) (string, error)
+
+	// fromFile marks the HTTP tools of the tools file, which Reload replaces.
+	fromFile bool
+}
+
+// HTTPTool is a tool served by an HTTP endpoint: the arguments are POSTed
+// as a JSON object and the response body is the result.
+type HTTPTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters"`
+	URL         string                 `json:"url"`
+	Headers     map[string]string      `json:"headers,omitempty"`
+	// Timeout is a duration such as "10s"; empty is DefaultToolTimeout.
+	Timeout string `json:"timeout,omitempty"`
+}
+
+type ToolsFile struct {
+	Tools []HTTPTool `json:"tools"`
+	// MCPServers are external MCP servers whose tools are added to the
+	// registry, named <server>__<tool>.
+	MCPServers []MCPServerConfig `json:"mcp_servers,omitempty"`
+}
+
+// ToolStep is a tool call of a tool loop, as returned in its trace.
+type ToolStep struct {
+	Round     int                    `json:"round"`
+	Tool      string                 `json:"tool"`
+	Arguments map[string]interface{} `json:"arguments"`
+	Result    string                 `json:"result,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+	TimeTaken string                 `json:"time_taken"`
+}
+
+// ToolRegistry holds the tools the model can call. Go tools are registered
+// with Register; HTTP tools and MCP servers are read from the tools file.
+type ToolRegistry struct {
+	mu    sync.RWMutex
+	tools map[string]*Tool
+	path  string
+	// client calls the HTTP tools.
+	client *http.Client
+	// servers are the connected MCP servers of the tools file.
+	servers []*MCPClient
+}
+
+// NewToolRegistry returns a registry with the built-in tools.
+func NewToolRegistry() *ToolRegistry {
+	return newToolRegistry(builtinTools()...)
+}
+
+func newToolRegistry(tools ...Tool) *ToolRegistry {
+	registry := &ToolRegistry{tools: make(map[string]*Tool), client: &http.Client{}}
+	for _, tool := range tools {
+		if err := registry.Register(tool); err != nil {
+			panic(err)
+		}
+	}
+	return registry
+}
+
+// LoadToolRegistry returns a registry with the built-in tools and the HTTP
+// tools of the file at path, when path is not empty.
+func LoadToolRegistry(path string) (*ToolRegistry, error) {
+	registry := NewToolRegistry()
+	if path == "" {
+		return registry, nil
+	}
+	registry.path = path
+	if err := registry.Reload(); err != nil {
+		return registry, err
+	}
+	return registry, nil
+}
+
+// Register adds tool, replacing a tool of the same name.
+func (r *ToolRegistry) Register(tool Tool) error {
+	if !toolNamePattern.MatchString(tool.Name) {
+		return fmt.Errorf("tool name %q must be 1 to 64 letters, digits, '_' or '-'", tool.Name)
+	}
+	if tool.Run == nil {
+		return fmt.Errorf("tool %q: a Run function is required", tool.Name)
+	}
+	if tool.Parameters == nil {
+		tool.Parameters = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tools[tool.Name] = &tool
+	return nil
+}
+
+func (r *ToolRegistry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tools, name)
+}
+
+// Reload reads the tools file again and swaps in its tools, reconnecting
+// its MCP servers. An MCP server that cannot be reached is logged and left
+// out. On other errors the current tools are kept.
+func (r *ToolRegistry) Reload() error {
+	if r.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return fmt.Errorf("error reading tools file: %w", err)
+	}
+	var file ToolsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("error decoding tools file: %w", err)
+	}
+	tools := make([]Tool, 0, len(file.Tools))
+	for _, httpTool := range file.Tools {
+		tool, err := r.httpTool(httpTool)
+		if err != nil {
+			return err
+		}
+		tools = append(tools, tool)
+	}
+	servers := make([]*MCPClient, 0, len(file.MCPServers))
+	for _, config := range file.MCPServers {
+		server, err := ConnectMCP(context.Background(), config)
+		if err != nil {
+			log.Printf("Skipping MCP server: %v", err)
+			continue
+		}
+		serverTools, err := server.Tools(context.Background())
+		if err != nil {
+			log.Printf("Skipping MCP server: %v", err)
+			_ = server.Close()
+			continue
+		}
+		log.Printf("Connected to MCP server %s with %d tools", config.Name, len(serverTools))
+		servers = append(servers, server)
+		tools = append(tools, serverTools...)
+	}
+
+	r.mu.Lock()
+	for _, tool := range tools {
+		if registered, ok := r.tools[tool.Name]; ok && !registered.fromFile {
+			r.mu.Unlock()
+			closeMCPClients(servers)
+			return fmt.Errorf("tool %q: the name is taken by a Go tool", tool.Name)
+		}
+	}
+	for name, tool := range r.tools {
+		if tool.fromFile {
+			delete(r.tools, name)
+		}
+	}
+	for i := range tools {
+		r.tools[tools[i].Name] = &tools[i]
+	}
+	previous := r.servers
+	r.servers = servers
+	r.mu.Unlock()
+	closeMCPClients(previous)
+	return nil
+}
+
+// Close disconnects the MCP servers of the tools file, stopping those it
+// started.
+func (r *ToolRegistry) Close() {
+	r.mu.Lock()
+	servers := r.servers
+	r.servers = nil
+	for name, tool := range r.tools {
+		if tool.fromFile {
+			delete(r.tools, name)
+		}
+	}
+	r.mu.Unlock()
+	closeMCPClients(servers)
+}
+
+func closeMCPClients(servers []*MCPClient) {
+	for _, server := range servers {
+		if err := server.Close(); err != nil {
+			log.Printf("Error closing MCP server %s: %v", server.config.Name, err)
+		}
+	}
+}
+
+func (r *ToolRegistry) httpTool(config HTTPTool) (Tool, error) {
+	if !toolNamePattern.MatchString(config.Name) {
+		return Tool{}, fmt.Errorf("tool name %q must be 1 to 64 letters, digits, '_' or '-'", config.Name)
+	}
+	if config.URL == "" {
+		return Tool{}, fmt.Errorf("tool %q: a url is required", config.Name)
+	}
+	timeout := DefaultToolTimeout
+	if config.Timeout != "" {
+		parsed, err := time.ParseDuration(config.Timeout)
+		if err != nil || parsed <= 0 {
+			return Tool{}, fmt.Errorf("tool %q: invalid timeout %q", config.Name, config.Timeout)
+		}
+		timeout = parsed
+	}
+	parameters := config.Parameters
+	if parameters == nil {
+		parameters = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	}
+	return Tool{
+		Name:        config.Name,
+		Description: config.Description,
+		Parameters:  parameters,
+		fromFile:    true,
+		Run: func(ctx context.Context, arguments map[string]interface{}) (string, error) {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return r.callHTTPTool(ctx, config, arguments)
+		},
+	}, nil
+}
+
+func (r *ToolRegistry) callHTTPTool(ctx context.Context, config HTTPTool, arguments map[string]interface{}) (string, error) {
+	body, err := json.Marshal(arguments)
+	if err != nil {
+		return "", fmt.Errorf("error encoding arguments: %w", err)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, config.URL, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range config.Headers {
+		request.Header.Set(name, os.ExpandEnv(value))
+	}
+	response, err := r.client.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("error calling tool: %w", err)
+	}
+	defer response.Body.Close()
+	result, err := io.ReadAll(io.LimitReader(response.Body, maxToolResultSize))
+	if err != nil {
+		return "", fmt.Errorf("error reading tool result: %w", err)
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return "", fmt.Errorf("tool answered status %d: %s", response.StatusCode, result)
+	}
+	return string(result), nil
+}
+
+// Subset returns a registry with the named tools of r and the extra tools,
+// for a caller that may only use those. Its tools are not reloaded.
+func (r *ToolRegistry) Subset(names []string, extra ...Tool) (*ToolRegistry, error) {
+	subset := newToolRegistry()
+	subset.client = r.client
+	r.mu.RLock()
+	for _, name := range names {
+		tool, ok := r.tools[name]
+		if !ok {
+			r.mu.RUnlock()
+			return nil, fmt.Errorf("unknown tool %q", name)
+		}
+		subset.tools[name] = tool
+	}
+	r.mu.RUnlock()
+	for _, tool := range extra {
+		if err := subset.Register(tool); err != nil {
+			return nil, err
+		}
+	}
+	return subset, nil
+}
+
+// Names returns the names of the registered tools, sorted.
+func (r *ToolRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.tools))
+	for name := range r.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Definitions describes the named tools to the model; no names describes
+// them all.
+func (r *ToolRegistry) Definitions(names []string) ([]ollama.ToolDefinition, error) {
+	if len(names) == 0 {
+		names = r.Names()
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	definitions := make([]ollama.ToolDefinition, 0, len(names))
+	for _, name := range names {
+		tool, ok := r.tools[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown tool %q", name)
+		}
+		definitions = append(definitions, ollama.ToolDefinition{
+			Type: "function",
+			Function: ollama.ToolFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	return definitions, nil
+}
+
+// Execute runs a tool call. Errors are returned in the step, to be shown to
+// the model, rather than ending the loop.
+func (r *ToolRegistry) Execute(ctx context.Context, call ollama.ToolCall) ToolStep {
+	startTime := time.Now()
+	step := ToolStep{Tool: call.Function.Name, Arguments: call.Function.Arguments}
+	if step.Arguments == nil {
+		step.Arguments = map[string]interface{}{}
+	}
+	r.mu.RLock()
+	tool, ok := r.tools[call.Function.Name]
+	r.mu.RUnlock()
+	switch {
+	case !ok:
+		step.Error = fmt.Sprintf("unknown tool %q", call.Function.Name)
+	default:
+		if err := ollama.ValidateSchema(tool.Parameters, step.Arguments); err != nil {
+			step.Error = fmt.Sprintf("invalid arguments: %v", err)
+			break
+		}
+		result, err := tool.Run(ctx, step.Arguments)
+		if err != nil {
+			step.Error = err.Error()
+		} else {
+			step.Result = result
+		}
+	}
+	step.TimeTaken = time.Since(startTime).String()
+	return step
+}
+
+// RunTools sends req to chat with the tools and runs the tools the model
+// calls, feeding their results back, until the model answers without
+// calling any or maxRounds is exceeded. onCall, when not nil, sees every
+// tool call before it runs, with its round, tool and arguments, and
+// onStep as it completes.
+func (r *ToolRegistry) RunTools(ctx context.Context, req ollama.ChatRequest, chat func(ollama.ChatRequest) (*ollama.ChatResponse, error), maxRounds int, onCall, onStep func(ToolStep)) (*ollama.ChatResponse, []ToolStep, error) {
+	if maxRounds <= 0 {
+		maxRounds = DefaultToolRounds
+	}
+	req.Stream = false
+	req.Messages = append([]ollama.Message(nil), req.Messages...)
+	trace := make([]ToolStep, 0)
+	for round := 1; ; round++ {
+		response, err := chat(req)
+		if err != nil {
+			return nil, trace, err
+		}
+		if len(response.Message.ToolCalls) == 0 {
+			return response, trace, nil
+		}
+		if round > maxRounds {
+			return nil, trace, fmt.Errorf("%w (%d)", ErrToolRounds, maxRounds)
+		}
+		req.Messages = append(req.Messages, ollama.Message{
+			Role:      "assistant",
+			Content:   response.Message.Content,
+			ToolCalls: response.Message.ToolCalls,
+		})
+		for _, call := range response.Message.ToolCalls {
+			if onCall != nil {
+				onCall(ToolStep{Round: round, Tool: call.Function.Name, Arguments: call.Function.Arguments})
+			}
+			step := r.Execute(ctx, call)
+			step.Round = round
+			trace = append(trace, step)
+			if onStep != nil {
+				onStep(step)
+			}
+			content := step.Result
+			if step.Error != "" {
+				content = "Error: " + step.Error
+			}
+			req.Messages = append(req.Messages, ollama.Message{Role: "tool", Content: content, ToolName: step.Tool})
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, trace, err
+		}
+	}
+}
+
+// builtinTools are registered in every registry.
+func builtinTools() []Tool {
+	return []Tool{
+		{
+			Name:        "current_time",
+			Description: "Returns the current date and time in RFC 3339 format, in the given IANA time zone or UTC.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"timezone": map[string]interface{}{
+						"type":        "string",
+						"description": "IANA time zone, e.g. Europe/Lisbon",
+					},
+				},
+			},
+			Run: func(ctx context.Context, arguments map[string]interface{}) (string, error) {
+				location := time.UTC
+				if name, _ := arguments["timezone"].(string); name != "" {
+					loaded, err := time.LoadLocation(name)
+					if err != nil {
+						return "", fmt.Errorf("unknown time zone %q", name)
+					}
+					location = loaded
+				}
+				return time.Now().In(location).Format(time.RFC3339), nil
+			},
+		},
+	}
+}
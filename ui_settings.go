@@ -0,0 +1,122 @@
+package orus
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	UISettingsFileName = "orus_ui_settings.json"
+	ThemeLight         = "light"
+	ThemeDark          = "dark"
+)
+
+// UISettings are the playground preferences of a user, loaded into the
+// initial signals of the views so choices survive reloads.
+type UISettings struct {
+	UserID       string    `json:"user_id" swaggertype:"string" example:"123e4567-e89b-12d3-a456-426614174000"`
+	DefaultModel string    `json:"default_model,omitempty" swaggertype:"string" example:"llama3.1:8b"`
+	Temperature  *float64  `json:"temperature,omitempty" swaggertype:"number" example:"0.7"`
+	Theme        string    `json:"theme,omitempty" swaggertype:"string" example:"dark"`
+	Streaming    *bool     `json:"streaming,omitempty" swaggertype:"boolean" example:"true"`
+	UpdatedAt    time.Time `json:"updated_at" swaggertype:"string" example:"2021-01-01T00:00:00Z"`
+}
+
+// Validate reports the first invalid preference.
+func (s UISettings) Validate() *ValidationError {
+	if s.Temperature != nil && (*s.Temperature < 0 || *s.Temperature > 2) {
+		return &ValidationError{Code: "invalid_temperature", Message: "Field 'temperature' must be between 0 and 2"}
+	}
+	if s.Theme != "" && s.Theme != ThemeLight && s.Theme != ThemeDark {
+		return &ValidationError{Code: "invalid_theme", Message: "Field 'theme' must be 'light' or 'dark'"}
+	}
+	return nil
+}
+
+// IsStreaming reports whether responses should be streamed, which is the default.
+func (s UISettings) IsStreaming() bool {
+	return s.Streaming == nil || *s.Streaming
+}
+
+type UISettingsStore interface {
+	// Get returns the settings of userID, or empty settings when none were saved.
+	Get(userID string) (UISettings, error)
+	Save(settings UISettings) (UISettings, error)
+}
+
+// MemoryUISettingsStore keeps the settings in memory and, when created with
+// a directory, mirrors them to a JSON file inside it.
+type MemoryUISettingsStore struct {
+	mu       sync.RWMutex
+	path     string
+	settings map[string]UISettings
+}
+
+func NewMemoryUISettingsStore(dir string) *MemoryUISettingsStore {
+	store := &MemoryUISettingsStore{
+		settings: make(map[string]UISettings),
+	}
+	if dir != "" {
+		store.path = filepath.Join(dir, UISettingsFileName)
+		if err := store.load(); err != nil {
+			log.Println("Error loading UI settings: ", err)
+		}
+	}
+	return store
+}
+
+func (m *MemoryUISettingsStore) Get(userID string) (UISettings, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	settings, ok := m.settings[userID]
+	if !ok {
+		return UISettings{UserID: userID}, nil
+	}
+	return settings, nil
+}
+
+func (m *MemoryUISettingsStore) Save(settings UISettings) (UISettings, error) {
+	settings.UpdatedAt = time.Now().UTC()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.settings[settings.UserID] = settings
+	if err := m.save(); err != nil {
+		return settings, err
+	}
+	return settings, nil
+}
+
+func (m *MemoryUISettingsStore) load() error {
+	data, err := os.ReadFile(m.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &m.settings)
+}
+
+// save writes the settings file; the caller holds the lock.
+func (m *MemoryUISettingsStore) save() error {
+	if m.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(m.settings)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(m.path), 0o755); err != nil {
+		return err
+	}
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.path)
+}
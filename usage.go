@@ -0,0 +1,435 @@
+package orus
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Dsouza10082/orus/ollama"
+)
+
+const (
+	usageDayLayout     = "2006-01-02"
+	usageFileLayout    = "20060102"
+	usagePruneInterval = time.Hour
+)
+
+// UsageGroups are the dimensions usage can be grouped by.
+var UsageGroups = []string{"model", "key", "day", "endpoint"}
+
+// UsageRecord is the use one request made of a model: who called which
+// endpoint, with which model, how many tokens and how long it took. A
+// request using several models, such as /compare/run, has a record per
+// model.
+type UsageRecord struct {
+	Time             time.Time     `json:"time" swaggertype:"string" example:"2021-01-01T00:00:00Z"`
+	RequestID        string        `json:"request_id,omitempty" swaggertype:"string"`
+	Endpoint         string        `json:"endpoint" swaggertype:"string" example:"/orus-api/v1/call-llm"`
+	Caller           string        `json:"caller" swaggertype:"string" example:"key:3f2a9c1b7d4e"`
+	Model            string        `json:"model,omitempty" swaggertype:"string" example:"llama3.1:8b"`
+	Status           int           `json:"status" swaggertype:"integer" example:"200"`
+	PromptTokens     int           `json:"prompt_tokens" swaggertype:"integer" example:"26"`
+	CompletionTokens int           `json:"completion_tokens" swaggertype:"integer" example:"290"`
+	Duration         time.Duration `json:"duration" swaggertype:"integer" example:"1500000000"`
+}
+
+// UsageStore stores usage records.
+type UsageStore interface {
+	Write(records ...UsageRecord) error
+	// Query returns the records of [since, until), oldest first. Zero
+	// bounds are open.
+	Query(since, until time.Time) ([]UsageRecord, error)
+	// Prune deletes the records older than before and returns how many
+	// records (or, for the file store, files) were deleted.
+	Prune(before time.Time) (int, error)
+}
+
+// UsageLog records the usage of the requests and prunes it according to the
+// retention.
+type UsageLog struct {
+	store     UsageStore
+	retention time.Duration
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// LoadUsageLog keeps the usage in storage when it is not nil, or opens the
+// usage files in config.Dir, or keeps the usage in memory when it is empty.
+func LoadUsageLog(config UsageConfig, storage *SQLStore) (*UsageLog, error) {
+	var store UsageStore = NewMemoryUsageStore()
+	if storage != nil {
+		store = storage.Usage()
+	} else if config.Dir != "" {
+		fileStore, err := NewFileUsageStore(config.Dir)
+		if err != nil {
+			return nil, err
+		}
+		store = fileStore
+	}
+	return NewUsageLog(store, config.Retention), nil
+}
+
+func NewUsageLog(store UsageStore, retention time.Duration) *UsageLog {
+	l := &UsageLog{store: store, retention: retention, done: make(chan struct{})}
+	if retention > 0 {
+		go l.run()
+	}
+	return l
+}
+
+// Record stores records, logging the error of a store that failed, so a
+// request is never failed by its accounting.
+func (l *UsageLog) Record(records ...UsageRecord) {
+	if err := l.store.Write(records...); err != nil {
+		log.Println("Error writing usage records: ", err)
+	}
+}
+
+func (l *UsageLog) Query(since, until time.Time) ([]UsageRecord, error) {
+	return l.store.Query(since, until)
+}
+
+// Close stops the pruning.
+func (l *UsageLog) Close() {
+	l.closeOnce.Do(func() { close(l.done) })
+}
+
+func (l *UsageLog) run() {
+	ticker := time.NewTicker(usagePruneInterval)
+	defer ticker.Stop()
+	for {
+		l.prune()
+		select {
+		case <-ticker.C:
+		case <-l.done:
+			return
+		}
+	}
+}
+
+func (l *UsageLog) prune() {
+	pruned, err := l.store.Prune(time.Now().UTC().Add(-l.retention))
+	if err != nil {
+		log.Println("Error pruning usage records: ", err)
+		return
+	}
+	if pruned > 0 {
+		log.Printf("Pruned %d usage entries older than %s", pruned, l.retention)
+	}
+}
+
+// usageEntry is the usage the middleware gathers for a request while its
+// model calls run, possibly concurrently.
+type usageEntry struct {
+	mu     sync.Mutex
+	models []string
+	usage  map[string]*UsageRecord
+}
+
+func (e *usageEntry) add(model string, promptTokens, completionTokens int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	record, ok := e.usage[model]
+	if !ok {
+		record = &UsageRecord{Model: model}
+		e.usage[model] = record
+		e.models = append(e.models, model)
+	}
+	record.PromptTokens += promptTokens
+	record.CompletionTokens += completionTokens
+}
+
+type usageContextKey struct{}
+
+// AddUsage adds tokens of model to the usage of the request of ctx, when
+// the route records usage. The chat hooks add the model calls of the
+// handlers; handlers calling a model another way add them here.
+func AddUsage(ctx context.Context, model string, promptTokens, completionTokens int) {
+	if entry, ok := ctx.Value(usageContextKey{}).(*usageEntry); ok {
+		entry.add(model, promptTokens, completionTokens)
+	}
+}
+
+// usageHooks adds the tokens of every chat and the model of every embedding
+// to the usage of their request.
+func usageHooks(hooks *Hooks) {
+	hooks.OnAfterChat(func(ctx context.Context, req ollama.ChatRequest, resp *ollama.ChatResponse, err error) {
+		if resp == nil {
+			AddUsage(ctx, req.Model, 0, 0)
+			return
+		}
+		AddUsage(ctx, req.Model, resp.PromptEvalCount, resp.EvalCount)
+	})
+	hooks.OnEmbed(func(ctx context.Context, model string, texts []string, vectors [][]float64, err error) {
+		AddUsage(ctx, model, 0, 0)
+	})
+}
+
+// usageCaller is the caller as the audit log names it, without the port of
+// an anonymous caller, so its requests group together.
+func usageCaller(r *http.Request) string {
+	caller := CallerKey(r)
+	if strings.HasPrefix(caller, "ip:") {
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			return "ip:" + host
+		}
+	}
+	return caller
+}
+
+// UsageSummary is the usage of a group of records. Group holds the value of
+// each dimension the records were grouped by.
+type UsageSummary struct {
+	Group            map[string]string `json:"group,omitempty" swaggertype:"object"`
+	Requests         int               `json:"requests" swaggertype:"integer" example:"42"`
+	Errors           int               `json:"errors" swaggertype:"integer" example:"1"`
+	PromptTokens     int               `json:"prompt_tokens" swaggertype:"integer" example:"1200"`
+	CompletionTokens int               `json:"completion_tokens" swaggertype:"integer" example:"5400"`
+	TotalTokens      int               `json:"total_tokens" swaggertype:"integer" example:"6600"`
+	TotalDuration    time.Duration     `json:"total_duration" swaggertype:"integer" example:"63000000000"`
+	AverageDuration  time.Duration     `json:"average_duration" swaggertype:"integer" example:"1500000000"`
+}
+
+func (u *UsageSummary) add(record UsageRecord) {
+	u.Requests++
+	if record.Status >= http.StatusBadRequest {
+		u.Errors++
+	}
+	u.PromptTokens += record.PromptTokens
+	u.CompletionTokens += record.CompletionTokens
+	u.TotalTokens += record.PromptTokens + record.CompletionTokens
+	u.TotalDuration += record.Duration
+	u.AverageDuration = u.TotalDuration / time.Duration(u.Requests)
+}
+
+// usageDimension returns the value of record for one of UsageGroups.
+func usageDimension(record UsageRecord, dimension string) string {
+	switch dimension {
+	case "model":
+		return record.Model
+	case "key":
+		return record.Caller
+	case "day":
+		return record.Time.UTC().Format(usageDayLayout)
+	case "endpoint":
+		return record.Endpoint
+	}
+	return ""
+}
+
+// SummarizeUsage groups records by the dimensions of groupBy, taken from
+// UsageGroups, and returns the groups sorted by their values, so grouping
+// by day gives a time series, along with the totals of all the records.
+func SummarizeUsage(records []UsageRecord, groupBy []string) ([]UsageSummary, UsageSummary) {
+	var totals UsageSummary
+	groups := make(map[string]*UsageSummary)
+	keys := make([]string, 0)
+	for _, record := range records {
+		totals.add(record)
+		if len(groupBy) == 0 {
+			continue
+		}
+		values := make([]string, len(groupBy))
+		for i, dimension := range groupBy {
+			values[i] = usageDimension(record, dimension)
+		}
+		key := strings.Join(values, "\x00")
+		group, ok := groups[key]
+		if !ok {
+			group = &UsageSummary{Group: make(map[string]string, len(groupBy))}
+			for i, dimension := range groupBy {
+				group.Group[dimension] = values[i]
+			}
+			groups[key] = group
+			keys = append(keys, key)
+		}
+		group.add(record)
+	}
+	sort.Strings(keys)
+	summaries := make([]UsageSummary, 0, len(keys))
+	for _, key := range keys {
+		summaries = append(summaries, *groups[key])
+	}
+	return summaries, totals
+}
+
+// MemoryUsageStore keeps the usage in memory, until the process stops.
+type MemoryUsageStore struct {
+	mu      sync.RWMutex
+	records []UsageRecord
+}
+
+func NewMemoryUsageStore() *MemoryUsageStore {
+	return &MemoryUsageStore{records: make([]UsageRecord, 0)}
+}
+
+func (m *MemoryUsageStore) Write(records ...UsageRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records = append(m.records, records...)
+	return nil
+}
+
+func (m *MemoryUsageStore) Query(since, until time.Time) ([]UsageRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	records := make([]UsageRecord, 0)
+	for _, record := range m.records {
+		if usageInRange(record, since, until) {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+func (m *MemoryUsageStore) Prune(before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.records[:0]
+	for _, record := range m.records {
+		if !record.Time.Before(before) {
+			kept = append(kept, record)
+		}
+	}
+	pruned := len(m.records) - len(kept)
+	m.records = kept
+	return pruned, nil
+}
+
+func usageInRange(record UsageRecord, since, until time.Time) bool {
+	return (since.IsZero() || !record.Time.Before(since)) && (until.IsZero() || record.Time.Before(until))
+}
+
+// FileUsageStore appends records as JSON lines to a file per UTC day in a
+// directory, so a query reads only the days it covers and pruning deletes
+// whole days.
+type FileUsageStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+func NewFileUsageStore(dir string) (*FileUsageStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("error creating usage directory: %w", err)
+	}
+	return &FileUsageStore{dir: dir}, nil
+}
+
+func (s *FileUsageStore) path(day time.Time) string {
+	return filepath.Join(s.dir, fmt.Sprintf("usage-%s.jsonl", day.UTC().Format(usageFileLayout)))
+}
+
+func (s *FileUsageStore) Write(records ...UsageRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("error encoding usage record: %w", err)
+		}
+		file, err := os.OpenFile(s.path(record.Time), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return fmt.Errorf("error opening usage file: %w", err)
+		}
+		_, err = file.Write(append(line, '\n'))
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("error writing usage file: %w", err)
+		}
+	}
+	return nil
+}
+
+// files returns the usage files and their days, oldest first.
+func (s *FileUsageStore) files() ([]string, []time.Time, error) {
+	names, err := filepath.Glob(filepath.Join(s.dir, "usage-*.jsonl"))
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(names)
+	files := make([]string, 0, len(names))
+	days := make([]time.Time, 0, len(names))
+	for _, name := range names {
+		day, err := time.Parse(usageFileLayout, strings.TrimSuffix(strings.TrimPrefix(filepath.Base(name), "usage-"), ".jsonl"))
+		if err != nil {
+			continue
+		}
+		files = append(files, name)
+		days = append(days, day)
+	}
+	return files, days, nil
+}
+
+func (s *FileUsageStore) Query(since, until time.Time) ([]UsageRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files, days, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+	records := make([]UsageRecord, 0)
+	for i, name := range files {
+		if (!since.IsZero() && !days[i].Add(24*time.Hour).After(since)) || (!until.IsZero() && !days[i].Before(until)) {
+			continue
+		}
+		matched, err := readUsageFile(name, since, until)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, matched...)
+	}
+	return records, nil
+}
+
+func readUsageFile(name string, since, until time.Time) ([]UsageRecord, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("error opening usage file: %w", err)
+	}
+	defer file.Close()
+	records := make([]UsageRecord, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record UsageRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		if usageInRange(record, since, until) {
+			records = append(records, record)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// Prune deletes the files of the days that ended before before.
+func (s *FileUsageStore) Prune(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files, days, err := s.files()
+	if err != nil {
+		return 0, err
+	}
+	pruned := 0
+	for i, name := range files {
+		if days[i].Add(24 * time.Hour).After(before) {
+			continue
+		}
+		if err := os.Remove(name); err != nil {
+			return pruned, fmt.Errorf("error removing usage file: %w", err)
+		}
+		pruned++
+	}
+	return pruned, nil
+}
@@ -0,0 +1,49 @@
+package orus
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Middleware records the usage of the requests of the routes it wraps, a
+// record per model they called.
+func (l *UsageLog) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		entry := &usageEntry{usage: make(map[string]*UsageRecord)}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), usageContextKey{}, entry)))
+
+		template := UsageRecord{
+			Time:      start.UTC(),
+			RequestID: middleware.GetReqID(r.Context()),
+			Endpoint:  r.URL.Path,
+			Caller:    usageCaller(r),
+			Status:    ww.Status(),
+			Duration:  time.Since(start),
+		}
+		entry.mu.Lock()
+		defer entry.mu.Unlock()
+		if len(entry.models) == 0 {
+			l.Record(template)
+			return
+		}
+		records := make([]UsageRecord, 0, len(entry.models))
+		for _, model := range entry.models {
+			record := template
+			record.Model = model
+			record.PromptTokens = entry.usage[model].PromptTokens
+			record.CompletionTokens = entry.usage[model].CompletionTokens
+			records = append(records, record)
+		}
+		l.Record(records...)
+	})
+}
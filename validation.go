@@ -0,0 +1,13 @@
+package orus
+
+// ==================== Validation ====================
+
+type ValidationError struct {
+	Code    string
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
@@ -0,0 +1,574 @@
+package orus
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"unsafe"
+)
+
+const (
+	vectorFileMagic = "ORUSVEC1"
+	// vectorFileHeaderSize is the magic, the dimensions and the precision.
+	vectorFileHeaderSize = 16
+	// vectorFileFloat16 is the precision of a file of half precision slots,
+	// 0 being float32.
+	vectorFileFloat16 = 1
+	// vectorFileMinSlots is the fewest slots the file grows by.
+	vectorFileMinSlots = 1024
+	// vectorFileCompactMin is the fewest tombstones that trigger a compaction,
+	// once they are also half of the slots.
+	vectorFileCompactMin = 1024
+)
+
+// VectorFile keeps the embeddings of a collection in a flat file mapped in
+// memory, so the OS pages them in as they are searched and a collection
+// larger than RAM can be served. Only the embeddings, most of the size, are
+// mapped; the documents stay in memory with an index of their IDs.
+//
+// The file at path is a header of the magic, the dimensions and the
+// precision followed by one slot per document of float32 or float16 values,
+// in the byte order of the machine. The documents are logged to path.meta, where a delete appends a
+// tombstone; the slot stays in place until Compact rewrites both files. Their
+// content is encrypted there by cipher, when it is not nil.
+type VectorFile struct {
+	mu         sync.RWMutex
+	path       string
+	file       *os.File
+	meta       *os.File
+	data       []byte
+	dimensions int
+	// float16 stores the embeddings in half precision.
+	float16 bool
+	cipher  *Cipher
+	entries []vectorFileEntry
+	ids     map[string][]int
+	deleted int
+}
+
+type vectorFileEntry struct {
+	// document has no embedding, which is in the slot.
+	document Document
+	deleted  bool
+}
+
+// vectorFileRecord is a line of the metadata log.
+type vectorFileRecord struct {
+	Slot     int       `json:"slot"`
+	Document *Document `json:"document,omitempty"`
+	Deleted  bool      `json:"deleted,omitempty"`
+}
+
+// OpenVectorFile opens the vector file at path, creating it when missing,
+// with embeddings in half precision when float16 is set. A file stored in
+// the other precision is converted. The content of the documents is
+// encrypted by cipher, when it is not nil.
+func OpenVectorFile(path string, float16 bool, cipher *Cipher) (*VectorFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f := &VectorFile{path: path, ids: make(map[string][]int), float16: float16, cipher: cipher}
+	err := f.open()
+	if err == nil && f.float16 != float16 {
+		err = f.compactTo(float16)
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("error opening vector file %s: %w", path, err)
+	}
+	return f, nil
+}
+
+func (f *VectorFile) open() error {
+	if err := f.recoverCompaction(); err != nil {
+		return err
+	}
+	var err error
+	if f.file, err = os.OpenFile(f.path, os.O_RDWR|os.O_CREATE, 0o644); err != nil {
+		return err
+	}
+	if f.meta, err = os.OpenFile(f.path+".meta", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644); err != nil {
+		return err
+	}
+	info, err := f.file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		if _, err := f.file.WriteAt(f.header(f.float16), 0); err != nil {
+			return err
+		}
+		info, err = f.file.Stat()
+		if err != nil {
+			return err
+		}
+	}
+	if info.Size() < vectorFileHeaderSize {
+		return errors.New("the file is too short for a header")
+	}
+	if f.data, err = mapFile(f.file, int(info.Size())); err != nil {
+		return err
+	}
+	if string(f.data[:len(vectorFileMagic)]) != vectorFileMagic {
+		return errors.New("not a vector file")
+	}
+	f.dimensions = int(binary.NativeEndian.Uint32(f.data[len(vectorFileMagic):]))
+	f.float16 = binary.NativeEndian.Uint32(f.data[len(vectorFileMagic)+4:]) == vectorFileFloat16
+	if err := f.readMeta(); err != nil {
+		return err
+	}
+	if len(f.entries) > f.slots() {
+		return fmt.Errorf("the metadata has %d documents but the file has room for %d", len(f.entries), f.slots())
+	}
+	return nil
+}
+
+// recoverCompaction finishes a compaction that renamed the new vectors but
+// not the new metadata, and discards one that renamed neither.
+func (f *VectorFile) recoverCompaction() error {
+	if _, err := os.Stat(f.path + ".meta.compact"); err != nil {
+		return nil
+	}
+	if _, err := os.Stat(f.path + ".compact"); err == nil {
+		return errors.Join(os.Remove(f.path+".compact"), os.Remove(f.path+".meta.compact"))
+	}
+	return os.Rename(f.path+".meta.compact", f.path+".meta")
+}
+
+// readMeta replays the metadata log into the entries and the ID index.
+func (f *VectorFile) readMeta() error {
+	decoder := json.NewDecoder(bufio.NewReader(f.meta))
+	for {
+		var record vectorFileRecord
+		err := decoder.Decode(&record)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			// a crash cut the last record short: its documents were never
+			// added, and their slots are reused by the next append
+			log.Printf("Dropping a record cut short at the end of %s.meta", f.path)
+			return f.meta.Truncate(decoder.InputOffset())
+		}
+		if err != nil {
+			return fmt.Errorf("error reading metadata: %w", err)
+		}
+		switch {
+		case record.Document != nil:
+			if record.Slot != len(f.entries) {
+				return fmt.Errorf("metadata for slot %d found at slot %d", record.Slot, len(f.entries))
+			}
+			if record.Document.Content, err = f.cipher.Decrypt(record.Document.Content); err != nil {
+				return fmt.Errorf("error reading metadata for slot %d: %w", record.Slot, err)
+			}
+			f.entries = append(f.entries, vectorFileEntry{document: *record.Document})
+			f.ids[record.Document.ID] = append(f.ids[record.Document.ID], record.Slot)
+		case record.Deleted && record.Slot < len(f.entries):
+			f.remove(record.Slot)
+		}
+	}
+}
+
+// slots returns the number of documents the mapped file has room for.
+func (f *VectorFile) slots() int {
+	if f.dimensions == 0 {
+		return 0
+	}
+	return (len(f.data) - vectorFileHeaderSize) / f.slotSize()
+}
+
+func (f *VectorFile) slotSize() int {
+	if f.float16 {
+		return f.dimensions * 2
+	}
+	return f.dimensions * 4
+}
+
+func (f *VectorFile) header(float16 bool) []byte {
+	header := make([]byte, vectorFileHeaderSize)
+	copy(header, vectorFileMagic)
+	binary.NativeEndian.PutUint32(header[len(vectorFileMagic):], uint32(f.dimensions))
+	if float16 {
+		binary.NativeEndian.PutUint32(header[len(vectorFileMagic)+4:], vectorFileFloat16)
+	}
+	return header
+}
+
+// vector returns the float32 embedding in slot, which aliases the mapped
+// file.
+func (f *VectorFile) vector(slot int) []float32 {
+	offset := vectorFileHeaderSize + slot*f.slotSize()
+	return unsafe.Slice((*float32)(unsafe.Pointer(&f.data[offset])), f.dimensions)
+}
+
+// vector16 returns the float16 embedding in slot, which aliases the mapped
+// file.
+func (f *VectorFile) vector16(slot int) []uint16 {
+	offset := vectorFileHeaderSize + slot*f.slotSize()
+	return unsafe.Slice((*uint16)(unsafe.Pointer(&f.data[offset])), f.dimensions)
+}
+
+// Len returns the number of documents, not counting the deleted ones.
+func (f *VectorFile) Len() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return len(f.entries) - f.deleted
+}
+
+// Append adds documents at the end of the file, growing it when needed.
+// Every embedding must have the dimensions of the first one stored.
+func (f *VectorFile) Append(documents ...Document) error {
+	if len(documents) == 0 {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.dimensions == 0 {
+		if len(documents[0].Embedding) == 0 {
+			return errors.New("a document has no embedding")
+		}
+		f.dimensions = len(documents[0].Embedding)
+		binary.NativeEndian.PutUint32(f.data[len(vectorFileMagic):], uint32(f.dimensions))
+	}
+	for _, document := range documents {
+		if len(document.Embedding) != f.dimensions {
+			return fmt.Errorf("document %s has %d dimensions, the file holds %d", document.ID, len(document.Embedding), f.dimensions)
+		}
+	}
+	if err := f.reserve(len(f.entries) + len(documents)); err != nil {
+		return err
+	}
+
+	lines := &bytes.Buffer{}
+	encoder := json.NewEncoder(lines)
+	for i, document := range documents {
+		slot := len(f.entries) + i
+		if f.float16 {
+			vector := f.vector16(slot)
+			for j, value := range document.Embedding {
+				vector[j] = float32ToFloat16(float32(value))
+			}
+		} else {
+			vector := f.vector(slot)
+			for j, value := range document.Embedding {
+				vector[j] = float32(value)
+			}
+		}
+		document.Embedding = nil
+		document.Content = f.cipher.Encrypt(document.Content)
+		if err := encoder.Encode(vectorFileRecord{Slot: slot, Document: &document}); err != nil {
+			return fmt.Errorf("error encoding metadata: %w", err)
+		}
+	}
+	// The vectors are in place before their metadata, so a crash leaves at
+	// worst slots that are reused by the next append
+	if _, err := f.meta.Write(lines.Bytes()); err != nil {
+		return fmt.Errorf("error writing metadata: %w", err)
+	}
+	for _, document := range documents {
+		slot := len(f.entries)
+		document.Embedding = nil
+		f.entries = append(f.entries, vectorFileEntry{document: document})
+		f.ids[document.ID] = append(f.ids[document.ID], slot)
+	}
+	return nil
+}
+
+// reserve grows the file so it has room for slots documents.
+func (f *VectorFile) reserve(slots int) error {
+	if slots <= f.slots() {
+		return nil
+	}
+	slots = max(slots, 2*f.slots(), vectorFileMinSlots)
+	size := vectorFileHeaderSize + slots*f.slotSize()
+	if err := unmapFile(f.data); err != nil {
+		return err
+	}
+	f.data = nil
+	if err := f.file.Truncate(int64(size)); err != nil {
+		return fmt.Errorf("error growing vector file: %w", err)
+	}
+	data, err := mapFile(f.file, size)
+	if err != nil {
+		return err
+	}
+	f.data = data
+	return nil
+}
+
+// Delete adds a tombstone for the documents with the given IDs and returns
+// how many were deleted.
+func (f *VectorFile) Delete(ids ...string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	slots := make([]int, 0, len(ids))
+	for _, id := range ids {
+		for _, slot := range f.ids[id] {
+			if !f.entries[slot].deleted {
+				slots = append(slots, slot)
+			}
+		}
+	}
+	return f.delete(slots)
+}
+
+// DeleteWhere adds a tombstone for the documents accepted by filter and
+// returns how many were deleted.
+func (f *VectorFile) DeleteWhere(filter func(Document) bool) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	slots := make([]int, 0)
+	for slot, entry := range f.entries {
+		if !entry.deleted && filter(entry.document) {
+			slots = append(slots, slot)
+		}
+	}
+	return f.delete(slots)
+}
+
+func (f *VectorFile) delete(slots []int) int {
+	if len(slots) == 0 {
+		return 0
+	}
+	lines := &bytes.Buffer{}
+	encoder := json.NewEncoder(lines)
+	for _, slot := range slots {
+		_ = encoder.Encode(vectorFileRecord{Slot: slot, Deleted: true})
+	}
+	if _, err := f.meta.Write(lines.Bytes()); err != nil {
+		log.Printf("Error writing tombstones to %s: %v", f.path, err)
+		return 0
+	}
+	for _, slot := range slots {
+		f.remove(slot)
+	}
+	if f.deleted >= vectorFileCompactMin && f.deleted*2 >= len(f.entries) {
+		if err := f.compact(); err != nil {
+			log.Printf("Error compacting %s: %v", f.path, err)
+		}
+	}
+	return len(slots)
+}
+
+// remove marks slot as deleted in memory.
+func (f *VectorFile) remove(slot int) {
+	entry := &f.entries[slot]
+	if entry.deleted {
+		return
+	}
+	entry.deleted = true
+	f.deleted++
+	id := entry.document.ID
+	f.ids[id] = slices.DeleteFunc(f.ids[id], func(s int) bool { return s == slot })
+	if len(f.ids[id]) == 0 {
+		delete(f.ids, id)
+	}
+}
+
+// IDs returns the IDs of the documents accepted by filter.
+func (f *VectorFile) IDs(filter func(Document) bool) []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	ids := make([]string, 0)
+	for _, entry := range f.entries {
+		if !entry.deleted && filter(entry.document) {
+			ids = append(ids, entry.document.ID)
+		}
+	}
+	return ids
+}
+
+// Documents returns the documents accepted by filter (nil accepts all), with
+// their embeddings.
+func (f *VectorFile) Documents(filter func(Document) bool) []Document {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	documents := make([]Document, 0)
+	for slot, entry := range f.entries {
+		if entry.deleted || (filter != nil && !filter(entry.document)) {
+			continue
+		}
+		document := entry.document
+		document.Embedding = f.embedding(slot)
+		documents = append(documents, document)
+	}
+	return documents
+}
+
+func (f *VectorFile) embedding(slot int) []float64 {
+	if f.float16 {
+		return fromFloat16(f.vector16(slot))
+	}
+	vector := f.vector(slot)
+	embedding := make([]float64, len(vector))
+	for i, value := range vector {
+		embedding[i] = float64(value)
+	}
+	return embedding
+}
+
+// Search returns the limit documents most similar to the query vector,
+// skipping documents rejected by filter (nil accepts all), sharded as
+// configured.
+func (f *VectorFile) Search(query []float64, limit int, filter func(Document) bool, config *SearchConfig) []SearchResult {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if len(query) != f.dimensions {
+		return make([]SearchResult, 0)
+	}
+	half := newHalfQuery(query)
+	return searchSharded(config, len(f.entries), limit, func(start, end int) []SearchResult {
+		results := make(resultHeap, 0)
+		embedding := make([]float64, f.dimensions)
+		for slot := start; slot < end; slot++ {
+			entry := &f.entries[slot]
+			if entry.deleted || (filter != nil && !filter(entry.document)) {
+				continue
+			}
+			var similarity float64
+			if f.float16 {
+				similarity = half.similarity(f.vector16(slot))
+			} else {
+				for i, value := range f.vector(slot) {
+					embedding[i] = float64(value)
+				}
+				similarity = CosineSimilarity(query, embedding)
+			}
+			if !results.wants(similarity, limit) {
+				continue
+			}
+			document := entry.document
+			document.Embedding = f.embedding(slot)
+			results.keep(SearchResult{Document: document, Similarity: similarity}, limit)
+		}
+		return results
+	})
+}
+
+// Compact rewrites the file without the deleted documents.
+func (f *VectorFile) Compact() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.compactTo(f.float16)
+}
+
+func (f *VectorFile) compact() error {
+	return f.compactTo(f.float16)
+}
+
+// compactTo writes the live documents, in half precision when float16 is
+// set, to new files and renames them over the current ones, vectors first;
+// open finishes a compaction interrupted between the renames.
+func (f *VectorFile) compactTo(float16 bool) error {
+	vectors := &bytes.Buffer{}
+	vectors.Write(f.header(float16))
+	lines := &bytes.Buffer{}
+	encoder := json.NewEncoder(lines)
+	slots := 0
+	converted := make([]byte, 0, f.dimensions*4)
+	for slot, entry := range f.entries {
+		if entry.deleted {
+			continue
+		}
+		switch {
+		case float16 == f.float16:
+			offset := vectorFileHeaderSize + slot*f.slotSize()
+			vectors.Write(f.data[offset : offset+f.slotSize()])
+		case float16:
+			converted = converted[:0]
+			for _, value := range f.vector(slot) {
+				converted = binary.NativeEndian.AppendUint16(converted, float32ToFloat16(value))
+			}
+			vectors.Write(converted)
+		default:
+			converted = converted[:0]
+			for _, h := range f.vector16(slot) {
+				converted = binary.NativeEndian.AppendUint32(converted, math.Float32bits(float16Table[h]))
+			}
+			vectors.Write(converted)
+		}
+		document := entry.document
+		document.Content = f.cipher.Encrypt(document.Content)
+		if err := encoder.Encode(vectorFileRecord{Slot: slots, Document: &document}); err != nil {
+			return fmt.Errorf("error encoding metadata: %w", err)
+		}
+		slots++
+	}
+	if err := writeSynced(f.path+".compact", vectors.Bytes()); err != nil {
+		return err
+	}
+	if err := writeSynced(f.path+".meta.compact", lines.Bytes()); err != nil {
+		return err
+	}
+	if err := f.close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.path+".compact", f.path); err != nil {
+		return err
+	}
+	if err := os.Rename(f.path+".meta.compact", f.path+".meta"); err != nil {
+		return err
+	}
+	f.entries, f.ids, f.deleted = nil, make(map[string][]int), 0
+	return f.open()
+}
+
+func writeSynced(path string, data []byte) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Sync flushes the vectors and the metadata to disk.
+func (f *VectorFile) Sync() error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if err := f.file.Sync(); err != nil {
+		return err
+	}
+	return f.meta.Sync()
+}
+
+// Close unmaps and closes the file.
+func (f *VectorFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.close()
+}
+
+func (f *VectorFile) close() error {
+	var errs []error
+	if f.data != nil {
+		errs = append(errs, unmapFile(f.data))
+		f.data = nil
+	}
+	if f.file != nil {
+		errs = append(errs, f.file.Close())
+		f.file = nil
+	}
+	if f.meta != nil {
+		errs = append(errs, f.meta.Close())
+		f.meta = nil
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,18 @@
+//go:build !unix
+
+package orus
+
+import (
+	"errors"
+	"os"
+)
+
+var errMmapUnsupported = errors.New("memory-mapped vector files are not supported on this platform")
+
+func mapFile(file *os.File, size int) ([]byte, error) {
+	return nil, errMmapUnsupported
+}
+
+func unmapFile(data []byte) error {
+	return errMmapUnsupported
+}
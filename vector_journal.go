@@ -0,0 +1,351 @@
+package orus
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// DefaultJournalCheckpoint is how many records a journal takes before it is
+// checkpointed.
+const DefaultJournalCheckpoint = 10000
+
+// vectorJournalRecord is a line of a journal: the documents added to the
+// collection, or the IDs of the documents deleted from it.
+type vectorJournalRecord struct {
+	Add    []Document `json:"add,omitempty"`
+	Delete []string   `json:"delete,omitempty"`
+}
+
+// VectorJournal is a write-ahead log of the changes of vector collections.
+// Each change is appended to dir/<collection>.wal and flushed to disk
+// before the collection applies it, so a crash mid-ingest loses at worst the
+// change that was being written.
+//
+// Every checkpoint records, the journal is rotated to <collection>.wal.old
+// and the collection is checkpointed: a collection in memory is written to
+// dir/<collection>.json, in the format of VectorStore.Save, and a collection
+// backed by a vector file is flushed to it. The old journal is removed once
+// the checkpoint is on disk. At startup VectorStore.Recover loads the
+// checkpoint and replays the journals on top of it.
+//
+// The content of the documents in the journals and the checkpoints is
+// encrypted by cipher, like the documents of the storage.
+type VectorJournal struct {
+	dir         string
+	collections []string
+	checkpoint  int
+	cipher      *Cipher
+
+	mu   sync.Mutex
+	logs map[string]*journalLog
+}
+
+type journalLog struct {
+	file    *os.File
+	records int
+	// checkpointing is set from the rotation of the journal until the old
+	// one is removed.
+	checkpointing bool
+}
+
+// OpenVectorJournal journals collections in dir, created when missing, and
+// checkpoints them every checkpoint records. The content of the documents
+// is encrypted by cipher, when it is not nil.
+func OpenVectorJournal(dir string, collections []string, checkpoint int, cipher *Cipher) (*VectorJournal, error) {
+	if len(collections) == 0 {
+		return nil, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating journal directory: %w", err)
+	}
+	return &VectorJournal{
+		dir:         dir,
+		collections: collections,
+		checkpoint:  max(checkpoint, 1),
+		cipher:      cipher,
+		logs:        make(map[string]*journalLog),
+	}, nil
+}
+
+// Journals reports whether the changes of collection are journaled.
+func (j *VectorJournal) Journals(collection string) bool {
+	return j != nil && slices.Contains(j.collections, collection)
+}
+
+func (j *VectorJournal) path(collection string) string {
+	return filepath.Join(j.dir, collection+".wal")
+}
+
+// checkpointPath is the file a collection in memory is checkpointed to.
+func (j *VectorJournal) checkpointPath(collection string) string {
+	return filepath.Join(j.dir, collection+".json")
+}
+
+func (j *VectorJournal) log(collection string) *journalLog {
+	l := j.logs[collection]
+	if l == nil {
+		l = &journalLog{}
+		j.logs[collection] = l
+	}
+	return l
+}
+
+// append writes record to the journal of collection and flushes it, and
+// reports whether the collection is due for a checkpoint.
+func (j *VectorJournal) append(collection string, record vectorJournalRecord) (bool, error) {
+	record.Add = j.cipher.seal(record.Add)
+	line, err := json.Marshal(record)
+	if err != nil {
+		return false, fmt.Errorf("error encoding journal record: %w", err)
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	l := j.log(collection)
+	if l.file == nil {
+		if l.file, err = os.OpenFile(j.path(collection), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644); err != nil {
+			return false, fmt.Errorf("error opening journal: %w", err)
+		}
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return false, fmt.Errorf("error writing journal: %w", err)
+	}
+	if err := l.file.Sync(); err != nil {
+		return false, fmt.Errorf("error flushing journal: %w", err)
+	}
+	l.records++
+	return l.records >= j.checkpoint && !l.checkpointing, nil
+}
+
+// rotate moves the journal of collection aside for a checkpoint, so the
+// next changes start a new one. It reports false when a checkpoint of the
+// collection is already running.
+func (j *VectorJournal) rotate(collection string) (bool, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	l := j.log(collection)
+	if l.checkpointing {
+		return false, nil
+	}
+	if l.file != nil {
+		err := l.file.Close()
+		l.file = nil
+		if err != nil {
+			return false, fmt.Errorf("error closing journal: %w", err)
+		}
+	}
+	path := j.path(collection)
+	if _, err := os.Stat(path + ".old"); err == nil {
+		// a checkpoint failed after the last rotation: its old journal is
+		// not covered yet, so the current one is appended to it
+		if err := appendFile(path+".old", path); err != nil {
+			return false, err
+		}
+	} else if err := os.Rename(path, path+".old"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, fmt.Errorf("error rotating journal: %w", err)
+	}
+	l.records = 0
+	l.checkpointing = true
+	return true, nil
+}
+
+// appendFile appends the file at src to the one at dst and removes it.
+func appendFile(dst, src string) error {
+	data, err := os.ReadFile(src)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error rotating journal: %w", err)
+	}
+	file, err := os.OpenFile(dst, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("error rotating journal: %w", err)
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if err := errors.Join(err, file.Close()); err != nil {
+		return fmt.Errorf("error rotating journal: %w", err)
+	}
+	return os.Remove(src)
+}
+
+// checkpointed ends the checkpoint of collection, removing the old journal
+// when the checkpoint is on disk.
+func (j *VectorJournal) checkpointed(collection string, done bool) error {
+	var err error
+	if done {
+		if err = os.Remove(j.path(collection) + ".old"); errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+	}
+	j.mu.Lock()
+	j.log(collection).checkpointing = false
+	j.mu.Unlock()
+	return err
+}
+
+// read returns the records of the old and the current journal of
+// collection, in the order they were written. A record cut short by a crash
+// at the end of a journal is dropped, as its change was never applied.
+func (j *VectorJournal) read(collection string) ([]vectorJournalRecord, error) {
+	records := make([]vectorJournalRecord, 0)
+	for _, path := range []string{j.path(collection) + ".old", j.path(collection)} {
+		file, err := os.OpenFile(path, os.O_RDWR, 0)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error opening journal: %w", err)
+		}
+		records, err = readJournal(file, records)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading journal %s: %w", path, err)
+		}
+	}
+	for _, record := range records {
+		if err := j.cipher.open(record.Add); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// Reencrypt rewrites the checkpoints and the journals holding documents not
+// encrypted under the first key, and returns how many documents it
+// rewrote. It must not run while a server journals the collections.
+func (j *VectorJournal) Reencrypt() (int, error) {
+	if j == nil {
+		return 0, nil
+	}
+	rewritten := 0
+	for _, collection := range j.collections {
+		documents, err := readDocuments(j.checkpointPath(collection))
+		if err != nil {
+			return rewritten, fmt.Errorf("error reading checkpoint of %s: %w", collection, err)
+		}
+		n, err := j.reencrypt(documents)
+		if err == nil && n > 0 {
+			err = writeDocuments(j.checkpointPath(collection), documents)
+		}
+		if err != nil {
+			return rewritten, fmt.Errorf("error re-encrypting checkpoint of %s: %w", collection, err)
+		}
+		rewritten += n
+		for _, path := range []string{j.path(collection) + ".old", j.path(collection)} {
+			n, err := j.reencryptJournal(path)
+			rewritten += n
+			if err != nil {
+				return rewritten, fmt.Errorf("error re-encrypting journal %s: %w", path, err)
+			}
+		}
+	}
+	return rewritten, nil
+}
+
+// reencrypt encrypts the content of documents again under the first key, in
+// place, and returns how many changed.
+func (j *VectorJournal) reencrypt(documents []Document) (int, error) {
+	changed := 0
+	for i := range documents {
+		content, ok, err := j.cipher.reencrypt(documents[i].Content)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			documents[i].Content = content
+			changed++
+		}
+	}
+	return changed, nil
+}
+
+// reencryptJournal rewrites the journal at path when it holds documents
+// not encrypted under the first key, replacing it once the new one is on
+// disk.
+func (j *VectorJournal) reencryptJournal(path string) (int, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	records, err := readJournal(file, nil)
+	file.Close()
+	if err != nil {
+		return 0, err
+	}
+	rewritten := 0
+	var data bytes.Buffer
+	for _, record := range records {
+		n, err := j.reencrypt(record.Add)
+		if err != nil {
+			return 0, err
+		}
+		rewritten += n
+		line, err := json.Marshal(record)
+		if err != nil {
+			return 0, fmt.Errorf("error encoding journal record: %w", err)
+		}
+		data.Write(append(line, '\n'))
+	}
+	if rewritten == 0 {
+		return 0, nil
+	}
+	tmp := path + ".tmp"
+	file, err = os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	_, err = file.Write(data.Bytes())
+	if err == nil {
+		err = file.Sync()
+	}
+	if err := errors.Join(err, file.Close()); err != nil {
+		return 0, err
+	}
+	return rewritten, os.Rename(tmp, path)
+}
+
+// readJournal appends the records of file to records, truncating a last
+// line without its newline.
+func readJournal(file *os.File, records []vectorJournalRecord) ([]vectorJournalRecord, error) {
+	reader := bufio.NewReader(file)
+	var offset int64
+	for n := 1; ; n++ {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				log.Printf("Dropping a record cut short at the end of %s", file.Name())
+				if err := file.Truncate(offset); err != nil {
+					return nil, err
+				}
+			}
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		offset += int64(len(line))
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var record vectorJournalRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, fmt.Errorf("line %d is corrupt: %w", n, err)
+		}
+		records = append(records, record)
+	}
+}
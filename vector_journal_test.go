@@ -0,0 +1,126 @@
+package orus
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testCipher(t *testing.T, ids ...string) *Cipher {
+	t.Helper()
+	keys := make([]Secret, 0, len(ids))
+	for _, id := range ids {
+		key := bytes.Repeat([]byte(id[len(id)-1:]), 32)
+		keys = append(keys, Secret(id+":"+base64.StdEncoding.EncodeToString(key)))
+	}
+	cipher, err := NewCipher(EncryptionConfig{Keys: keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cipher
+}
+
+func testJournal(t *testing.T, dir string, cipher *Cipher) *VectorStore {
+	t.Helper()
+	journal, err := OpenVectorJournal(dir, []string{"docs"}, 100, cipher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewVectorStore().SetJournal(journal)
+}
+
+func contents(documents []Document) map[string]string {
+	byID := make(map[string]string, len(documents))
+	for _, document := range documents {
+		byID[document.ID] = document.Content
+	}
+	return byID
+}
+
+func TestVectorJournalEncryptsContent(t *testing.T) {
+	dir := t.TempDir()
+	store := testJournal(t, dir, testCipher(t, "k1"))
+	store.Add("docs", Document{ID: "a", Content: "first secret", Embedding: []float64{1, 0}})
+	store.Add("docs", Document{ID: "b", Content: "second secret", Embedding: []float64{0, 1}})
+	store.Delete("docs", "b")
+
+	wal, err := os.ReadFile(filepath.Join(dir, "docs.wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(wal, []byte("secret")) {
+		t.Fatalf("journal holds the content in plain text: %s", wal)
+	}
+
+	recovered := testJournal(t, dir, testCipher(t, "k1"))
+	if _, err := recovered.Recover(); err != nil {
+		t.Fatal(err)
+	}
+	checkpoint, err := os.ReadFile(filepath.Join(dir, "docs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(checkpoint, []byte("secret")) {
+		t.Fatalf("checkpoint holds the content in plain text: %s", checkpoint)
+	}
+	got := contents(recovered.Documents("docs", nil))
+	if len(got) != 1 || got["a"] != "first secret" {
+		t.Fatalf("recovered %v, want a: first secret", got)
+	}
+
+	// the checkpoint is read back on the next start
+	again := testJournal(t, dir, testCipher(t, "k1"))
+	if _, err := again.Recover(); err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(again.Documents("docs", nil)); got["a"] != "first secret" {
+		t.Fatalf("recovered %v from the checkpoint, want a: first secret", got)
+	}
+}
+
+func TestVectorJournalWithoutKeyFails(t *testing.T) {
+	dir := t.TempDir()
+	store := testJournal(t, dir, testCipher(t, "k1"))
+	store.Add("docs", Document{ID: "a", Content: "secret", Embedding: []float64{1}})
+
+	if _, err := testJournal(t, dir, testCipher(t, "k2")).Recover(); err == nil {
+		t.Fatal("recovered a journal encrypted with a key that is not configured")
+	}
+}
+
+func TestVectorJournalReencrypt(t *testing.T) {
+	dir := t.TempDir()
+	store := testJournal(t, dir, testCipher(t, "k1"))
+	store.Add("docs", Document{ID: "a", Content: "checkpointed", Embedding: []float64{1}})
+	if err := store.Checkpoint("docs"); err != nil {
+		t.Fatal(err)
+	}
+	store.Add("docs", Document{ID: "b", Content: "journaled", Embedding: []float64{1}})
+
+	journal, err := OpenVectorJournal(dir, []string{"docs"}, 100, testCipher(t, "k2", "k1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rewritten, err := journal.Reencrypt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rewritten != 2 {
+		t.Fatalf("rewrote %d documents, want 2", rewritten)
+	}
+	if rewritten, err := journal.Reencrypt(); err != nil || rewritten != 0 {
+		t.Fatalf("rewrote %d documents again (%v), want 0", rewritten, err)
+	}
+
+	// k1 can be removed once the files are rewritten
+	recovered := testJournal(t, dir, testCipher(t, "k2"))
+	if _, err := recovered.Recover(); err != nil {
+		t.Fatal(err)
+	}
+	got := contents(recovered.Documents("docs", nil))
+	if got["a"] != "checkpointed" || got["b"] != "journaled" {
+		t.Fatalf("recovered %v", got)
+	}
+}
@@ -0,0 +1,617 @@
+package orus
+
+import (
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrCollectionNotFound = errors.New("collection not found")
+
+// SearchConfig tunes the vector search.
+type SearchConfig struct {
+	// Kernel is the similarity kernel: "auto" picks the fastest on this CPU,
+	// or one of "generic", "unrolled" and, on amd64, "avx2".
+	Kernel string `yaml:"kernel"`
+	// Shards splits a collection into parts searched concurrently; 0 uses
+	// one per CPU.
+	Shards int `yaml:"shards"`
+	// Parallelism caps the shards of one query searched at once; 0 searches
+	// them all at once.
+	Parallelism int `yaml:"parallelism"`
+	// MinShardSize is the fewest documents in a shard, so a small collection
+	// is searched in a single pass.
+	MinShardSize int `yaml:"min_shard_size"`
+	// MmapCollections are kept in memory-mapped vector files in MmapDir,
+	// for collections larger than RAM.
+	MmapDir         string   `yaml:"mmap_dir"`
+	MmapCollections []string `yaml:"mmap_collections"`
+	// Float16Collections store their embeddings in half precision, in
+	// memory and in their vector files, for half the footprint.
+	Float16Collections []string `yaml:"float16_collections"`
+	// JournalCollections have their changes written ahead to a journal in
+	// JournalDir, replayed at startup, and are checkpointed every
+	// JournalCheckpoint records.
+	JournalDir         string   `yaml:"journal_dir"`
+	JournalCollections []string `yaml:"journal_collections"`
+	JournalCheckpoint  int      `yaml:"journal_checkpoint"`
+}
+
+const DefaultMinShardSize = 10000
+
+func DefaultSearchConfig() SearchConfig {
+	return SearchConfig{
+		Kernel:            SimilarityKernelAuto,
+		MinShardSize:      DefaultMinShardSize,
+		JournalCheckpoint: DefaultJournalCheckpoint,
+	}
+}
+
+// shardCount returns the shards a collection of size documents is split into.
+func (c SearchConfig) shardCount(size int) int {
+	shards := c.Shards
+	if shards <= 0 {
+		shards = runtime.GOMAXPROCS(0)
+	}
+	minSize := max(c.MinShardSize, 1)
+	return max(min(shards, size/minSize), 1)
+}
+
+// VectorStore keeps named collections of embedded documents in memory
+// and answers brute-force cosine similarity queries over them. A collection
+// opened with OpenFile keeps its embeddings in a memory-mapped VectorFile
+// instead. The changes of the collections listed by its VectorJournal are
+// journaled before they are applied.
+type VectorStore struct {
+	mu          sync.RWMutex
+	collections map[string][]Document
+	files       map[string]*VectorFile
+	// float16 are the collections stored in half precision.
+	float16 map[string]bool
+	search  atomic.Pointer[SearchConfig]
+	journal *VectorJournal
+	// cipher encrypts the content of the documents in the vector files and
+	// the files of Save; nil keeps it in plain text.
+	cipher *Cipher
+}
+
+func NewVectorStore() *VectorStore {
+	v := &VectorStore{
+		collections: make(map[string][]Document),
+		files:       make(map[string]*VectorFile),
+		float16:     make(map[string]bool),
+	}
+	return v.SetSearch(DefaultSearchConfig())
+}
+
+// SetFloat16 stores the embeddings of collections in half precision,
+// converting those already held in memory. It must be called before the
+// collections are opened with OpenFile.
+func (v *VectorStore) SetFloat16(collections ...string) *VectorStore {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, collection := range collections {
+		v.float16[collection] = true
+		documents := v.collections[collection]
+		for i := range documents {
+			documents[i] = toHalf(documents[i])
+		}
+	}
+	return v
+}
+
+// toHalf moves the embedding of document to half precision.
+func toHalf(document Document) Document {
+	if document.Embedding != nil {
+		document.half = toFloat16(document.Embedding)
+		document.Embedding = nil
+	}
+	return document
+}
+
+// fromHalf restores the embedding of a document stored in half precision.
+func fromHalf(document Document) Document {
+	if document.half != nil {
+		document.Embedding = fromFloat16(document.half)
+		document.half = nil
+	}
+	return document
+}
+
+// OpenFile backs collection with the vector file at path, created when
+// missing. The documents the collection already holds in memory are moved
+// to the file.
+func (v *VectorStore) OpenFile(collection string, path string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	file, err := OpenVectorFile(path, v.float16[collection], v.cipher)
+	if err != nil {
+		return err
+	}
+	documents := make([]Document, len(v.collections[collection]))
+	for i, document := range v.collections[collection] {
+		documents[i] = fromHalf(document)
+	}
+	if err := file.Append(documents...); err != nil {
+		file.Close()
+		return err
+	}
+	delete(v.collections, collection)
+	v.files[collection] = file
+	return nil
+}
+
+// file returns the vector file backing collection, or nil when it is kept
+// in memory.
+func (v *VectorStore) file(collection string) *VectorFile {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.files[collection]
+}
+
+// SetCipher encrypts the content of the documents written to the vector
+// files and by Save with cipher. It must be called before the collections
+// are opened with OpenFile or loaded.
+func (v *VectorStore) SetCipher(cipher *Cipher) *VectorStore {
+	v.cipher = cipher
+	return v
+}
+
+// SetJournal journals the changes of the collections journal lists. It must
+// be called before they change, and followed by Recover once they are
+// loaded.
+func (v *VectorStore) SetJournal(journal *VectorJournal) *VectorStore {
+	v.journal = journal
+	return v
+}
+
+// journalChange writes record to the journal of collection before it is
+// applied, and starts a checkpoint when one is due. It is called with the
+// lock held.
+func (v *VectorStore) journalChange(collection string, record vectorJournalRecord) {
+	if !v.journal.Journals(collection) {
+		return
+	}
+	due, err := v.journal.append(collection, record)
+	if err != nil {
+		log.Printf("Error journaling a change of %s: %v", collection, err)
+		return
+	}
+	if due {
+		go func() {
+			if err := v.Checkpoint(collection); err != nil {
+				log.Printf("Error checkpointing %s: %v", collection, err)
+			}
+		}()
+	}
+}
+
+// Checkpoint writes a collection in memory to its checkpoint, or flushes a
+// collection backed by a vector file, and removes the journal of the
+// changes it covers. The collection keeps changing meanwhile, in a new
+// journal.
+func (v *VectorStore) Checkpoint(collection string) error {
+	if !v.journal.Journals(collection) {
+		return nil
+	}
+	v.mu.Lock()
+	rotated, err := v.journal.rotate(collection)
+	if err != nil || !rotated {
+		v.mu.Unlock()
+		return err
+	}
+	file := v.files[collection]
+	documents := slices.Clone(v.collections[collection])
+	v.mu.Unlock()
+	if file != nil {
+		err = file.Sync()
+	} else {
+		for i := range documents {
+			documents[i] = fromHalf(documents[i])
+		}
+		err = writeDocuments(v.journal.checkpointPath(collection), v.journal.cipher.seal(documents))
+	}
+	return errors.Join(err, v.journal.checkpointed(collection, err == nil))
+}
+
+// Recover restores the journaled collections after a restart: a collection
+// in memory is replaced by its checkpoint, when there is one, then the
+// changes journaled since are applied again and the collection is
+// checkpointed. It returns how many changes were replayed.
+func (v *VectorStore) Recover() (int, error) {
+	if v.journal == nil {
+		return 0, nil
+	}
+	replayed := 0
+	var errs []error
+	for _, collection := range v.journal.collections {
+		n, err := v.recover(collection)
+		replayed += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error recovering %s: %w", collection, err))
+		}
+	}
+	return replayed, errors.Join(errs...)
+}
+
+func (v *VectorStore) recover(collection string) (int, error) {
+	records, err := v.journal.read(collection)
+	if err != nil {
+		return 0, err
+	}
+	v.mu.Lock()
+	if v.files[collection] == nil {
+		documents, err := readDocuments(v.journal.checkpointPath(collection))
+		if err == nil {
+			err = v.journal.cipher.open(documents)
+		}
+		if err != nil {
+			v.mu.Unlock()
+			return 0, fmt.Errorf("error reading checkpoint: %w", err)
+		}
+		if documents != nil {
+			v.collections[collection] = v.stored(collection, documents)
+		}
+	}
+	for _, record := range records {
+		v.apply(collection, record)
+	}
+	v.mu.Unlock()
+	return len(records), v.Checkpoint(collection)
+}
+
+// apply replays a journal record on collection. The documents added replace
+// those with the same IDs, so a change replayed on a collection that already
+// holds it leaves the collection as it was. It is called with the lock held.
+func (v *VectorStore) apply(collection string, record vectorJournalRecord) {
+	ids := slices.Clone(record.Delete)
+	for _, document := range record.Add {
+		ids = append(ids, document.ID)
+	}
+	if file := v.files[collection]; file != nil {
+		file.Delete(ids...)
+		if err := file.Append(record.Add...); err != nil {
+			log.Printf("Error adding documents to %s: %v", collection, err)
+		}
+		return
+	}
+	remove := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		remove[id] = struct{}{}
+	}
+	documents := slices.DeleteFunc(v.collections[collection], func(document Document) bool {
+		_, ok := remove[document.ID]
+		return ok
+	})
+	v.collections[collection] = append(documents, v.stored(collection, record.Add)...)
+}
+
+// stored returns documents in the precision collection is stored in.
+func (v *VectorStore) stored(collection string, documents []Document) []Document {
+	if v.float16[collection] {
+		for i := range documents {
+			documents[i] = toHalf(documents[i])
+		}
+	}
+	return documents
+}
+
+// SetSearch changes the sharding of the searches that start after it.
+func (v *VectorStore) SetSearch(config SearchConfig) *VectorStore {
+	v.search.Store(&config)
+	return v
+}
+
+// Add stores documents in the collection, creating it when needed.
+// Documents without an ID or creation time get one assigned.
+func (v *VectorStore) Add(collection string, documents ...Document) []Document {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	now := time.Now().UTC()
+	for i := range documents {
+		if documents[i].ID == "" {
+			documents[i].ID = uuid.New().String()
+		}
+		if documents[i].CreatedAt.IsZero() {
+			documents[i].CreatedAt = now
+		}
+	}
+	v.journalChange(collection, vectorJournalRecord{Add: documents})
+	if file := v.files[collection]; file != nil {
+		if err := file.Append(documents...); err != nil {
+			log.Printf("Error adding documents to %s: %v", collection, err)
+		}
+		return documents
+	}
+	for _, document := range documents {
+		if v.float16[collection] {
+			document = toHalf(document)
+		}
+		v.collections[collection] = append(v.collections[collection], document)
+	}
+	return documents
+}
+
+// Delete removes the documents matching the given IDs and returns how many were removed.
+func (v *VectorStore) Delete(collection string, ids ...string) int {
+	if file := v.file(collection); file != nil && !v.journal.Journals(collection) {
+		return file.Delete(ids...)
+	}
+	remove := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		remove[id] = struct{}{}
+	}
+	return v.DeleteWhere(collection, func(document Document) bool {
+		_, ok := remove[document.ID]
+		return ok
+	})
+}
+
+// DeleteWhere removes the documents accepted by filter and returns how many were removed.
+func (v *VectorStore) DeleteWhere(collection string, filter func(Document) bool) int {
+	journaled := v.journal.Journals(collection)
+	if file := v.file(collection); file != nil && !journaled {
+		return file.DeleteWhere(filter)
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if file := v.files[collection]; file != nil {
+		if ids := file.IDs(filter); len(ids) > 0 {
+			v.journalChange(collection, vectorJournalRecord{Delete: ids})
+		}
+		return file.DeleteWhere(filter)
+	}
+	documents := v.collections[collection]
+	kept := documents[:0]
+	removed := make([]string, 0)
+	for _, document := range documents {
+		if !filter(document) {
+			kept = append(kept, document)
+		} else if journaled {
+			removed = append(removed, document.ID)
+		}
+	}
+	if len(removed) > 0 {
+		v.journalChange(collection, vectorJournalRecord{Delete: removed})
+	}
+	v.collections[collection] = kept
+	return len(documents) - len(kept)
+}
+
+// Documents returns the documents of a collection accepted by filter (nil accepts all).
+func (v *VectorStore) Documents(collection string, filter func(Document) bool) []Document {
+	if file := v.file(collection); file != nil {
+		return file.Documents(filter)
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	documents := make([]Document, 0)
+	for _, document := range v.collections[collection] {
+		if filter == nil || filter(document) {
+			documents = append(documents, fromHalf(document))
+		}
+	}
+	return documents
+}
+
+func (v *VectorStore) Collections() []string {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	names := make([]string, 0, len(v.collections)+len(v.files))
+	for name := range v.collections {
+		names = append(names, name)
+	}
+	for name := range v.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Search returns the limit documents most similar to the query vector,
+// skipping documents rejected by filter (nil accepts all). A large
+// collection is split into shards searched concurrently, whose best
+// results are merged.
+func (v *VectorStore) Search(collection string, query []float64, limit int, filter func(Document) bool) []SearchResult {
+	config := v.search.Load()
+	if file := v.file(collection); file != nil {
+		return file.Search(query, limit, filter, config)
+	}
+	v.mu.RLock()
+	documents := v.collections[collection]
+	half := newHalfQuery(query)
+	results := searchSharded(config, len(documents), limit, func(start, end int) []SearchResult {
+		return searchShard(documents[start:end], query, half, limit, filter)
+	})
+	v.mu.RUnlock()
+	return results
+}
+
+// searchSharded splits a collection of size documents into shards, runs
+// search over their ranges, concurrently when there are several, and merges
+// their best results.
+func searchSharded(config *SearchConfig, size, limit int, search func(start, end int) []SearchResult) []SearchResult {
+	shards := config.shardCount(size)
+	parts := make([][]SearchResult, shards)
+	if shards == 1 {
+		parts[0] = search(0, size)
+	} else {
+		parallelism := config.Parallelism
+		if parallelism <= 0 {
+			parallelism = shards
+		}
+		workers := make(chan struct{}, parallelism)
+		shardSize := (size + shards - 1) / shards
+		var wg sync.WaitGroup
+		for i := range parts {
+			start, end := min(i*shardSize, size), min((i+1)*shardSize, size)
+			workers <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				parts[i] = search(start, end)
+				<-workers
+			}()
+		}
+		wg.Wait()
+	}
+
+	results := slices.Concat(parts...)
+	if results == nil {
+		results = make([]SearchResult, 0)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Similarity > results[j].Similarity
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// searchShard returns the limit best results of documents, or all of them
+// when limit is not positive, in no particular order. The documents stored
+// in half precision are scored against half.
+func searchShard(documents []Document, query []float64, half halfQuery, limit int, filter func(Document) bool) []SearchResult {
+	results := make(resultHeap, 0)
+	for _, document := range documents {
+		if filter != nil && !filter(document) {
+			continue
+		}
+		var similarity float64
+		if document.half != nil {
+			similarity = half.similarity(document.half)
+		} else {
+			similarity = CosineSimilarity(query, document.Embedding)
+		}
+		if !results.wants(similarity, limit) {
+			continue
+		}
+		results.keep(SearchResult{Document: fromHalf(document), Similarity: similarity}, limit)
+	}
+	return results
+}
+
+// resultHeap keeps the least similar result on top, so it is the one
+// replaced by a better one.
+type resultHeap []SearchResult
+
+func (h resultHeap) Len() int           { return len(h) }
+func (h resultHeap) Less(i, j int) bool { return h[i].Similarity < h[j].Similarity }
+func (h resultHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *resultHeap) Push(x any)        { *h = append(*h, x.(SearchResult)) }
+func (h *resultHeap) Pop() any {
+	old := *h
+	result := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return result
+}
+
+// wants reports whether a result of similarity would be kept among the
+// limit best.
+func (h resultHeap) wants(similarity float64, limit int) bool {
+	return limit <= 0 || len(h) < limit || similarity > h[0].Similarity
+}
+
+// keep adds result when it is among the limit best seen so far, or always
+// when limit is not positive.
+func (h *resultHeap) keep(result SearchResult, limit int) {
+	switch {
+	case limit <= 0:
+		*h = append(*h, result)
+	case len(*h) < limit:
+		heap.Push(h, result)
+	case result.Similarity > (*h)[0].Similarity:
+		(*h)[0] = result
+		heap.Fix(h, 0)
+	}
+}
+
+// Save writes a collection to a JSON file so it survives restarts, with the
+// content encrypted by the cipher of the store. A collection backed by a
+// vector file is flushed to it instead.
+func (v *VectorStore) Save(collection string, path string) error {
+	if file := v.file(collection); file != nil {
+		return file.Sync()
+	}
+	return writeDocuments(path, v.cipher.seal(v.Documents(collection, nil)))
+}
+
+// writeDocuments writes documents to a JSON file, replacing it once the new
+// one is on disk.
+func writeDocuments(path string, documents []Document) error {
+	data, err := json.Marshal(documents)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if err := errors.Join(err, file.Close()); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readDocuments reads a JSON file written by writeDocuments, returning nil
+// when it is missing.
+func readDocuments(path string) ([]Document, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	documents := make([]Document, 0)
+	if err := json.Unmarshal(data, &documents); err != nil {
+		return nil, err
+	}
+	return documents, nil
+}
+
+// Load replaces a collection with the contents of a JSON file written by Save.
+// A missing file leaves the collection empty. A collection backed by a vector
+// file only imports it while the vector file is empty, which moves a JSON
+// collection to a vector file once.
+func (v *VectorStore) Load(collection string, path string) error {
+	file := v.file(collection)
+	if file != nil && file.Len() > 0 {
+		return nil
+	}
+	documents, err := readDocuments(path)
+	if err == nil {
+		err = v.cipher.open(documents)
+	}
+	if err != nil || documents == nil {
+		return err
+	}
+	if file != nil {
+		return file.Append(documents...)
+	}
+	v.mu.Lock()
+	v.collections[collection] = v.stored(collection, documents)
+	v.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,199 @@
+package orus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// MediaVideoFrame is the kind of the records of video frames.
+	MediaVideoFrame          = "video_frame"
+	DefaultVideoInterval     = 10 * time.Second
+	DefaultVideoMaxFrames    = 60
+	DefaultVideoMaxSize      = 200 << 20
+	DefaultVideoCaptionModel = "llama3.2-vision"
+	MaxVideoFrames           = 1000
+	// videoFrameWidth is the widest frame extracted; vision models scale
+	// their images down to less than that.
+	videoFrameWidth = 1024
+)
+
+// ErrUnsupportedVideo is returned for an upload that is not a video.
+var ErrUnsupportedVideo = errors.New("unsupported video, expected MP4, MOV, WebM, MKV or AVI")
+
+// videoExtensions are the containers accepted by name when their content
+// is not sniffed as a video, as for QuickTime and Matroska.
+var videoExtensions = map[string]bool{
+	".mp4": true, ".m4v": true, ".mov": true, ".webm": true, ".mkv": true, ".avi": true,
+}
+
+// showinfoTimePattern reads the time of a frame from the showinfo filter
+// of ffmpeg.
+var showinfoTimePattern = regexp.MustCompile(`pts_time:\s*(-?[0-9.]+)`)
+
+// VideoFrame is a keyframe sampled from a video.
+type VideoFrame struct {
+	// Time is the position of the frame from the start of the video.
+	Time time.Duration
+	// Data is the frame as JPEG.
+	Data []byte
+}
+
+// IsVideo reports whether an upload is a video, by its content or, for
+// the containers that are not sniffed, by its file name.
+func IsVideo(contentType, filename string) bool {
+	return strings.HasPrefix(contentType, "video/") || videoExtensions[strings.ToLower(filepath.Ext(filename))]
+}
+
+// SampleVideoFrames extracts the keyframes of the video at path, one every
+// interval at most and up to maxFrames, with ffmpeg. Only the keyframes
+// are decoded, so a long video is sampled quickly; a video with sparse
+// keyframes gives fewer frames.
+func SampleVideoFrames(ctx context.Context, path string, interval time.Duration, maxFrames int) ([]VideoFrame, error) {
+	if interval <= 0 {
+		interval = DefaultVideoInterval
+	}
+	if maxFrames <= 0 {
+		maxFrames = DefaultVideoMaxFrames
+	}
+	dir, err := os.MkdirTemp("", "orus-frames-*")
+	if err != nil {
+		return nil, fmt.Errorf("error creating frames directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filter := fmt.Sprintf(`select='isnan(prev_selected_t)+gte(t-prev_selected_t\,%.3f)',scale='min(%d\,iw)':-2,showinfo`,
+		interval.Seconds(), videoFrameWidth)
+	_, stderr, err := runCommandStderr(ctx, nil, "ffmpeg", "-hide_banner", "-nostdin",
+		"-skip_frame", "nokey", "-i", path,
+		"-vf", filter, "-fps_mode", "vfr", "-frames:v", strconv.Itoa(maxFrames), "-q:v", "3",
+		filepath.Join(dir, "frame-%04d.jpg"))
+	if err != nil {
+		return nil, err
+	}
+	times := frameTimes(string(stderr))
+	paths, err := filepath.Glob(filepath.Join(dir, "frame-*.jpg"))
+	if err != nil {
+		return nil, err
+	}
+	// the frames are numbered from 1 in their order, as showinfo reports them
+	frames := make([]VideoFrame, 0, len(paths))
+	for n, framePath := range paths {
+		data, err := os.ReadFile(framePath)
+		if err != nil {
+			return nil, fmt.Errorf("error reading frame: %w", err)
+		}
+		frame := VideoFrame{Data: data}
+		if n < len(times) {
+			frame.Time = times[n]
+		}
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+// frameTimes reads the times of the frames written by ffmpeg from the
+// lines of its showinfo filter.
+func frameTimes(output string) []time.Duration {
+	times := make([]time.Duration, 0)
+	for _, line := range strings.Split(output, "\n") {
+		if !strings.Contains(line, "showinfo") {
+			continue
+		}
+		match := showinfoTimePattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		seconds, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			continue
+		}
+		times = append(times, time.Duration(max(seconds, 0)*float64(time.Second)))
+	}
+	return times
+}
+
+// Timecode formats a position in a video as "01:02:03".
+func Timecode(position time.Duration) string {
+	seconds := int(position / time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
+
+// IndexVideo replaces the records of source with the frames of a video,
+// captioned by captionModel. A frame is embedded by the image encoder when
+// model is clip, or else by its caption. Its metadata has its position as
+// timestamp, in seconds, and timecode, so a search can jump to it.
+// progress, when not nil, sees the frames as they are captioned.
+func (i *DocumentIndex) IndexVideo(ctx context.Context, source string, frames []VideoFrame, model, captionModel string, progress func(IngestProgress)) ([]Document, error) {
+	report := ingestReporter(progress)
+	documents := make([]Document, 0, len(frames))
+	report("captioning", 0, len(frames))
+	for n, frame := range frames {
+		caption, err := i.orus.CaptionImage(ctx, captionModel, frame.Data)
+		if err != nil {
+			return nil, err
+		}
+		var vector []float64
+		if model == ClipModel {
+			embedding, err := i.orus.Clip.EmbedImage(frame.Data)
+			if err != nil {
+				return nil, err
+			}
+			vector = Float64s(embedding)
+		} else if vector, err = i.orus.Embed(model, caption); err != nil {
+			return nil, err
+		}
+		document := Document{
+			ID:        uuid.New().String(),
+			Content:   caption,
+			Embedding: vector,
+			Metadata: map[string]interface{}{
+				"source":    source,
+				"chunk":     n,
+				"model":     model,
+				"kind":      MediaVideoFrame,
+				"timestamp": frame.Time.Seconds(),
+				"timecode":  Timecode(frame.Time),
+			},
+		}
+		if i.media != nil {
+			ref, err := i.media.Put(frame.Data)
+			if err != nil {
+				return nil, err
+			}
+			ref.Caption = caption
+			ref.Record = document.ID
+			document.Media = []MediaRef{ref}
+		}
+		documents = append(documents, document)
+		report("captioning", n+1, len(frames))
+	}
+
+	return i.replace(source, documents)
+}
+
+// SearchVideos returns the limit video frames whose captions, or images
+// with clip, are the most similar to query, among the frames of source
+// when it is not empty.
+func (i *DocumentIndex) SearchVideos(query, model, source string, limit int) ([]SearchResult, error) {
+	if limit <= 0 {
+		limit = DefaultRAGLimit
+	}
+	vector, err := i.orus.Embed(model, query)
+	if err != nil {
+		return nil, err
+	}
+	return i.store.Search(i.Collection, vector, limit, func(document Document) bool {
+		return document.Metadata["model"] == model && document.Metadata["kind"] == MediaVideoFrame &&
+			(source == "" || document.Metadata["source"] == source)
+	}), nil
+}
@@ -0,0 +1,73 @@
+package view
+
+import (
+	"net/http"
+)
+
+// ChatMessage is a message bubble of the chat page. Pending marks an
+// assistant message that is still streaming.
+type ChatMessage struct {
+	ID      string
+	Role    string
+	Content string
+	Model   string
+	Pending bool
+}
+
+// SessionLink is an entry of the sessions sidebar.
+type SessionLink struct {
+	ID     string
+	Title  string
+	Active bool
+}
+
+type ChatSignals struct {
+	SessionID string `json:"sessionId"`
+	Message   string `json:"message"`
+	Model     string `json:"model"`
+}
+
+type ChatData struct {
+	Page
+	Heading       string
+	Signals       string
+	Sessions      []SessionLink
+	Messages      []ChatMessage
+	ModelSelector ModelSelector
+}
+
+// RenderChat renders the chat page for the given session, or an empty
+// conversation when sessionID is empty.
+func (v *View) RenderChat(w http.ResponseWriter, sessionID string, title string, model string, sessions []SessionLink, messages []ChatMessage) error {
+	heading := title
+	if heading == "" {
+		heading = "New conversation"
+	}
+	return render(w, "chat", ChatData{
+		Page: Page{
+			Title:   "Orus Chat",
+			Version: Version,
+		},
+		Heading: heading,
+		Signals: signals(ChatSignals{
+			SessionID: sessionID,
+			Model:     model,
+		}),
+		Sessions: sessions,
+		Messages: messages,
+		ModelSelector: ModelSelector{
+			ID:      "chat-model",
+			Label:   "Model",
+			Signal:  "model",
+			Options: modelOptions(v.models, model),
+		},
+	})
+}
+
+func RenderChatMessage(message ChatMessage) (string, error) {
+	return fragment("chat_message", message)
+}
+
+func RenderSessionList(sessions []SessionLink) (string, error) {
+	return fragment("session_list", sessions)
+}
@@ -0,0 +1,67 @@
+package view
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ComparePanes is the number of models that can be compared side by side.
+const ComparePanes = 3
+
+// ComparePane is the streamed output and statistics of one compared model.
+type ComparePane struct {
+	Model            string `json:"model"`
+	Output           string `json:"output"`
+	Status           string `json:"status"`
+	FirstToken       string `json:"firstToken"`
+	Latency          string `json:"latency"`
+	PromptTokens     int    `json:"promptTokens"`
+	CompletionTokens int    `json:"completionTokens"`
+}
+
+type CompareSignals struct {
+	Prompt string                 `json:"prompt"`
+	Models map[string]string      `json:"models"`
+	Panes  map[string]ComparePane `json:"panes"`
+}
+
+// ComparePaneData is the data of one column of the comparison page.
+type ComparePaneData struct {
+	Key           string
+	ModelSelector ModelSelector
+}
+
+type CompareData struct {
+	Page
+	Signals string
+	Panes   []ComparePaneData
+}
+
+// CompareKey returns the signal key of the pane at index i.
+func CompareKey(i int) string {
+	return fmt.Sprintf("p%d", i)
+}
+
+func (v *View) RenderCompare(w http.ResponseWriter, initial CompareSignals) error {
+	panes := make([]ComparePaneData, ComparePanes)
+	for i := range panes {
+		key := CompareKey(i)
+		panes[i] = ComparePaneData{
+			Key: key,
+			ModelSelector: ModelSelector{
+				ID:      "compare-model-" + key,
+				Label:   fmt.Sprintf("Model %d", i+1),
+				Signal:  "models." + key,
+				Options: modelOptions(v.models, initial.Models[key]),
+			},
+		}
+	}
+	return render(w, "compare", CompareData{
+		Page: Page{
+			Title:   "Orus Model Comparison",
+			Version: Version,
+		},
+		Signals: signals(initial),
+		Panes:   panes,
+	})
+}
@@ -0,0 +1,104 @@
+package view
+
+import (
+	"math"
+	"net/http"
+)
+
+var plotPalette = []string{"#34d399", "#60a5fa", "#f472b6", "#fbbf24", "#a78bfa", "#f87171", "#2dd4bf", "#fb923c"}
+
+// EmbeddingPoint is a projected text. X and Y are the raw projection
+// coordinates until NewEmbeddingPlot scales them to the plot area.
+type EmbeddingPoint struct {
+	X     float64
+	Y     float64
+	Text  string
+	Group string
+	Color string
+}
+
+// PlotGroup is a legend entry of the scatter plot.
+type PlotGroup struct {
+	Name  string
+	Color string
+	Count int
+}
+
+// EmbeddingPlot is the data of the scatter plot partial.
+type EmbeddingPlot struct {
+	Source string
+	Points []EmbeddingPoint
+	Groups []PlotGroup
+}
+
+type EmbeddingsSignals struct {
+	Texts      string `json:"texts"`
+	Collection string `json:"collection"`
+	EmbedModel string `json:"embedModel"`
+	Selected   string `json:"selected"`
+}
+
+type EmbeddingsData struct {
+	Page
+	Signals       string
+	EmbedSelector ModelSelector
+	Collections   []ModelOption
+	Plot          EmbeddingPlot
+}
+
+func (v *View) RenderEmbeddings(w http.ResponseWriter, initial EmbeddingsSignals, collections []string) error {
+	options := []ModelOption{{Value: "", Label: "Texts below"}}
+	for _, collection := range collections {
+		options = append(options, ModelOption{Value: collection, Label: collection})
+	}
+	return render(w, "embeddings", EmbeddingsData{
+		Page: Page{
+			Title:   "Orus Embeddings",
+			Version: Version,
+		},
+		Signals: signals(initial),
+		EmbedSelector: ModelSelector{
+			ID:      "embeddings-model",
+			Label:   "Embedding Model",
+			Signal:  "embedModel",
+			Options: modelOptions([]string{"bge-m3", "nomic-embed-text:latest", "ollama-bge-m3"}, initial.EmbedModel),
+		},
+		Collections: options,
+	})
+}
+
+func RenderEmbeddingPlot(plot EmbeddingPlot) (string, error) {
+	return fragment("embedding_plot", plot)
+}
+
+// NewEmbeddingPlot scales the points into the 0-100 plot area, keeping the
+// aspect ratio, and assigns a color per group.
+func NewEmbeddingPlot(source string, points []EmbeddingPoint) EmbeddingPlot {
+	minX, maxX := math.Inf(1), math.Inf(-1)
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for _, point := range points {
+		minX, maxX = math.Min(minX, point.X), math.Max(maxX, point.X)
+		minY, maxY = math.Min(minY, point.Y), math.Max(maxY, point.Y)
+	}
+	span := math.Max(maxX-minX, maxY-minY)
+	if span == 0 || math.IsInf(span, 0) {
+		span = 1
+	}
+
+	plot := EmbeddingPlot{Source: source, Points: make([]EmbeddingPoint, len(points))}
+	groups := make(map[string]int)
+	for i, point := range points {
+		index, ok := groups[point.Group]
+		if !ok {
+			index = len(plot.Groups)
+			groups[point.Group] = index
+			plot.Groups = append(plot.Groups, PlotGroup{Name: point.Group, Color: plotPalette[index%len(plotPalette)]})
+		}
+		plot.Groups[index].Count++
+		point.Color = plot.Groups[index].Color
+		point.X = 5 + 90*(point.X-minX)/span
+		point.Y = 95 - 90*(point.Y-minY)/span
+		plot.Points[i] = point
+	}
+	return plot
+}
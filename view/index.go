@@ -1,44 +1,75 @@
 package view
 
 import (
-	_ "embed"
-	"fmt"
 	"net/http"
 )
 
-//go:embed index.html
-var indexHTML string
-
-type View struct {
-   models []string
-   optionsHtml string
+type IndexSignals struct {
+	Prompt        string   `json:"prompt"`
+	Model         string   `json:"model"`
+	OperationType string   `json:"operationType"`
+	ResponseMode  string   `json:"responseMode"`
+	Temperature   float64  `json:"temperature"`
+	Theme         string   `json:"theme"`
+	Think         bool     `json:"think"`
+	Thinking      string   `json:"thinking"`
+	Result        string   `json:"result"`
+	Images        []string `json:"images"`
+	ImageError    string   `json:"imageError"`
+	PageSession   string   `json:"pageSession"`
 }
 
-func NewView() *View {
-	return &View{
-		models: []string{},
-	}
+// ImageLimits are the attachment limits enforced by the server, repeated
+// client-side so oversized or unsupported images are rejected before upload.
+type ImageLimits struct {
+	MaxSize  int
+	MaxCount int
+	Types    []string
 }
 
-func (v *View) SetModels(models []string) *View {
-	v.models = models
-	return v
+type IndexData struct {
+	Page
+	Images        ImageLimits
+	Signals       string
+	ModelSelector ModelSelector
+	ResultPane    ResultPane
+	ThinkingPane  ResultPane
 }
 
-func (v *View) renderOptions() *View {
-	optionsHtml := ""
-	optionsHtml += "<option class='bg-white' value=''>Select a model</option>"
-	optionsHtml += "<option class='bg-white' value='bge-m3'>bge-m3</option>"
-	for _, model := range v.models {
-		optionsHtml += fmt.Sprintf("<option class='bg-white' value='%s'>%s</option>", model, model)
+func (v *View) RenderIndex(w http.ResponseWriter, preferences Preferences, images ImageLimits) error {
+	initial := IndexSignals{
+		Model:         preferences.Model,
+		OperationType: "qa-llm",
+		ResponseMode:  "stream",
+		Temperature:   preferences.Temperature,
+		Theme:         preferences.Theme,
+		Images:        []string{},
 	}
-	v.optionsHtml = optionsHtml
-	return v
+	if !preferences.Streaming {
+		initial.ResponseMode = "single"
+	}
+	return render(w, "index", IndexData{
+		Page: Page{
+			Title:   "Orus Prompt Console",
+			Version: Version,
+			Theme:   preferences.Theme,
+		},
+		Images:  images,
+		Signals: signals(initial),
+		ModelSelector: ModelSelector{
+			ID:      "llm-model",
+			Label:   "LLM Model",
+			Signal:  "model",
+			Options: modelOptions(append([]string{"bge-m3"}, v.models...), initial.Model),
+		},
+		ResultPane: ResultPane{
+			Label:   "Result (Markdown)",
+			Caption: "Orus API - LLM Prompt Console " + Version,
+			Signal:  "result",
+		},
+		ThinkingPane: ResultPane{
+			Label:  "Reasoning",
+			Signal: "thinking",
+		},
+	})
 }
-
-func (v *View) RenderIndex(w http.ResponseWriter) {
-	v.renderOptions()
-	codeHtml := fmt.Sprintf(indexHTML, v.optionsHtml)
-	w.Header().Set("Content-Type", "text/html")
-	w.Write([]byte(codeHtml))
-}
\ No newline at end of file
@@ -0,0 +1,23 @@
+package view
+
+import "net/http"
+
+type LoginData struct {
+	Page
+	// Next is the page to return to once signed in.
+	Next  string
+	Error string
+}
+
+// RenderLogin renders the sign in of the playground, which asks for an API
+// key when the server requires one.
+func (v *View) RenderLogin(w http.ResponseWriter, next, message string) error {
+	return render(w, "login", LoginData{
+		Page: Page{
+			Title:   "Orus Sign In",
+			Version: Version,
+		},
+		Next:  next,
+		Error: message,
+	})
+}
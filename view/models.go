@@ -0,0 +1,71 @@
+package view
+
+import (
+	"net/http"
+	"time"
+)
+
+// InstalledModel is a row of the installed models table.
+type InstalledModel struct {
+	Name              string
+	Size              int64
+	Digest            string
+	ModifiedAt        time.Time
+	Family            string
+	ParameterSize     string
+	QuantizationLevel string
+}
+
+// PullLayer is the download progress of one layer of a model being pulled.
+type PullLayer struct {
+	Digest    string
+	Total     int64
+	Completed int64
+}
+
+// PullProgress is the data of the pull progress partial.
+type PullProgress struct {
+	Model  string
+	Status string
+	Done   bool
+	Layers []PullLayer
+}
+
+type ModelsSignals struct {
+	PullModel   string `json:"pullModel"`
+	DeleteModel string `json:"deleteModel"`
+}
+
+type ModelsData struct {
+	Page
+	Signals string
+	Models  []InstalledModel
+	Pull    PullProgress
+}
+
+func (v *View) RenderModels(w http.ResponseWriter, models []InstalledModel) error {
+	return render(w, "models", ModelsData{
+		Page: Page{
+			Title:   "Orus Models",
+			Version: Version,
+		},
+		Signals: signals(ModelsSignals{}),
+		Models:  models,
+	})
+}
+
+func RenderModelList(models []InstalledModel) (string, error) {
+	return fragment("model_list", models)
+}
+
+func RenderPullProgress(progress PullProgress) (string, error) {
+	return fragment("pull_progress", progress)
+}
+
+// Ratio returns the completed share of the layer between 0 and 1.
+func (l PullLayer) Ratio() float64 {
+	if l.Total <= 0 {
+		return 0
+	}
+	return float64(l.Completed) / float64(l.Total)
+}
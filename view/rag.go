@@ -0,0 +1,94 @@
+package view
+
+import (
+	"net/http"
+)
+
+// RAGChunk is an indexed chunk, or a retrieved one when Similarity is set.
+type RAGChunk struct {
+	ID         string
+	Source     string
+	Number     int
+	Content    string
+	Similarity float64
+}
+
+// RAGSource is an indexed document listed in the playground.
+type RAGSource struct {
+	Source string
+	Model  string
+	Chunks int
+}
+
+// RAGChunks is the data of the indexed chunks partial.
+type RAGChunks struct {
+	Sources []RAGSource
+	Source  string
+	Chunks  []RAGChunk
+}
+
+type RAGSignals struct {
+	Source       string `json:"source"`
+	Document     string `json:"document"`
+	ChunkSize    int    `json:"chunkSize"`
+	ChunkOverlap int    `json:"chunkOverlap"`
+	EmbedModel   string `json:"embedModel"`
+	Question     string `json:"question"`
+	Limit        int    `json:"limit"`
+	Model        string `json:"model"`
+	// WebSearch adds web results to the retrieved chunks.
+	WebSearch bool   `json:"webSearch"`
+	Answer    string `json:"answer"`
+}
+
+type RAGData struct {
+	Page
+	Signals       string
+	EmbedSelector ModelSelector
+	ModelSelector ModelSelector
+	Indexed       RAGChunks
+	Retrieved     []RAGChunk
+	ResultPane    ResultPane
+	// WebSearch shows the web search toggle when a provider is configured.
+	WebSearch bool
+}
+
+// RenderRAG renders the playground; webSearch offers to add web results to
+// the retrieved chunks.
+func (v *View) RenderRAG(w http.ResponseWriter, initial RAGSignals, indexed RAGChunks, webSearch bool) error {
+	return render(w, "rag", RAGData{
+		Page: Page{
+			Title:   "Orus RAG Playground",
+			Version: Version,
+		},
+		Signals: signals(initial),
+		EmbedSelector: ModelSelector{
+			ID:      "rag-embed-model",
+			Label:   "Embedding Model",
+			Signal:  "embedModel",
+			Options: modelOptions([]string{"bge-m3", "nomic-embed-text:latest", "ollama-bge-m3"}, initial.EmbedModel),
+		},
+		ModelSelector: ModelSelector{
+			ID:      "rag-model",
+			Label:   "LLM Model",
+			Signal:  "model",
+			Options: modelOptions(v.models, initial.Model),
+		},
+		Indexed:   indexed,
+		Retrieved: []RAGChunk{},
+		WebSearch: webSearch,
+		ResultPane: ResultPane{
+			Label:   "Answer",
+			Caption: "Orus API - RAG Playground " + Version,
+			Signal:  "answer",
+		},
+	})
+}
+
+func RenderRAGChunks(indexed RAGChunks) (string, error) {
+	return fragment("rag_chunks", indexed)
+}
+
+func RenderRAGRetrieved(retrieved []RAGChunk) (string, error) {
+	return fragment("rag_retrieved", retrieved)
+}
@@ -0,0 +1,202 @@
+package view
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+//go:embed templates
+var templatesFS embed.FS
+
+const Version = "v1.0.5"
+
+var funcs = template.FuncMap{
+	"inc": func(i int) int {
+		return i + 1
+	},
+	"percent": func(value float64) int {
+		return int(math.Round(math.Max(0, math.Min(1, value)) * 100))
+	},
+	"bytes": func(size int64) string {
+		const unit = 1024
+		if size < unit {
+			return fmt.Sprintf("%d B", size)
+		}
+		div, exp := int64(unit), 0
+		for n := size / unit; n >= unit; n /= unit {
+			div *= unit
+			exp++
+		}
+		return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+	},
+	"short": func(digest string) string {
+		digest = strings.TrimPrefix(digest, "sha256:")
+		if len(digest) > 12 {
+			return digest[:12]
+		}
+		return digest
+	},
+}
+
+var (
+	pagesMu sync.Mutex
+	pages   = make(map[string]*template.Template)
+)
+
+// Page is the data shared by every page rendered inside the base layout.
+type Page struct {
+	Title   string
+	Version string
+	Theme   string
+}
+
+// Preferences are the saved UI settings used to seed the initial signals.
+type Preferences struct {
+	Model       string
+	Temperature float64
+	Theme       string
+	Streaming   bool
+}
+
+// DefaultPreferences are used until a user saves their own.
+func DefaultPreferences() Preferences {
+	return Preferences{
+		Model:       "llama3.1:8b",
+		Temperature: 0.8,
+		Theme:       "light",
+		Streaming:   true,
+	}
+}
+
+// ModelOption is a single entry of the model selector partial.
+type ModelOption struct {
+	Value    string
+	Label    string
+	Selected bool
+}
+
+// ModelSelector is the data of the model selector partial.
+type ModelSelector struct {
+	ID      string
+	Label   string
+	Signal  string
+	Options []ModelOption
+}
+
+// ResultPane is the data of the result pane partial.
+type ResultPane struct {
+	Label   string
+	Caption string
+	Signal  string
+}
+
+type View struct {
+	models []string
+}
+
+func NewView() *View {
+	return &View{
+		models: []string{},
+	}
+}
+
+func (v *View) SetModels(models []string) *View {
+	v.models = models
+	return v
+}
+
+// page returns the template set made of the layout, every partial and the
+// named page, parsing it on first use.
+func page(name string) (*template.Template, error) {
+	pagesMu.Lock()
+	defer pagesMu.Unlock()
+	if tmpl, ok := pages[name]; ok {
+		return tmpl, nil
+	}
+	tmpl, err := template.New(name).Funcs(funcs).ParseFS(templatesFS,
+		"templates/layout.html",
+		"templates/partials/*.html",
+		"templates/"+name+".html",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing page %s: %w", name, err)
+	}
+	pages[name] = tmpl
+	return tmpl, nil
+}
+
+// render executes the named page inside the base layout. The output is
+// buffered so a template error never leaves a half-written page behind.
+func render(w http.ResponseWriter, name string, data any) error {
+	tmpl, err := page(name)
+	if err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	if err := tmpl.ExecuteTemplate(buf, "layout", data); err != nil {
+		return fmt.Errorf("error rendering page %s: %w", name, err)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// partials returns the template set holding only the partials, used to
+// render fragments patched into an already loaded page.
+func partials() (*template.Template, error) {
+	pagesMu.Lock()
+	defer pagesMu.Unlock()
+	if tmpl, ok := pages["partials"]; ok {
+		return tmpl, nil
+	}
+	tmpl, err := template.New("partials").Funcs(funcs).ParseFS(templatesFS, "templates/partials/*.html")
+	if err != nil {
+		return nil, fmt.Errorf("error parsing partials: %w", err)
+	}
+	pages["partials"] = tmpl
+	return tmpl, nil
+}
+
+// fragment renders a single partial to a string.
+func fragment(name string, data any) (string, error) {
+	tmpl, err := partials()
+	if err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	if err := tmpl.ExecuteTemplate(buf, name, data); err != nil {
+		return "", fmt.Errorf("error rendering partial %s: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+// signals encodes the initial datastar signals of a page.
+func signals(value any) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
+// modelOptions builds the selector entries for the given models, preceded by
+// the placeholder.
+func modelOptions(models []string, selected string) []ModelOption {
+	options := []ModelOption{
+		{Value: "", Label: "Select a model"},
+	}
+	for _, model := range models {
+		options = append(options, ModelOption{Value: model, Label: model})
+	}
+	for i := range options {
+		options[i].Selected = options[i].Value == selected
+	}
+	return options
+}
@@ -0,0 +1,139 @@
+package orus
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Dsouza10082/orus/ollama"
+)
+
+const (
+	// DefaultWatchdogRepeats is how many times the end of a streaming reply
+	// may appear in its recent text before the generation is aborted.
+	DefaultWatchdogRepeats = 10
+	// DefaultWatchdogWindow is the recent text, in bytes, searched for
+	// repetitions.
+	DefaultWatchdogWindow = 4096
+
+	// watchdogTail is the length of the end of the reply looked for in the
+	// window.
+	watchdogTail = 64
+)
+
+// Abort reasons of a generation stopped by the watchdog.
+const (
+	AbortMaxTokens  = "max_tokens"
+	AbortRepetition = "repetition"
+)
+
+// GenerationAborted is why the watchdog stopped a generation. It is the
+// payload of the aborted event.
+type GenerationAborted struct {
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+	// Tokens are the chunks generated before the abort.
+	Tokens int `json:"tokens"`
+	// Repeated is the text found looping, for a repetition.
+	Repeated string `json:"repeated,omitempty"`
+}
+
+func (a *GenerationAborted) Error() string {
+	return a.Message
+}
+
+// Watchdog follows a streaming generation and cancels it when it runs over
+// its token budget or keeps repeating itself, as small local models
+// sometimes do. It is not safe for concurrent use.
+type Watchdog struct {
+	config  WatchdogConfig
+	cancel  context.CancelCauseFunc
+	tokens  int
+	recent  []byte
+	aborted *GenerationAborted
+}
+
+// NewWatchdog returns a watchdog for the generation run with the returned
+// context, which it cancels to abort it.
+func NewWatchdog(ctx context.Context, config WatchdogConfig) (*Watchdog, context.Context) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	return &Watchdog{config: config, cancel: cancel}, ctx
+}
+
+// Observe checks a chunk of the generation.
+func (w *Watchdog) Observe(chunk ollama.ChatStreamResponse) {
+	if w.aborted != nil {
+		return
+	}
+	text := chunk.Message.Thinking + chunk.Message.Content
+	if text == "" {
+		return
+	}
+	w.tokens++
+	if w.overBudget() {
+		return
+	}
+	if w.config.Repeats <= 0 {
+		return
+	}
+	w.recent = append(w.recent, text...)
+	if len(w.recent) > w.config.Window {
+		w.recent = append(w.recent[:0], w.recent[len(w.recent)-w.config.Window:]...)
+	}
+	if len(w.recent) < watchdogTail*w.config.Repeats {
+		return
+	}
+	tail := string(w.recent[len(w.recent)-watchdogTail:])
+	if strings.TrimSpace(tail) == "" {
+		return
+	}
+	if strings.Count(string(w.recent), tail) >= w.config.Repeats {
+		w.abort(&GenerationAborted{
+			Reason:   AbortRepetition,
+			Message:  fmt.Sprintf("the generation was aborted: it repeated itself %d times", w.config.Repeats),
+			Tokens:   w.tokens,
+			Repeated: strings.ToValidUTF8(tail, ""),
+		})
+	}
+}
+
+// ObserveLine counts an undecoded chunk of a passthrough stream against the
+// token budget. Repetitions are not watched, as the text is not decoded.
+func (w *Watchdog) ObserveLine() error {
+	if w.aborted != nil {
+		return w.aborted
+	}
+	w.tokens++
+	if w.overBudget() {
+		return w.aborted
+	}
+	return nil
+}
+
+func (w *Watchdog) overBudget() bool {
+	if w.config.MaxTokens <= 0 || w.tokens <= w.config.MaxTokens {
+		return false
+	}
+	w.abort(&GenerationAborted{
+		Reason:  AbortMaxTokens,
+		Message: fmt.Sprintf("the generation was aborted: it went over the budget of %d tokens", w.config.MaxTokens),
+		Tokens:  w.tokens,
+	})
+	return true
+}
+
+func (w *Watchdog) abort(aborted *GenerationAborted) {
+	w.aborted = aborted
+	w.cancel(aborted)
+}
+
+// Aborted returns why the watchdog stopped the generation, or nil when it
+// did not.
+func (w *Watchdog) Aborted() *GenerationAborted {
+	return w.aborted
+}
+
+// Stop releases the context of the watchdog.
+func (w *Watchdog) Stop() {
+	w.cancel(nil)
+}
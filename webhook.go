@@ -0,0 +1,205 @@
+package orus
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultWebhookTimeout = 10 * time.Second
+	DefaultWebhookRetries = 3
+	// maxWebhookBackoff bounds the wait between two deliveries of a payload.
+	maxWebhookBackoff = time.Minute
+)
+
+// The events of the webhook payloads.
+const (
+	WebhookJobCompleted = "job.completed"
+	WebhookJobFailed    = "job.failed"
+	// WebhookJobRunning is the state of a job not finished yet; it is never
+	// posted.
+	WebhookJobRunning = "job.running"
+)
+
+// The headers of a webhook delivery. The signature is "sha256=" and the hex
+// HMAC-SHA256, keyed with the webhook secret, of the timestamp, a dot and
+// the body.
+const (
+	WebhookEventHeader     = "X-Orus-Event"
+	WebhookJobHeader       = "X-Orus-Job"
+	WebhookTimestampHeader = "X-Orus-Timestamp"
+	WebhookSignatureHeader = "X-Orus-Signature"
+)
+
+type WebhookConfig struct {
+	// Secret signs the payloads; empty disables the webhooks.
+	Secret Secret `yaml:"secret"`
+	// Timeout bounds each delivery.
+	Timeout time.Duration `yaml:"timeout"`
+	// Retries is how many times a failed delivery is tried again, waiting
+	// 1s, 2s, 4s... in between.
+	Retries int `yaml:"retries"`
+	// Hosts are the hosts callbacks may be sent to; empty allows any.
+	Hosts []string `yaml:"hosts"`
+}
+
+// WebhookPayload is posted to the callback URL of a job once it completes
+// or fails.
+type WebhookPayload struct {
+	// ID is the job ID returned when the job was accepted.
+	ID    string `json:"id" swaggertype:"string" example:"8b1f4c2e-..."`
+	Event string `json:"event" swaggertype:"string" example:"job.completed"`
+	// Route is the route the job ran, such as /orus-api/v1/ollama-pull-model.
+	Route     string `json:"route" swaggertype:"string" example:"/orus-api/v1/ollama-pull-model"`
+	RequestID string `json:"request_id,omitempty" swaggertype:"string"`
+	// Status is the HTTP status the route answered with.
+	Status int `json:"status" swaggertype:"integer" example:"200"`
+	// Result is the response of the route: its JSON body, or the payload of
+	// the last event of a streaming route.
+	Result     json.RawMessage `json:"result,omitempty" swaggertype:"object"`
+	StartedAt  time.Time       `json:"started_at" swaggertype:"string" example:"2021-01-01T00:00:00Z"`
+	FinishedAt time.Time       `json:"finished_at" swaggertype:"string" example:"2021-01-01T00:20:00Z"`
+}
+
+// Webhooks post the signed payloads of the jobs run in the background to
+// their callback URL.
+type Webhooks struct {
+	config WebhookConfig
+	client *http.Client
+	jobs   JobStore
+}
+
+// NewWebhooks returns the webhooks of config, or nil when it has no secret.
+func NewWebhooks(config WebhookConfig) *Webhooks {
+	if config.Secret == "" {
+		return nil
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultWebhookTimeout
+	}
+	return &Webhooks{config: config, client: &http.Client{Timeout: config.Timeout}, jobs: NewMemoryJobStore()}
+}
+
+// SetJobs keeps the state of the jobs in store instead of memory.
+func (h *Webhooks) SetJobs(store JobStore) *Webhooks {
+	if h != nil {
+		h.jobs = store
+	}
+	return h
+}
+
+// SaveJob keeps the state of the job of payload.
+func (h *Webhooks) SaveJob(payload WebhookPayload) error {
+	return h.jobs.Save(payload)
+}
+
+// Job returns the last state of the job id, or ErrJobNotFound.
+func (h *Webhooks) Job(id string) (*WebhookPayload, error) {
+	return h.jobs.Get(id)
+}
+
+// CheckCallback returns an error unless callbackURL is an absolute http or
+// https URL to one of the allowed hosts.
+func (h *Webhooks) CheckCallback(callbackURL string) error {
+	parsed, err := url.Parse(callbackURL)
+	if err != nil {
+		return fmt.Errorf("invalid callback URL: %w", err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("callback URL %q must be an absolute http or https URL", callbackURL)
+	}
+	if len(h.config.Hosts) > 0 && !slices.Contains(h.config.Hosts, parsed.Hostname()) {
+		return fmt.Errorf("callback host %q is not allowed", parsed.Hostname())
+	}
+	return nil
+}
+
+// Deliver posts payload to callbackURL, trying again on network errors and
+// on 408, 429 and 5xx answers.
+func (h *Webhooks) Deliver(ctx context.Context, callbackURL string, payload WebhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error encoding webhook payload: %w", err)
+	}
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		retry, err := h.post(ctx, callbackURL, payload, body)
+		if err == nil || !retry || attempt >= h.config.Retries {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+		backoff = min(2*backoff, maxWebhookBackoff)
+	}
+}
+
+// post delivers body once, and reports whether a failure is worth another
+// try.
+func (h *Webhooks) post(ctx context.Context, callbackURL string, payload WebhookPayload, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("error creating webhook request: %w", err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Orus-Webhook")
+	req.Header.Set(WebhookEventHeader, payload.Event)
+	req.Header.Set(WebhookJobHeader, payload.ID)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(h.config.Secret.Reveal(), timestamp, body))
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("error delivering webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("webhook answered with status %d", resp.StatusCode)
+}
+
+// SignWebhook returns the signature header of a payload body sent at
+// timestamp, in Unix seconds.
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook reports whether signature is the one of body sent at
+// timestamp, and timestamp is within tolerance of now, for the receivers of
+// the webhooks to reject forged and replayed payloads. A zero tolerance does
+// not check the timestamp.
+func VerifyWebhook(secret, timestamp, signature string, body []byte, tolerance time.Duration) bool {
+	if tolerance > 0 {
+		seconds, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return false
+		}
+		age := time.Since(time.Unix(seconds, 0))
+		if age > tolerance || age < -tolerance {
+			return false
+		}
+	}
+	expected := SignWebhook(secret, timestamp, body)
+	return hmac.Equal([]byte(expected), []byte(strings.TrimSpace(signature)))
+}
@@ -0,0 +1,307 @@
+package orus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultWebResults is how many results a web search returns.
+	DefaultWebResults = 5
+	// DefaultWebSearchTimeout bounds a web search.
+	DefaultWebSearchTimeout = 10 * time.Second
+	// WebCollection holds the web results of a RAG question while they are
+	// ranked with the document chunks; they are removed after the question.
+	WebCollection = "web_search"
+
+	braveSearchURL  = "https://api.search.brave.com/res/v1/web/search"
+	tavilySearchURL = "https://api.tavily.com/search"
+)
+
+var htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// WebResult is a result of a web search.
+type WebResult struct {
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	Snippet string `json:"snippet"`
+}
+
+// WebSearcher searches the web.
+type WebSearcher interface {
+	Search(ctx context.Context, query string, limit int) ([]WebResult, error)
+}
+
+// LoadWebSearcher returns the searcher of the provider of config. It returns
+// nil when web search is off.
+func LoadWebSearcher(config WebSearchConfig) (WebSearcher, error) {
+	client := &http.Client{Timeout: config.Timeout}
+	switch config.Provider {
+	case "":
+		return nil, nil
+	case "searxng":
+		if config.URL == "" {
+			return nil, fmt.Errorf("the searxng provider requires a url")
+		}
+		return &SearxNGSearcher{url: strings.TrimSuffix(config.URL, "/") + "/search", client: client}, nil
+	case "brave":
+		searcher := &BraveSearcher{url: braveSearchURL, apiKey: config.APIKey, client: client}
+		if config.URL != "" {
+			searcher.url = config.URL
+		}
+		return searcher, nil
+	case "tavily":
+		searcher := &TavilySearcher{url: tavilySearchURL, apiKey: config.APIKey, client: client}
+		if config.URL != "" {
+			searcher.url = config.URL
+		}
+		return searcher, nil
+	default:
+		return nil, fmt.Errorf("unknown web search provider %q, expected searxng, brave or tavily", config.Provider)
+	}
+}
+
+// SearxNGSearcher searches with the JSON API of a SearxNG instance, which
+// must have the json format enabled.
+type SearxNGSearcher struct {
+	url    string
+	client *http.Client
+}
+
+func (s *SearxNGSearcher) Search(ctx context.Context, query string, limit int) ([]WebResult, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url+"?"+url.Values{"q": {query}, "format": {"json"}}.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	var answer struct {
+		Results []struct {
+			Title   string `json:"title"`
+			URL     string `json:"url"`
+			Content string `json:"content"`
+		} `json:"results"`
+	}
+	if err := doWebSearch(s.client, request, &answer); err != nil {
+		return nil, err
+	}
+	results := make([]WebResult, 0, limit)
+	for _, result := range answer.Results {
+		if len(results) == limit {
+			break
+		}
+		results = append(results, newWebResult(result.Title, result.URL, result.Content))
+	}
+	return results, nil
+}
+
+// BraveSearcher searches with the Brave Search API.
+type BraveSearcher struct {
+	url    string
+	apiKey Secret
+	client *http.Client
+}
+
+func (s *BraveSearcher) Search(ctx context.Context, query string, limit int) ([]WebResult, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url+"?"+url.Values{"q": {query}, "count": {fmt.Sprint(limit)}}.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("X-Subscription-Token", s.apiKey.Reveal())
+	var answer struct {
+		Web struct {
+			Results []struct {
+				Title       string `json:"title"`
+				URL         string `json:"url"`
+				Description string `json:"description"`
+			} `json:"results"`
+		} `json:"web"`
+	}
+	if err := doWebSearch(s.client, request, &answer); err != nil {
+		return nil, err
+	}
+	results := make([]WebResult, 0, limit)
+	for _, result := range answer.Web.Results {
+		if len(results) == limit {
+			break
+		}
+		results = append(results, newWebResult(result.Title, result.URL, result.Description))
+	}
+	return results, nil
+}
+
+// TavilySearcher searches with the Tavily API.
+type TavilySearcher struct {
+	url    string
+	apiKey Secret
+	client *http.Client
+}
+
+func (s *TavilySearcher) Search(ctx context.Context, query string, limit int) ([]WebResult, error) {
+	body, err := json.Marshal(map[string]interface{}{"query": query, "max_results": limit})
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Bearer "+s.apiKey.Reveal())
+	var answer struct {
+		Results []struct {
+			Title   string `json:"title"`
+			URL     string `json:"url"`
+			Content string `json:"content"`
+		} `json:"results"`
+	}
+	if err := doWebSearch(s.client, request, &answer); err != nil {
+		return nil, err
+	}
+	results := make([]WebResult, 0, limit)
+	for _, result := range answer.Results {
+		if len(results) == limit {
+			break
+		}
+		results = append(results, newWebResult(result.Title, result.URL, result.Content))
+	}
+	return results, nil
+}
+
+func doWebSearch(client *http.Client, request *http.Request, answer interface{}) error {
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("error searching the web: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return fmt.Errorf("web search answered status %d: %s", response.StatusCode, body)
+	}
+	if err := json.NewDecoder(response.Body).Decode(answer); err != nil {
+		return fmt.Errorf("error decoding web search results: %w", err)
+	}
+	return nil
+}
+
+// newWebResult strips the highlighting markup some engines put in titles
+// and snippets.
+func newWebResult(title, link, snippet string) WebResult {
+	clean := func(text string) string {
+		return strings.Join(strings.Fields(html.UnescapeString(htmlTagPattern.ReplaceAllString(text, ""))), " ")
+	}
+	return WebResult{Title: clean(title), URL: link, Snippet: clean(snippet)}
+}
+
+// Content is the text of the result given to the model.
+func (r WebResult) Content() string {
+	return r.Title + "\n" + r.Snippet
+}
+
+// webSearchTool lets the model search the web for what it does not know.
+func webSearchTool(searcher WebSearcher, results int) Tool {
+	return Tool{
+		Name:        "web_search",
+		Description: "Searches the web and returns the title, URL and snippet of the top results. Use it for recent events or facts you are not sure about.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"query": map[string]interface{}{
+					"type":        "string",
+					"description": "The search query",
+					"minLength":   1.0,
+				},
+			},
+			"required": []interface{}{"query"},
+		},
+		Run: func(ctx context.Context, arguments map[string]interface{}) (string, error) {
+			query, _ := arguments["query"].(string)
+			found, err := searcher.Search(ctx, query, results)
+			if err != nil {
+				return "", err
+			}
+			if len(found) == 0 {
+				return "No results.", nil
+			}
+			sb := &strings.Builder{}
+			for n, result := range found {
+				fmt.Fprintf(sb, "[%d] %s\n%s\n%s\n\n", n+1, result.Title, result.URL, result.Snippet)
+			}
+			return strings.TrimSpace(sb.String()), nil
+		},
+	}
+}
+
+// RetrieveWithWeb returns the chunks Retrieve finds for query together with
+// web results for it, sourced by their URL. With index, the results are
+// embedded with model into WebCollection and the limit most similar among
+// chunks and results are kept; the results are removed again before it
+// returns. Otherwise the results follow the chunks, without a similarity.
+func (i *DocumentIndex) RetrieveWithWeb(ctx context.Context, searcher WebSearcher, query, model string, limit, webResults int, index bool) ([]SearchResult, error) {
+	if limit <= 0 {
+		limit = DefaultRAGLimit
+	}
+	results, err := i.Retrieve(query, model, limit)
+	if err != nil {
+		return nil, err
+	}
+	found, err := searcher.Search(ctx, query, webResults)
+	if err != nil {
+		return nil, err
+	}
+	if !index {
+		for _, result := range found {
+			results = append(results, SearchResult{Document: webDocument(result, "")})
+		}
+		return results, nil
+	}
+
+	batch := uuid.New().String()
+	documents := make([]Document, 0, len(found))
+	for _, result := range found {
+		document := webDocument(result, batch)
+		vector, err := i.orus.Embed(model, document.Content)
+		if err != nil {
+			return nil, err
+		}
+		document.Embedding = vector
+		documents = append(documents, document)
+	}
+	i.store.Add(WebCollection, documents...)
+	defer i.store.DeleteWhere(WebCollection, func(document Document) bool {
+		return document.Metadata["batch"] == batch
+	})
+	vector, err := i.orus.Embed(model, query)
+	if err != nil {
+		return nil, err
+	}
+	results = append(results, i.store.Search(WebCollection, vector, limit, func(document Document) bool {
+		return document.Metadata["batch"] == batch
+	})...)
+	sort.SliceStable(results, func(a, b int) bool {
+		return results[a].Similarity > results[b].Similarity
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func webDocument(result WebResult, batch string) Document {
+	metadata := map[string]interface{}{"source": result.URL, "chunk": 0, "web": true}
+	if batch != "" {
+		metadata["batch"] = batch
+	}
+	return Document{Content: result.Content(), Metadata: metadata}
+}
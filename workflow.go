@@ -0,0 +1,520 @@
+package orus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Dsouza10082/orus/ollama"
+	"go.yaml.in/yaml/v3"
+)
+
+// Workflow step types.
+const (
+	StepRetrieve = "retrieve"
+	StepPrompt   = "prompt"
+	StepTool     = "tool"
+	StepValidate = "validate"
+)
+
+// Workflow step statuses, as reported in the step events.
+const (
+	StepStarted = "started"
+	StepDone    = "done"
+	StepFailed  = "failed"
+)
+
+// ErrWorkflowFailed is returned when a step of a workflow still fails after
+// its retries.
+var ErrWorkflowFailed = errors.New("workflow step failed")
+
+// Workflow chains steps whose outputs are variables of the steps that
+// follow. Text fields of the steps are Go templates over the variables:
+// the inputs of the run and the outputs of the steps so far, by step ID,
+// e.g. {{.question}} or {{.facts.city}} for a step with a JSON output.
+type Workflow struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description" json:"description,omitempty"`
+	// Inputs are the variables every run must be given.
+	Inputs []string       `yaml:"inputs" json:"inputs"`
+	Steps  []WorkflowStep `yaml:"steps" json:"steps"`
+	// Output is the template of the result; empty is the output of the last
+	// step.
+	Output string `yaml:"output" json:"output,omitempty"`
+
+	output *template.Template
+}
+
+// WorkflowStep is a step of a workflow. Which fields apply depends on Type.
+type WorkflowStep struct {
+	// ID names the variable the output of the step is stored in.
+	ID   string `yaml:"id" json:"id"`
+	Type string `yaml:"type" json:"type"`
+	// Retries is how many times a failed step is run again before the run
+	// fails.
+	Retries int `yaml:"retries" json:"retries,omitempty"`
+
+	// Query, EmbedModel and Limit retrieve the indexed chunks closest to
+	// Query; the output is the numbered passages.
+	Query      string `yaml:"query" json:"query,omitempty"`
+	EmbedModel string `yaml:"embed_model" json:"embed_model,omitempty"`
+	Limit      int    `yaml:"limit" json:"limit,omitempty"`
+
+	// Model is sent System and Prompt; the output is the answer, decoded
+	// when Format is "json" or a JSON Schema. Cloud uses Ollama Cloud.
+	Model  string      `yaml:"model" json:"model,omitempty"`
+	System string      `yaml:"system" json:"system,omitempty"`
+	Prompt string      `yaml:"prompt" json:"prompt,omitempty"`
+	Format interface{} `yaml:"format" json:"format,omitempty"`
+	Cloud  bool        `yaml:"cloud" json:"cloud,omitempty"`
+
+	// Tool is run with Arguments, whose string values are templates; the
+	// output is the result.
+	Tool      string                 `yaml:"tool" json:"tool,omitempty"`
+	Arguments map[string]interface{} `yaml:"arguments" json:"arguments,omitempty"`
+
+	// Value is checked against Schema (as JSON) and Pattern; the output is
+	// Value. When the check fails and retries are left, the run goes back
+	// to the RetryFrom step, such as the prompt that produced Value.
+	Value     string                 `yaml:"value" json:"value,omitempty"`
+	Schema    map[string]interface{} `yaml:"schema" json:"schema,omitempty"`
+	Pattern   string                 `yaml:"pattern" json:"pattern,omitempty"`
+	RetryFrom string                 `yaml:"retry_from" json:"retry_from,omitempty"`
+
+	templates map[string]*template.Template
+	pattern   *regexp.Regexp
+}
+
+// WorkflowEvent reports the progress of a step of a run.
+type WorkflowEvent struct {
+	Step      string      `json:"step"`
+	Type      string      `json:"type"`
+	Status    string      `json:"status"`
+	Attempt   int         `json:"attempt"`
+	Output    interface{} `json:"output,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	TimeTaken string      `json:"time_taken,omitempty"`
+}
+
+// WorkflowRun is the result of a run.
+type WorkflowRun struct {
+	Workflow  string                 `json:"workflow"`
+	Output    string                 `json:"output"`
+	Variables map[string]interface{} `json:"variables"`
+	// Trace has the done and failed events of the steps, in order.
+	Trace     []WorkflowEvent `json:"trace"`
+	TimeTaken string          `json:"time_taken"`
+}
+
+// Workflows holds the workflow definitions read from a directory of YAML
+// or JSON files, or from a single file, and runs them.
+type Workflows struct {
+	orus      *Orus
+	mu        sync.RWMutex
+	workflows map[string]*Workflow
+	path      string
+}
+
+// LoadWorkflows returns the workflows defined at path; an empty path
+// defines none.
+func LoadWorkflows(orus *Orus, path string) (*Workflows, error) {
+	workflows := &Workflows{orus: orus, workflows: make(map[string]*Workflow), path: path}
+	if path == "" {
+		return workflows, nil
+	}
+	if err := workflows.Reload(); err != nil {
+		return workflows, err
+	}
+	return workflows, nil
+}
+
+// Reload reads the definitions again and swaps them in. On error the
+// current definitions are kept.
+func (w *Workflows) Reload() error {
+	if w.path == "" {
+		return nil
+	}
+	files := []string{w.path}
+	if info, err := os.Stat(w.path); err != nil {
+		return fmt.Errorf("error reading workflows: %w", err)
+	} else if info.IsDir() {
+		files = nil
+		for _, pattern := range []string{"*.yaml", "*.yml", "*.json"} {
+			matches, _ := filepath.Glob(filepath.Join(w.path, pattern))
+			files = append(files, matches...)
+		}
+	}
+	workflows := make(map[string]*Workflow)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("error reading workflow: %w", err)
+		}
+		// A file holds one workflow or a list of them
+		var list []*Workflow
+		if err := yaml.Unmarshal(data, &list); err != nil {
+			var workflow Workflow
+			if err := yaml.Unmarshal(data, &workflow); err != nil {
+				return fmt.Errorf("error decoding workflow %s: %w", file, err)
+			}
+			list = []*Workflow{&workflow}
+		}
+		for _, workflow := range list {
+			if err := workflow.compile(); err != nil {
+				return fmt.Errorf("%s: %w", file, err)
+			}
+			if _, ok := workflows[workflow.Name]; ok {
+				return fmt.Errorf("%s: workflow %q is defined twice", file, workflow.Name)
+			}
+			workflows[workflow.Name] = workflow
+		}
+	}
+	w.mu.Lock()
+	w.workflows = workflows
+	w.mu.Unlock()
+	return nil
+}
+
+// List returns the workflows sorted by name.
+func (w *Workflows) List() []*Workflow {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	workflows := make([]*Workflow, 0, len(w.workflows))
+	for _, workflow := range w.workflows {
+		workflows = append(workflows, workflow)
+	}
+	sort.Slice(workflows, func(a, b int) bool {
+		return workflows[a].Name < workflows[b].Name
+	})
+	return workflows
+}
+
+func (w *Workflows) Get(name string) (*Workflow, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	workflow, ok := w.workflows[name]
+	return workflow, ok
+}
+
+var workflowFuncs = template.FuncMap{
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+}
+
+// compile checks the definition and parses its templates.
+func (wf *Workflow) compile() error {
+	if !toolNamePattern.MatchString(wf.Name) {
+		return fmt.Errorf("workflow name %q must be 1 to 64 letters, digits, '_' or '-'", wf.Name)
+	}
+	if len(wf.Steps) == 0 {
+		return fmt.Errorf("workflow %q has no steps", wf.Name)
+	}
+	ids := make(map[string]bool)
+	for _, input := range wf.Inputs {
+		ids[input] = true
+	}
+	for i := range wf.Steps {
+		step := &wf.Steps[i]
+		if step.ID == "" {
+			step.ID = fmt.Sprintf("step%d", i+1)
+		}
+		if ids[step.ID] {
+			return fmt.Errorf("workflow %q: step %q reuses the name of an input or step", wf.Name, step.ID)
+		}
+		ids[step.ID] = true
+		if err := step.compile(); err != nil {
+			return fmt.Errorf("workflow %q, step %q: %w", wf.Name, step.ID, err)
+		}
+	}
+	for i, step := range wf.Steps {
+		if step.RetryFrom != "" && (wf.stepIndex(step.RetryFrom) < 0 || wf.stepIndex(step.RetryFrom) > i) {
+			return fmt.Errorf("workflow %q, step %q: retry_from %q is not an earlier step", wf.Name, step.ID, step.RetryFrom)
+		}
+	}
+	if wf.Output != "" {
+		output, err := parseWorkflowTemplate("output", wf.Output)
+		if err != nil {
+			return fmt.Errorf("workflow %q: %w", wf.Name, err)
+		}
+		wf.output = output
+	}
+	return nil
+}
+
+func parseWorkflowTemplate(name, text string) (*template.Template, error) {
+	parsed, err := template.New(name).Funcs(workflowFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template %s: %w", name, err)
+	}
+	return parsed, nil
+}
+
+func (step *WorkflowStep) compile() error {
+	texts := map[string]string{}
+	switch step.Type {
+	case StepRetrieve:
+		texts["query"] = step.Query
+	case StepPrompt:
+		if step.Model == "" {
+			return errors.New("a model is required")
+		}
+		texts["system"], texts["prompt"] = step.System, step.Prompt
+	case StepTool:
+		if step.Tool == "" {
+			return errors.New("a tool is required")
+		}
+		for name, value := range step.Arguments {
+			if text, ok := value.(string); ok {
+				texts["arguments."+name] = text
+			}
+		}
+	case StepValidate:
+		texts["value"] = step.Value
+		if step.Pattern != "" {
+			pattern, err := regexp.Compile(step.Pattern)
+			if err != nil {
+				return fmt.Errorf("invalid pattern: %w", err)
+			}
+			step.pattern = pattern
+		}
+	default:
+		return fmt.Errorf("unknown type %q, expected retrieve, prompt, tool or validate", step.Type)
+	}
+	if step.Retries < 0 {
+		return errors.New("retries must not be negative")
+	}
+	// YAML decodes numbers as ints, which the schema checks read as float64
+	for _, value := range []interface{}{&step.Format, &step.Schema, &step.Arguments} {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, value); err != nil {
+			return err
+		}
+	}
+	step.templates = make(map[string]*template.Template, len(texts))
+	for name, text := range texts {
+		parsed, err := parseWorkflowTemplate(name, text)
+		if err != nil {
+			return err
+		}
+		step.templates[name] = parsed
+	}
+	return nil
+}
+
+func (wf *Workflow) stepIndex(id string) int {
+	for i, step := range wf.Steps {
+		if step.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (step *WorkflowStep) render(name string, variables map[string]interface{}) (string, error) {
+	return renderWorkflowTemplate(step.templates[name], variables)
+}
+
+func renderWorkflowTemplate(parsed *template.Template, variables map[string]interface{}) (string, error) {
+	sb := &bytes.Buffer{}
+	if err := parsed.Execute(sb, variables); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// Run runs the workflow with inputs. onEvent, when not nil, sees every step
+// start, finish or fail. A failed step is run again, or the run goes back
+// to its RetryFrom step, while it has retries left; the run stops at the
+// first step that fails for good.
+func (w *Workflows) Run(ctx context.Context, wf *Workflow, inputs map[string]interface{}, onEvent func(WorkflowEvent)) (*WorkflowRun, error) {
+	startTime := time.Now()
+	run := &WorkflowRun{Workflow: wf.Name, Variables: make(map[string]interface{}), Trace: make([]WorkflowEvent, 0)}
+	for _, input := range wf.Inputs {
+		value, ok := inputs[input]
+		if !ok {
+			return nil, fmt.Errorf("missing input %q", input)
+		}
+		run.Variables[input] = value
+	}
+	emit := func(event WorkflowEvent) {
+		if event.Status != StepStarted {
+			run.Trace = append(run.Trace, event)
+		}
+		if onEvent != nil {
+			onEvent(event)
+		}
+	}
+
+	attempts := make(map[string]int)
+	failures := make(map[string]int)
+	for i := 0; i < len(wf.Steps); i++ {
+		if err := ctx.Err(); err != nil {
+			return run, err
+		}
+		step := &wf.Steps[i]
+		attempts[step.ID]++
+		event := WorkflowEvent{Step: step.ID, Type: step.Type, Attempt: attempts[step.ID]}
+		event.Status = StepStarted
+		emit(event)
+		stepStart := time.Now()
+		output, err := w.runStep(ctx, step, run.Variables)
+		event.TimeTaken = time.Since(stepStart).String()
+		if err != nil {
+			event.Status, event.Error = StepFailed, err.Error()
+			emit(event)
+			failures[step.ID]++
+			if failures[step.ID] > step.Retries || ctx.Err() != nil {
+				run.TimeTaken = time.Since(startTime).String()
+				return run, fmt.Errorf("%w: %s: %v", ErrWorkflowFailed, step.ID, err)
+			}
+			if step.RetryFrom != "" {
+				i = wf.stepIndex(step.RetryFrom) - 1
+			} else {
+				i--
+			}
+			continue
+		}
+		run.Variables[step.ID] = output
+		event.Status, event.Output = StepDone, output
+		emit(event)
+	}
+
+	if wf.output != nil {
+		output, err := renderWorkflowTemplate(wf.output, run.Variables)
+		if err != nil {
+			run.TimeTaken = time.Since(startTime).String()
+			return run, fmt.Errorf("error rendering output: %w", err)
+		}
+		run.Output = output
+	} else {
+		run.Output = workflowText(run.Variables[wf.Steps[len(wf.Steps)-1].ID])
+	}
+	run.TimeTaken = time.Since(startTime).String()
+	return run, nil
+}
+
+func (w *Workflows) runStep(ctx context.Context, step *WorkflowStep, variables map[string]interface{}) (interface{}, error) {
+	switch step.Type {
+	case StepRetrieve:
+		query, err := step.render("query", variables)
+		if err != nil {
+			return nil, err
+		}
+		model := step.EmbedModel
+		if model == "" {
+			model = DefaultRAGEmbedModel
+		}
+		results, err := w.orus.Documents.Retrieve(query, model, step.Limit)
+		if err != nil {
+			return nil, err
+		}
+		sb := &strings.Builder{}
+		for n, result := range results {
+			fmt.Fprintf(sb, "[%d] %s\n\n", n+1, result.Document.Content)
+		}
+		return strings.TrimSpace(sb.String()), nil
+
+	case StepPrompt:
+		system, err := step.render("system", variables)
+		if err != nil {
+			return nil, err
+		}
+		prompt, err := step.render("prompt", variables)
+		if err != nil {
+			return nil, err
+		}
+		req := ollama.ChatRequest{Model: step.Model, Messages: make([]ollama.Message, 0, 2)}
+		if system != "" {
+			req.Messages = append(req.Messages, ollama.Message{Role: "system", Content: system})
+		}
+		req.Messages = append(req.Messages, ollama.Message{Role: "user", Content: prompt})
+		if step.Format != nil {
+			format, err := json.Marshal(step.Format)
+			if err != nil {
+				return nil, err
+			}
+			req.Format = format
+		}
+		client := w.orus.Backend.WithContext(ctx)
+		chat := client.Chat
+		if step.Cloud {
+			chat = client.ChatCloud
+		}
+		response, err := chat(req)
+		if err != nil {
+			return nil, err
+		}
+		if step.Format == nil {
+			return response.Message.Content, nil
+		}
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(response.Message.Content), &decoded); err != nil {
+			return nil, fmt.Errorf("the answer is not JSON: %w", err)
+		}
+		return decoded, nil
+
+	case StepTool:
+		arguments := make(map[string]interface{}, len(step.Arguments))
+		for name, value := range step.Arguments {
+			if _, ok := value.(string); ok {
+				rendered, err := step.render("arguments."+name, variables)
+				if err != nil {
+					return nil, err
+				}
+				value = rendered
+			}
+			arguments[name] = value
+		}
+		result := w.orus.Tools.Execute(ctx, ollama.ToolCall{Function: ollama.ToolCallFunction{Name: step.Tool, Arguments: arguments}})
+		if result.Error != "" {
+			return nil, errors.New(result.Error)
+		}
+		return result.Result, nil
+
+	case StepValidate:
+		value, err := step.render("value", variables)
+		if err != nil {
+			return nil, err
+		}
+		if step.pattern != nil && !step.pattern.MatchString(value) {
+			return nil, fmt.Errorf("the value does not match %s", step.Pattern)
+		}
+		if step.Schema == nil {
+			return value, nil
+		}
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+			return nil, fmt.Errorf("the value is not JSON: %w", err)
+		}
+		if err := ollama.ValidateSchema(step.Schema, decoded); err != nil {
+			return nil, err
+		}
+		return decoded, nil
+	}
+	return nil, fmt.Errorf("unknown step type %q", step.Type)
+}
+
+// workflowText renders a variable as text, encoding the structured ones as
+// JSON.
+func workflowText(value interface{}) string {
+	if text, ok := value.(string); ok {
+		return text
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}